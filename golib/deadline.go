@@ -0,0 +1,65 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// requestBudget tracks the time budget of one request: whether the client set it, and the contexts
+// handlers derived from it, so the deadline middleware can tell a timed-out MinIO call from other
+// failures.
+type requestBudget struct {
+	fromClient bool
+	mu         sync.Mutex
+	ctxs       []context.Context
+}
+
+type budgetKey struct{}
+
+// WithRequestBudget marks ctx as carrying a request budget. fromClient means the client sent its
+// own deadline (ctx already carries it) and RequestContext should not apply server defaults.
+func WithRequestBudget(ctx context.Context, fromClient bool) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &requestBudget{fromClient: fromClient})
+}
+
+// RequestContext returns the context for a handler's MinIO work. When the client set a deadline it
+// is used as-is; otherwise def applies, as handlers did with context.WithTimeout before.
+func RequestContext(r *http.Request, def time.Duration) (context.Context, context.CancelFunc) {
+	parent := r.Context()
+	b, _ := parent.Value(budgetKey{}).(*requestBudget)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if b != nil && b.fromClient {
+		ctx, cancel = context.WithCancel(parent)
+	} else {
+		ctx, cancel = context.WithTimeout(parent, def)
+	}
+	if b != nil {
+		b.mu.Lock()
+		b.ctxs = append(b.ctxs, ctx)
+		b.mu.Unlock()
+	}
+	return ctx, cancel
+}
+
+// BudgetExceeded reports whether ctx, or a context RequestContext derived from it, ran out of time.
+func BudgetExceeded(ctx context.Context) bool {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return true
+	}
+	b, _ := ctx.Value(budgetKey{}).(*requestBudget)
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.ctxs {
+		if errors.Is(c.Err(), context.DeadlineExceeded) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package golib
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// minioCodeStatus maps S3 error codes to the status a client of the proxy should see.
+var minioCodeStatus = map[string]int{
+	"NoSuchKey":     http.StatusNotFound,
+	"NoSuchBucket":  http.StatusNotFound,
+	"NoSuchVersion": http.StatusNotFound,
+	"NoSuchUpload":  http.StatusNotFound,
+
+	"AccessDenied":          http.StatusForbidden,
+	"AllAccessDisabled":     http.StatusForbidden,
+	"InvalidAccessKeyId":    http.StatusForbidden,
+	"SignatureDoesNotMatch": http.StatusForbidden,
+
+	"BucketNotEmpty":     http.StatusConflict,
+	"OperationAborted":   http.StatusConflict,
+	"InvalidObjectState": http.StatusConflict,
+	"ObjectLocked":       http.StatusConflict,
+
+	"PreconditionFailed": http.StatusPreconditionFailed,
+
+	"SlowDown":                   http.StatusServiceUnavailable,
+	"ServiceUnavailable":         http.StatusServiceUnavailable,
+	"XMinioServerNotInitialized": http.StatusServiceUnavailable,
+	"XMinioStorageFull":          http.StatusServiceUnavailable,
+}
+
+// MinioErrorResponse returns the S3 error behind err, also when it was wrapped with %w.
+func MinioErrorResponse(err error) minio.ErrorResponse {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp
+	}
+	return minio.ToErrorResponse(err)
+}
+
+// MinioStatus classifies an error from a MinIO call: 404 (missing key or bucket), 403 (denied),
+// 409 (object locked, bucket not empty, conflicting operation), 412 (a conditional write found the
+// object changed), 503 (MinIO overloaded, starting or unreachable) and 500 for everything else.
+// Timeouts count as unreachable.
+func MinioStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	resp := MinioErrorResponse(err)
+	if status, ok := minioCodeStatus[resp.Code]; ok {
+		return status
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusForbidden, http.StatusConflict, http.StatusServiceUnavailable:
+		return resp.StatusCode
+	}
+	var netErr net.Error
+	if resp.Code == "" && errors.As(err, &netErr) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// IsNotFound reports whether err means the object (or its bucket) does not exist.
+func IsNotFound(err error) bool {
+	return err != nil && MinioStatus(err) == http.StatusNotFound
+}
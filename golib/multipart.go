@@ -0,0 +1,81 @@
+package golib
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// DefaultMultipartMemory is the part of a multipart form held in memory when MultipartLimits.MaxMemory is 0;
+// the rest spills to temp files.
+const DefaultMultipartMemory = 50 << 20
+
+// multipartFieldSlack is the room left for non-file fields when the total body size is derived from
+// MaxFiles * MaxFileBytes.
+const multipartFieldSlack = 1 << 20
+
+// MultipartLimits bounds multipart/form-data parsing. The zero value keeps net/http's behavior with a
+// 50 MB memory limit and no caps on file size or count.
+type MultipartLimits struct {
+	// MaxMemory is held in memory before parts spill to temp files (0 = DefaultMultipartMemory).
+	MaxMemory int64
+	// MaxFileBytes caps each uploaded file (0 = unlimited).
+	MaxFileBytes int64
+	// MaxFiles caps the number of file parts across all fields (0 = unlimited).
+	MaxFiles int
+}
+
+// MultipartLimitError reports a form that exceeded MultipartLimits; handlers answer it with 413.
+type MultipartLimitError struct {
+	Msg string
+}
+
+func (e *MultipartLimitError) Error() string { return e.Msg }
+
+// IsMultipartLimit reports whether err came from a MultipartLimits cap.
+func IsMultipartLimit(err error) bool {
+	var le *MultipartLimitError
+	return errors.As(err, &le)
+}
+
+// ParseMultipartForm parses r's multipart form and enforces the limits. When both MaxFiles and
+// MaxFileBytes are set the body itself is capped, so an oversized request is cut off while it is read
+// instead of after it has been spooled to disk. Violations return *MultipartLimitError and remove any
+// temp files; other errors are returned unchanged. When r's context comes from WithCleanup the
+// form's temp files are also removed when the request ends, even if the handler panics.
+func (l MultipartLimits) ParseMultipartForm(w http.ResponseWriter, r *http.Request) error {
+	maxMemory := l.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = DefaultMultipartMemory
+	}
+	var maxBody int64
+	if l.MaxFiles > 0 && l.MaxFileBytes > 0 {
+		maxBody = int64(l.MaxFiles)*l.MaxFileBytes + multipartFieldSlack
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	}
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return &MultipartLimitError{Msg: fmt.Sprintf("request body exceeds %d bytes (%d files of at most %d bytes)", maxBody, l.MaxFiles, l.MaxFileBytes)}
+		}
+		return err
+	}
+	form := r.MultipartForm
+	AddCleanup(r.Context(), func() { form.RemoveAll() })
+
+	files := 0
+	for field, fhs := range r.MultipartForm.File {
+		files += len(fhs)
+		for _, fh := range fhs {
+			if l.MaxFileBytes > 0 && fh.Size > l.MaxFileBytes {
+				r.MultipartForm.RemoveAll()
+				return &MultipartLimitError{Msg: fmt.Sprintf("file %q in field %q is %d bytes, limit is %d", fh.Filename, field, fh.Size, l.MaxFileBytes)}
+			}
+		}
+	}
+	if l.MaxFiles > 0 && files > l.MaxFiles {
+		r.MultipartForm.RemoveAll()
+		return &MultipartLimitError{Msg: fmt.Sprintf("%d files in form, limit is %d", files, l.MaxFiles)}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package golib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// multipartTempPattern is the prefix mime/multipart gives the files it spills to disk.
+const multipartTempPattern = "multipart-"
+
+// UseMultipartTempDir makes multipart parsing spill file parts beyond MultipartLimits.MaxMemory into
+// dir. mime/multipart always writes to os.TempDir, so this sets TMPDIR for the whole process; call it
+// once at startup. dir is created with mode 0700 if missing.
+func UseMultipartTempDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create multipart temp dir: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".probe-")
+	if err != nil {
+		return fmt.Errorf("multipart temp dir %q is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return os.Setenv("TMPDIR", dir)
+}
+
+// SweepMultipartTemp removes spilled multipart files in dir older than maxAge, left behind when the
+// process was killed mid-request. It returns the number of files removed.
+func SweepMultipartTemp(dir string, maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), multipartTempPattern) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, e.Name())) == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+type cleanupKey struct{}
+
+type cleanupList struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// WithCleanup returns a context that collects cleanup functions (see AddCleanup) and a done func that
+// runs them in reverse order. Call done in a defer so it also runs when the handler panics.
+func WithCleanup(ctx context.Context) (context.Context, func()) {
+	l := &cleanupList{}
+	return context.WithValue(ctx, cleanupKey{}, l), func() {
+		l.mu.Lock()
+		fns := l.fns
+		l.fns = nil
+		l.mu.Unlock()
+		for i := len(fns) - 1; i >= 0; i-- {
+			fns[i]()
+		}
+	}
+}
+
+// AddCleanup registers fn to run when the request started with WithCleanup finishes. It reports
+// false when ctx carries no cleanup list, in which case fn is not registered.
+func AddCleanup(ctx context.Context, fn func()) bool {
+	l, ok := ctx.Value(cleanupKey{}).(*cleanupList)
+	if !ok {
+		return false
+	}
+	l.mu.Lock()
+	l.fns = append(l.fns, fn)
+	l.mu.Unlock()
+	return true
+}
@@ -0,0 +1,116 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSaturated is returned by Semaphore.Acquire when no slot frees up in time or the wait queue is full.
+var ErrSaturated = errors.New("semaphore saturated")
+
+// Semaphore limits concurrent work to a fixed number of slots with a bounded wait queue.
+// A nil *Semaphore is unlimited: Acquire always succeeds and Release is a no-op.
+type Semaphore struct {
+	slots    chan struct{}
+	waiting  atomic.Int64
+	maxQueue int64
+	timeout  time.Duration
+}
+
+// NewSemaphore returns a semaphore with limit slots; up to maxQueue callers may wait at most timeout
+// for a slot. limit <= 0 returns nil (unlimited).
+func NewSemaphore(limit, maxQueue int, timeout time.Duration) *Semaphore {
+	if limit <= 0 {
+		return nil
+	}
+	return &Semaphore{slots: make(chan struct{}, limit), maxQueue: int64(maxQueue), timeout: timeout}
+}
+
+// Acquire takes a slot, waiting in the queue if all are busy. It returns ErrSaturated when the queue
+// is full or the wait times out, and ctx.Err() when ctx is done first.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	if s.tryAcquire() {
+		return nil
+	}
+	if s.waiting.Add(1) > s.maxQueue {
+		s.waiting.Add(-1)
+		return ErrSaturated
+	}
+	defer s.waiting.Add(-1)
+
+	t := time.NewTimer(s.timeout)
+	defer t.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-t.C:
+		return ErrSaturated
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AcquireUpTo takes between 1 and n slots for a batch of n jobs: it waits for the first one like
+// Acquire, then takes whatever other slots are free right now, up to n. Run the batch with as many
+// workers as it returns and hand them all back with ReleaseN. Taking the slots up front means a
+// batch is refused as a whole, before any of it ran; not waiting for more than one means two
+// batches can't each hold part of the slots while waiting for the rest. n <= 0 takes nothing.
+func (s *Semaphore) AcquireUpTo(ctx context.Context, n int) (int, error) {
+	if s == nil || n <= 0 {
+		return max(n, 0), nil
+	}
+	if err := s.Acquire(ctx); err != nil {
+		return 0, err
+	}
+	taken := 1
+	for taken < n && s.tryAcquire() {
+		taken++
+	}
+	return taken, nil
+}
+
+// tryAcquire takes a slot if one is free, without waiting.
+func (s *Semaphore) tryAcquire() bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReleaseN frees n slots taken by AcquireUpTo.
+func (s *Semaphore) ReleaseN(n int) {
+	for range n {
+		s.Release()
+	}
+}
+
+// Release frees a slot taken by a successful Acquire.
+func (s *Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// RetryAfter is a hint, in whole seconds, for clients rejected with ErrSaturated.
+func (s *Semaphore) RetryAfter() int {
+	if s == nil {
+		return 0
+	}
+	return max(1, int(s.timeout.Seconds()))
+}
+
+// InUse returns the number of slots currently taken.
+func (s *Semaphore) InUse() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.slots)
+}
@@ -0,0 +1,100 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphore_AcquireRelease(t *testing.T) {
+	s := NewSemaphore(2, 0, time.Millisecond)
+	ctx := context.Background()
+	for i := range 2 {
+		if err := s.Acquire(ctx); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	if s.InUse() != 2 {
+		t.Errorf("InUse = %d, want 2", s.InUse())
+	}
+	if err := s.Acquire(ctx); !errors.Is(err, ErrSaturated) {
+		t.Errorf("acquire with no queue: %v, want ErrSaturated", err)
+	}
+	s.Release()
+	if err := s.Acquire(ctx); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+}
+
+func TestSemaphore_Queue(t *testing.T) {
+	s := NewSemaphore(1, 1, time.Second)
+	ctx := context.Background()
+	s.Acquire(ctx)
+
+	got := make(chan error)
+	go func() { got <- s.Acquire(ctx) }()
+	for s.waiting.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Acquire(ctx); !errors.Is(err, ErrSaturated) {
+		t.Errorf("acquire with a full queue: %v, want ErrSaturated", err)
+	}
+	s.Release()
+	if err := <-got; err != nil {
+		t.Errorf("queued acquire: %v", err)
+	}
+
+	s.timeout = 10 * time.Millisecond
+	if err := s.Acquire(ctx); !errors.Is(err, ErrSaturated) {
+		t.Errorf("acquire past the timeout: %v, want ErrSaturated", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	s.timeout = time.Second
+	if err := s.Acquire(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("acquire with a done context: %v, want context.Canceled", err)
+	}
+	if s.InUse() != 1 || s.waiting.Load() != 0 {
+		t.Errorf("InUse = %d, waiting = %d after failed acquires", s.InUse(), s.waiting.Load())
+	}
+}
+
+func TestSemaphore_AcquireUpTo(t *testing.T) {
+	s := NewSemaphore(3, 0, time.Millisecond)
+	ctx := context.Background()
+	if n, err := s.AcquireUpTo(ctx, 5); n != 3 || err != nil {
+		t.Errorf("batch of 5 with 3 free slots: %d, %v", n, err)
+	}
+	if n, err := s.AcquireUpTo(ctx, 2); n != 0 || !errors.Is(err, ErrSaturated) {
+		t.Errorf("batch with no free slot: %d, %v", n, err)
+	}
+	s.ReleaseN(2)
+	if n, err := s.AcquireUpTo(ctx, 1); n != 1 || err != nil {
+		t.Errorf("batch of 1: %d, %v", n, err)
+	}
+	if n, err := s.AcquireUpTo(ctx, 0); n != 0 || err != nil {
+		t.Errorf("empty batch: %d, %v", n, err)
+	}
+	if s.InUse() != 2 {
+		t.Errorf("InUse = %d, want 2", s.InUse())
+	}
+}
+
+func TestSemaphore_Nil(t *testing.T) {
+	var s *Semaphore
+	if NewSemaphore(0, 10, time.Second) != nil {
+		t.Error("NewSemaphore(0) is not unlimited")
+	}
+	if err := s.Acquire(context.Background()); err != nil {
+		t.Errorf("nil Acquire: %v", err)
+	}
+	if n, err := s.AcquireUpTo(context.Background(), 7); n != 7 || err != nil {
+		t.Errorf("nil AcquireUpTo: %d, %v", n, err)
+	}
+	s.Release()
+	s.ReleaseN(7)
+	if s.InUse() != 0 || s.RetryAfter() != 0 {
+		t.Errorf("nil InUse = %d, RetryAfter = %d", s.InUse(), s.RetryAfter())
+	}
+}
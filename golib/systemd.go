@@ -0,0 +1,84 @@
+package golib
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes (SD_LISTEN_FDS_START).
+const sdListenFDsStart = 3
+
+// SystemdListeners returns the sockets passed by systemd socket activation (LISTEN_FDS), nil
+// when the process was not socket-activated. The LISTEN_* variables are cleared so child
+// processes don't pick the sockets up.
+func SystemdListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	lns := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(sdListenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(sdListenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener dups the descriptor
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+// SdNotify sends state (e.g. "READY=1") to the service manager. It reports false without error
+// when NOTIFY_SOCKET is unset, i.e. when not running under systemd with Type=notify.
+func SdNotify(state string) (bool, error) {
+	sock := os.Getenv("NOTIFY_SOCKET")
+	if sock == "" {
+		return false, nil
+	}
+	if strings.HasPrefix(sock, "@") {
+		sock = "\x00" + sock[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval returns how often systemd expects WATCHDOG=1 (WatchdogSec=), 0 when the
+// watchdog is off or meant for another process.
+func SdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
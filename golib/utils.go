@@ -3,7 +3,9 @@ package golib
 import (
 	log "log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func GetEnv(key, fallback string) string {
@@ -13,6 +15,34 @@ func GetEnv(key, fallback string) string {
 	return fallback
 }
 
+// GetEnvInt parses key as an int, returning fallback when unset or invalid.
+func GetEnvInt(key string, fallback int) int {
+	v := GetEnv(key, "")
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("env %s=%q is not an int, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+// GetEnvDuration parses key with time.ParseDuration (e.g. "10m"), returning fallback when unset or invalid.
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := GetEnv(key, "")
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("env %s=%q is not a duration, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
 func ConsoleLog(format string, a ...any) {
 	log.Printf(format+"\n", a...)
 }
@@ -0,0 +1,9 @@
+//go:build heic && cgo
+
+package kzenimage
+
+// Registers the "heic" image format (HEIC/HEIF and AVIF stills) with image.Decode. The decoder
+// bundles libde265 and dav1d, so it needs cgo and a C/C++ toolchain: build with -tags heic.
+import _ "github.com/jdeng/goheif"
+
+const HEICSupported = true
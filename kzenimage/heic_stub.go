@@ -0,0 +1,6 @@
+//go:build !(heic && cgo)
+
+package kzenimage
+
+// HEICSupported reports whether this build can decode HEIC images (see heic.go).
+const HEICSupported = false
@@ -0,0 +1,299 @@
+// Package kzenimage is the raster image pipeline of the kzen upload endpoints: oversized images are
+// downscaled and re-encoded, HEIC is converted to JPEG, and images over the configured limits are
+// rejected before they are decoded. Other kzen services use it to process images offline exactly
+// as an upload would be.
+package kzenimage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+
+	"kzen-go/golib"
+)
+
+const (
+	// DefaultMaxEdgePx is the longest side kept when Options.MaxEdgePx is unset.
+	DefaultMaxEdgePx = 4096
+	// DefaultJPEGQuality is used when Options.JPEGQuality is unset.
+	DefaultJPEGQuality = 100
+)
+
+// Options configures how raster images are processed; the zero value downscales to 4096 px,
+// encodes JPEG at quality 100 and has no limits.
+type Options struct {
+	// MaxEdgePx is the longest side an image may have before it is downscaled.
+	MaxEdgePx int
+	// JPEGQuality (1-100) is used when an image is re-encoded as JPEG.
+	JPEGQuality int
+	// Format forces the output format, "jpeg" or "png", converting images in any other format
+	// even when they fit. The default "" keeps PNG as PNG and re-encodes everything else as JPEG.
+	Format string
+	// AlphaBackground is composited under transparent images that would be re-encoded as JPEG;
+	// nil stores them as PNG instead, keeping the transparency (or uses white with Format "jpeg").
+	AlphaBackground *color.RGBA
+	// IgnoreOrientation keeps the stored pixel layout of re-encoded JPEGs. By default their EXIF
+	// orientation is applied, since the encoder drops EXIF and the image would otherwise show rotated.
+	IgnoreOrientation bool
+	// MaxDimensionPx rejects images wider or taller than this before decoding; 0 means no limit.
+	MaxDimensionPx int
+	// MaxDecodedBytes rejects images whose decoded pixels (width × height × 4) would take more
+	// memory than this, so a small file can't expand into gigabytes; 0 means no limit.
+	MaxDecodedBytes int64
+	// Workers bounds concurrent decode/resize/encode work across all callers, so one large batch
+	// can't take every CPU; nil means unbounded.
+	Workers *golib.Semaphore
+}
+
+// LimitError is returned for an image rejected by the size limits.
+type LimitError struct {
+	Filename      string
+	Width, Height int
+	Reason        string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("image %q is %dx%d px: %s", e.Filename, e.Width, e.Height, e.Reason)
+}
+
+// checkLimits rejects images whose header cfg is over o's limits.
+func (o Options) checkLimits(cfg image.Config, filename string) error {
+	limitErr := &LimitError{Filename: filename, Width: cfg.Width, Height: cfg.Height}
+	if o.MaxDimensionPx > 0 && (cfg.Width > o.MaxDimensionPx || cfg.Height > o.MaxDimensionPx) {
+		limitErr.Reason = fmt.Sprintf("larger than %d px", o.MaxDimensionPx)
+		return limitErr
+	}
+	if o.MaxDecodedBytes > 0 && int64(cfg.Width)*int64(cfg.Height)*4 > o.MaxDecodedBytes {
+		limitErr.Reason = fmt.Sprintf("more than %d bytes once decoded", o.MaxDecodedBytes)
+		return limitErr
+	}
+	return nil
+}
+
+func (o Options) maxEdge() int {
+	if o.MaxEdgePx <= 0 {
+		return DefaultMaxEdgePx
+	}
+	return o.MaxEdgePx
+}
+
+func (o Options) quality() int {
+	if o.JPEGQuality <= 0 || o.JPEGQuality > 100 {
+		return DefaultJPEGQuality
+	}
+	return o.JPEGQuality
+}
+
+// needsWork reports whether an image in format with the given size has to be re-encoded.
+// Browsers can't show HEIC, so it is always converted, like an oversized image.
+func (o Options) needsWork(format string, w, h int) bool {
+	maxEdge := o.maxEdge()
+	return format == "heic" || w > maxEdge || h > maxEdge || (o.Format != "" && o.Format != format)
+}
+
+// ParseHexColor parses "#rrggbb" or "rrggbb"; "" yields nil.
+func ParseHexColor(s string) (*color.RGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return nil, fmt.Errorf("color %q must be #rrggbb", s)
+	}
+	return &color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// Process runs the image in data, named filename, through the pipeline. Images that need no work
+// are returned as they are, without being decoded; so are files that can't be decoded, which are
+// logged. Images over o's limits yield a *LimitError, and decoding waits for one of o.Workers; the
+// error then wraps golib.ErrSaturated or ctx.Err().
+//
+// A re-encoded image is streamed while the Result is read, and the worker is held until then;
+// the Result must be closed.
+func Process(ctx context.Context, data []byte, filename string, o Options) (*Result, error) {
+	if o.Format != "" && o.Format != "jpeg" && o.Format != "png" {
+		return nil, fmt.Errorf("kzenimage: unsupported output format %q", o.Format)
+	}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		if err := o.checkLimits(cfg, filename); err != nil {
+			return nil, err
+		}
+		if !o.needsWork(format, cfg.Width, cfg.Height) {
+			return Unchanged(data, contentTypeForFormat(format, filename)), nil
+		}
+	}
+
+	if err := o.Workers.Acquire(ctx); err != nil {
+		return nil, fmt.Errorf("image workers: %w", err)
+	}
+	streaming := false
+	defer func() {
+		if !streaming {
+			o.Workers.Release()
+		}
+	}()
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		contentType := contentTypeForFormat("", filename)
+		if IsHEIC(contentType, data) && !HEICSupported {
+			log.Printf("kzenimage: %q is HEIC, which this build cannot decode (build with -tags heic), keeping it unchanged", filename)
+		} else {
+			log.Printf("kzenimage: decode %q failed: %v, keeping it unchanged", filename, err)
+		}
+		if contentType == "application/octet-stream" {
+			contentType = http.DetectContentType(data)
+		}
+		return Unchanged(data, contentType), nil
+	}
+
+	bounds := img.Bounds()
+	if !o.needsWork(format, bounds.Dx(), bounds.Dy()) {
+		return Unchanged(data, contentTypeForFormat(format, filename)), nil
+	}
+
+	// Only the resized copy is kept from here on, so the decoded original can be collected
+	// while the result is encoded.
+	maxEdge := o.maxEdge()
+	resized := Resize(img, maxEdge, maxEdge)
+	img = nil
+	if format == "jpeg" && !o.IgnoreOrientation {
+		resized = orient(resized, jpegOrientation(data))
+	}
+	out, outFormat := outputFormat(resized, format, o)
+	streaming = true
+	body := encodeStream(out, outFormat, o, func() {
+		releaseRGBA(out)
+		o.Workers.Release()
+	})
+	return &Result{ReadCloser: body, Size: -1, ContentType: "image/" + outFormat, Changed: true}, nil
+}
+
+// ProcessBytes is Process for callers that want the whole output in memory.
+func ProcessBytes(ctx context.Context, data []byte, filename string, o Options) ([]byte, string, error) {
+	res, err := Process(ctx, data, filename, o)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Close()
+	if !res.Changed {
+		return data, res.ContentType, nil
+	}
+	out, err := io.ReadAll(res)
+	return out, res.ContentType, err
+}
+
+// Resize scales img to fit within maxW×maxH while preserving aspect ratio.
+// If the image already fits, it is returned unchanged (no enlargement).
+func Resize(img image.Image, maxW, maxH int) image.Image {
+	bounds := img.Bounds()
+	origW := bounds.Dx()
+	origH := bounds.Dy()
+	if origW <= maxW && origH <= maxH {
+		return img
+	}
+
+	scaleW := float64(maxW) / float64(origW)
+	scaleH := float64(maxH) / float64(origH)
+	scale := scaleW
+	if scaleH < scaleW {
+		scale = scaleH
+	}
+
+	newW := int(float64(origW) * scale)
+	newH := int(float64(origH) * scale)
+	if newW < 1 {
+		newW = 1
+	}
+	if newH < 1 {
+		newH = 1
+	}
+
+	dst := newRGBA(image.Rect(0, 0, newW, newH))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Over, nil)
+	return dst
+}
+
+func contentTypeForFormat(format, filename string) string {
+	switch format {
+	case "jpeg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	case "gif":
+		return "image/gif"
+	case "webp":
+		return "image/webp"
+	case "heic":
+		return "image/heic"
+	default:
+		switch strings.ToLower(path.Ext(filename)) {
+		case ".jpg", ".jpeg":
+			return "image/jpeg"
+		case ".png":
+			return "image/png"
+		case ".gif":
+			return "image/gif"
+		case ".webp":
+			return "image/webp"
+		case ".heic":
+			return "image/heic"
+		case ".heif":
+			return "image/heif"
+		default:
+			return "application/octet-stream"
+		}
+	}
+}
+
+// IsHEIC reports whether data looks like a HEIC/HEIF file (an ISO BMFF "ftyp" box with a HEIF brand).
+func IsHEIC(contentType string, data []byte) bool {
+	if contentType == "image/heic" || contentType == "image/heif" {
+		return true
+	}
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	switch string(data[8:12]) {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+		return true
+	}
+	return false
+}
+
+// hasTransparency reports whether any pixel of img is not fully opaque.
+func hasTransparency(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flatten draws img over a solid bg, for encoders without an alpha channel.
+func flatten(img image.Image, bg color.RGBA) image.Image {
+	b := img.Bounds()
+	dst := newRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
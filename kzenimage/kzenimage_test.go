@@ -0,0 +1,215 @@
+package kzenimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"kzen-go/golib"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func opaque(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+// withOrientation returns a JPEG of img with an EXIF APP1 segment carrying orientation o.
+func withOrientation(t *testing.T, img image.Image, o uint16, order binary.AppendByteOrder) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	if order == binary.LittleEndian {
+		tiff = []byte("II\x2a\x00\x08\x00\x00\x00")
+	}
+	tiff = order.AppendUint16(tiff, 1)      // one IFD0 entry
+	tiff = order.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = order.AppendUint16(tiff, 3)      // SHORT
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, o)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // value padding, no next IFD
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xff, 0xe1}, uint16(len(seg)+2))
+	app1 = append(app1, seg...)
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func decodeConfig(t *testing.T, data []byte) (image.Config, string) {
+	t.Helper()
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, format
+}
+
+func TestProcess_KeepsImagesThatFit(t *testing.T) {
+	data := encodePNG(t, opaque(100, 50))
+	res, err := Process(context.Background(), data, "a.png", Options{MaxEdgePx: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if res.Changed || res.Size != int64(len(data)) || res.ContentType != "image/png" {
+		t.Errorf("result = %+v, want the upload unchanged", res)
+	}
+}
+
+func TestProcess_DownscalesOversized(t *testing.T) {
+	out, contentType, err := ProcessBytes(context.Background(), encodePNG(t, opaque(300, 150)), "a.png", Options{MaxEdgePx: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, format := decodeConfig(t, out)
+	if contentType != "image/png" || format != "png" || cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("got %s %dx%d (%s)", format, cfg.Width, cfg.Height, contentType)
+	}
+}
+
+func TestProcess_Limits(t *testing.T) {
+	data := encodePNG(t, opaque(300, 10))
+	for _, o := range []Options{{MaxDimensionPx: 200}, {MaxDecodedBytes: 300*10*4 - 1}} {
+		_, err := Process(context.Background(), data, "a.png", o)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Width != 300 || limitErr.Height != 10 {
+			t.Errorf("%+v: err = %v, want a LimitError", o, err)
+		}
+	}
+}
+
+func TestProcess_Format(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	out, contentType, err := ProcessBytes(context.Background(), encodePNG(t, transparent), "a.png", Options{Format: "jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, format := decodeConfig(t, out); format != "jpeg" || contentType != "image/jpeg" {
+		t.Errorf("Format jpeg: got %s (%s)", format, contentType)
+	}
+	img, _ := jpeg.Decode(bytes.NewReader(out))
+	if r, g, b, _ := img.At(5, 5).RGBA(); r>>8 < 0xf0 || g>>8 < 0xf0 || b>>8 < 0xf0 {
+		t.Errorf("transparent pixel flattened to %d,%d,%d, want white", r>>8, g>>8, b>>8)
+	}
+
+	out, contentType, err = ProcessBytes(context.Background(), withOrientation(t, opaque(20, 10), 1, binary.BigEndian), "a.jpg", Options{Format: "png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, format := decodeConfig(t, out); format != "png" || contentType != "image/png" {
+		t.Errorf("Format png: got %s (%s)", format, contentType)
+	}
+
+	if _, err := Process(context.Background(), out, "a.png", Options{Format: "tiff"}); err == nil {
+		t.Error("unsupported Format accepted")
+	}
+}
+
+func TestProcess_Transparency(t *testing.T) {
+	pal := color.Palette{color.Transparent, color.White}
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 200, 100), pal), nil); err != nil {
+		t.Fatal(err)
+	}
+	_, contentType, err := ProcessBytes(context.Background(), buf.Bytes(), "a.gif", Options{MaxEdgePx: 100})
+	if err != nil || contentType != "image/png" {
+		t.Errorf("transparent GIF = %q, %v; want image/png", contentType, err)
+	}
+	bg := &color.RGBA{A: 0xff}
+	_, contentType, err = ProcessBytes(context.Background(), buf.Bytes(), "a.gif", Options{MaxEdgePx: 100, AlphaBackground: bg})
+	if err != nil || contentType != "image/jpeg" {
+		t.Errorf("transparent GIF with background = %q, %v; want image/jpeg", contentType, err)
+	}
+}
+
+func TestProcess_Orientation(t *testing.T) {
+	for _, order := range []binary.AppendByteOrder{binary.BigEndian, binary.LittleEndian} {
+		data := withOrientation(t, opaque(200, 100), 6, order)
+		if o := jpegOrientation(data); o != 6 {
+			t.Fatalf("%v: jpegOrientation = %d, want 6", order, o)
+		}
+		out, _, err := ProcessBytes(context.Background(), data, "a.jpg", Options{MaxEdgePx: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg, _ := decodeConfig(t, out); cfg.Width != 50 || cfg.Height != 100 {
+			t.Errorf("%v: rotated image is %dx%d, want 50x100", order, cfg.Width, cfg.Height)
+		}
+	}
+
+	data := withOrientation(t, opaque(200, 100), 6, binary.BigEndian)
+	out, _, err := ProcessBytes(context.Background(), data, "a.jpg", Options{MaxEdgePx: 100, IgnoreOrientation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ := decodeConfig(t, out); cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("IgnoreOrientation: image is %dx%d, want 100x50", cfg.Width, cfg.Height)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 2x1: red, blue. Orientation 6 shows it rotated clockwise: red on top of blue.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 0xff, A: 0xff})
+	src.Set(1, 0, color.RGBA{B: 0xff, A: 0xff})
+	cases := map[int][]color.RGBA{
+		2: {{B: 0xff, A: 0xff}, {R: 0xff, A: 0xff}},
+		6: {{R: 0xff, A: 0xff}, {B: 0xff, A: 0xff}},
+		8: {{B: 0xff, A: 0xff}, {R: 0xff, A: 0xff}},
+	}
+	for o, want := range cases {
+		in := image.NewRGBA(src.Rect)
+		copy(in.Pix, src.Pix)
+		got := orient(in, o)
+		var pixels []color.RGBA
+		b := got.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				pixels = append(pixels, got.At(x, y).(color.RGBA))
+			}
+		}
+		if len(pixels) != len(want) || pixels[0] != want[0] || pixels[1] != want[1] {
+			t.Errorf("orientation %d: pixels %v, want %v", o, pixels, want)
+		}
+	}
+}
+
+func TestProcess_WorkersSaturated(t *testing.T) {
+	workers := golib.NewSemaphore(1, 0, 0)
+	o := Options{MaxEdgePx: 10, Workers: workers}
+	data := encodePNG(t, opaque(100, 100))
+	held, err := Process(context.Background(), data, "a.png", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Process(context.Background(), data, "b.png", o); !errors.Is(err, golib.ErrSaturated) {
+		t.Errorf("second image while the worker streams: err = %v, want ErrSaturated", err)
+	}
+	held.Close()
+	res, err := Process(context.Background(), data, "c.png", o)
+	if err != nil {
+		t.Fatalf("worker not released by Close: %v", err)
+	}
+	res.Close()
+}
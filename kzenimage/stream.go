@@ -0,0 +1,104 @@
+package kzenimage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sync"
+)
+
+// Result is the output of Process: the input itself, or a re-encoded image produced while it is
+// read. It must be closed, which also stops an unfinished encode.
+type Result struct {
+	io.ReadCloser
+	// Size is -1 while a re-encoded image is being streamed.
+	Size        int64
+	ContentType string
+	// Changed is false when the input is returned as it was.
+	Changed bool
+}
+
+// Unchanged wraps data, which needs no processing, as a Result.
+func Unchanged(data []byte, contentType string) *Result {
+	return &Result{ReadCloser: io.NopCloser(bytes.NewReader(data)), Size: int64(len(data)), ContentType: contentType}
+}
+
+// rgbaPool recycles the pixel buffers of resized images; at the default 4096 px edge each is up
+// to 64 MB, which would otherwise be allocated anew for every large photo.
+var rgbaPool sync.Pool
+
+// newRGBA returns a cleared RGBA image with bounds r, reusing a pooled buffer when one is big enough.
+func newRGBA(r image.Rectangle) *image.RGBA {
+	n := 4 * r.Dx() * r.Dy()
+	if img, ok := rgbaPool.Get().(*image.RGBA); ok && cap(img.Pix) >= n {
+		img.Pix = img.Pix[:n]
+		clear(img.Pix)
+		img.Stride = 4 * r.Dx()
+		img.Rect = r
+		return img
+	}
+	return image.NewRGBA(r)
+}
+
+// releaseRGBA returns img's buffer to the pool when it came from newRGBA; img must not be used after.
+func releaseRGBA(img image.Image) {
+	if rgba, ok := img.(*image.RGBA); ok {
+		rgbaPool.Put(rgba)
+	}
+}
+
+// outputFormat picks how img is encoded: o.Format when set, otherwise PNG input stays PNG and
+// everything else becomes JPEG. Transparent images that would become JPEG are flattened onto
+// o.AlphaBackground, or stay PNG without one unless Format forces JPEG (flattened onto white).
+func outputFormat(img image.Image, format string, o Options) (image.Image, string) {
+	if o.Format == "png" || (o.Format == "" && format == "png") {
+		return img, "png"
+	}
+	if !hasTransparency(img) {
+		return img, "jpeg"
+	}
+	bg := o.AlphaBackground
+	if bg == nil {
+		if o.Format != "jpeg" {
+			return img, "png"
+		}
+		bg = &color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	}
+	flat := flatten(img, *bg)
+	releaseRGBA(img)
+	return flat, "jpeg"
+}
+
+// encodeStream encodes img as format ("png" or "jpeg") into the returned reader while it is read,
+// so the encoded image is never held in memory as a whole. done runs when encoding ends; closing
+// the reader early stops the encoder and waits for done.
+func encodeStream(img image.Image, format string, o Options, done func()) io.ReadCloser {
+	pr, pw := io.Pipe()
+	s := &encodedStream{PipeReader: pr, finished: make(chan struct{})}
+	go func() {
+		defer close(s.finished)
+		defer done()
+		var err error
+		if format == "png" {
+			err = png.Encode(pw, img)
+		} else {
+			err = jpeg.Encode(pw, img, &jpeg.Options{Quality: o.quality()})
+		}
+		pw.CloseWithError(err)
+	}()
+	return s
+}
+
+type encodedStream struct {
+	*io.PipeReader
+	finished chan struct{}
+}
+
+func (s *encodedStream) Close() error {
+	err := s.PipeReader.Close()
+	<-s.finished
+	return err
+}
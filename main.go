@@ -1,28 +1,297 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/fs"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 
-	"kzen-go/minioserver"
 	"kzen-go/golib"
+	"kzen-go/minioserver"
 )
 
 func main() {
 	_ = godotenv.Load()
 
+	mounts, err := minioserver.ParseMounts(golib.GetEnv("MOUNTS", ""))
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	seedAssets, err := minioserver.ParseSeedAssets(golib.GetEnv("SEED_ASSETS", ""))
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	tenants, err := minioserver.ParseTenants(golib.GetEnv("TENANTS", ""))
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	apiKeysRaw := golib.GetEnv("API_KEYS", "")
+	apiKeys, err := minioserver.ParseAPIKeys(apiKeysRaw)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	var apiKeysFile string // "@path" values are watched for rotation
+	if file, ok := strings.CutPrefix(strings.TrimSpace(apiKeysRaw), "@"); ok {
+		apiKeysFile = file
+	}
+
+	trustedProxies, err := minioserver.ParseTrustedProxies(golib.GetEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	cdnPurgeURLs, err := minioserver.ParseCDNPurgeURLs(golib.GetEnv("CDN_PURGE_URLS", ""))
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	socketMode, err := strconv.ParseUint(golib.GetEnv("LISTEN_SOCKET_MODE", "660"), 8, 32)
+	if err != nil {
+		log.Fatalf("config: LISTEN_SOCKET_MODE: %v", err)
+	}
+
 	cfg := minioserver.Config{
 		Endpoint:  golib.GetEnv("MINIO_ENDPOINT", "localhost:9000"),
 		AccessKey: golib.GetEnv("MINIO_ACCESS_KEY", "minioadmin"),
 		SecretKey: golib.GetEnv("MINIO_SECRET_KEY", "minioadmin"),
 		Bucket:    golib.GetEnv("MINIO_BUCKET", "mybucket"),
 		UseSSL:    golib.GetEnv("MINIO_USE_SSL", "false") == "true",
-		Listen:    golib.GetEnv("LISTEN_ADDR", ":8080"),
-		APIKey:    golib.GetEnv("API_KEY", ""),
+
+		CredentialSources: minioserver.ParseCredentialSources(golib.GetEnv("MINIO_CREDENTIALS", "")),
+		CredentialsFile:   golib.GetEnv("MINIO_CREDENTIALS_FILE", ""),
+		AssumeRoleARN:     golib.GetEnv("MINIO_ASSUME_ROLE_ARN", ""),
+
+		SecretsProvider: golib.GetEnv("SECRETS_PROVIDER", ""),
+		SecretsPath:     golib.GetEnv("SECRETS_PATH", ""),
+		SecretsRefresh:  golib.GetEnvDuration("SECRETS_REFRESH", 5*time.Minute),
+		SecretsRegion:   golib.GetEnv("AWS_REGION", ""),
+		VaultAddr:       golib.GetEnv("VAULT_ADDR", ""),
+		VaultToken:      golib.GetEnv("VAULT_TOKEN", ""),
+		VaultTokenFile:  golib.GetEnv("VAULT_TOKEN_FILE", ""),
+
+		Listen:           golib.GetEnv("LISTEN_ADDR", ":8080"),
+		ListenSocketMode: fs.FileMode(socketMode),
+		AdminListen:      golib.GetEnv("ADMIN_LISTEN_ADDR", ""),
+		APIKey:           golib.GetEnv("API_KEY", ""),
+
+		PublicEndpoint: golib.GetEnv("MINIO_PUBLIC_ENDPOINT", ""),
+		PublicUseSSL:   golib.GetEnv("MINIO_PUBLIC_USE_SSL", "true") == "true",
+		Region:         golib.GetEnv("MINIO_REGION", ""),
+
+		APIKeys:     apiKeys,
+		APIKeysFile: apiKeysFile,
+
+		Tenants:         tenants,
+		TenantResolvers: strings.FieldsFunc(golib.GetEnv("TENANT_RESOLVERS", ""), func(r rune) bool { return r == ',' || r == ' ' }),
+		TenantDomain:    golib.GetEnv("TENANT_DOMAIN", ""),
+
+		RequireSignedRequests: golib.GetEnv("API_REQUIRE_SIGNATURE", "false") == "true",
+		RequireSignatureNonce: golib.GetEnv("API_REQUIRE_NONCE", "false") == "true",
+		AccessTokenSecret:     golib.GetEnv("ACCESS_TOKEN_SECRET", ""),
+		AccessTokenMaxTTL:     golib.GetEnvDuration("ACCESS_TOKEN_MAX_TTL", time.Hour),
+		UploadLinkMaxTTL:      golib.GetEnvDuration("UPLOAD_LINK_MAX_TTL", 7*24*time.Hour),
+		CredentialedOrigins:   strings.FieldsFunc(golib.GetEnv("CORS_CREDENTIALED_ORIGINS", ""), func(r rune) bool { return r == ',' || r == ' ' }),
+		TrustedProxies:        trustedProxies,
+		ByteStatsPrefixDepth:  golib.GetEnvInt("BYTE_STATS_PREFIX_DEPTH", 0),
+
+		HotlinkAllowedDomains:    strings.Split(golib.GetEnv("HOTLINK_ALLOWED_DOMAINS", ""), ","),
+		HotlinkAllowEmptyReferer: golib.GetEnv("HOTLINK_ALLOW_EMPTY_REFERER", "true") == "true",
+		HotlinkPlaceholderKey:    golib.GetEnv("HOTLINK_PLACEHOLDER_KEY", ""),
+
+		NotFoundImageKey:    golib.GetEnv("NOT_FOUND_IMAGE_KEY", ""),
+		NotFoundImageStatus: golib.GetEnvInt("NOT_FOUND_IMAGE_STATUS", 404),
+
+		SVGMode: golib.GetEnv("SVG_SERVE_MODE", minioserver.SVGServeInline),
+
+		AliasesKey: golib.GetEnv("ALIASES_KEY", ""),
+		AliasMode:  golib.GetEnv("ALIAS_MODE", minioserver.AliasRedirect),
+
+		ContentHashURLs:   golib.GetEnv("CONTENT_HASH_URLS", "false") == "true",
+		ContentHashBucket: golib.GetEnv("CONTENT_HASH_BUCKET", ""),
+
+		CDNPurgeProvider: golib.GetEnv("CDN_PURGE_PROVIDER", ""),
+		CDNPurgeURLs:     cdnPurgeURLs,
+		CDNPurgeZone:     golib.GetEnv("CDN_PURGE_ZONE", ""),
+		CDNPurgeToken:    golib.GetEnv("CDN_PURGE_TOKEN", ""),
+
+		AnalyticsSink:          golib.GetEnv("ANALYTICS_SINK", ""),
+		AnalyticsFlushInterval: golib.GetEnvDuration("ANALYTICS_FLUSH_INTERVAL", time.Minute),
+
+		AlertWebhookURL:       golib.GetEnv("ALERT_WEBHOOK_URL", ""),
+		AlertSlackWebhookURL:  golib.GetEnv("ALERT_SLACK_WEBHOOK_URL", ""),
+		AlertErrorRatePercent: golib.GetEnvInt("ALERT_ERROR_RATE_PERCENT", 0),
+		AlertMinioDownAfter:   golib.GetEnvDuration("ALERT_MINIO_DOWN_AFTER", 0),
+		AlertDeleteBatchSize:  golib.GetEnvInt("ALERT_DELETE_BATCH_SIZE", 0),
+		AlertCooldown:         golib.GetEnvDuration("ALERT_COOLDOWN", 15*time.Minute),
+
+		ReadCacheBytes:                int64(golib.GetEnvInt("READ_CACHE_BYTES", 0)),
+		ReadCacheObjectMaxBytes:       int64(golib.GetEnvInt("READ_CACHE_OBJECT_MAX_BYTES", 1<<20)),
+		ReadCacheTTL:                  golib.GetEnvDuration("READ_CACHE_TTL", 30*time.Second),
+		ReadCacheStaleWhileRevalidate: golib.GetEnvDuration("READ_CACHE_STALE_WHILE_REVALIDATE", 30*time.Second),
+		ReadCacheStaleIfError:         golib.GetEnvDuration("READ_CACHE_STALE_IF_ERROR", 10*time.Minute),
+
+		IdempotencyTTL:       golib.GetEnvDuration("IDEMPOTENCY_TTL", 10*time.Minute),
+		MaxRequestTimeout:    golib.GetEnvDuration("REQUEST_TIMEOUT_MAX", 10*time.Minute),
+		SlowRequestThreshold: golib.GetEnvDuration("SLOW_REQUEST_THRESHOLD", 0),
+		ReadRetryAttempts:    golib.GetEnvInt("READ_RETRY_ATTEMPTS", 3),
+		ReadRetryDelay:       golib.GetEnvDuration("READ_RETRY_DELAY", 50*time.Millisecond),
+		LargeObjectThreshold: int64(golib.GetEnvInt("LARGE_OBJECT_THRESHOLD", 0)),
+		FetchMaxBytes:        int64(golib.GetEnvInt("FETCH_MAX_BYTES", 20<<20)),
+		Mounts:               mounts,
+		SeedAssets:           seedAssets,
+		StartupDiagnostics:   golib.GetEnv("STARTUP_DIAGNOSTICS", "false") == "true",
+		QuarantineWebhookURL: golib.GetEnv("QUARANTINE_WEBHOOK_URL", ""),
+		UploadWebhookURL:     golib.GetEnv("UPLOAD_WEBHOOK_URL", ""),
+		DirectoryIndex:       golib.GetEnv("DIRECTORY_INDEX", "false") == "true",
+		SoftDelete:           golib.GetEnv("SOFT_DELETE", "false") == "true",
+		BrowseStatsCacheTTL:  golib.GetEnvDuration("BROWSE_STATS_CACHE_TTL", 5*time.Minute),
+
+		BackupTarget:      golib.GetEnv("BACKUP_TARGET", ""),
+		BackupBucket:      golib.GetEnv("BACKUP_BUCKET", ""),
+		BackupPrefix:      golib.GetEnv("BACKUP_PREFIX", ""),
+		BackupSchedule:    golib.GetEnv("BACKUP_SCHEDULE", ""),
+		BackupIncremental: golib.GetEnv("BACKUP_INCREMENTAL", "false") == "true",
+
+		AuditEnabled:       golib.GetEnv("AUDIT_ENABLED", "false") == "true",
+		AuditSchedule:      golib.GetEnv("AUDIT_SCHEDULE", ""),
+		AuditBucket:        golib.GetEnv("AUDIT_BUCKET", ""),
+		AuditPrefix:        golib.GetEnv("AUDIT_PREFIX", ""),
+		AuditSamplePercent: golib.GetEnvInt("AUDIT_SAMPLE_PERCENT", 5),
+
+		ParallelGetThreshold: int64(golib.GetEnvInt("PARALLEL_GET_THRESHOLD", 0)),
+		ParallelGetWorkers:   golib.GetEnvInt("PARALLEL_GET_WORKERS", 4),
+
+		MaxDownloadBytesPerSec:      int64(golib.GetEnvInt("MAX_DOWNLOAD_BYTES_PER_SEC", 0)),
+		MaxTotalDownloadBytesPerSec: int64(golib.GetEnvInt("MAX_TOTAL_DOWNLOAD_BYTES_PER_SEC", 0)),
+
+		MaxConcurrentUploads: golib.GetEnvInt("MAX_CONCURRENT_UPLOADS", 0),
+		UploadQueueSize:      golib.GetEnvInt("UPLOAD_QUEUE_SIZE", 100),
+		UploadQueueTimeout:   golib.GetEnvDuration("UPLOAD_QUEUE_TIMEOUT", 10*time.Second),
+
+		MultipartMaxMemory: int64(golib.GetEnvInt("MULTIPART_MAX_MEMORY", 50<<20)),
+		UploadMaxFileBytes: int64(golib.GetEnvInt("UPLOAD_MAX_FILE_BYTES", 0)),
+		UploadMaxFiles:     golib.GetEnvInt("UPLOAD_MAX_FILES", 0),
+		MultipartTempDir:   golib.GetEnv("MULTIPART_TEMP_DIR", ""),
+		UploadKeyTemplate:  golib.GetEnv("UPLOAD_KEY_TEMPLATE", ""),
+
+		UploadPreserveFilenames:  golib.GetEnv("UPLOAD_PRESERVE_FILENAMES", "false") == "true",
+		UploadCheckKeyCollisions: golib.GetEnv("UPLOAD_CHECK_KEY_COLLISIONS", "false") == "true",
+		UploadPreserveOriginals:  golib.GetEnv("UPLOAD_PRESERVE_ORIGINALS", "false") == "true",
+		DirectUploadImages:       golib.GetEnv("DIRECT_UPLOAD_IMAGES", "false") == "true",
+		ImageMaxEdgePx:           golib.GetEnvInt("IMAGE_MAX_EDGE_PX", 4096),
+		ImageJPEGQuality:         golib.GetEnvInt("IMAGE_JPEG_QUALITY", 100),
+		ImageAlphaBackground:     golib.GetEnv("IMAGE_ALPHA_BACKGROUND", ""),
+		ImageMaxDimensionPx:      golib.GetEnvInt("IMAGE_MAX_DIMENSION_PX", 16384),
+		ImageMaxDecodedBytes:     int64(golib.GetEnvInt("IMAGE_MAX_DECODED_BYTES", 256<<20)),
+		ImageWorkers:             golib.GetEnvInt("IMAGE_WORKERS", 0),
+	}
+	if command := golib.GetEnv("SVG_RASTERIZE_COMMAND", ""); command != "" {
+		cfg.SVGRasterizer = minioserver.CommandRasterizer(command)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(check(cfg))
+		case "migrate-prefix":
+			os.Exit(migratePrefix(cfg, os.Args[2:]))
+		case "restore":
+			os.Exit(restore(cfg, os.Args[2:]))
+		}
+	}
 	if err := minioserver.Run(cfg); err != nil {
 		log.Fatalf("server: %v", err)
 	}
 }
+
+// check runs "kzen-go check": the self-test of POST /admin/selftest, with the report on stdout.
+// It exits 0 when every step passed, 1 when one failed and 2 when the test could not run.
+func check(cfg minioserver.Config) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report, err := minioserver.SelfTest(ctx, cfg)
+	if err != nil {
+		log.Printf("check: %v", err)
+		return 2
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
+
+// migratePrefix runs "kzen-go migrate-prefix [-apply] [-bucket b] [-prefix kzen] [-from users/]",
+// moving objects stored before the kzen folder prefix under it. Without -apply it only reports
+// the moves. It exits 1 when an object could not be moved.
+func migratePrefix(cfg minioserver.Config, args []string) int {
+	flags := flag.NewFlagSet("migrate-prefix", flag.ExitOnError)
+	var m minioserver.PrefixMigration
+	flags.StringVar(&m.Bucket, "bucket", minioserver.KZEN_STORAGE, "bucket to migrate in place")
+	flags.StringVar(&m.Prefix, "prefix", "kzen", "folder prefix objects move under")
+	flags.StringVar(&m.From, "from", "", "only migrate keys starting with this (default: every key outside -prefix)")
+	flags.BoolVar(&m.Apply, "apply", false, "move the objects (default: dry run)")
+	flags.Parse(args)
+
+	report, err := minioserver.MigratePrefix(context.Background(), cfg, m)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if err != nil {
+		log.Printf("migrate-prefix: %v", err)
+		return 2
+	}
+	log.Printf("migrate-prefix: %d moved, %d skipped, %d errors (dry run: %v)", len(report.Moved), len(report.Skipped), len(report.Errors), report.DryRun)
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// restore runs "kzen-go restore [-apply] [-bucket b] [-prefix p] [-overwrite] <archive>", uploading
+// the objects of a backup archive (a local file, or a name in BACKUP_TARGET). Without -apply it
+// only reports what it would upload. It exits 1 when an object could not be restored.
+func restore(cfg minioserver.Config, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	var r minioserver.BackupRestore
+	flags.StringVar(&r.Bucket, "bucket", "", "bucket to restore into (default: BACKUP_BUCKET or MINIO_BUCKET)")
+	flags.StringVar(&r.Prefix, "prefix", "", "only restore keys starting with this")
+	flags.BoolVar(&r.Overwrite, "overwrite", false, "replace objects modified since the backup")
+	flags.BoolVar(&r.Apply, "apply", false, "upload the objects (default: dry run)")
+	flags.Parse(args)
+	// Flags may also follow the archive: restore <archive> -prefix users/.
+	r.Archive = flags.Arg(0)
+	if flags.NArg() > 1 {
+		flags.Parse(flags.Args()[1:])
+	}
+	if r.Archive == "" || flags.NArg() > 0 {
+		log.Printf("usage: kzen-go restore [-apply] [-bucket b] [-prefix p] [-overwrite] <archive>")
+		return 2
+	}
+
+	report, err := minioserver.RestoreBackup(context.Background(), cfg, r)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if err != nil {
+		log.Printf("restore: %v", err)
+		return 2
+	}
+	log.Printf("restore: %d restored, %d skipped, %d errors (dry run: %v)", len(report.Restored), len(report.Skipped), len(report.Errors), report.DryRun)
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
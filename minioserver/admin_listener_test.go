@@ -0,0 +1,59 @@
+package minioserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func unixClient(sock string) *http.Client {
+	return &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+}
+
+func TestRun_AdminListener(t *testing.T) {
+	dir := t.TempDir()
+	public, admin := filepath.Join(dir, "public.sock"), filepath.Join(dir, "admin.sock")
+	go Run(Config{
+		Endpoint:    "127.0.0.1:1",
+		Bucket:      "test",
+		Listen:      "unix:" + public,
+		AdminListen: "unix:" + admin,
+	})
+
+	get := func(sock, path string) int {
+		var lastErr error
+		for i := 0; i < 50; i++ {
+			resp, err := unixClient(sock).Get("http://kzen" + path)
+			if err == nil {
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+			lastErr = err
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("GET %s on %s: %v", path, filepath.Base(sock), lastErr)
+		return 0
+	}
+
+	for _, path := range []string{"/metrics", "/stats", "/debug/list"} {
+		if got := get(public, path); got != http.StatusNotFound {
+			t.Errorf("public %s = %d, want 404", path, got)
+		}
+	}
+	if got := get(admin, "/metrics"); got != http.StatusOK {
+		t.Errorf("admin /metrics = %d, want 200", got)
+	}
+	if got := get(admin, "/health"); got != http.StatusOK {
+		t.Errorf("admin /health = %d, want 200", got)
+	}
+	if got := get(public, "/health"); got != http.StatusOK {
+		t.Errorf("public /health = %d, want 200", got)
+	}
+}
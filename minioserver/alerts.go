@@ -0,0 +1,198 @@
+package minioserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+func init() {
+	metrics.describe("kzen_alerts_total", "counter", "Alerts raised, by alert.")
+	metrics.describe("kzen_minio_up", "gauge", "1 if the last MinIO probe succeeded, 0 if it failed.")
+}
+
+// Alert names, the "alert" field of alert webhooks.
+const (
+	alertErrorRate     = "error_rate"
+	alertMinioDown     = "minio_unreachable"
+	alertMinioRecovery = "minio_recovered"
+	alertDeleteBatch   = "large_delete_batch"
+)
+
+const (
+	defaultAlertCooldown = 15 * time.Minute
+	// alertErrorWindow is the window the error rate is measured over; windows with fewer than
+	// alertMinRequests requests are ignored, so a few failures on a quiet instance stay silent.
+	alertErrorWindow = time.Minute
+	alertMinRequests = 20
+)
+
+// alertThresholds are the conditions that raise an alert; a zero field disables its check.
+type alertThresholds struct {
+	ErrorRatePercent int           // 5xx responses per 100 requests over alertErrorWindow
+	MinioDownAfter   time.Duration // MinIO failing every probe for this long
+	DeleteBatchSize  int           // keys in one batch delete
+}
+
+// alerter tells operators about anomalies through a JSON webhook (event "alert") and/or a Slack
+// incoming webhook. Each alert is sent at most once per cooldown; a MinIO recovery always is.
+type alerter struct {
+	hook      *webhook
+	slack     *webhook
+	limits    alertThresholds
+	cooldown  time.Duration
+	mu        sync.Mutex
+	last      map[string]time.Time
+	requests  int
+	errors    int
+	downSince time.Time
+	downSent  bool
+}
+
+// newAlerter returns nil when there is nowhere to send alerts or nothing to check.
+func newAlerter(hookURL, slackURL string, limits alertThresholds, cooldown time.Duration) *alerter {
+	if hookURL == "" && slackURL == "" {
+		return nil
+	}
+	if limits == (alertThresholds{}) {
+		return nil
+	}
+	if cooldown <= 0 {
+		cooldown = defaultAlertCooldown
+	}
+	return &alerter{
+		hook:     newWebhook(hookURL),
+		slack:    newWebhook(slackURL),
+		limits:   limits,
+		cooldown: cooldown,
+		last:     map[string]time.Time{},
+	}
+}
+
+// raise sends alert unless it was sent within the cooldown.
+func (a *alerter) raise(alert, message string, details map[string]any) {
+	now := time.Now()
+	a.mu.Lock()
+	if last, ok := a.last[alert]; ok && now.Sub(last) < a.cooldown && alert != alertMinioRecovery {
+		a.mu.Unlock()
+		return
+	}
+	a.last[alert] = now
+	a.mu.Unlock()
+
+	log.Printf("ALERT %s: %s", alert, message)
+	metrics.add("kzen_alerts_total", 1, "alert", alert)
+	payload := map[string]any{"alert": alert, "message": message}
+	for k, v := range details {
+		payload[k] = v
+	}
+	a.hook.send("alert", payload)
+	a.slack.deliver("alert", map[string]string{"text": ":rotating_light: kzen-go " + alert + ": " + message})
+}
+
+// observe counts a response for the error rate.
+func (a *alerter) observe(status int) {
+	if a == nil || a.limits.ErrorRatePercent <= 0 {
+		return
+	}
+	a.mu.Lock()
+	a.requests++
+	if status >= 500 {
+		a.errors++
+	}
+	a.mu.Unlock()
+}
+
+// checkErrorRate closes the current error-rate window and alerts if it went over the threshold.
+func (a *alerter) checkErrorRate() {
+	a.mu.Lock()
+	requests, errors := a.requests, a.errors
+	a.requests, a.errors = 0, 0
+	a.mu.Unlock()
+	if requests < alertMinRequests || errors*100 < a.limits.ErrorRatePercent*requests {
+		return
+	}
+	a.raise(alertErrorRate, fmt.Sprintf("%d of %d requests failed with 5xx in the last %s", errors, requests, alertErrorWindow),
+		map[string]any{"requests": requests, "errors": errors, "window": alertErrorWindow.String()})
+}
+
+// probed records the result of a MinIO probe at now.
+func (a *alerter) probed(err error, now time.Time) {
+	if err == nil {
+		metrics.set("kzen_minio_up", 1)
+		a.mu.Lock()
+		since, sent := a.downSince, a.downSent
+		a.downSince, a.downSent = time.Time{}, false
+		a.mu.Unlock()
+		if sent {
+			a.raise(alertMinioRecovery, fmt.Sprintf("MinIO reachable again after %s", now.Sub(since).Round(time.Second)), nil)
+		}
+		return
+	}
+	metrics.set("kzen_minio_up", 0)
+	a.mu.Lock()
+	if a.downSince.IsZero() {
+		a.downSince = now
+	}
+	down := now.Sub(a.downSince)
+	fire := !a.downSent && down >= a.limits.MinioDownAfter
+	if fire {
+		a.downSent = true
+	}
+	a.mu.Unlock()
+	if fire {
+		a.raise(alertMinioDown, fmt.Sprintf("MinIO unreachable for %s: %v", down.Round(time.Second), err),
+			map[string]any{"error": err.Error(), "downSeconds": int(down.Seconds())})
+	}
+}
+
+// deleteBatch alerts when one batch delete removes at least DeleteBatchSize keys.
+func (a *alerter) deleteBatch(bucket string, keys int, by string) {
+	if a == nil || a.limits.DeleteBatchSize <= 0 || keys < a.limits.DeleteBatchSize {
+		return
+	}
+	a.raise(alertDeleteBatch, fmt.Sprintf("batch delete of %d keys in %s by %q", keys, bucket, by),
+		map[string]any{"bucket": bucket, "keys": keys, "apiKey": by})
+}
+
+// run measures the error rate and, with probe set, checks MinIO until ctx is done.
+func (a *alerter) run(ctx context.Context, probe func(context.Context) error) {
+	errTick := time.NewTicker(alertErrorWindow)
+	defer errTick.Stop()
+	var probeC <-chan time.Time
+	if a.limits.MinioDownAfter > 0 && probe != nil {
+		interval := min(max(a.limits.MinioDownAfter/3, time.Second), 30*time.Second)
+		probeTick := time.NewTicker(interval)
+		defer probeTick.Stop()
+		probeC = probeTick.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-errTick.C:
+			if a.limits.ErrorRatePercent > 0 {
+				a.checkErrorRate()
+			}
+		case now := <-probeC:
+			pctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := probe(pctx)
+			cancel()
+			a.probed(err, now)
+		}
+	}
+}
+
+// alertMiddleware feeds response statuses to a's error rate.
+func alertMiddleware(a *alerter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lw := &logResponseWriter{countingResponseWriter: countingResponseWriter{ResponseWriter: w}}
+			next.ServeHTTP(lw, r)
+			a.observe(lw.statusCode())
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func alertReceiver(t *testing.T) (string, <-chan map[string]any) {
+	t.Helper()
+	got := make(chan map[string]any, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		got <- body
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, got
+}
+
+func nextAlert(t *testing.T, got <-chan map[string]any) map[string]any {
+	t.Helper()
+	select {
+	case body := <-got:
+		return body
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert delivered")
+		return nil
+	}
+}
+
+func TestAlerter_ErrorRate(t *testing.T) {
+	url, got := alertReceiver(t)
+	a := newAlerter(url, "", alertThresholds{ErrorRatePercent: 10}, time.Hour)
+	h := alertMiddleware(a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	serve := func(path string, n int) {
+		for range n {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+	}
+
+	// Too few requests to judge.
+	serve("/fail", 5)
+	a.checkErrorRate()
+	// 2 of 30 is under 10%.
+	serve("/ok", 28)
+	serve("/fail", 2)
+	a.checkErrorRate()
+	serve("/ok", 27)
+	serve("/fail", 3)
+	a.checkErrorRate()
+	body := nextAlert(t, got)
+	if body["event"] != "alert" || body["alert"] != alertErrorRate || body["errors"] != float64(3) || body["requests"] != float64(30) {
+		t.Errorf("alert = %v", body)
+	}
+
+	// The cooldown holds back the next one.
+	serve("/fail", 30)
+	a.checkErrorRate()
+	select {
+	case body := <-got:
+		t.Errorf("alert within cooldown: %v", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAlerter_MinioDown(t *testing.T) {
+	url, got := alertReceiver(t)
+	a := newAlerter("", url, alertThresholds{MinioDownAfter: time.Minute}, time.Hour)
+	start := time.Now()
+	down := errors.New("connection refused")
+	a.probed(down, start)
+	a.probed(down, start.Add(30*time.Second))
+	if a.downSent {
+		t.Fatal("alerted before MinioDownAfter")
+	}
+	a.probed(down, start.Add(time.Minute))
+	a.probed(down, start.Add(90*time.Second))
+	if body := nextAlert(t, got); body["text"] != ":rotating_light: kzen-go minio_unreachable: MinIO unreachable for 1m0s: connection refused" {
+		t.Errorf("slack message = %v", body)
+	}
+	a.probed(nil, start.Add(2*time.Minute))
+	if body := nextAlert(t, got); body["text"] != ":rotating_light: kzen-go minio_recovered: MinIO reachable again after 2m0s" {
+		t.Errorf("slack message = %v", body)
+	}
+	select {
+	case body := <-got:
+		t.Errorf("extra alert: %v", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAlerter_DeleteBatch(t *testing.T) {
+	url, got := alertReceiver(t)
+	a := newAlerter(url, "", alertThresholds{DeleteBatchSize: 100}, 0)
+	a.deleteBatch("files", 99, "app")
+	a.deleteBatch("files", 250, "app")
+	body := nextAlert(t, got)
+	if body["alert"] != alertDeleteBatch || body["keys"] != float64(250) || body["apiKey"] != "app" {
+		t.Errorf("alert = %v", body)
+	}
+
+	var off *alerter
+	off.deleteBatch("files", 1000, "app")
+	if newAlerter(url, "", alertThresholds{}, 0) != nil || newAlerter("", "", alertThresholds{DeleteBatchSize: 1}, 0) != nil {
+		t.Error("alerter without checks or receivers")
+	}
+}
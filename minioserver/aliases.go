@@ -0,0 +1,280 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+func init() {
+	metrics.describe("kzen_alias_hits_total", "counter", "GET misses answered from the alias table, by bucket.")
+}
+
+// Alias modes: how a GET of an aliased (moved) key is answered.
+const (
+	AliasRedirect = "redirect" // 301 to the new key
+	AliasServe    = "serve"    // the new object, under the old URL
+)
+
+const (
+	aliasReloadInterval = 30 * time.Second
+	// aliasMaxHops bounds alias chains (a -> b -> c after two renames) and breaks cycles.
+	aliasMaxHops = 8
+)
+
+// aliasTable maps old keys to new ones, per bucket, so references to moved objects (img_path
+// values in the kzen database) keep working. It is stored as one JSON object in MinIO,
+// {"bucket": {"old/key": "new/key"}}, and reloaded when it changes, so every instance sees the
+// same table.
+type aliasTable struct {
+	client   *minio.Client
+	bucket   string // where the table is stored
+	key      string
+	redirect bool
+
+	mu      sync.RWMutex
+	aliases map[string]map[string]string
+	etag    string
+	writeMu sync.Mutex
+}
+
+func newAliasTable(client *minio.Client, bucket, key, mode string) (*aliasTable, error) {
+	if key == "" {
+		return nil, nil
+	}
+	switch mode {
+	case "", AliasRedirect, AliasServe:
+	default:
+		return nil, fmt.Errorf("alias mode %q: want %s or %s", mode, AliasRedirect, AliasServe)
+	}
+	t := &aliasTable{client: client, bucket: bucket, key: strings.TrimPrefix(key, "/"), redirect: mode != AliasServe}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := t.load(ctx); err != nil {
+		return nil, fmt.Errorf("alias table %s/%s: %w", bucket, t.key, err)
+	}
+	return t, nil
+}
+
+// load reads the table if it changed since the last load; a missing object is an empty table.
+func (t *aliasTable) load(ctx context.Context) error {
+	aliases, etag, err := t.read(ctx)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if aliases != nil {
+		t.aliases, t.etag = aliases, etag
+	}
+	return nil
+}
+
+// read returns the stored table and its ETag; aliases is nil when the table is unchanged.
+func (t *aliasTable) read(ctx context.Context) (map[string]map[string]string, string, error) {
+	info, err := t.client.StatObject(ctx, t.bucket, t.key, minio.StatObjectOptions{})
+	if golib.IsNotFound(err) {
+		return map[string]map[string]string{}, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	t.mu.RLock()
+	unchanged := info.ETag == t.etag
+	t.mu.RUnlock()
+	if unchanged {
+		return nil, info.ETag, nil
+	}
+	obj, err := t.client.GetObject(ctx, t.bucket, t.key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer obj.Close()
+	aliases := map[string]map[string]string{}
+	if err := json.NewDecoder(obj).Decode(&aliases); err != nil && err != io.EOF {
+		return nil, "", fmt.Errorf("parse: %w", err)
+	}
+	return aliases, info.ETag, nil
+}
+
+// watch reloads the table until ctx is done, keeping the previous table on errors.
+func (t *aliasTable) watch(ctx context.Context) {
+	tick := time.NewTicker(aliasReloadInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			lctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := t.load(lctx); err != nil {
+				log.Printf("alias table reload: %v (keeping previous aliases)", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// lookup follows the aliases of key in bucket to the newest key.
+func (t *aliasTable) lookup(bucket, key string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	to, ok := t.aliases[bucket][key]
+	if !ok {
+		return "", false
+	}
+	for range aliasMaxHops {
+		next, ok := t.aliases[bucket][to]
+		if !ok || next == key {
+			break
+		}
+		to = next
+	}
+	return to, true
+}
+
+// isTableKey reports whether key in bucket is the stored table, which object routes don't serve.
+func (t *aliasTable) isTableKey(bucket, key string) bool {
+	return t != nil && bucket == t.bucket && key == t.key
+}
+
+// update applies fn to the newest stored table of bucket and stores the result. Writers on
+// other instances are not locked out; the last write wins.
+func (t *aliasTable) update(ctx context.Context, bucket string, fn func(aliases map[string]string)) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if err := t.load(ctx); err != nil {
+		return err
+	}
+	t.mu.RLock()
+	aliases := make(map[string]map[string]string, len(t.aliases))
+	for b, m := range t.aliases {
+		aliases[b] = maps.Clone(m)
+	}
+	t.mu.RUnlock()
+	if aliases[bucket] == nil {
+		aliases[bucket] = map[string]string{}
+	}
+	fn(aliases[bucket])
+	if len(aliases[bucket]) == 0 {
+		delete(aliases, bucket)
+	}
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	info, err := t.client.PutObject(ctx, t.bucket, t.key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.aliases, t.etag = aliases, info.ETag
+	t.mu.Unlock()
+	return nil
+}
+
+// resolveAlias handles a GET miss of key. ok is false when key has no alias. With a redirect
+// table it answers 301 to the new key on the same route (prefix is the key prefix the route's
+// mount adds) and reports done; otherwise it returns the key to serve instead.
+func (t *aliasTable) resolveAlias(w http.ResponseWriter, r *http.Request, bucket, key, prefix string) (to string, done, ok bool) {
+	to, ok = t.lookup(bucket, key)
+	if !ok {
+		return "", false, false
+	}
+	metrics.add("kzen_alias_hits_total", 1, "bucket", bucket)
+	// A target outside the route's prefix has no URL on this route, so it is served in place.
+	if !t.redirect || !strings.HasPrefix(to, prefix) {
+		w.Header().Set("X-Alias-Of", to)
+		return to, false, true
+	}
+	route := strings.TrimSuffix(r.URL.Path, key)
+	loc := (&url.URL{Path: route + strings.TrimPrefix(to, prefix), RawQuery: r.URL.RawQuery}).String()
+	http.Redirect(w, r, loc, http.StatusMovedPermanently)
+	return "", true, true
+}
+
+// aliasesHandler serves the alias table of defaultBucket (or ?bucket=):
+//
+//	GET    /admin/aliases         the aliases
+//	PUT    /admin/aliases         add or replace aliases from a JSON object {"old/key": "new/key"}
+//	DELETE /admin/aliases?key=    remove the alias of an old key
+func aliasesHandler(t *aliasTable, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := r.URL.Query().Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			if err := t.load(ctx); err != nil {
+				respondStorageError(w, err, "failed to read the alias table")
+				return
+			}
+			t.mu.RLock()
+			aliases := maps.Clone(t.aliases[bucket])
+			t.mu.RUnlock()
+			if aliases == nil {
+				aliases = map[string]string{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "aliases": aliases})
+			return
+		case http.MethodPut:
+			var add map[string]string
+			if err := json.NewDecoder(io.LimitReader(r.Body, 10<<20)).Decode(&add); err != nil || len(add) == 0 {
+				respondError(w, `body must be a JSON object {"old/key": "new/key"}`, http.StatusBadRequest)
+				return
+			}
+			for from, to := range add {
+				if strings.TrimPrefix(from, "/") == "" || strings.TrimPrefix(to, "/") == "" || from == to {
+					respondError(w, fmt.Sprintf("invalid alias %q -> %q", from, to), http.StatusBadRequest)
+					return
+				}
+			}
+			err = t.update(ctx, bucket, func(aliases map[string]string) {
+				for from, to := range add {
+					aliases[strings.TrimPrefix(from, "/")] = strings.TrimPrefix(to, "/")
+				}
+			})
+		case http.MethodDelete:
+			key := strings.TrimPrefix(r.URL.Query().Get("key"), "/")
+			if key == "" {
+				respondError(w, "key query parameter required", http.StatusBadRequest)
+				return
+			}
+			err = t.update(ctx, bucket, func(aliases map[string]string) { delete(aliases, key) })
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			log.Printf("alias table update: %v", err)
+			respondStorageError(w, err, "failed to update the alias table")
+			return
+		}
+		log.Printf("aliases of %s changed (%s) by %q", bucket, r.Method, apiKeyName(r.Context()))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}
+}
@@ -0,0 +1,65 @@
+package minioserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAliasTable(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["kzen/users/42/a.jpg"] = []byte("moved")
+
+	table, err := newAliasTable(client, "files", "kzen-meta/aliases.json", AliasRedirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	aliasesHandler(table, "files").ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/aliases",
+		strings.NewReader(`{"old/a.jpg": "users/42/a.jpg", "users/42/a.jpg": "kzen/users/42/a.jpg"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := objects["kzen-meta/aliases.json"]; !ok {
+		t.Fatal("alias table not stored")
+	}
+	// Another instance loads the stored table.
+	other, err := newAliasTable(client, "files", "kzen-meta/aliases.json", AliasServe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to, ok := other.lookup("files", "old/a.jpg"); !ok || to != "kzen/users/42/a.jpg" {
+		t.Errorf("lookup = %q, %v; want the end of the chain", to, ok)
+	}
+
+	get := func(table *aliasTable, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h := objectsHandlerWithPrefix(client, "files", "/objects/", proxyOptions{Aliases: table})
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	if rec := get(table, "/objects/old/a.jpg?w=200"); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/objects/kzen/users/42/a.jpg?w=200" {
+		t.Errorf("redirect: %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := get(other, "/objects/old/a.jpg"); rec.Code != http.StatusOK || rec.Body.String() != "moved" || rec.Header().Get("X-Alias-Of") != "kzen/users/42/a.jpg" {
+		t.Errorf("serve: %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	if rec := get(table, "/objects/missing.jpg"); rec.Code != http.StatusNotFound {
+		t.Errorf("no alias: %d", rec.Code)
+	}
+	if rec := get(table, "/objects/kzen-meta/aliases.json"); rec.Code != http.StatusNotFound {
+		t.Errorf("alias table served: %d", rec.Code)
+	}
+
+	if err := table.update(context.Background(), "files", func(a map[string]string) { delete(a, "old/a.jpg") }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := table.lookup("files", "old/a.jpg"); ok {
+		t.Error("alias still there after delete")
+	}
+	if _, err := newAliasTable(client, "files", "x.json", "bounce"); err == nil {
+		t.Error("unknown alias mode accepted")
+	}
+}
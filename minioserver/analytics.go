@@ -0,0 +1,265 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+func init() {
+	metrics.describe("kzen_analytics_records_dropped_total", "counter", "Analytics records lost because the sink failed or the buffer was full.")
+}
+
+const (
+	analyticsDefaultFlush = time.Minute
+	analyticsBatchSize    = 1000
+	// analyticsMaxPending bounds the records kept while the sink is failing.
+	analyticsMaxPending = 10 * analyticsBatchSize
+)
+
+// analyticsRecord is one request in the analytics export. The client IP is truncated to its
+// /24 (IPv4) or /48 (IPv6) network before it is stored.
+type analyticsRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	BytesIn   int64     `json:"bytesIn"`
+	BytesOut  int64     `json:"bytesOut"`
+	Duration  float64   `json:"durationMs"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	APIKey    string    `json:"apiKey,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	// Download is how an object body ended (complete, client_aborted, backend_error); "" when the
+	// request streamed none. ObjectSize is that object's size, -1 if unknown.
+	Download   string `json:"download,omitempty"`
+	ObjectSize int64  `json:"objectSize,omitempty"`
+}
+
+// anonymizeIP keeps the network part of ip: the /24 of an IPv4 and the /48 of an IPv6 address.
+func anonymizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	bits := 24
+	if addr.Is6() && !addr.Is4In6() {
+		bits = 48
+	}
+	prefix, _ := addr.Unmap().Prefix(bits)
+	return prefix.Addr().String()
+}
+
+// analyticsSink stores one batch of newline-delimited JSON records.
+type analyticsSink interface {
+	write(ctx context.Context, batch []byte) error
+}
+
+// newAnalyticsSink parses Config.AnalyticsSink: a file path (or file:///path), s3://bucket/prefix/
+// (on the proxy's MinIO, one object per batch) or an http(s):// collector URL (POSTed each batch).
+func newAnalyticsSink(spec string, client *minio.Client) (analyticsSink, error) {
+	switch {
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		if _, err := url.Parse(spec); err != nil {
+			return nil, fmt.Errorf("analytics sink: %w", err)
+		}
+		return httpAnalyticsSink{url: spec, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	case strings.HasPrefix(spec, "s3://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(spec, "s3://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("analytics sink %q: bucket required", spec)
+		}
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		return s3AnalyticsSink{client: client, bucket: bucket, prefix: prefix}, nil
+	case strings.Contains(spec, "://") && !strings.HasPrefix(spec, "file://"):
+		return nil, fmt.Errorf("analytics sink %q: want a file path, s3:// or http(s):// URL", spec)
+	default:
+		return fileAnalyticsSink{path: strings.TrimPrefix(spec, "file://")}, nil
+	}
+}
+
+type fileAnalyticsSink struct{ path string }
+
+func (s fileAnalyticsSink) write(ctx context.Context, batch []byte) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(batch); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type s3AnalyticsSink struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// write stores the batch as <prefix>YYYY/MM/DD/HHMMSS-<uuid>.ndjson.
+func (s s3AnalyticsSink) write(ctx context.Context, batch []byte) error {
+	key := s.prefix + time.Now().UTC().Format("2006/01/02/150405") + "-" + uuid.NewString() + ".ndjson"
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(batch), int64(len(batch)),
+		minio.PutObjectOptions{ContentType: "application/x-ndjson"})
+	return err
+}
+
+type httpAnalyticsSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpAnalyticsSink) write(ctx context.Context, batch []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// analyticsExporter buffers records and hands them to the sink in batches, every flush interval
+// or when a batch is full. A failed batch is kept for the next flush, up to analyticsMaxPending
+// records; older records are dropped beyond that.
+type analyticsExporter struct {
+	sink  analyticsSink
+	mu    sync.Mutex
+	recs  []analyticsRecord
+	full  chan struct{}
+	flush time.Duration
+}
+
+func newAnalyticsExporter(sink analyticsSink, flush time.Duration) *analyticsExporter {
+	if flush <= 0 {
+		flush = analyticsDefaultFlush
+	}
+	return &analyticsExporter{sink: sink, full: make(chan struct{}, 1), flush: flush}
+}
+
+func (a *analyticsExporter) add(rec analyticsRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.recs) >= analyticsMaxPending {
+		a.recs = a.recs[1:]
+		metrics.add("kzen_analytics_records_dropped_total", 1)
+	}
+	a.recs = append(a.recs, rec)
+	if len(a.recs) == analyticsBatchSize {
+		select {
+		case a.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run flushes until ctx is done, then flushes once more.
+func (a *analyticsExporter) run(ctx context.Context) {
+	tick := time.NewTicker(a.flush)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.send(context.Background())
+			return
+		case <-tick.C:
+		case <-a.full:
+		}
+		a.send(ctx)
+	}
+}
+
+// send writes the pending records in batches of analyticsBatchSize.
+func (a *analyticsExporter) send(ctx context.Context) {
+	for {
+		a.mu.Lock()
+		n := min(len(a.recs), analyticsBatchSize)
+		batch := a.recs[:n:n]
+		a.recs = a.recs[n:]
+		a.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, rec := range batch {
+			enc.Encode(rec)
+		}
+		wctx, cancel := context.WithTimeout(ctx, time.Minute)
+		err := a.sink.write(wctx, buf.Bytes())
+		cancel()
+		if err != nil {
+			log.Printf("analytics: %d records not exported: %v", n, err)
+			a.mu.Lock()
+			a.recs = append(batch, a.recs...)
+			if drop := len(a.recs) - analyticsMaxPending; drop > 0 {
+				a.recs = a.recs[drop:]
+				metrics.add("kzen_analytics_records_dropped_total", float64(drop))
+			}
+			a.mu.Unlock()
+			return
+		}
+	}
+}
+
+// analyticsMiddleware records every request it sees for a. It runs after auth, so the record
+// carries the API key name.
+func analyticsMiddleware(a *analyticsExporter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, download := withDownloadRecord(r)
+			lw := &logResponseWriter{countingResponseWriter: countingResponseWriter{ResponseWriter: w}}
+			var body *countingReadCloser
+			if r.Body != nil && r.Body != http.NoBody {
+				body = &countingReadCloser{ReadCloser: r.Body}
+				r.Body = body
+			}
+			next.ServeHTTP(lw, r)
+			rec := analyticsRecord{
+				Time:      start.UTC(),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    lw.statusCode(),
+				BytesOut:  lw.n,
+				Duration:  float64(time.Since(start).Microseconds()) / 1000,
+				IP:        anonymizeIP(clientIP(r)),
+				UserAgent: r.UserAgent(),
+				APIKey:    apiKeyName(r.Context()),
+				RequestID: requestID(r.Context()),
+				Download:  download.Outcome,
+			}
+			if download.Outcome != "" {
+				rec.ObjectSize = download.Size
+			}
+			if body != nil {
+				rec.BytesIn = body.n
+			}
+			a.add(rec)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package minioserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	for in, want := range map[string]string{
+		"203.0.113.77":          "203.0.113.0",
+		"::ffff:203.0.113.77":   "203.0.113.0",
+		"2001:db8:1234:5678::1": "2001:db8:1234::",
+		"not an ip":             "",
+	} {
+		if got := anonymizeIP(in); got != want {
+			t.Errorf("anonymizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+type failingSink struct{ fail bool }
+
+func (s *failingSink) write(ctx context.Context, batch []byte) error {
+	if s.fail {
+		return errors.New("collector down")
+	}
+	return nil
+}
+
+func TestAnalyticsExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.ndjson")
+	sink, err := newAnalyticsSink(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newAnalyticsExporter(sink, 0)
+	h := analyticsMiddleware(a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	req := httptest.NewRequest(http.MethodPut, "/objects/a.txt", strings.NewReader("hello"))
+	req.RemoteAddr = "198.51.100.23:4242"
+	req.Header.Set("User-Agent", "kzen-test")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	a.send(context.Background())
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec analyticsRecord
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() || json.Unmarshal(sc.Bytes(), &rec) != nil {
+		t.Fatalf("export = %q", data)
+	}
+	if rec.Method != http.MethodPut || rec.Status != http.StatusCreated || rec.BytesIn != 5 || rec.BytesOut != 11 ||
+		rec.IP != "198.51.100.0" || rec.UserAgent != "kzen-test" {
+		t.Errorf("record = %+v", rec)
+	}
+
+	// A failing sink keeps the records for the next flush.
+	fs := &failingSink{fail: true}
+	a = newAnalyticsExporter(fs, 0)
+	a.add(analyticsRecord{Path: "/a"})
+	a.send(context.Background())
+	if len(a.recs) != 1 {
+		t.Fatalf("pending after failure = %d, want 1", len(a.recs))
+	}
+	fs.fail = false
+	a.send(context.Background())
+	if len(a.recs) != 0 {
+		t.Errorf("pending after recovery = %d, want 0", len(a.recs))
+	}
+
+	for _, spec := range []string{"ftp://host/x", "s3://"} {
+		if _, err := newAnalyticsSink(spec, nil); err == nil {
+			t.Errorf("sink %q accepted", spec)
+		}
+	}
+}
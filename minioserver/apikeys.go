@@ -0,0 +1,270 @@
+package minioserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is one named key of the key set. A key is valid from CreatedAt (if set) until ExpiresAt
+// (if set), so a rotation adds the new key and gives the old one an ExpiresAt after the overlap.
+type APIKey struct {
+	Name      string    `json:"name"`
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	// Admin keys may also use the admin endpoints (e.g. /debug/list) on the public listener.
+	Admin bool `json:"admin,omitempty"`
+}
+
+var (
+	errAPIKeyMissing = errors.New("missing API key")
+	errAPIKeyInvalid = errors.New("invalid API key")
+	errAPIKeyExpired = errors.New("expired API key")
+	// errSignatureRequired rejects a plain key when only signed requests are allowed.
+	errSignatureRequired = errors.New("signed request required")
+)
+
+// ParseAPIKeys reads a key set from a JSON array, e.g.
+// [{"name":"web","key":"...","expiresAt":"2026-01-01T00:00:00Z"}].
+// A value starting with "@" is read from that file path. Empty input yields no keys.
+func ParseAPIKeys(raw string) ([]APIKey, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if file, ok := strings.CutPrefix(raw, "@"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read api keys file: %w", err)
+		}
+		raw = string(data)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+		return nil, fmt.Errorf("parse api keys: %w", err)
+	}
+	names := make(map[string]bool, len(keys))
+	for i, k := range keys {
+		if k.Name == "" || k.Key == "" {
+			return nil, fmt.Errorf("api key %d: name and key are required", i)
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("api key %d: duplicate name %q", i, k.Name)
+		}
+		names[k.Name] = true
+	}
+	return keys, nil
+}
+
+// apiKeyStore holds the current key set; it can be swapped at runtime (file reload) so keys
+// rotate without a restart.
+type apiKeyStore struct {
+	mu   sync.RWMutex
+	keys []APIKey
+	// signedOnly rejects plain X-API-Key / Bearer keys; only signed requests are accepted.
+	signedOnly bool
+	// requireNonce rejects signed POST/PUT/DELETE requests without X-Kzen-Nonce; nonces holds
+	// the ones seen (see nonce.go).
+	requireNonce bool
+	nonces       *nonceCache
+	// tokenSecret signs the access tokens minted for these keys (see tokens.go).
+	tokenSecret []byte
+	// cookieAuth accepts access tokens from the auth cookie, with CSRF checks (see csrf.go).
+	cookieAuth bool
+}
+
+func newAPIKeyStore(keys []APIKey) *apiKeyStore {
+	s := &apiKeyStore{nonces: newNonceCache()}
+	s.set(keys)
+	return s
+}
+
+func (s *apiKeyStore) set(keys []APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append([]APIKey(nil), keys...)
+}
+
+// lookup returns the name of the key matching key at now. Every key is compared in constant time
+// so the response time doesn't reveal which one matched.
+func (s *apiKeyStore) lookup(key string, now time.Time) (string, error) {
+	if key == "" {
+		return "", errAPIKeyMissing
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var match *APIKey
+	for i := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(s.keys[i].Key), []byte(key)) == 1 && match == nil {
+			match = &s.keys[i]
+		}
+	}
+	if match == nil {
+		return "", errAPIKeyInvalid
+	}
+	if !match.validAt(now) {
+		return match.Name, errAPIKeyExpired
+	}
+	return match.Name, nil
+}
+
+// byName returns the key called name, for verifying signed requests.
+func (s *apiKeyStore) byName(name string, now time.Time) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.Name == name {
+			if !k.validAt(now) {
+				return APIKey{}, errAPIKeyExpired
+			}
+			return k, nil
+		}
+	}
+	return APIKey{}, errAPIKeyInvalid
+}
+
+// isAdmin reports whether the key called name is an admin key.
+func (s *apiKeyStore) isAdmin(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.Name == name {
+			return k.Admin
+		}
+	}
+	return false
+}
+
+func (k APIKey) validAt(now time.Time) bool {
+	return (k.CreatedAt.IsZero() || !now.Before(k.CreatedAt)) && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
+
+// authenticate checks the request's key or signature and records per-key metrics. For signed
+// requests r.Body is read and verified first, then replaced with the verified bytes.
+//
+// A request already authenticated by an outer layer (see withAPIKey) gets that result back: its
+// signature nonce is spent and its body consumed, so checking it again would fail as a replay.
+func (s *apiKeyStore) authenticate(r *http.Request) (string, error) {
+	if name := apiKeyName(r.Context()); name != "" {
+		return name, nil
+	}
+	var name string
+	var err error
+	mode := "key"
+	if isSignedRequest(r) {
+		mode = "signature"
+		name, err = s.verifySignedRequest(r, time.Now())
+	} else if token := s.cookieToken(r); token != "" {
+		mode = "cookie"
+		name, err = s.verifyCookie(r, token, time.Now())
+	} else if isAccessToken(requestAPIKey(r)) {
+		// Tokens are meant to travel to browsers, so they are accepted with signedOnly too.
+		mode = "token"
+		name, err = s.verifyToken(r, requestAPIKey(r), time.Now())
+	} else if s.signedOnly && requestAPIKey(r) != "" {
+		err = errSignatureRequired
+	} else {
+		name, err = s.lookup(requestAPIKey(r), time.Now())
+	}
+	switch {
+	case err == nil:
+		metrics.add("kzen_api_key_requests_total", 1, "key", name, "mode", mode)
+	case errors.Is(err, errAPIKeyExpired):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "expired", "key", name)
+	case errors.Is(err, errAPIKeyMissing):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "missing")
+	case errors.Is(err, errSignatureDate):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "signature_date")
+	case errors.Is(err, errSignatureMismatch), errors.Is(err, errSignatureMalformed):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "signature")
+	case errors.Is(err, errSignatureReplay):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "replay", "key", name)
+	case errors.Is(err, errSignatureNonce):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "nonce", "key", name)
+	case errors.Is(err, errSignatureRequired):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "unsigned")
+	case errors.Is(err, errCSRF):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "csrf", "key", name)
+	case errors.Is(err, errTokenScope):
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "token_scope", "key", name)
+	default:
+		metrics.add("kzen_api_key_rejected_total", 1, "reason", "invalid")
+	}
+	return name, err
+}
+
+// watchFile re-reads path every interval and, when its modification time changes, replaces the
+// key set with static plus the file's keys. Parse errors keep the previous set.
+func (s *apiKeyStore) watchFile(ctx context.Context, path string, static []APIKey, interval time.Duration) {
+	var lastMod time.Time
+	if fi, err := os.Stat(path); err == nil {
+		lastMod = fi.ModTime()
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			lastMod = s.reloadIfChanged(path, static, lastMod)
+		}
+	}
+}
+
+// reloadIfChanged reloads path when its modification time differs from lastMod and returns the
+// time it saw.
+func (s *apiKeyStore) reloadIfChanged(path string, static []APIKey, lastMod time.Time) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil || fi.ModTime().Equal(lastMod) {
+		return lastMod
+	}
+	keys, err := ParseAPIKeys("@" + path)
+	if err != nil {
+		log.Printf("api keys reload: %v (keeping previous keys)", err)
+		return fi.ModTime()
+	}
+	s.set(append(append([]APIKey(nil), static...), keys...))
+	log.Printf("api keys reloaded from %s (%d keys)", path, len(keys))
+	return fi.ModTime()
+}
+
+type apiKeyNameKey struct{}
+
+// apiKeyName returns the name of the key that authenticated the request, or "".
+func apiKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameKey{}).(string)
+	return name
+}
+
+type apiKeyAdminKey struct{}
+
+// withAPIKey records the key that authenticated r in its context: its name and, unless it came
+// as an access token (which is never an admin credential), whether it is an admin key.
+func withAPIKey(keys *apiKeyStore, r *http.Request, name string) context.Context {
+	ctx := context.WithValue(r.Context(), apiKeyNameKey{}, name)
+	if keys.isAdmin(name) && !keys.viaToken(r) {
+		ctx = context.WithValue(ctx, apiKeyAdminKey{}, true)
+	}
+	return ctx
+}
+
+// apiKeyIsAdmin reports whether the request was authenticated by an admin key.
+func apiKeyIsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(apiKeyAdminKey{}).(bool)
+	return admin
+}
+
+func init() {
+	metrics.describe("kzen_api_key_requests_total", "counter", "Authenticated requests per API key name.")
+	metrics.describe("kzen_api_key_rejected_total", "counter", "Requests rejected by API key auth, by reason.")
+}
@@ -0,0 +1,118 @@
+package minioserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyStore_RotationOverlap(t *testing.T) {
+	switchAt := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	expireAt := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	store := newAPIKeyStore([]APIKey{
+		{Name: "old", Key: "old-secret", ExpiresAt: expireAt},
+		{Name: "new", Key: "new-secret", CreatedAt: switchAt},
+	})
+
+	cases := []struct {
+		key     string
+		now     time.Time
+		name    string
+		wantErr error
+	}{
+		{"old-secret", switchAt.Add(-time.Hour), "old", nil},
+		{"new-secret", switchAt.Add(-time.Hour), "new", errAPIKeyExpired},
+		{"old-secret", switchAt.Add(time.Hour), "old", nil},
+		{"new-secret", switchAt.Add(time.Hour), "new", nil},
+		{"old-secret", expireAt, "old", errAPIKeyExpired},
+		{"nope", switchAt, "", errAPIKeyInvalid},
+		{"", switchAt, "", errAPIKeyMissing},
+	}
+	for _, tc := range cases {
+		name, err := store.lookup(tc.key, tc.now)
+		if name != tc.name || !errors.Is(err, tc.wantErr) {
+			t.Errorf("lookup(%q, %s) = %q, %v; want %q, %v", tc.key, tc.now, name, err, tc.name, tc.wantErr)
+		}
+	}
+}
+
+func TestParseAPIKeys_Validation(t *testing.T) {
+	if _, err := ParseAPIKeys(`[{"name":"a","key":"x"},{"name":"a","key":"y"}]`); err == nil {
+		t.Error("expected error for duplicate names")
+	}
+	if _, err := ParseAPIKeys(`[{"name":"a"}]`); err == nil {
+		t.Error("expected error for missing key")
+	}
+	keys, err := ParseAPIKeys(`[{"name":"a","key":"x","expiresAt":"2026-01-01T00:00:00Z"}]`)
+	if err != nil || len(keys) != 1 || keys[0].ExpiresAt.Year() != 2026 {
+		t.Errorf("ParseAPIKeys = %+v, %v", keys, err)
+	}
+}
+
+func TestAPIKeyStore_ReloadIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`[{"name":"a","key":"one"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(path)
+	store := newAPIKeyStore([]APIKey{{Name: "a", Key: "one"}})
+	static := []APIKey{{Name: "default", Key: "static"}}
+
+	if got := store.reloadIfChanged(path, static, fi.ModTime()); !got.Equal(fi.ModTime()) {
+		t.Errorf("unchanged file: lastMod moved to %s", got)
+	}
+	if _, err := store.lookup("static", time.Now()); err == nil {
+		t.Error("unchanged file should not be reloaded")
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name":"b","key":"two"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := fi.ModTime().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	store.reloadIfChanged(path, static, fi.ModTime())
+
+	if _, err := store.lookup("two", time.Now()); err != nil {
+		t.Errorf("new key not loaded: %v", err)
+	}
+	if _, err := store.lookup("one", time.Now()); err == nil {
+		t.Error("removed key still valid")
+	}
+	if _, err := store.lookup("static", time.Now()); err != nil {
+		t.Errorf("static key lost on reload: %v", err)
+	}
+
+	os.WriteFile(path, []byte(`not json`), 0o600)
+	evenLater := later.Add(time.Minute)
+	os.Chtimes(path, evenLater, evenLater)
+	store.reloadIfChanged(path, static, later)
+	if _, err := store.lookup("two", time.Now()); err != nil {
+		t.Errorf("bad file dropped previous keys: %v", err)
+	}
+}
+
+func TestAPIKeyMiddleware_SetsKeyName(t *testing.T) {
+	store := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	var got string
+	h := apiKeyMiddleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = apiKeyName(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/objects/a", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || got != "web" {
+		t.Errorf("status %d, key name %q", rec.Code, got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/objects/a", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("missing key: status %d, want 401", rec.Code)
+	}
+}
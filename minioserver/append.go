@@ -0,0 +1,197 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	// appendMaxChunkBytes caps one append request body; the endpoint is meant for log lines, not media.
+	appendMaxChunkBytes = 10 << 20
+	// appendComposeMinBytes is S3's minimum size for every part but the last. Existing objects
+	// at least this big are extended server-side with ComposeObject instead of being re-uploaded.
+	appendComposeMinBytes = 5 << 20
+	// appendAttempts bounds the tries of an append whose object another writer (e.g. another
+	// replica) changed between the read and the write.
+	appendAttempts = 3
+)
+
+// isAppend reports whether r appends to its object: POST {key}?append. A flag rather than a path
+// suffix, so a key ending in "/append" is still an ordinary key.
+func isAppend(r *http.Request) bool {
+	return r.Method == http.MethodPost && r.URL.Query().Has("append")
+}
+
+// appendLocks serializes appends to the same key within this process so concurrent writers
+// don't read the same base object and drop each other's lines.
+var appendLocks = &keyedMutex{locks: make(map[string]*keyedMutexEntry)}
+
+type keyedMutexEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedMutexEntry
+}
+
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	e, ok := k.locks[key]
+	if !ok {
+		e = &keyedMutexEntry{}
+		k.locks[key] = e
+	}
+	e.refs++
+	k.mu.Unlock()
+
+	e.mu.Lock()
+	return func() {
+		e.mu.Unlock()
+		k.mu.Lock()
+		e.refs--
+		if e.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// proxyAppendWithPrefix handles POST {pathPrefix}{key}?append: the request body is appended to the
+// object at key (created if missing). Small objects are read, concatenated and rewritten; large ones
+// are extended with ComposeObject so the existing bytes never leave MinIO.
+func proxyAppendWithPrefix(client *minio.Client, bucket string, pathPrefix string, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		objectKey := strings.TrimPrefix(r.URL.Path, pathPrefix)
+		if objectKey == "" {
+			respondError(w, "object key required", http.StatusBadRequest)
+			return
+		}
+
+		chunk, err := io.ReadAll(io.LimitReader(r.Body, appendMaxChunkBytes+1))
+		if err != nil {
+			respondError(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if len(chunk) > appendMaxChunkBytes {
+			respondError(w, fmt.Sprintf("append body exceeds %d bytes", appendMaxChunkBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 60*time.Second)
+		defer cancel()
+
+		unlock := appendLocks.Lock(bucket + "/" + objectKey)
+		defer unlock()
+
+		if err := opts.UploadSlots.Acquire(ctx); err != nil {
+			respondUploadBusy(w, opts.UploadSlots, err)
+			return
+		}
+		defer opts.UploadSlots.Release()
+
+		if err := opts.checkOwner(ctx, client, bucket, objectKey); err != nil {
+			respondOwnerError(w, err)
+			return
+		}
+		size, err := appendToObject(ctx, client, bucket, objectKey, chunk, r.Header.Get("Content-Type"), opts.stampOwner(ctx, nil))
+		if err != nil {
+			log.Printf("append object %q: %v", objectKey, err)
+			respondStorageError(w, err, "append failed")
+			return
+		}
+		opts.changed(bucket, objectKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(fmt.Sprintf(`{"ok":true,"key":%q,"size":%d}`, objectKey, size)))
+	}
+}
+
+// appendToObject writes existing+chunk to objectKey and returns the new object size. meta is the
+// user metadata of an object the chunk creates; existing objects keep theirs. Every write is
+// conditional on the object read, so an append that races another writer starts over instead of
+// dropping the other writer's bytes.
+func appendToObject(ctx context.Context, client *minio.Client, bucket, objectKey string, chunk []byte, contentType string, meta map[string]string) (int64, error) {
+	for attempt := 1; ; attempt++ {
+		size, err := appendOnce(ctx, client, bucket, objectKey, chunk, contentType, meta)
+		if attempt == appendAttempts || golib.MinioStatus(err) != http.StatusPreconditionFailed {
+			return size, err
+		}
+		metrics.add("kzen_append_retries_total", 1)
+	}
+}
+
+func appendOnce(ctx context.Context, client *minio.Client, bucket, objectKey string, chunk []byte, contentType string, meta map[string]string) (int64, error) {
+	info, err := client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		if !golib.IsNotFound(err) {
+			return 0, fmt.Errorf("stat: %w", err)
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		opts := minio.PutObjectOptions{ContentType: contentType, UserMetadata: meta}
+		opts.SetMatchETagExcept("*")
+		_, err := client.PutObject(ctx, bucket, objectKey, bytes.NewReader(chunk), int64(len(chunk)), opts)
+		return int64(len(chunk)), err
+	}
+	if len(chunk) == 0 {
+		return info.Size, nil
+	}
+
+	if info.Size >= appendComposeMinBytes {
+		partKey := objectKey + ".append-" + uuid.New().String()
+		if _, err := client.PutObject(ctx, bucket, partKey, bytes.NewReader(chunk), int64(len(chunk)),
+			minio.PutObjectOptions{ContentType: info.ContentType}); err != nil {
+			return 0, fmt.Errorf("put part: %w", err)
+		}
+		defer func() {
+			if err := client.RemoveObject(context.Background(), bucket, partKey, minio.RemoveObjectOptions{}); err != nil {
+				log.Printf("append: remove part %q: %v", partKey, err)
+			}
+		}()
+		_, err := client.ComposeObject(ctx,
+			minio.CopyDestOptions{Bucket: bucket, Object: objectKey},
+			minio.CopySrcOptions{Bucket: bucket, Object: objectKey, MatchETag: info.ETag},
+			minio.CopySrcOptions{Bucket: bucket, Object: partKey},
+		)
+		if err != nil {
+			return 0, fmt.Errorf("compose: %w", err)
+		}
+		return info.Size + int64(len(chunk)), nil
+	}
+
+	obj, err := client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("get: %w", err)
+	}
+	existing, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return 0, fmt.Errorf("read: %w", err)
+	}
+	combined := append(existing, chunk...)
+	opts := minio.PutObjectOptions{ContentType: info.ContentType, UserMetadata: info.UserMetadata}
+	opts.SetMatchETag(info.ETag)
+	if _, err := client.PutObject(ctx, bucket, objectKey, bytes.NewReader(combined), int64(len(combined)), opts); err != nil {
+		return 0, fmt.Errorf("put: %w", err)
+	}
+	return int64(len(combined)), nil
+}
+
+func init() {
+	metrics.describe("kzen_append_retries_total", "counter", "Appends started over because another writer changed the object.")
+}
@@ -0,0 +1,229 @@
+package minioserver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// appendS3 is an in-memory bucket "bkt" with what appends use: conditional PUTs, and multipart
+// uploads, including parts copied from other objects (ComposeObject), plus CopyObject. beforeWrite, if set, runs
+// before every conditional write, e.g. to play another writer; gets counts object downloads.
+type appendS3 struct {
+	mu          sync.Mutex
+	objects     map[string][]byte
+	etags       map[string]string
+	parts       [][]byte
+	version     int
+	gets        int
+	beforeWrite func(s *appendS3)
+}
+
+// put stores data under key with a new ETag; callers hold s.mu.
+func (s *appendS3) put(key string, data []byte) {
+	s.version++
+	s.objects[key], s.etags[key] = data, "v"+strconv.Itoa(s.version)
+}
+
+func newAppendS3(t *testing.T) (*minio.Client, *appendS3) {
+	t.Helper()
+	s := &appendS3{objects: map[string][]byte{}, etags: map[string]string{}}
+	precondition := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		io.WriteString(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		body := decodeAWSChunked(r)
+		key := strings.TrimPrefix(r.URL.Path, "/bkt/")
+		q := r.URL.Query()
+		copySource := r.Header.Get("X-Amz-Copy-Source")
+		if r.Method == http.MethodPut && s.beforeWrite != nil {
+			s.beforeWrite(s)
+		}
+		switch {
+		case r.Method == http.MethodHead, r.Method == http.MethodGet:
+			data, ok := s.objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				if r.Method == http.MethodGet {
+					io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`)
+				}
+				return
+			}
+			w.Header().Set("ETag", `"`+s.etags[key]+`"`)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if r.Method == http.MethodGet {
+				s.gets++
+				w.Write(data)
+			}
+		case r.Method == http.MethodPut && q.Has("partNumber") && copySource != "":
+			src, _ := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(copySource, "/"), "bkt/"))
+			if m := r.Header.Get("X-Amz-Copy-Source-If-Match"); m != "" && strings.Trim(m, `"`) != s.etags[src] {
+				precondition(w)
+				return
+			}
+			var start, end int
+			fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &start, &end)
+			s.parts = append(s.parts, bytes.Clone(s.objects[src][start:end+1]))
+			fmt.Fprintf(w, `<CopyPartResult><ETag>"p%d"</ETag><LastModified>2006-01-02T15:04:05.000Z</LastModified></CopyPartResult>`, len(s.parts))
+		case r.Method == http.MethodPut && copySource != "":
+			src, _ := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(copySource, "/"), "bkt/"))
+			s.put(key, bytes.Clone(s.objects[src]))
+			fmt.Fprintf(w, `<CopyObjectResult><ETag>"%s"</ETag><LastModified>2006-01-02T15:04:05.000Z</LastModified></CopyObjectResult>`, s.etags[key])
+		case r.Method == http.MethodPut && q.Has("partNumber"):
+			s.parts = append(s.parts, body)
+			w.Header().Set("ETag", fmt.Sprintf(`"p%d"`, len(s.parts)))
+		case r.Method == http.MethodPut:
+			current, exists := s.etags[key]
+			ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+			if (ifNoneMatch != "" && exists && (ifNoneMatch == `"*"` || ifNoneMatch == `"`+current+`"`)) ||
+				(ifMatch != "" && (!exists || ifMatch != `"`+current+`"`)) {
+				precondition(w)
+				return
+			}
+			s.put(key, body)
+			w.Header().Set("ETag", `"`+s.etags[key]+`"`)
+		case r.Method == http.MethodPost && q.Has("uploads"):
+			s.parts = nil
+			io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPost && q.Has("uploadId"):
+			s.put(key, bytes.Join(s.parts, nil))
+			io.WriteString(w, `<CompleteMultipartUploadResult><Bucket>bkt</Bucket><ETag>"`+s.etags[key]+`"</ETag></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodDelete:
+			delete(s.objects, key)
+			delete(s.etags, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := minio.New(strings.TrimPrefix(srv.URL, "http://"), &minio.Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, s
+}
+
+func TestAppend(t *testing.T) {
+	client, s := newAppendS3(t)
+	h := objectsHandlerWithPrefix(client, "bkt", "/objects/", proxyOptions{})
+	do := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, line := range []string{"a\n", "b\n"} {
+		if rec := do("/objects/logs/app.log?append", line); rec.Code != http.StatusOK {
+			t.Fatalf("append %q: %d %s", line, rec.Code, rec.Body)
+		}
+	}
+	if got := string(s.objects["logs/app.log"]); got != "a\nb\n" {
+		t.Errorf("appended object = %q", got)
+	}
+
+	// A key ending in /append is an ordinary key, not an append to its parent.
+	if rec := do("/objects/logs/app.log/append", "new"); rec.Code != http.StatusCreated {
+		t.Fatalf("POST to .../append: %d %s", rec.Code, rec.Body)
+	}
+	if string(s.objects["logs/app.log/append"]) != "new" || string(s.objects["logs/app.log"]) != "a\nb\n" {
+		t.Errorf("POST to .../append appended: %q", s.objects)
+	}
+
+	// Retention refuses appends, and only appends.
+	locked := mountHandler(client, Mount{Route: "/locked/", Bucket: "bkt", Type: MountTypeObjects,
+		Features: &MountFeatures{Upload: true}, Retention: &MountRetention{LegalHold: true}}, proxyOptions{})
+	for target, want := range map[string]int{"/locked/audit.log?append": http.StatusForbidden, "/locked/audit.log/append": http.StatusCreated} {
+		rec := httptest.NewRecorder()
+		locked.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader("x")))
+		if rec.Code != want {
+			t.Errorf("POST %s on a retention mount: %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+// Another writer changes the object between the read and the write: the append starts over
+// from the new object rather than overwriting it.
+func TestAppend_ConcurrentWriter(t *testing.T) {
+	client, s := newAppendS3(t)
+	s.put("log", []byte("a"))
+	s.beforeWrite = func(s *appendS3) {
+		s.put("log", append(s.objects["log"], 'X'))
+		s.beforeWrite = nil
+	}
+	size, err := appendToObject(t.Context(), client, "bkt", "log", []byte("b"), "", nil)
+	if err != nil || size != 3 || string(s.objects["log"]) != "aXb" {
+		t.Errorf("append after a concurrent write: %d, %v, object %q", size, err, s.objects["log"])
+	}
+
+	// A key created by someone else after the Stat isn't replaced either.
+	s.beforeWrite = func(s *appendS3) {
+		s.put("new", []byte("theirs "))
+		s.beforeWrite = nil
+	}
+	if _, err := appendToObject(t.Context(), client, "bkt", "new", []byte("mine"), "", nil); err != nil || string(s.objects["new"]) != "theirs mine" {
+		t.Errorf("append to a key created concurrently: %v, object %q", err, s.objects["new"])
+	}
+
+	// A writer that never stops wins after appendAttempts tries.
+	s.beforeWrite = func(s *appendS3) { s.put("log", append(s.objects["log"], 'X')) }
+	_, err = appendToObject(t.Context(), client, "bkt", "log", []byte("c"), "", nil)
+	if golib.MinioStatus(err) != http.StatusPreconditionFailed {
+		t.Errorf("append racing a constant writer: %v, want 412", err)
+	}
+	if strings.Contains(string(s.objects["log"]), "c") {
+		t.Errorf("failed append was stored: %q", s.objects["log"])
+	}
+}
+
+// Objects of appendComposeMinBytes and more are extended with ComposeObject: the existing bytes
+// are never downloaded, and a source changed mid-compose makes the append start over.
+func TestAppend_Compose(t *testing.T) {
+	client, s := newAppendS3(t)
+	big := bytes.Repeat([]byte("x"), appendComposeMinBytes)
+	s.put("big.log", big)
+
+	size, err := appendToObject(t.Context(), client, "bkt", "big.log", []byte("tail"), "", nil)
+	if err != nil || size != int64(len(big))+4 {
+		t.Fatalf("compose append: %d, %v", size, err)
+	}
+	if got := s.objects["big.log"]; !bytes.Equal(got[:len(big)], big) || string(got[len(big):]) != "tail" {
+		t.Errorf("composed object: %d bytes ending in %q", len(got), got[len(got)-8:])
+	}
+	if s.gets != 0 {
+		t.Errorf("existing object downloaded %d times", s.gets)
+	}
+	if len(s.objects) != 1 {
+		t.Errorf("append parts left behind: %d objects", len(s.objects))
+	}
+
+	// Another writer appends while the parts are copied.
+	copies := 0
+	s.beforeWrite = func(s *appendS3) {
+		if copies++; copies == 2 {
+			s.put("big.log", append(bytes.Clone(s.objects["big.log"]), "X"...))
+		}
+	}
+	if _, err := appendToObject(t.Context(), client, "bkt", "big.log", []byte("more"), "", nil); err != nil {
+		t.Fatalf("compose append after a concurrent write: %v", err)
+	}
+	if got := s.objects["big.log"]; !strings.HasSuffix(string(got), "tailXmore") || len(got) != len(big)+9 {
+		t.Errorf("composed object after a concurrent write: %d bytes ending in %q", len(got), got[len(got)-12:])
+	}
+}
@@ -0,0 +1,361 @@
+package minioserver
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func init() {
+	metrics.describe("kzen_audit_runs_total", "counter", "Bucket audits, by result (ok|failed).")
+	metrics.describe("kzen_audit_last_run_timestamp_seconds", "gauge", "Unix time the last bucket audit finished.")
+	metrics.describe("kzen_audit_objects", "gauge", "Objects walked by the last bucket audit, by check (listed|sampled|verified).")
+	metrics.describe("kzen_audit_problems", "gauge", "Problems found by the last bucket audit, by problem.")
+}
+
+// auditReportPrefix holds the audit reports, in the audited bucket; audits skip it.
+const auditReportPrefix = "kzen-audit/"
+
+// auditMetaSHA256 is user metadata (X-Amz-Meta-Sha256) holding the hex SHA-256 of an object,
+// e.g. set by a processor; the audit checks sampled objects against it.
+const auditMetaSHA256 = "Sha256"
+
+// auditProblemsMax bounds the problems listed in a report; the counts cover all of them.
+const auditProblemsMax = 1000
+
+// Problems an audit reports.
+const (
+	auditEmpty      = "empty"           // zero bytes
+	auditTruncated  = "truncated"       // fewer bytes than its size, or an image without its end marker
+	auditMismatch   = "sha256_mismatch" // content does not hash to its recorded SHA-256
+	auditUnreadable = "unreadable"      // reading it failed
+)
+
+// AuditProblem is one object an audit flagged.
+type AuditProblem struct {
+	Key     string `json:"key"`
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+	Size    int64  `json:"size"`
+}
+
+// AuditReport is the outcome of one audit; it is also stored as an object under kzen-audit/.
+type AuditReport struct {
+	Bucket    string         `json:"bucket"`
+	Prefix    string         `json:"prefix"`
+	ReportKey string         `json:"reportKey"`
+	Started   time.Time      `json:"started"`
+	Duration  string         `json:"duration"`
+	Objects   int            `json:"objects"`
+	Bytes     int64          `json:"bytes"`
+	Sampled   int            `json:"sampled"`  // objects read in full
+	Verified  int            `json:"verified"` // sampled objects with a SHA-256 to check
+	Counts    map[string]int `json:"counts"`   // problems by kind
+	Problems  []AuditProblem `json:"problems"` // the first auditProblemsMax
+}
+
+func (r *AuditReport) flag(p AuditProblem) {
+	r.Counts[p.Problem]++
+	if len(r.Problems) < auditProblemsMax {
+		r.Problems = append(r.Problems, p)
+	}
+}
+
+// auditor walks prefix of bucket: every object is checked for zero bytes, and a sample of
+// sampleRate (0 to 1) is read in full to check its size, its SHA-256 when one is recorded, and
+// the end marker of JPEG and PNG images.
+type auditor struct {
+	client     *minio.Client
+	bucket     string
+	prefix     string
+	sampleRate float64
+
+	mu      sync.Mutex
+	running bool
+	last    *AuditReport
+	lastErr string
+	next    time.Time
+}
+
+// newAuditor builds the auditor of cfg and, with a schedule, starts running it.
+func newAuditor(client *minio.Client, cfg Config) (*auditor, error) {
+	a := &auditor{
+		client:     client,
+		bucket:     cmp.Or(cfg.AuditBucket, cfg.Bucket),
+		prefix:     strings.TrimPrefix(cfg.AuditPrefix, "/"),
+		sampleRate: min(max(float64(cfg.AuditSamplePercent)/100, 0), 1),
+	}
+	if cfg.AuditSchedule != "" {
+		sched, err := parseCron(cfg.AuditSchedule)
+		if err != nil {
+			return nil, fmt.Errorf("AUDIT_SCHEDULE: %w", err)
+		}
+		go a.schedule(context.Background(), sched)
+	}
+	log.Printf("audits of %s/%s (schedule %q, %d%% sampled)", a.bucket, a.prefix, cfg.AuditSchedule, cfg.AuditSamplePercent)
+	return a, nil
+}
+
+// errAuditRunning is returned by start while an audit is in progress.
+var errAuditRunning = errors.New("an audit is already running")
+
+func (a *auditor) start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		return errAuditRunning
+	}
+	a.running = true
+	return nil
+}
+
+// run audits the bucket, stores the report and publishes its metrics. The caller must have called
+// start.
+func (a *auditor) run(ctx context.Context) (*AuditReport, error) {
+	report, err := a.audit(ctx)
+	if err == nil {
+		err = a.store(ctx, report)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running = false
+	if err != nil {
+		a.lastErr = err.Error()
+		log.Printf("audit %s/%s failed: %v", a.bucket, a.prefix, err)
+		metrics.add("kzen_audit_runs_total", 1, "result", "failed")
+		return nil, err
+	}
+	a.last, a.lastErr = report, ""
+	log.Printf("audit %s/%s: %d objects, %d sampled, %d problems (%s)", a.bucket, a.prefix, report.Objects, report.Sampled, len(report.Problems), report.ReportKey)
+	metrics.add("kzen_audit_runs_total", 1, "result", "ok")
+	metrics.set("kzen_audit_last_run_timestamp_seconds", float64(time.Now().Unix()))
+	metrics.set("kzen_audit_objects", float64(report.Objects), "check", "listed")
+	metrics.set("kzen_audit_objects", float64(report.Sampled), "check", "sampled")
+	metrics.set("kzen_audit_objects", float64(report.Verified), "check", "verified")
+	for _, p := range []string{auditEmpty, auditTruncated, auditMismatch, auditUnreadable} {
+		metrics.set("kzen_audit_problems", float64(report.Counts[p]), "problem", p)
+	}
+	return report, nil
+}
+
+func (a *auditor) audit(ctx context.Context) (*AuditReport, error) {
+	started := time.Now().UTC()
+	report := &AuditReport{
+		Bucket:    a.bucket,
+		Prefix:    a.prefix,
+		ReportKey: auditReportPrefix + "report-" + started.Format("20060102T150405Z") + ".json",
+		Started:   started,
+		Counts:    map[string]int{},
+		Problems:  []AuditProblem{},
+	}
+	for obj := range a.client.ListObjects(ctx, a.bucket, minio.ListObjectsOptions{Prefix: a.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if strings.HasSuffix(obj.Key, "/") || strings.HasPrefix(obj.Key, auditReportPrefix) || strings.HasPrefix(obj.Key, selfTestPrefix) {
+			continue
+		}
+		report.Objects++
+		report.Bytes += obj.Size
+		if obj.Size == 0 {
+			report.flag(AuditProblem{Key: obj.Key, Problem: auditEmpty})
+			continue
+		}
+		if rand.Float64() >= a.sampleRate {
+			continue
+		}
+		report.Sampled++
+		verified, problem := a.check(ctx, obj.Key)
+		if verified {
+			report.Verified++
+		}
+		if problem != nil {
+			report.flag(*problem)
+		}
+	}
+	report.Duration = time.Since(started).Round(time.Millisecond).String()
+	return report, nil
+}
+
+// check reads key in full. It reports whether a recorded SHA-256 was checked, and the problem
+// found, if any.
+func (a *auditor) check(ctx context.Context, key string) (bool, *AuditProblem) {
+	obj, err := a.client.GetObject(ctx, a.bucket, key, minio.GetObjectOptions{Checksum: true})
+	if err != nil {
+		return false, &AuditProblem{Key: key, Problem: auditUnreadable, Detail: err.Error()}
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return false, &AuditProblem{Key: key, Problem: auditUnreadable, Detail: err.Error()}
+	}
+	h := sha256.New()
+	tail := &tailBuffer{max: 32}
+	n, err := io.Copy(io.MultiWriter(h, tail), obj)
+	switch {
+	case err != nil && !errors.Is(err, io.ErrUnexpectedEOF):
+		return false, &AuditProblem{Key: key, Problem: auditUnreadable, Detail: err.Error(), Size: info.Size}
+	case n != info.Size:
+		return false, &AuditProblem{Key: key, Problem: auditTruncated, Detail: fmt.Sprintf("read %d of %d bytes", n, info.Size), Size: info.Size}
+	}
+	if !imageEndMarkerOK(info.ContentType, tail.buf) {
+		return false, &AuditProblem{Key: key, Problem: auditTruncated, Detail: "no " + info.ContentType + " end marker", Size: info.Size}
+	}
+
+	want := expectedSHA256(key, info)
+	if want == "" {
+		return false, nil
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return true, &AuditProblem{Key: key, Problem: auditMismatch, Detail: "sha256 " + got + ", recorded " + want, Size: info.Size}
+	}
+	return true, nil
+}
+
+// expectedSHA256 returns the hex SHA-256 recorded for an object: its S3 checksum (not for
+// multipart uploads, whose checksum covers the parts), its Sha256 metadata, or the name of a
+// content-hash copy. "" when none is recorded.
+func expectedSHA256(key string, info minio.ObjectInfo) string {
+	if c := info.ChecksumSHA256; c != "" && !strings.Contains(c, "-") {
+		if sum, err := base64.StdEncoding.DecodeString(c); err == nil && len(sum) == sha256.Size {
+			return hex.EncodeToString(sum)
+		}
+	}
+	if v := strings.ToLower(info.UserMetadata[auditMetaSHA256]); len(v) == 2*sha256.Size {
+		return v
+	}
+	if name, ok := strings.CutPrefix(key, hashBlobPrefix); ok {
+		if m := hashNamePattern.FindStringSubmatch(name); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// imageEndMarkerOK reports whether tail, the last bytes of an object, ends a JPEG (EOI marker)
+// or PNG (IEND chunk) of that content type; other types always pass. Some cameras append data
+// after the EOI, so the marker only has to be near the end.
+func imageEndMarkerOK(contentType string, tail []byte) bool {
+	switch strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])) {
+	case "image/jpeg":
+		return bytes.Contains(tail, []byte{0xFF, 0xD9})
+	case "image/png":
+		return bytes.Contains(tail, []byte("IEND"))
+	}
+	return true
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+// store writes the report under its key and as kzen-audit/latest.json.
+func (a *auditor) store(ctx context.Context, report *AuditReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{report.ReportKey, auditReportPrefix + "latest.json"} {
+		_, err := a.client.PutObject(ctx, a.bucket, key, bytes.NewReader(data), int64(len(data)),
+			minio.PutObjectOptions{ContentType: "application/json"})
+		if err != nil {
+			return fmt.Errorf("store report: %w", err)
+		}
+	}
+	return nil
+}
+
+// schedule runs an audit whenever sched fires, until ctx is done.
+func (a *auditor) schedule(ctx context.Context, sched *cronSchedule) {
+	for {
+		next := sched.next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		a.mu.Lock()
+		a.next = next
+		a.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := a.start(); err != nil {
+			log.Printf("audit: scheduled run skipped: %v", err)
+			continue
+		}
+		a.run(ctx)
+	}
+}
+
+// auditHandler serves the auditor's admin endpoint:
+//
+//	GET  /admin/audit   state: running, last report and error, next scheduled run
+//	POST /admin/audit   start an audit in the background (202); ?wait=1 waits for the report
+func auditHandler(a *auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			a.mu.Lock()
+			state := map[string]any{"running": a.running, "bucket": a.bucket, "prefix": a.prefix, "last": a.last}
+			if a.lastErr != "" {
+				state["lastError"] = a.lastErr
+			}
+			if !a.next.IsZero() {
+				state["next"] = a.next
+			}
+			a.mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state)
+		case http.MethodPost:
+			if err := a.start(); err != nil {
+				respondErrorCode(w, err.Error(), "audit_running", http.StatusConflict)
+				return
+			}
+			if q := r.URL.Query().Get("wait"); q != "1" && q != "true" {
+				go a.run(context.Background())
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]any{"started": true})
+				return
+			}
+			report, err := a.run(r.Context())
+			if err != nil {
+				respondError(w, "audit failed: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package minioserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditor(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	good := []byte("hashed content")
+	sum := sha256.Sum256(good)
+	objects["sha256/"+hex.EncodeToString(sum[:])+".txt"] = good
+	objects["sha256/"+strings.Repeat("0", 64)+".txt"] = []byte("bit rot")
+	objects["kzen/empty.txt"] = nil
+	objects["kzen/a.txt"] = []byte("a")
+	objects[auditReportPrefix+"old.json"] = nil // earlier reports are not audited
+
+	a := &auditor{client: client, bucket: "files", sampleRate: 1}
+	rec := httptest.NewRecorder()
+	auditHandler(a).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/audit?wait=1", nil))
+	var report AuditReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != http.StatusOK || report.Objects != 4 || report.Sampled != 3 || report.Verified != 2 {
+		t.Fatalf("audit: %d %s", rec.Code, rec.Body.String())
+	}
+	if report.Counts[auditEmpty] != 1 || report.Counts[auditMismatch] != 1 || len(report.Problems) != 2 {
+		t.Errorf("problems: %+v", report.Problems)
+	}
+	var stored AuditReport
+	if err := json.Unmarshal(objects[auditReportPrefix+"latest.json"], &stored); err != nil || stored.ReportKey != report.ReportKey || objects[report.ReportKey] == nil {
+		t.Errorf("stored report: %v %+v", err, stored)
+	}
+	if got := metrics.value("kzen_audit_problems", "problem", auditMismatch); got != 1 {
+		t.Errorf("kzen_audit_problems{sha256_mismatch} = %v", got)
+	}
+}
+
+func TestImageEndMarkerOK(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		tail        []byte
+		want        bool
+	}{
+		{"image/jpeg", []byte{0x00, 0xFF, 0xD9}, true},
+		{"image/jpeg", []byte{0xFF, 0xD9, 0, 0, 0}, true},
+		{"image/jpeg", []byte{0x12, 0x34}, false},
+		{"image/png", []byte("....IEND\xaeB`\x82"), true},
+		{"image/png; charset=binary", []byte("IDAT...."), false},
+		{"text/plain", nil, true},
+	} {
+		if got := imageEndMarkerOK(tc.contentType, tc.tail); got != tc.want {
+			t.Errorf("imageEndMarkerOK(%q, %q) = %v", tc.contentType, tc.tail, got)
+		}
+	}
+}
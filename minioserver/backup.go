@@ -0,0 +1,479 @@
+package minioserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+func init() {
+	metrics.describe("kzen_backups_total", "counter", "Backup runs, by result (ok|failed).")
+	metrics.describe("kzen_backup_last_success_timestamp_seconds", "gauge", "Unix time the last successful backup finished.")
+	metrics.describe("kzen_backup_last_bytes", "gauge", "Object bytes written by the last successful backup.")
+}
+
+// backupManifestName is the manifest of the last backup in a backup target: the ETag of every
+// object it covered, which the next incremental backup compares against.
+const backupManifestName = "kzen-backup-manifest.json"
+
+// backupMetaDir holds the entries of an archive that are not objects (its manifest); restores
+// skip it.
+const backupMetaDir = ".kzen-backup/"
+
+// PAX records of archive entries, carrying what a restore needs besides the content.
+const (
+	backupPAXETag            = "KZEN.etag"
+	backupPAXContentType     = "KZEN.content-type"
+	backupPAXContentEncoding = "KZEN.content-encoding"
+	backupPAXMetaPrefix      = "KZEN.meta."
+)
+
+// backupManifest describes one backup; it is written inside the archive (under backupMetaDir)
+// and, for the last backup, as backupManifestName next to the archives.
+type backupManifest struct {
+	Archive     string            `json:"archive"`
+	Time        time.Time         `json:"time"`
+	Bucket      string            `json:"bucket"`
+	Prefix      string            `json:"prefix"`
+	Incremental bool              `json:"incremental"`
+	Base        string            `json:"base,omitempty"`    // previous archive, for incremental backups
+	Deleted     []string          `json:"deleted,omitempty"` // keys gone since Base
+	ETags       map[string]string `json:"etags"`             // every object under Prefix
+}
+
+// BackupReport is the outcome of one backup.
+type BackupReport struct {
+	Archive     string    `json:"archive"`
+	Incremental bool      `json:"incremental"`
+	Base        string    `json:"base,omitempty"`
+	Objects     int       `json:"objects"` // objects written to the archive
+	Unchanged   int       `json:"unchanged,omitempty"`
+	Deleted     int       `json:"deleted,omitempty"`
+	Bytes       int64     `json:"bytes"` // object bytes, before compression
+	Started     time.Time `json:"started"`
+	Duration    string    `json:"duration"`
+}
+
+// backupStore is where archives and the manifest are written: a bucket prefix or a directory.
+type backupStore interface {
+	put(ctx context.Context, name string, r io.Reader) error
+	// get returns an error satisfying errors.Is(err, os.ErrNotExist) for missing names.
+	get(ctx context.Context, name string) (io.ReadCloser, error)
+	String() string
+}
+
+// parseBackupTarget parses BACKUP_TARGET: "s3://bucket/prefix" for a bucket on the same MinIO, or
+// a local directory.
+func parseBackupTarget(client *minio.Client, target string) (backupStore, error) {
+	if rest, ok := strings.CutPrefix(target, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("backup target %q: bucket required", target)
+		}
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		return &bucketBackupStore{client: client, bucket: bucket, prefix: prefix}, nil
+	}
+	if !filepath.IsAbs(target) {
+		return nil, fmt.Errorf("backup target %q: want s3://bucket/prefix or an absolute path", target)
+	}
+	if err := os.MkdirAll(target, 0o750); err != nil {
+		return nil, err
+	}
+	return dirBackupStore(target), nil
+}
+
+type bucketBackupStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *bucketBackupStore) put(ctx context.Context, name string, r io.Reader) error {
+	// Archives are streamed: the size is unknown, so bound the buffered part size.
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+name, r, -1, minio.PutObjectOptions{PartSize: 64 << 20})
+	return err
+}
+
+func (s *bucketBackupStore) get(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if golib.IsNotFound(err) {
+			return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *bucketBackupStore) String() string { return "s3://" + s.bucket + "/" + s.prefix }
+
+// dirBackupStore writes each file under a temporary name and renames it when complete, so a
+// failed backup never leaves a truncated archive behind.
+type dirBackupStore string
+
+func (d dirBackupStore) put(ctx context.Context, name string, r io.Reader) error {
+	dst := filepath.Join(string(d), name)
+	f, err := os.CreateTemp(string(d), "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dst)
+}
+
+func (d dirBackupStore) get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), name))
+}
+
+func (d dirBackupStore) String() string { return string(d) }
+
+// backupJob writes every object under prefix of bucket into a timestamped tar.zst in store. With
+// incremental set, archives after the first hold only the objects whose ETag changed since the
+// previous backup, and list the deleted keys in their manifest.
+type backupJob struct {
+	client      *minio.Client
+	bucket      string
+	prefix      string
+	store       backupStore
+	incremental bool
+
+	mu      sync.Mutex
+	running bool
+	last    *BackupReport
+	lastErr string
+	next    time.Time
+}
+
+// newBackupJob builds the backup job of cfg and, with a schedule, starts running it.
+func newBackupJob(client *minio.Client, cfg Config) (*backupJob, error) {
+	store, err := parseBackupTarget(client, cfg.BackupTarget)
+	if err != nil {
+		return nil, err
+	}
+	b := &backupJob{
+		client:      client,
+		bucket:      cmp.Or(cfg.BackupBucket, cfg.Bucket),
+		prefix:      strings.TrimPrefix(cfg.BackupPrefix, "/"),
+		store:       store,
+		incremental: cfg.BackupIncremental,
+	}
+	if cfg.BackupSchedule != "" {
+		sched, err := parseCron(cfg.BackupSchedule)
+		if err != nil {
+			return nil, fmt.Errorf("BACKUP_SCHEDULE: %w", err)
+		}
+		go b.schedule(context.Background(), sched)
+	}
+	log.Printf("backups of %s/%s to %s (schedule %q, incremental %v)", b.bucket, b.prefix, store, cfg.BackupSchedule, b.incremental)
+	return b, nil
+}
+
+// errBackupRunning is returned by start while a backup is in progress.
+var errBackupRunning = errors.New("a backup is already running")
+
+// start marks a backup as running, or fails when one already is.
+func (b *backupJob) start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running {
+		return errBackupRunning
+	}
+	b.running = true
+	return nil
+}
+
+func (b *backupJob) finish(report *BackupReport, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = false
+	if err != nil {
+		b.lastErr = err.Error()
+		log.Printf("backup %s/%s to %s failed: %v", b.bucket, b.prefix, b.store, err)
+		metrics.add("kzen_backups_total", 1, "result", "failed")
+		return
+	}
+	b.last, b.lastErr = report, ""
+	log.Printf("backup %s/%s: %s (%d objects, %d bytes, %s)", b.bucket, b.prefix, report.Archive, report.Objects, report.Bytes, report.Duration)
+	metrics.add("kzen_backups_total", 1, "result", "ok")
+	metrics.set("kzen_backup_last_success_timestamp_seconds", float64(time.Now().Unix()))
+	metrics.set("kzen_backup_last_bytes", float64(report.Bytes))
+}
+
+// run writes one backup; full forces a full archive in incremental mode. The caller must have
+// called start.
+func (b *backupJob) run(ctx context.Context, full bool) (*BackupReport, error) {
+	report, err := b.backup(ctx, full)
+	b.finish(report, err)
+	return report, err
+}
+
+func (b *backupJob) backup(ctx context.Context, full bool) (*BackupReport, error) {
+	started := time.Now().UTC()
+	var prev *backupManifest
+	if b.incremental && !full {
+		m, err := b.loadManifest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read manifest: %w", err)
+		}
+		// A manifest of another bucket or prefix is no base for this one.
+		if m != nil && m.Bucket == b.bucket && m.Prefix == b.prefix {
+			prev = m
+		}
+	}
+
+	manifest := &backupManifest{
+		Archive: "kzen-backup-" + started.Format("20060102T150405Z") + ".tar.zst",
+		Time:    started,
+		Bucket:  b.bucket,
+		Prefix:  b.prefix,
+		ETags:   map[string]string{},
+	}
+	if prev != nil {
+		manifest.Incremental, manifest.Base = true, prev.Archive
+		manifest.Archive = strings.Replace(manifest.Archive, ".tar.zst", "-incremental.tar.zst", 1)
+	}
+	report := &BackupReport{Archive: manifest.Archive, Incremental: manifest.Incremental, Base: manifest.Base, Started: started}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(b.writeArchive(ctx, pw, prev, manifest, report))
+	}()
+	if err := b.store.put(ctx, manifest.Archive, pr); err != nil {
+		pr.CloseWithError(err)
+		return nil, err
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.store.put(ctx, backupManifestName, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("write manifest: %w", err)
+	}
+	report.Duration = time.Since(started).Round(time.Millisecond).String()
+	return report, nil
+}
+
+func (b *backupJob) loadManifest(ctx context.Context) (*backupManifest, error) {
+	rc, err := b.store.get(ctx, backupManifestName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var m backupManifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// skip reports whether key is left out of backups: folder markers, self-test canaries and the
+// backups themselves when they are stored in the same bucket.
+func (b *backupJob) skip(key string) bool {
+	if strings.HasSuffix(key, "/") || strings.HasPrefix(key, selfTestPrefix) {
+		return true
+	}
+	s, ok := b.store.(*bucketBackupStore)
+	return ok && s.bucket == b.bucket && strings.HasPrefix(key, s.prefix)
+}
+
+func (b *backupJob) writeArchive(ctx context.Context, w io.Writer, prev *backupManifest, manifest *backupManifest, report *BackupReport) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: b.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if b.skip(obj.Key) {
+			continue
+		}
+		manifest.ETags[obj.Key] = obj.ETag
+		if prev != nil && prev.ETags[obj.Key] == obj.ETag {
+			report.Unchanged++
+			continue
+		}
+		n, etag, err := writeBackupEntry(ctx, tw, b.client, b.bucket, obj.Key)
+		if golib.IsNotFound(err) {
+			delete(manifest.ETags, obj.Key) // deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		manifest.ETags[obj.Key] = etag
+		report.Objects++
+		report.Bytes += n
+	}
+	if prev != nil {
+		for key := range prev.ETags {
+			if _, ok := manifest.ETags[key]; !ok {
+				manifest.Deleted = append(manifest.Deleted, key)
+			}
+		}
+		report.Deleted = len(manifest.Deleted)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: backupMetaDir + "manifest.json", Mode: 0o644, Size: int64(len(data)), ModTime: manifest.Time}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeBackupEntry adds key to tw, named by its full key, with its ETag, Content-Type,
+// Content-Encoding and user metadata as PAX records. It returns the bytes written and the ETag of the copy.
+func writeBackupEntry(ctx context.Context, tw *tar.Writer, client *minio.Client, bucket, key string) (int64, string, error) {
+	src, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, "", err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	pax := map[string]string{backupPAXETag: info.ETag}
+	if info.ContentType != "" {
+		pax[backupPAXContentType] = info.ContentType
+	}
+	if enc := info.Metadata.Get("Content-Encoding"); enc != "" {
+		pax[backupPAXContentEncoding] = enc
+	}
+	for k, v := range info.UserMetadata {
+		pax[backupPAXMetaPrefix+k] = v
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:       key,
+		Mode:       0o644,
+		Size:       info.Size,
+		ModTime:    info.LastModified,
+		Format:     tar.FormatPAX,
+		PAXRecords: pax,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	n, err := copyPooled(tw, src)
+	if err != nil {
+		return n, "", fmt.Errorf("copy %q: %w", key, err)
+	}
+	return n, info.ETag, nil
+}
+
+// schedule runs a backup whenever sched fires, until ctx is done. A backup still running when the
+// next one is due delays it to the following slot.
+func (b *backupJob) schedule(ctx context.Context, sched *cronSchedule) {
+	for {
+		next := sched.next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		b.mu.Lock()
+		b.next = next
+		b.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := b.start(); err != nil {
+			log.Printf("backup: scheduled run skipped: %v", err)
+			continue
+		}
+		b.run(ctx, false)
+	}
+}
+
+// backupHandler serves the backup job's admin endpoint:
+//
+//	GET  /admin/backup   state: running, last report and error, next scheduled run
+//	POST /admin/backup   start a backup in the background (202); ?wait=1 waits for the report,
+//	                     ?full=1 writes a full archive in incremental mode
+func backupHandler(b *backupJob) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			b.mu.Lock()
+			state := map[string]any{"running": b.running, "target": b.store.String(), "bucket": b.bucket, "prefix": b.prefix, "last": b.last}
+			if b.lastErr != "" {
+				state["lastError"] = b.lastErr
+			}
+			if !b.next.IsZero() {
+				state["next"] = b.next
+			}
+			b.mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(state)
+		case http.MethodPost:
+			if err := b.start(); err != nil {
+				respondErrorCode(w, err.Error(), "backup_running", http.StatusConflict)
+				return
+			}
+			q := r.URL.Query()
+			full := q.Get("full") == "1" || q.Get("full") == "true"
+			if q.Get("wait") != "1" && q.Get("wait") != "true" {
+				go b.run(context.Background(), full)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]any{"started": true})
+				return
+			}
+			report, err := b.run(r.Context(), full)
+			if err != nil {
+				respondError(w, "backup failed: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package minioserver
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// readBackup returns the entries of an archive by name, and its manifest.
+func readBackup(t *testing.T, path string) (map[string]*tar.Header, backupManifest) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	entries := map[string]*tar.Header{}
+	var manifest backupManifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, manifest
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == backupMetaDir+"manifest.json" {
+			json.NewDecoder(tr).Decode(&manifest)
+			continue
+		}
+		entries[hdr.Name] = hdr
+	}
+}
+
+func TestBackupJob_Incremental(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["kzen/a.jpg"] = []byte("a")
+	objects["kzen/b.jpg"] = []byte("bb")
+	objects["other/c.jpg"] = []byte("c")
+	dir := t.TempDir()
+	b := &backupJob{client: client, bucket: "files", prefix: "kzen/", store: dirBackupStore(dir), incremental: true}
+	h := backupHandler(b)
+	run := func(target string) BackupReport {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		var report BackupReport
+		json.Unmarshal(rec.Body.Bytes(), &report)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("backup: %d %s", rec.Code, rec.Body.String())
+		}
+		return report
+	}
+
+	full := run("/admin/backup?wait=1")
+	entries, manifest := readBackup(t, filepath.Join(dir, full.Archive))
+	if full.Incremental || full.Objects != 2 || full.Bytes != 3 || len(entries) != 2 || entries["kzen/b.jpg"].PAXRecords[backupPAXETag] != "abc" {
+		t.Fatalf("full backup: %+v %v", full, entries)
+	}
+	if len(manifest.ETags) != 2 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	// The next one only holds what changed.
+	delete(objects, "kzen/a.jpg")
+	objects["kzen/new.jpg"] = []byte("new")
+	incr := run("/admin/backup?wait=1")
+	entries, manifest = readBackup(t, filepath.Join(dir, incr.Archive))
+	if !incr.Incremental || incr.Base != full.Archive || incr.Objects != 1 || incr.Unchanged != 1 || incr.Deleted != 1 || entries["kzen/new.jpg"] == nil {
+		t.Fatalf("incremental backup: %+v %v", incr, entries)
+	}
+	if len(manifest.Deleted) != 1 || manifest.Deleted[0] != "kzen/a.jpg" || len(manifest.ETags) != 2 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/backup", nil))
+	var state struct {
+		Running bool         `json:"running"`
+		Last    BackupReport `json:"last"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &state)
+	if state.Running || state.Last.Archive != incr.Archive {
+		t.Errorf("state: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,167 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	batchCopyMaxPairs    = 1000
+	batchCopyConcurrency = 8
+)
+
+type batchCopyPair struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+type batchCopyRequest struct {
+	Pairs []batchCopyPair `json:"pairs"`
+	// Overwrite replaces existing destinations; otherwise they fail with status 409.
+	Overwrite bool `json:"overwrite"`
+}
+
+type batchCopyResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	OK          bool   `json:"ok"`
+	ETag        string `json:"etag,omitempty"`
+	Err         string `json:"error,omitempty"`
+	// Status is the HTTP status the failure maps to, e.g. 404 for a missing source.
+	Status int `json:"status,omitempty"`
+}
+
+// batchCopyHandler serves POST /batch/copy: {"pairs": [{"source", "destination"}], "overwrite"}
+// copies each source object to its destination key inside MinIO, batchCopyConcurrency at a time,
+// keeping content type and metadata, e.g. to duplicate a goal's images when the goal is cloned.
+// Every pair gets a result; one failing doesn't stop the others. With auth on, copies are owned
+// by the key that made them, and only destinations it owns may be overwritten.
+func batchCopyHandler(client *minio.Client, bucket string, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req batchCopyRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Pairs) == 0 {
+			respondError(w, "pairs required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Pairs) > batchCopyMaxPairs {
+			respondError(w, fmt.Sprintf("at most %d pairs per request", batchCopyMaxPairs), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 5*time.Minute)
+		defer cancel()
+
+		results := make([]batchCopyResult, len(req.Pairs))
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, batchCopyConcurrency)
+		for i, p := range req.Pairs {
+			src, dst := strings.TrimPrefix(strings.TrimSpace(p.Source), "/"), strings.TrimPrefix(strings.TrimSpace(p.Destination), "/")
+			results[i] = batchCopyResult{Source: src, Destination: dst}
+			if msg := batchCopyInvalid(opts, bucket, src, dst); msg != "" {
+				results[i].Err, results[i].Status = msg, http.StatusBadRequest
+				continue
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(res *batchCopyResult) {
+				defer func() { <-sem; wg.Done() }()
+				existing, err := client.StatObject(ctx, bucket, res.Destination, minio.StatObjectOptions{})
+				switch {
+				case err == nil && !req.Overwrite:
+					res.Err, res.Status = "destination exists", http.StatusConflict
+					return
+				case err == nil:
+					err = opts.mayModify(ctx, existing)
+				case golib.IsNotFound(err):
+					err = nil
+				}
+				if err != nil {
+					res.Err, res.Status = err.Error(), ownerErrorStatus(err)
+					return
+				}
+				dest := minio.CopyDestOptions{Bucket: bucket, Object: res.Destination}
+				if opts.ownsObjects() {
+					// The copy belongs to whoever made it, which takes rewriting the metadata.
+					src, err := client.StatObject(ctx, bucket, res.Source, minio.StatObjectOptions{})
+					if err != nil {
+						res.Err, res.Status = err.Error(), golib.MinioStatus(err)
+						return
+					}
+					dest.UserMetadata, dest.ReplaceMetadata = opts.stampOwner(ctx, copyMetadata(src)), true
+				}
+				info, err := client.CopyObject(ctx, dest, minio.CopySrcOptions{Bucket: bucket, Object: res.Source})
+				if err != nil {
+					res.Err, res.Status = err.Error(), golib.MinioStatus(err)
+					return
+				}
+				opts.changed(bucket, res.Destination)
+				res.OK, res.ETag = true, info.ETag
+			}(&results[i])
+		}
+		wg.Wait()
+
+		failed := 0
+		for _, res := range results {
+			if !res.OK {
+				failed++
+			}
+		}
+		log.Printf("batch copy by %q: %d pairs, %d failed", apiKeyName(r.Context()), len(results), failed)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"copied": results})
+	}
+}
+
+// copyMetadata returns the metadata of info for a copy that replaces it: its user metadata and
+// the standard headers MinIO stores with an object.
+func copyMetadata(info minio.ObjectInfo) map[string]string {
+	meta := map[string]string{}
+	for k, v := range info.UserMetadata {
+		meta[k] = v
+	}
+	if info.ContentType != "" {
+		meta["Content-Type"] = info.ContentType
+	}
+	for _, h := range []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language"} {
+		if v := info.Metadata.Get(h); v != "" {
+			meta[h] = v
+		}
+	}
+	return meta
+}
+
+// batchCopyInvalid returns why a pair can't be copied, or "".
+func batchCopyInvalid(opts proxyOptions, bucket, src, dst string) string {
+	switch {
+	case src == "" || dst == "":
+		return "source and destination required"
+	case src == dst:
+		return "source and destination are the same key"
+	case strings.HasSuffix(src, "/") || strings.HasSuffix(dst, "/"):
+		return "keys must name objects, not folders"
+	}
+	for _, key := range []string{src, dst} {
+		if hiddenKey(opts, bucket, key) {
+			return fmt.Sprintf("%q is a reserved key", key)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchCopyHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["goals/1/a.jpg"] = []byte("a")
+	objects["goals/1/b.jpg"] = []byte("bb")
+	objects["goals/2/b.jpg"] = []byte("old")
+	handler := batchCopyHandler(client, "files", proxyOptions{})
+
+	copyPairs := func(body string) (int, []batchCopyResult) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/batch/copy", strings.NewReader(body)))
+		var resp struct {
+			Copied []batchCopyResult `json:"copied"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Copied
+	}
+
+	code, results := copyPairs(`{"pairs":[
+		{"source":"goals/1/a.jpg","destination":"goals/2/a.jpg"},
+		{"source":"goals/1/b.jpg","destination":"goals/2/b.jpg"},
+		{"source":"goals/1/a.jpg","destination":"trash/a.jpg"},
+		{"source":"/goals/1/a.jpg","destination":"goals/1/a.jpg"}]}`)
+	if code != http.StatusOK || len(results) != 4 {
+		t.Fatalf("got %d %+v", code, results)
+	}
+	if r := results[0]; !r.OK || string(objects["goals/2/a.jpg"]) != "a" {
+		t.Errorf("copy: %+v", r)
+	}
+	if r := results[1]; r.OK || r.Status != http.StatusConflict || string(objects["goals/2/b.jpg"]) != "old" {
+		t.Errorf("existing destination: %+v", r)
+	}
+	for _, r := range results[2:] {
+		if r.OK || r.Status != http.StatusBadRequest {
+			t.Errorf("invalid pair: %+v", r)
+		}
+	}
+
+	if _, results := copyPairs(`{"pairs":[{"source":"goals/1/b.jpg","destination":"goals/2/b.jpg"}],"overwrite":true}`); !results[0].OK || string(objects["goals/2/b.jpg"]) != "bb" {
+		t.Errorf("overwrite: %+v", results)
+	}
+	if code, _ := copyPairs(`{"pairs":[]}`); code != http.StatusBadRequest {
+		t.Errorf("no pairs: got %d, want 400", code)
+	}
+}
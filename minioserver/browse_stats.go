@@ -0,0 +1,201 @@
+package minioserver
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	folderStatsMaxDepth   = 5
+	folderStatsMaxEntries = 1000
+)
+
+// folderStats is the rollup of one folder: every object under Prefix, however deep, and the
+// subfolders down to the requested depth, largest first.
+type folderStats struct {
+	Prefix  string         `json:"prefix"`
+	Objects int64          `json:"objects"`
+	Bytes   int64          `json:"bytes"`
+	Folders []*folderStats `json:"folders,omitempty"`
+
+	children map[string]*folderStats
+}
+
+func (f *folderStats) add(size int64) {
+	f.Objects++
+	f.Bytes += size
+}
+
+func (f *folderStats) child(name string) *folderStats {
+	c, ok := f.children[name]
+	if !ok {
+		c = &folderStats{Prefix: f.Prefix + name + "/", children: map[string]*folderStats{}}
+		f.children[name] = c
+		f.Folders = append(f.Folders, c)
+	}
+	return c
+}
+
+func (f *folderStats) sort() {
+	slices.SortFunc(f.Folders, func(a, b *folderStats) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), strings.Compare(a.Prefix, b.Prefix))
+	})
+	for _, c := range f.Folders {
+		c.sort()
+	}
+}
+
+// browseStats is the GET /browse/stats reply.
+type browseStats struct {
+	Bucket      string    `json:"bucket"`
+	Depth       int       `json:"depth"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Cached      bool      `json:"cached"`
+	*folderStats
+}
+
+// collectFolderStats lists everything under prefix and rolls it up into subfolders depth levels
+// deep. Folder markers and the keys object routes hide are not counted.
+func collectFolderStats(r *http.Request, client objectLister, opts proxyOptions, bucket, prefix string, depth int) (*folderStats, error) {
+	ctx, cancel := golib.RequestContext(r, 5*time.Minute)
+	defer cancel()
+
+	root := &folderStats{Prefix: prefix, children: map[string]*folderStats{}}
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if strings.HasSuffix(obj.Key, "/") || hiddenKey(opts, bucket, obj.Key) {
+			continue
+		}
+		root.add(obj.Size)
+		folders := strings.Split(strings.TrimPrefix(obj.Key, prefix), "/")
+		folders = folders[:len(folders)-1]
+		f := root
+		for _, name := range folders[:min(depth, len(folders))] {
+			f = f.child(name)
+			f.add(obj.Size)
+		}
+	}
+	root.sort()
+	return root, nil
+}
+
+type folderStatsEntry struct {
+	stats     *folderStats
+	generated time.Time
+}
+
+// folderStatsCache keeps rollups for ttl: listing a large prefix takes long, and a treemap view
+// asks for the same ones again and again.
+type folderStatsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]folderStatsEntry
+}
+
+// newFolderStatsCache returns nil when ttl is 0 (caching off).
+func newFolderStatsCache(ttl time.Duration) *folderStatsCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &folderStatsCache{ttl: ttl, entries: map[string]folderStatsEntry{}}
+}
+
+func (c *folderStatsCache) get(id string, now time.Time) (folderStatsEntry, bool) {
+	if c == nil {
+		return folderStatsEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if ok && now.Sub(e.generated) >= c.ttl {
+		delete(c.entries, id)
+		ok = false
+	}
+	return e, ok
+}
+
+func (c *folderStatsCache) put(id string, e folderStatsEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= folderStatsMaxEntries {
+		for k, old := range c.entries {
+			if e.generated.Sub(old.generated) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= folderStatsMaxEntries {
+			clear(c.entries)
+		}
+	}
+	c.entries[id] = e
+}
+
+// folderStatsHandler serves GET /browse/stats?prefix=&depth=1&bucket=: object counts and byte
+// totals for prefix and its subfolders, depth levels deep (at most 5), for storage treemaps.
+// Rollups are cached (see newFolderStatsCache); refresh=1 recomputes one.
+func folderStatsHandler(client objectLister, defaultBucket string, buckets []string, cache *folderStatsCache, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		bucket := cmp.Or(q.Get("bucket"), defaultBucket)
+		if !slices.Contains(buckets, bucket) {
+			respondError(w, "unknown bucket", http.StatusBadRequest)
+			return
+		}
+		prefix := strings.TrimPrefix(q.Get("prefix"), "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		depth := 1
+		if v := q.Get("depth"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > folderStatsMaxDepth {
+				respondError(w, "depth must be 1 to "+strconv.Itoa(folderStatsMaxDepth), http.StatusBadRequest)
+				return
+			}
+			depth = n
+		}
+
+		id := bucket + "\x00" + prefix + "\x00" + strconv.Itoa(depth)
+		now := time.Now()
+		entry, cached := cache.get(id, now)
+		if !cached || q.Get("refresh") == "1" {
+			stats, err := collectFolderStats(r, client, opts, bucket, prefix, depth)
+			if err != nil {
+				log.Printf("browse stats %s/%s: %v", bucket, prefix, err)
+				respondStorageError(w, err, "failed to list objects")
+				return
+			}
+			entry, cached = folderStatsEntry{stats: stats, generated: now}, false
+			cache.put(id, entry)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(browseStats{
+			Bucket:      bucket,
+			Depth:       depth,
+			GeneratedAt: entry.generated.UTC(),
+			Cached:      cached,
+			folderStats: entry.stats,
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestFolderStatsHandler(t *testing.T) {
+	mock := &mockObjectLister{objects: []minio.ObjectInfo{
+		{Key: "kzen/top.jpg", Size: 1},
+		{Key: "kzen/a/"},
+		{Key: "kzen/a/x.jpg", Size: 10},
+		{Key: "kzen/a/deep/y.jpg", Size: 20},
+		{Key: "kzen/b/z.jpg", Size: 100},
+		{Key: "trash/kzen/b/old.jpg~1", Size: 1000},
+	}}
+	handler := folderStatsHandler(mock, "files", []string{"files"}, newFolderStatsCache(time.Minute), proxyOptions{})
+
+	type reply struct {
+		Cached  bool  `json:"cached"`
+		Objects int64 `json:"objects"`
+		Bytes   int64 `json:"bytes"`
+		Folders []struct {
+			Prefix  string `json:"prefix"`
+			Objects int64  `json:"objects"`
+			Bytes   int64  `json:"bytes"`
+			Folders []struct {
+				Prefix string `json:"prefix"`
+			} `json:"folders"`
+		} `json:"folders"`
+	}
+	get := func(target string) (int, reply) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var r reply
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+				t.Fatalf("%s: %v", target, err)
+			}
+		}
+		return rec.Code, r
+	}
+
+	code, r := get("/browse/stats?prefix=kzen")
+	if code != http.StatusOK || r.Cached || r.Objects != 4 || r.Bytes != 131 || len(r.Folders) != 2 {
+		t.Fatalf("stats: %d %+v", code, r)
+	}
+	if f := r.Folders[0]; f.Prefix != "kzen/b/" || f.Bytes != 100 || len(f.Folders) != 0 {
+		t.Errorf("largest first: %+v", f)
+	}
+	if f := r.Folders[1]; f.Prefix != "kzen/a/" || f.Objects != 2 || f.Bytes != 30 {
+		t.Errorf("kzen/a/ counts nested objects: %+v", f)
+	}
+
+	mock.objects = append(mock.objects, minio.ObjectInfo{Key: "kzen/c/new.jpg", Size: 5})
+	if _, r := get("/browse/stats?prefix=kzen/"); !r.Cached || len(r.Folders) != 2 {
+		t.Errorf("want the cached rollup: %+v", r)
+	}
+	if _, r := get("/browse/stats?prefix=kzen/&refresh=1"); r.Cached || len(r.Folders) != 3 {
+		t.Errorf("refresh: %+v", r)
+	}
+	if _, r := get("/browse/stats?prefix=kzen/&depth=2"); len(r.Folders[1].Folders) != 1 || r.Folders[1].Folders[0].Prefix != "kzen/a/deep/" {
+		t.Errorf("depth 2: %+v", r)
+	}
+	for _, target := range []string{"/browse/stats?depth=9", "/browse/stats?bucket=other"} {
+		if code, _ := get(target); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", target, code)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+
+	"kzen-go/golib"
+)
+
+// bucketLifecycleClient is the part of *minio.Client the lifecycle endpoints use.
+type bucketLifecycleClient interface {
+	GetBucketLifecycle(ctx context.Context, bucket string) (*lifecycle.Configuration, error)
+	SetBucketLifecycle(ctx context.Context, bucket string, config *lifecycle.Configuration) error
+}
+
+const lifecycleMaxBytes = 64 << 10
+
+// expireRulePrefix starts the ID of rules written by PUT /admin/lifecycle/expire, so they can be
+// found again for the same prefix.
+const expireRulePrefix = "kzen-expire:"
+
+// prefixExpiry asks MinIO to delete the objects under Prefix Days after they were written.
+type prefixExpiry struct {
+	Prefix string `json:"prefix"`
+	Days   int    `json:"days"`
+}
+
+// setExpiry replaces the rule written for prefix with one expiring its objects after days;
+// days 0 only removes it. Other rules are kept as they are.
+func setExpiry(c *lifecycle.Configuration, prefix string, days int) {
+	id := expireRulePrefix + prefix
+	kept := c.Rules[:0]
+	for _, rule := range c.Rules {
+		if rule.ID != id {
+			kept = append(kept, rule)
+		}
+	}
+	c.Rules = kept
+	if days > 0 {
+		c.Rules = append(c.Rules, lifecycle.Rule{
+			ID:         id,
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: prefix},
+			Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(days)},
+		})
+	}
+}
+
+// bucketLifecycleHandler serves the admin lifecycle endpoints for ?bucket= (default defaultBucket):
+//
+//	GET    /admin/lifecycle         current rules
+//	PUT    /admin/lifecycle         replace the configuration with the JSON body {"Rules":[...]}
+//	DELETE /admin/lifecycle         remove all rules
+//	PUT    /admin/lifecycle/expire  {"prefix":"kzen/tmp/","days":1}; days 0 removes the rule
+func bucketLifecycleHandler(client bucketLifecycleClient, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := r.URL.Query().Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		expire := strings.HasSuffix(r.URL.Path, "/expire")
+		switch {
+		case r.Method == http.MethodGet && !expire:
+		case r.Method == http.MethodPut && !expire:
+			body, err := io.ReadAll(io.LimitReader(r.Body, lifecycleMaxBytes+1))
+			if err != nil || len(body) > lifecycleMaxBytes {
+				respondError(w, "lifecycle body must be at most 64 KB", http.StatusRequestEntityTooLarge)
+				return
+			}
+			config := lifecycle.NewConfiguration()
+			if err := json.Unmarshal(body, config); err != nil || len(config.Rules) == 0 {
+				respondError(w, "body must be a lifecycle configuration with at least one rule", http.StatusBadRequest)
+				return
+			}
+			if err := client.SetBucketLifecycle(ctx, bucket, config); err != nil {
+				log.Printf("set bucket lifecycle %q: %v", bucket, err)
+				respondStorageError(w, err, "failed to set lifecycle: "+golib.MinioErrorResponse(err).Message)
+				return
+			}
+			log.Printf("bucket lifecycle of %q replaced by %q", bucket, apiKeyName(r.Context()))
+		case r.Method == http.MethodDelete && !expire:
+			if err := client.SetBucketLifecycle(ctx, bucket, lifecycle.NewConfiguration()); err != nil {
+				log.Printf("remove bucket lifecycle %q: %v", bucket, err)
+				respondStorageError(w, err, "failed to remove lifecycle")
+				return
+			}
+			log.Printf("bucket lifecycle of %q removed by %q", bucket, apiKeyName(r.Context()))
+		case r.Method == http.MethodPut && expire:
+			var req prefixExpiry
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			req.Prefix = strings.TrimPrefix(req.Prefix, "/")
+			if req.Prefix == "" || req.Days < 0 {
+				respondError(w, "prefix required and days must not be negative", http.StatusBadRequest)
+				return
+			}
+			config, err := loadBucketLifecycle(ctx, client, bucket)
+			if err != nil {
+				log.Printf("get bucket lifecycle %q: %v", bucket, err)
+				respondStorageError(w, err, "failed to get lifecycle")
+				return
+			}
+			setExpiry(config, req.Prefix, req.Days)
+			if err := client.SetBucketLifecycle(ctx, bucket, config); err != nil {
+				log.Printf("set bucket lifecycle %q: %v", bucket, err)
+				respondStorageError(w, err, "failed to set lifecycle: "+golib.MinioErrorResponse(err).Message)
+				return
+			}
+			log.Printf("expiry of %s/%s set to %d days by %q", bucket, req.Prefix, req.Days, apiKeyName(r.Context()))
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		config, err := loadBucketLifecycle(ctx, client, bucket)
+		if err != nil {
+			log.Printf("get bucket lifecycle %q: %v", bucket, err)
+			respondStorageError(w, err, "failed to get lifecycle")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"bucket": bucket,
+			"rules":  config.Rules,
+		})
+	}
+}
+
+// loadBucketLifecycle returns bucket's lifecycle; a bucket without one yields no rules.
+func loadBucketLifecycle(ctx context.Context, client bucketLifecycleClient, bucket string) (*lifecycle.Configuration, error) {
+	config, err := client.GetBucketLifecycle(ctx, bucket)
+	if err != nil {
+		if golib.MinioErrorResponse(err).Code == "NoSuchLifecycleConfiguration" {
+			return lifecycle.NewConfiguration(), nil
+		}
+		return nil, err
+	}
+	if config.Rules == nil {
+		config.Rules = []lifecycle.Rule{}
+	}
+	return config, nil
+}
@@ -0,0 +1,244 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"kzen-go/golib"
+)
+
+// bucketPolicyClient is the part of *minio.Client the policy endpoints use.
+type bucketPolicyClient interface {
+	GetBucketPolicy(ctx context.Context, bucket string) (string, error)
+	SetBucketPolicy(ctx context.Context, bucket, policy string) error
+}
+
+const policyMaxBytes = 20 << 10 // S3 caps bucket policies at 20 KB
+
+// anonymousActions are the actions granted to everyone for each access level, as mc anonymous
+// set download|upload|public does for objects.
+var anonymousActions = map[string][]string{
+	"readonly":  {"s3:GetObject"},
+	"writeonly": {"s3:PutObject"},
+	"readwrite": {"s3:DeleteObject", "s3:GetObject", "s3:PutObject"},
+}
+
+// stringList is a policy field that may be a single string or a list.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(l))
+}
+
+type bucketPolicy struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Sid       string          `json:"Sid,omitempty"`
+	Effect    string          `json:"Effect"`
+	Principal json.RawMessage `json:"Principal,omitempty"`
+	Action    stringList      `json:"Action"`
+	Resource  stringList      `json:"Resource"`
+	Condition json.RawMessage `json:"Condition,omitempty"`
+}
+
+// anonymousPrincipal is the Principal written for anonymous statements.
+var anonymousPrincipal = json.RawMessage(`{"AWS":["*"]}`)
+
+// isAnonymous reports whether the statement applies to everyone ("*" or {"AWS": "*"|["*"]}).
+func (st policyStatement) isAnonymous() bool {
+	var s string
+	if json.Unmarshal(st.Principal, &s) == nil {
+		return s == "*"
+	}
+	var p struct {
+		AWS stringList `json:"AWS"`
+	}
+	return json.Unmarshal(st.Principal, &p) == nil && slices.Contains(p.AWS, "*")
+}
+
+// anonymousGrant is an access level given to everyone on the objects under a prefix.
+type anonymousGrant struct {
+	Prefix string `json:"prefix"`
+	Access string `json:"access"`
+}
+
+func objectsARN(bucket, prefix string) string {
+	return "arn:aws:s3:::" + bucket + "/" + prefix + "*"
+}
+
+// anonymousGrants summarizes the unconditional anonymous Allow statements on objects of bucket.
+func (p bucketPolicy) anonymousGrants(bucket string) []anonymousGrant {
+	grants := []anonymousGrant{}
+	for _, st := range p.Statement {
+		if st.Effect != "Allow" || !st.isAnonymous() || len(st.Condition) > 0 {
+			continue
+		}
+		actions := slices.Sorted(slices.Values(st.Action))
+		access := "custom"
+		for level, want := range anonymousActions {
+			if slices.Equal(actions, want) {
+				access = level
+			}
+		}
+		for _, res := range st.Resource {
+			prefix, ok := strings.CutPrefix(res, "arn:aws:s3:::"+bucket+"/")
+			if !ok {
+				continue
+			}
+			grants = append(grants, anonymousGrant{Prefix: strings.TrimSuffix(prefix, "*"), Access: access})
+		}
+	}
+	return grants
+}
+
+// setAnonymous replaces the anonymous statements that cover exactly prefix with one granting
+// access; "none" only removes them. Other statements are kept as they are.
+func (p *bucketPolicy) setAnonymous(bucket, prefix, access string) {
+	arn := objectsARN(bucket, prefix)
+	kept := p.Statement[:0]
+	for _, st := range p.Statement {
+		if st.isAnonymous() && len(st.Resource) == 1 && st.Resource[0] == arn {
+			continue
+		}
+		kept = append(kept, st)
+	}
+	p.Statement = kept
+	if actions, ok := anonymousActions[access]; ok {
+		p.Statement = append(p.Statement, policyStatement{
+			Effect:    "Allow",
+			Principal: anonymousPrincipal,
+			Action:    append(stringList(nil), actions...),
+			Resource:  stringList{arn},
+		})
+	}
+	if p.Version == "" {
+		p.Version = "2012-10-17"
+	}
+}
+
+// bucketPolicyHandler serves the admin policy endpoints for ?bucket= (default defaultBucket):
+//
+//	GET    /admin/policy            current policy and its anonymous grants
+//	PUT    /admin/policy            replace the policy with the JSON body
+//	DELETE /admin/policy            remove the policy
+//	PUT    /admin/policy/anonymous  {"prefix":"kzen/public/","access":"readonly|writeonly|readwrite|none"}
+func bucketPolicyHandler(client bucketPolicyClient, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket := r.URL.Query().Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		anonymous := strings.HasSuffix(r.URL.Path, "/anonymous")
+		switch {
+		case r.Method == http.MethodGet && !anonymous:
+		case r.Method == http.MethodPut && !anonymous:
+			body, err := io.ReadAll(io.LimitReader(r.Body, policyMaxBytes+1))
+			if err != nil || len(body) > policyMaxBytes {
+				respondError(w, "policy body must be at most 20 KB", http.StatusRequestEntityTooLarge)
+				return
+			}
+			var p bucketPolicy
+			if err := json.Unmarshal(body, &p); err != nil || len(p.Statement) == 0 {
+				respondError(w, "body must be a bucket policy with at least one Statement", http.StatusBadRequest)
+				return
+			}
+			if err := client.SetBucketPolicy(ctx, bucket, string(body)); err != nil {
+				log.Printf("set bucket policy %q: %v", bucket, err)
+				respondStorageError(w, err, "failed to set policy: "+golib.MinioErrorResponse(err).Message)
+				return
+			}
+			log.Printf("bucket policy of %q replaced by %q", bucket, apiKeyName(r.Context()))
+		case r.Method == http.MethodDelete && !anonymous:
+			if err := client.SetBucketPolicy(ctx, bucket, ""); err != nil {
+				log.Printf("remove bucket policy %q: %v", bucket, err)
+				respondStorageError(w, err, "failed to remove policy")
+				return
+			}
+			log.Printf("bucket policy of %q removed by %q", bucket, apiKeyName(r.Context()))
+		case r.Method == http.MethodPut && anonymous:
+			var req anonymousGrant
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			req.Prefix = strings.TrimPrefix(req.Prefix, "/")
+			if _, ok := anonymousActions[req.Access]; !ok && req.Access != "none" {
+				respondError(w, "access must be readonly, writeonly, readwrite or none", http.StatusBadRequest)
+				return
+			}
+			p, err := loadBucketPolicy(ctx, client, bucket)
+			if err != nil {
+				respondStorageError(w, err, "failed to get policy")
+				return
+			}
+			p.setAnonymous(bucket, req.Prefix, req.Access)
+			policy := ""
+			if len(p.Statement) > 0 {
+				data, _ := json.Marshal(p)
+				policy = string(data)
+			}
+			if err := client.SetBucketPolicy(ctx, bucket, policy); err != nil {
+				log.Printf("set bucket policy %q: %v", bucket, err)
+				respondStorageError(w, err, "failed to set policy: "+golib.MinioErrorResponse(err).Message)
+				return
+			}
+			log.Printf("anonymous %s access to %s/%s set by %q", req.Access, bucket, req.Prefix, apiKeyName(r.Context()))
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeBucketPolicy(ctx, w, client, bucket)
+	}
+}
+
+// loadBucketPolicy returns bucket's policy; a bucket without one yields an empty policy.
+func loadBucketPolicy(ctx context.Context, client bucketPolicyClient, bucket string) (bucketPolicy, error) {
+	var p bucketPolicy
+	raw, err := client.GetBucketPolicy(ctx, bucket)
+	if err != nil || raw == "" {
+		return p, err
+	}
+	return p, json.Unmarshal([]byte(raw), &p)
+}
+
+// writeBucketPolicy replies with { bucket, policy, anonymous } for the current policy.
+func writeBucketPolicy(ctx context.Context, w http.ResponseWriter, client bucketPolicyClient, bucket string) {
+	raw, err := client.GetBucketPolicy(ctx, bucket)
+	if err != nil {
+		log.Printf("get bucket policy %q: %v", bucket, err)
+		respondStorageError(w, err, "failed to get policy")
+		return
+	}
+	var p bucketPolicy
+	policy := json.RawMessage("null")
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			respondError(w, "bucket policy is not valid JSON", http.StatusBadGateway)
+			return
+		}
+		policy = json.RawMessage(raw)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"bucket":    bucket,
+		"policy":    policy,
+		"anonymous": p.anonymousGrants(bucket),
+	})
+}
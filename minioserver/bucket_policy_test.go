@@ -0,0 +1,108 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type mockPolicyClient struct {
+	policies map[string]string
+}
+
+func (m *mockPolicyClient) GetBucketPolicy(_ context.Context, bucket string) (string, error) {
+	return m.policies[bucket], nil
+}
+
+func (m *mockPolicyClient) SetBucketPolicy(_ context.Context, bucket, policy string) error {
+	m.policies[bucket] = policy
+	return nil
+}
+
+type policyResponse struct {
+	Bucket    string           `json:"bucket"`
+	Policy    json.RawMessage  `json:"policy"`
+	Anonymous []anonymousGrant `json:"anonymous"`
+}
+
+func doPolicy(t *testing.T, h http.HandlerFunc, method, target, body string) policyResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s %s = %d %s", method, target, rec.Code, rec.Body.String())
+	}
+	var resp policyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestBucketPolicy_Anonymous(t *testing.T) {
+	// An existing statement for another principal must survive.
+	existing := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::1:user/app"]},"Action":"s3:*","Resource":"arn:aws:s3:::b/*"}]}`
+	client := &mockPolicyClient{policies: map[string]string{"b": existing}}
+	h := bucketPolicyHandler(client, "b")
+
+	resp := doPolicy(t, h, http.MethodPut, "/admin/policy/anonymous", `{"prefix":"kzen/public/","access":"readonly"}`)
+	if len(resp.Anonymous) != 1 || resp.Anonymous[0] != (anonymousGrant{Prefix: "kzen/public/", Access: "readonly"}) {
+		t.Fatalf("anonymous = %+v", resp.Anonymous)
+	}
+	if !strings.Contains(client.policies["b"], "arn:aws:iam::1:user/app") {
+		t.Errorf("other statement dropped: %s", client.policies["b"])
+	}
+
+	// Changing the level replaces the statement instead of adding another.
+	resp = doPolicy(t, h, http.MethodPut, "/admin/policy/anonymous", `{"prefix":"kzen/public/","access":"readwrite"}`)
+	if len(resp.Anonymous) != 1 || resp.Anonymous[0].Access != "readwrite" {
+		t.Fatalf("anonymous = %+v", resp.Anonymous)
+	}
+
+	resp = doPolicy(t, h, http.MethodPut, "/admin/policy/anonymous", `{"prefix":"kzen/public/","access":"none"}`)
+	if len(resp.Anonymous) != 0 {
+		t.Fatalf("anonymous = %+v, want none", resp.Anonymous)
+	}
+
+	resp = doPolicy(t, h, http.MethodDelete, "/admin/policy", "")
+	if string(resp.Policy) != "null" || client.policies["b"] != "" {
+		t.Errorf("policy after delete = %s", resp.Policy)
+	}
+}
+
+func TestBucketPolicy_PutValidates(t *testing.T) {
+	h := bucketPolicyHandler(&mockPolicyClient{policies: map[string]string{}}, "b")
+	for _, body := range []string{"not json", `{"Version":"2012-10-17","Statement":[]}`} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPut, "/admin/policy", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %q = %d, want 400", body, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, "/admin/policy/anonymous", strings.NewReader(`{"prefix":"a/","access":"everything"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bad access level = %d, want 400", rec.Code)
+	}
+}
+
+func TestBucketPolicy_GrantsFromHandWrittenPolicy(t *testing.T) {
+	p := bucketPolicy{}
+	json.Unmarshal([]byte(`{"Statement":[
+		{"Effect":"Allow","Principal":"*","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::b/img/*","arn:aws:s3:::b/css/*"]},
+		{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"s3:ListBucket","Resource":"arn:aws:s3:::b/pub/*"}
+	]}`), &p)
+	got := p.anonymousGrants("b")
+	want := []anonymousGrant{{"img/", "readonly"}, {"css/", "readonly"}, {"pub/", "custom"}}
+	if len(got) != len(want) {
+		t.Fatalf("grants = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("grant %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
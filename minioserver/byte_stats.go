@@ -0,0 +1,199 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// byteStatsMaxPrefixes bounds the number of tracked prefixes; bytes for further prefixes are
+// summed under byteStatsOverflow so a flood of distinct keys can't grow memory without bound.
+const (
+	byteStatsMaxPrefixes = 10000
+	byteStatsOverflow    = "_other"
+)
+
+type byteStatsKey struct {
+	bucket string
+	prefix string
+}
+
+type byteCounts struct {
+	in  int64
+	out int64
+}
+
+// byteAccounting sums request (in) and response (out) body bytes per bucket and key prefix, where
+// the prefix is the first depth path segments of the object key (e.g. depth 3 groups
+// "kzen/users/<userId>/..." per user). A nil *byteAccounting records nothing.
+type byteAccounting struct {
+	depth  int
+	mu     sync.Mutex
+	counts map[byteStatsKey]*byteCounts
+}
+
+func newByteAccounting(depth int) *byteAccounting {
+	if depth <= 0 {
+		return nil
+	}
+	return &byteAccounting{depth: depth, counts: make(map[byteStatsKey]*byteCounts)}
+}
+
+// prefix returns the first depth segments of key with a trailing "/", or "" for keys at the root.
+func (a *byteAccounting) prefix(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	parts := strings.SplitN(key, "/", a.depth+1)
+	if len(parts) <= a.depth {
+		parts = parts[:len(parts)-1] // last segment is the object name
+	} else {
+		parts = parts[:a.depth]
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, "/") + "/"
+}
+
+func (a *byteAccounting) add(bucket, key string, in, out int64) {
+	if a == nil || (in == 0 && out == 0) {
+		return
+	}
+	k := byteStatsKey{bucket: bucket, prefix: a.prefix(key)}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, ok := a.counts[k]
+	if !ok {
+		if len(a.counts) >= byteStatsMaxPrefixes {
+			k.prefix = byteStatsOverflow
+			c = a.counts[k]
+		}
+		if c == nil {
+			c = &byteCounts{}
+			a.counts[k] = c
+		}
+	}
+	c.in += in
+	c.out += out
+}
+
+func (a *byteAccounting) addIn(bucket, key string, n int64)  { a.add(bucket, key, n, 0) }
+func (a *byteAccounting) addOut(bucket, key string, n int64) { a.add(bucket, key, 0, n) }
+
+type prefixByteStats struct {
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix"`
+	BytesIn  int64  `json:"bytesIn"`
+	BytesOut int64  `json:"bytesOut"`
+}
+
+// snapshot returns the counters, busiest prefix first.
+func (a *byteAccounting) snapshot() []prefixByteStats {
+	a.mu.Lock()
+	out := make([]prefixByteStats, 0, len(a.counts))
+	for k, c := range a.counts {
+		out = append(out, prefixByteStats{Bucket: k.bucket, Prefix: k.prefix, BytesIn: c.in, BytesOut: c.out})
+	}
+	a.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		ti, tj := out[i].BytesIn+out[i].BytesOut, out[j].BytesIn+out[j].BytesOut
+		if ti != tj {
+			return ti > tj
+		}
+		return out[i].Bucket+out[i].Prefix < out[j].Bucket+out[j].Prefix
+	})
+	return out
+}
+
+// register exposes the counters on reg as kzen_prefix_bytes_total{direction,bucket,prefix}.
+func (a *byteAccounting) register(reg *metricsRegistry) {
+	reg.describe("kzen_prefix_bytes_total", "counter", "Request (in) and response (out) body bytes per bucket and key prefix.")
+	reg.gaugeFunc("kzen_prefix_bytes_total", func() map[string]float64 {
+		series := make(map[string]float64)
+		for _, s := range a.snapshot() {
+			series[labelString([]string{"direction", "in", "bucket", s.Bucket, "prefix", s.Prefix})] = float64(s.BytesIn)
+			series[labelString([]string{"direction", "out", "bucket", s.Bucket, "prefix", s.Prefix})] = float64(s.BytesOut)
+		}
+		return series
+	})
+}
+
+// statsHandler serves GET /stats: per-prefix byte counts as JSON, optionally filtered by
+// ?bucket= and ?prefix= (a prefix of the tracked prefix).
+func statsHandler(a *byteAccounting) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if a == nil {
+			respondError(w, "byte accounting disabled (set BYTE_STATS_PREFIX_DEPTH)", http.StatusNotFound)
+			return
+		}
+		bucket := r.URL.Query().Get("bucket")
+		prefix := r.URL.Query().Get("prefix")
+		stats := []prefixByteStats{}
+		for _, s := range a.snapshot() {
+			if (bucket == "" || s.Bucket == bucket) && strings.HasPrefix(s.Prefix, prefix) {
+				stats = append(stats, s)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"depth": a.depth, "prefixes": stats})
+	}
+}
+
+// countingReadCloser counts bytes read from a request body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingResponseWriter counts response body bytes.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingResponseWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *countingResponseWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+// withByteAccounting counts the request and response bodies of h and adds them to bucket/key.
+func withByteAccounting(a *byteAccounting, bucket, key string, w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	if a == nil {
+		h(w, r)
+		return
+	}
+	cw := &countingResponseWriter{ResponseWriter: w}
+	var body *countingReadCloser
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &countingReadCloser{ReadCloser: r.Body}
+		r = r.WithContext(r.Context()) // shallow copy; don't swap the caller's Body
+		r.Body = body
+	}
+	h(cw, r)
+	var in int64
+	if body != nil {
+		in = body.n
+	}
+	a.add(bucket, key, in, cw.n)
+}
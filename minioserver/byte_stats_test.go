@@ -0,0 +1,65 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestByteAccounting_Prefix(t *testing.T) {
+	a := newByteAccounting(3)
+	cases := map[string]string{
+		"kzen/users/42/media/a.jpg": "kzen/users/42/",
+		"kzen/users/42/a.jpg":       "kzen/users/42/",
+		"kzen/users/a.jpg":          "kzen/users/",
+		"a.jpg":                     "",
+		"/kzen/users/7/x":           "kzen/users/7/",
+	}
+	for key, want := range cases {
+		if got := a.prefix(key); got != want {
+			t.Errorf("prefix(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestWithByteAccounting_CountsBodies(t *testing.T) {
+	a := newByteAccounting(1)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("0123456789"))
+	}
+	r := httptest.NewRequest(http.MethodPut, "/objects/photos/a.jpg", strings.NewReader("abcd"))
+	withByteAccounting(a, "b", "photos/a.jpg", httptest.NewRecorder(), r, h)
+	withByteAccounting(a, "b", "photos/c.jpg", httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), h)
+
+	rec := httptest.NewRecorder()
+	statsHandler(a)(rec, httptest.NewRequest(http.MethodGet, "/stats?bucket=b", nil))
+	var resp struct {
+		Prefixes []prefixByteStats `json:"prefixes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := prefixByteStats{Bucket: "b", Prefix: "photos/", BytesIn: 4, BytesOut: 20}
+	if len(resp.Prefixes) != 1 || resp.Prefixes[0] != want {
+		t.Errorf("stats = %+v, want [%+v]", resp.Prefixes, want)
+	}
+}
+
+func TestByteAccounting_OverflowBucket(t *testing.T) {
+	a := newByteAccounting(1)
+	for i := 0; i < byteStatsMaxPrefixes+5; i++ {
+		a.addIn("b", fmt.Sprintf("u%d/k", i), 1)
+	}
+	stats := a.snapshot()
+	if len(stats) != byteStatsMaxPrefixes+1 {
+		t.Errorf("tracked %d prefixes, want %d", len(stats), byteStatsMaxPrefixes+1)
+	}
+	if stats[0].Prefix != byteStatsOverflow || stats[0].BytesIn != 5 {
+		t.Errorf("busiest = %+v, want %s with 5 bytes", stats[0], byteStatsOverflow)
+	}
+}
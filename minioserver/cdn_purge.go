@@ -0,0 +1,200 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	metrics.describe("kzen_cdn_purges_total", "counter", "Public URLs sent to the CDN purge API, by result (ok|failed|dropped).")
+}
+
+// CDN purge providers.
+const (
+	CDNCloudflare = "cloudflare"
+	CDNFastly     = "fastly"
+)
+
+const (
+	cdnPurgeQueue = 10000
+	// cdnPurgeBatch is the most URLs Cloudflare takes in one purge call.
+	cdnPurgeBatch  = 30
+	cdnPurgeLinger = time.Second
+)
+
+// ParseCDNPurgeURLs parses "bucket=template,..." (e.g. CDN_PURGE_URLS): the public URL of an
+// object of bucket, with {key} (and optionally {bucket}) placeholders; bucket "*" covers every
+// bucket not listed.
+func ParseCDNPurgeURLs(s string) (map[string]string, error) {
+	urls := map[string]string{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		bucket, tmpl, ok := strings.Cut(entry, "=")
+		if !ok || bucket == "" || !strings.Contains(tmpl, "{key}") {
+			return nil, fmt.Errorf("cdn purge url %q: want bucket=https://host/path/{key}", entry)
+		}
+		urls[strings.TrimSpace(bucket)] = strings.TrimSpace(tmpl)
+	}
+	return urls, nil
+}
+
+// cdnPurger sends the public URLs of changed objects to the CDN in the background, batched.
+// Purges are best effort: a failed call is logged and counted, not retried.
+type cdnPurger struct {
+	provider string
+	zone     string // Cloudflare zone ID
+	token    string // Cloudflare API token or Fastly API key
+	urls     map[string]string
+	apiBase  string
+	client   *http.Client
+	queue    chan string
+}
+
+// newCDNPurger returns nil when provider is "".
+func newCDNPurger(provider, zone, token string, urls map[string]string) (*cdnPurger, error) {
+	p := &cdnPurger{provider: provider, zone: zone, token: token, urls: urls,
+		client: &http.Client{Timeout: 30 * time.Second}, queue: make(chan string, cdnPurgeQueue)}
+	switch provider {
+	case "":
+		return nil, nil
+	case CDNCloudflare:
+		if zone == "" {
+			return nil, fmt.Errorf("cdn purge: cloudflare needs a zone ID")
+		}
+		p.apiBase = "https://api.cloudflare.com"
+	case CDNFastly:
+		p.apiBase = "https://api.fastly.com"
+	default:
+		return nil, fmt.Errorf("cdn purge: unknown provider %q (want %s or %s)", provider, CDNCloudflare, CDNFastly)
+	}
+	if token == "" || len(urls) == 0 {
+		return nil, fmt.Errorf("cdn purge: %s needs a token and at least one public URL template", provider)
+	}
+	return p, nil
+}
+
+// publicURL returns the URL key of bucket is served at, or "" if bucket has no template.
+func (p *cdnPurger) publicURL(bucket, key string) string {
+	tmpl, ok := p.urls[bucket]
+	if !ok {
+		tmpl, ok = p.urls["*"]
+	}
+	if !ok {
+		return ""
+	}
+	escaped := (&url.URL{Path: key}).EscapedPath()
+	return strings.NewReplacer("{bucket}", url.PathEscape(bucket), "{key}", escaped).Replace(tmpl)
+}
+
+// changed queues the public URL of key for purging. It never blocks: with the queue full the
+// purge is dropped and counted.
+func (p *cdnPurger) changed(bucket, key string) {
+	if p == nil {
+		return
+	}
+	u := p.publicURL(bucket, key)
+	if u == "" {
+		return
+	}
+	select {
+	case p.queue <- u:
+	default:
+		metrics.add("kzen_cdn_purges_total", 1, "result", "dropped")
+	}
+}
+
+// run sends queued URLs until ctx is done, in batches of up to cdnPurgeBatch gathered over
+// cdnPurgeLinger.
+func (p *cdnPurger) run(ctx context.Context) {
+	for {
+		var batch []string
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-p.queue:
+			batch = append(batch, u)
+		}
+		linger := time.NewTimer(cdnPurgeLinger)
+	gather:
+		for len(batch) < cdnPurgeBatch {
+			select {
+			case u := <-p.queue:
+				if !containsString(batch, u) {
+					batch = append(batch, u)
+				}
+			case <-linger.C:
+				break gather
+			}
+		}
+		linger.Stop()
+		result := "ok"
+		if err := p.purge(ctx, batch); err != nil {
+			log.Printf("cdn purge of %d urls: %v", len(batch), err)
+			result = "failed"
+		}
+		metrics.add("kzen_cdn_purges_total", float64(len(batch)), "result", result)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *cdnPurger) purge(ctx context.Context, urls []string) error {
+	if p.provider == CDNFastly {
+		// Fastly purges one URL per call: POST /purge/<host>/<path>.
+		var failed []string
+		for _, u := range urls {
+			target := strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+			if err := p.call(ctx, p.apiBase+"/purge/"+target, nil, "Fastly-Key", p.token); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", u, err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%s", strings.Join(failed, "; "))
+		}
+		return nil
+	}
+	body, _ := json.Marshal(map[string]any{"files": urls})
+	return p.call(ctx, p.apiBase+"/client/v4/zones/"+url.PathEscape(p.zone)+"/purge_cache", body,
+		"Authorization", "Bearer "+p.token)
+}
+
+func (p *cdnPurger) call(ctx context.Context, endpoint string, body []byte, authHeader, auth string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(authHeader, auth)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
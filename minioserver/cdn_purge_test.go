@@ -0,0 +1,127 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCDNPurgeCloudflare(t *testing.T) {
+	type call struct {
+		path, auth string
+		files      []string
+	}
+	calls := make(chan call, 4)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Files []string `json:"files"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		calls <- call{r.URL.Path, r.Header.Get("Authorization"), body.Files}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer api.Close()
+
+	p, err := newCDNPurger(CDNCloudflare, "zone1", "tok", map[string]string{
+		"kzen-storage": "https://cdn.kzen.app/kzen-storage-objects/{key}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.apiBase = api.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.run(ctx)
+
+	p.changed("kzen-storage", "kzen/users/42/avatar one.jpg")
+	p.changed("kzen-storage", "kzen/users/42/avatar one.jpg")
+	p.changed("kzen-storage", "kzen/users/42/b.png")
+	p.changed("other", "x.jpg") // no template: not purged
+
+	select {
+	case c := <-calls:
+		if c.path != "/client/v4/zones/zone1/purge_cache" || c.auth != "Bearer tok" {
+			t.Errorf("call %s with %q", c.path, c.auth)
+		}
+		want := []string{
+			"https://cdn.kzen.app/kzen-storage-objects/kzen/users/42/avatar%20one.jpg",
+			"https://cdn.kzen.app/kzen-storage-objects/kzen/users/42/b.png",
+		}
+		if !slices.Equal(c.files, want) {
+			t.Errorf("files = %q, want %q", c.files, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no purge call")
+	}
+}
+
+func TestCDNPurgeFastly(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Fastly-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+	}))
+	defer api.Close()
+
+	p, err := newCDNPurger(CDNFastly, "", "key", map[string]string{"*": "https://img.kzen.app/{bucket}/{key}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.apiBase = api.URL
+	if err := p.purge(context.Background(), []string{p.publicURL("files", "a/b.jpg"), p.publicURL("kzen-storage", "c.png")}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/purge/img.kzen.app/files/a/b.jpg", "/purge/img.kzen.app/kzen-storage/c.png"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+}
+
+func TestParseCDNPurgeURLs(t *testing.T) {
+	urls, err := ParseCDNPurgeURLs("kzen-storage=https://cdn.kzen.app/o/{key}, *=https://cdn.kzen.app/{bucket}/{key}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 2 || urls["*"] != "https://cdn.kzen.app/{bucket}/{key}" {
+		t.Errorf("urls = %v", urls)
+	}
+	if _, err := ParseCDNPurgeURLs("kzen-storage=https://cdn.kzen.app/o/"); err == nil {
+		t.Error("template without {key} accepted")
+	}
+	if _, err := newCDNPurger("akamai", "", "t", urls); err == nil {
+		t.Error("unknown provider accepted")
+	}
+	if p, err := newCDNPurger("", "", "", nil); p != nil || err != nil {
+		t.Errorf("disabled purger = %v, %v", p, err)
+	}
+}
+
+// recordingPurger queues the key of every change, in any bucket, without purging it; read them
+// with changedKeys.
+func recordingPurger() *cdnPurger {
+	return &cdnPurger{urls: map[string]string{"*": "{key}"}, queue: make(chan string, 64)}
+}
+
+// changedKeys drains the keys queued on p.
+func changedKeys(p *cdnPurger) []string {
+	var keys []string
+	for {
+		select {
+		case k := <-p.queue:
+			keys = append(keys, k)
+		default:
+			return keys
+		}
+	}
+}
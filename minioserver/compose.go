@@ -0,0 +1,180 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const composeMaxSources = 10000
+
+type composeRequest struct {
+	Sources       []string `json:"sources"`
+	Destination   string   `json:"destination"`
+	ContentType   string   `json:"contentType,omitempty"`
+	DeleteSources bool     `json:"deleteSources,omitempty"`
+}
+
+// composeHandler stitches part objects into one with MinIO ComposeObject.
+// Body: {"sources": ["parts/a.000", "parts/a.001"], "destination": "videos/a.mp4", "deleteSources": true}.
+// Every source except the last must be at least 5 MiB (S3 multipart rule). With auth on, the
+// destination and, with deleteSources, the sources must be the caller's (see ownerMeta); with
+// SoftDelete the sources are moved to the trash. The flags of the mounts serving the keys apply
+// as on their routes (see mountPermits).
+func composeHandler(client *minio.Client, bucket string, mounts []Mount, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req composeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		req.Destination = strings.TrimSpace(req.Destination)
+		if req.Destination == "" {
+			respondError(w, "destination required", http.StatusBadRequest)
+			return
+		}
+		if hiddenKey(opts, bucket, req.Destination) {
+			respondError(w, fmt.Sprintf("%q is a reserved key", req.Destination), http.StatusBadRequest)
+			return
+		}
+		if len(req.Sources) == 0 || len(req.Sources) > composeMaxSources {
+			respondError(w, fmt.Sprintf("between 1 and %d sources required", composeMaxSources), http.StatusBadRequest)
+			return
+		}
+
+		srcs := make([]minio.CopySrcOptions, len(req.Sources))
+		for i, k := range req.Sources {
+			k = strings.TrimSpace(k)
+			if k == "" {
+				respondError(w, fmt.Sprintf("sources[%d] is empty", i), http.StatusBadRequest)
+				return
+			}
+			if hiddenKey(opts, bucket, k) {
+				respondError(w, fmt.Sprintf("%q is a reserved key", k), http.StatusBadRequest)
+				return
+			}
+			if k == req.Destination && req.DeleteSources {
+				respondError(w, "destination cannot be a source when deleteSources is set", http.StatusBadRequest)
+				return
+			}
+			req.Sources[i] = k
+			srcs[i] = minio.CopySrcOptions{Bucket: bucket, Object: k}
+		}
+
+		ctx, cancel := golib.RequestContext(r, 10*time.Minute)
+		defer cancel()
+
+		if err := mountPermits(r, mounts, opts, http.MethodPut, bucket, req.Destination); err != nil {
+			respondMountError(w, err)
+			return
+		}
+		for _, k := range req.Sources {
+			err := mountPermits(r, mounts, opts, http.MethodGet, bucket, k)
+			if err == nil && req.DeleteSources {
+				err = mountPermits(r, mounts, opts, http.MethodDelete, bucket, k)
+			}
+			if err != nil {
+				respondMountError(w, err)
+				return
+			}
+		}
+
+		checks := []string{req.Destination}
+		if req.DeleteSources {
+			checks = append(checks, req.Sources...)
+		}
+		for _, k := range checks {
+			if err := opts.checkOwner(ctx, client, bucket, k); err != nil {
+				respondOwnerError(w, err)
+				return
+			}
+		}
+
+		dst := minio.CopyDestOptions{Bucket: bucket, Object: req.Destination}
+		if opts.ownsObjects() {
+			// Stamping the owner replaces the metadata, so the first source's is carried over.
+			first, err := client.StatObject(ctx, bucket, req.Sources[0], minio.StatObjectOptions{})
+			if golib.IsNotFound(err) {
+				respondError(w, "compose failed: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				respondStorageError(w, err, "compose failed")
+				return
+			}
+			dst.ReplaceMetadata = true
+			dst.UserMetadata = opts.stampOwner(ctx, copyMetadata(first))
+		}
+		if req.ContentType != "" {
+			dst.ReplaceMetadata = true
+			if dst.UserMetadata == nil {
+				dst.UserMetadata = map[string]string{}
+			}
+			dst.UserMetadata["Content-Type"] = req.ContentType
+		}
+		if err := opts.UploadSlots.Acquire(ctx); err != nil {
+			respondUploadBusy(w, opts.UploadSlots, err)
+			return
+		}
+		info, err := client.ComposeObject(ctx, dst, srcs...)
+		opts.UploadSlots.Release()
+		if err != nil {
+			log.Printf("compose %q: %v", req.Destination, err)
+			// A missing or too small source is the caller's mistake, not a missing destination.
+			if golib.MinioErrorResponse(err).Code == "InvalidArgument" || golib.IsNotFound(err) {
+				respondError(w, "compose failed: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			respondStorageError(w, err, "compose failed")
+			return
+		}
+		opts.changed(bucket, req.Destination)
+
+		by := apiKeyName(r.Context())
+		removeSource := func(k string) error {
+			if !opts.SoftDelete {
+				return client.RemoveObject(ctx, bucket, k, minio.RemoveObjectOptions{})
+			}
+			info, err := client.StatObject(ctx, bucket, k, minio.StatObjectOptions{})
+			if golib.IsNotFound(err) {
+				return nil // listed twice
+			}
+			if err == nil {
+				_, err = trashObject(ctx, client, bucket, info, by)
+			}
+			return err
+		}
+		var deleteErrors []string
+		if req.DeleteSources {
+			for _, k := range req.Sources {
+				if err := removeSource(k); err != nil {
+					log.Printf("compose: remove source %q: %v", k, err)
+					deleteErrors = append(deleteErrors, fmt.Sprintf("%s: %v", k, err))
+					continue
+				}
+				opts.changed(bucket, k)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"ok":           true,
+			"key":          req.Destination,
+			"size":         info.Size,
+			"etag":         info.ETag,
+			"deleteErrors": deleteErrors,
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"kzen-go/golib"
+)
+
+func TestCompose_RefusesHiddenKeys(t *testing.T) {
+	client, s := newAppendS3(t)
+	s.put("a.part", []byte("a"))
+	s.put("quarantine/b.part", []byte("flagged"))
+	h := composeHandler(client, "bkt", nil, proxyOptions{})
+
+	for name, body := range map[string]string{
+		"hidden source":      `{"sources":["a.part","quarantine/b.part"],"destination":"out.bin"}`,
+		"hidden destination": `{"sources":["a.part"],"destination":"trash/out.bin"}`,
+	} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/compose", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "reserved key") {
+			t.Errorf("%s: %d %s", name, rec.Code, rec.Body)
+		}
+	}
+	if len(s.objects) != 2 {
+		t.Errorf("objects after refused composes: %v", s.objects)
+	}
+}
+
+// The destination and every removed source are reported changed, for the read cache and CDN.
+func TestCompose_Changed(t *testing.T) {
+	client, s := newAppendS3(t)
+	s.put("a.part", []byte("alpha"))
+	purger := recordingPurger()
+	rec := httptest.NewRecorder()
+	composeHandler(client, "bkt", nil, proxyOptions{Purge: purger})(rec, httptest.NewRequest(http.MethodPost, "/compose",
+		strings.NewReader(`{"sources":["a.part"],"destination":"a.bin","deleteSources":true}`)))
+	if rec.Code != http.StatusOK || string(s.objects["a.bin"]) != "alpha" {
+		t.Fatalf("compose: %d %s, objects %q", rec.Code, rec.Body, s.objects)
+	}
+	if got := changedKeys(purger); !slices.Equal(got, []string{"a.bin", "a.part"}) {
+		t.Errorf("changed %v, want a.bin and a.part", got)
+	}
+}
+
+// Composing takes an upload slot, and with SoftDelete the sources go to the trash.
+func TestCompose_SlotsAndSoftDelete(t *testing.T) {
+	client, s := newAppendS3(t)
+	s.put("a.part", []byte("alpha"))
+	slots := golib.NewSemaphore(1, 0, 0)
+	h := composeHandler(client, "bkt", nil, proxyOptions{UploadSlots: slots, SoftDelete: true})
+	compose := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/compose",
+			strings.NewReader(`{"sources":["a.part"],"destination":"a.bin","deleteSources":true}`)))
+		return rec
+	}
+
+	if err := slots.Acquire(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if rec := compose(); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("compose with no free slot: %d %s", rec.Code, rec.Body)
+	}
+	slots.Release()
+
+	if rec := compose(); rec.Code != http.StatusOK || string(s.objects["a.bin"]) != "alpha" {
+		t.Fatalf("compose: %d %s", rec.Code, rec.Body)
+	}
+	if _, ok := s.objects["a.part"]; ok {
+		t.Error("source not removed")
+	}
+	trashed := false
+	for k, v := range s.objects {
+		trashed = trashed || (strings.HasPrefix(k, "trash/a.part~") && string(v) == "alpha")
+	}
+	if !trashed {
+		t.Errorf("source not in the trash: %q", s.objects)
+	}
+}
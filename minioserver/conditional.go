@@ -0,0 +1,97 @@
+package minioserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+	"kzen-go/minioserver/media-handlers"
+)
+
+// checkWritePreconditions evaluates conditional request headers for an upload to objectKey.
+// It returns 0 when the write may proceed, otherwise the HTTP status and message to reply with.
+//
+// If-None-Match: * means "create only": the upload is rejected with 412 when the key already exists.
+// If-Match: "<etag>" means "replace only this version": the upload is rejected with 412 when the
+// object is missing or its ETag differs, so concurrent editors don't silently lose updates.
+// The Stat answers the common case early; the returned writeCondition repeats the check on the Put
+// itself, so a writer that raced past the Stat still gets 412 (see writeCondition.apply).
+func checkWritePreconditions(ctx context.Context, client *minio.Client, bucket, objectKey string, r *http.Request) (writeCondition, int, string) {
+	ifNoneMatch := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifNoneMatch != "*" && ifMatch == "" {
+		return writeCondition{}, 0, ""
+	}
+
+	info, err := client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{})
+	// A reservation placeholder (POST /reserve) stands in for an object that does not exist yet.
+	reserved := err == nil && mediahandlers.IsReservation(info)
+	exists := err == nil && !reserved
+	if err != nil && !golib.IsNotFound(err) {
+		log.Printf("precondition stat %q bucket=%q: %v", objectKey, bucket, err)
+		if status := golib.MinioStatus(err); status != http.StatusInternalServerError {
+			return writeCondition{}, status, storageErrorMessages[status]
+		}
+		return writeCondition{}, http.StatusInternalServerError, "failed to check object existence"
+	}
+
+	var cond writeCondition
+	if ifNoneMatch == "*" {
+		if exists {
+			return cond, http.StatusPreconditionFailed, "object already exists"
+		}
+		if reserved {
+			// Replace the placeholder, and only it.
+			cond.matchETag = info.ETag
+		} else {
+			cond.mustCreate = true
+		}
+	}
+	if ifMatch != "" {
+		if !exists {
+			return cond, http.StatusPreconditionFailed, "object does not exist"
+		}
+		if !etagMatches(ifMatch, info.ETag) {
+			return cond, http.StatusPreconditionFailed, "object changed since it was fetched"
+		}
+		cond.matchETag = info.ETag
+	}
+	return cond, 0, ""
+}
+
+// writeCondition is what checkWritePreconditions saw, for MinIO to check again atomically with
+// the Put. A Put that no longer meets it fails with PreconditionFailed (golib.MinioStatus: 412).
+type writeCondition struct {
+	mustCreate bool   // the key must still not exist
+	matchETag  string // the object must still have this ETag
+}
+
+func (c writeCondition) apply(opts *minio.PutObjectOptions) {
+	if c.mustCreate {
+		opts.SetMatchETagExcept("*")
+	}
+	if c.matchETag != "" {
+		opts.SetMatchETag(c.matchETag)
+	}
+}
+
+// etagMatches reports whether an If-Match header value (comma-separated list or "*") matches etag.
+// Quotes and weak prefixes are ignored since MinIO ETags are compared as opaque strings.
+func etagMatches(header, etag string) bool {
+	etag = normalizeETag(etag)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || (candidate != "" && normalizeETag(candidate) == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeETag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+}
@@ -0,0 +1,153 @@
+package minioserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		want   bool
+	}{
+		{name: "quoted header", header: `"abc123"`, etag: "abc123", want: true},
+		{name: "unquoted header", header: "abc123", etag: "abc123", want: true},
+		{name: "weak etag", header: `W/"abc123"`, etag: "abc123", want: true},
+		{name: "list contains match", header: `"zzz", "abc123"`, etag: "abc123", want: true},
+		{name: "wildcard", header: "*", etag: "abc123", want: true},
+		{name: "mismatch", header: `"zzz"`, etag: "abc123", want: false},
+		{name: "multipart etag", header: `"d41d8cd9-2"`, etag: "d41d8cd9-2", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, tt.etag); got != tt.want {
+				t.Fatalf("etagMatches(%q, %q) = %v, want %v", tt.header, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
+
+// conditionalS3 is a bucket that, like MinIO, checks If-Match and If-None-Match on the write
+// itself: a plain PUT, or the start of a multipart upload (minio-go sends the conditions there).
+// beforeWrite runs between the proxy's Stat and its write, standing in for a concurrent writer.
+func conditionalS3(t *testing.T, beforeWrite func(objects map[string]string)) (*minio.Client, map[string]string) {
+	t.Helper()
+	var mu sync.Mutex
+	objects := map[string]string{} // key -> ETag
+	version := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		io.Copy(io.Discard, r.Body)
+		key := strings.TrimPrefix(r.URL.Path, "/bkt/")
+		q := r.URL.Query()
+		if start := r.Method == http.MethodPost && q.Has("uploads"); start || (r.Method == http.MethodPut && !q.Has("partNumber")) {
+			if beforeWrite != nil {
+				beforeWrite(objects)
+			}
+			current, exists := objects[key]
+			ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+			if (ifNoneMatch != "" && exists && (ifNoneMatch == `"*"` || ifNoneMatch == `"`+current+`"`)) ||
+				(ifMatch != "" && (!exists || ifMatch != `"`+current+`"`)) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				io.WriteString(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+				return
+			}
+		}
+		switch {
+		case r.Method == http.MethodHead:
+			etag, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("ETag", `"`+etag+`"`)
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		case r.Method == http.MethodPost && q.Has("uploads"):
+			io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && q.Has("partNumber"):
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodPut, r.Method == http.MethodPost:
+			version++
+			objects[key] = "put" + strconv.Itoa(version)
+			w.Header().Set("ETag", `"`+objects[key]+`"`)
+			if r.Method == http.MethodPost {
+				io.WriteString(w, `<CompleteMultipartUploadResult><Bucket>bkt</Bucket><ETag>"`+objects[key]+`"</ETag></CompleteMultipartUploadResult>`)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := minio.New(strings.TrimPrefix(srv.URL, "http://"), &minio.Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, objects
+}
+
+func TestProxyPost_IfNoneMatch(t *testing.T) {
+	put := func(client *minio.Client, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/objects/"+key, strings.NewReader("data"))
+		req.Header.Set("If-None-Match", "*")
+		rec := httptest.NewRecorder()
+		proxyPostWithPrefix(client, "bkt", "/objects/", proxyOptions{})(rec, req)
+		return rec
+	}
+
+	client, objects := conditionalS3(t, nil)
+	if rec := put(client, "a.txt"); rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	if rec := put(client, "a.txt"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("existing key: %d, want 412", rec.Code)
+	}
+
+	// Another writer creates the key after the Stat: the write itself must fail.
+	client, objects = conditionalS3(t, func(objects map[string]string) { objects["race.txt"] = "theirs" })
+	if rec := put(client, "race.txt"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("key created concurrently: %d %s, want 412", rec.Code, rec.Body)
+	}
+	if objects["race.txt"] != "theirs" {
+		t.Errorf("concurrent writer's object replaced: %q", objects["race.txt"])
+	}
+}
+
+func TestProxyPost_IfMatch(t *testing.T) {
+	put := func(client *minio.Client, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/objects/doc.txt", strings.NewReader("data"))
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		proxyPostWithPrefix(client, "bkt", "/objects/", proxyOptions{})(rec, req)
+		return rec
+	}
+
+	client, objects := conditionalS3(t, nil)
+	if rec := put(client, `"v1"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("missing object: %d, want 412", rec.Code)
+	}
+	objects["doc.txt"] = "v1"
+	if rec := put(client, `"v0"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale ETag: %d, want 412", rec.Code)
+	}
+	if rec := put(client, `"v1"`); rec.Code != http.StatusCreated || objects["doc.txt"] == "v1" {
+		t.Errorf("current ETag: %d %s", rec.Code, rec.Body)
+	}
+
+	// Another editor saves between the Stat and the write: the stale write must not land.
+	client, objects = conditionalS3(t, func(objects map[string]string) { objects["doc.txt"] = "theirs" })
+	objects["doc.txt"] = "v1"
+	if rec := put(client, `"v1"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("object changed concurrently: %d %s, want 412", rec.Code, rec.Body)
+	}
+	if objects["doc.txt"] != "theirs" {
+		t.Errorf("concurrent edit lost: %q", objects["doc.txt"])
+	}
+}
@@ -0,0 +1,84 @@
+package minioserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	metrics.describe("kzen_decompressed_responses_total", "counter", "Pre-compressed objects decompressed for clients that don't accept their encoding, by encoding.")
+}
+
+// storedEncodings are the Content-Encodings uploads may be stored with. gzip objects are
+// decompressed on the fly for clients that don't accept gzip; the standard library has no Brotli
+// decoder, so br objects are refused (406) to such clients.
+var storedEncodings = map[string]bool{"gzip": true, "br": true}
+
+// uploadEncoding returns the Content-Encoding an upload is stored with ("" for none), or ok false
+// for an encoding that can't be stored.
+func uploadEncoding(r *http.Request) (encoding string, ok bool) {
+	enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if enc == "" || enc == "identity" {
+		return "", true
+	}
+	return enc, storedEncodings[enc]
+}
+
+// acceptsEncoding reports whether r's Accept-Encoding allows enc: named, or covered by "*", with
+// a non-zero q.
+func acceptsEncoding(r *http.Request, enc string) bool {
+	wildcard := false
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			q := 1.0
+			if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+			switch {
+			case name == enc:
+				return q > 0
+			case name == "*":
+				wildcard = q > 0
+			}
+		}
+	}
+	return wildcard
+}
+
+// negotiateEncoding prepares the response for an object stored with Content-Encoding encoding
+// ("" for none) and returns the body to stream and its size. Clients accepting the encoding get
+// the stored bytes with Content-Encoding set; others get gzip objects decompressed (chunked, ETag
+// suffixed -identity) and other encodings a 406, in which case ok is false and the response is
+// written.
+func negotiateEncoding(w http.ResponseWriter, r *http.Request, body io.Reader, size int64, etag, encoding string) (io.Reader, int64, bool) {
+	encoding = strings.ToLower(encoding)
+	if encoding == "" || encoding == "identity" {
+		return body, size, true
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if acceptsEncoding(r, encoding) {
+		w.Header().Set("Content-Encoding", encoding)
+		return body, size, true
+	}
+	if encoding != "gzip" {
+		respondErrorCode(w, "object is stored "+encoding+"-encoded, which the client does not accept", "not_acceptable", http.StatusNotAcceptable)
+		return nil, 0, false
+	}
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		respondError(w, "stored gzip object is corrupt", http.StatusBadGateway)
+		return nil, 0, false
+	}
+	if etag != "" {
+		w.Header().Set("ETag", `"`+etag+`-identity"`)
+	}
+	metrics.add("kzen_decompressed_responses_total", 1, "encoding", encoding)
+	return gz, -1, true
+}
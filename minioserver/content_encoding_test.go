@@ -0,0 +1,96 @@
+package minioserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"gzip, deflate, br", true},
+		{"br;q=1.0, gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"*", true},
+		{"*, gzip;q=0", false},
+		{"deflate", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept-Encoding", tc.accept)
+		}
+		if got := acceptsEncoding(r, "gzip"); got != tc.want {
+			t.Errorf("acceptsEncoding(%q, gzip) = %v, want %v", tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestPreCompressedObjects(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	const doc = `{"items": ["a", "b", "c"]}`
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(doc))
+	zw.Close()
+
+	for _, opts := range []proxyOptions{{}, {ReadCache: newReadCache(1<<20, 0, time.Minute, 0, 0)}} {
+		h := objectsHandlerWithPrefix(client, "files", "/objects/", opts)
+		do := func(method, target string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, target, bytes.NewReader(body))
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec
+		}
+
+		putEncoded(t, client, "data.json", gz.Bytes(), "gzip")
+		if !bytes.Equal(objects["data.json"], gz.Bytes()) {
+			t.Fatal("object not stored compressed")
+		}
+
+		// A client accepting gzip gets the stored bytes as they are.
+		rec := do(http.MethodGet, "/objects/data.json", nil, map[string]string{"Accept-Encoding": "gzip, br"})
+		if rec.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(rec.Body.Bytes(), gz.Bytes()) || rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("gzip client: %d %v", rec.Code, rec.Header())
+		}
+		// Others get it decompressed, under a different ETag.
+		rec = do(http.MethodGet, "/objects/data.json", nil, nil)
+		body, _ := io.ReadAll(rec.Body)
+		if rec.Header().Get("Content-Encoding") != "" || string(body) != doc || rec.Header().Get("ETag") != `"abc-identity"` {
+			t.Errorf("identity client: %q %v", body, rec.Header())
+		}
+
+		// Brotli can't be decoded here: clients without br are refused.
+		putEncoded(t, client, "data.br.json", []byte("not really brotli"), "br")
+		if rec := do(http.MethodGet, "/objects/data.br.json", nil, map[string]string{"Accept-Encoding": "gzip"}); rec.Code != http.StatusNotAcceptable {
+			t.Errorf("br to gzip-only client: %d", rec.Code)
+		}
+		if rec := do(http.MethodPut, "/objects/x", []byte("x"), map[string]string{"Content-Encoding": "compress"}); rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("unknown encoding: %d", rec.Code)
+		}
+		opts.changed("files", "data.json")
+		opts.changed("files", "data.br.json")
+	}
+}
+
+func putEncoded(t *testing.T, client *minio.Client, key string, data []byte, encoding string) {
+	t.Helper()
+	_, err := client.PutObject(context.Background(), "files", key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json", ContentEncoding: encoding})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,283 @@
+package minioserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+func init() {
+	metrics.describe("kzen_content_hash_stored_total", "counter", "Objects copied under their content hash for /i/ URLs.")
+}
+
+// Content-hash URLs: /i/{sha256}.{ext} serves a copy of an object stored under its content hash,
+// so the URL of an image changes when the image does and can be cached forever. Logical keys
+// (img_path) are translated to hash URLs by /i/resolve.
+const (
+	hashRoute      = "/i/"
+	hashResolve    = "/i/resolve"
+	hashBlobPrefix = "sha256/"
+	// hashCacheControl is sent with every hash URL: its content never changes.
+	hashCacheControl = "public, max-age=31536000, immutable"
+	// hashCacheMax bounds the remembered key -> hash translations.
+	hashCacheMax = 100000
+	// hashResolveMax bounds the keys of one POST /i/resolve.
+	hashResolveMax = 500
+)
+
+var hashNamePattern = regexp.MustCompile(`^([0-9a-f]{64})(\.[a-z0-9]{1,10})?$`)
+
+// contentHashes stores hashed copies of objects in bucket and remembers which hash each
+// version (ETag) of a logical key has.
+type contentHashes struct {
+	client *minio.Client
+	bucket string // where hashed copies are stored
+
+	mu    sync.Mutex
+	known map[string]string // "bucket/key etag" -> hash name
+}
+
+func newContentHashes(client *minio.Client, bucket string) *contentHashes {
+	return &contentHashes{client: client, bucket: bucket, known: map[string]string{}}
+}
+
+// hashName returns the name ("<sha256>.<ext>") under /i/ of the current content of key in
+// bucket, hashing it and storing the hashed copy the first time that content is seen.
+func (c *contentHashes) hashName(ctx context.Context, bucket, key string) (string, error) {
+	info, err := c.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	id := bucket + "/" + key + " " + info.ETag
+	c.mu.Lock()
+	name, ok := c.known[id]
+	c.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	obj, err := c.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, obj)
+	obj.Close()
+	if err != nil {
+		return "", err
+	}
+	name = hex.EncodeToString(h.Sum(nil))
+	if ext := strings.ToLower(path.Ext(key)); hashNamePattern.MatchString(name + ext) {
+		name += ext
+	}
+	blob := hashBlobPrefix + name
+	if _, err := c.client.StatObject(ctx, c.bucket, blob, minio.StatObjectOptions{}); golib.IsNotFound(err) {
+		meta := map[string]string{"Content-Type": info.ContentType, "Hashed-From": bucket + "/" + key}
+		if _, err := c.client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: c.bucket, Object: blob, UserMetadata: meta, ReplaceMetadata: true},
+			minio.CopySrcOptions{Bucket: bucket, Object: key, MatchETag: info.ETag}); err != nil {
+			return "", err
+		}
+		metrics.add("kzen_content_hash_stored_total", 1)
+	} else if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	if len(c.known) >= hashCacheMax {
+		clear(c.known)
+	}
+	c.known[id] = name
+	c.mu.Unlock()
+	return name, nil
+}
+
+// contentHashHandler serves
+//
+//	GET  /i/{sha256}.{ext}             the hashed copy, cacheable forever
+//	GET  /i/resolve?key=[&bucket=]     302 to the hash URL of key's current content
+//	POST /i/resolve                    {"bucket": "...", "keys": [...]} -> {"urls": {key: "/i/..."}}
+//
+// bucket defaults to defaultBucket; keys are full object keys (e.g. kzen/users/42/a.jpg). Resolving
+// copies objects, so it takes an API key on every method, and a hash URL is public, so only keys
+// an objects mount of mounts serves with public reads get one (see hashSource).
+func contentHashHandler(hashes *contentHashes, defaultBucket string, mounts []Mount, opts proxyOptions) http.HandlerFunc {
+	get := proxyGetWithPrefix(hashes.client, hashes.bucket, hashRoute, opts)
+	resolve := requireAPIKey(opts.APIKeys, func(w http.ResponseWriter, r *http.Request) {
+		resolveContentHash(w, r, hashes, defaultBucket, mounts, opts)
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == hashResolve {
+			resolve(w, r)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, hashRoute)
+		if !hashNamePattern.MatchString(name) {
+			respondError(w, "object not found", http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !opts.Hotlink.permits(w, r, opts.APIKeys) {
+			opts.Hotlink.respondBlocked(w, r, hashes.client, hashes.bucket, hashBlobPrefix+name)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.URL.Path = hashRoute + hashBlobPrefix + name
+		get(&immutableWriter{ResponseWriter: w}, r)
+	}
+}
+
+var (
+	errHashNotServed = errors.New("no objects mount serves the key")
+	errHashNotPublic = errors.New("the key is not publicly readable")
+)
+
+// hashSource checks key in bucket may get a hash URL: it must be served by an objects mount
+// (the first of mounts whose bucket and prefix hold it) that allows public reads, and not be one
+// of the keys the object routes hide.
+func hashSource(opts proxyOptions, mounts []Mount, bucket, key string) error {
+	if hiddenKey(opts, bucket, key) {
+		return errHashNotServed
+	}
+	m, ok := servingMount(mounts, bucket, key)
+	if !ok {
+		return errHashNotServed
+	}
+	if !m.features().PublicRead {
+		return errHashNotPublic
+	}
+	return nil
+}
+
+// immutableWriter adds hashCacheControl to successful responses only; a 404 must stay
+// uncached, since the hashed copy may be stored later.
+type immutableWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (iw *immutableWriter) WriteHeader(status int) {
+	if !iw.wroteHeader && (status < 300 || status == http.StatusNotModified) {
+		iw.Header().Set("Cache-Control", hashCacheControl)
+	}
+	iw.wroteHeader = true
+	iw.ResponseWriter.WriteHeader(status)
+}
+
+func (iw *immutableWriter) Write(p []byte) (int, error) {
+	if !iw.wroteHeader {
+		iw.WriteHeader(http.StatusOK)
+	}
+	return iw.ResponseWriter.Write(p)
+}
+
+func (iw *immutableWriter) Flush() {
+	if f, ok := iw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (iw *immutableWriter) Unwrap() http.ResponseWriter { return iw.ResponseWriter }
+
+func resolveContentHash(w http.ResponseWriter, r *http.Request, hashes *contentHashes, defaultBucket string, mounts []Mount, opts proxyOptions) {
+	// The hash URL serves the object to anyone, so the hotlink policy applies to resolving it.
+	if !opts.Hotlink.permits(w, r, opts.APIKeys) {
+		respondError(w, "hotlinking not allowed", http.StatusForbidden)
+		return
+	}
+	ctx, cancel := golib.RequestContext(r, 60*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		bucket := q.Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		key := strings.TrimPrefix(q.Get("key"), "/")
+		if key == "" {
+			respondError(w, "key query parameter required", http.StatusBadRequest)
+			return
+		}
+		if err := hashSource(opts, mounts, bucket, key); err != nil {
+			respondError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		name, err := hashes.hashName(ctx, bucket, key)
+		if err != nil {
+			if golib.IsNotFound(err) {
+				respondError(w, "object not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("hash %s/%s: %v", bucket, key, err)
+			respondStorageError(w, err, "failed to hash object")
+			return
+		}
+		// The key may be replaced at any time, so the redirect itself must not be cached long.
+		w.Header().Set("Cache-Control", "no-cache")
+		http.Redirect(w, r, hashRoute+name, http.StatusFound)
+	case http.MethodPost:
+		var req struct {
+			Bucket string   `json:"bucket"`
+			Keys   []string `json:"keys"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || len(req.Keys) == 0 {
+			respondError(w, `body must be {"keys": ["..."]}`, http.StatusBadRequest)
+			return
+		}
+		if len(req.Keys) > hashResolveMax {
+			respondError(w, "too many keys", http.StatusBadRequest)
+			return
+		}
+		if req.Bucket == "" {
+			req.Bucket = defaultBucket
+		}
+		urls := map[string]string{}
+		errs := map[string]string{}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, 8)
+		for _, key := range req.Keys {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(key string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				name, err := "", hashSource(opts, mounts, req.Bucket, strings.TrimPrefix(key, "/"))
+				if err == nil {
+					name, err = hashes.hashName(ctx, req.Bucket, strings.TrimPrefix(key, "/"))
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs[key] = err.Error()
+					return
+				}
+				urls[key] = hashRoute + name
+			}(key)
+		}
+		wg.Wait()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"bucket": req.Bucket, "urls": urls, "errors": errs})
+	default:
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
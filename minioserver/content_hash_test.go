@@ -0,0 +1,110 @@
+package minioserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentHashHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["kzen/users/42/a.JPG"] = []byte("avatar v1")
+	h := contentHashHandler(newContentHashes(client, "files"), "files", defaultMounts("files"), proxyOptions{})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+	sum := sha256.Sum256([]byte("avatar v1"))
+	want := "/i/" + hex.EncodeToString(sum[:]) + ".jpg"
+
+	rec := do(http.MethodGet, "/i/resolve?key=kzen/users/42/a.JPG", "")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != want {
+		t.Fatalf("resolve: %d %q, want %s", rec.Code, rec.Header().Get("Location"), want)
+	}
+	if string(objects["sha256/"+strings.TrimPrefix(want, "/i/")]) != "avatar v1" {
+		t.Fatalf("hashed copy not stored: %v", objects)
+	}
+
+	rec = do(http.MethodGet, want, "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "avatar v1" || rec.Header().Get("Cache-Control") != hashCacheControl {
+		t.Errorf("GET %s: %d %q %q", want, rec.Code, rec.Body.String(), rec.Header().Get("Cache-Control"))
+	}
+	missing := "/i/" + strings.Repeat("0", 64) + ".jpg"
+	if rec := do(http.MethodGet, missing, ""); rec.Code != http.StatusNotFound || rec.Header().Get("Cache-Control") != "" {
+		t.Errorf("missing hash: %d, Cache-Control %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	if rec := do(http.MethodGet, "/i/../objects/a.jpg", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("non-hash name: %d", rec.Code)
+	}
+
+	protected := contentHashHandler(newContentHashes(client, "files"), "files", defaultMounts("files"),
+		proxyOptions{Hotlink: newHotlinkPolicy([]string{"kzen.app"}, false, "")})
+	for referer, status := range map[string]int{"https://kzen.app/": http.StatusOK, "https://evil.com/": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, want, nil)
+		req.Header.Set("Referer", referer)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		if rec.Code != status || rec.Header().Get("Vary") != "Origin, Referer" {
+			t.Errorf("hash URL from %s: %d, Vary %q, want %d", referer, rec.Code, rec.Header().Get("Vary"), status)
+		}
+	}
+
+	rec = do(http.MethodPost, "/i/resolve", `{"keys": ["kzen/users/42/a.JPG", "nope.png"]}`)
+	var resp struct {
+		URLs   map[string]string `json:"urls"`
+		Errors map[string]string `json:"errors"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.URLs["kzen/users/42/a.JPG"] != want || resp.Errors["nope.png"] == "" {
+		t.Errorf("POST resolve: %s", rec.Body.String())
+	}
+}
+
+func TestContentHashHandler_Resolve(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	for _, key := range []string{"public/a.jpg", "private/b.jpg", "trash/public/c.jpg~1"} {
+		objects[key] = []byte(key)
+	}
+	mounts := []Mount{
+		{Route: "/pub/", Bucket: "files", Prefix: "public/", Type: MountTypeObjects},
+		{Route: "/priv/", Bucket: "files", Prefix: "private/", Type: MountTypeObjects, Features: &MountFeatures{Upload: true}},
+	}
+	opts := proxyOptions{APIKeys: newAPIKeyStore([]APIKey{{Name: "app", Key: "secret"}})}
+	h := contentHashHandler(newContentHashes(client, "files"), "files", mounts, opts)
+	resolve := func(target, key string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := resolve("/i/resolve?key=public/a.jpg", ""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous resolve: %d, want 401", code)
+	}
+	for key := range objects {
+		if strings.HasPrefix(key, "sha256/") {
+			t.Fatalf("anonymous resolve stored %s", key)
+		}
+	}
+	if code := resolve("/i/resolve?key=public/a.jpg", "secret"); code != http.StatusFound {
+		t.Errorf("public key: %d, want 302", code)
+	}
+	for _, target := range []string{
+		"/i/resolve?key=private/b.jpg",
+		"/i/resolve?key=trash/public/c.jpg~1",
+		"/i/resolve?key=other/d.jpg",
+		"/i/resolve?bucket=backups&key=public/a.jpg",
+	} {
+		if code := resolve(target, "secret"); code != http.StatusForbidden {
+			t.Errorf("%s: %d, want 403", target, code)
+		}
+	}
+}
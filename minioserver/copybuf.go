@@ -0,0 +1,36 @@
+package minioserver
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// copyBufSize is larger than io.Copy's 32 KiB default: fewer reads from the MinIO connection per
+// image and fewer writes to the client socket.
+const copyBufSize = 256 << 10
+
+var copyBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, copyBufSize)
+		return &b
+	},
+}
+
+// writerOnly hides dst's io.ReaderFrom so io.CopyBuffer uses the pooled buffer.
+type writerOnly struct{ io.Writer }
+
+// copyPooled is io.Copy with a pooled buffer. Sources with their own fast path keep it:
+// io.WriterTo (bytes.Reader, strings.Reader) writes directly, and *os.File goes through dst's
+// ReaderFrom so net/http can use sendfile.
+func copyPooled(dst io.Writer, src io.Reader) (int64, error) {
+	if wt, ok := src.(io.WriterTo); ok {
+		return wt.WriteTo(dst)
+	}
+	if _, ok := src.(*os.File); ok {
+		return io.Copy(dst, src)
+	}
+	bufp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bufp)
+	return io.CopyBuffer(writerOnly{dst}, src, *bufp)
+}
@@ -0,0 +1,109 @@
+package minioserver
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// MountCORS is the CORS policy of one mount, replacing the global one (any origin, or
+// Config.CredentialedOrigins) for its routes: e.g. a public image mount readable from anywhere
+// next to an upload mount only the frontend may call.
+type MountCORS struct {
+	// Origins are the allowed Origin values, e.g. "https://app.kzen.app"; "*" allows any.
+	Origins []string `json:"origins"`
+	// Methods are the allowed methods; empty allows every method the proxy serves.
+	Methods []string `json:"methods,omitempty"`
+	// Credentials lets the origins send cookies (see csrf.go); not allowed with "*".
+	Credentials bool `json:"credentials,omitempty"`
+}
+
+const corsAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+
+func (c *MountCORS) normalize() error {
+	if len(c.Origins) == 0 {
+		return fmt.Errorf("cors needs at least one origin")
+	}
+	for i, o := range c.Origins {
+		o = strings.TrimSuffix(strings.TrimSpace(o), "/")
+		if o != "*" && !strings.HasPrefix(o, "http://") && !strings.HasPrefix(o, "https://") {
+			return fmt.Errorf("cors origin %q must be * or scheme://host", o)
+		}
+		c.Origins[i] = o
+	}
+	if c.Credentials && slices.Contains(c.Origins, "*") {
+		return fmt.Errorf("cors credentials need explicit origins, not *")
+	}
+	for i, m := range c.Methods {
+		c.Methods[i] = strings.ToUpper(strings.TrimSpace(m))
+	}
+	if len(c.Methods) > 0 && !slices.Contains(c.Methods, http.MethodOptions) {
+		c.Methods = append(c.Methods, http.MethodOptions)
+	}
+	return nil
+}
+
+// setHeaders sets the CORS headers of c for a request from origin. A disallowed origin gets an
+// empty Access-Control-Allow-Origin entry, which is not sent but keeps setCORSHeaders (e.g. on
+// 401) from filling in "*".
+func (c *MountCORS) setHeaders(w http.ResponseWriter, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	switch {
+	case origin != "" && slices.Contains(c.Origins, strings.TrimSuffix(origin, "/")):
+		h.Set("Access-Control-Allow-Origin", origin)
+	case slices.Contains(c.Origins, "*"):
+		h.Set("Access-Control-Allow-Origin", "*")
+	default:
+		h["Access-Control-Allow-Origin"] = nil
+		return
+	}
+	if c.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	setCORSHeaders(w)
+	if len(c.Methods) > 0 {
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.Methods, ", "))
+	}
+}
+
+// mountCORSMiddleware applies the CORS policy of the mount a request is routed to, and the
+// global cors middleware to requests for everything else.
+func mountCORSMiddleware(mounts []Mount, cors func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	// A mux with the mounts' patterns finds the mount the main mux will pick.
+	routes := http.NewServeMux()
+	policies := map[string]*MountCORS{}
+	for _, m := range mounts {
+		if m.CORS != nil {
+			routes.Handle(m.pattern(), http.NotFoundHandler())
+			policies[m.pattern()] = m.CORS
+		}
+	}
+	if len(policies) == 0 {
+		return cors
+	}
+	return func(next http.Handler) http.Handler {
+		fallback := cors(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lookup := r
+			// /v2/ paths are rewritten later on, by apiVersionMiddleware.
+			if _, p := requestAPIVersion(r); p != r.URL.Path {
+				lookup = r.Clone(r.Context())
+				lookup.URL.Path, lookup.URL.RawPath = p, ""
+			}
+			_, pattern := routes.Handler(lookup)
+			policy, ok := policies[pattern]
+			if !ok {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+			policy.setHeaders(w, r.Header.Get("Origin"))
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
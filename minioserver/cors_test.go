@@ -0,0 +1,53 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMountCORSMiddleware(t *testing.T) {
+	mounts, err := ParseMounts(`[
+		{"route":"/images/","cors":{"origins":["*"],"methods":["get","head"]}},
+		{"route":"/uploads/","cors":{"origins":["https://app.kzen.app/"],"credentials":true}}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unauthorized := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { respondUnauthorized(w) })
+	h := mountCORSMiddleware(mounts, corsMiddleware)(unauthorized)
+
+	do := func(method, target, origin string) http.Header {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Result().Header
+	}
+
+	for _, c := range []struct {
+		method, target, origin string
+		wantOrigin, wantCreds  string
+	}{
+		{http.MethodGet, "/images/a.png", "https://anyone.example", "*", ""},
+		{http.MethodOptions, "/uploads/a.png", "https://app.kzen.app", "https://app.kzen.app", "true"},
+		{http.MethodPut, "/v2/uploads/a.png", "https://app.kzen.app", "https://app.kzen.app", "true"},
+		{http.MethodPut, "/uploads/a.png", "https://evil.example", "", ""},
+		{http.MethodGet, "/other/a.png", "https://evil.example", "*", ""},
+	} {
+		hdr := do(c.method, c.target, c.origin)
+		if got := hdr.Get("Access-Control-Allow-Origin"); got != c.wantOrigin {
+			t.Errorf("%s %s from %s: Allow-Origin %q, want %q", c.method, c.target, c.origin, got, c.wantOrigin)
+		}
+		if got := hdr.Get("Access-Control-Allow-Credentials"); got != c.wantCreds {
+			t.Errorf("%s %s from %s: Allow-Credentials %q, want %q", c.method, c.target, c.origin, got, c.wantCreds)
+		}
+	}
+	if got := do(http.MethodOptions, "/images/a.png", "https://anyone.example").Get("Access-Control-Allow-Methods"); got != "GET, HEAD, OPTIONS" {
+		t.Errorf("Allow-Methods = %q", got)
+	}
+
+	if _, err := ParseMounts(`[{"route":"/u/","cors":{"origins":["*"],"credentials":true}}]`); err == nil {
+		t.Error("credentials with * accepted")
+	}
+}
@@ -1,7 +1,6 @@
 package minioserver
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -12,6 +11,8 @@ import (
 	"time"
 
 	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
 )
 
 var uuidInNameRe = regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
@@ -45,11 +46,11 @@ type createStoryFolderResult struct {
 func createStoryFolderHandler(client *minio.Client, bucket string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+		ctx, cancel := golib.RequestContext(r, 10*time.Minute)
 		defer cancel()
 
 		result := createStoryFolderResult{
@@ -0,0 +1,35 @@
+package minioserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, 1, 30, 10, 17, 30, 0, time.UTC) // a Friday
+	for _, tc := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 1, 30, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 1, 31, 3, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", time.Date(2026, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 7", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}, // day-of-month or Sunday
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		s, err := parseCron(tc.spec)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tc.spec, err)
+		}
+		if got := s.next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: next = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("parseCron(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package minioserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Browsers calling from CredentialedOrigins may hold an access token in an HttpOnly cookie
+// instead of a header. Since the browser attaches that cookie to any request, including forged
+// cross-site ones, every mutating request authenticated by it must also send X-CSRF-Token: a
+// value derived from the token with HMAC, handed to the page by POST /auth/cookie. A forged
+// request can't read it, and it needs no server-side session.
+const (
+	authCookieName = "kzen_token"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+var errCSRF = errors.New("missing or invalid CSRF token")
+
+// csrfToken is the X-CSRF-Token value for the access token in the cookie.
+func (s *apiKeyStore) csrfToken(token string) string {
+	mac := hmac.New(sha256.New, s.tokenSecret)
+	mac.Write([]byte("csrf " + token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cookieToken returns the access token of r's auth cookie when cookie auth is on and r carries
+// no key of its own.
+func (s *apiKeyStore) cookieToken(r *http.Request) string {
+	if !s.cookieAuth || requestAPIKey(r) != "" || isSignedRequest(r) {
+		return ""
+	}
+	c, err := r.Cookie(authCookieName)
+	if err != nil || !isAccessToken(c.Value) {
+		return ""
+	}
+	return c.Value
+}
+
+// verifyCookie checks the token in the auth cookie and, for methods that change state, the
+// X-CSRF-Token header that must accompany it.
+func (s *apiKeyStore) verifyCookie(r *http.Request, token string, now time.Time) (string, error) {
+	name, err := s.verifyToken(r, token, now)
+	if err != nil {
+		return name, err
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return name, nil
+	}
+	if !hmac.Equal([]byte(r.Header.Get(csrfHeader)), []byte(s.csrfToken(token))) {
+		return name, errCSRF
+	}
+	return name, nil
+}
+
+// authCookieHandler serves /auth/cookie. POST with an access token (not a key, which must never
+// sit in a browser) stores that token in the HttpOnly auth cookie and returns the CSRF token for
+// it; DELETE clears the cookie. The token is checked here rather than by apiKeyMiddleware, as its
+// paths needn't cover /auth/cookie.
+func authCookieHandler(keys *apiKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+		case http.MethodDelete:
+			http.SetCookie(w, &http.Cookie{Name: authCookieName, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteNoneMode})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := requestAPIKey(r)
+		if !isAccessToken(token) {
+			respondError(w, "an access token from /auth/token is required", http.StatusForbidden)
+			return
+		}
+		c, err := keys.validToken(token, time.Now())
+		if err != nil {
+			respondUnauthorized(w)
+			return
+		}
+		expires := time.Unix(c.Expires, 0)
+		http.SetCookie(w, &http.Cookie{
+			Name:     authCookieName,
+			Value:    token,
+			Path:     "/",
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   true,
+			// Credentialed cross-origin requests only carry SameSite=None cookies.
+			SameSite: http.SameSiteNoneMode,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{"csrfToken": keys.csrfToken(token), "expiresAt": expires.UTC()})
+	}
+}
+
+// credentialedCORSMiddleware answers requests from origins with the origin itself and
+// Access-Control-Allow-Credentials, so those pages may send cookies; other origins get the
+// usual wildcard headers, under which browsers send no cookies.
+func credentialedCORSMiddleware(origins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(origins, strings.TrimSuffix(origin, "/")) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			corsMiddleware(next).ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieAuthCSRF(t *testing.T) {
+	keys := newAPIKeyStore([]APIKey{{Name: "backend", Key: "secret"}})
+	keys.tokenSecret = accessTokenSecret(Config{AccessTokenSecret: "s"}, "")
+	keys.cookieAuth = true
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/token", tokenHandler(keys, time.Hour))
+	mux.HandleFunc("/auth/cookie", authCookieHandler(keys))
+	mux.HandleFunc("/private/", requireAPIKey(keys, ok))
+	mux.Handle("/", ok)
+	h := credentialedCORSMiddleware([]string{"https://app.kzen.app"})(apiKeyMiddleware(keys)(mux))
+
+	do := func(method, target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"paths":["/objects/users/42/","/private/"],"methods":["GET","PUT"]}`))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/auth/token", "X-API-Key", "secret")
+	var tok struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &tok)
+
+	if rec := do(http.MethodPost, "/auth/cookie", "X-API-Key", "secret"); rec.Code != http.StatusForbidden {
+		t.Errorf("cookie for a key: %d, want 403", rec.Code)
+	}
+	rec = do(http.MethodPost, "/auth/cookie", "Authorization", "Bearer "+tok.Token, "Origin", "https://app.kzen.app")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cookie for a token: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.kzen.app" || rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("allowed origin got Access-Control-Allow-Origin %q", got)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Value != tok.Token {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	var resp struct {
+		CSRFToken string `json:"csrfToken"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	cookie := authCookieName + "=" + tok.Token
+
+	for _, c := range []struct {
+		name, method, target string
+		header               []string
+		want                 int
+	}{
+		{"write without CSRF token", http.MethodPut, "/objects/users/42/a.png", nil, http.StatusForbidden},
+		{"write with a wrong CSRF token", http.MethodPut, "/objects/users/42/a.png", []string{csrfHeader, "nope"}, http.StatusForbidden},
+		{"write with CSRF token", http.MethodPut, "/objects/users/42/a.png", []string{csrfHeader, resp.CSRFToken}, http.StatusOK},
+		{"write out of scope", http.MethodPut, "/objects/users/43/a.png", []string{csrfHeader, resp.CSRFToken}, http.StatusUnauthorized},
+		{"authenticated read", http.MethodGet, "/private/a.png", nil, http.StatusOK},
+	} {
+		if rec := do(c.method, c.target, append([]string{"Cookie", cookie}, c.header...)...); rec.Code != c.want {
+			t.Errorf("%s: %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+
+	// A cookie can't stand in for a token when minting tokens.
+	if rec := do(http.MethodPost, "/auth/token", "Cookie", cookie, csrfHeader, resp.CSRFToken); rec.Code == http.StatusOK {
+		t.Error("token minted with the auth cookie")
+	}
+	if got := do(http.MethodGet, "/", "Origin", "https://evil.example").Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("other origin got Access-Control-Allow-Origin %q, want *", got)
+	}
+}
@@ -0,0 +1,90 @@
+package minioserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kzen-go/golib"
+)
+
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// parseRequestTimeout reads X-Request-Timeout as seconds ("2.5") or a Go duration ("1500ms").
+func parseRequestTimeout(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs <= 0 {
+			return 0, false
+		}
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil && d > 0
+}
+
+// deadlineMiddleware lets clients set the time budget of a request with X-Request-Timeout (capped
+// at max). With a budget the handlers' own fixed timeouts (golib.RequestContext) step aside, so a
+// client can ask for a shorter deadline to fail fast or a longer one for a big export. Whenever MinIO
+// work runs out of time - client budget or server default - a 5xx reply becomes 504 with code
+// deadline_exceeded, so clients can tell a timeout from a server error.
+func deadlineMiddleware(max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			d, fromClient := parseRequestTimeout(r.Header.Get(requestTimeoutHeader))
+			if fromClient {
+				var cancel func()
+				ctx, cancel = context.WithTimeout(ctx, min(d, max))
+				defer cancel()
+			}
+			r = r.WithContext(golib.WithRequestBudget(ctx, fromClient))
+			next.ServeHTTP(&deadlineWriter{ResponseWriter: w, r: r}, r)
+		})
+	}
+}
+
+// deadlineWriter turns a 5xx written after the request budget ran out into a 504, dropping the
+// handler's body.
+type deadlineWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	wrote   bool
+	swallow bool
+}
+
+func (dw *deadlineWriter) WriteHeader(status int) {
+	if dw.wrote {
+		return
+	}
+	dw.wrote = true
+	if status >= 500 && status != http.StatusGatewayTimeout && golib.BudgetExceeded(dw.r.Context()) {
+		dw.swallow = true
+		respondErrorCode(dw.ResponseWriter, "request deadline exceeded", "deadline_exceeded", http.StatusGatewayTimeout)
+		return
+	}
+	dw.ResponseWriter.WriteHeader(status)
+}
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	if !dw.wrote {
+		dw.WriteHeader(http.StatusOK)
+	}
+	if dw.swallow {
+		return len(p), nil
+	}
+	return dw.ResponseWriter.Write(p)
+}
+
+func (dw *deadlineWriter) Flush() {
+	if f, ok := dw.ResponseWriter.(http.Flusher); ok && !dw.swallow {
+		f.Flush()
+	}
+}
+
+func (dw *deadlineWriter) Unwrap() http.ResponseWriter { return dw.ResponseWriter }
@@ -0,0 +1,90 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kzen-go/golib"
+)
+
+func TestParseRequestTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"2":      2 * time.Second,
+		"0.5":    500 * time.Millisecond,
+		"1500ms": 1500 * time.Millisecond,
+		"":       0,
+		"0":      0,
+		"-3":     0,
+		"soon":   0,
+	}
+	for in, want := range cases {
+		if got, _ := parseRequestTimeout(in); got != want {
+			t.Errorf("parseRequestTimeout(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+// minioWork stands in for a handler whose MinIO call takes d and fails with a 500 on timeout.
+func minioWork(d, def time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := golib.RequestContext(r, def)
+		defer cancel()
+		select {
+		case <-time.After(d):
+			w.Write([]byte("ok"))
+		case <-ctx.Done():
+			respondError(w, ctx.Err().Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestDeadlineMiddleware_ClientBudget(t *testing.T) {
+	h := deadlineMiddleware(time.Minute)(minioWork(time.Second, time.Minute))
+	req := httptest.NewRequest(http.MethodGet, "/objects/a", nil)
+	req.Header.Set(requestTimeoutHeader, "20ms")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var body errorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusGatewayTimeout ||
+		body.Code != "deadline_exceeded" {
+		t.Fatalf("response = %d %q (%v)", rec.Code, rec.Body.String(), err)
+	}
+}
+
+func TestDeadlineMiddleware_ClientBudgetOverridesDefault(t *testing.T) {
+	// The handler default (10ms) would time out; the client asked for more.
+	h := deadlineMiddleware(time.Minute)(minioWork(50*time.Millisecond, 10*time.Millisecond))
+	req := httptest.NewRequest(http.MethodGet, "/objects/a", nil)
+	req.Header.Set(requestTimeoutHeader, "5")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Fatalf("response = %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDeadlineMiddleware_ServerDefault(t *testing.T) {
+	h := deadlineMiddleware(time.Minute)(minioWork(time.Second, 20*time.Millisecond))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/objects/a", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", rec.Code)
+	}
+}
+
+func TestDeadlineMiddleware_OtherErrorsUntouched(t *testing.T) {
+	h := deadlineMiddleware(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondError(w, "boom", http.StatusInternalServerError)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/objects/a", nil)
+	req.Header.Set(requestTimeoutHeader, "5")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// permissionCheck is the outcome of trying one S3 action on a bucket: Allowed, Denied (MinIO
+// answered AccessDenied) or neither, when the call failed for another reason (Err).
+type permissionCheck struct {
+	Action  string
+	Allowed bool
+	Denied  bool
+	Err     error
+}
+
+func permissionResult(action string, err error) permissionCheck {
+	switch code := golib.MinioErrorResponse(err).Code; {
+	case err == nil, code == "NoSuchKey":
+		return permissionCheck{Action: action, Allowed: true}
+	case code == "AccessDenied" || code == "AllAccessDisabled":
+		return permissionCheck{Action: action, Denied: true, Err: err}
+	}
+	return permissionCheck{Action: action, Err: err}
+}
+
+// checkPermissions tries ListBucket, PutObject, GetObject and DeleteObject on bucket one by one,
+// with a canary under selfTestPrefix. Without PutObject, GetObject and DeleteObject are tried on a
+// key that does not exist: a NoSuchKey answer (or a successful delete) still shows the permission.
+func checkPermissions(ctx context.Context, client *minio.Client, bucket string) []permissionCheck {
+	key := selfTestPrefix + "permissions-" + uuid.NewString()
+	canary := []byte("kzen-go permission check\n")
+
+	var listErr error
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: selfTestPrefix, MaxKeys: 1}) {
+		listErr = obj.Err
+		break
+	}
+	_, putErr := client.PutObject(ctx, bucket, key, bytes.NewReader(canary), int64(len(canary)),
+		minio.PutObjectOptions{ContentType: "text/plain"})
+	getErr := func() error {
+		obj, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		_, err = io.Copy(io.Discard, obj)
+		return err
+	}()
+	delErr := client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{})
+	return []permissionCheck{
+		permissionResult("ListBucket", listErr),
+		permissionResult("PutObject", putErr),
+		permissionResult("GetObject", getErr),
+		permissionResult("DeleteObject", delErr),
+	}
+}
+
+// servedBuckets lists the buckets cfg serves: the default bucket, the mounts' and the
+// tenants'.
+func servedBuckets(cfg Config) []string {
+	buckets := []string{cfg.Bucket}
+	for _, m := range mergeMounts(defaultMounts(cfg.Bucket), cfg.Mounts) {
+		buckets = append(buckets, m.Bucket)
+	}
+	for _, t := range cfg.Tenants {
+		buckets = append(buckets, t.Bucket)
+	}
+	buckets = slices.DeleteFunc(buckets, func(b string) bool { return b == "" })
+	slices.Sort(buckets)
+	return slices.Compact(buckets)
+}
+
+// logStartupDiagnostics checks the permissions of cfg's credentials on every bucket it serves and
+// logs the result, with a warning naming the actions MinIO denied. Denied reads otherwise only
+// show up as AccessDenied retries (kzen_minio_retries_total) under load.
+func logStartupDiagnostics(cfg Config) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		log.Printf("diagnostics: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, bucket := range servedBuckets(cfg) {
+		var states, denied []string
+		for _, c := range checkPermissions(ctx, client, bucket) {
+			switch {
+			case c.Allowed:
+				states = append(states, c.Action+" ok")
+			case c.Denied:
+				states = append(states, c.Action+" DENIED")
+				denied = append(denied, c.Action)
+			default:
+				states = append(states, c.Action+" unknown ("+c.Err.Error()+")")
+			}
+		}
+		log.Printf("diagnostics: %s: %s", bucket, strings.Join(states, ", "))
+		if len(denied) > 0 {
+			log.Printf("WARNING diagnostics: credentials lack %s on bucket %s; check the user's policy and the bucket policy",
+				strings.Join(denied, ", "), bucket)
+		}
+	}
+}
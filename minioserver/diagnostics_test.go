@@ -0,0 +1,41 @@
+package minioserver
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	client, objects := selfTestS3(t, true)
+	got := map[string]string{}
+	for _, c := range checkPermissions(t.Context(), client, "files") {
+		switch {
+		case c.Allowed:
+			got[c.Action] = "ok"
+		case c.Denied:
+			got[c.Action] = "denied"
+		default:
+			got[c.Action] = c.Err.Error()
+		}
+	}
+	want := map[string]string{"ListBucket": "ok", "PutObject": "denied", "GetObject": "ok", "DeleteObject": "ok"}
+	for action, state := range want {
+		if got[action] != state {
+			t.Errorf("%s = %q, want %q", action, got[action], state)
+		}
+	}
+	if len(objects) != 0 {
+		t.Errorf("canary left behind: %v", objects)
+	}
+}
+
+func TestDiagnosticBuckets(t *testing.T) {
+	cfg := Config{
+		Bucket:  "files",
+		Mounts:  []Mount{{Route: "/media/", Bucket: "media"}, {Route: "/docs/"}},
+		Tenants: map[string]Tenant{"acme": {Bucket: "acme"}, "globex": {}},
+	}
+	if got, want := servedBuckets(cfg), []string{"acme", "files", "kzen-storage", "media"}; !slices.Equal(got, want) {
+		t.Errorf("servedBuckets = %v, want %v", got, want)
+	}
+}
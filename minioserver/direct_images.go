@@ -0,0 +1,146 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+	"kzen-go/kzenimage"
+	"kzen-go/minioserver/media-handlers"
+)
+
+const (
+	// directImageQueue confirmed images wait for a worker; more are reported as not queued.
+	directImageQueue   = 256
+	directImageWorkers = 4
+	// directImageTimeout bounds the work on one image, as for reprocessing.
+	directImageTimeout = reprocessObjectTimeout
+)
+
+// directImageJob is an image confirmed with POST /uploads/confirm, as stat'ed then.
+type directImageJob struct {
+	bucket string
+	info   minio.ObjectInfo
+}
+
+// directImages runs images uploaded straight to MinIO through the pipeline of the image upload
+// endpoints, in the background: the processed image replaces the upload under its key, and with
+// preserveOriginals the upload is kept under mediahandlers.OriginalKey first, as for proxied images.
+type directImages struct {
+	client            *minio.Client
+	pipeline          kzenimage.Options
+	preserveOriginals bool
+	slots             *golib.Semaphore
+	changed           func(bucket, key string)
+	queue             chan directImageJob
+}
+
+// newDirectImages starts the workers of a directImages; call it once per server.
+func newDirectImages(client *minio.Client, pipeline kzenimage.Options, preserveOriginals bool, opts proxyOptions) *directImages {
+	d := &directImages{
+		client:            client,
+		pipeline:          pipeline,
+		preserveOriginals: preserveOriginals,
+		slots:             opts.UploadSlots,
+		changed:           opts.changed,
+		queue:             make(chan directImageJob, directImageQueue),
+	}
+	for range directImageWorkers {
+		go d.run()
+	}
+	return d
+}
+
+// wants reports whether the object info describes is an image the pipeline would handle. SVG is
+// left as uploaded, and so are the preserved originals themselves.
+func (d *directImages) wants(info minio.ObjectInfo) bool {
+	return d != nil && strings.HasPrefix(info.ContentType, "image/") && info.ContentType != "image/svg+xml" &&
+		!strings.HasPrefix(info.Key, mediahandlers.OriginalsPrefix)
+}
+
+// enqueue schedules the image and reports whether there was room in the queue.
+func (d *directImages) enqueue(bucket string, info minio.ObjectInfo) bool {
+	select {
+	case d.queue <- directImageJob{bucket: bucket, info: info}:
+		return true
+	default:
+		metrics.add("kzen_direct_images_total", 1, "result", "dropped")
+		return false
+	}
+}
+
+func (d *directImages) run() {
+	for job := range d.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), directImageTimeout)
+		result, err := d.process(ctx, job.bucket, job.info)
+		cancel()
+		if err != nil {
+			log.Printf("direct image %s/%s: %v", job.bucket, job.info.Key, err)
+			result = "failed"
+		}
+		metrics.add("kzen_direct_images_total", 1, "result", result)
+	}
+}
+
+// process runs the pipeline over the image if it is still the upload that was confirmed, and
+// returns "processed" or "unchanged".
+func (d *directImages) process(ctx context.Context, bucket string, info minio.ObjectInfo) (string, error) {
+	obj, err := d.client.GetObject(ctx, bucket, info.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return "", fmt.Errorf("read: %w", err)
+	}
+	res, err := kzenimage.Process(ctx, data, info.Key, d.pipeline)
+	if err != nil {
+		return "", err
+	}
+	defer res.Close()
+	if !res.Changed {
+		return "unchanged", nil
+	}
+	out, err := io.ReadAll(res)
+	if err != nil {
+		return "", fmt.Errorf("encode: %w", err)
+	}
+
+	if err := d.slots.Acquire(ctx); err != nil {
+		return "", err
+	}
+	defer d.slots.Release()
+	if d.preserveOriginals {
+		if _, err := d.client.PutObject(ctx, bucket, mediahandlers.OriginalKey(info.Key), bytes.NewReader(data), int64(len(data)),
+			minio.PutObjectOptions{ContentType: info.ContentType, UserMetadata: info.UserMetadata}); err != nil {
+			return "", fmt.Errorf("put original: %w", err)
+		}
+	}
+	meta := maps.Clone(info.UserMetadata)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta[uploadConfirmedMeta] = time.Now().UTC().Format(time.RFC3339)
+	putOpts := minio.PutObjectOptions{ContentType: res.ContentType, UserMetadata: meta}
+	// An upload that replaced the image meanwhile wins; it gets its own confirm.
+	putOpts.SetMatchETag(info.ETag)
+	if _, err := d.client.PutObject(ctx, bucket, info.Key, bytes.NewReader(out), int64(len(out)), putOpts); err != nil {
+		return "", fmt.Errorf("put: %w", err)
+	}
+	d.changed(bucket, info.Key)
+	log.Printf("direct image %s/%s: %d -> %d bytes (%s)", bucket, info.Key, len(data), len(out), res.ContentType)
+	return "processed", nil
+}
+
+func init() {
+	metrics.describe("kzen_direct_images_total", "counter", "Confirmed direct image uploads run through the image pipeline, by result (processed, unchanged, failed, dropped).")
+}
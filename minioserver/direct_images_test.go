@@ -0,0 +1,60 @@
+package minioserver
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/kzenimage"
+)
+
+func TestDirectImages_Process(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	big, small := pngOfSize(t, 300, 100), pngOfSize(t, 100, 50)
+	objects["boards/7/big.png"], objects["boards/7/small.png"] = big, small
+	var changed []string
+	d := &directImages{
+		client:            client,
+		pipeline:          kzenimage.Options{MaxEdgePx: 150},
+		preserveOriginals: true,
+		changed:           func(bucket, key string) { changed = append(changed, key) },
+	}
+
+	result, err := d.process(t.Context(), "files", minio.ObjectInfo{Key: "boards/7/big.png", ETag: "abc", ContentType: "image/png"})
+	if err != nil || result != "processed" {
+		t.Fatalf("process: %q, %v", result, err)
+	}
+	img, _, err := image.DecodeConfig(bytes.NewReader(objects["boards/7/big.png"]))
+	if err != nil || img.Width != 150 {
+		t.Errorf("processed image = %+v (%v)", img, err)
+	}
+	if !bytes.Equal(objects["originals/boards/7/big.png"], big) {
+		t.Error("original not preserved")
+	}
+	if len(changed) != 1 || changed[0] != "boards/7/big.png" {
+		t.Errorf("changed %v", changed)
+	}
+
+	result, err = d.process(t.Context(), "files", minio.ObjectInfo{Key: "boards/7/small.png", ETag: "abc", ContentType: "image/png"})
+	if err != nil || result != "unchanged" || !bytes.Equal(objects["boards/7/small.png"], small) {
+		t.Errorf("image that fits: %q, %v", result, err)
+	}
+	if _, ok := objects["originals/boards/7/small.png"]; ok {
+		t.Error("original of an unchanged image stored")
+	}
+
+	for _, info := range []minio.ObjectInfo{
+		{Key: "a.svg", ContentType: "image/svg+xml"},
+		{Key: "a.pdf", ContentType: "application/pdf"},
+		{Key: "originals/a.png", ContentType: "image/png"},
+	} {
+		if d.wants(info) {
+			t.Errorf("wants %+v", info)
+		}
+	}
+	if !d.wants(minio.ObjectInfo{Key: "a.jpg", ContentType: "image/jpeg"}) || (*directImages)(nil).wants(minio.ObjectInfo{Key: "a.jpg", ContentType: "image/jpeg"}) {
+		t.Error("wants of a JPEG")
+	}
+}
@@ -0,0 +1,128 @@
+package minioserver
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+type directoryEntry struct {
+	Name     string
+	Href     string
+	IsDir    bool
+	Size     string
+	Modified string
+	// entry is what the listing said about the object, for sorting.
+	entry debugListEntry
+}
+
+var directoryIndexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Bucket}}/{{.Prefix}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; }
+table { border-collapse: collapse; }
+td, th { padding: .25rem 1rem; text-align: left; }
+td.size { text-align: right; font-variant-numeric: tabular-nums; }
+</style>
+</head>
+<body>
+<h1>{{.Bucket}}/{{.Prefix}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Last modified</th></tr>
+{{if .Prefix}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td class="size">{{.Size}}</td><td>{{.Modified}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// wantsDirectoryIndex reports whether r is a browser request for a "folder" (key ending in "/").
+func wantsDirectoryIndex(r *http.Request, objectKey string) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if objectKey != "" && !strings.HasSuffix(objectKey, "/") {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// directoryIndexHandler renders a simple HTML listing (links, sizes, dates) for browser GETs of a
+// prefix ending in "/", so developers can eyeball bucket contents; all other requests go to next.
+// Folders come first; the listFilter parameters sort and filter the files.
+func directoryIndexHandler(client objectLister, bucket string, pathPrefix string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimPrefix(r.URL.Path, pathPrefix)
+		if !wantsDirectoryIndex(r, prefix) {
+			next(w, r)
+			return
+		}
+
+		filter, err := parseListFilter(r.URL.Query())
+		if err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 10*time.Second)
+		defer cancel()
+
+		var entries []directoryEntry
+		for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+			if obj.Err != nil {
+				log.Printf("directory index %q: %v", prefix, obj.Err)
+				respondStorageError(w, obj.Err, obj.Err.Error())
+				return
+			}
+			name := strings.TrimPrefix(obj.Key, prefix)
+			if name == "" {
+				continue
+			}
+			e := directoryEntry{
+				Name:  name,
+				Href:  (&url.URL{Path: name}).String(),
+				IsDir: strings.HasSuffix(name, "/"),
+				entry: debugListEntry{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified},
+			}
+			if !e.IsDir {
+				if !filter.match(obj.Size, obj.LastModified) {
+					continue
+				}
+				e.Size = humanize.IBytes(uint64(obj.Size))
+				if !obj.LastModified.IsZero() {
+					e.Modified = obj.LastModified.UTC().Format("2006-01-02 15:04:05")
+				}
+			}
+			entries = append(entries, e)
+		}
+		slices.SortStableFunc(entries, func(a, b directoryEntry) int {
+			if a.IsDir != b.IsDir {
+				if a.IsDir {
+					return -1
+				}
+				return 1
+			}
+			if a.IsDir {
+				return strings.Compare(a.Name, b.Name)
+			}
+			return filter.compare(a.entry, b.entry)
+		})
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := directoryIndexTmpl.Execute(w, map[string]any{"Bucket": bucket, "Prefix": prefix, "Entries": entries}); err != nil {
+			log.Printf("directory index %q: render: %v", prefix, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestDirectoryIndex_RendersHTMLForBrowserPrefix(t *testing.T) {
+	mock := &mockObjectLister{
+		objects: []minio.ObjectInfo{
+			{Key: "photos/sub/"},
+			{Key: "photos/a.jpg", Size: 2048},
+			{Key: "other/b.jpg"},
+		},
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called for a browser prefix request")
+	}
+	handler := directoryIndexHandler(mock, "test-bucket", "/objects/", next)
+
+	req := httptest.NewRequest(http.MethodGet, "/objects/photos/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("got Content-Type %q, want text/html", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`href="sub/"`, `href="a.jpg"`, "2.0 KiB", `href="../"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "b.jpg") {
+		t.Error("listing must only include the requested prefix")
+	}
+}
+
+func TestDirectoryIndex_PassesThroughObjectAndAPIRequests(t *testing.T) {
+	handler := directoryIndexHandler(&mockObjectLister{}, "test-bucket", "/objects/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, tc := range []struct{ path, accept string }{
+		{"/objects/photos/a.jpg", "text/html"},
+		{"/objects/photos/", "application/json"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Accept", tc.accept)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("%s (Accept %s): got status %d, want pass-through", tc.path, tc.accept, rec.Code)
+		}
+	}
+}
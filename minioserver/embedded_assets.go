@@ -0,0 +1,72 @@
+package minioserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// embeddedAssetsRoute serves the fallback images built into the binary.
+const embeddedAssetsRoute = "/static/"
+
+// embeddedFS holds fallback images (placeholder.png, broken-image.png, avatar.png) the UI can
+// show when storage is unreachable, as they are served without MinIO.
+//
+//go:embed static
+var embeddedFS embed.FS
+
+type embeddedAsset struct {
+	data        []byte
+	etag        string
+	contentType string
+}
+
+// embeddedAssets are the files of embeddedFS by name, with their ETags computed once.
+var embeddedAssets = loadEmbeddedAssets()
+
+func loadEmbeddedAssets() map[string]embeddedAsset {
+	assets := map[string]embeddedAsset{}
+	fs.WalkDir(embeddedFS, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := embeddedFS.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		assets[strings.TrimPrefix(name, "static/")] = embeddedAsset{
+			data:        data,
+			etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+			contentType: mime.TypeByExtension(path.Ext(name)),
+		}
+		return nil
+	})
+	return assets
+}
+
+// embeddedAssetsHandler serves GET/HEAD /static/<name> from the binary, with a day of caching and
+// ETag revalidation. The assets change only with a new build, so browsers may keep them.
+func embeddedAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	asset, ok := embeddedAssets[strings.TrimPrefix(r.URL.Path, embeddedAssetsRoute)]
+	if !ok {
+		respondError(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", asset.contentType)
+	w.Header().Set("ETag", asset.etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(asset.data))
+}
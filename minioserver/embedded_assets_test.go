@@ -0,0 +1,34 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmbeddedAssetsHandler(t *testing.T) {
+	for _, name := range []string{"placeholder.png", "broken-image.png", "avatar.png"} {
+		rec := httptest.NewRecorder()
+		embeddedAssetsHandler(rec, httptest.NewRequest(http.MethodGet, "/static/"+name, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" || rec.Body.Len() == 0 {
+			t.Errorf("%s: got %d %q (%d bytes)", name, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Len())
+		}
+	}
+
+	etag := embeddedAssets["avatar.png"].etag
+	req := httptest.NewRequest(http.MethodGet, "/static/avatar.png", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec := httptest.NewRecorder()
+	embeddedAssetsHandler(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: got %d, want 304", rec.Code)
+	}
+
+	for _, target := range []string{"/static/", "/static/missing.png", "/static/../server.go"} {
+		rec := httptest.NewRecorder()
+		embeddedAssetsHandler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package minioserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiVersionHeader = "X-API-Version"
+	// latestAPIVersion is the newest response shape. Version 1 is the original, per-handler JSON.
+	latestAPIVersion = 2
+)
+
+// apiEnvelope is the version 2 response body: data on success, error otherwise.
+type apiEnvelope struct {
+	APIVersion int             `json:"apiVersion"`
+	OK         bool            `json:"ok"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Error      *apiError       `json:"error,omitempty"`
+}
+
+type apiError struct {
+	// Code is the errorBody code, or derived from the status ("not_found").
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details is the handler's original JSON error body, when it had one.
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// requestAPIVersion returns the version asked for by a "/v2/..." path or the X-API-Version header
+// and the path with any version prefix removed. Unknown or missing versions mean 1. Only /v2/ is
+// treated as a version prefix: /v1/... routes predate versioning and are served as-is.
+func requestAPIVersion(r *http.Request) (int, string) {
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/v2/"); ok {
+		return 2, "/" + rest
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(r.Header.Get(apiVersionHeader))); err == nil && v >= 1 && v <= latestAPIVersion {
+		return v, r.URL.Path
+	}
+	return 1, r.URL.Path
+}
+
+type originalURLKey struct{}
+
+// originalURL returns the URL r was received on, before apiVersionMiddleware removed a /v2/
+// prefix. Signatures and token path scopes are checked against it, since that is the path the
+// client signed or was granted.
+func originalURL(r *http.Request) *url.URL {
+	if u, ok := r.Context().Value(originalURLKey{}).(*url.URL); ok {
+		return u
+	}
+	return r.URL
+}
+
+// apiVersionMiddleware serves versioned responses. Version 2 (/v2/ routes or X-API-Version: 2) wraps
+// JSON bodies and error responses in apiEnvelope; version 1 keeps each handler's own shape. For any
+// version, JSON bodies are transcoded to msgpack or CBOR when Accept asks for it. Object bodies,
+// streams and other non-JSON responses pass through untouched, and so does every successful GET or
+// HEAD under objectRoutes: a stored application/json object is served as stored, not buffered.
+func apiVersionMiddleware(objectRoutes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version, p := requestAPIVersion(r)
+			format := negotiateFormat(r.Header.Get("Accept"))
+			w.Header().Set(apiVersionHeader, strconv.Itoa(version))
+			if version == 1 && format == formatJSON {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if p != r.URL.Path {
+				r2 := r.Clone(context.WithValue(r.Context(), originalURLKey{}, r.URL))
+				r2.URL.Path = p
+				r2.URL.RawPath = ""
+				r = r2
+			}
+			ew := &envelopeWriter{ResponseWriter: w, version: version, format: format, head: r.Method == http.MethodHead}
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				for _, route := range objectRoutes {
+					if strings.HasPrefix(r.URL.Path, route) {
+						ew.objectRead = true
+						break
+					}
+				}
+			}
+			defer ew.finish()
+			next.ServeHTTP(ew, r)
+		})
+	}
+}
+
+// envelopeWriter decides at WriteHeader whether a response is rewritten (JSON, or a plain-text error
+// under version 2) and then buffers it; everything else is passed straight through.
+type envelopeWriter struct {
+	http.ResponseWriter
+	version int
+	format  wireFormat
+	head    bool
+	// objectRead marks a read of a stored object: only its errors are rewritten.
+	objectRead bool
+
+	status    int
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (ew *envelopeWriter) WriteHeader(status int) {
+	if ew.status != 0 {
+		return
+	}
+	ew.status = status
+	ct := ew.Header().Get("Content-Type")
+	isJSON := strings.HasPrefix(ct, "application/json")
+	plainError := ew.version >= 2 && status >= 400 && (ct == "" || strings.HasPrefix(ct, "text/plain"))
+	bodyless := ew.head || status == http.StatusNoContent || status == http.StatusNotModified || status < 200
+	stored := ew.objectRead && status < 400
+	ew.buffering = !bodyless && !stored && (isJSON || plainError)
+	if !ew.buffering {
+		ew.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (ew *envelopeWriter) Write(p []byte) (int, error) {
+	if ew.status == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.buffering {
+		return ew.buf.Write(p)
+	}
+	return ew.ResponseWriter.Write(p)
+}
+
+// Flush is a no-op while buffering: the rewritten body is only complete at the end.
+func (ew *envelopeWriter) Flush() {
+	if ew.buffering {
+		return
+	}
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (ew *envelopeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := ew.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack not supported")
+}
+
+func (ew *envelopeWriter) Unwrap() http.ResponseWriter { return ew.ResponseWriter }
+
+func (ew *envelopeWriter) finish() {
+	if !ew.buffering {
+		return
+	}
+	body := ew.buf.Bytes()
+	if ew.version >= 2 {
+		body = envelopeBody(ew.status, ew.Header().Get("Content-Type"), body)
+	}
+	out, err := transcodeJSON(body, ew.format)
+	if err != nil {
+		// Not valid JSON after all; send what the handler wrote.
+		log.Printf("response transcode: %v", err)
+		out = body
+	} else {
+		ew.Header().Set("Content-Type", ew.format.contentType())
+	}
+	h := ew.Header()
+	h.Del("Content-Length")
+	h.Add("Vary", "Accept")
+	h.Add("Vary", apiVersionHeader)
+	ew.ResponseWriter.WriteHeader(ew.status)
+	ew.ResponseWriter.Write(out)
+}
+
+// envelopeBody wraps a handler's response body in apiEnvelope.
+func envelopeBody(status int, contentType string, body []byte) []byte {
+	env := apiEnvelope{APIVersion: latestAPIVersion, OK: status < 400}
+	trimmed := bytes.TrimSpace(body)
+	isJSON := strings.HasPrefix(contentType, "application/json") && json.Valid(trimmed)
+	if env.OK {
+		if isJSON {
+			env.Data = json.RawMessage(trimmed)
+		} else {
+			env.Data, _ = json.Marshal(string(trimmed))
+		}
+	} else {
+		e := &apiError{Code: statusCode(status), Message: strings.TrimSpace(string(trimmed))}
+		if isJSON {
+			e.Details = json.RawMessage(trimmed)
+			e.Message = jsonErrorMessage(trimmed)
+			if code := jsonErrorCode(trimmed); code != "" {
+				e.Code = code
+			}
+		}
+		if e.Message == "" {
+			e.Message = http.StatusText(status)
+		}
+		env.Error = e
+	}
+	out, _ := json.Marshal(env)
+	return out
+}
+
+// jsonErrorCode returns the "code" of an errorBody, "" for other bodies.
+func jsonErrorCode(body []byte) string {
+	var eb errorBody
+	if json.Unmarshal(body, &eb) != nil {
+		return ""
+	}
+	return eb.Code
+}
+
+// jsonErrorMessage pulls the human-readable message out of the error bodies handlers write today:
+// {"error": "..."}, {"msg": "..."} or {"message": "..."}.
+func jsonErrorMessage(body []byte) string {
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	for _, k := range []string{"error", "message", "msg"} {
+		if s, ok := fields[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package minioserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWireFormats_Transcode(t *testing.T) {
+	in := []byte(`{"b":[1,-2,300,1.5],"a":"hi","n":null,"t":true}`)
+
+	mp, err := transcodeJSON(in, formatMsgpack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMP := []byte{0x84,
+		0xa1, 'a', 0xa2, 'h', 'i',
+		0xa1, 'b', 0x94, 0x01, 0xfe, 0xd1, 0x01, 0x2c, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xa1, 'n', 0xc0,
+		0xa1, 't', 0xc3}
+	if !bytes.Equal(mp, wantMP) {
+		t.Errorf("msgpack = % x\nwant      % x", mp, wantMP)
+	}
+
+	cb, err := transcodeJSON(in, formatCBOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCBOR := []byte{0xa4,
+		0x61, 'a', 0x62, 'h', 'i',
+		0x61, 'b', 0x84, 0x01, 0x21, 0x19, 0x01, 0x2c, 0xfb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x61, 'n', 0xf6,
+		0x61, 't', 0xf5}
+	if !bytes.Equal(cb, wantCBOR) {
+		t.Errorf("cbor = % x\nwant   % x", cb, wantCBOR)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := map[string]wireFormat{
+		"":                                   formatJSON,
+		"*/*":                                formatJSON,
+		"application/json":                   formatJSON,
+		"application/cbor":                   formatCBOR,
+		"text/html, application/x-msgpack":   formatMsgpack,
+		"application/vnd.msgpack;q=0.9, */*": formatMsgpack,
+	}
+	for accept, want := range cases {
+		if got := negotiateFormat(accept); got != want {
+			t.Errorf("negotiateFormat(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestAPIVersionMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/thing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"key": "a.jpg"})
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "object not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("/raw", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("PNG"))
+	})
+	mux.HandleFunc("/objects/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/objects/missing.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"stored":true}`))
+	})
+	h := apiVersionMiddleware([]string{"/objects/"})(mux)
+
+	serve := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v[0])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("/thing", nil); rec.Body.String() != "{\"key\":\"a.jpg\"}\n" || rec.Header().Get(apiVersionHeader) != "1" {
+		t.Errorf("v1 body changed: %q (version %q)", rec.Body.String(), rec.Header().Get(apiVersionHeader))
+	}
+
+	var env apiEnvelope
+	rec := serve("/v2/thing", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || !env.OK || string(env.Data) != `{"key":"a.jpg"}` {
+		t.Errorf("v2 success = %q (%v)", rec.Body.String(), err)
+	}
+
+	rec = serve("/missing", http.Header{apiVersionHeader: {"2"}})
+	env = apiEnvelope{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || rec.Code != 404 || env.OK || env.Error == nil ||
+		env.Error.Code != "not_found" || env.Error.Message != "object not found" {
+		t.Errorf("v2 error = %d %q (%v)", rec.Code, rec.Body.String(), err)
+	}
+
+	if rec := serve("/v2/raw", nil); rec.Body.String() != "PNG" || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("raw body rewritten: %q", rec.Body.String())
+	}
+
+	if rec := serve("/v2/objects/a.json", nil); rec.Body.String() != `{"stored":true}` {
+		t.Errorf("stored JSON object wrapped: %q", rec.Body.String())
+	}
+	env = apiEnvelope{}
+	if rec := serve("/v2/objects/missing.json", nil); json.Unmarshal(rec.Body.Bytes(), &env) != nil || env.Error == nil {
+		t.Errorf("object route error not wrapped: %q", rec.Body.String())
+	}
+
+	rec = serve("/thing", http.Header{"Accept": {"application/cbor"}})
+	if rec.Header().Get("Content-Type") != "application/cbor" || !bytes.HasPrefix(rec.Body.Bytes(), []byte{0xa1, 0x63, 'k', 'e', 'y'}) {
+		t.Errorf("v1 cbor = %q % x", rec.Header().Get("Content-Type"), rec.Body.Bytes())
+	}
+}
+
+func TestJSONErrorMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad input", http.StatusBadRequest)
+	})
+	mux.HandleFunc("/coded", func(w http.ResponseWriter, r *http.Request) {
+		respondErrorCode(w, "upload incomplete", "upload_incomplete", http.StatusConflict)
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	h := apiVersionMiddleware(nil)(jsonErrorMiddleware(recoveryMiddleware(mux)))
+
+	cases := []struct {
+		path   string
+		status int
+		code   string
+		msg    string
+	}{
+		{"/plain", 400, "bad_request", "bad input"},
+		{"/coded", 409, "upload_incomplete", "upload incomplete"},
+		{"/panic", 500, "internal_error", "internal server error"},
+		{"/nope", 404, "not_found", "404 page not found"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+		var body errorBody
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != c.status ||
+			body.Code != c.code || body.Error != c.msg || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s = %d %q (%v)", c.path, rec.Code, rec.Body.String(), err)
+		}
+	}
+
+	// Version 2 keeps the handler's code in the envelope.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/coded", nil))
+	var env apiEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Error == nil || env.Error.Code != "upload_incomplete" {
+		t.Errorf("v2 coded error = %q (%v)", rec.Body.String(), err)
+	}
+}
+
+func TestAPIVersionMiddleware_AuthSeesOriginalPath(t *testing.T) {
+	store := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	h := apiVersionMiddleware(nil)(apiKeyMiddleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/objects/a" {
+			t.Errorf("handler path = %q", r.URL.Path)
+		}
+	})))
+
+	r := httptest.NewRequest(http.MethodDelete, "/v2/objects/a", nil)
+	SignRequest(r, "web", "secret", nil, time.Now())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("request signed for /v2/objects/a: %d %s", rec.Code, rec.Body)
+	}
+
+	// A signature for the unversioned path doesn't cover the /v2/ one.
+	r = httptest.NewRequest(http.MethodDelete, "/objects/a", nil)
+	SignRequest(r, "web", "secret", nil, time.Now())
+	r.URL.Path = "/v2/objects/a"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("request signed for /objects/a sent to /v2/objects/a: %d", rec.Code)
+	}
+}
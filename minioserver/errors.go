@@ -0,0 +1,137 @@
+package minioserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kzen-go/golib"
+)
+
+// errorBody is the JSON body of every 4xx/5xx response: a human-readable message and a stable
+// machine-readable code.
+type errorBody struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	// RequestID is set on 500s so users can quote it and operators can find the logged stack.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// statusCode turns a status into the default error code, e.g. 413 -> "request_entity_too_large".
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "http_" + strconv.Itoa(status)
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.NewReplacer("-", " ", "'", "").Replace(text)), " ", "_")
+}
+
+// respondError replies with a JSON errorBody whose code is derived from status. It takes the same
+// arguments as http.Error.
+func respondError(w http.ResponseWriter, msg string, status int) {
+	respondErrorCode(w, msg, statusCode(status), status)
+}
+
+// respondErrorCode is respondError with an explicit code, for errors clients need to tell apart
+// from others with the same status.
+func respondErrorCode(w http.ResponseWriter, msg, code string, status int) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	body := errorBody{Error: msg, Code: code}
+	if status >= 500 {
+		body.RequestID = w.Header().Get(requestIDHeader)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// storageErrorMessages are the client-facing messages for classified MinIO errors (golib.MinioStatus).
+var storageErrorMessages = map[int]string{
+	http.StatusNotFound:           "object not found",
+	http.StatusForbidden:          "access to object denied",
+	http.StatusConflict:           "object is locked or busy",
+	http.StatusPreconditionFailed: "object changed during the request",
+	http.StatusServiceUnavailable: "storage unavailable, retry later",
+}
+
+// respondStorageError replies to a failed MinIO call with the status golib.MinioStatus assigns to
+// err; msg is used for unclassified errors (500). A 503 suggests retrying after a second.
+func respondStorageError(w http.ResponseWriter, err error, msg string) {
+	status := golib.MinioStatus(err)
+	if m, ok := storageErrorMessages[status]; ok {
+		msg = m
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	respondError(w, msg, status)
+}
+
+// jsonErrorMiddleware makes every error response JSON: plain-text 4xx/5xx bodies (http.Error in
+// handlers outside this package, net/http's own 404/405) are rewritten into errorBody. Panics are
+// handled by recoveryMiddleware inside it.
+func jsonErrorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jw := &jsonErrorWriter{ResponseWriter: w, head: r.Method == http.MethodHead}
+		next.ServeHTTP(jw, r)
+		jw.finish()
+	})
+}
+
+// jsonErrorWriter buffers plain-text error bodies so they can be rewritten as JSON; all other
+// responses pass straight through.
+type jsonErrorWriter struct {
+	http.ResponseWriter
+	head      bool
+	status    int
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (jw *jsonErrorWriter) WriteHeader(status int) {
+	if jw.status != 0 {
+		return
+	}
+	jw.status = status
+	ct := jw.Header().Get("Content-Type")
+	jw.buffering = status >= 400 && !jw.head && (ct == "" || strings.HasPrefix(ct, "text/plain"))
+	if !jw.buffering {
+		jw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (jw *jsonErrorWriter) Write(p []byte) (int, error) {
+	if jw.status == 0 {
+		jw.WriteHeader(http.StatusOK)
+	}
+	if jw.buffering {
+		return jw.buf.Write(p)
+	}
+	return jw.ResponseWriter.Write(p)
+}
+
+func (jw *jsonErrorWriter) Flush() {
+	if jw.buffering {
+		return
+	}
+	if f, ok := jw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (jw *jsonErrorWriter) Unwrap() http.ResponseWriter { return jw.ResponseWriter }
+
+func (jw *jsonErrorWriter) finish() {
+	if !jw.buffering {
+		return
+	}
+	msg := strings.TrimSpace(jw.buf.String())
+	if msg == "" {
+		msg = http.StatusText(jw.status)
+	}
+	respondError(jw.ResponseWriter, msg, jw.status)
+}
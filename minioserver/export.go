@@ -0,0 +1,253 @@
+package minioserver
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"kzen-go/golib"
+)
+
+// exportRequest describes what to export (one key, or every object under prefix as a tar.gz)
+// and where to send it (exactly one of HTTP or S3).
+type exportRequest struct {
+	Key    string        `json:"key,omitempty"`
+	Prefix string        `json:"prefix,omitempty"`
+	HTTP   *exportHTTP   `json:"http,omitempty"`
+	S3     *exportS3Dest `json:"s3,omitempty"`
+}
+
+type exportHTTP struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"` // PUT (default) or POST
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type exportS3Dest struct {
+	Endpoint  string `json:"endpoint"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	UseSSL    bool   `json:"useSSL"`
+}
+
+func (r *exportRequest) validate() error {
+	r.Key = strings.TrimSpace(r.Key)
+	r.Prefix = strings.TrimSpace(r.Prefix)
+	if (r.Key == "") == (r.Prefix == "") {
+		return fmt.Errorf("exactly one of key or prefix required")
+	}
+	if (r.HTTP == nil) == (r.S3 == nil) {
+		return fmt.Errorf("exactly one of http or s3 destination required")
+	}
+	if r.HTTP != nil {
+		u, err := url.Parse(r.HTTP.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("http.url must be an absolute http(s) URL")
+		}
+		r.HTTP.Method = strings.ToUpper(strings.TrimSpace(r.HTTP.Method))
+		if r.HTTP.Method == "" {
+			r.HTTP.Method = http.MethodPut
+		}
+		if r.HTTP.Method != http.MethodPut && r.HTTP.Method != http.MethodPost {
+			return fmt.Errorf("http.method must be PUT or POST")
+		}
+	}
+	if r.S3 != nil {
+		if r.S3.Endpoint == "" || r.S3.Bucket == "" || r.S3.Key == "" {
+			return fmt.Errorf("s3.endpoint, s3.bucket and s3.key required")
+		}
+	}
+	return nil
+}
+
+// exportHandler streams an object, or a tar.gz of a prefix, to a remote HTTP endpoint or another
+// S3-compatible bucket with caller-provided credentials (user data export / GDPR requests).
+// Destinations must resolve to public addresses, like POST /fetch. The proxy's own keys (see
+// hiddenKey) are not exported.
+func exportHandler(client *minio.Client, bucket string, opts proxyOptions) http.HandlerFunc {
+	transport := newPublicOnlyTransport()
+	httpClient := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse // the streamed body can't be replayed
+		},
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req exportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := req.validate(); err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Minute)
+		defer cancel()
+
+		var body io.ReadCloser
+		var size int64 = -1
+		contentType := "application/gzip"
+		if req.Key != "" && hiddenKey(opts, bucket, req.Key) {
+			respondError(w, "object not found", http.StatusNotFound)
+			return
+		}
+		if req.Key != "" {
+			info, err := client.StatObject(ctx, bucket, req.Key, minio.StatObjectOptions{})
+			if err != nil {
+				log.Printf("export stat %q: %v", req.Key, err)
+				respondStorageError(w, err, "failed to get object info")
+				return
+			}
+			obj, err := client.GetObject(ctx, bucket, req.Key, minio.GetObjectOptions{})
+			if err != nil {
+				respondStorageError(w, err, "failed to open object")
+				return
+			}
+			body, size, contentType = obj, info.Size, info.ContentType
+		} else {
+			body = streamPrefixArchive(ctx, client, opts, bucket, req.Prefix)
+		}
+		defer body.Close()
+
+		var sent int64
+		var err error
+		if req.HTTP != nil {
+			sent, err = exportToHTTP(ctx, httpClient, req.HTTP, body, size, contentType)
+		} else {
+			sent, err = exportToS3(ctx, transport, req.S3, body, size, contentType)
+		}
+		if err != nil {
+			log.Printf("export key=%q prefix=%q: %v", req.Key, req.Prefix, err)
+			respondError(w, "export failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "bytes": sent})
+	}
+}
+
+func exportToHTTP(ctx context.Context, httpClient *http.Client, dest *exportHTTP, body io.Reader, size int64, contentType string) (int64, error) {
+	counter := &countingReader{r: body}
+	req, err := http.NewRequestWithContext(ctx, dest.Method, dest.URL, counter)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range dest.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return counter.n, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return counter.n, fmt.Errorf("destination returned %d", resp.StatusCode)
+	}
+	return counter.n, nil
+}
+
+func exportToS3(ctx context.Context, transport http.RoundTripper, dest *exportS3Dest, body io.Reader, size int64, contentType string) (int64, error) {
+	endpoint := strings.TrimPrefix(strings.TrimPrefix(dest.Endpoint, "https://"), "http://")
+	dst, err := minio.New(endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(dest.AccessKey, dest.SecretKey, ""),
+		Secure:    dest.UseSSL,
+		Region:    dest.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return 0, err
+	}
+	info, err := dst.PutObject(ctx, dest.Bucket, dest.Key, body, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// streamPrefixArchive returns a reader producing a tar.gz of every object under prefix but the
+// hidden ones.
+// Entries are named relative to prefix. Errors abort the stream so the receiver sees a truncated archive.
+func streamPrefixArchive(ctx context.Context, client *minio.Client, opts proxyOptions, bucket, prefix string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		tw := tar.NewWriter(gz)
+		err := func() error {
+			for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+				if obj.Err != nil {
+					return obj.Err
+				}
+				if strings.HasSuffix(obj.Key, "/") || hiddenKey(opts, bucket, obj.Key) {
+					continue
+				}
+				if err := writeTarEntry(ctx, tw, client, bucket, obj, path.Clean(strings.TrimPrefix(obj.Key, prefix))); err != nil {
+					return err
+				}
+			}
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			return gz.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+func writeTarEntry(ctx context.Context, tw *tar.Writer, client *minio.Client, bucket string, obj minio.ObjectInfo, name string) error {
+	src, err := client.GetObject(ctx, bucket, obj.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("get %q: %w", obj.Key, err)
+	}
+	defer src.Close()
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    strings.TrimPrefix(name, "/"),
+		Mode:    0o644,
+		Size:    obj.Size,
+		ModTime: obj.LastModified,
+	}); err != nil {
+		return err
+	}
+	if _, err := copyPooled(tw, src); err != nil {
+		return fmt.Errorf("copy %q: %w", obj.Key, err)
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,151 @@
+package minioserver
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportRequest_Validate(t *testing.T) {
+	dest := &exportHTTP{URL: "https://example.com/upload"}
+	s3 := &exportS3Dest{Endpoint: "s3.example.com", Bucket: "b", Key: "k"}
+	for name, req := range map[string]exportRequest{
+		"no source":        {HTTP: dest},
+		"key and prefix":   {Key: "a", Prefix: "p/", HTTP: dest},
+		"no destination":   {Key: "a"},
+		"two destinations": {Key: "a", HTTP: dest, S3: s3},
+		"relative url":     {Key: "a", HTTP: &exportHTTP{URL: "/upload"}},
+		"file url":         {Key: "a", HTTP: &exportHTTP{URL: "file:///etc/passwd"}},
+		"gopher url":       {Key: "a", HTTP: &exportHTTP{URL: "gopher://example.com/"}},
+		"delete method":    {Key: "a", HTTP: &exportHTTP{URL: "https://example.com/", Method: "DELETE"}},
+		"s3 without key":   {Key: "a", S3: &exportS3Dest{Endpoint: "s3.example.com", Bucket: "b"}},
+	} {
+		if err := req.validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	req := exportRequest{Key: " a ", HTTP: &exportHTTP{URL: "https://example.com/upload", Method: "post"}}
+	if err := req.validate(); err != nil || req.Key != "a" || req.HTTP.Method != http.MethodPost {
+		t.Errorf("valid request: %v, %+v", err, req.HTTP)
+	}
+	req = exportRequest{Prefix: "p/", HTTP: &exportHTTP{URL: "https://example.com/upload"}}
+	if err := req.validate(); err != nil || req.HTTP.Method != http.MethodPut {
+		t.Errorf("default method: %v, %q", err, req.HTTP.Method)
+	}
+}
+
+// The destinations are only reached through newPublicOnlyTransport, so a loopback listener (or
+// anything else internal) is refused when it is dialed.
+func TestExport_RefusesInternalDestinations(t *testing.T) {
+	reached := false
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+	defer internal.Close()
+	ctx := context.Background()
+	transport := newPublicOnlyTransport()
+
+	_, err := exportToHTTP(ctx, &http.Client{Transport: transport}, &exportHTTP{URL: internal.URL, Method: http.MethodPut},
+		strings.NewReader("data"), 4, "text/plain")
+	if !errors.Is(err, errFetchBlockedAddress) {
+		t.Errorf("http export to %s: %v, want errFetchBlockedAddress", internal.URL, err)
+	}
+	dest := &exportS3Dest{Endpoint: strings.TrimPrefix(internal.URL, "http://"), AccessKey: "ak", SecretKey: "sk", Region: "us-east-1", Bucket: "bkt", Key: "k"}
+	// minio-go retries failed dials, so give up before its backoff adds up.
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	if _, err := exportToS3(ctx, transport, dest, strings.NewReader("data"), 4, "text/plain"); err == nil {
+		t.Errorf("s3 export to %s succeeded", dest.Endpoint)
+	}
+	if reached {
+		t.Error("internal destination was reached")
+	}
+}
+
+func TestExportToHTTP(t *testing.T) {
+	var got, auth string
+	status := http.StatusOK
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got, auth = r.Method+" "+r.Header.Get("Content-Type")+" "+string(body), r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer dest.Close()
+
+	req := &exportHTTP{URL: dest.URL, Method: http.MethodPost, Headers: map[string]string{"Authorization": "Bearer t"}}
+	n, err := exportToHTTP(context.Background(), dest.Client(), req, strings.NewReader("hello"), 5, "text/plain")
+	if err != nil || n != 5 || got != "POST text/plain hello" || auth != "Bearer t" {
+		t.Errorf("export: %d, %v; destination saw %q, auth %q", n, err, got, auth)
+	}
+	status = http.StatusForbidden
+	if _, err := exportToHTTP(context.Background(), dest.Client(), req, strings.NewReader("hello"), 5, ""); err == nil {
+		t.Error("403 from the destination was not an error")
+	}
+}
+
+func TestStreamPrefixArchive(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["users/42/a.txt"] = []byte("alpha")
+	objects["users/42/photos/b.jpg"] = []byte("bravo")
+	objects["users/42/photos/"] = nil
+	objects["users/420/c.txt"] = []byte("not exported")
+
+	archive := streamPrefixArchive(context.Background(), client, proxyOptions{}, "files", "users/42/")
+	defer archive.Close()
+	entries := archiveEntries(t, archive)
+	if len(entries) != 2 || entries["a.txt"] != "alpha" || entries["photos/b.jpg"] != "bravo" {
+		t.Errorf("archive entries = %v", entries)
+	}
+}
+
+// archiveEntries reads a tar.gz into a map of entry names to contents.
+func archiveEntries(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Size != int64(len(data)) {
+			t.Errorf("%s: header size %d, %d bytes", hdr.Name, hdr.Size, len(data))
+		}
+		entries[hdr.Name] = string(data)
+	}
+}
+
+// Hidden keys are refused by key and left out of a prefix archive.
+func TestExport_RefusesHiddenKeys(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["a.txt"] = []byte("alpha")
+	objects["quarantine/b.exe"] = []byte("flagged")
+	objects["trash/c.txt"] = []byte("deleted")
+
+	rec := httptest.NewRecorder()
+	exportHandler(client, "files", proxyOptions{})(rec, httptest.NewRequest(http.MethodPost, "/export",
+		strings.NewReader(`{"key":"quarantine/b.exe","http":{"url":"https://example.com/upload"}}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("export of a quarantined key: %d %s", rec.Code, rec.Body)
+	}
+
+	archive := streamPrefixArchive(context.Background(), client, proxyOptions{}, "files", "")
+	defer archive.Close()
+	if entries := archiveEntries(t, archive); len(entries) != 1 || entries["a.txt"] != "alpha" {
+		t.Errorf("archive of the bucket = %v", entries)
+	}
+}
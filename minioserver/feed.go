@@ -0,0 +1,206 @@
+package minioserver
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	feedDefaultEntries = 50
+	feedMaxEntries     = 500
+	// feedMaxListed objects under the prefix are looked at at most; finding the newest needs the
+	// whole listing.
+	feedMaxListed = 100000
+)
+
+// atomFeed and atomEntry are the parts of RFC 4287 GET /feed writes.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+// feedObjectURL returns the path key is served at by the first objects mount of mounts for bucket
+// whose prefix holds it, or "" if no mount serves it. Mounts bound to another host are skipped.
+func feedObjectURL(mounts []Mount, host, bucket, key string) string {
+	for _, m := range mounts {
+		if m.Type != MountTypeObjects || m.Bucket != bucket || !strings.HasPrefix(key, m.Prefix) {
+			continue
+		}
+		if m.Host != "" && m.Host != host {
+			continue
+		}
+		return m.Route + (&url.URL{Path: strings.TrimPrefix(key, m.Prefix)}).EscapedPath()
+	}
+	return ""
+}
+
+// feedBaseURL is the scheme and host the request came in on, for the absolute links feed
+// readers need.
+func feedBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// feedHandler serves GET /feed?prefix=&bucket=&limit=: the limit (default 50, at most 500) most
+// recently modified objects under prefix as an Atom feed, newest first, so new uploads to a shared
+// prefix can be followed in feed readers and automation. Each entry is titled with the file name
+// and links to the object, as an enclosure with its size and type, through the objects mount of
+// mounts serving it; objects no mount serves are left out, and so are folder markers and the keys
+// the object routes hide. The bucket must be one an objects mount serves (default defaultBucket).
+// Last-Modified is the newest entry's time, and If-Modified-Since is answered with 304.
+func feedHandler(client objectLister, defaultBucket string, mounts []Mount, opts proxyOptions) http.HandlerFunc {
+	mounts = slices.Clone(mounts)
+	for i := range mounts {
+		if mounts[i].Bucket == "" {
+			mounts[i].Bucket = defaultBucket
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		bucket := cmp.Or(q.Get("bucket"), defaultBucket)
+		if !slices.ContainsFunc(mounts, func(m Mount) bool { return m.Type == MountTypeObjects && m.Bucket == bucket }) {
+			respondError(w, "unknown bucket", http.StatusBadRequest)
+			return
+		}
+		prefix := strings.TrimPrefix(q.Get("prefix"), "/")
+		limit := feedDefaultEntries
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > feedMaxEntries {
+				respondError(w, fmt.Sprintf("limit must be 1 to %d", feedMaxEntries), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		ctx, cancel := golib.RequestContext(r, 2*time.Minute)
+		defer cancel()
+
+		newest := func(a, b minio.ObjectInfo) int {
+			return cmp.Or(b.LastModified.Compare(a.LastModified), strings.Compare(a.Key, b.Key))
+		}
+		var objects []minio.ObjectInfo
+		listed := 0
+		for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if obj.Err != nil {
+				log.Printf("feed %s/%s: %v", bucket, prefix, obj.Err)
+				respondStorageError(w, obj.Err, "failed to list objects")
+				return
+			}
+			if listed++; listed > feedMaxListed {
+				respondError(w, fmt.Sprintf("more than %d objects under the prefix; narrow it", feedMaxListed), http.StatusBadRequest)
+				return
+			}
+			if strings.HasSuffix(obj.Key, "/") || hiddenKey(opts, bucket, obj.Key) ||
+				feedObjectURL(mounts, host, bucket, obj.Key) == "" {
+				continue
+			}
+			objects = append(objects, obj)
+			// Keep the newest limit objects, trimming in batches rather than on every append.
+			if len(objects) >= 2*limit {
+				slices.SortFunc(objects, newest)
+				objects = objects[:limit]
+			}
+		}
+		slices.SortFunc(objects, newest)
+		objects = objects[:min(len(objects), limit)]
+
+		updated := time.Unix(0, 0).UTC()
+		if len(objects) > 0 {
+			updated = objects[0].LastModified.UTC().Truncate(time.Second)
+		}
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !updated.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		base := feedBaseURL(r)
+		self := base + r.URL.RequestURI()
+		feed := atomFeed{
+			Title:   "kzen " + bucket + "/" + prefix,
+			ID:      self,
+			Updated: updated.Format(time.RFC3339),
+			Links:   []atomLink{{Rel: "self", Href: self, Type: "application/atom+xml"}},
+			Author:  atomAuthor{Name: bucket},
+		}
+		for _, obj := range objects {
+			href := base + feedObjectURL(mounts, host, bucket, obj.Key)
+			contentType := cmp.Or(mime.TypeByExtension(path.Ext(obj.Key)), "application/octet-stream")
+			feed.Entries = append(feed.Entries, atomEntry{
+				Title: path.Base(obj.Key),
+				// A re-upload under the same key is a new entry.
+				ID:      "urn:kzen:" + url.PathEscape(bucket) + ":" + (&url.URL{Path: obj.Key}).EscapedPath() + ":" + normalizeETag(obj.ETag),
+				Updated: obj.LastModified.UTC().Format(time.RFC3339),
+				Links: []atomLink{
+					{Rel: "alternate", Href: href},
+					{Rel: "enclosure", Href: href, Type: contentType, Length: obj.Size},
+				},
+				Summary: fmt.Sprintf("%s, %s", obj.Key, humanize.IBytes(uint64(obj.Size))),
+			})
+		}
+		out, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			respondError(w, "failed to encode feed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Header().Set("Last-Modified", updated.Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write([]byte(xml.Header))
+		w.Write(out)
+	}
+}
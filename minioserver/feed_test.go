@@ -0,0 +1,66 @@
+package minioserver
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestFeedHandler(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2026, 3, day, 12, 0, 0, 0, time.UTC) }
+	mock := &mockObjectLister{objects: []minio.ObjectInfo{
+		{Key: "shared/a photo.jpg", Size: 2048, ETag: `"e1"`, LastModified: at(1)},
+		{Key: "shared/b.pdf", Size: 10, ETag: `"e2"`, LastModified: at(3)},
+		{Key: "shared/sub/c.png", Size: 5, ETag: `"e3"`, LastModified: at(2)},
+		{Key: "shared/", LastModified: at(4)},
+		{Key: "trash/shared/d.jpg~1", LastModified: at(5)},
+	}}
+	h := feedHandler(mock, "files", defaultMounts("files"), proxyOptions{})
+	get := func(target string, header http.Header) (*httptest.ResponseRecorder, atomFeed) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		h(rec, req)
+		var feed atomFeed
+		if rec.Code == http.StatusOK {
+			if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+				t.Fatalf("%s: %v\n%s", target, err, rec.Body)
+			}
+		}
+		return rec, feed
+	}
+
+	rec, feed := get("/feed?prefix=shared/", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/atom+xml; charset=utf-8" || len(feed.Entries) != 3 {
+		t.Fatalf("feed: %d %+v", rec.Code, feed)
+	}
+	if feed.Entries[0].Title != "b.pdf" || feed.Entries[2].Title != "a photo.jpg" || feed.Updated != "2026-03-03T12:00:00Z" {
+		t.Errorf("entries %+v, updated %s", feed.Entries, feed.Updated)
+	}
+	enclosure := feed.Entries[2].Links[1]
+	if enclosure.Rel != "enclosure" || enclosure.Href != "http://example.com/objects/shared/a%20photo.jpg" || enclosure.Type != "image/jpeg" || enclosure.Length != 2048 {
+		t.Errorf("enclosure %+v", enclosure)
+	}
+	if feed.Entries[0].ID == feed.Entries[1].ID || feed.Links[0].Href != "http://example.com/feed?prefix=shared/" {
+		t.Errorf("ids %q %q, self %+v", feed.Entries[0].ID, feed.Entries[1].ID, feed.Links)
+	}
+
+	if _, feed := get("/feed?prefix=shared/&limit=1", nil); len(feed.Entries) != 1 || feed.Entries[0].Title != "b.pdf" {
+		t.Errorf("limit=1: %+v", feed.Entries)
+	}
+	if rec, _ := get("/feed?prefix=shared/", http.Header{"If-Modified-Since": {at(3).Format(http.TimeFormat)}}); rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: %d, want 304", rec.Code)
+	}
+	if rec, _ := get("/feed?bucket=private", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown bucket: %d", rec.Code)
+	}
+	if rec, _ := get("/feed?limit=0", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: %d", rec.Code)
+	}
+}
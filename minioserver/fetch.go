@@ -0,0 +1,227 @@
+package minioserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	fetchMaxRedirects = 3
+	fetchTimeout      = 30 * time.Second
+)
+
+// fetchAllowedTypes are the Content-Type prefixes accepted from remote servers.
+var fetchAllowedTypes = []string{"image/"}
+
+var errFetchBlockedAddress = errors.New("destination address is not allowed")
+
+// nonPublicNets are the special-purpose ranges the net.IP predicates don't cover.
+var nonPublicNets = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"; 0.x.x.x reaches local hosts on Linux
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and the broadcast address
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which maps to any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+}
+
+// isPublicIP reports whether ip is routable on the public internet. Loopback, private,
+// link-local (incl. cloud metadata 169.254.169.254), multicast, unspecified and the special-purpose
+// addresses of nonPublicNets are rejected.
+func isPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range nonPublicNets {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// newPublicOnlyTransport returns a transport whose dialer refuses non-public addresses. The check runs
+// on the resolved IP at connect time, so DNS rebinding and redirects to internal hosts are blocked too.
+func newPublicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicIP(net.ParseIP(host)) {
+				return errFetchBlockedAddress
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	}
+}
+
+// newFetchClient returns an HTTP client for downloading user-supplied URLs (see newPublicOnlyTransport).
+func newFetchClient() *http.Client {
+	return &http.Client{
+		Timeout:   fetchTimeout,
+		Transport: newPublicOnlyTransport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= fetchMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", fetchMaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+type fetchRequest struct {
+	URL string `json:"url"`
+	Key string `json:"key"`
+}
+
+// fetchHandler downloads a remote file and stores it under key, so the UI can "add image by URL"
+// without routing the bytes through the browser. Body: {"url": "https://...", "key": "photos/a.jpg"}.
+// When folderPrefix is set it is prepended to key, like the upload handlers.
+func fetchHandler(client *minio.Client, bucket string, folderPrefix string, opts proxyOptions) http.HandlerFunc {
+	maxBytes := opts.FetchMaxBytes
+	httpClient := newFetchClient()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req fetchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		req.Key = strings.TrimPrefix(strings.TrimSpace(req.Key), "/")
+		if req.Key == "" {
+			respondError(w, "key required", http.StatusBadRequest)
+			return
+		}
+		objectKey := req.Key
+		if prefix := strings.TrimPrefix(folderPrefix, "/"); prefix != "" {
+			objectKey = path.Join(prefix, objectKey)
+		}
+		if hiddenKey(opts, bucket, objectKey) {
+			respondError(w, fmt.Sprintf("%q is a reserved key", req.Key), http.StatusBadRequest)
+			return
+		}
+		u, err := url.Parse(strings.TrimSpace(req.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			respondError(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 2*fetchTimeout)
+		defer cancel()
+
+		remoteReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			respondError(w, "invalid url", http.StatusBadRequest)
+			return
+		}
+		resp, err := httpClient.Do(remoteReq)
+		if err != nil {
+			log.Printf("fetch %q: %v", u.Redacted(), err)
+			if errors.Is(err, errFetchBlockedAddress) {
+				respondError(w, "url resolves to a blocked address", http.StatusBadRequest)
+				return
+			}
+			respondError(w, "failed to download url", http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			respondError(w, fmt.Sprintf("remote returned %d", resp.StatusCode), http.StatusBadGateway)
+			return
+		}
+		contentType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+		if !fetchTypeAllowed(contentType) {
+			respondError(w, fmt.Sprintf("content type %q not allowed", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+		if resp.ContentLength > maxBytes {
+			respondError(w, fmt.Sprintf("remote file exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+		if err != nil {
+			respondError(w, "failed to read remote body", http.StatusBadGateway)
+			return
+		}
+		if int64(len(data)) > maxBytes {
+			respondError(w, fmt.Sprintf("remote file exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if err := opts.UploadSlots.Acquire(ctx); err != nil {
+			respondUploadBusy(w, opts.UploadSlots, err)
+			return
+		}
+		defer opts.UploadSlots.Release()
+		if err := opts.checkOwner(ctx, client, bucket, objectKey); err != nil {
+			respondOwnerError(w, err)
+			return
+		}
+		_, err = client.PutObject(ctx, bucket, objectKey, bytes.NewReader(data), int64(len(data)),
+			minio.PutObjectOptions{ContentType: contentType, UserMetadata: opts.stampOwner(ctx, nil)})
+		if err != nil {
+			log.Printf("fetch: put object %q: %v", objectKey, err)
+			respondStorageError(w, err, "upload failed")
+			return
+		}
+		opts.changed(bucket, objectKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "key": objectKey, "size": len(data), "contentType": contentType})
+	}
+}
+
+func fetchTypeAllowed(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range fetchAllowedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
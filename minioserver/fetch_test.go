@@ -0,0 +1,62 @@
+package minioserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.100", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"0.1.2.3", false},
+		{"192.0.0.170", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"255.255.255.255", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::808:808", false},
+		{"198.20.0.1", true},
+		{"192.0.1.1", true},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+// A hidden key is refused before the URL is downloaded.
+func TestFetchHandler_RefusesHiddenKeys(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	h := fetchHandler(client, "files", "", proxyOptions{})
+	for _, key := range []string{"quarantine/a.jpg", "kzen-inventory/b.json"} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/fetch",
+			strings.NewReader(`{"url":"https://example.invalid/a.jpg","key":"`+key+`"}`)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "reserved key") {
+			t.Errorf("fetch to %s: %d %s", key, rec.Code, rec.Body)
+		}
+	}
+	if len(objects) != 0 {
+		t.Errorf("objects stored: %v", objects)
+	}
+}
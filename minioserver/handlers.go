@@ -1,18 +1,25 @@
 package minioserver
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
 )
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -20,52 +27,66 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ok"))
 }
 
-func objectsHandler(client *minio.Client, bucket string) http.HandlerFunc {
-	return objectsHandlerWithPrefix(client, bucket, "/objects/")
+func objectsHandler(client *minio.Client, bucket string, opts proxyOptions) http.HandlerFunc {
+	return objectsHandlerWithPrefix(client, bucket, "/objects/", opts)
 }
 
-func objectsHandlerWithPrefix(client *minio.Client, bucket string, pathPrefix string) http.HandlerFunc {
-	get := proxyGetWithPrefix(client, bucket, pathPrefix)
-	post := proxyPostWithPrefix(client, bucket, pathPrefix)
-	put := proxyPutWithPrefix(client, bucket, pathPrefix)
-	del := proxyDeleteWithPrefix(client, bucket, pathPrefix)
+func objectsHandlerWithPrefix(client *minio.Client, bucket string, pathPrefix string, opts proxyOptions) http.HandlerFunc {
+	get := proxyGetWithPrefix(client, bucket, pathPrefix, opts)
+	if opts.DirectoryIndex {
+		get = directoryIndexHandler(client, bucket, pathPrefix, get)
+	}
+	post := proxyPostWithPrefix(client, bucket, pathPrefix, opts)
+	put := proxyPutWithPrefix(client, bucket, pathPrefix, opts)
+	del := proxyDeleteWithPrefix(client, bucket, pathPrefix, opts)
+	appendObj := proxyAppendWithPrefix(client, bucket, pathPrefix, opts)
 	return func(w http.ResponseWriter, r *http.Request) {
+		if key := strings.TrimPrefix(r.URL.Path, pathPrefix); hiddenKey(opts, bucket, key) {
+			respondError(w, "object not found", http.StatusNotFound)
+			return
+		}
 		switch r.Method {
 		case http.MethodGet:
 			get(w, r)
 		case http.MethodHead:
 			get(w, r)
 		case http.MethodPost:
+			if isAppend(r) {
+				appendObj(w, r)
+				return
+			}
 			post(w, r)
 		case http.MethodPut:
 			put(w, r)
 		case http.MethodDelete:
 			del(w, r)
 		default:
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	}
 }
 
-func batchHandler(client *minio.Client, bucket string) http.HandlerFunc {
+// batchHandler serves /batch. Every key is held to the flags of the mount serving it (see
+// mountPermits), so a batch reaches no more than the mount's route would.
+func batchHandler(client *minio.Client, bucket string, mounts []Mount, opts proxyOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			batchGet(client, bucket, w, r)
+			batchGet(client, bucket, mounts, opts, w, r)
 		case http.MethodPost:
-			batchPost(client, bucket, w, r)
+			batchPost(client, bucket, mounts, opts, w, r)
 		case http.MethodDelete:
-			batchDelete(client, bucket, w, r)
+			batchDelete(client, bucket, mounts, opts, w, r)
 		default:
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	}
 }
 
-func batchGet(client *minio.Client, bucket string, w http.ResponseWriter, r *http.Request) {
+func batchGet(client *minio.Client, bucket string, mounts []Mount, opts proxyOptions, w http.ResponseWriter, r *http.Request) {
 	keysParam := r.URL.Query().Get("keys")
 	if keysParam == "" {
-		http.Error(w, "keys query required (e.g. ?keys=a.jpg,b.jpg)", http.StatusBadRequest)
+		respondError(w, "keys query required (e.g. ?keys=a.jpg,b.jpg)", http.StatusBadRequest)
 		return
 	}
 	keys := strings.Split(keysParam, ",")
@@ -73,11 +94,17 @@ func batchGet(client *minio.Client, bucket string, w http.ResponseWriter, r *htt
 		keys[i] = strings.TrimSpace(k)
 	}
 	if len(keys) == 0 {
-		http.Error(w, "at least one key required", http.StatusBadRequest)
+		respondError(w, "at least one key required", http.StatusBadRequest)
 		return
 	}
+	for _, key := range keys {
+		if err := mountPermits(r, mounts, opts, r.Method, bucket, key); err != nil {
+			respondMountError(w, err)
+			return
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	ctx, cancel := golib.RequestContext(r, 60*time.Second)
 	defer cancel()
 
 	type result struct {
@@ -92,6 +119,10 @@ func batchGet(client *minio.Client, bucket string, w http.ResponseWriter, r *htt
 		if key == "" {
 			continue
 		}
+		if hiddenKey(opts, bucket, key) {
+			results[i] = result{key: key, err: errors.New("object not found")}
+			continue
+		}
 		wg.Add(1)
 		go func(idx int, objKey string) {
 			defer wg.Done()
@@ -106,8 +137,9 @@ func batchGet(client *minio.Client, bucket string, w http.ResponseWriter, r *htt
 				results[idx] = result{key: objKey, err: err}
 				return
 			}
-			data, err := io.ReadAll(obj)
-			if err != nil {
+			// Stat gives the exact size, so read into one allocation instead of io.ReadAll's growing buffer.
+			data := make([]byte, info.Size)
+			if _, err := io.ReadFull(obj, data); err != nil {
 				results[idx] = result{key: objKey, err: err}
 				return
 			}
@@ -133,24 +165,29 @@ func batchGet(client *minio.Client, bucket string, w http.ResponseWriter, r *htt
 			"Content-Disposition": {`form-data; name="` + res.key + `"; filename="` + res.key + `"`},
 		})
 		part.Write(res.data)
+		opts.ByteStats.addOut(bucket, res.key, int64(len(res.data)))
 	}
 	mpw.Close()
 }
 
-func batchPost(client *minio.Client, bucket string, w http.ResponseWriter, r *http.Request) {
+func batchPost(client *minio.Client, bucket string, mounts []Mount, opts proxyOptions, w http.ResponseWriter, r *http.Request) {
 	ct := r.Header.Get("Content-Type")
 	if !strings.Contains(ct, "multipart/form-data") {
-		http.Error(w, "multipart form required", http.StatusBadRequest)
+		respondError(w, "multipart form required", http.StatusBadRequest)
 		return
 	}
-	if err := r.ParseMultipartForm(50 << 20); err != nil {
-		http.Error(w, "invalid multipart form", http.StatusBadRequest)
+	if err := opts.Multipart.ParseMultipartForm(w, r); err != nil {
+		if golib.IsMultipartLimit(err) {
+			respondError(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		respondError(w, "invalid multipart form", http.StatusBadRequest)
 		return
 	}
 
 	keysParam := r.FormValue("keys")
 	if keysParam == "" {
-		http.Error(w, "keys form field required (comma-separated object keys)", http.StatusBadRequest)
+		respondError(w, "keys form field required (comma-separated object keys)", http.StatusBadRequest)
 		return
 	}
 	keyList := strings.Split(keysParam, ",")
@@ -163,26 +200,52 @@ func batchPost(client *minio.Client, bucket string, w http.ResponseWriter, r *ht
 		files = r.MultipartForm.File["file"]
 	}
 	if len(files) != len(keyList) {
-		http.Error(w, fmt.Sprintf("keys count (%d) must match files count (%d)", len(keyList), len(files)), http.StatusBadRequest)
+		respondError(w, fmt.Sprintf("keys count (%d) must match files count (%d)", len(keyList), len(files)), http.StatusBadRequest)
 		return
 	}
+	for _, key := range keyList {
+		if err := mountPermits(r, mounts, opts, r.Method, bucket, key); err != nil {
+			respondMountError(w, err)
+			return
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 120*time.Second)
+	ctx, cancel := golib.RequestContext(r, 120*time.Second)
 	defer cancel()
 
 	type uploadResult struct {
 		Key string `json:"key"`
 		OK  bool   `json:"ok"`
 		Err string `json:"error,omitempty"`
+		// Status is the HTTP status the failure maps to (golib.MinioStatus), e.g. 403 or 503.
+		Status int `json:"status,omitempty"`
 	}
 	results := make([]uploadResult, len(keyList))
 	var wg sync.WaitGroup
+	started := 0
+	var busyErr error
 	for i := range keyList {
+		// Take an upload slot before starting each file so a large batch queues behind other
+		// uploads instead of opening every PutObject at once.
+		if err := opts.UploadSlots.Acquire(ctx); err != nil {
+			busyErr = err
+			break
+		}
+		started++
 		wg.Add(1)
 		go func(idx int) {
 			defer wg.Done()
+			defer opts.UploadSlots.Release()
 			objKey := keyList[idx]
 			file := files[idx]
+			if hiddenKey(opts, bucket, objKey) {
+				results[idx] = uploadResult{Key: objKey, Err: fmt.Sprintf("%q is a reserved key", objKey), Status: http.StatusBadRequest}
+				return
+			}
+			if err := opts.checkOwner(ctx, client, bucket, objKey); err != nil {
+				results[idx] = uploadResult{Key: objKey, Err: err.Error(), Status: ownerErrorStatus(err)}
+				return
+			}
 			f, err := file.Open()
 			if err != nil {
 				results[idx] = uploadResult{Key: objKey, Err: err.Error()}
@@ -193,24 +256,33 @@ func batchPost(client *minio.Client, bucket string, w http.ResponseWriter, r *ht
 			if contentType == "" {
 				contentType = "application/octet-stream"
 			}
-			_, err = client.PutObject(ctx, bucket, objKey, f, -1, minio.PutObjectOptions{ContentType: contentType})
+			_, err = client.PutObject(ctx, bucket, objKey, f, -1, minio.PutObjectOptions{ContentType: contentType, UserMetadata: opts.stampOwner(ctx, nil)})
 			if err != nil {
-				results[idx] = uploadResult{Key: objKey, Err: err.Error()}
+				results[idx] = uploadResult{Key: objKey, Err: err.Error(), Status: golib.MinioStatus(err)}
 				return
 			}
+			opts.ByteStats.addIn(bucket, objKey, file.Size)
+			opts.changed(bucket, objKey)
 			results[idx] = uploadResult{Key: objKey, OK: true}
 		}(i)
 	}
 	wg.Wait()
 
 	w.Header().Set("Content-Type", "application/json")
+	if busyErr != nil {
+		log.Printf("batch upload: %d of %d files started: %v", started, len(keyList), busyErr)
+		w.Header().Set("Retry-After", strconv.Itoa(opts.UploadSlots.RetryAfter()))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]any{"uploaded": results[:started], "error": "upload capacity exceeded, retry later", "code": "upload_busy"})
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]any{"uploaded": results})
 }
 
-func batchDelete(client *minio.Client, bucket string, w http.ResponseWriter, r *http.Request) {
+func batchDelete(client *minio.Client, bucket string, mounts []Mount, opts proxyOptions, w http.ResponseWriter, r *http.Request) {
 	keysParam := r.URL.Query().Get("keys")
 	if keysParam == "" {
-		http.Error(w, "keys query required (e.g. ?keys=a.jpg,b.jpg)", http.StatusBadRequest)
+		respondError(w, "keys query required (e.g. ?keys=a.jpg,b.jpg)", http.StatusBadRequest)
 		return
 	}
 	keys := strings.Split(keysParam, ",")
@@ -218,18 +290,28 @@ func batchDelete(client *minio.Client, bucket string, w http.ResponseWriter, r *
 		keys[i] = strings.TrimSpace(k)
 	}
 	if len(keys) == 0 {
-		http.Error(w, "at least one key required", http.StatusBadRequest)
+		respondError(w, "at least one key required", http.StatusBadRequest)
 		return
 	}
+	for _, key := range keys {
+		if err := mountPermits(r, mounts, opts, r.Method, bucket, key); err != nil {
+			respondMountError(w, err)
+			return
+		}
+	}
+	opts.Alerts.deleteBatch(bucket, len(keys), apiKeyName(r.Context()))
 
-	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	ctx, cancel := golib.RequestContext(r, 60*time.Second)
 	defer cancel()
 
 	type delResult struct {
-		Key string `json:"key"`
-		OK  bool   `json:"ok"`
-		Err string `json:"error,omitempty"`
+		Key      string `json:"key"`
+		OK       bool   `json:"ok"`
+		TrashKey string `json:"trashKey,omitempty"`
+		Err      string `json:"error,omitempty"`
+		Status   int    `json:"status,omitempty"`
 	}
+	by := apiKeyName(r.Context())
 	results := make([]delResult, len(keys))
 	var wg sync.WaitGroup
 	for i, key := range keys {
@@ -239,11 +321,41 @@ func batchDelete(client *minio.Client, bucket string, w http.ResponseWriter, r *
 		wg.Add(1)
 		go func(idx int, objKey string) {
 			defer wg.Done()
+			if hiddenKey(opts, bucket, objKey) {
+				results[idx] = delResult{Key: objKey, Err: "object not found", Status: http.StatusNotFound}
+				return
+			}
+			if opts.SoftDelete {
+				info, err := client.StatObject(ctx, bucket, objKey, minio.StatObjectOptions{})
+				if golib.IsNotFound(err) {
+					results[idx] = delResult{Key: objKey, OK: true}
+					return
+				}
+				if err == nil {
+					err = opts.mayModify(ctx, info)
+				}
+				trashKey := ""
+				if err == nil {
+					trashKey, err = trashObject(ctx, client, bucket, info, by)
+				}
+				if err != nil {
+					results[idx] = delResult{Key: objKey, Err: err.Error(), Status: ownerErrorStatus(err)}
+					return
+				}
+				opts.changed(bucket, objKey)
+				results[idx] = delResult{Key: objKey, OK: true, TrashKey: trashKey}
+				return
+			}
+			if err := opts.checkOwner(ctx, client, bucket, objKey); err != nil {
+				results[idx] = delResult{Key: objKey, Err: err.Error(), Status: ownerErrorStatus(err)}
+				return
+			}
 			err := client.RemoveObject(ctx, bucket, objKey, minio.RemoveObjectOptions{})
 			if err != nil {
-				results[idx] = delResult{Key: objKey, Err: err.Error()}
+				results[idx] = delResult{Key: objKey, Err: err.Error(), Status: golib.MinioStatus(err)}
 				return
 			}
+			opts.changed(bucket, objKey)
 			results[idx] = delResult{Key: objKey, OK: true}
 		}(i, key)
 	}
@@ -258,124 +370,256 @@ type objectLister interface {
 	ListObjects(ctx context.Context, bucket string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
 }
 
+const (
+	debugListDefaultKeys = 1000
+	debugListMaxKeys     = 10000
+	// debugListMaxSorted matching objects are sorted at most; sorting needs the whole listing.
+	debugListMaxSorted = 100000
+)
+
+// debugListEntry is one object in the /debug/list output.
+type debugListEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// debugList serves at most max-keys objects under prefix per request (default 1000, up to 10000).
+// When more remain, isTruncated is true and nextContinuationToken is passed back as
+// continuation-token to get the next page. The listFilter parameters filter the objects; sorting
+// by anything but the key lists the whole prefix (at most debugListMaxSorted matches) and pages
+// through the sorted result.
 func debugList(client objectLister, bucket string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 		/* prefix is the folder -> http://localhost:9004/debug/list?prefix=kzen/ */
-		prefix := r.URL.Query().Get("prefix")
+		q := r.URL.Query()
+		prefix := q.Get("prefix")
+		maxKeys := debugListDefaultKeys
+		if v := q.Get("max-keys"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				respondError(w, "max-keys must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			maxKeys = min(n, debugListMaxKeys)
+		}
+		filter, err := parseListFilter(q)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Sorted pages continue at an offset into the sorted listing, others after a key.
+		var startAfter string
+		offset := 0
+		if tok := q.Get("continuation-token"); tok != "" {
+			raw, err := base64.RawURLEncoding.DecodeString(tok)
+			if err == nil && filter.ordered() {
+				offset, err = strconv.Atoi(string(raw))
+				if offset < 0 {
+					err = strconv.ErrRange
+				}
+			}
+			if err != nil {
+				respondError(w, "invalid continuation-token", http.StatusBadRequest)
+				return
+			}
+			if !filter.ordered() {
+				startAfter = string(raw)
+			}
+		}
 
-		log.Printf("debugList: %s", prefix)
+		log.Printf("debugList: %s (max %d)", prefix, maxKeys)
 
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		ctx, cancel := golib.RequestContext(r, 10*time.Second)
 		defer cancel()
 
-		ch := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
-		var keys []string
+		ch := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, StartAfter: startAfter})
+		objects := []debugListEntry{}
+		truncated := false
 		for obj := range ch {
 			if obj.Err != nil {
 				log.Printf("list objects: %v", obj.Err)
-				http.Error(w, obj.Err.Error(), http.StatusInternalServerError)
+				respondStorageError(w, obj.Err, obj.Err.Error())
+				return
+			}
+			if obj.Key <= startAfter {
+				continue // listers that ignore StartAfter
+			}
+			if !filter.match(obj.Size, obj.LastModified) {
+				continue
+			}
+			if filter.ordered() && len(objects) == debugListMaxSorted {
+				respondError(w, fmt.Sprintf("more than %d objects to sort; narrow the prefix or the filters", debugListMaxSorted), http.StatusBadRequest)
 				return
 			}
-			keys = append(keys, obj.Key)
+			if !filter.ordered() && len(objects) == maxKeys {
+				truncated = true
+				cancel() // stop the listing; the channel drains on its own
+				break
+			}
+			objects = append(objects, debugListEntry{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
 		}
 
+		var next string
+		if filter.ordered() {
+			slices.SortFunc(objects, filter.compare)
+			objects = objects[min(offset, len(objects)):]
+			if truncated = len(objects) > maxKeys; truncated {
+				objects = objects[:maxKeys]
+				next = strconv.Itoa(offset + maxKeys)
+			}
+		} else if truncated {
+			next = objects[len(objects)-1].Key
+		}
+		resp := map[string]any{"bucket": bucket, "objects": objects, "isTruncated": truncated}
+		if truncated {
+			resp["nextContinuationToken"] = base64.RawURLEncoding.EncodeToString([]byte(next))
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "objects": keys})
+		json.NewEncoder(w).Encode(resp)
 	}
 }
 
-const statRetries = 3
-const statRetryDelay = 50 * time.Millisecond
-
 func proxyGet(client *minio.Client, bucket string) http.HandlerFunc {
-	return proxyGetWithPrefix(client, bucket, "/objects/")
+	return proxyGetWithPrefix(client, bucket, "/objects/", proxyOptions{})
 }
 
-func proxyGetWithPrefix(client *minio.Client, bucket string, pathPrefix string) http.HandlerFunc {
+func proxyGetWithPrefix(client *minio.Client, bucket string, pathPrefix string, opts proxyOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		objectKey := strings.TrimPrefix(r.URL.Path, pathPrefix)
 		if objectKey == "" {
-			http.Error(w, "object key required", http.StatusBadRequest)
+			respondError(w, "object key required", http.StatusBadRequest)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
 		defer cancel()
 
+		if opts.ReadCache != nil && opts.ReadCache.serve(ctx, w, r, client, bucket, objectKey, opts) {
+			return
+		}
+
 		// StatObject can intermittently return "Access Denied" under concurrent load.
 		// Retry a few times before failing.
-		var info minio.ObjectInfo
-		var err error
-		for attempt := 0; attempt < statRetries; attempt++ {
-			info, err = client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{})
-			if err == nil {
-				break
-			}
-			if !strings.Contains(err.Error(), "Access Denied") {
-				break
+		info, err := opts.retry().statObject(ctx, client, bucket, objectKey)
+		if golib.IsNotFound(err) && opts.Aliases != nil {
+			to, done, ok := opts.Aliases.resolveAlias(w, r, bucket, objectKey, opts.MountPrefix)
+			if done {
+				return
 			}
-			if attempt < statRetries-1 {
-				time.Sleep(statRetryDelay)
+			if ok {
+				objectKey = to
+				info, err = opts.retry().statObject(ctx, client, bucket, objectKey)
 			}
 		}
 		if err != nil {
 			log.Printf("stat object %q bucket=%q: %v", objectKey, bucket, err)
 			w.Header().Set("X-MinIO-Error", err.Error())
-			if strings.Contains(err.Error(), "does not exist") {
-				http.Error(w, "object not found", http.StatusNotFound)
+			if golib.IsNotFound(err) {
+				if opts.NotFoundImageKey != "" && wantsImage(r, objectKey) &&
+					servePlaceholder(w, r, client, bucket, opts.NotFoundImageKey, opts.NotFoundImageStatus, "not-found") {
+					return
+				}
+				respondError(w, "object not found", http.StatusNotFound)
 				return
 			}
-			http.Error(w, "failed to get object info", http.StatusInternalServerError)
+			respondStorageError(w, err, "failed to get object info")
 			return
 		}
 
-		obj, err := client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
-		if err != nil {
-			log.Printf("GET %q bucket=%q err: %v", objectKey, bucket, err)
-			w.Header().Set("X-MinIO-Error", err.Error())
-			http.Error(w, "object not found", http.StatusNotFound)
-			return
+		var obj io.ReadCloser
+		if opts.ParallelGetThreshold > 0 && info.Size >= opts.ParallelGetThreshold && r.Method == http.MethodGet {
+			// Large object: several ranged GETs in flight hide the proxy<->MinIO round-trip latency.
+			obj = newParallelRangeReader(ctx, info.Size, defaultParallelGetChunk, opts.ParallelGetWorkers,
+				minioRangeFetcher(client, bucket, objectKey, info.ETag, opts.retry()))
+		} else if r.Method == http.MethodGet {
+			obj, err = opts.retry().getObject(ctx, client, bucket, objectKey, minio.GetObjectOptions{})
+			if err != nil {
+				log.Printf("GET %q bucket=%q err: %v", objectKey, bucket, err)
+				w.Header().Set("X-MinIO-Error", err.Error())
+				respondStorageError(w, err, "failed to get object")
+				return
+			}
+		} else {
+			obj, err = client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
+			if err != nil {
+				log.Printf("GET %q bucket=%q err: %v", objectKey, bucket, err)
+				w.Header().Set("X-MinIO-Error", err.Error())
+				respondStorageError(w, err, "failed to get object")
+				return
+			}
 		}
 		defer obj.Close()
 
 		if info.ContentType != "" {
 			w.Header().Set("Content-Type", info.ContentType)
 		}
-		w.Header().Set("Content-Length", fmtSize(info.Size))
+		if info.ETag != "" {
+			w.Header().Set("ETag", `"`+info.ETag+`"`)
+		}
+		encoding := info.Metadata.Get("Content-Encoding")
+		body, size, ok := negotiateEncoding(w, r, obj, info.Size, info.ETag, encoding)
+		if !ok {
+			return
+		}
+		if isSVG(info.ContentType, objectKey) {
+			// Pre-compressed SVGs can't be rewritten, only sandboxed.
+			if encoding != "" {
+				setSVGSandbox(w)
+			} else if opts.SVG.serve(w, r, obj, info.Size, info.ETag) {
+				return
+			}
+		}
 
-		if _, err := io.Copy(w, obj); err != nil {
-			log.Printf("stream object %q: %v", objectKey, err)
+		out := newThrottledResponseWriter(ctx, w, newByteRateLimiter(opts.DownloadBytesPerSec), opts.DownloadLimiter)
+		if n, err := streamBody(out, r, body, size); err != nil {
+			log.Printf("stream object %q: %v (%d of %d bytes)", objectKey, err, n, size)
 		}
 	}
 }
 
 func proxyPost(client *minio.Client, bucket string) http.HandlerFunc {
-	return proxyPostWithPrefix(client, bucket, "/objects/")
+	return proxyPostWithPrefix(client, bucket, "/objects/", proxyOptions{})
 }
 
-func proxyPostWithPrefix(client *minio.Client, bucket string, pathPrefix string) http.HandlerFunc {
+func proxyPostWithPrefix(client *minio.Client, bucket string, pathPrefix string, opts proxyOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		objectKey := strings.TrimPrefix(r.URL.Path, pathPrefix)
 		if objectKey == "" {
-			http.Error(w, "object key required", http.StatusBadRequest)
+			respondError(w, "object key required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 60*time.Second)
+		defer cancel()
+
+		cond, status, msg := checkWritePreconditions(ctx, client, bucket, objectKey, r)
+		if status != 0 {
+			respondError(w, msg, status)
+			return
+		}
+		if err := opts.checkOwner(ctx, client, bucket, objectKey); err != nil {
+			respondOwnerError(w, err)
 			return
 		}
 
 		var body io.Reader
+		var filename string
 		contentType := "application/octet-stream"
 
 		if strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
 			file, hdr, err := r.FormFile("file")
 			if err != nil {
-				http.Error(w, "multipart form requires 'file' field", http.StatusBadRequest)
+				respondError(w, "multipart form requires 'file' field", http.StatusBadRequest)
 				return
 			}
 			defer file.Close()
 			body = file
+			filename = hdr.Filename
 			if hdr.Header.Get("Content-Type") != "" {
 				contentType = hdr.Header.Get("Content-Type")
 			}
@@ -385,19 +629,75 @@ func proxyPostWithPrefix(client *minio.Client, bucket string, pathPrefix string)
 				contentType = ct
 			}
 		}
+		encoding, ok := uploadEncoding(r)
+		if !ok {
+			respondError(w, "unsupported Content-Encoding (gzip or br)", http.StatusUnsupportedMediaType)
+			return
+		}
+		if encoding != "" && len(opts.Processors) > 0 {
+			respondError(w, "compressed uploads cannot be processed; send them uncompressed", http.StatusUnsupportedMediaType)
+			return
+		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
-		defer cancel()
+		storageClass, err := storageClassFor(r, opts.StorageClass)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		_, err := client.PutObject(ctx, bucket, objectKey, body, -1, minio.PutObjectOptions{
-			ContentType: contentType,
-		})
+		if err := opts.UploadSlots.Acquire(ctx); err != nil {
+			respondUploadBusy(w, opts.UploadSlots, err)
+			return
+		}
+		defer opts.UploadSlots.Release()
+
+		putOpts := minio.PutObjectOptions{ContentType: contentType, ContentEncoding: encoding, StorageClass: storageClass}
+		size := int64(-1)
+		if len(opts.Processors) > 0 {
+			u := &Upload{Bucket: bucket, Key: objectKey, Filename: filename, ContentType: contentType, Metadata: map[string]string{}}
+			data, err := runProcessors(ctx, opts.Processors, u, body, opts.Multipart.MaxFileBytes)
+			var q *quarantineError
+			if errors.As(err, &q) {
+				qKey, err := quarantineUpload(ctx, client, u, data, q, opts.QuarantineWebhook, apiKeyName(r.Context()))
+				if err != nil {
+					log.Printf("quarantine %q: %v", objectKey, err)
+					respondStorageError(w, err, "upload failed")
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]any{"ok": false, "quarantined": true, "key": objectKey, "quarantineKey": qKey, "reason": q.reason})
+				return
+			}
+			if err != nil {
+				respondProcessorError(w, objectKey, err)
+				return
+			}
+			putOpts.ContentType = u.ContentType
+			putOpts.UserMetadata = u.Metadata
+			body, size = bytes.NewReader(data), int64(len(data))
+		}
+		putOpts.UserMetadata = opts.stampOwner(ctx, putOpts.UserMetadata)
+		opts.Retention.apply(&putOpts, time.Now())
+		cond.apply(&putOpts)
+		uploaded, err := client.PutObject(ctx, bucket, objectKey, body, size, putOpts)
 		if err != nil {
 			log.Printf("put object %q: %v", objectKey, err)
-			http.Error(w, "upload failed", http.StatusInternalServerError)
+			if golib.MinioErrorResponse(err).Code == "InvalidStorageClass" {
+				respondError(w, "storage class "+storageClass+" is not supported by the storage", http.StatusBadRequest)
+				return
+			}
+			respondStorageError(w, err, "upload failed")
 			return
 		}
 
+		opts.changed(bucket, objectKey)
+		opts.UploadWebhook.send("uploaded", uploadEvent(bucket, minio.ObjectInfo{Key: objectKey, Size: uploaded.Size, ETag: uploaded.ETag},
+			putOpts.ContentType, apiKeyName(r.Context()), "proxy"))
+
+		if uploaded.ETag != "" {
+			w.Header().Set("ETag", `"`+uploaded.ETag+`"`)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		w.Write([]byte(`{"ok":true,"key":"` + objectKey + `"}`))
@@ -408,34 +708,76 @@ func proxyPut(client *minio.Client, bucket string) http.HandlerFunc {
 	return proxyPost(client, bucket)
 }
 
-func proxyPutWithPrefix(client *minio.Client, bucket string, pathPrefix string) http.HandlerFunc {
-	return proxyPostWithPrefix(client, bucket, pathPrefix)
+func proxyPutWithPrefix(client *minio.Client, bucket string, pathPrefix string, opts proxyOptions) http.HandlerFunc {
+	return proxyPostWithPrefix(client, bucket, pathPrefix, opts)
 }
 
 func proxyDelete(client *minio.Client, bucket string) http.HandlerFunc {
-	return proxyDeleteWithPrefix(client, bucket, "/objects/")
+	return proxyDeleteWithPrefix(client, bucket, "/objects/", proxyOptions{})
 }
 
-func proxyDeleteWithPrefix(client *minio.Client, bucket string, pathPrefix string) http.HandlerFunc {
+func proxyDeleteWithPrefix(client *minio.Client, bucket string, pathPrefix string, opts proxyOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		objectKey := strings.TrimPrefix(r.URL.Path, pathPrefix)
 		if objectKey == "" {
-			http.Error(w, "object key required", http.StatusBadRequest)
+			respondError(w, "object key required", http.StatusBadRequest)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
 		defer cancel()
 
-		err := client.RemoveObject(ctx, bucket, objectKey, minio.RemoveObjectOptions{})
-		if err != nil {
-			log.Printf("DELETE %q: %v", objectKey, err)
-			http.Error(w, "delete failed", http.StatusInternalServerError)
+		// S3 deletes of missing keys succeed, so whether the object existed takes a stat first.
+		// existed stays null when the stat fails for another reason.
+		q := r.URL.Query().Get("mustExist")
+		mustExist := q == "1" || q == "true"
+		var existed any
+		info, err := client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{})
+		switch {
+		case err == nil:
+			existed = true
+			if err := opts.mayModify(ctx, info); err != nil {
+				respondOwnerError(w, err)
+				return
+			}
+		case golib.IsNotFound(err):
+			existed = false
+			if mustExist {
+				respondError(w, "object not found", http.StatusNotFound)
+				return
+			}
+		case mustExist, opts.SoftDelete, opts.ownsObjects():
+			// Without the stat, neither mustExist, the trash nor the owner can be honored.
+			log.Printf("DELETE %q: stat: %v", objectKey, err)
+			respondStorageError(w, err, "failed to get object info")
 			return
+		default:
+			log.Printf("DELETE %q: stat: %v (deleting anyway)", objectKey, err)
+		}
+
+		resp := map[string]any{"ok": true, "deleted": objectKey, "existed": existed}
+		switch {
+		case opts.SoftDelete && existed == false:
+			// Nothing to move to the trash.
+		case opts.SoftDelete:
+			trashKey, err := trashObject(ctx, client, bucket, info, apiKeyName(r.Context()))
+			if err != nil {
+				log.Printf("DELETE %q: trash: %v", objectKey, err)
+				respondStorageError(w, err, "delete failed")
+				return
+			}
+			resp["trashKey"] = trashKey
+		default:
+			if err := client.RemoveObject(ctx, bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
+				log.Printf("DELETE %q: %v", objectKey, err)
+				respondStorageError(w, err, "delete failed")
+				return
+			}
 		}
+		opts.changed(bucket, objectKey)
 
 		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"ok":true,"deleted":"` + objectKey + `"}`))
+		json.NewEncoder(w).Encode(resp)
 	}
 }
 
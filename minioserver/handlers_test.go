@@ -0,0 +1,45 @@
+package minioserver
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// /batch reads, writes and deletes none of the keys the object routes hide.
+func TestBatch_RefusesHiddenKeys(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["a.txt"] = []byte("public")
+	objects["quarantine/a.txt"] = []byte("flagged")
+	objects["trash/b.txt"] = []byte("deleted")
+	h := batchHandler(client, "files", nil, proxyOptions{})
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/batch?keys=a.txt,quarantine/a.txt", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "public") || strings.Contains(rec.Body.String(), "flagged") {
+		t.Errorf("GET: %d %s", rec.Code, rec.Body)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("keys", "kzen-inventory/fake.json")
+	fw, _ := mw.CreateFormFile("files", "fake.json")
+	fw.Write([]byte("{}"))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/batch", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if _, ok := objects["kzen-inventory/fake.json"]; ok || !strings.Contains(rec.Body.String(), "reserved key") {
+		t.Errorf("POST stored a report key: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodDelete, "/batch?keys=trash/b.txt", nil))
+	if _, ok := objects["trash/b.txt"]; !ok || !strings.Contains(rec.Body.String(), `"status":404`) {
+		t.Errorf("DELETE removed a trash key: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,114 @@
+package minioserver
+
+import (
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// hotlinkPolicy restricts public object reads to pages on allowed domains, judged by the Origin
+// or Referer header. A nil *hotlinkPolicy allows everything.
+type hotlinkPolicy struct {
+	// domains match exactly or as a parent domain: "kzen.app" allows "kzen.app" and "www.kzen.app".
+	domains []string
+	// allowEmpty lets requests without Origin/Referer through (direct visits, privacy-stripped
+	// referers, native apps).
+	allowEmpty bool
+	// placeholderKey is an image in the requested bucket sent instead of a 403 to blocked image
+	// requests; "" always answers 403.
+	placeholderKey string
+}
+
+func newHotlinkPolicy(domains []string, allowEmpty bool, placeholderKey string) *hotlinkPolicy {
+	var clean []string
+	for _, d := range domains {
+		if d = strings.ToLower(strings.Trim(strings.TrimSpace(d), ".")); d != "" {
+			clean = append(clean, d)
+		}
+	}
+	if len(clean) == 0 {
+		return nil
+	}
+	return &hotlinkPolicy{domains: clean, allowEmpty: allowEmpty, placeholderKey: strings.TrimPrefix(placeholderKey, "/")}
+}
+
+// allowed reports whether r may read objects. The proxy's own host is always allowed so its pages
+// (directory index, previews) keep working.
+func (p *hotlinkPolicy) allowed(r *http.Request) bool {
+	if p == nil {
+		return true
+	}
+	source := r.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return p.allowEmpty
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	own := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		own = h
+	}
+	if strings.EqualFold(own, host) {
+		return true
+	}
+	for _, d := range p.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsImage reports whether a blocked request is an image embed, which gets the placeholder.
+func wantsImage(r *http.Request, objectKey string) bool {
+	if strings.HasPrefix(mime.TypeByExtension(path.Ext(objectKey)), "image/") {
+		return true
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), "image/")
+}
+
+// permits reports whether r may read objects: the policy allows it, or it carries a valid key.
+// With a policy configured every answer depends on Origin and Referer, allowed ones too, so the
+// response says so for caches.
+func (p *hotlinkPolicy) permits(w http.ResponseWriter, r *http.Request, keys *apiKeyStore) bool {
+	if p == nil {
+		return true
+	}
+	w.Header().Add("Vary", "Origin, Referer")
+	return p.allowed(r) || hasValidAPIKey(keys, r)
+}
+
+// respondBlocked answers a read permits refused with the placeholder image or 403.
+func (p *hotlinkPolicy) respondBlocked(w http.ResponseWriter, r *http.Request, client *minio.Client, bucket, objectKey string) {
+	if p.placeholderKey != "" && wantsImage(r, objectKey) &&
+		servePlaceholder(w, r, client, bucket, p.placeholderKey, http.StatusOK, "hotlink") {
+		return
+	}
+	respondError(w, "hotlinking not allowed", http.StatusForbidden)
+}
+
+// hotlinkProtected applies the hotlink policy of opts to next, a public read route serving the
+// objects of bucket under route (e.g. /render/).
+func hotlinkProtected(client *minio.Client, bucket, route string, opts proxyOptions, next http.HandlerFunc) http.HandlerFunc {
+	if opts.Hotlink == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !opts.Hotlink.permits(w, r, opts.APIKeys) {
+			opts.Hotlink.respondBlocked(w, r, client, bucket, strings.TrimPrefix(r.URL.Path, route))
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,75 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHotlinkPolicy_Allowed(t *testing.T) {
+	p := newHotlinkPolicy([]string{"kzen.app", " .example.com "}, false, "")
+
+	cases := []struct {
+		origin, referer string
+		want            bool
+	}{
+		{"", "https://kzen.app/stories/1", true},
+		{"", "https://www.kzen.app/", true},
+		{"https://cdn.example.com", "", true},
+		{"", "https://evil.com/page", false},
+		{"", "https://notkzen.app/", false},
+		{"", "https://kzen.app.evil.com/", false},
+		{"", "", false},
+		{"null", "", false},
+		{"", "https://proxy.local:8080/objects/", true}, // own host
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "http://proxy.local:8080/objects/a.jpg", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if tc.referer != "" {
+			r.Header.Set("Referer", tc.referer)
+		}
+		if got := p.allowed(r); got != tc.want {
+			t.Errorf("origin=%q referer=%q: allowed = %v, want %v", tc.origin, tc.referer, got, tc.want)
+		}
+	}
+
+	if newHotlinkPolicy([]string{""}, true, "") != nil {
+		t.Error("empty domain list should disable the policy")
+	}
+	var off *hotlinkPolicy
+	if !off.allowed(httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Error("nil policy should allow everything")
+	}
+}
+
+func TestHotlinkProtected(t *testing.T) {
+	opts := proxyOptions{Hotlink: newHotlinkPolicy([]string{"kzen.app"}, false, "")}
+	served := false
+	h := hotlinkProtected(nil, "files", "/render/", opts, func(w http.ResponseWriter, r *http.Request) { served = true })
+
+	r := httptest.NewRequest(http.MethodGet, "/render/doc.md", nil)
+	r.Header.Set("Referer", "https://kzen.app/stories/1")
+	rec := httptest.NewRecorder()
+	h(rec, r)
+	if !served || rec.Header().Get("Vary") != "Origin, Referer" {
+		t.Errorf("allowed read: served %v, Vary %q", served, rec.Header().Get("Vary"))
+	}
+
+	served = false
+	r.Header.Set("Referer", "https://evil.com/")
+	rec = httptest.NewRecorder()
+	h(rec, r)
+	if served || rec.Code != http.StatusForbidden || rec.Header().Get("Vary") != "Origin, Referer" {
+		t.Errorf("hotlinked read: served %v, %d, Vary %q", served, rec.Code, rec.Header().Get("Vary"))
+	}
+
+	// Without a policy nothing varies.
+	rec = httptest.NewRecorder()
+	hotlinkProtected(nil, "files", "/render/", proxyOptions{}, func(w http.ResponseWriter, r *http.Request) {})(rec, r)
+	if rec.Header().Get("Vary") != "" {
+		t.Errorf("no policy: Vary %q", rec.Header().Get("Vary"))
+	}
+}
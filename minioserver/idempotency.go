@@ -0,0 +1,170 @@
+package minioserver
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyHeader       = "Idempotency-Key"
+	idempotencyMaxKeyLen    = 255
+	idempotencyMaxEntries   = 10000
+	idempotencyMaxBodyBytes = 1 << 20
+)
+
+// idempotencyEntry is a stored response for one Idempotency-Key. done is false while the
+// first request with that key is still running.
+type idempotencyEntry struct {
+	done    bool
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// idempotencyCache keeps recent responses by key for ttl so client retries can be replayed.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, entries: make(map[string]*idempotencyEntry)}
+}
+
+// begin returns the stored entry for key, or nil when the caller should run the request. reserved
+// reports whether key was reserved for the caller's response; it is not when the cache holds
+// idempotencyMaxEntries live entries, and the request then runs without replay protection.
+func (c *idempotencyCache) begin(key string, now time.Time) (e *idempotencyEntry, reserved bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		if now.Before(e.expires) {
+			return e, false
+		}
+		delete(c.entries, key)
+	}
+	if len(c.entries) >= idempotencyMaxEntries {
+		c.evictExpired(now)
+		if len(c.entries) >= idempotencyMaxEntries {
+			metrics.add("kzen_idempotency_cache_full_total", 1)
+			return nil, false
+		}
+	}
+	c.entries[key] = &idempotencyEntry{expires: now.Add(c.ttl)}
+	return nil, true
+}
+
+func (c *idempotencyCache) finish(key string, status int, header http.Header, body []byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &idempotencyEntry{done: true, status: status, header: header, body: body, expires: now.Add(c.ttl)}
+}
+
+// release drops a reservation whose response should not be replayed (5xx, oversized body).
+func (c *idempotencyCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *idempotencyCache) evictExpired(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// recordingWriter passes the response through while keeping a copy for the idempotency cache.
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if !rw.overflow {
+		if rw.body.Len()+len(p) > idempotencyMaxBodyBytes {
+			rw.overflow = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(p)
+		}
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// idempotencyCacheKey scopes an Idempotency-Key to the request's method, path and API key, so a
+// client can't replay the response another key's request got.
+func idempotencyCacheKey(r *http.Request, key string) string {
+	return r.Method + " " + r.URL.Path + " " + apiKeyName(r.Context()) + " " + key
+}
+
+// idempotencyMiddleware replays the stored response for POST/PUT requests that repeat an
+// Idempotency-Key seen within the cache TTL, so retried uploads are not stored twice.
+// A retry that arrives while the first request is still running gets 409.
+func idempotencyMiddleware(cache *idempotencyCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > idempotencyMaxKeyLen {
+				respondError(w, "Idempotency-Key too long", http.StatusBadRequest)
+				return
+			}
+			cacheKey := idempotencyCacheKey(r, key)
+
+			e, reserved := cache.begin(cacheKey, time.Now())
+			if e != nil {
+				if !e.done {
+					respondError(w, "request with this Idempotency-Key is still in progress", http.StatusConflict)
+					return
+				}
+				for k, v := range e.header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(e.status)
+				w.Write(e.body)
+				return
+			}
+
+			if !reserved {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w}
+			defer func() {
+				if rw.status == 0 || rw.status >= 500 || rw.overflow {
+					cache.release(cacheKey)
+					return
+				}
+				cache.finish(cacheKey, rw.status, w.Header().Clone(), rw.body.Bytes(), time.Now())
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func init() {
+	metrics.describe("kzen_idempotency_cache_full_total", "counter", "Requests with an Idempotency-Key run unprotected because the replay cache was full.")
+}
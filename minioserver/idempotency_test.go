@@ -0,0 +1,117 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyMiddleware_ReplaysResponse(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	})
+	handler := idempotencyMiddleware(newIdempotencyCache(time.Minute))(next)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/objects/a.jpg", nil)
+		req.Header.Set(idempotencyHeader, "abc")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("request %d: got status %d, want %d", i, rec.Code, http.StatusCreated)
+		}
+		if rec.Body.String() != `{"ok":true}` {
+			t.Errorf("request %d: got body %q", i, rec.Body.String())
+		}
+		if replayed := rec.Header().Get("Idempotent-Replayed"); (i == 1) != (replayed == "true") {
+			t.Errorf("request %d: Idempotent-Replayed = %q", i, replayed)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyMiddleware_DoesNotCacheServerErrors(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "upload failed", http.StatusInternalServerError)
+	})
+	handler := idempotencyMiddleware(newIdempotencyCache(time.Minute))(next)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPut, "/objects/a.jpg", nil)
+		req.Header.Set(idempotencyHeader, "abc")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2 (5xx must allow retry)", calls)
+	}
+}
+
+func TestIdempotencyMiddleware_InFlightConflict(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	req := httptest.NewRequest(http.MethodPost, "/objects/a.jpg", nil)
+	cache.begin(idempotencyCacheKey(req, "abc"), time.Now())
+	handler := idempotencyMiddleware(cache)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not run while the same key is in flight")
+	}))
+
+	req.Header.Set(idempotencyHeader, "abc")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestIdempotencyMiddleware_ScopedToAPIKey(t *testing.T) {
+	keys := newAPIKeyStore([]APIKey{{Name: "alice", Key: "a"}, {Name: "bob", Key: "b"}})
+	calls := 0
+	handler := apiKeyMiddleware(keys)(idempotencyMiddleware(newIdempotencyCache(time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(apiKeyName(r.Context())))
+	})))
+
+	for _, key := range []string{"a", "b"} {
+		req := httptest.NewRequest(http.MethodPost, "/objects/a.jpg", nil)
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set(idempotencyHeader, "abc")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("key %s got the response of another key: %q", key, rec.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyCache_Bounded(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	now := time.Now()
+	for i := range idempotencyMaxEntries {
+		if _, reserved := cache.begin(strconv.Itoa(i), now); !reserved {
+			t.Fatalf("entry %d not reserved", i)
+		}
+	}
+	if e, reserved := cache.begin("one more", now); e != nil || reserved {
+		t.Errorf("full cache: entry %v, reserved %v", e, reserved)
+	}
+	if len(cache.entries) != idempotencyMaxEntries {
+		t.Errorf("%d entries, want at most %d", len(cache.entries), idempotencyMaxEntries)
+	}
+	if _, reserved := cache.begin("later", now.Add(2*time.Minute)); !reserved {
+		t.Error("expired entries not evicted")
+	}
+}
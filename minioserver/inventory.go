@@ -0,0 +1,302 @@
+package minioserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// inventoryPrefix holds the inventories POST /admin/inventory stores, in the inventoried bucket.
+const inventoryPrefix = "kzen-inventory/"
+
+// isReportKey reports whether key is an inventory or audit report; object routes don't serve
+// them, as they list every key of the bucket.
+func isReportKey(key string) bool {
+	return strings.HasPrefix(key, inventoryPrefix) || strings.HasPrefix(key, auditReportPrefix)
+}
+
+const (
+	// inventoryBatch objects are listed before the missing content types are stat'ed, in parallel.
+	inventoryBatch       = 256
+	inventoryConcurrency = 16
+)
+
+// inventoryEntry is one object of an inventory.
+type inventoryEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	ContentType  string    `json:"contentType"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+var inventoryCSVHeader = []string{"key", "size", "etag", "content_type", "last_modified"}
+
+// inventoryWriter writes entries as CSV (with a header row) or as a JSON array, one entry a line.
+type inventoryWriter struct {
+	w     *bufio.Writer
+	csv   *csv.Writer
+	count int
+}
+
+func newInventoryWriter(w io.Writer, format string) *inventoryWriter {
+	iw := &inventoryWriter{w: bufio.NewWriter(w)}
+	if format == "csv" {
+		iw.csv = csv.NewWriter(iw.w)
+		iw.csv.Write(inventoryCSVHeader)
+	} else {
+		iw.w.WriteString("[")
+	}
+	return iw
+}
+
+func (iw *inventoryWriter) write(e inventoryEntry) error {
+	iw.count++
+	if iw.csv != nil {
+		return iw.csv.Write([]string{e.Key, strconv.FormatInt(e.Size, 10), e.ETag, e.ContentType, e.LastModified.UTC().Format(time.RFC3339)})
+	}
+	if iw.count > 1 {
+		iw.w.WriteString(",")
+	}
+	iw.w.WriteString("\n")
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = iw.w.Write(data)
+	return err
+}
+
+func (iw *inventoryWriter) close() error {
+	if iw.csv != nil {
+		iw.csv.Flush()
+		if err := iw.csv.Error(); err != nil {
+			return err
+		}
+	} else {
+		iw.w.WriteString("\n]\n")
+	}
+	return iw.w.Flush()
+}
+
+// listedContentType returns the content type a MinIO listing with metadata carries, if any.
+func listedContentType(obj minio.ObjectInfo) string {
+	if obj.ContentType != "" {
+		return obj.ContentType
+	}
+	for k, v := range obj.UserMetadata {
+		if strings.EqualFold(k, "Content-Type") {
+			return v
+		}
+	}
+	return ""
+}
+
+// writeInventory lists every object under prefix into iw. Listings ask for metadata, which MinIO
+// answers with the content type; objects listed without one are stat'ed.
+func writeInventory(ctx context.Context, client objectStatLister, bucket, prefix string, iw *inventoryWriter) (int64, error) {
+	var total int64
+	batch := make([]inventoryEntry, 0, inventoryBatch)
+	flush := func() error {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, inventoryConcurrency)
+		errs := make([]error, len(batch))
+		for i := range batch {
+			if batch[i].ContentType != "" {
+				continue
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(e *inventoryEntry, i int) {
+				defer func() { <-sem; wg.Done() }()
+				info, err := client.StatObject(ctx, bucket, e.Key, minio.StatObjectOptions{})
+				if golib.IsNotFound(err) {
+					return // deleted since it was listed; keep the listed entry
+				}
+				e.ContentType, errs[i] = info.ContentType, err
+			}(&batch[i], i)
+		}
+		wg.Wait()
+		for i, e := range batch {
+			if errs[i] != nil {
+				return fmt.Errorf("stat %q: %w", e.Key, errs[i])
+			}
+			if err := iw.write(e); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithMetadata: true}) {
+		if obj.Err != nil {
+			return total, obj.Err
+		}
+		if strings.HasSuffix(obj.Key, "/") || isReportKey(obj.Key) {
+			continue
+		}
+		total += obj.Size
+		batch = append(batch, inventoryEntry{Key: obj.Key, Size: obj.Size, ETag: obj.ETag, ContentType: listedContentType(obj), LastModified: obj.LastModified})
+		if len(batch) == inventoryBatch {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, flush()
+}
+
+// inventoryHandler serves the inventories of defaultBucket (or ?bucket=):
+//
+//	POST /admin/inventory?prefix=&format=csv|json   write an inventory of prefix and store it
+//	GET  /admin/inventory                           list the stored inventories
+//	GET  /admin/inventory?key=                      download one
+//
+// Inventories are built in a temporary file, then stored as kzen-inventory/<time>.<format>.
+func inventoryHandler(client *minio.Client, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		bucket := q.Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if key := q.Get("key"); key != "" {
+				downloadInventory(client, bucket, key, w, r)
+				return
+			}
+			listInventories(client, bucket, w, r)
+			return
+		case http.MethodPost:
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		format := q.Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		if format != "csv" && format != "json" {
+			respondError(w, "format must be csv or json", http.StatusBadRequest)
+			return
+		}
+		prefix := strings.TrimPrefix(q.Get("prefix"), "/")
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Minute)
+		defer cancel()
+
+		tmp, err := os.CreateTemp("", "kzen-inventory-*")
+		if err != nil {
+			respondError(w, "failed to create temp file", http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		started := time.Now().UTC()
+		iw := newInventoryWriter(tmp, format)
+		total, err := writeInventory(ctx, client, bucket, prefix, iw)
+		if err == nil {
+			err = iw.close()
+		}
+		if err != nil {
+			log.Printf("inventory %s/%s: %v", bucket, prefix, err)
+			respondStorageError(w, err, "inventory failed")
+			return
+		}
+		size, err := tmp.Seek(0, io.SeekCurrent)
+		if err == nil {
+			_, err = tmp.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			respondError(w, "failed to read inventory", http.StatusInternalServerError)
+			return
+		}
+
+		key := inventoryPrefix + started.Format("20060102T150405Z") + "." + format
+		contentType := "text/csv"
+		if format == "json" {
+			contentType = "application/json"
+		}
+		meta := map[string]string{"Inventory-Prefix": prefix, "Inventory-Objects": strconv.Itoa(iw.count)}
+		if _, err := client.PutObject(ctx, bucket, key, tmp, size, minio.PutObjectOptions{ContentType: contentType, UserMetadata: meta}); err != nil {
+			log.Printf("inventory %s/%s: store: %v", bucket, key, err)
+			respondStorageError(w, err, "failed to store inventory")
+			return
+		}
+		log.Printf("inventory %s/%s: %d objects, %d bytes -> %s", bucket, prefix, iw.count, total, key)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"bucket":   bucket,
+			"prefix":   prefix,
+			"key":      key,
+			"format":   format,
+			"objects":  iw.count,
+			"bytes":    total,
+			"download": "/admin/inventory?" + url.Values{"bucket": {bucket}, "key": {key}}.Encode(),
+		})
+	}
+}
+
+func listInventories(client *minio.Client, bucket string, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := golib.RequestContext(r, 30*time.Second)
+	defer cancel()
+	items := []debugListEntry{}
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: inventoryPrefix, Recursive: true}) {
+		if obj.Err != nil {
+			respondStorageError(w, obj.Err, "failed to list inventories")
+			return
+		}
+		items = append(items, debugListEntry{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "inventories": items})
+}
+
+func downloadInventory(client *minio.Client, bucket, key string, w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(key, inventoryPrefix) {
+		respondError(w, "key must be under "+inventoryPrefix, http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := golib.RequestContext(r, 10*time.Minute)
+	defer cancel()
+	obj, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		respondStorageError(w, err, "failed to get inventory")
+		return
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if golib.IsNotFound(err) {
+		respondError(w, "inventory not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondStorageError(w, err, "failed to get inventory")
+		return
+	}
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(key)+`"`)
+	copyPooled(w, obj)
+}
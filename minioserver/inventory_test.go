@@ -0,0 +1,57 @@
+package minioserver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInventoryHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["kzen/a.jpg"] = []byte("a")
+	objects["kzen/b,c.txt"] = []byte("bc")
+	objects["other/d.txt"] = []byte("d")
+	h := inventoryHandler(client, "files")
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/admin/inventory?prefix=kzen/")
+	var resp struct {
+		Key      string `json:"key"`
+		Objects  int    `json:"objects"`
+		Bytes    int64  `json:"bytes"`
+		Download string `json:"download"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.Objects != 2 || resp.Bytes != 3 || !strings.HasPrefix(resp.Key, inventoryPrefix) || !strings.HasSuffix(resp.Key, ".csv") {
+		t.Fatalf("inventory: %d %s", rec.Code, rec.Body.String())
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(objects[resp.Key]))).ReadAll()
+	if err != nil || len(rows) != 3 || rows[0][0] != "key" || rows[2][0] != "kzen/b,c.txt" || rows[2][1] != "2" || rows[2][2] != "abc" {
+		t.Fatalf("csv: %v %q", err, objects[resp.Key])
+	}
+
+	// Downloadable, and listed; earlier inventories are not inventoried.
+	rec = do(http.MethodGet, resp.Download)
+	if rec.Code != http.StatusOK || rec.Body.String() != string(objects[resp.Key]) || !strings.Contains(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("download: %d %v", rec.Code, rec.Header())
+	}
+	rec = do(http.MethodPost, "/admin/inventory?format=json")
+	var entries []inventoryEntry
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if err := json.Unmarshal(objects[resp.Key], &entries); err != nil || len(entries) != 3 {
+		t.Errorf("json: %v %s", err, objects[resp.Key])
+	}
+	if rec := do(http.MethodGet, "/admin/inventory"); !strings.Contains(rec.Body.String(), resp.Key) {
+		t.Errorf("list: %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/admin/inventory?key=kzen/a.jpg"); rec.Code != http.StatusBadRequest {
+		t.Errorf("download outside %s: %d", inventoryPrefix, rec.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestParseListFilter(t *testing.T) {
+	f, err := parseListFilter(url.Values{"sort": {"size"}, "order": {"desc"}, "minSize": {"1KB"}, "maxSize": {"2048"}, "after": {"2026-01-01"}, "before": {"2026-02-01T00:00:00Z"}})
+	if err != nil || !f.ordered() || f.minSize != 1000 || f.maxSize != 2048 {
+		t.Fatalf("parse: %+v %v", f, err)
+	}
+	jan, feb := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		size     int64
+		modified time.Time
+		want     bool
+	}{{1500, jan, true}, {999, jan, false}, {4096, jan, false}, {1500, jan.Add(-time.Second), false}, {1500, feb, false}} {
+		if got := f.match(tc.size, tc.modified); got != tc.want {
+			t.Errorf("match(%d, %v) = %v, want %v", tc.size, tc.modified, got, tc.want)
+		}
+	}
+	if f, _ := parseListFilter(url.Values{"sort": {"name"}}); f.ordered() {
+		t.Error("sort=name is key order")
+	}
+	for _, q := range []string{"sort=type", "order=up", "minSize=-1", "maxSize=lots", "after=yesterday"} {
+		v, _ := url.ParseQuery(q)
+		if _, err := parseListFilter(v); err == nil {
+			t.Errorf("%s: want an error", q)
+		}
+	}
+}
+
+func TestDebugList_SortedPages(t *testing.T) {
+	mock := &mockObjectLister{objects: []minio.ObjectInfo{
+		{Key: "a", Size: 30}, {Key: "b", Size: 10}, {Key: "c", Size: 50}, {Key: "d", Size: 20}, {Key: "e", Size: 1},
+	}}
+	handler := debugList(mock, "test-bucket")
+
+	var got []string
+	target := "/debug/list?sort=size&order=desc&minSize=5&max-keys=2"
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var p struct {
+			Objects     []debugListEntry `json:"objects"`
+			IsTruncated bool             `json:"isTruncated"`
+			Next        string           `json:"nextContinuationToken"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatalf("page %d: %v (%s)", i, err, rec.Body.String())
+		}
+		for _, o := range p.Objects {
+			got = append(got, o.Key)
+		}
+		if !p.IsTruncated {
+			break
+		}
+		target = "/debug/list?sort=size&order=desc&minSize=5&max-keys=2&continuation-token=" + p.Next
+	}
+	if strings.Join(got, ",") != "c,a,d,b" {
+		t.Errorf("got %v, want c,a,d,b", got)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/debug/list?sort=bytes", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bad sort: got status %d, want 400", rec.Code)
+	}
+}
+
+func TestDirectoryIndex_SortsFilesAfterFolders(t *testing.T) {
+	mock := &mockObjectLister{objects: []minio.ObjectInfo{
+		{Key: "p/a.jpg", Size: 10}, {Key: "p/b.jpg", Size: 30}, {Key: "p/sub/"}, {Key: "p/c.jpg", Size: 20},
+	}}
+	handler := directoryIndexHandler(mock, "test-bucket", "/objects/", nil)
+	req := httptest.NewRequest(http.MethodGet, "/objects/p/?sort=size&order=desc&minSize=15", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	body := rec.Body.String()
+	sub, b, c := strings.Index(body, `href="sub/"`), strings.Index(body, `href="b.jpg"`), strings.Index(body, `href="c.jpg"`)
+	if sub < 0 || sub > b || b > c || strings.Contains(body, "a.jpg") {
+		t.Errorf("want sub/, b.jpg, c.jpg and no a.jpg:\n%s", body)
+	}
+}
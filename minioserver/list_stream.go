@@ -0,0 +1,106 @@
+package minioserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// listStreamFlushEvery records, a streamed listing is flushed to the client.
+const listStreamFlushEvery = 1000
+
+// listStreamRecord is one line of GET /list/stream.
+type listStreamRecord struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// listStreamHandler serves GET /list/stream?prefix=&start-after=&bucket=: every object under
+// prefix as newline-delimited JSON, written as ListObjects returns it, so clients can work through
+// millions of keys without either side holding the whole listing. The bucket must be one of
+// buckets (default defaultBucket). Keys the object routes hide (quarantine/, trash/, reports) are
+// left out, and so are objects the listFilter size and date parameters exclude; streams come in
+// key order, so other sorts are refused. A listing error after the first record ends the stream with an {"error": ...} line;
+// resume with start-after set to the last key received.
+func listStreamHandler(client objectLister, defaultBucket string, buckets []string, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		bucket := q.Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		if !slices.Contains(buckets, bucket) {
+			respondError(w, "unknown bucket", http.StatusBadRequest)
+			return
+		}
+		prefix := strings.TrimPrefix(q.Get("prefix"), "/")
+		startAfter := q.Get("start-after")
+		filter, err := parseListFilter(q)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if filter.ordered() {
+			respondError(w, "streamed listings come in key order; sort with /debug/list", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Minute)
+		defer cancel()
+
+		ch := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, StartAfter: startAfter})
+		bw := bufio.NewWriterSize(w, 64<<10)
+		enc := json.NewEncoder(bw)
+		flusher, _ := w.(http.Flusher)
+		flush := func() error {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		count := 0
+		for obj := range ch {
+			if obj.Err != nil {
+				log.Printf("list stream %s/%s: %v after %d records", bucket, prefix, obj.Err, count)
+				if count == 0 {
+					respondStorageError(w, obj.Err, "failed to list objects")
+					return
+				}
+				enc.Encode(map[string]string{"error": obj.Err.Error(), "code": golib.MinioErrorResponse(obj.Err).Code})
+				break
+			}
+			if obj.Key <= startAfter || strings.HasSuffix(obj.Key, "/") ||
+				hiddenKey(opts, bucket, obj.Key) ||
+				!filter.match(obj.Size, obj.LastModified) {
+				continue
+			}
+			enc.Encode(listStreamRecord{Key: obj.Key, Size: obj.Size, ETag: obj.ETag, LastModified: obj.LastModified})
+			count++
+			if count%listStreamFlushEvery == 0 {
+				if err := flush(); err != nil {
+					return // client gone; the deferred cancel stops the listing
+				}
+			}
+		}
+		flush()
+	}
+}
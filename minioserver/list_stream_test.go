@@ -0,0 +1,42 @@
+package minioserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListStreamHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	for _, key := range []string{"kzen/a.jpg", "kzen/b.jpg", "kzen/c.jpg", "trash/kzen/d.jpg~1", "other/e.jpg"} {
+		objects[key] = []byte(key)
+	}
+	h := listStreamHandler(client, "files", []string{"files"}, proxyOptions{})
+	list := func(target string) (*httptest.ResponseRecorder, []listStreamRecord) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var records []listStreamRecord
+		sc := bufio.NewScanner(rec.Body)
+		for sc.Scan() {
+			var rec listStreamRecord
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				t.Fatalf("line %q: %v", sc.Text(), err)
+			}
+			records = append(records, rec)
+		}
+		return rec, records
+	}
+
+	rec, records := list("/list/stream?prefix=kzen/")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" || len(records) != 3 || records[2].Key != "kzen/c.jpg" || records[2].Size != 10 {
+		t.Fatalf("stream: %d %v", rec.Code, records)
+	}
+	if _, records := list("/list/stream?start-after=kzen/a.jpg"); len(records) != 3 || records[0].Key != "kzen/b.jpg" {
+		t.Errorf("resumed: %v", records)
+	}
+	if rec, _ := list("/list/stream?bucket=private"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown bucket: %d", rec.Code)
+	}
+}
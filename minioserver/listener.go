@@ -0,0 +1,96 @@
+package minioserver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const unixListenPrefix = "unix:"
+
+// DefaultSocketMode lets the socket's group (e.g. the nginx user's) connect.
+const DefaultSocketMode fs.FileMode = 0o660
+
+// listenAll opens every address in spec, a comma-separated list of TCP addresses (":8080",
+// "0.0.0.0:8080", "[::1]:8080") and "unix:/path/to.sock" sockets. Listing an IPv4 and an IPv6
+// address serves both stacks from explicit binds; ":8080" alone already accepts both where the OS
+// allows it. Sockets get mode socketMode.
+func listenAll(spec string, socketMode fs.FileMode) ([]net.Listener, error) {
+	var lns []net.Listener
+	for _, addr := range strings.Split(spec, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		ln, err := listen(addr, socketMode)
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	if len(lns) == 0 {
+		return nil, fmt.Errorf("listen: no address in %q", spec)
+	}
+	return lns, nil
+}
+
+func listen(addr string, socketMode fs.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixListenPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("listen %q: socket path required", addr)
+	}
+	// A socket left behind by a previous run would make Listen fail; anything else at the path is
+	// not ours to remove.
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("listen %q: path exists and is not a socket", addr)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("listen %q: remove stale socket: %w", addr, err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if socketMode == 0 {
+		socketMode = DefaultSocketMode
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("listen %q: chmod: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// serveAll serves handler on every listener until one of them fails.
+func serveAll(srv *http.Server, lns []net.Listener) error {
+	errc := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln net.Listener) { errc <- srv.Serve(ln) }(ln)
+	}
+	err := <-errc
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	srv.Close()
+	return err
+}
+
+// fromUnixSocket reports whether r arrived on a unix socket listener. Only local processes (the
+// reverse proxy in front) can reach one, so its forwarding headers are trusted.
+func fromUnixSocket(r *http.Request) bool {
+	addr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	_, ok := addr.(*net.UnixAddr)
+	return ok
+}
@@ -0,0 +1,75 @@
+package minioserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenAll_UnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "kzen.sock")
+	// A stale socket from an earlier run is replaced.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lns, err := listenAll("127.0.0.1:0, unix:"+sock, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lns) != 2 {
+		t.Fatalf("got %d listeners, want 2", len(lns))
+	}
+	fi, err := os.Stat(sock)
+	if err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode = %v (%v), want 0600", fi.Mode().Perm(), err)
+	}
+
+	srv := &http.Server{Handler: realIPMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, clientIP(r))
+	}))}
+	go serveAll(srv, lns)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	req, _ := http.NewRequest(http.MethodGet, "http://kzen/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "203.0.113.9" {
+		t.Errorf("client IP over socket = %q, want the forwarded one", body)
+	}
+
+	resp, err = http.Get("http://" + lns[0].Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestListenAll_RefusesNonSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	os.WriteFile(path, []byte("x"), 0o600)
+	if _, err := listenAll("unix:"+path, 0); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Fatalf("err = %v, want not a socket", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file was removed: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package mediahandlers
+
+import (
+	"mime"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// slugMaxLen caps the slug kept in object keys.
+const slugMaxLen = 64
+
+// originalFilenameMeta is the user metadata key holding the uploaded file's raw name
+// (X-Amz-Meta-Original-Filename).
+const originalFilenameMeta = "Original-Filename"
+
+// latinFold maps common accented Latin letters to ASCII so "Café Menü" becomes "cafe-menu".
+var latinFold = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "ß", "ss",
+)
+
+// slugifyFilename returns a key-safe version of filename without its extension: lower-case ASCII
+// letters and digits joined by single dashes, at most slugMaxLen long. Names with nothing usable
+// (e.g. only non-Latin script) become "file".
+func slugifyFilename(filename string) string {
+	stem := strings.TrimSuffix(path.Base(strings.ReplaceAll(filename, "\\", "/")), path.Ext(filename))
+	stem = latinFold.Replace(strings.ToLower(stem))
+
+	var b strings.Builder
+	dash := false
+	for _, r := range stem {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+			if b.Len() >= slugMaxLen {
+				break
+			}
+			continue
+		}
+		dash = true
+	}
+	if b.Len() == 0 {
+		return "file"
+	}
+	return b.String()
+}
+
+// originalFilenameMetadata stores the raw filename as user metadata. Header values must be ASCII,
+// so other names are RFC 2047-encoded as the S3 SDKs do.
+func originalFilenameMetadata(filename string) map[string]string {
+	if filename == "" {
+		return nil
+	}
+	v := filename
+	for i := 0; i < len(v); i++ {
+		if v[i] >= utf8.RuneSelf || v[i] < 0x20 {
+			v = mime.QEncoding.Encode("utf-8", filename)
+			break
+		}
+	}
+	return map[string]string{originalFilenameMeta: v}
+}
@@ -0,0 +1,108 @@
+package mediahandlers
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// keyTemplateVars are the placeholders a key template may use.
+var keyTemplateVars = map[string]bool{
+	"folder": true, // form field folder
+	"userId": true, // form field userId
+	"id":     true, // the file's id from ids/id, "" when not sent
+	"uuid":   true, // a fresh random UUID
+	"ext":    true, // extension of the stored object, with the dot (".jpeg")
+	"name":   true, // slug of the original filename without extension (see slugifyFilename)
+	"yyyy":   true, // upload date (UTC)
+	"mm":     true,
+	"dd":     true,
+}
+
+// KeyTemplate builds object keys for uploaded files that arrive without a path, e.g.
+// "{folder}/{userId}/{yyyy}/{mm}/{uuid}{ext}". The zero value keeps the legacy "{userId}_{uuid}{ext}"
+// file name under folder.
+type KeyTemplate struct {
+	raw string
+}
+
+// ParseKeyTemplate validates s: placeholders must be known and it must contain {uuid} so generated keys
+// stay unique. "" returns the zero (legacy) template.
+func ParseKeyTemplate(s string) (KeyTemplate, error) {
+	s = strings.Trim(strings.TrimSpace(s), "/")
+	if s == "" {
+		return KeyTemplate{}, nil
+	}
+	rest := s
+	hasUUID := false
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			break
+		}
+		if strings.Contains(rest[:open], "}") {
+			return KeyTemplate{}, fmt.Errorf("key template %q: unmatched }", s)
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return KeyTemplate{}, fmt.Errorf("key template %q: unclosed {", s)
+		}
+		name := rest[open+1 : open+end]
+		if !keyTemplateVars[name] {
+			return KeyTemplate{}, fmt.Errorf("key template %q: unknown placeholder {%s}", s, name)
+		}
+		hasUUID = hasUUID || name == "uuid"
+		rest = rest[open+end+1:]
+	}
+	if strings.Contains(rest, "}") {
+		return KeyTemplate{}, fmt.Errorf("key template %q: unmatched }", s)
+	}
+	if !hasUUID {
+		return KeyTemplate{}, fmt.Errorf("key template %q: must contain {uuid}", s)
+	}
+	return KeyTemplate{raw: s}, nil
+}
+
+// IsZero reports whether t is the legacy template.
+func (t KeyTemplate) IsZero() bool { return t.raw == "" }
+
+func (t KeyTemplate) String() string { return t.raw }
+
+// keyTemplateInput carries the per-file values substituted into a KeyTemplate.
+type keyTemplateInput struct {
+	Folder string
+	UserID string
+	ID     string
+	UUID   string
+	Ext    string
+	// Name is the slugified original filename; with the zero template it is appended to the legacy
+	// name only when set (PreserveFilenames).
+	Name string
+	Now  time.Time
+}
+
+// render returns the generated path. For the zero template that is the legacy file name (relative to
+// folder, with "_{name}" before the extension when in.Name is set); otherwise the full key relative to the handler's folderPrefix. Empty segments produced
+// by blank values are dropped.
+func (t KeyTemplate) render(in keyTemplateInput) string {
+	if t.IsZero() {
+		if in.Name != "" {
+			return fmt.Sprintf("%s_%s_%s%s", in.UserID, in.UUID, in.Name, in.Ext)
+		}
+		return fmt.Sprintf("%s_%s%s", in.UserID, in.UUID, in.Ext)
+	}
+	now := in.Now.UTC()
+	r := strings.NewReplacer(
+		"{folder}", in.Folder,
+		"{userId}", in.UserID,
+		"{id}", in.ID,
+		"{uuid}", in.UUID,
+		"{ext}", in.Ext,
+		"{name}", in.Name,
+		"{yyyy}", now.Format("2006"),
+		"{mm}", now.Format("01"),
+		"{dd}", now.Format("02"),
+	)
+	return path.Clean(strings.TrimPrefix(r.Replace(t.raw), "/"))
+}
@@ -0,0 +1,129 @@
+package mediahandlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+	"kzen-go/kzenimage"
+)
+
+// Options tunes the image upload handlers; the zero value keeps the original behavior.
+type Options struct {
+	// UploadSlots bounds concurrent PutObject calls shared with the other upload endpoints; nil means unlimited.
+	UploadSlots *golib.Semaphore
+	// RecordBytesIn is called with each stored file's upload size for per-prefix byte accounting; may be nil.
+	RecordBytesIn func(bucket, objectKey string, n int64)
+	// OnChange is called with each object stored or deleted, e.g. to purge it from a CDN; may be nil.
+	OnChange func(bucket, objectKey string)
+	// Multipart bounds form parsing; the zero value keeps the 50 MB memory limit with no file caps.
+	Multipart golib.MultipartLimits
+	// KeyTemplate names uploaded files sent without a path; the zero value keeps "{userId}_{uuid}{ext}".
+	KeyTemplate KeyTemplate
+	// PreserveFilenames keeps a slug of the original filename in generated keys and stores the raw
+	// name in the Original-Filename metadata.
+	PreserveFilenames bool
+	// CheckKeyCollisions stats generated keys before uploading and retries with a new one when the key
+	// exists or is reserved (see ReserveKey).
+	CheckKeyCollisions bool
+	// PreserveOriginals stores the untouched upload under OriginalKey(key) whenever image processing
+	// changed it, so it can be re-processed later with better settings.
+	PreserveOriginals bool
+	// Pipeline configures raster image processing.
+	Pipeline kzenimage.Options
+	// StampOwner adds the uploading API key to an upload's user metadata; may be nil.
+	StampOwner func(ctx context.Context, meta map[string]string) map[string]string
+	// MayModify returns ErrNotOwner when the request may not overwrite or delete the existing object
+	// info; nil lets every request change every object.
+	MayModify func(ctx context.Context, info minio.ObjectInfo) error
+}
+
+// ErrNotOwner refuses a change to an object another API key uploaded.
+var ErrNotOwner = errors.New("object belongs to another API key")
+
+// OriginalsPrefix is where PreserveOriginals keeps untouched uploads, under their processed keys.
+const OriginalsPrefix = "originals/"
+
+// OriginalKey returns the key of the preserved original of objectKey.
+func OriginalKey(objectKey string) string {
+	return OriginalsPrefix + objectKey
+}
+
+// putOptions returns the PutObject options for an uploaded file.
+func (o Options) putOptions(ctx context.Context, contentType, filename string) minio.PutObjectOptions {
+	po := minio.PutObjectOptions{ContentType: contentType}
+	if o.PreserveFilenames {
+		po.UserMetadata = originalFilenameMetadata(filename)
+	}
+	po.UserMetadata = o.stampOwner(ctx, po.UserMetadata)
+	return po
+}
+
+func (o Options) stampOwner(ctx context.Context, meta map[string]string) map[string]string {
+	if o.StampOwner == nil {
+		return meta
+	}
+	return o.StampOwner(ctx, meta)
+}
+
+// checkOwner stats objectKey and applies MayModify; a missing object may always be written.
+func (o Options) checkOwner(ctx context.Context, client *minio.Client, bucket, objectKey string) error {
+	if o.MayModify == nil {
+		return nil
+	}
+	info, err := client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{})
+	if golib.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return o.MayModify(ctx, info)
+}
+
+// ownerStatus is the HTTP status answering a checkOwner error.
+func ownerStatus(err error) int {
+	if errors.Is(err, ErrNotOwner) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// putOriginal stores raw under OriginalKey(objectKey) when PreserveOriginals is on and processing
+// changed the image; unchanged uploads need no second copy.
+func (o Options) putOriginal(ctx context.Context, client *minio.Client, bucket, objectKey string, raw []byte, changed bool, filename string) error {
+	if !o.PreserveOriginals || !changed {
+		return nil
+	}
+	_, err := client.PutObject(ctx, bucket, OriginalKey(objectKey), bytes.NewReader(raw), int64(len(raw)),
+		o.putOptions(ctx, http.DetectContentType(raw), filename))
+	return err
+}
+
+// removeOriginal deletes the preserved original of objectKey, if any.
+func (o Options) removeOriginal(ctx context.Context, client *minio.Client, bucket, objectKey string) {
+	if !o.PreserveOriginals {
+		return
+	}
+	err := client.RemoveObject(ctx, bucket, OriginalKey(objectKey), minio.RemoveObjectOptions{})
+	if err != nil && !golib.IsNotFound(err) {
+		log.Printf("remove original of %q: %v", objectKey, err)
+	}
+}
+
+func (o Options) recordBytesIn(bucket, objectKey string, n int64) {
+	if o.RecordBytesIn != nil {
+		o.RecordBytesIn(bucket, objectKey, n)
+	}
+}
+
+func (o Options) changed(bucket, objectKey string) {
+	if o.OnChange != nil {
+		o.OnChange(bucket, objectKey)
+	}
+}
@@ -0,0 +1,19 @@
+package mediahandlers
+
+import (
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/kzenimage"
+)
+
+// streamPartSize is the PutObject part size for re-encoded images, whose size is only known once
+// encoding ends. minio-go buffers one part at a time, so this bounds the encoded bytes in memory.
+const streamPartSize = 5 << 20
+
+// streamOptions completes po for storing res.
+func streamOptions(res *kzenimage.Result, po minio.PutObjectOptions) minio.PutObjectOptions {
+	if res.Size < 0 {
+		po.PartSize = streamPartSize
+	}
+	return po
+}
@@ -0,0 +1,162 @@
+package mediahandlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	// keyCollisionRetries is how many fresh keys are tried before giving up.
+	keyCollisionRetries = 5
+	// ReservedUntilMeta is the user metadata key on the zero-byte object that marks a reserved key
+	// (X-Amz-Meta-Kzen-Reserved-Until, RFC 3339).
+	ReservedUntilMeta = "Kzen-Reserved-Until"
+	// reservationContentType marks reservation placeholders for anyone browsing the bucket.
+	reservationContentType = "application/x-kzen-reservation"
+
+	reserveDefaultTTL = time.Hour
+	reserveMaxTTL     = 24 * time.Hour
+)
+
+// IsReservation reports whether info is a reservation placeholder written by ReserveKey. Uploads
+// treat such objects as absent so the client holding the reservation can create the key.
+func IsReservation(info minio.ObjectInfo) bool {
+	return info.Size == 0 && info.UserMetadata[ReservedUntilMeta] != ""
+}
+
+// keyTaken reports whether key is in use: an existing object or an unexpired reservation.
+func keyTaken(ctx context.Context, client *minio.Client, bucket, key string, now time.Time) (bool, error) {
+	info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if golib.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if IsReservation(info) {
+		until, err := time.Parse(time.RFC3339, info.UserMetadata[ReservedUntilMeta])
+		return err != nil || now.Before(until), nil
+	}
+	return true, nil
+}
+
+// uniqueKey calls gen until the object key it returns is not taken in bucket, at most
+// keyCollisionRetries times, and returns gen's result. name is what the handler reports to the client
+// (e.g. an img_path relative to the folder). Keys are checked with a Stat, so two uploads racing for
+// the same generated key are only caught if one finishes first; generated keys carry a UUID, which
+// makes that practically impossible.
+func uniqueKey(ctx context.Context, client *minio.Client, bucket string, gen func() (name, objectKey string)) (string, string, error) {
+	for i := 0; i < keyCollisionRetries; i++ {
+		name, objectKey := gen()
+		taken, err := keyTaken(ctx, client, bucket, objectKey, time.Now())
+		if err != nil {
+			return "", "", fmt.Errorf("check %q: %w", objectKey, err)
+		}
+		if !taken {
+			return name, objectKey, nil
+		}
+		log.Printf("generated key %q already exists, retrying", objectKey)
+	}
+	return "", "", fmt.Errorf("no free key after %d attempts", keyCollisionRetries)
+}
+
+type reserveRequest struct {
+	Folder   string `json:"folder"`
+	UserID   string `json:"userId"`
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	// Ext is the extension of the file that will be uploaded (".jpeg"); taken from Filename when empty.
+	Ext string `json:"ext"`
+	// TTL is how long the reservation holds, in seconds (default 3600, max 86400).
+	TTL int `json:"ttl"`
+}
+
+// ReserveKey serves POST /reserve: it generates a key the same way upload-images names files sent
+// without a path (opts.KeyTemplate), makes sure nothing exists there, and writes a zero-byte
+// placeholder so no other reservation or generated upload takes it until the TTL runs out. The client
+// then uploads to the key, e.g. with PUT /objects/{objectKey} and If-None-Match: *.
+// Returns 201 { key, objectKey, expiresAt }: key is relative to folderPrefix (usable as imgPaths),
+// objectKey is the full key in bucket.
+func ReserveKey(client *minio.Client, bucket string, folderPrefix string, opts Options) http.HandlerFunc {
+	prefix := strings.Trim(folderPrefix, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var req reserveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"msg": "reserveKey: invalid JSON body"})
+			return
+		}
+		folder := strings.Trim(strings.TrimSpace(req.Folder), "/")
+		ext := req.Ext
+		if ext == "" {
+			ext = strings.ToLower(path.Ext(req.Filename))
+		}
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if folder == "" && opts.KeyTemplate.IsZero() {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"msg": "reserveKey: folder is required"})
+			return
+		}
+		ttl := reserveDefaultTTL
+		if req.TTL > 0 {
+			ttl = min(time.Duration(req.TTL)*time.Second, reserveMaxTTL)
+		}
+
+		gen := func() (string, string) {
+			in := keyTemplateInput{
+				Folder: folder, UserID: strings.TrimSpace(req.UserID), ID: req.ID,
+				UUID: uuid.New().String(), Ext: ext, Now: time.Now(),
+			}
+			if !opts.KeyTemplate.IsZero() || opts.PreserveFilenames {
+				in.Name = slugifyFilename(req.Filename)
+			}
+			key := opts.KeyTemplate.render(in)
+			if opts.KeyTemplate.IsZero() {
+				key = path.Join(folder, key)
+			}
+			return key, path.Join(prefix, key)
+		}
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+		// A reservation is only useful if it is free, so the check runs regardless of CheckKeyCollisions.
+		key, objectKey, err := uniqueKey(ctx, client, bucket, gen)
+		if err != nil {
+			log.Printf("reserveKey: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": "reserveKey: could not reserve a key"})
+			return
+		}
+
+		expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+		if _, err := client.PutObject(ctx, bucket, objectKey, bytes.NewReader(nil), 0, minio.PutObjectOptions{
+			ContentType:  reservationContentType,
+			UserMetadata: opts.stampOwner(ctx, map[string]string{ReservedUntilMeta: expiresAt.Format(time.RFC3339)}),
+		}); err != nil {
+			log.Printf("reserveKey: put %q: %v", objectKey, err)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": "reserveKey: could not reserve a key"})
+			return
+		}
+		respondJSON(w, http.StatusCreated, map[string]any{
+			"key":       key,
+			"objectKey": objectKey,
+			"expiresAt": expiresAt.Format(time.RFC3339),
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package mediahandlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+	"kzen-go/kzenimage"
+)
+
+// base64MaxBytes caps the decoded payload of POST /objects-base64.
+const base64MaxBytes = 20 << 20
+
+type base64UploadRequest struct {
+	Key         string `json:"key"`
+	ContentType string `json:"contentType"`
+	// Data is standard base64, or a data URL ("data:image/png;base64,...") whose media type is
+	// used when ContentType is empty.
+	Data string `json:"data"`
+}
+
+// decodeBase64Payload decodes plain base64 or a base64 data URL and returns the bytes and the
+// data URL's media type ("" for plain base64).
+func decodeBase64Payload(s string) ([]byte, string, error) {
+	s = strings.TrimSpace(s)
+	mediaType := ""
+	if rest, ok := strings.CutPrefix(s, "data:"); ok {
+		meta, payload, ok := strings.Cut(rest, ",")
+		if !ok {
+			return nil, "", fmt.Errorf("malformed data URL")
+		}
+		params := strings.Split(meta, ";")
+		if params[len(params)-1] != "base64" {
+			return nil, "", fmt.Errorf("data URL must be base64-encoded")
+		}
+		mediaType = params[0]
+		s = payload
+	}
+	if base64.StdEncoding.DecodedLen(len(s)) > base64MaxBytes+3 {
+		return nil, "", fmt.Errorf("payload exceeds %d bytes", base64MaxBytes)
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		// Canvas exports are padded; some clipboard tools strip the padding.
+		if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "=")); err != nil {
+			return nil, "", fmt.Errorf("invalid base64: %w", err)
+		}
+	}
+	return data, mediaType, nil
+}
+
+// processImageUpload runs the upload image pipeline: SVG is stored as-is, raster images go
+// through kzenimage.Process, anything else is stored unchanged. The result must be closed.
+func processImageUpload(ctx context.Context, data []byte, filename, contentType string, p kzenimage.Options) (*kzenimage.Result, error) {
+	if contentType == "image/svg+xml" || strings.HasSuffix(strings.ToLower(filename), ".svg") {
+		return kzenimage.Unchanged(data, "image/svg+xml"), nil
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(contentType, "image/") && !kzenimage.IsHEIC(contentType, data) {
+		return kzenimage.Unchanged(data, contentType), nil
+	}
+	return kzenimage.Process(ctx, data, filename, p)
+}
+
+// respondProcessError replies to a failed processImageUpload: 422 for images over the limits,
+// 503 when the image workers are saturated.
+func respondProcessError(w http.ResponseWriter, handler string, err error, p kzenimage.Options) {
+	var limitErr *kzenimage.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]string{"msg": handler + ": " + limitErr.Error()})
+	case errors.Is(err, golib.ErrSaturated):
+		w.Header().Set("Retry-After", strconv.Itoa(p.Workers.RetryAfter()))
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"msg": handler + ": server busy, retry later"})
+	default:
+		log.Printf("%s: process image: %v", handler, err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": handler + ": upload failed"})
+	}
+}
+
+// UploadBase64 accepts POST {"key","contentType","data"} with base64 (or data URL) content, for
+// clients such as canvas exports or clipboard paste that already hold a data URL. Images go through
+// the same pipeline as multipart uploads. When folderPrefix is set it is prepended to key.
+// Returns 201 { key, contentType, size }.
+func UploadBase64(client *minio.Client, bucket string, folderPrefix string, opts Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// base64 is 4/3 the size of the data; allow some slack for the JSON around it.
+		r.Body = http.MaxBytesReader(w, r.Body, base64MaxBytes*4/3+64<<10)
+		var req base64UploadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"msg": "uploadBase64: invalid or too large JSON body"})
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimSpace(req.Key), "/")
+		if key == "" || req.Data == "" {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"msg": "uploadBase64: key and data are required"})
+			return
+		}
+		data, mediaType, err := decodeBase64Payload(req.Data)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"msg": "uploadBase64: " + err.Error()})
+			return
+		}
+		contentType := req.ContentType
+		if contentType == "" {
+			contentType = mediaType
+		}
+		if contentType == "" {
+			contentType = mime.TypeByExtension(path.Ext(key))
+		}
+		ctx, cancel := golib.RequestContext(r, 60*time.Second)
+		defer cancel()
+		body, err := processImageUpload(ctx, data, key, contentType, opts.Pipeline)
+		if err != nil {
+			respondProcessError(w, "uploadBase64", err, opts.Pipeline)
+			return
+		}
+		defer body.Close()
+		contentType = body.ContentType
+
+		if prefix := strings.TrimPrefix(folderPrefix, "/"); prefix != "" {
+			key = path.Join(prefix, key)
+		}
+
+		if err := opts.UploadSlots.Acquire(ctx); err != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(opts.UploadSlots.RetryAfter()))
+			respondJSON(w, http.StatusServiceUnavailable, map[string]string{"msg": "uploadBase64: server busy, retry later"})
+			return
+		}
+		defer opts.UploadSlots.Release()
+
+		if err := opts.checkOwner(ctx, client, bucket, key); err != nil {
+			log.Printf("uploadBase64: overwrite %q: %v", key, err)
+			respondJSON(w, ownerStatus(err), map[string]string{"msg": "uploadBase64: " + err.Error()})
+			return
+		}
+		info, err := client.PutObject(ctx, bucket, key, body, body.Size,
+			streamOptions(body, minio.PutObjectOptions{ContentType: contentType, UserMetadata: opts.stampOwner(ctx, nil)}))
+		if err != nil {
+			log.Printf("uploadBase64: put %q: %v", key, err)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": "uploadBase64: upload failed"})
+			return
+		}
+		if err := opts.putOriginal(ctx, client, bucket, key, data, body.Changed, key); err != nil {
+			log.Printf("uploadBase64: put original of %q: %v", key, err)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": "uploadBase64: upload failed"})
+			return
+		}
+		opts.recordBytesIn(bucket, key, int64(len(data)))
+		opts.changed(bucket, key)
+		respondJSON(w, http.StatusCreated, map[string]any{"key": key, "contentType": contentType, "size": info.Size})
+	}
+}
@@ -1,134 +1,26 @@
 package mediahandlers
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"image"
-	_ "image/gif"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
-	xdraw "golang.org/x/image/draw"
-)
 
-const (
-	maxRasterEdgePx   = 4096
-	jpegEncodeQuality = 100
+	"kzen-go/golib"
+	"kzen-go/kzenimage"
 )
 
-// resizeToFit scales img to fit within maxW×maxH while preserving aspect ratio.
-// If the image already fits, it is returned unchanged (no enlargement).
-func resizeToFit(img image.Image, maxW, maxH int) image.Image {
-	bounds := img.Bounds()
-	origW := bounds.Dx()
-	origH := bounds.Dy()
-	if origW <= maxW && origH <= maxH {
-		return img
-	}
-
-	scaleW := float64(maxW) / float64(origW)
-	scaleH := float64(maxH) / float64(origH)
-	scale := scaleW
-	if scaleH < scaleW {
-		scale = scaleH
-	}
-
-	newW := int(float64(origW) * scale)
-	newH := int(float64(origH) * scale)
-	if newW < 1 {
-		newW = 1
-	}
-	if newH < 1 {
-		newH = 1
-	}
-
-	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
-	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Over, nil)
-	return dst
-}
-
-func contentTypeForFormat(format, filename string) string {
-	switch format {
-	case "jpeg":
-		return "image/jpeg"
-	case "png":
-		return "image/png"
-	case "gif":
-		return "image/gif"
-	case "webp":
-		return "image/webp"
-	default:
-		switch strings.ToLower(path.Ext(filename)) {
-		case ".jpg", ".jpeg":
-			return "image/jpeg"
-		case ".png":
-			return "image/png"
-		case ".gif":
-			return "image/gif"
-		case ".webp":
-			return "image/webp"
-		default:
-			return "application/octet-stream"
-		}
-	}
-}
-
-func encodeRasterImage(img image.Image, format string) ([]byte, string, error) {
-	var buf bytes.Buffer
-	switch format {
-	case "png":
-		if err := png.Encode(&buf, img); err != nil {
-			return nil, "", err
-		}
-		return buf.Bytes(), "image/png", nil
-	default:
-		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegEncodeQuality}); err != nil {
-			return nil, "", err
-		}
-		return buf.Bytes(), "image/jpeg", nil
-	}
-}
-
-// processRasterImage returns original bytes when the image fits within maxRasterEdgePx.
-// Only downscales oversized images and preserves PNG when possible.
-func processRasterImage(data []byte, filename string) ([]byte, string) {
-	img, format, err := image.Decode(bytes.NewReader(data))
-	if err != nil {
-		log.Printf("uploadImages: decode %q failed: %v, uploading raw", filename, err)
-		contentType := contentTypeForFormat("", filename)
-		if contentType == "application/octet-stream" {
-			contentType = http.DetectContentType(data)
-		}
-		return data, contentType
-	}
-
-	bounds := img.Bounds()
-	w, h := bounds.Dx(), bounds.Dy()
-	if w <= maxRasterEdgePx && h <= maxRasterEdgePx {
-		return data, contentTypeForFormat(format, filename)
-	}
-
-	resized := resizeToFit(img, maxRasterEdgePx, maxRasterEdgePx)
-	encoded, contentType, err := encodeRasterImage(resized, format)
-	if err != nil {
-		log.Printf("uploadImages: encode %q failed: %v, uploading raw", filename, err)
-		return data, contentTypeForFormat(format, filename)
-	}
-	return encoded, contentType
-}
-
 // isKnownFormField checks if a form field key is a known/reserved field name
 func isKnownFormField(key string) bool {
 	knownFields := map[string]bool{
@@ -160,19 +52,24 @@ func respondJSON(w http.ResponseWriter, status int, v any) {
 // UploadImagesToMinioServer accepts multipart form: files (multiple), userId, folder, imgPathsToDelete (comma-separated, optional),
 // imgPaths (comma-separated, optional), ids (comma-separated, optional), or imgPath/id (singular). When imgPaths and ids are provided
 // in same order as files, they are used as object paths; otherwise a new filename is generated.
-// img_path already includes the extension (e.g. userId_id_folder.jpeg).
+// img_path already includes the extension (e.g. userId_id_folder.jpeg). Generated names follow
+// opts.KeyTemplate; with a custom template the returned img_path is the full key under folderPrefix.
 // When folderPrefix is provided, it is prepended to all MinIO object keys (uploads and deletes).
 // Old images listed in imgPathsToDelete are removed.
 // All uploads and deletes run concurrently.
 // Returns on 200: { inserted: [{id, img_path}], deleted: [img_path1, img_path2, ...] }
-func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix string) http.HandlerFunc {
+func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix string, opts Options) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		if err := r.ParseMultipartForm(50 << 20); err != nil {
+		if err := opts.Multipart.ParseMultipartForm(w, r); err != nil {
+			if golib.IsMultipartLimit(err) {
+				respondJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"msg": "kZenUploadImagesToMinioServer:" + err.Error()})
+				return
+			}
 			respondJSON(w, http.StatusInternalServerError, map[string]any{"msg": "kZenUploadImagesToMinioServer:parse form error"})
 			return
 		}
@@ -361,7 +258,7 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 120*time.Second)
+		ctx, cancel := golib.RequestContext(r, 120*time.Second)
 		defer cancel()
 
 		type uploadResult struct {
@@ -374,8 +271,21 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 		deletedPaths := make([]string, len(imgPathsToDelete))
 		var wg sync.WaitGroup
 
-		// Upload each file concurrently (only if there are files).
+		// The upload slots for the whole batch are taken before anything is stored, so a busy
+		// server refuses the request as a whole instead of after some of its files.
+		slots, err := opts.UploadSlots.AcquireUpTo(ctx, len(fileHeaders))
+		if err != nil {
+			log.Printf("uploadImages: upload slots saturated: %v", err)
+			w.Header().Set("Retry-After", strconv.Itoa(opts.UploadSlots.RetryAfter()))
+			respondJSON(w, http.StatusServiceUnavailable, map[string]any{"msg": "kZenUploadImagesToMinioServer:server busy, retry later"})
+			return
+		}
+		defer opts.UploadSlots.ReleaseN(slots)
+		workers := make(chan struct{}, max(slots, 1))
+
+		// Upload each file concurrently (only if there are files), at most slots at a time.
 		for i, fh := range fileHeaders {
+			workers <- struct{}{}
 			wg.Add(1)
 			imgPath := ""
 			fileId := ""
@@ -413,6 +323,7 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 
 			go func(idx int, fh *multipart.FileHeader, imgPath, id string) {
 				defer wg.Done()
+				defer func() { <-workers }()
 
 				f, err := fh.Open()
 				if err != nil {
@@ -424,27 +335,34 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 				isSvg := fh.Header.Get("Content-Type") == "image/svg+xml" ||
 					strings.HasSuffix(strings.ToLower(fh.Filename), ".svg")
 
-				var objectData []byte
-				var contentType string
+				var body *kzenimage.Result
+				var raw []byte
 				var ext string
 
 				if isSvg {
-					objectData, err = io.ReadAll(f)
+					svg, err := io.ReadAll(f)
 					if err != nil {
 						results[idx] = uploadResult{err: fmt.Errorf("read %q: %w", fh.Filename, err)}
 						return
 					}
-					contentType = "image/svg+xml"
+					body = kzenimage.Unchanged(svg, "image/svg+xml")
 					ext = ".svg"
 				} else {
-					raw, err := io.ReadAll(f)
+					raw, err = io.ReadAll(f)
 					if err != nil {
 						results[idx] = uploadResult{err: fmt.Errorf("read %q: %w", fh.Filename, err)}
 						return
 					}
-					objectData, contentType = processRasterImage(raw, fh.Filename)
-					if contentType == "image/jpeg" {
+					body, err = kzenimage.Process(ctx, raw, fh.Filename, opts.Pipeline)
+					if err != nil {
+						results[idx] = uploadResult{err: err}
+						return
+					}
+					defer body.Close()
+					if body.ContentType == "image/jpeg" {
 						ext = ".jpeg"
+					} else if body.ContentType == "image/png" && !strings.EqualFold(path.Ext(fh.Filename), ".png") {
+						ext = ".png" // a transparent GIF/WebP re-encoded as PNG
 					} else {
 						ext = path.Ext(fh.Filename)
 						if ext == "" {
@@ -453,28 +371,66 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 					}
 				}
 
+				withPrefix := func(key string) string {
+					if folderPrefix != "" {
+						return path.Join(strings.TrimPrefix(folderPrefix, "/"), key)
+					}
+					return key
+				}
 				var objectKey string
 				var finalImgPath string
 				if imgPath != "" {
 					finalImgPath = imgPath
-					objectKey = path.Join(folder, imgPath)
+					objectKey = withPrefix(path.Join(folder, imgPath))
 				} else {
-					fileName := fmt.Sprintf("%s_%s%s", userId, uuid.New().String(), ext)
-					finalImgPath = fileName
-					objectKey = path.Join(folder, fileName)
-				}
-				if folderPrefix != "" {
-					prefix := strings.TrimPrefix(folderPrefix, "/")
-					objectKey = path.Join(prefix, objectKey)
+					gen := func() (string, string) {
+						if opts.KeyTemplate.IsZero() {
+							in := keyTemplateInput{UserID: userId, UUID: uuid.New().String(), Ext: ext}
+							if opts.PreserveFilenames {
+								in.Name = slugifyFilename(fh.Filename)
+							}
+							fileName := opts.KeyTemplate.render(in)
+							return fileName, withPrefix(path.Join(folder, fileName))
+						}
+						// Template keys are full paths (relative to folderPrefix), which the delete
+						// branch below also accepts as-is.
+						key := opts.KeyTemplate.render(keyTemplateInput{
+							Folder: folder, UserID: userId, ID: id, UUID: uuid.New().String(), Ext: ext, Now: time.Now(),
+							Name: slugifyFilename(fh.Filename),
+						})
+						return key, withPrefix(key)
+					}
+					if opts.CheckKeyCollisions {
+						finalImgPath, objectKey, err = uniqueKey(ctx, client, bucket, gen)
+						if err != nil {
+							results[idx] = uploadResult{err: err}
+							return
+						}
+					} else {
+						finalImgPath, objectKey = gen()
+					}
 				}
 
-				_, err = client.PutObject(ctx, bucket, objectKey,
-					bytes.NewReader(objectData), int64(len(objectData)),
-					minio.PutObjectOptions{ContentType: contentType})
+				if imgPath != "" {
+					if err := opts.checkOwner(ctx, client, bucket, objectKey); err != nil {
+						results[idx] = uploadResult{err: fmt.Errorf("overwrite %q: %w", objectKey, err)}
+						return
+					}
+				}
+				_, err = client.PutObject(ctx, bucket, objectKey, body, body.Size,
+					streamOptions(body, opts.putOptions(ctx, body.ContentType, fh.Filename)))
 				if err != nil {
 					results[idx] = uploadResult{err: fmt.Errorf("put %q: %w", objectKey, err)}
 					return
 				}
+				if raw != nil {
+					if err := opts.putOriginal(ctx, client, bucket, objectKey, raw, body.Changed, fh.Filename); err != nil {
+						results[idx] = uploadResult{err: fmt.Errorf("put original of %q: %w", objectKey, err)}
+						return
+					}
+				}
+				opts.recordBytesIn(bucket, objectKey, fh.Size)
+				opts.changed(bucket, objectKey)
 				results[idx] = uploadResult{imgPath: finalImgPath, id: id}
 			}(i, fh, imgPath, id)
 		}
@@ -492,15 +448,20 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 			}
 			go func(idx int, delKey string) {
 				defer wg.Done()
+				if err := opts.checkOwner(ctx, client, bucket, delKey); err != nil {
+					deleteErrors[idx] = fmt.Errorf("delete %q: %w", delKey, err)
+					return
+				}
 				if err := client.RemoveObject(ctx, bucket, delKey, minio.RemoveObjectOptions{}); err != nil {
-					errStr := err.Error()
-					if strings.Contains(errStr, "does not exist") || strings.Contains(errStr, "NoSuchKey") {
+					if golib.IsNotFound(err) {
 						log.Printf("uploadImages: path to delete not found (skipping): %q", delKey)
 						return
 					}
 					deleteErrors[idx] = fmt.Errorf("delete %q: %w", delKey, err)
 					return
 				}
+				opts.removeOriginal(ctx, client, bucket, delKey)
+				opts.changed(bucket, delKey)
 				deletedPaths[idx] = p // return original path as sent by client
 			}(i, objKey)
 		}
@@ -510,6 +471,20 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 		for _, res := range results {
 			if res.err != nil {
 				log.Printf("uploadImages: %v", res.err)
+				var limitErr *kzenimage.LimitError
+				if errors.As(res.err, &limitErr) {
+					respondJSON(w, http.StatusUnprocessableEntity, map[string]any{"msg": "kZenUploadImagesToMinioServer:" + limitErr.Error()})
+					return
+				}
+				if errors.Is(res.err, ErrNotOwner) {
+					respondJSON(w, http.StatusForbidden, map[string]any{"msg": "kZenUploadImagesToMinioServer:" + ErrNotOwner.Error()})
+					return
+				}
+				if errors.Is(res.err, golib.ErrSaturated) {
+					w.Header().Set("Retry-After", strconv.Itoa(opts.Pipeline.Workers.RetryAfter()))
+					respondJSON(w, http.StatusServiceUnavailable, map[string]any{"msg": "kZenUploadImagesToMinioServer:server busy, retry later"})
+					return
+				}
 				respondJSON(w, http.StatusInternalServerError, map[string]any{"msg": "kZenUploadImagesToMinioServer:upload error"})
 				return
 			}
@@ -517,7 +492,7 @@ func UploadImagesToMinioServer(client *minio.Client, bucket string, folderPrefix
 		for _, err := range deleteErrors {
 			if err != nil {
 				log.Printf("uploadImages: %v", err)
-				respondJSON(w, http.StatusInternalServerError, map[string]any{"msg": "kZenUploadImagesToMinioServer:delete error"})
+				respondJSON(w, ownerStatus(err), map[string]any{"msg": "kZenUploadImagesToMinioServer:delete error"})
 				return
 			}
 		}
@@ -1,9 +1,8 @@
 package mediahandlers
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,11 +10,15 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+	"kzen-go/kzenimage"
 )
 
 const kzenStorageObjectsPrefix = "kzen-storage-objects/"
@@ -109,14 +112,18 @@ func rewriteLegacyUserMediaKey(p string) string {
 // - Does not require userId/folder; each file's target path is the full segment after folderPrefix (e.g. users/userId/media/.../file.jpeg).
 // - Form field deletedSources (comma-separated) replaces imgPathsToDelete; values may be full URLs or bare paths (see objectKeyFromDeleteInput).
 // - Missing path for an uploaded file returns 400 (no UUID fallback).
-func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPrefix string) http.HandlerFunc {
+func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPrefix string, opts Options) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		if err := r.ParseMultipartForm(50 << 20); err != nil {
+		if err := opts.Multipart.ParseMultipartForm(w, r); err != nil {
+			if golib.IsMultipartLimit(err) {
+				respondJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:" + err.Error()})
+				return
+			}
 			respondJSON(w, http.StatusInternalServerError, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:parse form error"})
 			return
 		}
@@ -322,7 +329,7 @@ func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPref
 			}
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 120*time.Second)
+		ctx, cancel := golib.RequestContext(r, 120*time.Second)
 		defer cancel()
 
 		type uploadResult struct {
@@ -337,12 +344,25 @@ func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPref
 
 		prefix := strings.TrimPrefix(folderPrefix, "/")
 
+		// The upload slots for the whole batch are taken before anything is stored, so a busy
+		// server refuses the request as a whole instead of after some of its files.
+		slots, err := opts.UploadSlots.AcquireUpTo(ctx, len(fileHeaders))
+		if err != nil {
+			log.Printf("uploadImagesV2: upload slots saturated: %v", err)
+			w.Header().Set("Retry-After", strconv.Itoa(opts.UploadSlots.RetryAfter()))
+			respondJSON(w, http.StatusServiceUnavailable, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:server busy, retry later"})
+			return
+		}
+		defer opts.UploadSlots.ReleaseN(slots)
+		workers := make(chan struct{}, max(slots, 1))
 		for i, fh := range fileHeaders {
+			workers <- struct{}{}
 			wg.Add(1)
 			imgPath := strings.TrimSpace(resolvedPaths[i])
 			id := resolvedIDs[i]
 			go func(idx int, fh *multipart.FileHeader, imgPath, id string) {
 				defer wg.Done()
+				defer func() { <-workers }()
 
 				f, err := fh.Open()
 				if err != nil {
@@ -354,34 +374,50 @@ func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPref
 				isSvg := fh.Header.Get("Content-Type") == "image/svg+xml" ||
 					strings.HasSuffix(strings.ToLower(fh.Filename), ".svg")
 
-				var objectData []byte
-				var contentType string
+				var body *kzenimage.Result
+				var raw []byte
 
 				if isSvg {
-					objectData, err = io.ReadAll(f)
+					svg, err := io.ReadAll(f)
 					if err != nil {
 						results[idx] = uploadResult{err: fmt.Errorf("read %q: %w", fh.Filename, err)}
 						return
 					}
-					contentType = "image/svg+xml"
+					body = kzenimage.Unchanged(svg, "image/svg+xml")
 				} else {
-					raw, err := io.ReadAll(f)
+					raw, err = io.ReadAll(f)
 					if err != nil {
 						results[idx] = uploadResult{err: fmt.Errorf("read %q: %w", fh.Filename, err)}
 						return
 					}
-					objectData, contentType = processRasterImage(raw, fh.Filename)
+					body, err = kzenimage.Process(ctx, raw, fh.Filename, opts.Pipeline)
+					if err != nil {
+						results[idx] = uploadResult{err: err}
+						return
+					}
+					defer body.Close()
 				}
 
 				objectKey := path.Join(prefix, imgPath)
+				if err := opts.checkOwner(ctx, client, bucket, objectKey); err != nil {
+					results[idx] = uploadResult{err: fmt.Errorf("overwrite %q: %w", objectKey, err)}
+					return
+				}
 
-				_, err = client.PutObject(ctx, bucket, objectKey,
-					bytes.NewReader(objectData), int64(len(objectData)),
-					minio.PutObjectOptions{ContentType: contentType})
+				_, err = client.PutObject(ctx, bucket, objectKey, body, body.Size,
+					streamOptions(body, opts.putOptions(ctx, body.ContentType, fh.Filename)))
 				if err != nil {
 					results[idx] = uploadResult{err: fmt.Errorf("put %q: %w", objectKey, err)}
 					return
 				}
+				if raw != nil {
+					if err := opts.putOriginal(ctx, client, bucket, objectKey, raw, body.Changed, fh.Filename); err != nil {
+						results[idx] = uploadResult{err: fmt.Errorf("put original of %q: %w", objectKey, err)}
+						return
+					}
+				}
+				opts.recordBytesIn(bucket, objectKey, fh.Size)
+				opts.changed(bucket, objectKey)
 				results[idx] = uploadResult{imgPath: imgPath, id: id}
 			}(i, fh, imgPath, id)
 		}
@@ -395,15 +431,20 @@ func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPref
 				if objectKey == "" {
 					return
 				}
+				if err := opts.checkOwner(ctx, client, bucket, objectKey); err != nil {
+					deleteErrors[idx] = fmt.Errorf("delete %q: %w", objectKey, err)
+					return
+				}
 				if err := client.RemoveObject(ctx, bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
-					errStr := err.Error()
-					if strings.Contains(errStr, "does not exist") || strings.Contains(errStr, "NoSuchKey") {
+					if golib.IsNotFound(err) {
 						log.Printf("uploadImagesV2: path to delete not found (skipping): %q", objectKey)
 						return
 					}
 					deleteErrors[idx] = fmt.Errorf("delete %q: %w", objectKey, err)
 					return
 				}
+				opts.removeOriginal(ctx, client, bucket, objectKey)
+				opts.changed(bucket, objectKey)
 				deletedPaths[idx] = original
 			}(i, delKey, orig)
 		}
@@ -413,6 +454,20 @@ func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPref
 		for _, res := range results {
 			if res.err != nil {
 				log.Printf("uploadImagesV2: %v", res.err)
+				var limitErr *kzenimage.LimitError
+				if errors.As(res.err, &limitErr) {
+					respondJSON(w, http.StatusUnprocessableEntity, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:" + limitErr.Error()})
+					return
+				}
+				if errors.Is(res.err, ErrNotOwner) {
+					respondJSON(w, http.StatusForbidden, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:" + ErrNotOwner.Error()})
+					return
+				}
+				if errors.Is(res.err, golib.ErrSaturated) {
+					w.Header().Set("Retry-After", strconv.Itoa(opts.Pipeline.Workers.RetryAfter()))
+					respondJSON(w, http.StatusServiceUnavailable, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:server busy, retry later"})
+					return
+				}
 				respondJSON(w, http.StatusInternalServerError, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:upload error"})
 				return
 			}
@@ -420,7 +475,7 @@ func UploadImagesToMinioServerV2(client *minio.Client, bucket string, folderPref
 		for _, err := range deleteErrors {
 			if err != nil {
 				log.Printf("uploadImagesV2: %v", err)
-				respondJSON(w, http.StatusInternalServerError, map[string]any{"msg": "kZenUploadImagesToMinioServerV2:delete error"})
+				respondJSON(w, ownerStatus(err), map[string]any{"msg": "kZenUploadImagesToMinioServerV2:delete error"})
 				return
 			}
 		}
@@ -0,0 +1,136 @@
+package mediahandlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// pasteMaxBytes caps the raw image body of POST /paste.
+const pasteMaxBytes = 20 << 20
+
+// extensionForContentType maps the pipeline's output type to the file extension used in keys.
+func extensionForContentType(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpeg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	default:
+		return ""
+	}
+}
+
+// pasteKey returns a date-based key such as "pastes/2024/06/<uuid>.jpeg".
+func pasteKey(now time.Time, ext string) string {
+	return path.Join("pastes", now.UTC().Format("2006/01"), uuid.New().String()+ext)
+}
+
+// UploadPaste accepts POST with raw image bytes as the body (clipboard or screenshot paste) and no
+// key: it generates pastes/YYYY/MM/<uuid>.<ext>, runs the resize pipeline and stores the result.
+// folderPrefix is prepended to the key as for the other upload handlers; publicRoute is the object
+// route the returned path is built on (e.g. "/kzen-storage-objects/").
+// Returns 201 { key, path, contentType, size }.
+func UploadPaste(client *minio.Client, bucket string, folderPrefix string, publicRoute string, opts Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		data, err := io.ReadAll(io.LimitReader(r.Body, pasteMaxBytes+1))
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"msg": "uploadPaste: failed to read body"})
+			return
+		}
+		if len(data) > pasteMaxBytes {
+			respondJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"msg": "uploadPaste: image exceeds 20 MB"})
+			return
+		}
+		if len(data) == 0 {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"msg": "uploadPaste: empty body"})
+			return
+		}
+
+		// Trust the bytes over the header: pasted blobs often arrive as application/octet-stream.
+		contentType := http.DetectContentType(data)
+		if declared := r.Header.Get("Content-Type"); strings.HasPrefix(declared, "image/svg+xml") {
+			contentType = "image/svg+xml"
+		}
+		if !strings.HasPrefix(contentType, "image/") {
+			respondJSON(w, http.StatusUnsupportedMediaType, map[string]string{"msg": "uploadPaste: body is not an image"})
+			return
+		}
+		ctx, cancel := golib.RequestContext(r, 60*time.Second)
+		defer cancel()
+		body, err := processImageUpload(ctx, data, "paste", contentType, opts.Pipeline)
+		if err != nil {
+			respondProcessError(w, "uploadPaste", err, opts.Pipeline)
+			return
+		}
+		defer body.Close()
+		contentType = body.ContentType
+
+		gen := func() (string, string) {
+			key := pasteKey(time.Now(), extensionForContentType(contentType))
+			if prefix := strings.TrimPrefix(folderPrefix, "/"); prefix != "" {
+				key = path.Join(prefix, key)
+			}
+			return key, key
+		}
+
+		var key string
+		if opts.CheckKeyCollisions {
+			if key, _, err = uniqueKey(ctx, client, bucket, gen); err != nil {
+				log.Printf("uploadPaste: %v", err)
+				respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": "uploadPaste: upload failed"})
+				return
+			}
+		} else {
+			key, _ = gen()
+		}
+		if err := opts.UploadSlots.Acquire(ctx); err != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(opts.UploadSlots.RetryAfter()))
+			respondJSON(w, http.StatusServiceUnavailable, map[string]string{"msg": "uploadPaste: server busy, retry later"})
+			return
+		}
+		defer opts.UploadSlots.Release()
+
+		info, err := client.PutObject(ctx, bucket, key, body, body.Size,
+			streamOptions(body, minio.PutObjectOptions{ContentType: contentType, UserMetadata: opts.stampOwner(ctx, nil)}))
+		if err != nil {
+			log.Printf("uploadPaste: put %q: %v", key, err)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": "uploadPaste: upload failed"})
+			return
+		}
+		if err := opts.putOriginal(ctx, client, bucket, key, data, body.Changed, "paste"); err != nil {
+			log.Printf("uploadPaste: put original of %q: %v", key, err)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"msg": "uploadPaste: upload failed"})
+			return
+		}
+		opts.recordBytesIn(bucket, key, int64(len(data)))
+		opts.changed(bucket, key)
+		respondJSON(w, http.StatusCreated, map[string]any{
+			"key":         key,
+			"path":        publicRoute + key,
+			"contentType": contentType,
+			"size":        info.Size,
+		})
+	}
+}
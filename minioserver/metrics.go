@@ -0,0 +1,178 @@
+package minioserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metricsRegistry is a minimal Prometheus-text-format registry: counters, gauges and summaries
+// (as _count/_sum pairs) keyed by name plus label pairs. Gauge funcs are evaluated at scrape time.
+type metricsRegistry struct {
+	mu     sync.Mutex
+	help   map[string]string
+	types  map[string]string
+	values map[string]map[string]float64 // name -> rendered labels -> value
+	funcs  map[string]func() map[string]float64
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		help:   make(map[string]string),
+		types:  make(map[string]string),
+		values: make(map[string]map[string]float64),
+		funcs:  make(map[string]func() map[string]float64),
+	}
+}
+
+// metrics is the process-wide registry served on /metrics.
+var metrics = newMetricsRegistry()
+
+// describe sets the HELP and TYPE lines for name ("counter", "gauge" or "summary").
+func (m *metricsRegistry) describe(name, typ, help string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.help[name] = help
+	m.types[name] = typ
+}
+
+// labelString renders key/value pairs as {k="v",...}; an odd trailing key is ignored.
+func labelString(kv []string) string {
+	if len(kv) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		fmt.Fprintf(&b, `%s="%s"`, kv[i], v)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (m *metricsRegistry) addLocked(name, labels string, v float64) {
+	series, ok := m.values[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.values[name] = series
+	}
+	series[labels] += v
+}
+
+// add increments counter name by v.
+func (m *metricsRegistry) add(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addLocked(name, labelString(labels), v)
+}
+
+// set sets gauge name to v.
+func (m *metricsRegistry) set(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[name]; !ok {
+		m.values[name] = make(map[string]float64)
+	}
+	m.values[name][labelString(labels)] = v
+}
+
+// observe records one sample of summary name (exported as name_count and name_sum).
+func (m *metricsRegistry) observe(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := labelString(labels)
+	m.addLocked(name+"_count", l, 1)
+	m.addLocked(name+"_sum", l, v)
+}
+
+// gaugeFunc registers fn to produce the series of gauge name at scrape time (labels -> value).
+func (m *metricsRegistry) gaugeFunc(name string, fn func() map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.funcs[name] = fn
+}
+
+// value returns the current value of one series, mainly for tests.
+func (m *metricsRegistry) value(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[name][labelString(labels)]
+}
+
+// writeText renders every series in the Prometheus text exposition format.
+func (m *metricsRegistry) writeText(w *strings.Builder) {
+	m.mu.Lock()
+	series := make(map[string]map[string]float64, len(m.values)+len(m.funcs))
+	for name, vals := range m.values {
+		cp := make(map[string]float64, len(vals))
+		for k, v := range vals {
+			cp[k] = v
+		}
+		series[name] = cp
+	}
+	funcs := make(map[string]func() map[string]float64, len(m.funcs))
+	for name, fn := range m.funcs {
+		funcs[name] = fn
+	}
+	help := make(map[string]string, len(m.help))
+	types := make(map[string]string, len(m.types))
+	for name := range m.help {
+		help[name], types[name] = m.help[name], m.types[name]
+	}
+	m.mu.Unlock()
+
+	for name, fn := range funcs {
+		series[name] = fn()
+	}
+
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	described := make(map[string]bool)
+	for _, name := range names {
+		base := strings.TrimSuffix(strings.TrimSuffix(name, "_count"), "_sum")
+		if types[base] != "summary" {
+			base = name
+		}
+		if !described[base] {
+			if h := help[base]; h != "" {
+				fmt.Fprintf(w, "# HELP %s %s\n", base, h)
+			}
+			if t := types[base]; t != "" {
+				fmt.Fprintf(w, "# TYPE %s %s\n", base, t)
+			}
+			described[base] = true
+		}
+		labels := make([]string, 0, len(series[name]))
+		for l := range series[name] {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			fmt.Fprintf(w, "%s%s %g\n", name, l, series[name][l])
+		}
+	}
+}
+
+// metricsHandler serves the registry in Prometheus text format.
+func metricsHandler(reg *metricsRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var b strings.Builder
+		reg.writeText(&b)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(b.String()))
+	}
+}
@@ -0,0 +1,111 @@
+package minioserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMetricsRegistryText(t *testing.T) {
+	reg := newMetricsRegistry()
+	reg.describe("requests_total", "counter", "Requests.")
+	reg.describe("latency_seconds", "summary", "Latency.")
+	reg.add("requests_total", 1, "code", "200")
+	reg.add("requests_total", 2, "code", "200")
+	reg.add("requests_total", 1, "code", `5"x`)
+	reg.observe("latency_seconds", 0.5)
+	reg.observe("latency_seconds", 1.5)
+	reg.gaugeFunc("queue_depth", func() map[string]float64 { return map[string]float64{"": 7} })
+
+	var b strings.Builder
+	reg.writeText(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE requests_total counter\n",
+		`requests_total{code="200"} 3` + "\n",
+		`requests_total{code="5\"x"} 1` + "\n",
+		"# TYPE latency_seconds summary\n",
+		"latency_seconds_count 2\n",
+		"latency_seconds_sum 2\n",
+		"queue_depth 7\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "# TYPE latency_seconds") != 1 {
+		t.Errorf("summary described more than once:\n%s", out)
+	}
+}
+
+func TestInstrumentTransportCountsConns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	reg := newMetricsRegistry()
+	base := &http.Transport{MaxIdleConnsPerHost: 10}
+	defer base.CloseIdleConnections()
+	client := &http.Client{Transport: instrumentTransport(base, reg)}
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	if got := reg.value("kzen_minio_conns_total", "host", host, "reused", "false"); got != 1 {
+		t.Errorf("new conns = %v, want 1", got)
+	}
+	if got := reg.value("kzen_minio_conns_total", "host", host, "reused", "true"); got != 2 {
+		t.Errorf("reused conns = %v, want 2", got)
+	}
+
+	var b strings.Builder
+	reg.writeText(&b)
+	for _, want := range []string{
+		`kzen_minio_conns_open{host="` + host + `"} 1`,
+		`kzen_minio_requests_inflight{host="` + host + `"} 0`,
+		`kzen_minio_conns_idle{host="` + host + `"} 1`,
+		"kzen_minio_max_idle_conns_per_host 10",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+// Happy Eyeballs dials several addresses at once; each connect is timed from its own start.
+func TestTracingTransport_ParallelDials(t *testing.T) {
+	reg := newMetricsRegistry()
+	tr := instrumentTransport(&http.Transport{}, reg).(*tracingTransport)
+	trace := tr.clientTrace("minio:9000")
+
+	var wg sync.WaitGroup
+	for _, addr := range []string{"[2001:db8::1]:9000", "192.0.2.1:9000"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			trace.ConnectStart("tcp", addr)
+			trace.ConnectDone("tcp", addr, nil)
+		}()
+	}
+	wg.Wait()
+	trace.ConnectDone("tcp", "198.51.100.1:9000", nil) // never started
+
+	if got := reg.value("kzen_minio_connect_seconds_count", "host", "minio:9000"); got != 2 {
+		t.Errorf("connects observed = %v, want 2", got)
+	}
+	if got := reg.value("kzen_minio_connect_seconds_sum", "host", "minio:9000"); got < 0 || got > 1 {
+		t.Errorf("connect seconds = %v", got)
+	}
+}
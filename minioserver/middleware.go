@@ -1,10 +1,12 @@
 package minioserver
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strings"
-	"time"
+
+	"kzen-go/golib"
 )
 
 // Chain composes multiple middleware into one.
@@ -21,16 +23,34 @@ func Chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) ht
 // setCORSHeaders sets CORS headers so the server can be called from any origin (any UI).
 // Must be set on every response, including errors (e.g. 401), or the browser blocks the response.
 func setCORSHeaders(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, X-API-Key, Authorization, X-Requested-With")
+	// An origin already decided by credentialedCORSMiddleware or a mount's policy is kept.
+	if _, ok := w.Header()["Access-Control-Allow-Origin"]; !ok {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+	w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, X-API-Key, Authorization, X-Requested-With, Idempotency-Key, If-Match, If-None-Match, X-Kzen-Date, X-Kzen-Content-SHA256, X-Kzen-Nonce, X-API-Version, X-Request-Id, X-Request-Timeout, X-Storage-Class, X-CSRF-Token")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Stream-Error, X-Placeholder, X-API-Version, X-Request-Id")
 	w.Header().Set("Access-Control-Max-Age", "86400") // cache preflight 24h
 }
 
-func apiKeyMiddleware(apiKey string) func(http.Handler) http.Handler {
+// cleanupMiddleware runs the cleanups registered during the request (e.g. removing spilled
+// multipart temp files, see golib.MultipartLimits) once the handler returns or panics.
+func cleanupMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, done := golib.WithCleanup(r.Context())
+		defer done()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiKeyMiddleware requires a valid key from keys on every non-GET request. The matched key's
+// name is stored in the request context (see apiKeyName).
+func apiKeyMiddleware(keys *apiKeyStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/health" || r.URL.Path == "/health/" {
+			// /auth/cookie checks the access token it is given itself, /upload-links/{link} the link.
+			if r.URL.Path == "/health" || r.URL.Path == "/health/" || r.URL.Path == "/auth/cookie" ||
+				strings.HasPrefix(r.URL.Path, "/upload-links/") {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -45,27 +65,88 @@ func apiKeyMiddleware(apiKey string) func(http.Handler) http.Handler {
 				return
 			}
 
-			key := r.Header.Get("X-API-Key")
-			if key == "" {
-				key = r.Header.Get("Authorization")
-				if strings.HasPrefix(key, "Bearer ") {
-					key = strings.TrimPrefix(key, "Bearer ")
-				} else {
-					key = ""
-				}
+			name, err := keys.authenticate(r)
+			if errors.Is(err, errCSRF) {
+				log.Printf("auth rejected: %s %s %s: %v", clientIP(r), r.Method, r.URL.Path, err)
+				respondErrorCode(w, err.Error(), "csrf", http.StatusForbidden)
+				return
 			}
-			if key != apiKey {
-				setCORSHeaders(w) // required so browser gets CORS headers on 401
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(`{"error":"invalid or missing API key"}`))
+			if err != nil {
+				log.Printf("auth rejected: %s %s %s: %v", clientIP(r), r.Method, r.URL.Path, err)
+				respondUnauthorized(w)
 				return
 			}
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(withAPIKey(keys, r, name)))
 		})
 	}
 }
 
+// requireAPIKey checks the key on every method, including the GETs apiKeyMiddleware lets through.
+// A nil store means auth is disabled.
+func requireAPIKey(keys *apiKeyStore, next http.HandlerFunc) http.HandlerFunc {
+	if keys == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, err := keys.authenticate(r)
+		if err != nil {
+			respondUnauthorized(w)
+			return
+		}
+		next(w, r.WithContext(withAPIKey(keys, r, name)))
+	}
+}
+
+// requireAdminKey lets only admin keys (APIKey.Admin) through, on every method. Without a key
+// store there are no admin credentials, so the endpoint is closed; use the admin listener instead.
+func requireAdminKey(keys *apiKeyStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if keys == nil {
+			respondError(w, "admin endpoint: configure an admin API key or ADMIN_LISTEN_ADDR", http.StatusForbidden)
+			return
+		}
+		name, err := keys.authenticate(r)
+		if err != nil {
+			respondUnauthorized(w)
+			return
+		}
+		// A token minted by an admin key is still not an admin credential.
+		if !keys.isAdmin(name) || keys.viaToken(r) {
+			log.Printf("admin endpoint denied: %s %s key %q", clientIP(r), r.URL.Path, name)
+			respondError(w, "admin API key required", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(withAPIKey(keys, r, name)))
+	}
+}
+
+// hasValidAPIKey reports whether r carries a valid key or signature; requests without any
+// credentials aren't counted as auth failures.
+func hasValidAPIKey(keys *apiKeyStore, r *http.Request) bool {
+	if keys == nil || (requestAPIKey(r) == "" && !isSignedRequest(r)) {
+		return false
+	}
+	_, err := keys.authenticate(r)
+	return err == nil
+}
+
+// requestAPIKey returns the key from X-API-Key or "Authorization: Bearer <key>", or "".
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return key
+}
+
+func respondUnauthorized(w http.ResponseWriter) {
+	setCORSHeaders(w) // required so browser gets CORS headers on 401
+	respondErrorCode(w, "invalid or missing API key", "unauthorized", http.StatusUnauthorized)
+}
+
 // corsMiddleware follows the standard CORS pattern: set headers on every response,
 // reply to OPTIONS (preflight) without calling the handler, then pass through.
 func corsMiddleware(next http.Handler) http.Handler {
@@ -78,14 +159,3 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-func logMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-
-		if r.Method != http.MethodGet {
-			log.Printf("%s %s %v", r.Method, r.URL.Path, time.Since(start))
-		}
-	})
-}
@@ -0,0 +1,200 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Credential sources for Config.CredentialSources.
+const (
+	CredentialsStatic     = "static"      // AccessKey/SecretKey
+	CredentialsFile       = "file"        // CredentialsFile, re-read when it changes
+	CredentialsIAM        = "iam"         // EC2/ECS instance roles and web identity (IRSA) tokens
+	CredentialsAssumeRole = "assume-role" // STS AssumeRole at Endpoint with AccessKey/SecretKey
+)
+
+// credentialsFileCheckGap is how often a credentials file is checked for rotation.
+const credentialsFileCheckGap = 10 * time.Second
+
+// minioCredentials returns the MinIO credentials for cfg: the providers of cfg.CredentialSources
+// chained in order (the first one that yields keys is used until its keys expire), or the static
+// keys when no source is set. It fails when none of the sources yields keys.
+func minioCredentials(cfg Config) (*credentials.Credentials, error) {
+	sources := cfg.CredentialSources
+	if len(sources) == 0 {
+		return credentials.New(staticCredentials(cfg)), nil
+	}
+	var providers []credentials.Provider
+	for _, src := range sources {
+		switch src {
+		case CredentialsStatic:
+			providers = append(providers, staticCredentials(cfg))
+		case CredentialsFile:
+			if cfg.CredentialsFile == "" {
+				return nil, fmt.Errorf("credentials source %q needs a credentials file", src)
+			}
+			providers = append(providers, &fileCredentials{path: cfg.CredentialsFile, checkGap: credentialsFileCheckGap})
+		case CredentialsIAM:
+			providers = append(providers, &credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}})
+		case CredentialsAssumeRole:
+			scheme := "http://"
+			if cfg.UseSSL {
+				scheme = "https://"
+			}
+			providers = append(providers, &credentials.STSAssumeRole{
+				Client:      &http.Client{Transport: http.DefaultTransport},
+				STSEndpoint: scheme + cfg.Endpoint,
+				Options: credentials.STSAssumeRoleOptions{
+					AccessKey: cfg.AccessKey,
+					SecretKey: cfg.SecretKey,
+					RoleARN:   cfg.AssumeRoleARN,
+					Location:  cfg.Region,
+				},
+			})
+		default:
+			return nil, fmt.Errorf("unknown credentials source %q", src)
+		}
+	}
+	creds := credentials.NewChainCredentials(providers)
+	v, err := creds.Get()
+	if err != nil || v.SignerType.IsAnonymous() {
+		return nil, fmt.Errorf("no MinIO credentials from %s", strings.Join(sources, ", "))
+	}
+	log.Printf("MinIO credentials from %s", strings.Join(sources, ", "))
+	return creds, nil
+}
+
+// staticCredentials are AccessKey/SecretKey, or the keys of cfg's secret (see
+// Config.SecretsProvider), which change when the secret does.
+func staticCredentials(cfg Config) credentials.Provider {
+	if cfg.secrets != nil {
+		return &secretCredentials{w: cfg.secrets, accessKey: cfg.AccessKey, secretKey: cfg.SecretKey}
+	}
+	return &credentials.Static{Value: credentials.Value{
+		AccessKeyID: cfg.AccessKey, SecretAccessKey: cfg.SecretKey, SignerType: credentials.SignatureV4,
+	}}
+}
+
+// fileCredentials reads MinIO keys from a file that an external agent (Vault agent, a Kubernetes
+// secret mount) rewrites on rotation; keys are re-read when the file changes. The file is JSON,
+// {"accessKey":"...","secretKey":"...","sessionToken":"..."}, or a directory holding one file
+// per field (accessKey, secretKey, optional sessionToken), as a Kubernetes secret is mounted.
+type fileCredentials struct {
+	path     string
+	checkGap time.Duration
+
+	// Guarded by the lock of the credentials.Credentials wrapping the provider.
+	modTime time.Time
+	checked time.Time
+}
+
+func (f *fileCredentials) Retrieve() (credentials.Value, error) {
+	v, modTime, err := readCredentialsFile(f.path)
+	if err != nil {
+		log.Printf("minio credentials file %s: %v", f.path, err)
+		return credentials.Value{}, err
+	}
+	if !f.modTime.IsZero() {
+		log.Printf("minio credentials reloaded from %s", f.path)
+	}
+	f.modTime, f.checked = modTime, time.Now()
+	return v, nil
+}
+
+// IsExpired reports whether the file changed since it was read; a file that can't be read keeps
+// the old keys, so a rotation caught halfway doesn't break requests.
+func (f *fileCredentials) IsExpired() bool {
+	if time.Since(f.checked) < f.checkGap {
+		return false
+	}
+	f.checked = time.Now()
+	_, modTime, err := credentialsFileStat(f.path)
+	return err == nil && !modTime.Equal(f.modTime)
+}
+
+// credentialsFileStat returns the files holding the credentials at path and their latest
+// modification time.
+func credentialsFileStat(path string) ([]string, time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, fi.ModTime(), nil
+	}
+	var files []string
+	latest := time.Time{}
+	for _, name := range []string{"accessKey", "secretKey", "sessionToken"} {
+		file := filepath.Join(path, name)
+		fi, err := os.Stat(file)
+		if os.IsNotExist(err) && name == "sessionToken" {
+			continue
+		}
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		files = append(files, file)
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return files, latest, nil
+}
+
+func readCredentialsFile(path string) (credentials.Value, time.Time, error) {
+	files, modTime, err := credentialsFileStat(path)
+	if err != nil {
+		return credentials.Value{}, time.Time{}, err
+	}
+	var keys struct {
+		AccessKey    string `json:"accessKey"`
+		SecretKey    string `json:"secretKey"`
+		SessionToken string `json:"sessionToken"`
+	}
+	if len(files) == 1 && files[0] == path {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return credentials.Value{}, time.Time{}, err
+		}
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return credentials.Value{}, time.Time{}, fmt.Errorf("parse: %w", err)
+		}
+	} else {
+		fields := map[string]*string{"accessKey": &keys.AccessKey, "secretKey": &keys.SecretKey, "sessionToken": &keys.SessionToken}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return credentials.Value{}, time.Time{}, err
+			}
+			*fields[filepath.Base(file)] = strings.TrimSpace(string(data))
+		}
+	}
+	if keys.AccessKey == "" || keys.SecretKey == "" {
+		return credentials.Value{}, time.Time{}, fmt.Errorf("accessKey and secretKey are required")
+	}
+	return credentials.Value{
+		AccessKeyID:     keys.AccessKey,
+		SecretAccessKey: keys.SecretKey,
+		SessionToken:    keys.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, modTime, nil
+}
+
+// ParseCredentialSources splits a comma-separated MINIO_CREDENTIALS value.
+func ParseCredentialSources(raw string) []string {
+	var sources []string
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
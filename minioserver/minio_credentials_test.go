@@ -0,0 +1,110 @@
+package minioserver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMinioCredentials_FileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "minio.json")
+	if err := os.WriteFile(path, []byte(`{"accessKey":"ak1","secretKey":"sk1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := minioCredentials(Config{CredentialSources: []string{CredentialsFile, CredentialsStatic}, CredentialsFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := creds.Get(); v.AccessKeyID != "ak1" || v.SecretAccessKey != "sk1" {
+		t.Fatalf("keys = %s/%s, want ak1/sk1", v.AccessKeyID, v.SecretAccessKey)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"accessKey":"ak2","secretKey":"sk2","sessionToken":"tok"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := creds.Get(); v.AccessKeyID != "ak1" {
+		t.Errorf("keys re-read before the check gap: %s", v.AccessKeyID)
+	}
+
+	f := &fileCredentials{path: path}
+	if _, err := f.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if f.IsExpired() {
+		t.Error("unchanged file reported expired")
+	}
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !f.IsExpired() {
+		t.Error("rewritten file not reported expired")
+	}
+	if v, err := f.Retrieve(); err != nil || v.AccessKeyID != "ak2" || v.SessionToken != "tok" {
+		t.Errorf("after rotation: %+v, %v", v, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"accessKey":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if !f.IsExpired() {
+		t.Fatal("rewritten file not reported expired")
+	}
+	if _, err := f.Retrieve(); err == nil {
+		t.Error("half-written file accepted")
+	}
+}
+
+func TestMinioCredentials_SecretDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "accessKey"), []byte("ak\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "secretKey"), []byte("sk\n"), 0o600)
+	creds, err := minioCredentials(Config{CredentialSources: []string{CredentialsFile}, CredentialsFile: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := creds.Get(); v.AccessKeyID != "ak" || v.SecretAccessKey != "sk" || v.SessionToken != "" {
+		t.Errorf("keys = %+v", v)
+	}
+}
+
+func TestMinioCredentials_Invalid(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"unknown source":    {CredentialSources: []string{"vault"}},
+		"file without path": {CredentialSources: []string{CredentialsFile}},
+		"missing file":      {CredentialSources: []string{CredentialsFile}, CredentialsFile: filepath.Join(t.TempDir(), "none")},
+	} {
+		if _, err := minioCredentials(cfg); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	// The file is missing, so the chain falls back to the static keys.
+	creds, err := minioCredentials(Config{
+		CredentialSources: []string{CredentialsFile, CredentialsStatic},
+		CredentialsFile:   filepath.Join(t.TempDir(), "none"),
+		AccessKey:         "ak", SecretKey: "sk",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := creds.Get(); v.AccessKeyID != "ak" {
+		t.Errorf("fallback keys = %+v", v)
+	}
+}
+
+func TestParseCredentialSources(t *testing.T) {
+	if got := ParseCredentialSources(" File, static ,,"); !reflect.DeepEqual(got, []string{"file", "static"}) {
+		t.Errorf("ParseCredentialSources = %q", got)
+	}
+	if got := ParseCredentialSources(""); got != nil {
+		t.Errorf("ParseCredentialSources(\"\") = %q, want nil", got)
+	}
+}
@@ -0,0 +1,352 @@
+package minioserver
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	MountTypeObjects = "objects"
+	MountTypeStatic  = "static"
+	MountTypeWebDAV  = "webdav"
+)
+
+// Mount maps a URL route onto a bucket (and optional key prefix inside it).
+type Mount struct {
+	Route string `json:"route"` // URL path prefix ending in "/", e.g. "/app/"
+	// Host limits the mount to requests for that host name (e.g. "storage.kzen.app"), which
+	// take it over any mount of the same route without a host. Empty matches every host.
+	Host   string `json:"host,omitempty"`
+	Bucket string `json:"bucket"` // defaults to Config.Bucket
+	Prefix string `json:"prefix"` // key prefix inside Bucket, e.g. "kzen/frontend/"
+	Type   string `json:"type"`   // "objects" (default), "static" or "webdav"
+
+	// CacheMaxAge is the Cache-Control max-age in seconds for non-HTML files of a static mount;
+	// nil means defaultStaticMaxAge, so 0 can turn browser caching off.
+	CacheMaxAge *int `json:"cacheMaxAge,omitempty"`
+
+	// Features lists what an objects mount allows. Omitted means everything (the original
+	// behavior); when present, any capability not set to true is turned off.
+	Features *MountFeatures `json:"features,omitempty"`
+
+	// Retention locks every object uploaded through an objects mount (the bucket must have been
+	// created with object locking). nil uploads without lock settings.
+	Retention *MountRetention `json:"retention,omitempty"`
+
+	// StorageClass is the storage class of uploads through an objects mount, e.g.
+	// REDUCED_REDUNDANCY or a MinIO tier name; "" uses the bucket default. X-Storage-Class
+	// overrides it per request.
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// CORS replaces the global CORS headers for this mount's routes; nil keeps them.
+	CORS *MountCORS `json:"cors,omitempty"`
+}
+
+// MountRetention is the WORM setting applied to uploads of a mount.
+type MountRetention struct {
+	Mode      string `json:"mode"`      // "GOVERNANCE" or "COMPLIANCE"; "" for legal hold only
+	Days      int    `json:"days"`      // retain-until = upload time + Days
+	LegalHold bool   `json:"legalHold"` // put new objects under legal hold
+}
+
+// apply sets the lock fields of opts for an upload at now.
+func (rt *MountRetention) apply(opts *minio.PutObjectOptions, now time.Time) {
+	if rt == nil {
+		return
+	}
+	if rt.Mode != "" {
+		opts.Mode = minio.RetentionMode(rt.Mode)
+		opts.RetainUntilDate = now.AddDate(0, 0, rt.Days).UTC()
+	}
+	if rt.LegalHold {
+		opts.LegalHold = minio.LegalHoldEnabled
+	}
+}
+
+// MountFeatures are the per-mount capability switches of an objects mount.
+type MountFeatures struct {
+	Upload     bool `json:"upload"`     // POST/PUT, including ?append
+	Delete     bool `json:"delete"`     // DELETE
+	List       bool `json:"list"`       // HTML directory index of prefixes
+	Transform  bool `json:"transform"`  // GET ?render=1 HTML previews
+	PublicRead bool `json:"publicRead"` // GET/HEAD without the API key
+}
+
+var allMountFeatures = MountFeatures{Upload: true, Delete: true, List: true, Transform: true, PublicRead: true}
+
+func (m Mount) features() MountFeatures {
+	if m.Features == nil {
+		return allMountFeatures
+	}
+	return *m.Features
+}
+
+// ParseMounts reads mounts from a JSON array, e.g.
+// [{"route":"/app/","bucket":"kzen-storage","prefix":"kzen/frontend/","type":"static"}].
+// A value starting with "@" is read from that file path. Empty input yields no mounts.
+func ParseMounts(raw string) ([]Mount, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if file, ok := strings.CutPrefix(raw, "@"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read mounts file: %w", err)
+		}
+		raw = string(data)
+	}
+	var mounts []Mount
+	if err := json.Unmarshal([]byte(raw), &mounts); err != nil {
+		return nil, fmt.Errorf("parse mounts: %w", err)
+	}
+	for i := range mounts {
+		if err := mounts[i].normalize(); err != nil {
+			return nil, fmt.Errorf("mount %d: %w", i, err)
+		}
+	}
+	return mounts, nil
+}
+
+func (m *Mount) normalize() error {
+	m.Route = strings.TrimSpace(m.Route)
+	m.Host = strings.ToLower(strings.TrimSpace(m.Host))
+	if strings.ContainsAny(m.Host, ":/") {
+		return fmt.Errorf("host %q must be a bare host name, without scheme or port", m.Host)
+	}
+	if !strings.HasPrefix(m.Route, "/") {
+		return fmt.Errorf("route %q must start with /", m.Route)
+	}
+	if !strings.HasSuffix(m.Route, "/") {
+		m.Route += "/"
+	}
+	m.Prefix = strings.TrimPrefix(strings.TrimSpace(m.Prefix), "/")
+	if m.Prefix != "" && !strings.HasSuffix(m.Prefix, "/") {
+		m.Prefix += "/"
+	}
+	if m.Type == "" {
+		m.Type = MountTypeObjects
+	}
+	switch m.Type {
+	case MountTypeObjects, MountTypeStatic, MountTypeWebDAV:
+	default:
+		return fmt.Errorf("unknown type %q", m.Type)
+	}
+	if rt := m.Retention; rt != nil {
+		rt.Mode = strings.ToUpper(strings.TrimSpace(rt.Mode))
+		switch {
+		case rt.Mode != "" && !minio.RetentionMode(rt.Mode).IsValid():
+			return fmt.Errorf("retention mode %q must be GOVERNANCE or COMPLIANCE", rt.Mode)
+		case rt.Mode != "" && rt.Days <= 0:
+			return fmt.Errorf("retention days must be positive")
+		case rt.Mode == "" && !rt.LegalHold:
+			return fmt.Errorf("retention needs a mode or legalHold")
+		}
+	}
+	class, err := normalizeStorageClass(m.StorageClass)
+	if err != nil {
+		return err
+	}
+	m.StorageClass = class
+	if m.CORS != nil {
+		if err := m.CORS.normalize(); err != nil {
+			return err
+		}
+	}
+	if m.CacheMaxAge != nil && *m.CacheMaxAge < 0 {
+		return fmt.Errorf("cacheMaxAge must not be negative")
+	}
+	return nil
+}
+
+// defaultStaticMaxAge is the max-age of static mounts without a CacheMaxAge.
+const defaultStaticMaxAge = 3600
+
+// cacheMaxAge returns the max-age the static mount m serves non-HTML files with.
+func (m Mount) cacheMaxAge() int {
+	if m.CacheMaxAge == nil {
+		return defaultStaticMaxAge
+	}
+	return *m.CacheMaxAge
+}
+
+// defaultMounts are the built-in object routes. A MOUNTS entry with the same route replaces the
+// built-in one, e.g. to turn off DELETE on /kzen-storage-objects/.
+func defaultMounts(bucket string) []Mount {
+	return []Mount{
+		{Route: "/objects/", Bucket: bucket, Type: MountTypeObjects},
+		{Route: fmt.Sprintf("/%s-objects/", KZEN_STORAGE), Bucket: KZEN_STORAGE, Type: MountTypeObjects},
+	}
+}
+
+// servedMounts returns the mounts cfg serves, built-in ones included, with their buckets set.
+func servedMounts(cfg Config) []Mount {
+	mounts := mergeMounts(defaultMounts(cfg.Bucket), cfg.Mounts)
+	for i := range mounts {
+		if mounts[i].Bucket == "" {
+			mounts[i].Bucket = cfg.Bucket
+		}
+	}
+	return mounts
+}
+
+// pattern is the ServeMux pattern of m: its route, on its host if it has one.
+func (m Mount) pattern() string {
+	return m.Host + m.Route
+}
+
+// mergeMounts returns base with every entry of overrides either replacing the mount with the
+// same host and route or appended. A replacement keeps the bucket and prefix of the mount it
+// replaces unless it sets its own, so {"route":"/kzen-storage-objects/","features":...} still
+// serves kzen-storage.
+func mergeMounts(base, overrides []Mount) []Mount {
+	out := append([]Mount(nil), base...)
+	for _, m := range overrides {
+		replaced := false
+		for i := range out {
+			if out[i].pattern() == m.pattern() {
+				m.Bucket = cmp.Or(m.Bucket, out[i].Bucket)
+				m.Prefix = cmp.Or(m.Prefix, out[i].Prefix)
+				out[i] = m
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// mountHandler returns the handler for m: static site or the regular object proxy, with
+// m.Prefix prepended to every object key and m's feature flags enforced.
+func mountHandler(client *minio.Client, m Mount, opts proxyOptions) http.HandlerFunc {
+	switch m.Type {
+	case MountTypeStatic:
+		return staticSiteHandler(client, m)
+	case MountTypeWebDAV:
+		return webdavHandler(client, m, opts)
+	}
+	f := m.features()
+	opts.DirectoryIndex = opts.DirectoryIndex && f.List
+	opts.Retention = m.Retention
+	opts.StorageClass = m.StorageClass
+	opts.MountPrefix = m.Prefix
+	objects := objectsHandlerWithPrefix(client, m.Bucket, m.Route, opts)
+	render := renderHandler(client, m.Bucket, m.Route, opts)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if !f.PublicRead && opts.APIKeys != nil {
+				if _, err := opts.APIKeys.authenticate(r); err != nil {
+					respondUnauthorized(w)
+					return
+				}
+			} else if !opts.Hotlink.permits(w, r, opts.APIKeys) {
+				key := m.Prefix + strings.TrimPrefix(r.URL.Path, m.Route)
+				opts.Hotlink.respondBlocked(w, r, client, m.Bucket, key)
+				return
+			}
+		case http.MethodPost, http.MethodPut:
+			if !f.Upload {
+				respondError(w, "uploads are disabled on this route", http.StatusForbidden)
+				return
+			}
+			// Appending rewrites the object, which a locked object must not allow.
+			if m.Retention != nil && isAppend(r) {
+				respondError(w, "append is not allowed on a route with retention", http.StatusForbidden)
+				return
+			}
+		case http.MethodDelete:
+			if !f.Delete {
+				respondError(w, "deletes are disabled on this route", http.StatusForbidden)
+				return
+			}
+		}
+		if m.Prefix != "" {
+			r = r.Clone(r.Context())
+			r.URL.Path = m.Route + m.Prefix + strings.TrimPrefix(r.URL.Path, m.Route)
+		}
+		h := objects
+		if f.Transform && r.Method == http.MethodGet && r.URL.Query().Get("render") == "1" {
+			h = render
+		}
+		key := strings.TrimPrefix(r.URL.Path, m.Route)
+		withByteAccounting(opts.ByteStats, m.Bucket, key, w, r, h)
+	}
+}
+
+var (
+	errMountNotPublic = errors.New("the key is not publicly readable")
+	errMountNoUpload  = errors.New("uploads are disabled on this route")
+	errMountNoDelete  = errors.New("deletes are disabled on this route")
+)
+
+// servingMount returns the objects mount of mounts that serves key in bucket: the first whose
+// bucket and prefix hold it.
+func servingMount(mounts []Mount, bucket, key string) (Mount, bool) {
+	for _, m := range mounts {
+		if m.Type == MountTypeObjects && m.Bucket == bucket && strings.HasPrefix(key, m.Prefix) {
+			return m, true
+		}
+	}
+	return Mount{}, false
+}
+
+// mountPermits applies the flags of the mount serving key in bucket to a method on it from a
+// route outside the mounts, like /batch or /compose, so they reach no more than the mount's own
+// route: reads need PublicRead or an API key, uploads Upload and deletes Delete. A key no objects
+// mount serves is read only with an API key.
+func mountPermits(r *http.Request, mounts []Mount, opts proxyOptions, method, bucket, key string) error {
+	f := MountFeatures{Upload: true, Delete: true}
+	if m, ok := servingMount(mounts, bucket, key); ok {
+		f = m.features()
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		if !f.PublicRead && opts.APIKeys != nil {
+			if _, err := opts.APIKeys.authenticate(r); err != nil {
+				return errMountNotPublic
+			}
+		}
+	case http.MethodPost, http.MethodPut:
+		if !f.Upload {
+			return errMountNoUpload
+		}
+	case http.MethodDelete:
+		if !f.Delete {
+			return errMountNoDelete
+		}
+	}
+	return nil
+}
+
+// respondMountError replies to a mountPermits refusal as the mount's own route would.
+func respondMountError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMountNotPublic) {
+		respondUnauthorized(w)
+		return
+	}
+	respondError(w, err.Error(), http.StatusForbidden)
+}
+
+// mountGuarded applies mountPermits to routes that take the key from the path after pathPrefix,
+// e.g. /render/.
+func mountGuarded(mounts []Mount, bucket, pathPrefix string, opts proxyOptions, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := mountPermits(r, mounts, opts, r.Method, bucket, strings.TrimPrefix(r.URL.Path, pathPrefix)); err != nil {
+			respondMountError(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,180 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestMergeMounts_OverrideReplacesBuiltin(t *testing.T) {
+	overrides, err := ParseMounts(`[{"route":"/kzen-storage-objects/","bucket":"kzen-storage","features":{"upload":true}},{"route":"/extra/"}]`)
+	if err != nil {
+		t.Fatalf("ParseMounts: %v", err)
+	}
+	mounts := mergeMounts(defaultMounts("main"), overrides)
+	if len(mounts) != 3 {
+		t.Fatalf("got %d mounts, want 3: %+v", len(mounts), mounts)
+	}
+	if mounts[0].Route != "/objects/" || mounts[0].features() != allMountFeatures {
+		t.Errorf("built-in /objects/ changed: %+v", mounts[0])
+	}
+	if f := mounts[1].features(); !f.Upload || f.Delete || f.PublicRead {
+		t.Errorf("override features = %+v", f)
+	}
+	if mounts[2].Route != "/extra/" {
+		t.Errorf("extra mount not appended: %+v", mounts[2])
+	}
+}
+
+func TestMergeMounts_OverrideInheritsStorage(t *testing.T) {
+	overrides, err := ParseMounts(`[{"route":"/kzen-storage-objects/","features":{"publicRead":true}},{"route":"/app/","bucket":"web","prefix":"v2/"}]`)
+	if err != nil {
+		t.Fatalf("ParseMounts: %v", err)
+	}
+	base := append(defaultMounts("main"), Mount{Route: "/app/", Bucket: "web", Prefix: "v1/", Type: MountTypeStatic})
+	mounts := mergeMounts(base, overrides)
+	if m := mounts[1]; m.Bucket != KZEN_STORAGE || m.Prefix != "" || !m.features().PublicRead || m.features().Upload {
+		t.Errorf("override without a bucket: %+v", m)
+	}
+	if m := mounts[2]; m.Bucket != "web" || m.Prefix != "v2/" {
+		t.Errorf("override with its own prefix: %+v", m)
+	}
+	inherited := mergeMounts(base, []Mount{{Route: "/app/", Type: MountTypeStatic}})
+	if m := inherited[2]; m.Bucket != "web" || m.Prefix != "v1/" {
+		t.Errorf("override without bucket and prefix: %+v", m)
+	}
+}
+
+func TestMountHandler_EnforcesFeatures(t *testing.T) {
+	client, err := minio.New("localhost:9", &minio.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Mount{Route: "/files/", Bucket: "b", Type: MountTypeObjects, Features: &MountFeatures{}}
+	h := mountHandler(client, m, proxyOptions{APIKeys: newAPIKeyStore([]APIKey{{Name: "t", Key: "secret"}})})
+
+	cases := []struct {
+		method string
+		want   int
+	}{
+		{http.MethodPost, http.StatusForbidden},
+		{http.MethodPut, http.StatusForbidden},
+		{http.MethodDelete, http.StatusForbidden},
+		{http.MethodGet, http.StatusUnauthorized},
+		{http.MethodHead, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(tc.method, "/files/a.txt", nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.method, rec.Code, tc.want)
+		}
+	}
+}
+
+// /batch, /render/ and /compose serve the mounts' keys under the same flags as the mounts.
+func TestMountPermits_OtherRoutes(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["private.txt"] = []byte("private")
+	objects["public/notes.md"] = []byte("# Notes")
+	mounts := []Mount{
+		{Route: "/pub/", Bucket: "files", Prefix: "public/", Type: MountTypeObjects},
+		{Route: "/objects/", Bucket: "files", Type: MountTypeObjects, Features: &MountFeatures{}},
+	}
+	opts := proxyOptions{APIKeys: newAPIKeyStore([]APIKey{{Name: "t", Key: "secret"}})}
+	batch := batchHandler(client, "files", mounts, opts)
+	render := mountGuarded(mounts, "files", "/render/", opts, renderHandler(client, "files", "/render/", opts))
+	compose := composeHandler(client, "files", mounts, opts)
+
+	cases := []struct {
+		h      http.HandlerFunc
+		method string
+		target string
+		body   string
+		key    bool
+		want   int
+	}{
+		{batch, http.MethodGet, "/batch?keys=public/notes.md", "", false, http.StatusOK},
+		{batch, http.MethodGet, "/batch?keys=public/notes.md,private.txt", "", false, http.StatusUnauthorized},
+		{batch, http.MethodGet, "/batch?keys=private.txt", "", true, http.StatusOK},
+		{batch, http.MethodDelete, "/batch?keys=private.txt", "", true, http.StatusForbidden},
+		{render, http.MethodGet, "/render/public/notes.md", "", false, http.StatusOK},
+		{render, http.MethodGet, "/render/private.txt", "", false, http.StatusUnauthorized},
+		{compose, http.MethodPost, "/compose", `{"sources":["public/notes.md"],"destination":"copy.md"}`, true, http.StatusForbidden},
+		{compose, http.MethodPost, "/compose", `{"sources":["private.txt"],"destination":"public/x.txt","deleteSources":true}`, true, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+		if tc.key {
+			req.Header.Set("X-API-Key", "secret")
+		}
+		rec := httptest.NewRecorder()
+		tc.h(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s %s: status = %d, want %d (%s)", tc.method, tc.target, tc.body, rec.Code, tc.want, rec.Body)
+		}
+	}
+	if _, ok := objects["private.txt"]; !ok {
+		t.Error("private.txt deleted")
+	}
+}
+
+func TestParseMounts_Retention(t *testing.T) {
+	mounts, err := ParseMounts(`[{"route":"/legal/","retention":{"mode":"compliance","days":30,"legalHold":true}}]`)
+	if err != nil {
+		t.Fatalf("ParseMounts: %v", err)
+	}
+	var opts minio.PutObjectOptions
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mounts[0].Retention.apply(&opts, now)
+	if opts.Mode != minio.Compliance || !opts.RetainUntilDate.Equal(now.AddDate(0, 0, 30)) || opts.LegalHold != minio.LegalHoldEnabled {
+		t.Errorf("put options = mode %q until %v hold %q", opts.Mode, opts.RetainUntilDate, opts.LegalHold)
+	}
+
+	for _, bad := range []string{
+		`[{"route":"/x/","retention":{"mode":"forever","days":1}}]`,
+		`[{"route":"/x/","retention":{"mode":"GOVERNANCE"}}]`,
+		`[{"route":"/x/","retention":{}}]`,
+	} {
+		if _, err := ParseMounts(bad); err == nil {
+			t.Errorf("ParseMounts(%s) accepted", bad)
+		}
+	}
+}
+
+func TestMounts_Host(t *testing.T) {
+	overrides, err := ParseMounts(`[{"host":"Storage.kzen.app","route":"/","bucket":"kzen-storage"},{"host":"files.other.app","route":"/objects/","bucket":"other"}]`)
+	if err != nil {
+		t.Fatalf("ParseMounts: %v", err)
+	}
+	mounts := mergeMounts(defaultMounts("main"), overrides)
+	if len(mounts) != 4 {
+		t.Fatalf("host mounts replaced a built-in one: %+v", mounts)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("health")) })
+	for _, m := range mounts {
+		mux.HandleFunc(m.pattern(), func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(m.Bucket)) })
+	}
+	for target, want := range map[string]string{
+		"http://storage.kzen.app:8080/a.png":   "kzen-storage",
+		"http://storage.kzen.app/health":       "kzen-storage",
+		"http://files.other.app/objects/a.png": "other",
+		"http://files.other.app/health":        "health",
+		"http://localhost/objects/a.png":       "main",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Body.String() != want {
+			t.Errorf("%s served by %q, want %q", target, rec.Body.String(), want)
+		}
+	}
+
+	if _, err := ParseMounts(`[{"host":"https://storage.kzen.app","route":"/"}]`); err == nil {
+		t.Error("host with a scheme accepted")
+	}
+}
@@ -1,7 +1,6 @@
 package movestorymessages
 
 import (
-	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -15,6 +14,8 @@ import (
 	"time"
 
 	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
 )
 
 type csvRow struct {
@@ -105,7 +106,7 @@ func Handler(client *minio.Client, bucket string) http.HandlerFunc {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Minute)
+		ctx, cancel := golib.RequestContext(r, 30*time.Minute)
 		defer cancel()
 
 		result := moveResult{
@@ -0,0 +1,103 @@
+package minioserver
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kzen-go/golib"
+)
+
+func multipartRequest(t *testing.T, files map[string]int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("keys", "a")
+	for name, size := range files {
+		fw, err := mw.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(bytes.Repeat([]byte("x"), size))
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/batch", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestBatchPost_MultipartLimits(t *testing.T) {
+	opts := proxyOptions{Multipart: golib.MultipartLimits{MaxFileBytes: 1024, MaxFiles: 2}}
+
+	cases := []struct {
+		name  string
+		files map[string]int
+		msg   string
+	}{
+		{"file too large", map[string]int{"big.bin": 2048}, "big.bin"},
+		{"too many files", map[string]int{"a": 1, "b": 1, "c": 1}, "3 files"},
+		{"body over total cap", map[string]int{"a": 1 << 20, "b": 1 << 20}, "request body exceeds"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		batchPost(nil, "b", nil, opts, rec, multipartRequest(t, c.files))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status = %d, want 413 (%s)", c.name, rec.Code, rec.Body.String())
+			continue
+		}
+		if !strings.Contains(rec.Body.String(), c.msg) {
+			t.Errorf("%s: body %q does not mention %q", c.name, rec.Body.String(), c.msg)
+		}
+	}
+}
+
+func TestCleanupMiddleware_RemovesSpilledFilesOnPanic(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	limits := golib.MultipartLimits{MaxMemory: 1}
+	h := cleanupMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := limits.ParseMultipartForm(w, r); err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) == 0 {
+			t.Fatal("expected the file part to spill to disk")
+		}
+		panic("handler failed")
+	}))
+
+	func() {
+		defer func() { recover() }()
+		h.ServeHTTP(httptest.NewRecorder(), multipartRequest(t, map[string]int{"a.bin": 64 << 10}))
+	}()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("temp files left after panic: %v", entries)
+	}
+}
+
+func TestSweepMultipartTemp_RemovesOnlyStaleSpillFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-3 * time.Hour)
+	for _, name := range []string{"multipart-1", "multipart-2", "other"} {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, []byte("x"), 0o600)
+		if name != "multipart-2" {
+			os.Chtimes(p, old, old)
+		}
+	}
+	n, err := golib.SweepMultipartTemp(dir, multipartTempMaxAge)
+	if err != nil || n != 1 {
+		t.Fatalf("sweep = %d, %v; want 1", n, err)
+	}
+	for _, name := range []string{"multipart-2", "other"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s removed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// objectLockClient is the part of *minio.Client the legal hold endpoint uses.
+type objectLockClient interface {
+	GetObjectLegalHold(ctx context.Context, bucket, object string, opts minio.GetObjectLegalHoldOptions) (*minio.LegalHoldStatus, error)
+	PutObjectLegalHold(ctx context.Context, bucket, object string, opts minio.PutObjectLegalHoldOptions) error
+	GetObjectRetention(ctx context.Context, bucket, object, versionID string) (*minio.RetentionMode, *time.Time, error)
+}
+
+// objectLockState is the lock of one object version as reported by GET /admin/legal-hold.
+type objectLockState struct {
+	Bucket          string     `json:"bucket"`
+	Key             string     `json:"key"`
+	VersionID       string     `json:"versionId,omitempty"`
+	LegalHold       bool       `json:"legalHold"`
+	Mode            string     `json:"mode,omitempty"`
+	RetainUntilDate *time.Time `json:"retainUntilDate,omitempty"`
+}
+
+// noLockConfig reports whether err only says the object has no hold or retention set.
+func noLockConfig(err error) bool {
+	return golib.MinioErrorResponse(err).Code == "NoSuchObjectLockConfiguration"
+}
+
+// legalHoldHandler serves the admin legal hold endpoint for ?bucket= (default defaultBucket),
+// ?key= and optionally ?versionId=:
+//
+//	GET    /admin/legal-hold  legal hold and retention of the object
+//	PUT    /admin/legal-hold  place a legal hold
+//	DELETE /admin/legal-hold  release the legal hold
+func legalHoldHandler(client objectLockClient, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		bucket := q.Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		key := strings.TrimPrefix(q.Get("key"), "/")
+		if key == "" {
+			respondError(w, "key query parameter required", http.StatusBadRequest)
+			return
+		}
+		versionID := q.Get("versionId")
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		var status minio.LegalHoldStatus
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut:
+			status = minio.LegalHoldEnabled
+		case http.MethodDelete:
+			status = minio.LegalHoldDisabled
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if status != "" {
+			err := client.PutObjectLegalHold(ctx, bucket, key, minio.PutObjectLegalHoldOptions{Status: &status, VersionID: versionID})
+			if err != nil {
+				log.Printf("set legal hold %s on %s/%s: %v", status, bucket, key, err)
+				respondStorageError(w, err, "failed to set legal hold: "+golib.MinioErrorResponse(err).Message)
+				return
+			}
+			log.Printf("legal hold %s on %s/%s set by %q", status, bucket, key, apiKeyName(r.Context()))
+		}
+
+		state := objectLockState{Bucket: bucket, Key: key, VersionID: versionID}
+		hold, err := client.GetObjectLegalHold(ctx, bucket, key, minio.GetObjectLegalHoldOptions{VersionID: versionID})
+		if err != nil && !noLockConfig(err) {
+			log.Printf("get legal hold %s/%s: %v", bucket, key, err)
+			respondStorageError(w, err, "failed to get legal hold: "+golib.MinioErrorResponse(err).Message)
+			return
+		}
+		state.LegalHold = hold != nil && *hold == minio.LegalHoldEnabled
+		mode, until, err := client.GetObjectRetention(ctx, bucket, key, versionID)
+		if err != nil && !noLockConfig(err) {
+			log.Printf("get retention %s/%s: %v", bucket, key, err)
+			respondStorageError(w, err, "failed to get retention: "+golib.MinioErrorResponse(err).Message)
+			return
+		}
+		if mode != nil {
+			state.Mode = mode.String()
+			state.RetainUntilDate = until
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	}
+}
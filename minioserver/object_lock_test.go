@@ -0,0 +1,73 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+type mockLockClient struct {
+	holds map[string]minio.LegalHoldStatus
+	until time.Time
+}
+
+func (m *mockLockClient) GetObjectLegalHold(_ context.Context, _, object string, _ minio.GetObjectLegalHoldOptions) (*minio.LegalHoldStatus, error) {
+	s, ok := m.holds[object]
+	if !ok {
+		return nil, minio.ErrorResponse{Code: "NoSuchObjectLockConfiguration", StatusCode: http.StatusNotFound}
+	}
+	return &s, nil
+}
+
+func (m *mockLockClient) PutObjectLegalHold(_ context.Context, _, object string, opts minio.PutObjectLegalHoldOptions) error {
+	m.holds[object] = *opts.Status
+	return nil
+}
+
+func (m *mockLockClient) GetObjectRetention(_ context.Context, _, object, _ string) (*minio.RetentionMode, *time.Time, error) {
+	if m.until.IsZero() {
+		return nil, nil, minio.ErrorResponse{Code: "NoSuchObjectLockConfiguration", StatusCode: http.StatusNotFound}
+	}
+	mode := minio.Governance
+	return &mode, &m.until, nil
+}
+
+func TestLegalHoldHandler(t *testing.T) {
+	client := &mockLockClient{holds: map[string]minio.LegalHoldStatus{}}
+	h := legalHoldHandler(client, "b")
+	do := func(method string) objectLockState {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(method, "/admin/legal-hold?key=kzen/contract.pdf", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s = %d %s", method, rec.Code, rec.Body.String())
+		}
+		var s objectLockState
+		if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if s := do(http.MethodGet); s.LegalHold || s.Mode != "" || s.Bucket != "b" {
+		t.Errorf("unlocked object = %+v", s)
+	}
+	if s := do(http.MethodPut); !s.LegalHold {
+		t.Errorf("after PUT legalHold = false")
+	}
+	client.until = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if s := do(http.MethodDelete); s.LegalHold || s.Mode != "GOVERNANCE" || s.RetainUntilDate == nil {
+		t.Errorf("after DELETE = %+v", s)
+	}
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, "/admin/legal-hold", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing key: status %d, want 400", rec.Code)
+	}
+}
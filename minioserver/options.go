@@ -0,0 +1,136 @@
+package minioserver
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kzen-go/golib"
+)
+
+// proxyOptions tunes the object proxy handlers; the zero value keeps the original behavior.
+type proxyOptions struct {
+	// DirectoryIndex renders an HTML listing for browser GETs of prefixes ending in "/".
+	DirectoryIndex bool
+	// ParallelGetThreshold is the object size from which GETs fetch byte ranges from MinIO in
+	// parallel; 0 disables parallel GETs.
+	ParallelGetThreshold int64
+	// ParallelGetWorkers is the number of ranges fetched concurrently per parallel GET.
+	ParallelGetWorkers int
+	// DownloadBytesPerSec limits each download; 0 means unlimited.
+	DownloadBytesPerSec int64
+	// DownloadLimiter is shared by all downloads (global bandwidth cap); nil means unlimited.
+	DownloadLimiter *byteRateLimiter
+	// UploadSlots bounds concurrent PutObject calls across all upload handlers; nil means unlimited.
+	UploadSlots *golib.Semaphore
+	// FetchMaxBytes caps files downloaded by POST /fetch.
+	FetchMaxBytes int64
+	// Multipart bounds multipart form parsing for uploads.
+	Multipart golib.MultipartLimits
+	// ByteStats accumulates bytes in/out per key prefix; nil disables accounting.
+	ByteStats *byteAccounting
+	// Hotlink restricts public reads on object mounts by Origin/Referer; nil allows all.
+	Hotlink *hotlinkPolicy
+	// NotFoundImageKey is an image in the requested bucket served with NotFoundImageStatus
+	// (404 or 200) to image GETs of missing objects; "" keeps the plain 404.
+	NotFoundImageKey    string
+	NotFoundImageStatus int
+	// APIKeys are enforced on GETs of mounts that turn off public reads; nil means auth is off.
+	APIKeys *apiKeyStore
+	// Retry re-runs object reads denied by MinIO; zero fields take defaultRetryPolicy's values.
+	Retry retryPolicy
+	// Retention is the object lock applied to uploads; nil uploads without lock settings.
+	Retention *MountRetention
+	// StorageClass is the default storage class of uploads; "" uses the bucket default.
+	StorageClass string
+	// Processors rewrite uploads before they are stored (not appends); nil stores them as sent.
+	Processors []ProcessorFunc
+	// SVG is how SVG objects are served; the zero value serves them as stored.
+	SVG svgPolicy
+	// QuarantineWebhook is told about uploads processors quarantined; nil tells no one.
+	QuarantineWebhook *webhook
+	// UploadWebhook is told about stored uploads, proxied or confirmed; nil tells no one.
+	UploadWebhook *webhook
+	// Alerts is told about batch deletes; nil raises no alerts.
+	Alerts *alerter
+	// Aliases answers GET misses of moved keys; nil answers them 404.
+	Aliases *aliasTable
+	// MountPrefix is the key prefix of the mount being served, for alias redirects.
+	MountPrefix string
+	// SoftDelete moves deleted objects to the trash instead of removing them.
+	SoftDelete bool
+	// Purge is told about overwritten and deleted objects; nil purges nothing.
+	Purge *cdnPurger
+	// ReadCache serves small objects from memory, stale while revalidating or when MinIO fails;
+	// nil reads every object from MinIO.
+	ReadCache *readCache
+}
+
+func (o proxyOptions) retry() retryPolicy {
+	p := o.Retry
+	if p.Attempts == 0 {
+		p.Attempts = defaultRetryPolicy.Attempts
+	}
+	if p.Delay == 0 {
+		p.Delay = defaultRetryPolicy.Delay
+	}
+	return p
+}
+
+// changed is called after key in bucket was overwritten or deleted.
+func (o proxyOptions) changed(bucket, key string) {
+	o.Purge.changed(bucket, key)
+	o.ReadCache.forget(bucket, key)
+}
+
+// hiddenKey reports whether key in bucket is one of the proxy's own objects, which no route
+// serves, lists or writes: quarantined uploads, the trash, stored reports and the alias table.
+func hiddenKey(opts proxyOptions, bucket, key string) bool {
+	return isQuarantineKey(key) || isTrashKey(key) || isReportKey(key) || opts.Aliases.isTableKey(bucket, key)
+}
+
+func proxyOptionsFromConfig(cfg Config) proxyOptions {
+	opts := proxyOptions{
+		DirectoryIndex:       cfg.DirectoryIndex,
+		ParallelGetThreshold: cfg.ParallelGetThreshold,
+		ParallelGetWorkers:   cfg.ParallelGetWorkers,
+		DownloadBytesPerSec:  cfg.MaxDownloadBytesPerSec,
+		DownloadLimiter:      newByteRateLimiter(cfg.MaxTotalDownloadBytesPerSec),
+		UploadSlots:          golib.NewSemaphore(cfg.MaxConcurrentUploads, cfg.UploadQueueSize, cfg.UploadQueueTimeout),
+		FetchMaxBytes:        cfg.FetchMaxBytes,
+		ByteStats:            newByteAccounting(cfg.ByteStatsPrefixDepth),
+		NotFoundImageKey:     strings.TrimPrefix(cfg.NotFoundImageKey, "/"),
+		NotFoundImageStatus:  cfg.NotFoundImageStatus,
+		Hotlink:              newHotlinkPolicy(cfg.HotlinkAllowedDomains, cfg.HotlinkAllowEmptyReferer, cfg.HotlinkPlaceholderKey),
+		Retry:                retryPolicy{Attempts: cfg.ReadRetryAttempts, Delay: cfg.ReadRetryDelay},
+		SVG:                  svgPolicy{mode: cfg.SVGMode, rasterizer: cfg.SVGRasterizer},
+		QuarantineWebhook:    newWebhook(cfg.QuarantineWebhookURL),
+		UploadWebhook:        newWebhook(cfg.UploadWebhookURL),
+		SoftDelete:           cfg.SoftDelete,
+		ReadCache: newReadCache(cfg.ReadCacheBytes, cfg.ReadCacheObjectMaxBytes, cfg.ReadCacheTTL,
+			cfg.ReadCacheStaleWhileRevalidate, cfg.ReadCacheStaleIfError),
+	}
+	opts.Multipart = golib.MultipartLimits{
+		MaxMemory:    cfg.MultipartMaxMemory,
+		MaxFileBytes: cfg.UploadMaxFileBytes,
+		MaxFiles:     cfg.UploadMaxFiles,
+	}
+	if opts.NotFoundImageStatus != http.StatusOK {
+		opts.NotFoundImageStatus = http.StatusNotFound
+	}
+	if opts.FetchMaxBytes <= 0 {
+		opts.FetchMaxBytes = 20 << 20
+	}
+	if opts.ParallelGetWorkers <= 0 {
+		opts.ParallelGetWorkers = 4
+	}
+	return opts
+}
+
+// respondUploadBusy replies 503 with Retry-After when no upload slot could be taken.
+func respondUploadBusy(w http.ResponseWriter, slots *golib.Semaphore, err error) {
+	log.Printf("upload rejected: %v (%d slots in use)", err, slots.InUse())
+	w.Header().Set("Retry-After", strconv.Itoa(slots.RetryAfter()))
+	respondErrorCode(w, "upload capacity exceeded, retry later", "upload_busy", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,88 @@
+package minioserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+	"kzen-go/minioserver/media-handlers"
+)
+
+// ownerMeta is the user metadata (x-amz-meta-owner) naming the API key that uploaded an object.
+// It is stamped on uploads while auth is on, and then only that key, or an admin key, may
+// overwrite or delete the object. Objects without an owner (uploaded before auth, or by tools
+// going to MinIO directly) stay writable by every key.
+const ownerMeta = "Owner"
+
+// errNotOwner refuses a change to an object another API key uploaded; the image upload handlers
+// share it.
+var errNotOwner = mediahandlers.ErrNotOwner
+
+type objectStater interface {
+	StatObject(ctx context.Context, bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+}
+
+// ownsObjects reports whether uploads are stamped with their owner and changes checked against it.
+func (o proxyOptions) ownsObjects() bool {
+	return o.APIKeys != nil
+}
+
+// stampOwner returns meta with the Owner of an upload by the request's key added.
+func (o proxyOptions) stampOwner(ctx context.Context, meta map[string]string) map[string]string {
+	name := apiKeyName(ctx)
+	if !o.ownsObjects() || name == "" {
+		return meta
+	}
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta[ownerMeta] = name
+	return meta
+}
+
+// mayModify returns errNotOwner when info was uploaded by another key than the request's and
+// that key is not an admin key.
+func (o proxyOptions) mayModify(ctx context.Context, info minio.ObjectInfo) error {
+	if !o.ownsObjects() || apiKeyIsAdmin(ctx) {
+		return nil
+	}
+	if owner := info.UserMetadata[ownerMeta]; owner != "" && owner != apiKeyName(ctx) {
+		return errNotOwner
+	}
+	return nil
+}
+
+// checkOwner stats key and applies mayModify; a missing object may always be written.
+func (o proxyOptions) checkOwner(ctx context.Context, client objectStater, bucket, key string) error {
+	if !o.ownsObjects() || apiKeyIsAdmin(ctx) {
+		return nil
+	}
+	info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if golib.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return o.mayModify(ctx, info)
+}
+
+// ownerErrorStatus is the HTTP status of a checkOwner error.
+func ownerErrorStatus(err error) int {
+	if errors.Is(err, errNotOwner) {
+		return http.StatusForbidden
+	}
+	return golib.MinioStatus(err)
+}
+
+// respondOwnerError answers a failed checkOwner: 403 not_owner, or the storage error.
+func respondOwnerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNotOwner) {
+		respondErrorCode(w, err.Error(), "not_owner", http.StatusForbidden)
+		return
+	}
+	respondStorageError(w, err, "failed to get object info")
+}
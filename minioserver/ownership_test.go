@@ -0,0 +1,68 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestOwnership_OnlyOwnerOrAdminModifies(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["legacy.txt"] = []byte("old")
+	store := newAPIKeyStore([]APIKey{{Name: "web", Key: "web-key"}, {Name: "app", Key: "app-key"}, {Name: "ops", Key: "ops-key", Admin: true}})
+	// A pass-through processor buffers uploads, so they are sent in one PUT: selfTestS3 has no
+	// multipart uploads.
+	buffer := func(_ context.Context, _ *Upload, data []byte) ([]byte, error) { return data, nil }
+	opts := proxyOptions{APIKeys: store, Processors: []ProcessorFunc{buffer}}
+	put := proxyPostWithPrefix(client, "files", "/objects/", opts)
+	del := proxyDeleteWithPrefix(client, "files", "/objects/", opts)
+	h := apiKeyMiddleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			del(w, r)
+			return
+		}
+		put(w, r)
+	}))
+	send := func(method, target, key string) (int, string) {
+		req := httptest.NewRequest(method, target, strings.NewReader("data"))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var body struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body.Code
+	}
+
+	if code, _ := send(http.MethodPut, "/objects/a.txt", "web-key"); code != http.StatusCreated {
+		t.Fatalf("upload: %d", code)
+	}
+	info, err := client.StatObject(t.Context(), "files", "a.txt", minio.StatObjectOptions{})
+	if err != nil || info.UserMetadata[ownerMeta] != "web" {
+		t.Fatalf("owner metadata %v, %v", info.UserMetadata, err)
+	}
+	if code, errCode := send(http.MethodPut, "/objects/a.txt", "app-key"); code != http.StatusForbidden || errCode != "not_owner" {
+		t.Errorf("overwrite by another key: %d %q", code, errCode)
+	}
+	if code, _ := send(http.MethodDelete, "/objects/a.txt", "app-key"); code != http.StatusForbidden {
+		t.Errorf("delete by another key: %d", code)
+	}
+	if code, _ := send(http.MethodPut, "/objects/a.txt", "web-key"); code != http.StatusCreated {
+		t.Errorf("overwrite by the owner: %d", code)
+	}
+	if code, _ := send(http.MethodPut, "/objects/legacy.txt", "app-key"); code != http.StatusCreated {
+		t.Errorf("overwrite of an object without owner: %d", code)
+	}
+	if code, _ := send(http.MethodDelete, "/objects/a.txt", "ops-key"); code != http.StatusOK {
+		t.Errorf("delete by an admin key: %d", code)
+	}
+	if _, ok := objects["a.txt"]; ok {
+		t.Error("object not deleted")
+	}
+}
@@ -0,0 +1,111 @@
+package minioserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// defaultParallelGetChunk is the byte range fetched by each worker of a parallel GET.
+const defaultParallelGetChunk = 8 << 20
+
+// rangeFetchFunc returns bytes [off, off+n) of an object.
+type rangeFetchFunc func(ctx context.Context, off, n int64) ([]byte, error)
+
+type rangeChunk struct {
+	data []byte
+	err  error
+}
+
+// parallelRangeReader streams an object of known size by fetching up to workers byte ranges
+// concurrently and emitting them in order. At most workers chunks are buffered at a time.
+type parallelRangeReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (p *parallelRangeReader) Close() error {
+	p.cancel()
+	return p.PipeReader.Close()
+}
+
+func newParallelRangeReader(ctx context.Context, size, chunkSize int64, workers int, fetch rangeFetchFunc) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	queue := make(chan chan rangeChunk, workers)
+
+	// Producer: start one fetch per chunk, blocking while workers results are pending.
+	go func() {
+		defer close(queue)
+		for off := int64(0); off < size; off += chunkSize {
+			n := min(chunkSize, size-off)
+			ch := make(chan rangeChunk, 1)
+			select {
+			case queue <- ch:
+			case <-ctx.Done():
+				return
+			}
+			go func(off, n int64) {
+				data, err := fetch(ctx, off, n)
+				if err == nil && int64(len(data)) != n {
+					err = fmt.Errorf("range %d-%d: got %d bytes", off, off+n-1, len(data))
+				}
+				ch <- rangeChunk{data: data, err: err}
+			}(off, n)
+		}
+	}()
+
+	// Consumer: write chunks in order; any failure aborts the remaining fetches.
+	go func() {
+		defer cancel()
+		for ch := range queue {
+			var res rangeChunk
+			select {
+			case res = <-ch:
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+				return
+			}
+			if res.err != nil {
+				pw.CloseWithError(res.err)
+				return
+			}
+			if _, err := pw.Write(res.data); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	return &parallelRangeReader{PipeReader: pr, cancel: cancel}
+}
+
+// minioRangeFetcher reads byte ranges of bucket/objectKey, pinned to etag so a concurrent overwrite
+// can't mix two versions in one response.
+func minioRangeFetcher(client *minio.Client, bucket, objectKey, etag string, retry retryPolicy) rangeFetchFunc {
+	return func(ctx context.Context, off, n int64) ([]byte, error) {
+		opts := minio.GetObjectOptions{}
+		if err := opts.SetRange(off, off+n-1); err != nil {
+			return nil, err
+		}
+		if etag != "" {
+			opts.SetMatchETag(etag)
+		}
+		data := make([]byte, n)
+		err := retry.do(ctx, "range", func() error {
+			obj, err := client.GetObject(ctx, bucket, objectKey, opts)
+			if err != nil {
+				return err
+			}
+			defer obj.Close()
+			_, err = io.ReadFull(obj, data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+}
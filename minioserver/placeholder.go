@@ -0,0 +1,47 @@
+package minioserver
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// placeholderHeader tells the client it got a stand-in image, not the object it asked for.
+const placeholderHeader = "X-Placeholder"
+
+// servePlaceholder answers r with the image at key in bucket and the given status, marked with
+// X-Placeholder: reason and never cached (the real object may appear later). It returns false,
+// having written nothing, when the placeholder can't be read so the caller can send its own error.
+func servePlaceholder(w http.ResponseWriter, r *http.Request, client *minio.Client, bucket, key string, status int, reason string) bool {
+	ctx, cancel := golib.RequestContext(r, 30*time.Second)
+	defer cancel()
+	obj, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		log.Printf("placeholder %q bucket=%q: %v", key, bucket, err)
+		return false
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		log.Printf("placeholder %q bucket=%q: %v", key, bucket, err)
+		return false
+	}
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(placeholderHeader, reason)
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return true
+	}
+	if _, err := copyPooled(w, obj); err != nil {
+		log.Printf("placeholder %q: %v", key, err)
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+func init() {
+	metrics.describe("kzen_prefetch_total", "counter", "Keys named by POST /prefetch, by result (warmed|cached|too_large|failed|dropped).")
+}
+
+const (
+	// prefetchMaxKeys bounds the keys of one POST /prefetch.
+	prefetchMaxKeys = 200
+	// prefetchQueue bounds the keys waiting to be warmed across all requests; further keys are
+	// dropped, so prefetching never backs up behind a slow MinIO.
+	prefetchQueue   = 1000
+	prefetchWorkers = 4
+)
+
+type prefetchJob struct {
+	bucket, key string
+}
+
+// prefetcher warms the read cache with objects the frontend expects to need soon (the next page
+// of a gallery), a few at a time in the background.
+type prefetcher struct {
+	client  *minio.Client
+	cache   *readCache
+	retry   retryPolicy
+	opts    proxyOptions
+	buckets map[string]bool
+	queue   chan prefetchJob
+}
+
+func newPrefetcher(client *minio.Client, opts proxyOptions, buckets []string) *prefetcher {
+	p := &prefetcher{
+		client:  client,
+		cache:   opts.ReadCache,
+		retry:   opts.retry(),
+		opts:    opts,
+		buckets: map[string]bool{},
+		queue:   make(chan prefetchJob, prefetchQueue),
+	}
+	for _, b := range buckets {
+		p.buckets[b] = true
+	}
+	return p
+}
+
+// run warms queued keys with prefetchWorkers workers until ctx is done.
+func (p *prefetcher) run(ctx context.Context) {
+	for range prefetchWorkers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.queue:
+					p.warm(ctx, job)
+				}
+			}
+		}()
+	}
+}
+
+func (p *prefetcher) warm(ctx context.Context, job prefetchJob) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	load := minioCacheLoader(p.client, job.bucket, job.key, p.retry, p.cache.maxObject)
+	result, err := p.cache.warm(ctx, job.bucket, job.key, load, time.Now())
+	if err != nil && !golib.IsNotFound(err) {
+		log.Printf("prefetch %s/%s: %v", job.bucket, job.key, err)
+	}
+	metrics.add("kzen_prefetch_total", 1, "result", result)
+}
+
+// prefetchHandler serves POST /prefetch {"bucket": "...", "keys": ["..."]} (bucket defaults to
+// defaultBucket; keys are full object keys). It answers 202 at once with how many keys were
+// queued; the objects are read into the cache afterwards.
+func prefetchHandler(p *prefetcher, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Bucket string   `json:"bucket"`
+			Keys   []string `json:"keys"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || len(req.Keys) == 0 {
+			respondError(w, `body must be {"keys": ["..."]}`, http.StatusBadRequest)
+			return
+		}
+		if len(req.Keys) > prefetchMaxKeys {
+			respondError(w, "too many keys", http.StatusBadRequest)
+			return
+		}
+		if req.Bucket == "" {
+			req.Bucket = defaultBucket
+		}
+		if !p.buckets[req.Bucket] {
+			respondError(w, "unknown bucket", http.StatusBadRequest)
+			return
+		}
+
+		queued, dropped := 0, 0
+		for _, key := range req.Keys {
+			key = strings.TrimPrefix(key, "/")
+			if key == "" || strings.HasSuffix(key, "/") || hiddenKey(p.opts, req.Bucket, key) {
+				continue
+			}
+			select {
+			case p.queue <- prefetchJob{bucket: req.Bucket, key: key}:
+				queued++
+			default:
+				dropped++
+				metrics.add("kzen_prefetch_total", 1, "result", "dropped")
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"bucket": req.Bucket, "queued": queued, "dropped": dropped})
+	}
+}
+
+// warm loads key into the cache unless a fresh copy is already there, and returns the
+// kzen_prefetch_total result. Unlike get it counts nothing as a cache request.
+func (c *readCache) warm(ctx context.Context, bucket, key string, load cacheLoader, now time.Time) (string, error) {
+	id := readCacheID(bucket, key)
+	cached, ok := c.lookup(id)
+	if ok && now.Sub(cached.fetched) < c.ttl {
+		return "cached", nil
+	}
+	etag := ""
+	if ok {
+		etag = cached.obj.etag
+	}
+	obj, err := load(ctx, etag)
+	switch {
+	case err == nil && obj == nil:
+		c.touch(id, now)
+		return "cached", nil
+	case err == nil:
+		c.store(id, obj, now)
+		return "warmed", nil
+	case errors.Is(err, errNotCacheable):
+		return "too_large", nil
+	}
+	if golib.IsNotFound(err) {
+		c.drop(id)
+	}
+	return "failed", err
+}
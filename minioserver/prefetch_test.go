@@ -0,0 +1,64 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["gallery/1.jpg"] = []byte("one")
+	objects["gallery/2.jpg"] = []byte("two")
+	opts := proxyOptions{ReadCache: newReadCache(1<<20, 0, time.Minute, 0, 0)}
+	p := newPrefetcher(client, opts, []string{"files"})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		prefetchHandler(p, "files").ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/prefetch", strings.NewReader(body)))
+		return rec
+	}
+	rec := post(`{"keys": ["/gallery/1.jpg", "gallery/2.jpg", "gallery/missing.jpg", "gallery/"]}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct{ Queued, Dropped int }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Queued != 3 || resp.Dropped != 0 {
+		t.Fatalf("response = %+v", resp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, ok1 := opts.ReadCache.lookup("files/gallery/1.jpg")
+		_, ok2 := opts.ReadCache.lookup("files/gallery/2.jpg")
+		if ok1 && ok2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cache not warmed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The next gallery load is served from the cache.
+	get := httptest.NewRecorder()
+	objectsHandlerWithPrefix(client, "files", "/objects/", opts).ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/objects/gallery/2.jpg", nil))
+	if get.Body.String() != "two" || get.Header().Get("X-Cache") != cacheHit {
+		t.Errorf("GET after prefetch: %q %s", get.Body.String(), get.Header().Get("X-Cache"))
+	}
+
+	if rec := post(`{"bucket": "elsewhere", "keys": ["a.jpg"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown bucket: %d", rec.Code)
+	}
+	if rec := post(`{"keys": []}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("no keys: %d", rec.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package minioserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// PrefixMigration moves objects stored before the "/kzen" folder prefix existed (e.g.
+// users/42/a.jpg) to the key the handlers use now (kzen/users/42/a.jpg).
+type PrefixMigration struct {
+	// Bucket is migrated in place; "" is KZEN_STORAGE.
+	Bucket string
+	// Prefix is the folder prefix objects move under; "" is "kzen".
+	Prefix string
+	// From limits the migration to legacy keys starting with it (e.g. "users/"); "" takes every
+	// key outside Prefix except the proxy's own (quarantine/, kzen-selftest/).
+	From string
+	// Apply moves the objects; otherwise the migration only reports what it would do.
+	Apply bool
+}
+
+// PrefixMove is one object of a prefix migration.
+type PrefixMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Size int64  `json:"size"`
+}
+
+// PrefixSkip is an object left in place, with the reason.
+type PrefixSkip struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// PrefixMigrationReport lists what a migration moved (or, in a dry run, would move).
+type PrefixMigrationReport struct {
+	DryRun  bool         `json:"dryRun"`
+	Bucket  string       `json:"bucket"`
+	Prefix  string       `json:"prefix"`
+	Moved   []PrefixMove `json:"moved"`
+	Skipped []PrefixSkip `json:"skipped"`
+	Errors  []string     `json:"errors"`
+}
+
+// prefixMigrationClient is the part of *minio.Client a prefix migration uses.
+type prefixMigrationClient interface {
+	ListObjects(ctx context.Context, bucket string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	StatObject(ctx context.Context, bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
+	RemoveObject(ctx context.Context, bucket, key string, opts minio.RemoveObjectOptions) error
+}
+
+// MigratePrefix runs m against cfg's MinIO, for the "kzen-go migrate-prefix" command. With
+// cfg.AliasesKey set, the moved keys are added to the alias table, so their old URLs keep
+// working.
+func MigratePrefix(ctx context.Context, cfg Config, m PrefixMigration) (PrefixMigrationReport, error) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return PrefixMigrationReport{}, err
+	}
+	aliases, err := newAliasTable(client, cfg.Bucket, cfg.AliasesKey, cfg.AliasMode)
+	if err != nil {
+		return PrefixMigrationReport{}, fmt.Errorf("load aliases: %w", err)
+	}
+	report, err := migratePrefix(ctx, client, m, proxyOptions{Aliases: aliases})
+	if !m.Apply || aliases == nil || len(report.Moved) == 0 {
+		return report, err
+	}
+	aerr := aliases.update(ctx, report.Bucket, func(table map[string]string) {
+		for _, mv := range report.Moved {
+			table[mv.From] = mv.To
+		}
+	})
+	if aerr != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("record aliases: %v", aerr))
+	}
+	return report, err
+}
+
+// migratePrefix copies each legacy object to its prefixed key, checks the copy has the size
+// (and, for objects not uploaded in parts, the ETag) of the original, and only then removes the
+// original. A key that already exists under the prefix is never overwritten, and keys the
+// object routes hide (see hiddenKey) stay where they are.
+func migratePrefix(ctx context.Context, client prefixMigrationClient, m PrefixMigration, opts proxyOptions) (PrefixMigrationReport, error) {
+	if m.Bucket == "" {
+		m.Bucket = KZEN_STORAGE
+	}
+	prefix := strings.Trim(m.Prefix, "/")
+	if prefix == "" {
+		prefix = "kzen"
+	}
+	prefix += "/"
+	report := PrefixMigrationReport{
+		DryRun:  !m.Apply,
+		Bucket:  m.Bucket,
+		Prefix:  prefix,
+		Moved:   []PrefixMove{},
+		Skipped: []PrefixSkip{},
+		Errors:  []string{},
+	}
+	from := strings.TrimPrefix(m.From, "/")
+	if strings.HasPrefix(from, prefix) {
+		return report, fmt.Errorf("from %q is inside the prefix %q", from, prefix)
+	}
+
+	for obj := range client.ListObjects(ctx, m.Bucket, minio.ListObjectsOptions{Prefix: from, Recursive: true}) {
+		if obj.Err != nil {
+			return report, obj.Err
+		}
+		key := obj.Key
+		switch {
+		case strings.HasPrefix(key, prefix), strings.HasSuffix(key, "/"):
+			continue
+		case from == "" && (hiddenKey(opts, m.Bucket, key) || strings.HasPrefix(key, selfTestPrefix)):
+			continue
+		}
+		dest := prefix + key
+		if existing, err := client.StatObject(ctx, m.Bucket, dest, minio.StatObjectOptions{}); err == nil {
+			reason := "destination exists with different content"
+			if sameObject(obj, existing) {
+				reason = "destination exists with the same content"
+			}
+			report.Skipped = append(report.Skipped, PrefixSkip{Key: key, Reason: reason})
+			continue
+		}
+		move := PrefixMove{From: key, To: dest, Size: obj.Size}
+		if !m.Apply {
+			report.Moved = append(report.Moved, move)
+			continue
+		}
+		if err := moveVerified(ctx, client, m.Bucket, obj, dest); err != nil {
+			log.Printf("[migrate-prefix] %s -> %s: %v", key, dest, err)
+			report.Errors = append(report.Errors, fmt.Sprintf("%s -> %s: %v", key, dest, err))
+			continue
+		}
+		report.Moved = append(report.Moved, move)
+	}
+	return report, nil
+}
+
+// moveVerified copies src to dest, verifies the copy and removes src.
+func moveVerified(ctx context.Context, client prefixMigrationClient, bucket string, src minio.ObjectInfo, dest string) error {
+	if _, err := client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucket, Object: dest},
+		minio.CopySrcOptions{Bucket: bucket, Object: src.Key}); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	copied, err := client.StatObject(ctx, bucket, dest, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if !sameObject(src, copied) {
+		return fmt.Errorf("verify: copy has %d bytes (etag %s), original %d bytes (etag %s); original kept",
+			copied.Size, copied.ETag, src.Size, src.ETag)
+	}
+	if err := client.RemoveObject(ctx, bucket, src.Key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("remove original: %w", err)
+	}
+	return nil
+}
+
+// sameObject compares sizes and, when neither object was uploaded in parts (whose ETags change
+// on copy), ETags.
+func sameObject(a, b minio.ObjectInfo) bool {
+	if a.Size != b.Size {
+		return false
+	}
+	ea, eb := strings.Trim(a.ETag, `"`), strings.Trim(b.ETag, `"`)
+	if strings.Contains(ea, "-") || strings.Contains(eb, "-") {
+		return true
+	}
+	return ea == eb
+}
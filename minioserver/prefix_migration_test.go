@@ -0,0 +1,103 @@
+package minioserver
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// fakeMoveClient keeps objects by key; badCopy corrupts copies of that key.
+type fakeMoveClient struct {
+	objects map[string]minio.ObjectInfo
+	badCopy string
+}
+
+func (c *fakeMoveClient) ListObjects(ctx context.Context, bucket string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	keys := make([]string, 0, len(c.objects))
+	for key := range c.objects {
+		if strings.HasPrefix(key, opts.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	ch := make(chan minio.ObjectInfo, len(keys))
+	for _, key := range keys {
+		ch <- c.objects[key]
+	}
+	close(ch)
+	return ch
+}
+
+func (c *fakeMoveClient) StatObject(ctx context.Context, bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	info, ok := c.objects[key]
+	if !ok {
+		return info, minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}
+	}
+	return info, nil
+}
+
+func (c *fakeMoveClient) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error) {
+	info := c.objects[src.Object]
+	info.Key = dst.Object
+	if src.Object == c.badCopy {
+		info.Size--
+	}
+	c.objects[dst.Object] = info
+	return minio.UploadInfo{}, nil
+}
+
+func (c *fakeMoveClient) RemoveObject(ctx context.Context, bucket, key string, opts minio.RemoveObjectOptions) error {
+	delete(c.objects, key)
+	return nil
+}
+
+func TestMigratePrefix(t *testing.T) {
+	newClient := func() *fakeMoveClient {
+		c := &fakeMoveClient{objects: map[string]minio.ObjectInfo{}, badCopy: "users/3/c.jpg"}
+		for _, o := range []minio.ObjectInfo{
+			{Key: "users/1/a.jpg", Size: 10, ETag: "a"},
+			{Key: "users/2/b.jpg", Size: 20, ETag: "b"},
+			{Key: "kzen/users/2/b.jpg", Size: 21, ETag: "other"},
+			{Key: "users/3/c.jpg", Size: 30, ETag: "c"},
+			{Key: "kzen/users/4/d.jpg", Size: 40, ETag: "d"},
+			{Key: "quarantine/e.exe", Size: 50, ETag: "e"},
+		} {
+			c.objects[o.Key] = o
+		}
+		return c
+	}
+
+	c := newClient()
+	report, err := migratePrefix(context.Background(), c, PrefixMigration{}, proxyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.Moved) != 2 || len(report.Skipped) != 1 || len(c.objects) != 6 {
+		t.Fatalf("dry run: %+v, objects %v", report, c.objects)
+	}
+
+	report, err = migratePrefix(context.Background(), c, PrefixMigration{Apply: true, From: "users/"}, proxyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Moved) != 1 || report.Moved[0].To != "kzen/users/1/a.jpg" || len(report.Errors) != 1 {
+		t.Fatalf("apply: %+v", report)
+	}
+	if _, ok := c.objects["users/1/a.jpg"]; ok {
+		t.Error("moved original still there")
+	}
+	if _, ok := c.objects["users/3/c.jpg"]; !ok {
+		t.Error("original removed after a failed verification")
+	}
+	if c.objects["kzen/users/2/b.jpg"].ETag != "other" {
+		t.Error("existing destination overwritten")
+	}
+
+	if _, err := migratePrefix(context.Background(), newClient(), PrefixMigration{From: "kzen/users/"}, proxyOptions{}); err == nil {
+		t.Error("from inside the prefix accepted")
+	}
+}
@@ -0,0 +1,100 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	batchURLsMaxKeys       = 1000
+	batchURLsDefaultExpiry = time.Hour
+	batchURLsMaxExpiry     = 7 * 24 * time.Hour // S3 SigV4 limit
+)
+
+type batchURLsRequest struct {
+	Keys []string `json:"keys"`
+	// ExpiresIn is the URL lifetime in seconds (default 3600, max 7 days).
+	ExpiresIn int `json:"expiresIn"`
+}
+
+type batchURL struct {
+	Key string `json:"key"`
+	URL string `json:"url,omitempty"`
+	Err string `json:"error,omitempty"`
+}
+
+// batchURLsHandler serves POST /batch/urls: presigned GET URLs for many keys in one call so a
+// gallery can load images straight from MinIO. presigner signs for the endpoint browsers reach,
+// which may differ from the one the proxy uses. Keys are relative to folderPrefix, as for uploads.
+// Presigning is local, so keys are not checked for existence; the proxy's own keys (see
+// hiddenKey) are refused.
+func batchURLsHandler(presigner *minio.Client, bucket string, folderPrefix string, opts proxyOptions) http.HandlerFunc {
+	folder := strings.Trim(folderPrefix, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req batchURLsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Keys) == 0 {
+			respondError(w, "keys required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Keys) > batchURLsMaxKeys {
+			respondError(w, fmt.Sprintf("at most %d keys per request", batchURLsMaxKeys), http.StatusRequestEntityTooLarge)
+			return
+		}
+		expiry := batchURLsDefaultExpiry
+		if req.ExpiresIn > 0 {
+			expiry = min(time.Duration(req.ExpiresIn)*time.Second, batchURLsMaxExpiry)
+		}
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		urls := make([]batchURL, len(req.Keys))
+		for i, k := range req.Keys {
+			k = strings.TrimPrefix(strings.TrimSpace(k), "/")
+			urls[i].Key = k
+			if k == "" {
+				urls[i].Err = "empty key"
+				continue
+			}
+			objectKey := k
+			if folder != "" {
+				objectKey = path.Join(folder, k)
+			}
+			if hiddenKey(opts, bucket, objectKey) {
+				urls[i].Err = "object not found"
+				continue
+			}
+			u, err := presigner.PresignedGetObject(ctx, bucket, objectKey, expiry, url.Values{})
+			if err != nil {
+				log.Printf("presign %q bucket=%q: %v", objectKey, bucket, err)
+				urls[i].Err = "failed to presign"
+				continue
+			}
+			urls[i].URL = u.String()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"urls":      urls,
+			"expiresAt": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+		})
+	}
+}
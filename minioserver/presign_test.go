@@ -0,0 +1,72 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestBatchURLsHandler_PresignsWithFolderPrefix(t *testing.T) {
+	presigner, err := minio.New("s3.example.com", &minio.Options{
+		Creds:  credentials.NewStaticV4("ak", "sk", ""),
+		Secure: true,
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := batchURLsHandler(presigner, "kzen-storage", "/kzen", proxyOptions{})
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/kzen-storage-batch-urls",
+		strings.NewReader(`{"keys":["users/1/a.jpeg",""],"expiresIn":600}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		URLs []batchURL `json:"urls"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.URLs) != 2 {
+		t.Fatalf("got %d urls", len(resp.URLs))
+	}
+	u := resp.URLs[0].URL
+	if !strings.HasPrefix(u, "https://s3.example.com/kzen-storage/kzen/users/1/a.jpeg?") ||
+		!strings.Contains(u, "X-Amz-Expires=600") || !strings.Contains(u, "X-Amz-Signature=") {
+		t.Errorf("unexpected url %q", u)
+	}
+	if resp.URLs[1].Err == "" {
+		t.Error("empty key should report an error")
+	}
+}
+
+func TestBatchURLsHandler_RefusesHiddenKeys(t *testing.T) {
+	presigner, err := minio.New("s3.example.com", &minio.Options{Creds: credentials.NewStaticV4("ak", "sk", ""), Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	batchURLsHandler(presigner, "files", "", proxyOptions{})(rec, httptest.NewRequest(http.MethodPost, "/batch/urls",
+		strings.NewReader(`{"keys":["a.jpg","quarantine/a.jpg","trash/b.jpg"]}`)))
+	var resp struct {
+		URLs []batchURL `json:"urls"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.URLs) != 3 {
+		t.Fatalf("response %d %s: %v", rec.Code, rec.Body, err)
+	}
+	if resp.URLs[0].URL == "" {
+		t.Errorf("a.jpg not presigned: %+v", resp.URLs[0])
+	}
+	for _, u := range resp.URLs[1:] {
+		if u.URL != "" || u.Err == "" {
+			t.Errorf("%s presigned: %+v", u.Key, u)
+		}
+	}
+}
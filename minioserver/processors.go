@@ -0,0 +1,90 @@
+package minioserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Upload is a file about to be stored through an objects mount, as seen by a ProcessorFunc.
+type Upload struct {
+	Bucket string
+	Key    string
+	// Filename is the name of the multipart file field, "" for raw bodies.
+	Filename string
+	// ContentType and Metadata (stored as X-Amz-Meta-* user metadata) may be changed by processors.
+	ContentType string
+	Metadata    map[string]string
+}
+
+// ProcessorFunc rewrites an upload before it is stored, e.g. to watermark or recompress it, and
+// returns the bytes to store. It may change u.ContentType and u.Metadata. A non-nil error rejects
+// the upload with 422 and the error's message.
+type ProcessorFunc func(ctx context.Context, u *Upload, data []byte) ([]byte, error)
+
+// AddProcessor registers fn for uploads through the mount at route (e.g. "/objects/"); processors
+// of a route run in the order they were added.
+func (c *Config) AddProcessor(route string, fn ProcessorFunc) {
+	if !strings.HasSuffix(route, "/") {
+		route += "/"
+	}
+	if c.Processors == nil {
+		c.Processors = map[string][]ProcessorFunc{}
+	}
+	c.Processors[route] = append(c.Processors[route], fn)
+}
+
+// errUploadTooLarge is returned by runProcessors for bodies over the limit.
+var errUploadTooLarge = errors.New("upload too large to process")
+
+// runProcessors reads body, at most maxBytes of it when maxBytes > 0, and passes it through
+// procs in order. When a processor quarantines the upload, the data read is returned with
+// the error.
+func runProcessors(ctx context.Context, procs []ProcessorFunc, u *Upload, body io.Reader, maxBytes int64) ([]byte, error) {
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read upload: %w", err)
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, errUploadTooLarge
+	}
+	orig := data
+	for _, fn := range procs {
+		if data, err = fn(ctx, u, data); err != nil {
+			var q *quarantineError
+			if errors.As(err, &q) {
+				// The upload as sent is what gets quarantined.
+				return orig, &processorError{err: err}
+			}
+			return nil, &processorError{err: err}
+		}
+	}
+	return data, nil
+}
+
+// processorError is a ProcessorFunc's rejection of an upload.
+type processorError struct{ err error }
+
+func (e *processorError) Error() string { return e.err.Error() }
+func (e *processorError) Unwrap() error { return e.err }
+
+// respondProcessorError replies to a failed runProcessors.
+func respondProcessorError(w http.ResponseWriter, objectKey string, err error) {
+	var procErr *processorError
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		respondError(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.As(err, &procErr):
+		log.Printf("upload %q rejected by processor: %v", objectKey, procErr.err)
+		respondErrorCode(w, "upload rejected: "+procErr.Error(), "processor_rejected", http.StatusUnprocessableEntity)
+	default:
+		respondError(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,75 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestConfigAddProcessor(t *testing.T) {
+	var cfg Config
+	noop := func(_ context.Context, _ *Upload, data []byte) ([]byte, error) { return data, nil }
+	cfg.AddProcessor("/objects", noop)
+	cfg.AddProcessor("/objects/", noop)
+	if len(cfg.Processors["/objects/"]) != 2 {
+		t.Errorf("Processors = %v, want two for /objects/", cfg.Processors)
+	}
+}
+
+func TestMountHandler_RunsProcessors(t *testing.T) {
+	var stored []byte
+	var storedType, storedMeta string
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			stored, _ = io.ReadAll(r.Body)
+			storedType = r.Header.Get("Content-Type")
+			storedMeta = r.Header.Get("X-Amz-Meta-Watermark")
+			w.Header().Set("ETag", `"abc"`)
+		}
+	}))
+	defer s3.Close()
+	client, err := minio.New(strings.TrimPrefix(s3.URL, "http://"), &minio.Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upper := func(_ context.Context, u *Upload, data []byte) ([]byte, error) {
+		u.ContentType = "text/x-shout"
+		u.Metadata["watermark"] = u.Key
+		return bytes.ToUpper(data), nil
+	}
+	reject := func(_ context.Context, u *Upload, data []byte) ([]byte, error) {
+		if bytes.Contains(data, []byte("SECRET")) {
+			return nil, errors.New("no secrets")
+		}
+		return data, nil
+	}
+	m := Mount{Route: "/files/", Bucket: "bucket", Prefix: "p/", Type: MountTypeObjects}
+	h := mountHandler(client, m, proxyOptions{Processors: []ProcessorFunc{upper, reject}})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/files/a.txt", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	h(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body.String())
+	}
+	// The body is aws-chunked, so only look for the payload in it.
+	if !bytes.Contains(stored, []byte("\r\nHELLO\r\n")) || storedType != "text/x-shout" || storedMeta != "p/a.txt" {
+		t.Errorf("stored %q as %q with watermark %q", stored, storedType, storedMeta)
+	}
+
+	stored = nil
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, "/files/b.txt", strings.NewReader("a secret")))
+	if rec.Code != http.StatusUnprocessableEntity || stored != nil {
+		t.Errorf("rejected upload: status %d, stored %q", rec.Code, stored)
+	}
+}
@@ -0,0 +1,209 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// quarantinePrefix holds uploads a processor flagged (see Quarantine), under their original key.
+// Object routes don't serve it; only the /admin/quarantine endpoints reach it.
+const quarantinePrefix = "quarantine/"
+
+// User metadata of quarantined objects.
+const (
+	quarantineMetaReason = "Quarantine-Reason"
+	quarantineMetaKey    = "Quarantine-Key"
+	quarantineMetaTime   = "Quarantine-Time"
+	quarantineMetaBy     = "Quarantine-By"
+)
+
+// quarantineError is a processor's soft rejection of an upload.
+type quarantineError struct{ reason string }
+
+func (e *quarantineError) Error() string { return "quarantined: " + e.reason }
+
+// Quarantine is returned by a ProcessorFunc (e.g. a virus scanner, or a type check that should
+// not bounce the upload) to store the upload under quarantine/ for review instead of rejecting
+// it. The client gets 202 and the quarantine webhook is notified with reason.
+func Quarantine(reason string) error {
+	return &quarantineError{reason: reason}
+}
+
+// isQuarantineKey reports whether key is inside the quarantine prefix.
+func isQuarantineKey(key string) bool {
+	return strings.HasPrefix(key, quarantinePrefix)
+}
+
+// quarantineUpload stores data, rejected by a processor with q, under the quarantine prefix.
+func quarantineUpload(ctx context.Context, client *minio.Client, u *Upload, data []byte, q *quarantineError, hook *webhook, by string) (string, error) {
+	key := quarantinePrefix + u.Key
+	meta := map[string]string{}
+	for k, v := range u.Metadata {
+		meta[k] = v
+	}
+	now := time.Now().UTC()
+	meta[quarantineMetaReason] = q.reason
+	meta[quarantineMetaKey] = u.Key
+	meta[quarantineMetaTime] = now.Format(time.RFC3339)
+	meta[quarantineMetaBy] = by
+	_, err := client.PutObject(ctx, u.Bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: u.ContentType, UserMetadata: meta})
+	if err != nil {
+		return "", err
+	}
+	log.Printf("upload %s/%s quarantined as %s: %s", u.Bucket, u.Key, key, q.reason)
+	metrics.add("kzen_quarantined_total", 1, "bucket", u.Bucket)
+	hook.send("quarantined", map[string]any{"bucket": u.Bucket, "key": u.Key, "quarantineKey": key, "reason": q.reason, "apiKey": by})
+	return key, nil
+}
+
+// quarantineClient is the part of *minio.Client the quarantine endpoints use.
+type quarantineClient interface {
+	ListObjects(ctx context.Context, bucket string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	StatObject(ctx context.Context, bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
+	RemoveObject(ctx context.Context, bucket, key string, opts minio.RemoveObjectOptions) error
+}
+
+// quarantinedObject is an entry of GET /admin/quarantine.
+type quarantinedObject struct {
+	Key           string    `json:"key"` // original key, where release puts it
+	QuarantineKey string    `json:"quarantineKey"`
+	Reason        string    `json:"reason"`
+	QuarantinedAt string    `json:"quarantinedAt"`
+	By            string    `json:"by,omitempty"` // API key name of the uploader
+	Size          int64     `json:"size"`
+	ContentType   string    `json:"contentType"`
+	LastModified  time.Time `json:"lastModified"`
+}
+
+func quarantinedFromInfo(info minio.ObjectInfo) quarantinedObject {
+	return quarantinedObject{
+		Key:           info.UserMetadata[quarantineMetaKey],
+		QuarantineKey: info.Key,
+		Reason:        info.UserMetadata[quarantineMetaReason],
+		QuarantinedAt: info.UserMetadata[quarantineMetaTime],
+		By:            info.UserMetadata[quarantineMetaBy],
+		Size:          info.Size,
+		ContentType:   info.ContentType,
+		LastModified:  info.LastModified,
+	}
+}
+
+// quarantineListMax bounds GET /admin/quarantine; quarantine is meant to be worked off.
+const quarantineListMax = 1000
+
+// quarantineHandler serves the admin endpoints of the quarantine of defaultBucket (or ?bucket=):
+//
+//	GET    /admin/quarantine               list quarantined objects
+//	POST   /admin/quarantine/release?key=  move an object back to its original key
+//	DELETE /admin/quarantine?key=          purge an object
+//
+// key is the original key of the upload.
+func quarantineHandler(client quarantineClient, defaultBucket string, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		bucket := q.Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(q.Get("key"), "/"), quarantinePrefix)
+		release := strings.HasSuffix(r.URL.Path, "/release")
+
+		ctx, cancel := golib.RequestContext(r, 60*time.Second)
+		defer cancel()
+
+		switch {
+		case r.Method == http.MethodGet && !release:
+			items := []quarantinedObject{}
+			for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: quarantinePrefix, Recursive: true}) {
+				if obj.Err != nil {
+					respondStorageError(w, obj.Err, "failed to list quarantine")
+					return
+				}
+				info, err := client.StatObject(ctx, bucket, obj.Key, minio.StatObjectOptions{})
+				if err != nil {
+					respondStorageError(w, err, "failed to stat "+obj.Key)
+					return
+				}
+				items = append(items, quarantinedFromInfo(info))
+				if len(items) == quarantineListMax {
+					break
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "objects": items})
+			return
+		case r.Method == http.MethodPost && release, r.Method == http.MethodDelete && !release:
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if key == "" {
+			respondError(w, "key query parameter required", http.StatusBadRequest)
+			return
+		}
+		qKey := quarantinePrefix + key
+		info, err := client.StatObject(ctx, bucket, qKey, minio.StatObjectOptions{})
+		if err != nil {
+			if golib.IsNotFound(err) {
+				respondError(w, "object not in quarantine", http.StatusNotFound)
+				return
+			}
+			respondStorageError(w, err, "failed to stat "+qKey)
+			return
+		}
+		item := quarantinedFromInfo(info)
+		if item.Key == "" {
+			item.Key = key
+		}
+
+		event := "quarantine_purged"
+		if release {
+			event = "quarantine_released"
+			if err := releaseQuarantined(ctx, client, bucket, info, item.Key); err != nil {
+				log.Printf("release %s/%s: %v", bucket, qKey, err)
+				respondStorageError(w, err, "release failed")
+				return
+			}
+			opts.changed(bucket, item.Key)
+		}
+		if err := client.RemoveObject(ctx, bucket, qKey, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("remove %s/%s: %v", bucket, qKey, err)
+			respondStorageError(w, err, "failed to remove "+qKey)
+			return
+		}
+		by := apiKeyName(r.Context())
+		log.Printf("%s: %s/%s by %q", event, bucket, qKey, by)
+		opts.QuarantineWebhook.send(event, map[string]any{"bucket": bucket, "key": item.Key, "quarantineKey": qKey, "reason": item.Reason, "apiKey": by})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "released": release, "object": item})
+	}
+}
+
+// releaseQuarantined copies a quarantined object to key without the quarantine metadata.
+func releaseQuarantined(ctx context.Context, client quarantineClient, bucket string, info minio.ObjectInfo, key string) error {
+	meta := map[string]string{}
+	for k, v := range info.UserMetadata {
+		if !strings.HasPrefix(k, "Quarantine-") {
+			meta[k] = v
+		}
+	}
+	if info.ContentType != "" {
+		meta["Content-Type"] = info.ContentType
+	}
+	_, err := client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucket, Object: key, UserMetadata: meta, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: bucket, Object: info.Key})
+	return err
+}
@@ -0,0 +1,136 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+type fakeQuarantineClient struct {
+	objects map[string]minio.ObjectInfo
+	copied  minio.CopyDestOptions
+}
+
+func (c *fakeQuarantineClient) ListObjects(ctx context.Context, bucket string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	ch := make(chan minio.ObjectInfo, len(c.objects))
+	for key, info := range c.objects {
+		if strings.HasPrefix(key, opts.Prefix) {
+			ch <- minio.ObjectInfo{Key: info.Key}
+		}
+	}
+	close(ch)
+	return ch
+}
+
+func (c *fakeQuarantineClient) StatObject(ctx context.Context, bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	info, ok := c.objects[key]
+	if !ok {
+		return info, minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}
+	}
+	return info, nil
+}
+
+func (c *fakeQuarantineClient) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error) {
+	c.copied = dst
+	c.objects[dst.Object] = minio.ObjectInfo{Key: dst.Object}
+	return minio.UploadInfo{}, nil
+}
+
+func (c *fakeQuarantineClient) RemoveObject(ctx context.Context, bucket, key string, opts minio.RemoveObjectOptions) error {
+	delete(c.objects, key)
+	return nil
+}
+
+func TestQuarantineHandler(t *testing.T) {
+	events := make(chan map[string]any, 4)
+	hookSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev map[string]any
+		json.NewDecoder(r.Body).Decode(&ev)
+		events <- ev
+	}))
+	defer hookSrv.Close()
+
+	client := &fakeQuarantineClient{objects: map[string]minio.ObjectInfo{}}
+	for _, key := range []string{"a.pdf", "b.exe"} {
+		client.objects["quarantine/"+key] = minio.ObjectInfo{
+			Key:         "quarantine/" + key,
+			ContentType: "application/pdf",
+			UserMetadata: map[string]string{
+				quarantineMetaKey: key, quarantineMetaReason: "EICAR", "Original-Name": key,
+			},
+		}
+	}
+	purger := recordingPurger()
+	h := quarantineHandler(client, "files", proxyOptions{QuarantineWebhook: newWebhook(hookSrv.URL), Purge: purger})
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/admin/quarantine")
+	var list struct {
+		Objects []quarantinedObject `json:"objects"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if rec.Code != http.StatusOK || len(list.Objects) != 2 || list.Objects[0].Reason != "EICAR" {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(http.MethodPost, "/admin/quarantine/release?key=a.pdf"); rec.Code != http.StatusOK {
+		t.Fatalf("release: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := client.objects["a.pdf"]; !ok || client.objects["quarantine/a.pdf"].Key != "" {
+		t.Errorf("release left %v", client.objects)
+	}
+	if m := client.copied.UserMetadata; m[quarantineMetaReason] != "" || m["Original-Name"] != "a.pdf" || m["Content-Type"] != "application/pdf" {
+		t.Errorf("released metadata = %v", m)
+	}
+	if got := changedKeys(purger); !slices.Equal(got, []string{"a.pdf"}) {
+		t.Errorf("changed after release: %v", got)
+	}
+
+	if rec := do(http.MethodDelete, "/admin/quarantine?key=quarantine/b.exe"); rec.Code != http.StatusOK {
+		t.Fatalf("purge: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := client.objects["b.exe"]; ok || len(client.objects) != 1 {
+		t.Errorf("purge left %v", client.objects)
+	}
+	if rec := do(http.MethodDelete, "/admin/quarantine?key=b.exe"); rec.Code != http.StatusNotFound {
+		t.Errorf("purge twice: %d, want 404", rec.Code)
+	}
+
+	// Deliveries are asynchronous, so they may arrive in any order.
+	got := map[any]bool{}
+	for range 2 {
+		select {
+		case ev := <-events:
+			got[ev["event"]] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("webhooks received: %v", got)
+		}
+	}
+	if !got["quarantine_released"] || !got["quarantine_purged"] {
+		t.Errorf("webhooks received: %v", got)
+	}
+}
+
+func TestRunProcessors_Quarantine(t *testing.T) {
+	procs := []ProcessorFunc{
+		func(ctx context.Context, u *Upload, data []byte) ([]byte, error) { return []byte("rewritten"), nil },
+		func(ctx context.Context, u *Upload, data []byte) ([]byte, error) { return nil, Quarantine("EICAR") },
+	}
+	data, err := runProcessors(context.Background(), procs, &Upload{}, strings.NewReader("as sent"), 0)
+	var q *quarantineError
+	if !errors.As(err, &q) || q.reason != "EICAR" || string(data) != "as sent" {
+		t.Errorf("runProcessors = %q, %v; want the upload as sent and the quarantine", data, err)
+	}
+}
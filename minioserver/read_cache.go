@@ -0,0 +1,302 @@
+package minioserver
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+func init() {
+	metrics.describe("kzen_read_cache_requests_total", "counter", "Object GETs answered by the read cache, by result (hit|stale|revalidated|miss|stale_if_error).")
+	metrics.describe("kzen_read_cache_bytes", "gauge", "Bytes of object content held by the read cache.")
+}
+
+// Read cache results, sent as X-Cache.
+const (
+	cacheHit          = "HIT"
+	cacheStale        = "STALE"
+	cacheRevalidated  = "REVALIDATED"
+	cacheMiss         = "MISS"
+	cacheStaleIfError = "STALE-IF-ERROR"
+)
+
+// errNotCacheable is returned by a cacheLoader for objects over the per-object size limit; they
+// are served straight from MinIO.
+var errNotCacheable = errors.New("object too large for the read cache")
+
+// cachedObject is the content of one object version; it is never modified once stored.
+type cachedObject struct {
+	data            []byte
+	contentType     string
+	contentEncoding string
+	etag            string
+}
+
+// cacheEntry is a cached object and when it was last known to be current.
+type cacheEntry struct {
+	id      string
+	obj     *cachedObject
+	fetched time.Time
+}
+
+// cacheLoader fetches an object for the cache. Given the ETag of the cached copy it returns
+// (nil, nil) when the object is unchanged, so revalidation only costs a stat.
+type cacheLoader func(ctx context.Context, etag string) (*cachedObject, error)
+
+// readCache keeps small objects in memory (least recently used evicted first). A copy younger
+// than ttl is served as is; one up to staleWhileRevalidate older is still served, while a single
+// background fetch refreshes it; and when MinIO fails, a copy up to staleIfError past ttl is
+// served instead of the error. Writes through this instance drop the copy at once (forget);
+// writes elsewhere show up within ttl.
+type readCache struct {
+	maxBytes             int64
+	maxObject            int64
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+
+	mu         sync.Mutex
+	bytes      int64
+	lru        *list.List // of *cacheEntry, most recently used first
+	entries    map[string]*list.Element
+	refreshing map[string]bool
+}
+
+// newReadCache returns nil when maxBytes is 0 (cache off).
+func newReadCache(maxBytes, maxObject int64, ttl, staleWhileRevalidate, staleIfError time.Duration) *readCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	if maxObject <= 0 || maxObject > maxBytes {
+		maxObject = min(1<<20, maxBytes)
+	}
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &readCache{
+		maxBytes:             maxBytes,
+		maxObject:            maxObject,
+		ttl:                  ttl,
+		staleWhileRevalidate: max(staleWhileRevalidate, 0),
+		staleIfError:         max(staleIfError, 0),
+		lru:                  list.New(),
+		entries:              map[string]*list.Element{},
+		refreshing:           map[string]bool{},
+	}
+}
+
+func readCacheID(bucket, key string) string { return bucket + "/" + key }
+
+// get returns the object at key, from the cache when the copy is recent enough and through load
+// otherwise, with the X-Cache result.
+func (c *readCache) get(ctx context.Context, bucket, key string, load cacheLoader, now time.Time) (cacheEntry, string, error) {
+	id := readCacheID(bucket, key)
+	cached, ok := c.lookup(id)
+	if ok {
+		age := now.Sub(cached.fetched)
+		switch {
+		case age < c.ttl:
+			return c.result(cached, cacheHit)
+		case age < c.ttl+c.staleWhileRevalidate:
+			c.revalidate(id, cached.obj.etag, load)
+			return c.result(cached, cacheStale)
+		}
+	}
+
+	etag := ""
+	if ok {
+		etag = cached.obj.etag
+	}
+	obj, err := load(ctx, etag)
+	switch {
+	case err == nil && obj == nil:
+		cached.fetched = now
+		c.touch(id, now)
+		return c.result(cached, cacheRevalidated)
+	case err == nil:
+		entry := c.store(id, obj, now)
+		return c.result(entry, cacheMiss)
+	case golib.IsNotFound(err) || errors.Is(err, errNotCacheable):
+		c.forget(bucket, key)
+	case ok && now.Sub(cached.fetched) < c.ttl+c.staleIfError:
+		log.Printf("read cache: serving stale %s after error: %v", id, err)
+		return c.result(cached, cacheStaleIfError)
+	}
+	return cacheEntry{}, "", err
+}
+
+func (c *readCache) result(e cacheEntry, status string) (cacheEntry, string, error) {
+	metrics.add("kzen_read_cache_requests_total", 1, "result", map[string]string{
+		cacheHit: "hit", cacheStale: "stale", cacheRevalidated: "revalidated", cacheMiss: "miss", cacheStaleIfError: "stale_if_error",
+	}[status])
+	return e, status, nil
+}
+
+// revalidate refreshes id in the background, unless a refresh is already running.
+func (c *readCache) revalidate(id, etag string, load cacheLoader) {
+	c.mu.Lock()
+	if c.refreshing[id] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[id] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, id)
+			c.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		obj, err := load(ctx, etag)
+		switch {
+		case err == nil && obj == nil:
+			c.touch(id, time.Now())
+		case err == nil:
+			c.store(id, obj, time.Now())
+		case golib.IsNotFound(err) || errors.Is(err, errNotCacheable):
+			c.drop(id)
+		default:
+			log.Printf("read cache: revalidate %s: %v", id, err)
+		}
+	}()
+}
+
+func (c *readCache) lookup(id string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	c.lru.MoveToFront(el)
+	return *el.Value.(*cacheEntry), true
+}
+
+func (c *readCache) touch(id string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[id]; ok {
+		el.Value.(*cacheEntry).fetched = now
+	}
+}
+
+func (c *readCache) store(id string, obj *cachedObject, now time.Time) cacheEntry {
+	entry := &cacheEntry{id: id, obj: obj, fetched: now}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(id)
+	c.entries[id] = c.lru.PushFront(entry)
+	c.bytes += int64(len(obj.data))
+	for c.bytes > c.maxBytes && c.lru.Len() > 1 {
+		c.removeLocked(c.lru.Back().Value.(*cacheEntry).id)
+	}
+	metrics.set("kzen_read_cache_bytes", float64(c.bytes))
+	return *entry
+}
+
+func (c *readCache) drop(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(id)
+	metrics.set("kzen_read_cache_bytes", float64(c.bytes))
+}
+
+func (c *readCache) removeLocked(id string) {
+	if el, ok := c.entries[id]; ok {
+		c.bytes -= int64(len(el.Value.(*cacheEntry).obj.data))
+		c.lru.Remove(el)
+		delete(c.entries, id)
+	}
+}
+
+// forget drops the cached copy of key, after it was overwritten or deleted.
+func (c *readCache) forget(bucket, key string) {
+	if c == nil {
+		return
+	}
+	c.drop(readCacheID(bucket, key))
+}
+
+// minioCacheLoader loads key from MinIO, skipping the download when its ETag is unchanged.
+func minioCacheLoader(client *minio.Client, bucket, key string, retry retryPolicy, maxObject int64) cacheLoader {
+	return func(ctx context.Context, etag string) (*cachedObject, error) {
+		info, err := retry.statObject(ctx, client, bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		if etag != "" && info.ETag == etag {
+			return nil, nil
+		}
+		if info.Size > maxObject {
+			return nil, errNotCacheable
+		}
+		obj, err := retry.getObject(ctx, client, bucket, key, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, err
+		}
+		defer obj.Close()
+		data, err := io.ReadAll(io.LimitReader(obj, maxObject+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxObject {
+			return nil, errNotCacheable
+		}
+		return &cachedObject{data: data, contentType: info.ContentType, contentEncoding: info.Metadata.Get("Content-Encoding"), etag: info.ETag}, nil
+	}
+}
+
+// serve answers a GET or HEAD of key from the cache. It returns false, having written nothing,
+// when the object is missing or too large to cache, so the caller serves it the usual way.
+func (c *readCache) serve(ctx context.Context, w http.ResponseWriter, r *http.Request, client *minio.Client, bucket, key string, opts proxyOptions) bool {
+	entry, status, err := c.get(ctx, bucket, key, minioCacheLoader(client, bucket, key, opts.retry(), c.maxObject), time.Now())
+	if golib.IsNotFound(err) || errors.Is(err, errNotCacheable) {
+		return false
+	}
+	if err != nil {
+		log.Printf("GET %q bucket=%q err: %v", key, bucket, err)
+		w.Header().Set("X-MinIO-Error", err.Error())
+		respondStorageError(w, err, "failed to get object")
+		return true
+	}
+
+	obj := entry.obj
+	w.Header().Set("X-Cache", status)
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.fetched)/time.Second)))
+	if obj.contentType != "" {
+		w.Header().Set("Content-Type", obj.contentType)
+	}
+	if obj.etag != "" {
+		w.Header().Set("ETag", `"`+obj.etag+`"`)
+	}
+	body, size, ok := negotiateEncoding(w, r, bytes.NewReader(obj.data), int64(len(obj.data)), obj.etag, obj.contentEncoding)
+	if !ok {
+		return true
+	}
+	if isSVG(obj.contentType, key) {
+		if obj.contentEncoding != "" {
+			setSVGSandbox(w)
+		} else if opts.SVG.serve(w, r, body, size, obj.etag) {
+			return true
+		}
+	}
+	out := newThrottledResponseWriter(ctx, w, newByteRateLimiter(opts.DownloadBytesPerSec), opts.DownloadLimiter)
+	if n, err := streamBody(out, r, body, size); err != nil {
+		log.Printf("stream cached object %q: %v (%d of %d bytes)", key, err, n, size)
+	}
+	return true
+}
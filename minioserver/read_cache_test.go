@@ -0,0 +1,126 @@
+package minioserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadCacheStaleSemantics(t *testing.T) {
+	c := newReadCache(1<<20, 0, time.Minute, time.Minute, time.Hour)
+	var loads atomic.Int32
+	var down atomic.Bool
+	version := "v1"
+	load := func(ctx context.Context, etag string) (*cachedObject, error) {
+		loads.Add(1)
+		if down.Load() {
+			return nil, errors.New("dial tcp: connection refused")
+		}
+		if etag == version {
+			return nil, nil
+		}
+		return &cachedObject{data: []byte(version), etag: version}, nil
+	}
+	get := func(now time.Time) (string, string) {
+		t.Helper()
+		e, status, err := c.get(context.Background(), "files", "a.txt", load, now)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return string(e.obj.data), status
+	}
+	t0 := time.Now()
+
+	if body, status := get(t0); body != "v1" || status != cacheMiss {
+		t.Fatalf("first get = %q %s", body, status)
+	}
+	if _, status := get(t0.Add(30 * time.Second)); status != cacheHit || loads.Load() != 1 {
+		t.Fatalf("fresh get = %s after %d loads", status, loads.Load())
+	}
+
+	// Past the TTL but within stale-while-revalidate: the old copy now, the new one after the
+	// background refresh.
+	version = "v2"
+	if body, status := get(t0.Add(90 * time.Second)); body != "v1" || status != cacheStale {
+		t.Fatalf("stale get = %q %s", body, status)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if e, ok := c.lookup("files/a.txt"); ok && string(e.obj.data) == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background revalidation did not store v2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Past stale-while-revalidate with MinIO down: stale-if-error, until that runs out too.
+	e, _ := c.lookup("files/a.txt")
+	down.Store(true)
+	if body, status := get(e.fetched.Add(5 * time.Minute)); body != "v2" || status != cacheStaleIfError {
+		t.Fatalf("stale-if-error get = %q %s", body, status)
+	}
+	if _, _, err := c.get(context.Background(), "files", "a.txt", load, e.fetched.Add(2*time.Hour)); err == nil {
+		t.Fatal("copy past stale-if-error served")
+	}
+
+	// Back up and unchanged: revalidated with a stat, no download.
+	down.Store(false)
+	if body, status := get(e.fetched.Add(5 * time.Minute)); body != "v2" || status != cacheRevalidated {
+		t.Fatalf("revalidated get = %q %s", body, status)
+	}
+
+	c.forget("files", "a.txt")
+	if _, ok := c.lookup("files/a.txt"); ok {
+		t.Fatal("forget kept the copy")
+	}
+}
+
+func TestReadCacheEviction(t *testing.T) {
+	c := newReadCache(10, 10, time.Minute, 0, 0)
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		c.store(readCacheID("files", key), &cachedObject{data: []byte("1234")}, now)
+	}
+	if _, ok := c.lookup("files/a"); ok {
+		t.Error("least recently used entry not evicted")
+	}
+	if c.bytes != 8 {
+		t.Errorf("bytes = %d, want 8", c.bytes)
+	}
+	if newReadCache(0, 0, 0, 0, 0) != nil {
+		t.Error("cache enabled without a size")
+	}
+}
+
+func TestReadCacheServe(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["a.txt"] = []byte("hello")
+	opts := proxyOptions{ReadCache: newReadCache(1<<20, 0, time.Minute, 0, 0)}
+	h := objectsHandlerWithPrefix(client, "files", "/objects/", opts)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	if rec := get("/objects/a.txt"); rec.Code != http.StatusOK || rec.Body.String() != "hello" || rec.Header().Get("X-Cache") != cacheMiss {
+		t.Fatalf("first GET: %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	objects["a.txt"] = []byte("replaced behind the proxy")
+	if rec := get("/objects/a.txt"); rec.Body.String() != "hello" || rec.Header().Get("X-Cache") != cacheHit {
+		t.Fatalf("cached GET: %q %v", rec.Body.String(), rec.Header())
+	}
+	opts.changed("files", "a.txt")
+	if rec := get("/objects/a.txt"); rec.Body.String() != "replaced behind the proxy" {
+		t.Fatalf("GET after write: %q", rec.Body.String())
+	}
+	if rec := get("/objects/missing"); rec.Code != http.StatusNotFound || rec.Header().Get("X-Cache") != "" {
+		t.Fatalf("missing: %d %v", rec.Code, rec.Header())
+	}
+}
@@ -0,0 +1,51 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		peer   string
+		xff    string
+		realIP string
+		want   string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:5000", "1.2.3.4", "5.6.7.8", "203.0.113.9"},
+		{"trusted peer uses XFF", "10.1.2.3:5000", "198.51.100.7", "", "198.51.100.7"},
+		{"spoofed left entries skipped", "10.1.2.3:5000", "6.6.6.6, 198.51.100.7, 10.9.9.9", "", "198.51.100.7"},
+		{"all hops trusted uses leftmost", "127.0.0.1:5000", "10.0.0.5, 10.0.0.6", "", "10.0.0.5"},
+		{"X-Real-IP fallback", "127.0.0.1:5000", "", "198.51.100.8", "198.51.100.8"},
+		{"garbage XFF falls back to peer", "127.0.0.1:5000", "not-an-ip", "", "127.0.0.1"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.peer
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.realIP != "" {
+			r.Header.Set("X-Real-IP", tc.realIP)
+		}
+		if got := resolveClientIP(r, trusted); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies_Invalid(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("expected error for bad CIDR")
+	}
+	if _, err := ParseTrustedProxies("proxy.local"); err == nil {
+		t.Error("expected error for hostname")
+	}
+}
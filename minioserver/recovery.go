@@ -0,0 +1,106 @@
+package minioserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+func init() {
+	metrics.describe("kzen_http_panics_total", "counter", "Handler panics recovered into a 500 response.")
+}
+
+// requestID returns the ID assigned by requestIDMiddleware, "" outside a request.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts client-supplied IDs that are short and safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDMiddleware tags each request with an ID, taken from X-Request-Id when a proxy in front
+// already set a usable one, and echoes it in the response so logs and client reports can be matched.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// recoveryMiddleware turns a handler panic into a 500 internal_error JSON response, logs the stack
+// with the request ID and counts it in kzen_http_panics_total. If the handler had already started
+// the response there is nothing clean left to send, so the connection is aborted instead.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &panicWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			metrics.add("kzen_http_panics_total", 1)
+			log.Printf("panic [%s] %s %s %s: %v\n%s", requestID(r.Context()), clientIP(r), r.Method, r.URL.Path, v, debug.Stack())
+			if pw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			respondErrorCode(w, "internal server error", "internal_error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(pw, r)
+	})
+}
+
+// panicWriter records whether the response has started.
+type panicWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (pw *panicWriter) WriteHeader(status int) {
+	pw.wroteHeader = true
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *panicWriter) Write(p []byte) (int, error) {
+	pw.wroteHeader = true
+	return pw.ResponseWriter.Write(p)
+}
+
+func (pw *panicWriter) Flush() {
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (pw *panicWriter) Unwrap() http.ResponseWriter { return pw.ResponseWriter }
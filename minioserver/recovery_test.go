@@ -0,0 +1,57 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	before := metrics.value("kzen_http_panics_total")
+	h := requestIDMiddleware(recoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/objects/a", nil)
+	req.Header.Set(requestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var body errorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusInternalServerError ||
+		body.Code != "internal_error" || body.RequestID != "abc-123" {
+		t.Fatalf("response = %d %q (%v)", rec.Code, rec.Body.String(), err)
+	}
+	if got := metrics.value("kzen_http_panics_total"); got != before+1 {
+		t.Errorf("panics counter = %v, want %v", got, before+1)
+	}
+}
+
+func TestRecoveryMiddleware_AbortsStartedResponse(t *testing.T) {
+	h := recoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestRequestIDMiddleware_RejectsUnsafeIDs(t *testing.T) {
+	var seen string
+	h := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "evil\nid")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if seen == "" || seen == "evil\nid" || rec.Header().Get(requestIDHeader) != seen {
+		t.Errorf("request id = %q, header %q", seen, rec.Header().Get(requestIDHeader))
+	}
+}
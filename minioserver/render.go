@@ -0,0 +1,189 @@
+package minioserver
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+
+	"kzen-go/golib"
+)
+
+// renderMaxBytes caps objects converted by /render/; previews of bigger files are refused.
+const renderMaxBytes = 2 << 20
+
+var errRenderUnsupported = errors.New("unsupported content type for preview")
+
+// markdownRenderer drops raw HTML and dangerous link schemes (goldmark's default, non-"unsafe" mode),
+// so stored notes can't inject script into the preview.
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var renderPageTmpl = template.Must(template.New("render").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; max-width: 60rem; }
+pre { background: #f6f8fa; padding: 1rem; overflow: auto; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ddd; padding: .25rem .5rem; }
+</style>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`))
+
+var renderCSVTmpl = template.Must(template.New("csv").Parse(`<table>
+{{range $i, $row := .}}<tr>{{range $row}}{{if eq $i 0}}<th>{{.}}</th>{{else}}<td>{{.}}</td>{{end}}{{end}}</tr>
+{{end}}</table>
+`))
+
+var renderPreTmpl = template.Must(template.New("pre").Parse(`<pre>{{.}}</pre>`))
+
+// renderKind picks the preview format from the key extension, falling back to the stored content type.
+func renderKind(key, contentType string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".md", ".markdown":
+		return "markdown"
+	case ".json":
+		return "json"
+	case ".csv":
+		return "csv"
+	case ".txt", ".log", ".ndjson":
+		return "text"
+	}
+	ct := strings.ToLower(contentType)
+	switch {
+	case strings.HasPrefix(ct, "text/markdown"):
+		return "markdown"
+	case strings.HasPrefix(ct, "application/json"):
+		return "json"
+	case strings.HasPrefix(ct, "text/csv"):
+		return "csv"
+	case strings.HasPrefix(ct, "text/"):
+		return "text"
+	}
+	return ""
+}
+
+// renderContent converts data to an HTML fragment: Markdown to sanitized HTML, JSON pretty-printed,
+// CSV as a table, other text escaped in <pre>.
+func renderContent(kind string, data []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	switch kind {
+	case "markdown":
+		if err := markdownRenderer.Convert(data, &buf); err != nil {
+			return "", err
+		}
+	case "json":
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, data, "", "  "); err != nil {
+			// Not valid JSON; show it verbatim rather than failing the preview.
+			pretty.Reset()
+			pretty.Write(data)
+		}
+		if err := renderPreTmpl.Execute(&buf, pretty.String()); err != nil {
+			return "", err
+		}
+	case "csv":
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			return "", fmt.Errorf("parse csv: %w", err)
+		}
+		if err := renderCSVTmpl.Execute(&buf, records); err != nil {
+			return "", err
+		}
+	case "text":
+		if err := renderPreTmpl.Execute(&buf, string(data)); err != nil {
+			return "", err
+		}
+	default:
+		return "", errRenderUnsupported
+	}
+	// Safe: every branch above produced escaped or sanitized HTML.
+	return template.HTML(buf.String()), nil
+}
+
+// renderHandler serves GET {pathPrefix}{key} as an HTML preview of a stored Markdown, JSON, CSV or
+// text object. ?fragment=1 returns only the converted body for embedding in the app.
+func renderHandler(client *minio.Client, bucket string, pathPrefix string, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		objectKey := strings.TrimPrefix(r.URL.Path, pathPrefix)
+		if objectKey == "" {
+			respondError(w, "object key required", http.StatusBadRequest)
+			return
+		}
+		if hiddenKey(opts, bucket, objectKey) {
+			respondError(w, "object not found", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		info, err := client.StatObject(ctx, bucket, objectKey, minio.StatObjectOptions{})
+		if err != nil {
+			log.Printf("render stat %q bucket=%q: %v", objectKey, bucket, err)
+			respondStorageError(w, err, "failed to get object info")
+			return
+		}
+		kind := renderKind(objectKey, info.ContentType)
+		if kind == "" {
+			respondError(w, errRenderUnsupported.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		if info.Size > renderMaxBytes {
+			respondError(w, fmt.Sprintf("object exceeds %d bytes preview limit", renderMaxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		obj, err := client.GetObject(ctx, bucket, objectKey, minio.GetObjectOptions{})
+		if err != nil {
+			respondStorageError(w, err, "failed to get object")
+			return
+		}
+		defer obj.Close()
+		data, err := io.ReadAll(io.LimitReader(obj, renderMaxBytes))
+		if err != nil {
+			log.Printf("render read %q: %v", objectKey, err)
+			respondError(w, "failed to read object", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := renderContent(kind, data)
+		if err != nil {
+			respondError(w, "render failed: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src * data:")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if r.URL.Query().Get("fragment") == "1" {
+			io.WriteString(w, string(body))
+			return
+		}
+		renderPageTmpl.Execute(w, map[string]any{"Title": path.Base(objectKey), "Body": body})
+	}
+}
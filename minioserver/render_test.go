@@ -0,0 +1,79 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderContent_MarkdownIsSanitized(t *testing.T) {
+	md := "# Title\n\n<script>alert(1)</script>\n\n[click](javascript:alert(1))\n"
+	out, err := renderContent("markdown", []byte(md))
+	if err != nil {
+		t.Fatalf("renderContent: %v", err)
+	}
+	html := string(out)
+	if !strings.Contains(html, "<h1>Title</h1>") {
+		t.Errorf("missing heading: %s", html)
+	}
+	if strings.Contains(html, "<script>") || strings.Contains(html, "javascript:") {
+		t.Errorf("unsafe content not removed: %s", html)
+	}
+}
+
+func TestRenderContent_CSVAndJSON(t *testing.T) {
+	out, err := renderContent("csv", []byte("name,size\n<b>a</b>,1\n"))
+	if err != nil {
+		t.Fatalf("renderContent csv: %v", err)
+	}
+	if !strings.Contains(string(out), "<th>name</th>") || !strings.Contains(string(out), "&lt;b&gt;a&lt;/b&gt;") {
+		t.Errorf("unexpected csv output: %s", out)
+	}
+
+	out, err = renderContent("json", []byte(`{"a":[1,2]}`))
+	if err != nil {
+		t.Fatalf("renderContent json: %v", err)
+	}
+	if !strings.Contains(string(out), "&#34;a&#34;: [\n    1,") {
+		t.Errorf("json not pretty-printed: %s", out)
+	}
+}
+
+func TestRenderKind(t *testing.T) {
+	tests := []struct{ key, ct, want string }{
+		{"notes/a.md", "", "markdown"},
+		{"data/x.JSON", "", "json"},
+		{"data/x", "text/csv; charset=utf-8", "csv"},
+		{"img.jpeg", "image/jpeg", ""},
+	}
+	for _, tt := range tests {
+		if got := renderKind(tt.key, tt.ct); got != tt.want {
+			t.Errorf("renderKind(%q, %q) = %q, want %q", tt.key, tt.ct, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHandler_RefusesHiddenKeys(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	aliases, err := newAliasTable(client, "files", "kzen-meta/aliases.json", AliasRedirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects["notes.md"] = []byte("# Notes")
+	objects["kzen-meta/aliases.json"] = []byte(`{"old.md":"notes.md"}`)
+	objects["quarantine/notes.md"] = []byte("# Flagged")
+	h := renderHandler(client, "files", "/render/", proxyOptions{Aliases: aliases})
+
+	for target, want := range map[string]int{
+		"/render/notes.md":               http.StatusOK,
+		"/render/kzen-meta/aliases.json": http.StatusNotFound,
+		"/render/quarantine/notes.md":    http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s: %d, want %d", target, rec.Code, want)
+		}
+	}
+}
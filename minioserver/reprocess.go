@@ -0,0 +1,262 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/kzenimage"
+	"kzen-go/minioserver/media-handlers"
+)
+
+const (
+	// reprocessKeepJobs is how many finished jobs GET /admin/reprocess still reports.
+	reprocessKeepJobs = 20
+	// reprocessKeepErrors caps the per-object errors kept on a job.
+	reprocessKeepErrors = 20
+	// reprocessObjectTimeout bounds the work on a single original.
+	reprocessObjectTimeout = 2 * time.Minute
+)
+
+// reprocessBackend is the storage a reprocess job reads originals from and writes images to.
+type reprocessBackend interface {
+	list(ctx context.Context, prefix string) <-chan minio.ObjectInfo
+	read(ctx context.Context, key string) ([]byte, minio.ObjectInfo, error)
+	write(ctx context.Context, key string, data []byte, contentType string, meta map[string]string) error
+}
+
+type minioReprocessBackend struct {
+	client *minio.Client
+	bucket string
+	opts   proxyOptions
+}
+
+func (b minioReprocessBackend) list(ctx context.Context, prefix string) <-chan minio.ObjectInfo {
+	return b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+}
+
+func (b minioReprocessBackend) read(ctx context.Context, key string) ([]byte, minio.ObjectInfo, error) {
+	obj, err := b.client.GetObject(ctx, b.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	data, err := io.ReadAll(obj)
+	return data, info, err
+}
+
+func (b minioReprocessBackend) write(ctx context.Context, key string, data []byte, contentType string, meta map[string]string) error {
+	if err := b.opts.UploadSlots.Acquire(ctx); err != nil {
+		return err
+	}
+	defer b.opts.UploadSlots.Release()
+	_, err := b.client.PutObject(ctx, b.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType, UserMetadata: meta})
+	if err == nil {
+		b.opts.changed(b.bucket, key)
+	}
+	return err
+}
+
+// reprocessJob re-runs the image pipeline over the preserved originals under a prefix and
+// overwrites the stored images with the result.
+type reprocessJob struct {
+	ID          string     `json:"id"`
+	Bucket      string     `json:"bucket"`
+	Prefix      string     `json:"prefix"`
+	State       string     `json:"state"` // running, done, canceled or failed
+	Scanned     int        `json:"scanned"`
+	Reprocessed int        `json:"reprocessed"`
+	Failed      int        `json:"failed"`
+	Errors      []string   `json:"errors,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// reprocessJobs tracks reprocess jobs in memory; only one runs at a time so a rerun over a large
+// prefix can't starve uploads.
+type reprocessJobs struct {
+	mu   sync.Mutex
+	jobs []*reprocessJob // oldest first
+}
+
+// start registers a job for bucket/prefix and runs it in the background, or returns the running
+// job and false when there is one.
+func (js *reprocessJobs) start(backend reprocessBackend, pipeline kzenimage.Options, bucket, prefix string) (reprocessJob, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	for _, j := range js.jobs {
+		if j.State == "running" {
+			return js.snapshot(j), false
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &reprocessJob{ID: newRequestID(), Bucket: bucket, Prefix: prefix, State: "running", StartedAt: time.Now().UTC(), cancel: cancel}
+	js.jobs = append(js.jobs, job)
+	if len(js.jobs) > reprocessKeepJobs {
+		js.jobs = js.jobs[len(js.jobs)-reprocessKeepJobs:]
+	}
+	go js.run(ctx, job, backend, pipeline)
+	return js.snapshot(job), true
+}
+
+func (js *reprocessJobs) run(ctx context.Context, job *reprocessJob, backend reprocessBackend, pipeline kzenimage.Options) {
+	defer job.cancel()
+	for info := range backend.list(ctx, mediahandlers.OriginalKey(job.Prefix)) {
+		if info.Err != nil {
+			js.finish(job, "failed", fmt.Sprintf("list: %v", info.Err))
+			return
+		}
+		err := reprocessOne(ctx, backend, pipeline, info.Key)
+		js.mu.Lock()
+		job.Scanned++
+		if err != nil {
+			job.Failed++
+			if len(job.Errors) < reprocessKeepErrors {
+				job.Errors = append(job.Errors, err.Error())
+			}
+		} else {
+			job.Reprocessed++
+		}
+		js.mu.Unlock()
+	}
+	if ctx.Err() != nil {
+		js.finish(job, "canceled", "")
+		return
+	}
+	js.finish(job, "done", "")
+}
+
+// reprocessOne runs the pipeline over the original at originalKey and stores the result under
+// the image's own key.
+func reprocessOne(ctx context.Context, backend reprocessBackend, pipeline kzenimage.Options, originalKey string) error {
+	ctx, cancel := context.WithTimeout(ctx, reprocessObjectTimeout)
+	defer cancel()
+	key := strings.TrimPrefix(originalKey, mediahandlers.OriginalsPrefix)
+	data, info, err := backend.read(ctx, originalKey)
+	if err != nil {
+		return fmt.Errorf("read %q: %w", originalKey, err)
+	}
+	out, contentType, err := kzenimage.ProcessBytes(ctx, data, key, pipeline)
+	if err != nil {
+		return err
+	}
+	if err := backend.write(ctx, key, out, contentType, info.UserMetadata); err != nil {
+		return fmt.Errorf("write %q: %w", key, err)
+	}
+	return nil
+}
+
+func (js *reprocessJobs) finish(job *reprocessJob, state, errMsg string) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	now := time.Now().UTC()
+	job.State = state
+	job.FinishedAt = &now
+	if errMsg != "" {
+		job.Errors = append(job.Errors, errMsg)
+	}
+	log.Printf("reprocess job %s of %s/%s %s: %d reprocessed, %d failed", job.ID, job.Bucket, job.Prefix, state, job.Reprocessed, job.Failed)
+}
+
+// snapshot copies job for encoding; js.mu must be held.
+func (js *reprocessJobs) snapshot(job *reprocessJob) reprocessJob {
+	c := *job
+	c.Errors = append([]string(nil), job.Errors...)
+	c.cancel = nil
+	return c
+}
+
+func (js *reprocessJobs) get(id string) (reprocessJob, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	for _, j := range js.jobs {
+		if j.ID == id {
+			return js.snapshot(j), true
+		}
+	}
+	return reprocessJob{}, false
+}
+
+func (js *reprocessJobs) list() []reprocessJob {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	out := make([]reprocessJob, 0, len(js.jobs))
+	for i := len(js.jobs) - 1; i >= 0; i-- {
+		out = append(out, js.snapshot(js.jobs[i]))
+	}
+	return out
+}
+
+func (js *reprocessJobs) stop(id string) (reprocessJob, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	for _, j := range js.jobs {
+		if j.ID == id {
+			j.cancel()
+			return js.snapshot(j), true
+		}
+	}
+	return reprocessJob{}, false
+}
+
+// reprocessHandler serves the admin reprocess endpoints (prefixes are relative to the bucket,
+// without the originals/ part; ?bucket= defaults to defaultBucket):
+//
+//	POST   /admin/reprocess?prefix=kzen/stories/  start a job, 202 with its status
+//	GET    /admin/reprocess                       recent jobs, newest first
+//	GET    /admin/reprocess/{id}                  status of one job
+//	DELETE /admin/reprocess/{id}                  cancel a running job
+func reprocessHandler(jobs *reprocessJobs, newBackend func(bucket string) reprocessBackend, pipeline kzenimage.Options, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/reprocess"), "/")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && id == "":
+			bucket := r.URL.Query().Get("bucket")
+			if bucket == "" {
+				bucket = defaultBucket
+			}
+			prefix := strings.TrimPrefix(r.URL.Query().Get("prefix"), "/")
+			job, ok := jobs.start(newBackend(bucket), pipeline, bucket, prefix)
+			if !ok {
+				respondErrorCode(w, "reprocess job "+job.ID+" is still running", "job_running", http.StatusConflict)
+				return
+			}
+			log.Printf("reprocess job %s of %s/%s started by %q", job.ID, bucket, prefix, apiKeyName(r.Context()))
+			w.Header().Set("Location", "/admin/reprocess/"+job.ID)
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(job)
+		case r.Method == http.MethodGet && id == "":
+			json.NewEncoder(w).Encode(map[string]any{"jobs": jobs.list()})
+		case r.Method == http.MethodGet || r.Method == http.MethodDelete:
+			get := jobs.get
+			if r.Method == http.MethodDelete {
+				get = jobs.stop
+			}
+			job, ok := get(id)
+			if !ok {
+				respondError(w, "unknown reprocess job", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(job)
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
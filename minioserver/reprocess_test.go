@@ -0,0 +1,112 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/kzenimage"
+)
+
+type memReprocessBackend struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (b *memReprocessBackend) list(_ context.Context, prefix string) <-chan minio.ObjectInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan minio.ObjectInfo, len(b.objects))
+	for k := range b.objects {
+		if strings.HasPrefix(k, prefix) {
+			ch <- minio.ObjectInfo{Key: k}
+		}
+	}
+	close(ch)
+	return ch
+}
+
+func (b *memReprocessBackend) read(_ context.Context, key string) ([]byte, minio.ObjectInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, minio.ObjectInfo{}, errors.New("missing")
+	}
+	return data, minio.ObjectInfo{Key: key, UserMetadata: map[string]string{"Original-Filename": "big.png"}}, nil
+}
+
+func (b *memReprocessBackend) write(_ context.Context, key string, data []byte, contentType string, _ map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = data
+	b.types[key] = contentType
+	return nil
+}
+
+func pngOfSize(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReprocessHandler_RunsPipelineOverOriginals(t *testing.T) {
+	backend := &memReprocessBackend{
+		objects: map[string][]byte{
+			"originals/kzen/a.jpeg":   pngOfSize(t, 300, 100),
+			"originals/kzen/huge.png": pngOfSize(t, 2000, 10), // over MaxDimensionPx
+			"originals/other/b.jpeg":  pngOfSize(t, 300, 100),
+			"kzen/a.jpeg":             []byte("old"),
+		},
+		types: map[string]string{},
+	}
+	pipeline := kzenimage.Options{MaxEdgePx: 150, JPEGQuality: 80, MaxDimensionPx: 1000}
+	h := reprocessHandler(&reprocessJobs{}, func(string) reprocessBackend { return backend }, pipeline, "b")
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/admin/reprocess?prefix=kzen/", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body.String())
+	}
+	var job reprocessJob
+	json.Unmarshal(rec.Body.Bytes(), &job)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.State == "running" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/admin/reprocess/"+job.ID, nil))
+		json.Unmarshal(rec.Body.Bytes(), &job)
+	}
+	if job.State != "done" || job.Scanned != 2 || job.Reprocessed != 1 || job.Failed != 1 {
+		t.Fatalf("job = %+v", job)
+	}
+	img, _, err := image.DecodeConfig(bytes.NewReader(backend.objects["kzen/a.jpeg"]))
+	if err != nil || img.Width != 150 || backend.types["kzen/a.jpeg"] != "image/png" {
+		t.Errorf("reprocessed image = %+v (%v) type %q", img, err, backend.types["kzen/a.jpeg"])
+	}
+	if _, touched := backend.objects["other/b.jpeg"]; touched {
+		t.Error("object outside the prefix reprocessed")
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/admin/reprocess/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", rec.Code)
+	}
+}
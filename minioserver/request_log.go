@@ -0,0 +1,108 @@
+package minioserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+func init() {
+	metrics.describe("kzen_slow_requests_total", "counter", "Requests slower than SLOW_REQUEST_THRESHOLD, by method.")
+	metrics.describe("kzen_large_objects_total", "counter", "Request (in) or response (out) bodies of at least LARGE_OBJECT_THRESHOLD bytes, by method.")
+}
+
+// logThresholds flag requests worth a closer look. Zero disables a threshold.
+type logThresholds struct {
+	SlowRequest time.Duration
+	LargeObject int64
+}
+
+// logMiddleware logs every non-GET request, as before, plus any request (GETs included) that took
+// at least t.SlowRequest, moved a body of at least t.LargeObject bytes or whose object download
+// was cut short. Those lines carry the status, sizes and who asked (client IP, API key name,
+// User-Agent, request ID) and are counted in kzen_slow_requests_total / kzen_large_objects_total;
+// for downloads they add how the body ended (download=complete|client_aborted|backend_error), the
+// bytes sent of the object's size and the error.
+func logMiddleware(t logThresholds) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, download := withDownloadRecord(r)
+			lw := &logResponseWriter{countingResponseWriter: countingResponseWriter{ResponseWriter: w}}
+			var body *countingReadCloser
+			if r.Body != nil && r.Body != http.NoBody {
+				body = &countingReadCloser{ReadCloser: r.Body}
+				r.Body = body
+			}
+			next.ServeHTTP(lw, r)
+			elapsed := time.Since(start)
+
+			var in int64
+			if body != nil {
+				in = body.n
+			}
+			slow := t.SlowRequest > 0 && elapsed >= t.SlowRequest
+			largeIn := t.LargeObject > 0 && in >= t.LargeObject
+			largeOut := t.LargeObject > 0 && lw.n >= t.LargeObject
+			if slow {
+				metrics.add("kzen_slow_requests_total", 1, "method", r.Method)
+			}
+			if largeIn {
+				metrics.add("kzen_large_objects_total", 1, "direction", "in", "method", r.Method)
+			}
+			if largeOut {
+				metrics.add("kzen_large_objects_total", 1, "direction", "out", "method", r.Method)
+			}
+			truncated := download.Outcome != "" && download.Outcome != downloadComplete
+			if slow || largeIn || largeOut || truncated {
+				kind := "large"
+				switch {
+				case truncated:
+					kind = "truncated"
+				case slow:
+					kind = "slow"
+				}
+				log.Printf("%s request: %s %s %s status=%d %v in=%d out=%d%s apiKey=%q ua=%q id=%s",
+					kind, clientIP(r), r.Method, r.URL.Path, lw.statusCode(), elapsed, in, lw.n, download.logFields(),
+					apiKeyName(r.Context()), r.UserAgent(), requestID(r.Context()))
+				return
+			}
+			if r.Method != http.MethodGet {
+				log.Printf("%s %s %s %v", clientIP(r), r.Method, r.URL.Path, elapsed)
+			}
+		})
+	}
+}
+
+// logResponseWriter records the status and body size of a response.
+type logResponseWriter struct {
+	countingResponseWriter
+	status int
+}
+
+func (lw *logResponseWriter) WriteHeader(status int) {
+	if lw.status == 0 {
+		lw.status = status
+	}
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+func (lw *logResponseWriter) statusCode() int {
+	if lw.status == 0 {
+		return http.StatusOK
+	}
+	return lw.status
+}
+
+// logFields formats d for a request log line: "" when no object was streamed.
+func (d *downloadRecord) logFields() string {
+	if d.Outcome == "" {
+		return ""
+	}
+	f := fmt.Sprintf(" download=%s sent=%d/%d", d.Outcome, d.Written, d.Size)
+	if d.Err != nil {
+		f += fmt.Sprintf(" err=%q", d.Err.Error())
+	}
+	return f
+}
@@ -0,0 +1,87 @@
+package minioserver
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+func TestLogMiddleware_Thresholds(t *testing.T) {
+	h := logMiddleware(logThresholds{SlowRequest: 20 * time.Millisecond, LargeObject: 1000})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/objects/slow" {
+				time.Sleep(30 * time.Millisecond)
+			}
+			if r.URL.Path == "/objects/big" {
+				w.Write(bytes.Repeat([]byte("x"), 1500))
+			}
+		}))
+
+	slowBefore := metrics.value("kzen_slow_requests_total", "method", "GET")
+	largeBefore := metrics.value("kzen_large_objects_total", "direction", "out", "method", "GET")
+	buf := captureLog(t)
+	for _, p := range []string{"/objects/small", "/objects/slow", "/objects/big"} {
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		req.Header.Set("User-Agent", "tester")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "/objects/small") {
+		t.Errorf("small GET was logged: %q", out)
+	}
+	if !strings.Contains(out, "slow request:") || !strings.Contains(out, "/objects/slow") {
+		t.Errorf("slow GET not logged: %q", out)
+	}
+	if !strings.Contains(out, "large request:") || !strings.Contains(out, "out=1500") || !strings.Contains(out, `ua="tester"`) {
+		t.Errorf("large GET not logged: %q", out)
+	}
+	if got := metrics.value("kzen_slow_requests_total", "method", "GET"); got != slowBefore+1 {
+		t.Errorf("slow counter = %v, want %v", got, slowBefore+1)
+	}
+	if got := metrics.value("kzen_large_objects_total", "direction", "out", "method", "GET"); got != largeBefore+1 {
+		t.Errorf("large counter = %v, want %v", got, largeBefore+1)
+	}
+}
+
+func TestLogMiddleware_LargeUpload(t *testing.T) {
+	h := logMiddleware(logThresholds{LargeObject: 100})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 512)
+		for {
+			if _, err := r.Body.Read(buf); err != nil {
+				break
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	buf := captureLog(t)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/objects/a", strings.NewReader(strings.Repeat("y", 200))))
+	if out := buf.String(); !strings.Contains(out, "large request:") || !strings.Contains(out, "status=201") || !strings.Contains(out, "in=200") {
+		t.Errorf("log = %q", out)
+	}
+}
+
+func TestLogMiddleware_TruncatedDownload(t *testing.T) {
+	buf := captureLog(t)
+	h := logMiddleware(logThresholds{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamBody(w, r, &failingReader{data: "par", err: errors.New("connection reset by minio")}, 7)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/objects/a.jpg", nil))
+	if out := buf.String(); !strings.Contains(out, "truncated request:") || !strings.Contains(out, "download=backend_error sent=3/7") {
+		t.Errorf("log = %q", out)
+	}
+}
@@ -0,0 +1,221 @@
+package minioserver
+
+import (
+	"archive/tar"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// BackupRestore re-uploads the objects of a backup archive (see Config.BackupTarget). Deletions
+// recorded by incremental archives are not replayed: restore the last full archive, then each
+// incremental one after it, in order.
+type BackupRestore struct {
+	// Archive is the name of an archive in the backup target or, for the command, a local file.
+	Archive string
+	// Bucket receives the objects; "" is the bucket backed up (BackupBucket, or Bucket).
+	Bucket string
+	// Prefix limits the restore to keys starting with it.
+	Prefix string
+	// Overwrite replaces objects that changed after the backup was taken; otherwise they are
+	// skipped as newer.
+	Overwrite bool
+	// Apply uploads the objects; otherwise the restore only reports what it would do.
+	Apply bool
+}
+
+// RestoredObject is an object a restore uploaded (or, in a dry run, would upload).
+type RestoredObject struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// RestoreReport lists what a restore uploaded and skipped.
+type RestoreReport struct {
+	DryRun   bool             `json:"dryRun"`
+	Archive  string           `json:"archive"`
+	Bucket   string           `json:"bucket"`
+	Restored []RestoredObject `json:"restored"`
+	Skipped  []PrefixSkip     `json:"skipped"`
+	Errors   []string         `json:"errors"`
+}
+
+// RestoreBackup runs r against cfg's MinIO, for the "kzen-go restore" command. r.Archive is read
+// from the local file system when such a file exists, and from cfg.BackupTarget otherwise.
+func RestoreBackup(ctx context.Context, cfg Config, r BackupRestore) (RestoreReport, error) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return RestoreReport{}, err
+	}
+	r.Bucket = cmp.Or(r.Bucket, cfg.BackupBucket, cfg.Bucket)
+	var archive io.ReadCloser
+	if fi, err := os.Stat(r.Archive); err == nil && fi.Mode().IsRegular() {
+		archive, err = os.Open(r.Archive)
+		if err != nil {
+			return RestoreReport{}, err
+		}
+	} else {
+		if cfg.BackupTarget == "" {
+			return RestoreReport{}, fmt.Errorf("%s: no such file, and BACKUP_TARGET is not set", r.Archive)
+		}
+		store, err := parseBackupTarget(client, cfg.BackupTarget)
+		if err != nil {
+			return RestoreReport{}, err
+		}
+		if archive, err = openBackupArchive(ctx, store, r.Archive); err != nil {
+			return RestoreReport{}, err
+		}
+	}
+	defer archive.Close()
+	return restoreArchive(ctx, client, archive, r, proxyOptions{})
+}
+
+// errArchiveName is returned for archive names that are not plain .tar.zst file names.
+var errArchiveName = errors.New("want the file name of a .tar.zst backup")
+
+// openBackupArchive opens the archive called name in store.
+func openBackupArchive(ctx context.Context, store backupStore, name string) (io.ReadCloser, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".tar.zst") {
+		return nil, fmt.Errorf("archive %q: %w", name, errArchiveName)
+	}
+	return store.get(ctx, name)
+}
+
+// restoreArchive uploads each object of the tar.zst archive to r.Bucket with the Content-Type,
+// Content-Encoding and user metadata it was backed up with. Objects whose current ETag is the
+// archived one are skipped as unchanged, and objects modified after the archived copy as newer
+// (unless r.Overwrite). A failed upload is reported and the restore goes on; a corrupt archive
+// stops it. Restored keys are reported to opts.changed.
+func restoreArchive(ctx context.Context, client *minio.Client, archive io.Reader, r BackupRestore, opts proxyOptions) (RestoreReport, error) {
+	report := RestoreReport{
+		DryRun:   !r.Apply,
+		Archive:  r.Archive,
+		Bucket:   r.Bucket,
+		Restored: []RestoredObject{},
+		Skipped:  []PrefixSkip{},
+		Errors:   []string{},
+	}
+	zr, err := zstd.NewReader(archive)
+	if err != nil {
+		return report, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, fmt.Errorf("read archive: %w", err)
+		}
+		key := hdr.Name
+		if hdr.Typeflag != tar.TypeReg || strings.HasPrefix(key, backupMetaDir) || !strings.HasPrefix(key, r.Prefix) {
+			continue
+		}
+
+		existing, err := client.StatObject(ctx, r.Bucket, key, minio.StatObjectOptions{})
+		switch {
+		case err == nil && existing.ETag == hdr.PAXRecords[backupPAXETag]:
+			report.Skipped = append(report.Skipped, PrefixSkip{Key: key, Reason: "unchanged since the backup"})
+			continue
+		case err == nil && !r.Overwrite && existing.LastModified.After(hdr.ModTime):
+			report.Skipped = append(report.Skipped, PrefixSkip{Key: key, Reason: "newer than the backup"})
+			continue
+		case err != nil && !golib.IsNotFound(err):
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: stat: %v", key, err))
+			continue
+		}
+		if r.Apply {
+			if err := restoreEntry(ctx, client, r.Bucket, hdr, tr); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", key, err))
+				continue
+			}
+			opts.changed(r.Bucket, key)
+		}
+		report.Restored = append(report.Restored, RestoredObject{Key: key, Size: hdr.Size})
+	}
+}
+
+func restoreEntry(ctx context.Context, client *minio.Client, bucket string, hdr *tar.Header, body io.Reader) error {
+	opts := minio.PutObjectOptions{
+		ContentType:     hdr.PAXRecords[backupPAXContentType],
+		ContentEncoding: hdr.PAXRecords[backupPAXContentEncoding],
+		UserMetadata:    map[string]string{},
+	}
+	for k, v := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(k, backupPAXMetaPrefix); ok {
+			opts.UserMetadata[name] = v
+		}
+	}
+	_, err := client.PutObject(ctx, bucket, hdr.Name, body, hdr.Size, opts)
+	return err
+}
+
+// restoreHandler serves POST /admin/backup/restore: {"archive", "bucket", "prefix", "overwrite",
+// "apply"} restores an archive of store, like "kzen-go restore", and answers with the report.
+func restoreHandler(client *minio.Client, store backupStore, defaultBucket string, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Archive   string `json:"archive"`
+			Bucket    string `json:"bucket"`
+			Prefix    string `json:"prefix"`
+			Overwrite bool   `json:"overwrite"`
+			Apply     bool   `json:"apply"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		restore := BackupRestore{
+			Archive:   req.Archive,
+			Bucket:    cmp.Or(req.Bucket, defaultBucket),
+			Prefix:    strings.TrimPrefix(req.Prefix, "/"),
+			Overwrite: req.Overwrite,
+			Apply:     req.Apply,
+		}
+
+		ctx, cancel := golib.RequestContext(r, 60*time.Minute)
+		defer cancel()
+
+		archive, err := openBackupArchive(ctx, store, restore.Archive)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			respondError(w, "archive not found", http.StatusNotFound)
+			return
+		case errors.Is(err, errArchiveName):
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			respondStorageError(w, err, "failed to open archive")
+			return
+		}
+		defer archive.Close()
+
+		report, err := restoreArchive(ctx, client, archive, restore, opts)
+		log.Printf("restore %s to %s by %q: %d restored, %d skipped, %d errors (dry run: %v)",
+			restore.Archive, restore.Bucket, apiKeyName(r.Context()), len(report.Restored), len(report.Skipped), len(report.Errors), report.DryRun)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,67 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRestoreHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["kzen/a.jpg"] = []byte("a")
+	objects["kzen/b.jpg"] = []byte("bb")
+	objects["kzen/docs/c.pdf"] = []byte("ccc")
+	store := dirBackupStore(t.TempDir())
+	b := &backupJob{client: client, bucket: "files", prefix: "kzen/", store: store}
+	b.start()
+	full, err := b.run(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(objects, "kzen/a.jpg")
+	delete(objects, "kzen/docs/c.pdf")
+
+	purger := recordingPurger()
+	h := restoreHandler(client, store, "files", proxyOptions{Purge: purger})
+	restore := func(body string) (*httptest.ResponseRecorder, RestoreReport) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/backup/restore", strings.NewReader(body)))
+		var report RestoreReport
+		json.Unmarshal(rec.Body.Bytes(), &report)
+		return rec, report
+	}
+
+	// A dry run reports the missing objects and uploads nothing.
+	rec, report := restore(`{"archive":"` + full.Archive + `"}`)
+	if rec.Code != http.StatusOK || !report.DryRun || len(report.Restored) != 2 || len(report.Skipped) != 1 || report.Skipped[0].Key != "kzen/b.jpg" {
+		t.Fatalf("dry run: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := objects["kzen/a.jpg"]; ok {
+		t.Fatal("dry run uploaded")
+	}
+
+	rec, report = restore(`{"archive":"` + full.Archive + `","prefix":"kzen/docs/","apply":true}`)
+	if rec.Code != http.StatusOK || len(report.Restored) != 1 || len(report.Errors) != 0 {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body.String())
+	}
+	if string(objects["kzen/docs/c.pdf"]) != "ccc" {
+		t.Errorf("objects = %v", objects)
+	}
+	if got := changedKeys(purger); !slices.Equal(got, []string{"kzen/docs/c.pdf"}) {
+		t.Errorf("changed after restore: %v", got)
+	}
+	if _, ok := objects["kzen/a.jpg"]; ok {
+		t.Error("restored outside the prefix")
+	}
+
+	if rec, _ := restore(`{"archive":"../etc/passwd"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad name: %d", rec.Code)
+	}
+	if rec, _ := restore(`{"archive":"kzen-backup-19700101T000000Z.tar.zst"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("missing archive: %d", rec.Code)
+	}
+}
@@ -0,0 +1,406 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// Resumable uploads keep no server state: everything lives under uploadStagingPrefix in the target
+// bucket, so any proxy instance can continue an upload after a restart.
+//
+//	.uploads/<id>/manifest.json                 target key, size, chunk size, content type
+//	.uploads/<id>/chunk-<n>-<sha256 hex>        one object per received chunk
+//
+// Putting the checksum in the chunk's name lets GET /uploads/{id} report every chunk and its hash
+// from a single listing. Completion composes the chunks into the target key server-side.
+const (
+	uploadStagingPrefix     = ".uploads/"
+	uploadManifestName      = "manifest.json"
+	uploadChunkChecksumHdr  = "X-Chunk-SHA256"
+	uploadDefaultChunkBytes = 8 << 20
+	// uploadMinChunkBytes is S3's minimum compose source size (all chunks but the last).
+	uploadMinChunkBytes = 5 << 20
+	uploadMaxChunkBytes = 512 << 20
+	uploadMaxChunks     = 10000 // ComposeObject source limit
+)
+
+type uploadManifest struct {
+	ID          string    `json:"id"`
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ChunkSize   int64     `json:"chunkSize"`
+	ContentType string    `json:"contentType,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func (m uploadManifest) chunks() int {
+	return int((m.Size + m.ChunkSize - 1) / m.ChunkSize)
+}
+
+// chunkLen is the exact size chunk n must have: ChunkSize, except the last one.
+func (m uploadManifest) chunkLen(n int) int64 {
+	if n == m.chunks()-1 {
+		return m.Size - int64(n)*m.ChunkSize
+	}
+	return m.ChunkSize
+}
+
+func uploadStagingDir(id string) string { return uploadStagingPrefix + id + "/" }
+
+func uploadChunkPrefix(id string, n int) string {
+	return fmt.Sprintf("%schunk-%06d-", uploadStagingDir(id), n)
+}
+
+// parseUploadChunkName extracts the index and checksum from ".uploads/<id>/chunk-<n>-<sha>".
+func parseUploadChunkName(key string) (int, string, bool) {
+	name := key[strings.LastIndex(key, "/")+1:]
+	rest, ok := strings.CutPrefix(name, "chunk-")
+	if !ok {
+		return 0, "", false
+	}
+	num, sum, ok := strings.Cut(rest, "-")
+	if !ok || len(sum) != sha256.Size*2 {
+		return 0, "", false
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, "", false
+	}
+	return n, sum, true
+}
+
+type uploadChunkInfo struct {
+	N      int    `json:"n"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type uploadStatus struct {
+	uploadManifest
+	Chunks  int               `json:"chunks"`
+	Present []uploadChunkInfo `json:"present"`
+	Missing []int             `json:"missing"`
+}
+
+// resumableUploadsHandler serves the resumable upload API under pathPrefix (e.g. "/uploads/").
+// Keys are relative to folderPrefix, as for the other upload handlers:
+//
+//	POST   {prefix}                  {"key","size","chunkSize"?,"contentType"?} -> 201 manifest
+//	PUT    {prefix}{id}/chunks/{n}   chunk n (0-based); optional X-Chunk-SHA256 is verified
+//	GET    {prefix}{id}              manifest + present chunks (with checksums) + missing indexes
+//	POST   {prefix}{id}/complete     compose chunks into key and clean up
+//	DELETE {prefix}{id}              abort and clean up
+func resumableUploadsHandler(client *minio.Client, bucket string, pathPrefix string, folderPrefix string, opts proxyOptions) http.HandlerFunc {
+	folder := strings.Trim(folderPrefix, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, pathPrefix), "/")
+		parts := strings.Split(rest, "/")
+		id := parts[0]
+		if id != "" {
+			if _, err := uuid.Parse(id); err != nil {
+				respondError(w, "unknown upload id", http.StatusNotFound)
+				return
+			}
+		}
+
+		switch {
+		case rest == "" && r.Method == http.MethodPost:
+			createUpload(client, bucket, folder, w, r)
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			getUploadStatus(client, bucket, id, w, r)
+		case len(parts) == 1 && r.Method == http.MethodDelete:
+			abortUpload(client, bucket, id, w, r)
+		case len(parts) == 3 && parts[1] == "chunks" && r.Method == http.MethodPut:
+			n, err := strconv.Atoi(parts[2])
+			if err != nil || n < 0 {
+				respondError(w, "invalid chunk number", http.StatusBadRequest)
+				return
+			}
+			putUploadChunk(client, bucket, id, n, opts, w, r)
+		case len(parts) == 2 && parts[1] == "complete" && r.Method == http.MethodPost:
+			completeUpload(client, bucket, id, opts, w, r)
+		default:
+			respondError(w, "not found", http.StatusNotFound)
+		}
+	}
+}
+
+func createUpload(client *minio.Client, bucket, folder string, w http.ResponseWriter, r *http.Request) {
+	var m uploadManifest
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		respondError(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	m.Key = strings.TrimPrefix(strings.TrimSpace(m.Key), "/")
+	if m.Key == "" || strings.HasPrefix(m.Key, uploadStagingPrefix) {
+		respondError(w, "valid key required", http.StatusBadRequest)
+		return
+	}
+	if folder != "" {
+		m.Key = path.Join(folder, m.Key)
+	}
+	if m.Size <= 0 {
+		respondError(w, "size must be positive", http.StatusBadRequest)
+		return
+	}
+	if m.ChunkSize == 0 {
+		m.ChunkSize = uploadDefaultChunkBytes
+	}
+	if m.ChunkSize < uploadMinChunkBytes || m.ChunkSize > uploadMaxChunkBytes {
+		respondError(w, fmt.Sprintf("chunkSize must be between %d and %d", uploadMinChunkBytes, uploadMaxChunkBytes), http.StatusBadRequest)
+		return
+	}
+	if m.chunks() > uploadMaxChunks {
+		respondError(w, fmt.Sprintf("size needs more than %d chunks; use a larger chunkSize", uploadMaxChunks), http.StatusBadRequest)
+		return
+	}
+	m.ID = uuid.New().String()
+	m.CreatedAt = time.Now().UTC()
+
+	data, _ := json.Marshal(m)
+	ctx, cancel := golib.RequestContext(r, 30*time.Second)
+	defer cancel()
+	if _, err := client.PutObject(ctx, bucket, uploadStagingDir(m.ID)+uploadManifestName, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"}); err != nil {
+		log.Printf("create upload %q: %v", m.Key, err)
+		respondStorageError(w, err, "failed to create upload")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(uploadStatus{uploadManifest: m, Chunks: m.chunks(), Present: []uploadChunkInfo{}, Missing: allChunks(m.chunks())})
+}
+
+func allChunks(n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = i
+	}
+	return out
+}
+
+func loadUploadManifest(ctx context.Context, client *minio.Client, bucket, id string) (uploadManifest, error) {
+	var m uploadManifest
+	obj, err := client.GetObject(ctx, bucket, uploadStagingDir(id)+uploadManifestName, minio.GetObjectOptions{})
+	if err != nil {
+		return m, err
+	}
+	defer obj.Close()
+	if err := json.NewDecoder(obj).Decode(&m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// respondManifestError maps a manifest load failure to 404 (unknown/finished upload) or 500.
+func respondManifestError(w http.ResponseWriter, id string, err error) {
+	if golib.IsNotFound(err) {
+		respondError(w, "unknown upload id", http.StatusNotFound)
+		return
+	}
+	log.Printf("load upload manifest %q: %v", id, err)
+	respondStorageError(w, err, "failed to load upload")
+}
+
+// listUploadChunks returns the received chunks by index. If a chunk was uploaded more than once
+// only the newest copy counts.
+func listUploadChunks(ctx context.Context, client *minio.Client, bucket, id string) (map[int]minio.ObjectInfo, map[int]string, error) {
+	objs := make(map[int]minio.ObjectInfo)
+	sums := make(map[int]string)
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: uploadStagingDir(id) + "chunk-", Recursive: true}) {
+		if obj.Err != nil {
+			return nil, nil, obj.Err
+		}
+		n, sum, ok := parseUploadChunkName(obj.Key)
+		if !ok {
+			continue
+		}
+		if prev, seen := objs[n]; seen && prev.LastModified.After(obj.LastModified) {
+			continue
+		}
+		objs[n] = obj
+		sums[n] = sum
+	}
+	return objs, sums, nil
+}
+
+func getUploadStatus(client *minio.Client, bucket, id string, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := golib.RequestContext(r, 30*time.Second)
+	defer cancel()
+	m, err := loadUploadManifest(ctx, client, bucket, id)
+	if err != nil {
+		respondManifestError(w, id, err)
+		return
+	}
+	objs, sums, err := listUploadChunks(ctx, client, bucket, id)
+	if err != nil {
+		log.Printf("list upload chunks %q: %v", id, err)
+		respondStorageError(w, err, "failed to list chunks")
+		return
+	}
+	st := uploadStatus{uploadManifest: m, Chunks: m.chunks(), Present: []uploadChunkInfo{}, Missing: []int{}}
+	for n := 0; n < m.chunks(); n++ {
+		if obj, ok := objs[n]; ok {
+			st.Present = append(st.Present, uploadChunkInfo{N: n, Size: obj.Size, SHA256: sums[n]})
+		} else {
+			st.Missing = append(st.Missing, n)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func putUploadChunk(client *minio.Client, bucket, id string, n int, opts proxyOptions, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := golib.RequestContext(r, 10*time.Minute)
+	defer cancel()
+	m, err := loadUploadManifest(ctx, client, bucket, id)
+	if err != nil {
+		respondManifestError(w, id, err)
+		return
+	}
+	if n >= m.chunks() {
+		respondError(w, fmt.Sprintf("chunk %d out of range (upload has %d chunks)", n, m.chunks()), http.StatusBadRequest)
+		return
+	}
+	want := m.chunkLen(n)
+	if r.ContentLength >= 0 && r.ContentLength != want {
+		respondError(w, fmt.Sprintf("chunk %d must be %d bytes", n, want), http.StatusBadRequest)
+		return
+	}
+	expectSum := strings.ToLower(r.Header.Get(uploadChunkChecksumHdr))
+
+	// The checksum is part of the object name, so the chunk must be read (and hashed) before it is
+	// stored. Chunks are bounded by uploadMaxChunkBytes.
+	data, err := io.ReadAll(io.LimitReader(r.Body, want+1))
+	if err != nil {
+		respondError(w, "failed to read chunk", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) != want {
+		respondError(w, fmt.Sprintf("chunk %d must be %d bytes, got %d", n, want, len(data)), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+	if expectSum != "" && expectSum != got {
+		respondError(w, fmt.Sprintf("chunk %d checksum mismatch: got %s", n, got), http.StatusBadRequest)
+		return
+	}
+
+	if err := opts.UploadSlots.Acquire(ctx); err != nil {
+		respondUploadBusy(w, opts.UploadSlots, err)
+		return
+	}
+	defer opts.UploadSlots.Release()
+
+	// Drop earlier copies of this chunk (a retry with different bytes) before storing the new one.
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: uploadChunkPrefix(id, n)}) {
+		if obj.Err == nil && !strings.HasSuffix(obj.Key, got) {
+			client.RemoveObject(ctx, bucket, obj.Key, minio.RemoveObjectOptions{})
+		}
+	}
+	if _, err := client.PutObject(ctx, bucket, uploadChunkPrefix(id, n)+got, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream"}); err != nil {
+		log.Printf("put upload chunk %q/%d: %v", id, n, err)
+		respondStorageError(w, err, "failed to store chunk")
+		return
+	}
+	opts.ByteStats.addIn(bucket, m.Key, int64(len(data)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadChunkInfo{N: n, Size: int64(len(data)), SHA256: got})
+}
+
+func completeUpload(client *minio.Client, bucket, id string, opts proxyOptions, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := golib.RequestContext(r, 10*time.Minute)
+	defer cancel()
+	m, err := loadUploadManifest(ctx, client, bucket, id)
+	if err != nil {
+		respondManifestError(w, id, err)
+		return
+	}
+	objs, _, err := listUploadChunks(ctx, client, bucket, id)
+	if err != nil {
+		log.Printf("list upload chunks %q: %v", id, err)
+		respondStorageError(w, err, "failed to list chunks")
+		return
+	}
+	srcs := make([]minio.CopySrcOptions, 0, m.chunks())
+	var missing []int
+	for n := 0; n < m.chunks(); n++ {
+		obj, ok := objs[n]
+		if !ok {
+			missing = append(missing, n)
+			continue
+		}
+		srcs = append(srcs, minio.CopySrcOptions{Bucket: bucket, Object: obj.Key})
+	}
+	if len(missing) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{"error": "upload incomplete", "code": "upload_incomplete", "missing": missing})
+		return
+	}
+
+	if err := opts.checkOwner(ctx, client, bucket, m.Key); err != nil {
+		respondOwnerError(w, err)
+		return
+	}
+	dst := minio.CopyDestOptions{Bucket: bucket, Object: m.Key, ReplaceMetadata: true}
+	if m.ContentType != "" {
+		dst.UserMetadata = map[string]string{"Content-Type": m.ContentType}
+	}
+	dst.UserMetadata = opts.stampOwner(ctx, dst.UserMetadata)
+	info, err := client.ComposeObject(ctx, dst, srcs...)
+	if err != nil {
+		log.Printf("compose upload %q -> %q: %v", id, m.Key, err)
+		respondStorageError(w, err, "failed to assemble upload")
+		return
+	}
+	removeUploadStaging(client, bucket, id)
+	opts.changed(bucket, m.Key)
+
+	w.Header().Set("Content-Type", "application/json")
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "key": m.Key, "size": info.Size})
+}
+
+func abortUpload(client *minio.Client, bucket, id string, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := golib.RequestContext(r, 30*time.Second)
+	defer cancel()
+	if _, err := loadUploadManifest(ctx, client, bucket, id); err != nil {
+		respondManifestError(w, id, err)
+		return
+	}
+	removeUploadStaging(client, bucket, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeUploadStaging deletes everything under .uploads/<id>/. Failures are only logged; leftovers
+// are harmless and can be expired with a bucket lifecycle rule on .uploads/.
+func removeUploadStaging(client *minio.Client, bucket, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	objs := client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: uploadStagingDir(id), Recursive: true})
+	for err := range client.RemoveObjects(ctx, bucket, objs, minio.RemoveObjectsOptions{}) {
+		log.Printf("remove upload staging %q: %v", err.ObjectName, err.Err)
+	}
+}
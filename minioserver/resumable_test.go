@@ -0,0 +1,73 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestUploadManifest_ChunkLayout(t *testing.T) {
+	m := uploadManifest{Size: 12<<20 + 5, ChunkSize: 5 << 20}
+	if got := m.chunks(); got != 3 {
+		t.Fatalf("chunks = %d, want 3", got)
+	}
+	if got := m.chunkLen(0); got != 5<<20 {
+		t.Errorf("chunkLen(0) = %d", got)
+	}
+	if got := m.chunkLen(2); got != 2<<20+5 {
+		t.Errorf("chunkLen(2) = %d, want remainder", got)
+	}
+
+	exact := uploadManifest{Size: 10 << 20, ChunkSize: 5 << 20}
+	if exact.chunks() != 2 || exact.chunkLen(1) != 5<<20 {
+		t.Errorf("exact multiple: chunks=%d last=%d", exact.chunks(), exact.chunkLen(1))
+	}
+}
+
+func TestParseUploadChunkName(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	n, got, ok := parseUploadChunkName(uploadChunkPrefix("id", 42) + sum)
+	if !ok || n != 42 || got != sum {
+		t.Fatalf("parse = %d %q %v", n, got, ok)
+	}
+	for _, bad := range []string{
+		".uploads/id/manifest.json",
+		".uploads/id/chunk-000001-short",
+		".uploads/id/chunk-x-" + sum,
+	} {
+		if _, _, ok := parseUploadChunkName(bad); ok {
+			t.Errorf("parseUploadChunkName(%q) accepted", bad)
+		}
+	}
+}
+
+func TestResumableUploadsHandler_RejectsBadRequests(t *testing.T) {
+	client, err := minio.New("localhost:9", &minio.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := resumableUploadsHandler(client, "b", "/uploads/", "", proxyOptions{})
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/uploads/not-a-uuid", "", http.StatusNotFound},
+		{http.MethodPost, "/uploads/", `{"key":"","size":10}`, http.StatusBadRequest},
+		{http.MethodPost, "/uploads/", `{"key":".uploads/x","size":10}`, http.StatusBadRequest},
+		{http.MethodPost, "/uploads/", `{"key":"a.bin","size":0}`, http.StatusBadRequest},
+		{http.MethodPost, "/uploads/", `{"key":"a.bin","size":10,"chunkSize":1024}`, http.StatusBadRequest},
+		{http.MethodPost, "/uploads/", `{"key":"a.bin","size":1099511627776,"chunkSize":5242880}`, http.StatusBadRequest},
+		{http.MethodPut, "/uploads/6ba7b810-9dad-11d1-80b4-00c04fd430c8/chunks/-1", "", http.StatusBadRequest},
+		{http.MethodPatch, "/uploads/6ba7b810-9dad-11d1-80b4-00c04fd430c8", "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+		if rec.Code != c.want {
+			t.Errorf("%s %s %s = %d, want %d", c.method, c.path, c.body, rec.Code, c.want)
+		}
+	}
+}
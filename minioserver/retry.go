@@ -0,0 +1,99 @@
+package minioserver
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+func init() {
+	metrics.describe("kzen_minio_retries_total", "counter", "MinIO calls retried after AccessDenied, by op (stat|get|range).")
+	metrics.describe("kzen_minio_retry_recovered_total", "counter", "MinIO calls that succeeded after at least one AccessDenied retry, by op.")
+	metrics.describe("kzen_minio_retry_exhausted_total", "counter", "MinIO calls still denied after every attempt, by op.")
+}
+
+// retryPolicy re-runs MinIO reads that fail with AccessDenied. MinIO intermittently denies
+// StatObject/GetObject under concurrent load (a policy evaluation issue on its side); the retry
+// counters show how often that still happens.
+type retryPolicy struct {
+	// Attempts is the total number of tries; 1 (or less) disables retrying.
+	Attempts int
+	// Delay is the mean wait between tries; each wait is jittered to 50-150% of it so requests
+	// denied together don't retry in lockstep.
+	Delay time.Duration
+}
+
+// defaultRetryPolicy is what the GET handlers used before the policy was configurable.
+var defaultRetryPolicy = retryPolicy{Attempts: 3, Delay: 50 * time.Millisecond}
+
+func (p retryPolicy) wait() time.Duration {
+	if p.Delay <= 0 {
+		return 0
+	}
+	return p.Delay/2 + rand.N(p.Delay)
+}
+
+// do calls fn until it succeeds, fails with anything but AccessDenied, attempts run out or ctx ends.
+// op labels the retry metrics.
+func (p retryPolicy) do(ctx context.Context, op string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			if attempt > 1 {
+				metrics.add("kzen_minio_retry_recovered_total", 1, "op", op)
+			}
+			return nil
+		}
+		if golib.MinioErrorResponse(err).Code != "AccessDenied" {
+			return err
+		}
+		if attempt >= p.Attempts {
+			if p.Attempts > 1 {
+				metrics.add("kzen_minio_retry_exhausted_total", 1, "op", op)
+			}
+			return err
+		}
+		metrics.add("kzen_minio_retries_total", 1, "op", op)
+		t := time.NewTimer(p.wait())
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// statObject is client.StatObject under p.
+func (p retryPolicy) statObject(ctx context.Context, client *minio.Client, bucket, key string) (minio.ObjectInfo, error) {
+	var info minio.ObjectInfo
+	err := p.do(ctx, "stat", func() (err error) {
+		info, err = client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+		return err
+	})
+	return info, err
+}
+
+// getObject opens key under p. minio-go only sends the GET on first use, so the object is
+// stat'ed here to surface (and retry) a denial before any bytes reach the client.
+func (p retryPolicy) getObject(ctx context.Context, client *minio.Client, bucket, key string, opts minio.GetObjectOptions) (*minio.Object, error) {
+	var obj *minio.Object
+	err := p.do(ctx, "get", func() error {
+		o, err := client.GetObject(ctx, bucket, key, opts)
+		if err != nil {
+			return err
+		}
+		if _, err := o.Stat(); err != nil {
+			o.Close()
+			return err
+		}
+		obj = o
+		return nil
+	})
+	return obj, err
+}
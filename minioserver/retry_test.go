@@ -0,0 +1,70 @@
+package minioserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var errDenied = minio.ErrorResponse{Code: "AccessDenied", Message: "Access Denied.", StatusCode: 403}
+
+func TestRetryPolicy_RecoversFromAccessDenied(t *testing.T) {
+	retries := metrics.value("kzen_minio_retries_total", "op", "test")
+	recovered := metrics.value("kzen_minio_retry_recovered_total", "op", "test")
+	calls := 0
+	err := retryPolicy{Attempts: 3, Delay: time.Millisecond}.do(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return errDenied
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("err = %v after %d calls", err, calls)
+	}
+	if got := metrics.value("kzen_minio_retries_total", "op", "test"); got != retries+2 {
+		t.Errorf("retries = %v, want %v", got, retries+2)
+	}
+	if got := metrics.value("kzen_minio_retry_recovered_total", "op", "test"); got != recovered+1 {
+		t.Errorf("recovered = %v, want %v", got, recovered+1)
+	}
+}
+
+func TestRetryPolicy_GivesUp(t *testing.T) {
+	exhausted := metrics.value("kzen_minio_retry_exhausted_total", "op", "test")
+	calls := 0
+	err := retryPolicy{Attempts: 2, Delay: time.Millisecond}.do(context.Background(), "test", func() error {
+		calls++
+		return errDenied
+	})
+	if err == nil || calls != 2 {
+		t.Fatalf("err = %v after %d calls", err, calls)
+	}
+	if got := metrics.value("kzen_minio_retry_exhausted_total", "op", "test"); got != exhausted+1 {
+		t.Errorf("exhausted = %v, want %v", got, exhausted+1)
+	}
+}
+
+func TestRetryPolicy_OnlyRetriesAccessDenied(t *testing.T) {
+	calls := 0
+	boom := errors.New("boom")
+	err := retryPolicy{Attempts: 5, Delay: time.Millisecond}.do(context.Background(), "test", func() error {
+		calls++
+		return boom
+	})
+	if err != boom || calls != 1 {
+		t.Fatalf("err = %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryPolicy_Jitter(t *testing.T) {
+	p := retryPolicy{Delay: 100 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := p.wait(); d < 50*time.Millisecond || d >= 150*time.Millisecond {
+			t.Fatalf("wait = %v, want within [50ms, 150ms)", d)
+		}
+	}
+}
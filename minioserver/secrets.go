@@ -0,0 +1,426 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Secret stores for Config.SecretsProvider.
+const (
+	SecretsVault = "vault" // HashiCorp Vault KV (v1 or v2) at VaultAddr
+	SecretsAWS   = "aws"   // AWS Secrets Manager, signed with the standard AWS credentials
+)
+
+// Fields read from the secret; each takes the place of the env variable of the same name.
+const (
+	secretAccessKey = "MINIO_ACCESS_KEY"
+	secretSecretKey = "MINIO_SECRET_KEY"
+	secretAPIKey    = "API_KEY"
+	secretAPIKeys   = "API_KEYS"
+)
+
+// secretStore reads a secret as a flat map of values.
+type secretStore interface {
+	fetch(ctx context.Context) (map[string]string, error)
+}
+
+// secretsWatcher holds the values of the configured secret and re-reads it periodically, so a
+// secret rotated in the store reaches the MinIO credentials and the API key set without a restart.
+type secretsWatcher struct {
+	store secretStore
+	name  string // store and path, for logs
+
+	mu       sync.RWMutex
+	values   map[string]string
+	version  string // fingerprint of values
+	onChange []func(map[string]string)
+}
+
+// withSecrets reads cfg's secret when cfg.SecretsProvider is set and returns cfg with the watcher
+// attached and the secret's MinIO keys in place of AccessKey/SecretKey. The watcher refreshes the
+// secret every SecretsRefresh until the process exits.
+func withSecrets(cfg Config) (Config, error) {
+	if cfg.SecretsProvider == "" || cfg.secrets != nil {
+		return cfg, nil
+	}
+	if cfg.SecretsPath == "" {
+		return cfg, fmt.Errorf("secrets provider %q needs a secret path", cfg.SecretsProvider)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	w := &secretsWatcher{name: cfg.SecretsProvider + " " + cfg.SecretsPath}
+	switch cfg.SecretsProvider {
+	case SecretsVault:
+		if cfg.VaultAddr == "" {
+			return cfg, fmt.Errorf("secrets provider vault needs VaultAddr")
+		}
+		w.store = &vaultStore{addr: cfg.VaultAddr, path: cfg.SecretsPath, token: cfg.VaultToken, tokenFile: cfg.VaultTokenFile, client: client}
+	case SecretsAWS:
+		region := cfg.SecretsRegion
+		if arn := strings.Split(cfg.SecretsPath, ":"); len(arn) > 3 && arn[0] == "arn" {
+			region = arn[3]
+		}
+		if region == "" {
+			return cfg, fmt.Errorf("secrets provider aws needs a region")
+		}
+		w.store = &awsSecretsStore{
+			endpoint: "https://secretsmanager." + region + ".amazonaws.com/",
+			region:   region,
+			secretID: cfg.SecretsPath,
+			creds: credentials.NewChainCredentials([]credentials.Provider{
+				&credentials.EnvAWS{},
+				&credentials.FileAWSCredentials{},
+				&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+			}),
+			client: client,
+		}
+	default:
+		return cfg, fmt.Errorf("unknown secrets provider %q", cfg.SecretsProvider)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := w.refresh(ctx); err != nil {
+		return cfg, fmt.Errorf("secrets: %w", err)
+	}
+	cfg.secrets = w
+	if v := w.get(secretAccessKey); v != "" {
+		cfg.AccessKey = v
+	}
+	if v := w.get(secretSecretKey); v != "" {
+		cfg.SecretKey = v
+	}
+	every := cfg.SecretsRefresh
+	if every <= 0 {
+		every = 5 * time.Minute
+	}
+	go w.run(context.Background(), every)
+	return cfg, nil
+}
+
+func (w *secretsWatcher) run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			if err := w.refresh(fetchCtx); err != nil {
+				log.Printf("secrets refresh: %v (keeping previous values)", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// refresh reads the secret and, when it changed, swaps the values and calls the onChange hooks.
+func (w *secretsWatcher) refresh(ctx context.Context) error {
+	values, err := w.store.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", w.name, err)
+	}
+	if _, err := apiKeysFromSecret(values); err != nil {
+		return fmt.Errorf("%s: %w", w.name, err)
+	}
+	canonical, _ := json.Marshal(values) // map keys are sorted
+	sum := sha256.Sum256(canonical)
+	version := hex.EncodeToString(sum[:8])
+
+	w.mu.Lock()
+	if version == w.version {
+		w.mu.Unlock()
+		return nil
+	}
+	first := w.version == ""
+	w.values, w.version = values, version
+	hooks := append([]func(map[string]string){}, w.onChange...)
+	w.mu.Unlock()
+
+	if first {
+		log.Printf("secrets loaded from %s", w.name)
+		return nil
+	}
+	log.Printf("secrets reloaded from %s", w.name)
+	for _, fn := range hooks {
+		fn(values)
+	}
+	return nil
+}
+
+func (w *secretsWatcher) get(name string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.values[name]
+}
+
+func (w *secretsWatcher) snapshot() (map[string]string, string) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.values, w.version
+}
+
+// notify calls fn with the new values whenever the secret changes.
+func (w *secretsWatcher) notify(fn func(map[string]string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onChange = append(w.onChange, fn)
+}
+
+// apiKeysFromSecret returns the keys of the API_KEY and API_KEYS fields of values.
+func apiKeysFromSecret(values map[string]string) ([]APIKey, error) {
+	keys, err := ParseAPIKeys(values[secretAPIKeys])
+	if err != nil {
+		return nil, err
+	}
+	if k := values[secretAPIKey]; k != "" {
+		keys = append([]APIKey{{Name: "default", Key: k}}, keys...)
+	}
+	return keys, nil
+}
+
+// secretCredentials are the MinIO keys of the watched secret; they expire when it changes.
+// Fields missing from the secret fall back to the configured keys.
+type secretCredentials struct {
+	w                    *secretsWatcher
+	accessKey, secretKey string
+
+	version string
+}
+
+func (s *secretCredentials) Retrieve() (credentials.Value, error) {
+	values, version := s.w.snapshot()
+	v := credentials.Value{
+		AccessKeyID:     values[secretAccessKey],
+		SecretAccessKey: values[secretSecretKey],
+		SignerType:      credentials.SignatureV4,
+	}
+	if v.AccessKeyID == "" {
+		v.AccessKeyID = s.accessKey
+	}
+	if v.SecretAccessKey == "" {
+		v.SecretAccessKey = s.secretKey
+	}
+	s.version = version
+	return v, nil
+}
+
+func (s *secretCredentials) IsExpired() bool {
+	_, version := s.w.snapshot()
+	return version != s.version
+}
+
+// secretValues flattens a secret's JSON object; non-string values (e.g. API_KEYS stored as an
+// array) are kept as their JSON.
+func secretValues(data []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			values[k] = s
+		} else {
+			values[k] = string(v)
+		}
+	}
+	return values, nil
+}
+
+// vaultStore reads a KV secret from Vault. The token comes from tokenFile (re-read on every
+// request, as written by a Vault agent) or token, and is renewed on each read.
+type vaultStore struct {
+	addr, path       string
+	token, tokenFile string
+	client           *http.Client
+
+	noRenew bool // the token is not renewable (e.g. a root token)
+}
+
+func (v *vaultStore) fetch(ctx context.Context) (map[string]string, error) {
+	token := v.token
+	if v.tokenFile != "" {
+		data, err := os.ReadFile(v.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("vault token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if !v.noRenew {
+		v.renew(ctx, token)
+	}
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := v.call(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(v.path, "/"), token, &resp); err != nil {
+		return nil, err
+	}
+	// KV v2 nests the values under data.data, next to data.metadata.
+	var v2 struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if json.Unmarshal(resp.Data, &v2) == nil && len(v2.Metadata) > 0 && len(v2.Data) > 0 {
+		return secretValues(v2.Data)
+	}
+	return secretValues(resp.Data)
+}
+
+// renew extends the token's TTL; tokens Vault refuses to renew are not tried again.
+func (v *vaultStore) renew(ctx context.Context, token string) {
+	err := v.call(ctx, http.MethodPost, "/v1/auth/token/renew-self", token, nil)
+	var statusErr *vaultStatusError
+	if errors.As(err, &statusErr) && statusErr.status < 500 {
+		log.Printf("vault token not renewed: %v", err)
+		v.noRenew = true
+	} else if err != nil {
+		log.Printf("vault token renewal: %v", err)
+	}
+}
+
+type vaultStatusError struct {
+	status int
+	msg    string
+}
+
+func (e *vaultStatusError) Error() string { return fmt.Sprintf("vault: %d %s", e.status, e.msg) }
+
+func (v *vaultStore) call(ctx context.Context, method, path, token string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.addr, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(body, &e)
+		return &vaultStatusError{status: resp.StatusCode, msg: strings.Join(e.Errors, "; ")}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// awsSecretsStore reads a secret from AWS Secrets Manager with GetSecretValue. Its SecretString
+// must be a JSON object.
+type awsSecretsStore struct {
+	endpoint, region, secretID string
+	creds                      *credentials.Credentials
+	client                     *http.Client
+}
+
+func (a *awsSecretsStore) fetch(ctx context.Context) (map[string]string, error) {
+	body, _ := json.Marshal(map[string]string{"SecretId": a.secretID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	v, err := a.creds.Get()
+	if err != nil || v.SignerType.IsAnonymous() {
+		return nil, fmt.Errorf("no AWS credentials")
+	}
+	signAWSv4(req, body, v, a.region, "secretsmanager", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secrets manager: %d %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return secretValues([]byte(out.SecretString))
+}
+
+// signAWSv4 signs req (whose body is body) for service with AWS Signature Version 4, covering
+// the Host header and every header already set on req.
+func signAWSv4(req *http.Request, body []byte, v credentials.Value, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if v.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", v.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vals := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payload := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + v.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		v.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,128 @@
+package minioserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestWithSecrets_VaultRotation(t *testing.T) {
+	var secretKey atomic.Value
+	secretKey.Store("sk1")
+	var renewed atomic.Int32
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "tok" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/auth/token/renew-self":
+			renewed.Add(1)
+		case "/v1/secret/data/kzen":
+			fmt.Fprintf(w, `{"data":{"data":{"MINIO_SECRET_KEY":%q,"API_KEYS":[{"name":"app","key":"k-%s"}]},"metadata":{"version":1}}}`,
+				secretKey.Load(), secretKey.Load())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer vault.Close()
+
+	cfg, err := withSecrets(Config{
+		AccessKey: "ak", SecretKey: "env-secret",
+		SecretsProvider: SecretsVault, SecretsPath: "secret/data/kzen", SecretsRefresh: time.Hour,
+		VaultAddr: vault.URL, VaultToken: "tok",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SecretKey != "sk1" || cfg.AccessKey != "ak" || renewed.Load() != 1 {
+		t.Fatalf("keys %s/%s, renewals %d", cfg.AccessKey, cfg.SecretKey, renewed.Load())
+	}
+	creds, err := minioCredentials(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := apiKeysFromConfig(cfg)
+	if name, err := keys.lookup("k-sk1", time.Now()); err != nil || name != "app" {
+		t.Fatalf("secret API key: %q, %v", name, err)
+	}
+
+	secretKey.Store("sk2")
+	if err := cfg.secrets.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := creds.Get(); v.AccessKeyID != "ak" || v.SecretAccessKey != "sk2" {
+		t.Errorf("after rotation: keys %s/%s", v.AccessKeyID, v.SecretAccessKey)
+	}
+	if _, err := keys.lookup("k-sk1", time.Now()); err == nil {
+		t.Error("old API key still accepted")
+	}
+	if _, err := keys.lookup("k-sk2", time.Now()); err != nil {
+		t.Errorf("new API key: %v", err)
+	}
+
+	if _, err := withSecrets(Config{SecretsProvider: SecretsVault, SecretsPath: "secret/data/kzen", VaultAddr: vault.URL, VaultToken: "bad"}); err == nil {
+		t.Error("denied secret read did not fail startup")
+	}
+}
+
+func TestVaultStore_KVv1(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/token/renew-self" {
+			http.Error(w, `{"errors":["token not renewable"]}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"lease_duration":2764800,"data":{"API_KEY":"abc"}}`)
+	}))
+	defer vault.Close()
+	store := &vaultStore{addr: vault.URL, path: "kv/kzen", client: vault.Client()}
+	values, err := store.fetch(context.Background())
+	if err != nil || values["API_KEY"] != "abc" {
+		t.Fatalf("fetch = %v, %v", values, err)
+	}
+	if !store.noRenew {
+		t.Error("refused renewal retried")
+	}
+}
+
+func TestAWSSecretsStore(t *testing.T) {
+	sm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"Name":"kzen","SecretString":"{\"MINIO_SECRET_KEY\":\"sk\"}"}`)
+	}))
+	defer sm.Close()
+	store := &awsSecretsStore{
+		endpoint: sm.URL, region: "eu-west-1", secretID: "kzen",
+		creds:  credentials.NewStaticV4("AKID", "secret", ""),
+		client: sm.Client(),
+	}
+	values, err := store.fetch(context.Background())
+	if err != nil || values["MINIO_SECRET_KEY"] != "sk" {
+		t.Errorf("fetch = %v, %v", values, err)
+	}
+}
+
+// TestSignAWSv4 checks the signer against the get-vanilla case of the AWS SigV4 test suite.
+func TestSignAWSv4(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	req.Header = http.Header{}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	v := credentials.Value{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSv4(req, nil, v, "us-east-1", "service", now)
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
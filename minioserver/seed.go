@@ -0,0 +1,143 @@
+package minioserver
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	// seedAttempts rounds are made at seedRetryDelay intervals before Run gives up on an asset
+	// it could not check or upload, e.g. because MinIO came up after the proxy.
+	seedAttempts   = 10
+	seedRetryDelay = 30 * time.Second
+)
+
+// SeedAsset is a default object (placeholder avatar, default cover) Run uploads from a local
+// file when its key is missing from the bucket. Existing objects are never replaced.
+type SeedAsset struct {
+	Bucket string `json:"bucket,omitempty"` // defaults to Config.Bucket
+	Key    string `json:"key"`
+	File   string `json:"file"` // local path; relative paths in a seed file are relative to it
+	// ContentType defaults to the type of the key's (or the file's) extension.
+	ContentType  string `json:"contentType,omitempty"`
+	CacheControl string `json:"cacheControl,omitempty"`
+}
+
+// ParseSeedAssets reads seed assets from a JSON array, e.g.
+// [{"key":"defaults/avatar.png","file":"/etc/kzen/seed/avatar.png"}].
+// A value starting with "@" is read from that file path. Empty input yields no assets.
+func ParseSeedAssets(raw string) ([]SeedAsset, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	dir := ""
+	if file, ok := strings.CutPrefix(raw, "@"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read seed assets file: %w", err)
+		}
+		raw, dir = string(data), filepath.Dir(file)
+	}
+	var assets []SeedAsset
+	if err := json.Unmarshal([]byte(raw), &assets); err != nil {
+		return nil, fmt.Errorf("parse seed assets: %w", err)
+	}
+	for i := range assets {
+		if err := assets[i].normalize(dir); err != nil {
+			return nil, fmt.Errorf("seed asset %d: %w", i, err)
+		}
+	}
+	return assets, nil
+}
+
+func (a *SeedAsset) normalize(dir string) error {
+	a.Key = strings.TrimPrefix(a.Key, "/")
+	if a.Key == "" || strings.HasSuffix(a.Key, "/") {
+		return fmt.Errorf("key %q must name an object", a.Key)
+	}
+	if a.File == "" {
+		return fmt.Errorf("%s: file required", a.Key)
+	}
+	if dir != "" && !filepath.IsAbs(a.File) {
+		a.File = filepath.Join(dir, a.File)
+	}
+	if fi, err := os.Stat(a.File); err != nil {
+		return fmt.Errorf("%s: %w", a.Key, err)
+	} else if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s: %s is not a regular file", a.Key, a.File)
+	}
+	if a.ContentType == "" {
+		a.ContentType = cmp.Or(mime.TypeByExtension(path.Ext(a.Key)), mime.TypeByExtension(filepath.Ext(a.File)), "application/octet-stream")
+	}
+	return nil
+}
+
+// seedAssets uploads the assets missing from their bucket and returns the ones that could not be
+// checked or uploaded.
+func seedAssets(ctx context.Context, client *minio.Client, defaultBucket string, assets []SeedAsset) []SeedAsset {
+	var failed []SeedAsset
+	for _, a := range assets {
+		bucket := cmp.Or(a.Bucket, defaultBucket)
+		uploaded, err := seedAsset(ctx, client, bucket, a)
+		switch {
+		case err != nil:
+			log.Printf("seed %s/%s: %v", bucket, a.Key, err)
+			failed = append(failed, a)
+		case uploaded:
+			log.Printf("seed %s/%s: uploaded from %s", bucket, a.Key, a.File)
+		}
+	}
+	return failed
+}
+
+func seedAsset(ctx context.Context, client *minio.Client, bucket string, a SeedAsset) (bool, error) {
+	_, err := client.StatObject(ctx, bucket, a.Key, minio.StatObjectOptions{})
+	if err == nil {
+		return false, nil
+	}
+	if !golib.IsNotFound(err) {
+		return false, err
+	}
+	f, err := os.Open(a.File)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	_, err = client.PutObject(ctx, bucket, a.Key, f, fi.Size(), minio.PutObjectOptions{ContentType: a.ContentType, CacheControl: a.CacheControl})
+	return err == nil, err
+}
+
+// runSeedAssets seeds assets in the background of startup, retrying the ones that failed.
+func runSeedAssets(client *minio.Client, defaultBucket string, assets []SeedAsset) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		assets = seedAssets(ctx, client, defaultBucket, assets)
+		cancel()
+		if len(assets) == 0 {
+			return
+		}
+		if attempt == seedAttempts {
+			log.Printf("WARNING seed: giving up on %d asset(s) after %d attempts", len(assets), attempt)
+			return
+		}
+		time.Sleep(seedRetryDelay)
+	}
+}
@@ -0,0 +1,68 @@
+package minioserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSeedAssets(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "avatar.png"), []byte("png"), 0o644)
+	cfgFile := filepath.Join(dir, "seed.json")
+	os.WriteFile(cfgFile, []byte(`[{"key":"/defaults/avatar.png","file":"avatar.png"},{"key":"defaults/cover","file":"avatar.png","contentType":"image/jpeg"}]`), 0o644)
+
+	assets, err := ParseSeedAssets("@" + cfgFile)
+	if err != nil || len(assets) != 2 {
+		t.Fatalf("parse: %v %v", assets, err)
+	}
+	if a := assets[0]; a.Key != "defaults/avatar.png" || a.File != filepath.Join(dir, "avatar.png") || a.ContentType != "image/png" {
+		t.Errorf("asset 0: %+v", a)
+	}
+	if a := assets[1]; a.ContentType != "image/jpeg" {
+		t.Errorf("asset 1: %+v", a)
+	}
+
+	for _, raw := range []string{
+		`[{"key":"","file":"x"}]`,
+		`[{"key":"a.png"}]`,
+		`[{"key":"a.png","file":"` + filepath.Join(dir, "missing.png") + `"}]`,
+		`[{"key":"a.png","file":"` + dir + `"}]`,
+		`{`,
+	} {
+		if _, err := ParseSeedAssets(raw); err == nil {
+			t.Errorf("%s: want an error", raw)
+		}
+	}
+	if assets, err := ParseSeedAssets(""); err != nil || assets != nil {
+		t.Errorf("empty: %v %v", assets, err)
+	}
+}
+
+func TestSeedAssets_UploadsOnlyMissing(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "avatar.png")
+	os.WriteFile(file, []byte("default"), 0o644)
+	objects["defaults/cover.png"] = []byte("custom")
+
+	assets := []SeedAsset{
+		{Key: "defaults/avatar.png", File: file, ContentType: "image/png"},
+		{Key: "defaults/cover.png", File: file, ContentType: "image/png"},
+	}
+	if failed := seedAssets(context.Background(), client, "files", assets); len(failed) != 0 {
+		t.Fatalf("failed: %v", failed)
+	}
+	if string(objects["defaults/avatar.png"]) != "default" {
+		t.Errorf("missing asset not uploaded: %q", objects["defaults/avatar.png"])
+	}
+	if string(objects["defaults/cover.png"]) != "custom" {
+		t.Errorf("existing object replaced: %q", objects["defaults/cover.png"])
+	}
+
+	client, _ = selfTestS3(t, true)
+	if failed := seedAssets(context.Background(), client, "files", assets[:1]); len(failed) != 1 {
+		t.Errorf("denied upload: want 1 failed, got %v", failed)
+	}
+}
@@ -0,0 +1,170 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// selfTestPrefix holds the canary objects of self-tests; each is deleted by the test that
+// wrote it.
+const selfTestPrefix = "kzen-selftest/"
+
+// SelfTestStep is one MinIO call of a self-test.
+type SelfTestStep struct {
+	Name       string  `json:"name"` // bucket, upload, stat, download, delete
+	OK         bool    `json:"ok"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+	Code       string  `json:"code,omitempty"` // S3 error code, if MinIO answered
+}
+
+// SelfTestReport is the result of SelfTest: every step run and, when one failed, a diagnosis
+// naming the likely cause.
+type SelfTestReport struct {
+	OK        bool           `json:"ok"`
+	Endpoint  string         `json:"endpoint"`
+	Bucket    string         `json:"bucket"`
+	Key       string         `json:"key"`
+	Steps     []SelfTestStep `json:"steps"`
+	Diagnosis string         `json:"diagnosis,omitempty"`
+}
+
+// runSelfTest writes a small canary object to bucket, stats it, reads it back and deletes it,
+// stopping at the first failed step (the canary is still deleted once it was written).
+func runSelfTest(ctx context.Context, client *minio.Client, bucket string) SelfTestReport {
+	report := SelfTestReport{
+		Endpoint: client.EndpointURL().Host,
+		Bucket:   bucket,
+		Key:      selfTestPrefix + uuid.NewString(),
+	}
+	canary := []byte("kzen-go self-test " + time.Now().UTC().Format(time.RFC3339Nano) + "\n")
+	step := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		s := SelfTestStep{Name: name, OK: err == nil, DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+		if err != nil {
+			s.Error = err.Error()
+			s.Code = golib.MinioErrorResponse(err).Code
+			if report.Diagnosis == "" {
+				report.Diagnosis = diagnoseSelfTest(name, err, report)
+			}
+		}
+		report.Steps = append(report.Steps, s)
+		return err == nil
+	}
+
+	report.OK = step("bucket", func() error {
+		ok, err := client.BucketExists(ctx, bucket)
+		if err == nil && !ok {
+			return minio.ErrorResponse{Code: "NoSuchBucket", Message: "bucket does not exist", StatusCode: http.StatusNotFound}
+		}
+		return err
+	}) && step("upload", func() error {
+		_, err := client.PutObject(ctx, bucket, report.Key, bytes.NewReader(canary), int64(len(canary)),
+			minio.PutObjectOptions{ContentType: "text/plain"})
+		return err
+	})
+	if !report.OK {
+		return report
+	}
+	report.OK = step("stat", func() error {
+		info, err := client.StatObject(ctx, bucket, report.Key, minio.StatObjectOptions{})
+		if err == nil && info.Size != int64(len(canary)) {
+			return fmt.Errorf("stat reports %d bytes, uploaded %d", info.Size, len(canary))
+		}
+		return err
+	}) && step("download", func() error {
+		obj, err := client.GetObject(ctx, bucket, report.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		data, err := io.ReadAll(obj)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, canary) {
+			return errSelfTestCorrupt
+		}
+		return nil
+	})
+	// Delete even after a failed stat or download, so no canary is left behind.
+	if !step("delete", func() error {
+		return client.RemoveObject(ctx, bucket, report.Key, minio.RemoveObjectOptions{})
+	}) {
+		report.OK = false
+	}
+	return report
+}
+
+var errSelfTestCorrupt = errors.New("downloaded canary differs from the upload")
+
+// diagnoseSelfTest explains the failure of step in operator terms.
+func diagnoseSelfTest(step string, err error, report SelfTestReport) string {
+	var netErr net.Error
+	code := golib.MinioErrorResponse(err).Code
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (code == "" && errors.As(err, &netErr)):
+		return fmt.Sprintf("network: MinIO at %s did not answer (%v); check MINIO_ENDPOINT, MINIO_USE_SSL, DNS and firewalls", report.Endpoint, err)
+	case code == "InvalidAccessKeyId" || code == "SignatureDoesNotMatch":
+		return "credentials: MinIO rejected the access key or secret; check MINIO_ACCESS_KEY/MINIO_SECRET_KEY or the credential sources"
+	case code == "NoSuchBucket":
+		return fmt.Sprintf("bucket: %q does not exist on %s", report.Bucket, report.Endpoint)
+	case code == "AccessDenied" || code == "AllAccessDisabled":
+		return fmt.Sprintf("policy: the credentials may not %s in %s/%s; check the user's policy and the bucket policy", step, report.Bucket, selfTestPrefix)
+	case errors.Is(err, errSelfTestCorrupt):
+		return "network: the object read back differs from the one written; check proxies or gateways in front of MinIO"
+	case golib.MinioStatus(err) == http.StatusServiceUnavailable:
+		return fmt.Sprintf("server: MinIO is unavailable or overloaded (%s)", code)
+	}
+	return fmt.Sprintf("%s failed: %v", step, err)
+}
+
+// SelfTest runs the canary check of POST /admin/selftest against cfg's MinIO and bucket, for the
+// "kzen-go check" command.
+func SelfTest(ctx context.Context, cfg Config) (SelfTestReport, error) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return SelfTestReport{}, err
+	}
+	return runSelfTest(ctx, client, cfg.Bucket), nil
+}
+
+// selfTestHandler serves POST /admin/selftest: a canary round trip through defaultBucket (or
+// ?bucket=). The report comes with 200 when every step passed, 503 otherwise.
+func selfTestHandler(client *minio.Client, defaultBucket string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bucket := r.URL.Query().Get("bucket")
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+		report := runSelfTest(ctx, client, bucket)
+		status := http.StatusOK
+		if !report.OK {
+			status = http.StatusServiceUnavailable
+			log.Printf("self-test of %s failed: %s", bucket, report.Diagnosis)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,180 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// selfTestS3 is a one-bucket S3 stand-in (no multipart uploads, every ETag "abc", user metadata
+// kept with each object); denyPut answers uploads with AccessDenied.
+func selfTestS3(t *testing.T, denyPut bool) (*minio.Client, map[string][]byte) {
+	t.Helper()
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	encodings := map[string]string{}     // Content-Encoding stored with each upload
+	metadata := map[string]http.Header{} // X-Amz-Meta-* headers stored with each upload
+	userMeta := func(h http.Header) http.Header {
+		meta := http.Header{}
+		for k, v := range h {
+			if strings.HasPrefix(k, "X-Amz-Meta-") {
+				meta[k] = v
+			}
+		}
+		return meta
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/files/")
+		if r.URL.Path == "/files/" || r.URL.Path == "/files" {
+			if r.Method == http.MethodGet {
+				prefix, delimiter := r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter")
+				keys, folders := []string{}, map[string]bool{}
+				for k := range objects {
+					if !strings.HasPrefix(k, prefix) {
+						continue
+					}
+					// With a delimiter, keys below the next one roll up into common prefixes.
+					if i := strings.Index(k[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+						folders[k[:len(prefix)+i+1]] = true
+						continue
+					}
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				io.WriteString(w, `<ListBucketResult><Name>files</Name><IsTruncated>false</IsTruncated>`)
+				for _, k := range keys {
+					fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><ETag>"abc"</ETag><LastModified>2006-01-02T15:04:05.000Z</LastModified></Contents>`, html.EscapeString(k), len(objects[k]))
+				}
+				for f := range folders {
+					fmt.Fprintf(w, `<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>`, html.EscapeString(f))
+				}
+				io.WriteString(w, `</ListBucketResult>`)
+			}
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			if denyPut {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`)
+				return
+			}
+			if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+				src, _ = url.PathUnescape(src)
+				srcKey := strings.TrimPrefix(strings.TrimPrefix(src, "/"), "files/")
+				objects[key] = objects[srcKey]
+				metadata[key] = metadata[srcKey]
+				if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+					metadata[key] = userMeta(r.Header)
+				}
+				io.WriteString(w, `<CopyObjectResult><ETag>"abc"</ETag><LastModified>2006-01-02T15:04:05.000Z</LastModified></CopyObjectResult>`)
+				return
+			}
+			objects[key] = decodeAWSChunked(r)
+			encodings[key] = strings.Trim(strings.ReplaceAll(r.Header.Get("Content-Encoding"), "aws-chunked", ""), ", ")
+			metadata[key] = userMeta(r.Header)
+			w.Header().Set("ETag", `"abc"`)
+		case http.MethodHead, http.MethodGet:
+			data, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if enc := encodings[key]; enc != "" {
+				w.Header().Set("Content-Encoding", enc)
+			}
+			for k, v := range metadata[key] {
+				w.Header()[k] = v
+			}
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+		case http.MethodDelete:
+			delete(objects, key)
+			delete(metadata, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := minio.New(strings.TrimPrefix(srv.URL, "http://"), &minio.Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, objects
+}
+
+// decodeAWSChunked returns the payload of an upload, which minio-go may send aws-chunked.
+func decodeAWSChunked(r *http.Request) []byte {
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get("X-Amz-Decoded-Content-Length") == "" {
+		return body
+	}
+	var data []byte
+	for {
+		line, rest, _ := strings.Cut(string(body), "\r\n")
+		size, _ := strconv.ParseInt(strings.SplitN(line, ";", 2)[0], 16, 64)
+		if size == 0 || int64(len(rest)) < size {
+			return data
+		}
+		data = append(data, rest[:size]...)
+		body = []byte(strings.TrimPrefix(rest[size:], "\r\n"))
+	}
+}
+
+func TestSelfTestHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	rec := httptest.NewRecorder()
+	selfTestHandler(client, "files").ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/selftest", nil))
+	var report SelfTestReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != http.StatusOK || !report.OK || len(report.Steps) != 5 || !strings.HasPrefix(report.Key, selfTestPrefix) {
+		t.Fatalf("selftest: %d %s", rec.Code, rec.Body.String())
+	}
+	if len(objects) != 0 {
+		t.Errorf("canary left behind: %v", objects)
+	}
+}
+
+func TestSelfTestHandler_Denied(t *testing.T) {
+	client, _ := selfTestS3(t, true)
+	rec := httptest.NewRecorder()
+	selfTestHandler(client, "files").ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/selftest", nil))
+	var report SelfTestReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != http.StatusServiceUnavailable || report.OK || len(report.Steps) != 2 {
+		t.Fatalf("selftest: %d %s", rec.Code, rec.Body.String())
+	}
+	if s := report.Steps[1]; s.Name != "upload" || s.Code != "AccessDenied" || !strings.HasPrefix(report.Diagnosis, "policy:") {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestSelfTest_Unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close()
+	report, err := SelfTest(t.Context(), Config{Endpoint: addr, Bucket: "files", AccessKey: "a", SecretKey: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || len(report.Steps) != 1 || !strings.HasPrefix(report.Diagnosis, "network:") {
+		t.Errorf("report = %+v", report)
+	}
+}
@@ -1,15 +1,22 @@
 package minioserver
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
+	"net/netip"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 
+	"kzen-go/golib"
+	"kzen-go/kzenimage"
 	"kzen-go/minioserver/media-handlers"
 	movestorymessages "kzen-go/minioserver/move_story_messages"
 )
@@ -20,20 +27,336 @@ type Config struct {
 	SecretKey string
 	Bucket    string
 	UseSSL    bool
-	Listen    string
-	APIKey    string
+	// CredentialSources, when set, replaces the static AccessKey/SecretKey with a chain of
+	// rotating sources tried in order (CredentialsStatic, CredentialsFile, CredentialsIAM,
+	// CredentialsAssumeRole); keys are refreshed when they expire, without a restart.
+	// CredentialsFile is the file or directory read by the "file" source, AssumeRoleARN the role
+	// assumed by "assume-role" with AccessKey/SecretKey.
+	CredentialSources []string
+	CredentialsFile   string
+	AssumeRoleARN     string
+
+	// SecretsProvider, when set (SecretsVault or SecretsAWS), reads the secret at SecretsPath at
+	// startup: its MINIO_ACCESS_KEY, MINIO_SECRET_KEY, API_KEY and API_KEYS fields take the place
+	// of the settings of the same name (API keys are added to the configured ones). The secret is
+	// re-read every SecretsRefresh (0 = 5m) and changes apply without a restart. SecretsPath is a
+	// Vault KV path ("secret/data/kzen-proxy") or a Secrets Manager id or ARN; SecretsRegion is
+	// the AWS region when SecretsPath is not an ARN. Vault is reached at VaultAddr with
+	// VaultToken, or the token in VaultTokenFile (re-read on each refresh, e.g. a Vault agent sink).
+	SecretsProvider string
+	SecretsPath     string
+	SecretsRefresh  time.Duration
+	SecretsRegion   string
+	VaultAddr       string
+	VaultToken      string
+	VaultTokenFile  string
+	secrets         *secretsWatcher
+
+	// Tenants, keyed by id, are isolated deployments served by this proxy (see ParseTenants). A
+	// request is routed to a tenant by the first of TenantResolvers that applies (default
+	// header, subdomain, key; TenantDomain is the parent domain of tenant subdomains); the tenant
+	// gets /objects/ on its own bucket prefix plus its own mounts, and only its own API keys are
+	// accepted. Requests that resolve to no tenant are served as before.
+	Tenants         map[string]Tenant
+	TenantResolvers []string
+	TenantDomain    string
+	// Listen is a comma-separated list of TCP addresses and "unix:/path/to.sock" sockets.
+	Listen string
+	// AdminListen, when set, serves /metrics, /stats and /debug/list on these addresses (same
+	// syntax as Listen) instead of the public listener. Bind it to a private interface.
+	AdminListen string
+	// ListenSocketMode is the permission of unix sockets in Listen (0 = 0660).
+	ListenSocketMode fs.FileMode
+	APIKey           string // single key, accepted under the name "default"
+
+	// APIKeys is the named key set (see ParseAPIKeys), valid alongside APIKey. When APIKeysFile is
+	// set, APIKeys were read from it and the file is re-read on change for zero-downtime rotation.
+	APIKeys     []APIKey
+	APIKeysFile string
+	// RequireSignedRequests rejects plain X-API-Key / Bearer keys; clients must sign requests
+	// (see SignRequest) so the key itself never travels over the wire or into logs.
+	RequireSignedRequests bool
+	// RequireSignatureNonce rejects signed mutating requests without X-Kzen-Nonce, so none can be
+	// replayed. Nonces are remembered per process: replicas behind a load balancer each keep
+	// their own.
+	RequireSignatureNonce bool
+	// AccessTokenSecret signs the short-lived tokens of POST /auth/token; set it to the same value
+	// on every replica. Empty uses a random secret, so tokens die with the process.
+	// AccessTokenMaxTTL caps their lifetime (0 = 1h).
+	AccessTokenSecret string
+	AccessTokenMaxTTL time.Duration
+	// UploadLinkMaxTTL caps the lifetime of the anonymous upload links of POST /upload-links (0 = 7 days).
+	UploadLinkMaxTTL time.Duration
+	// CredentialedOrigins are the browser origins allowed credentialed CORS requests. Setting it
+	// enables the HttpOnly token cookie of POST /auth/cookie, whose mutating requests must carry
+	// the matching X-CSRF-Token (see csrf.go).
+	CredentialedOrigins []string
+
+	// TrustedProxies are the peers whose X-Forwarded-For / X-Real-IP headers are believed when
+	// resolving the client IP (see ParseTrustedProxies). Empty means the TCP peer is the client.
+	TrustedProxies []netip.Prefix
+
+	// ByteStatsPrefixDepth is the number of key path segments that bytes in/out are grouped by on
+	// /stats and /metrics (e.g. 3 for "kzen/users/<userId>/"); 0 disables accounting.
+	ByteStatsPrefixDepth int
+
+	// HotlinkAllowedDomains, when non-empty, limits public GETs on object routes to pages on these
+	// domains (and their subdomains) by Origin/Referer. HotlinkAllowEmptyReferer admits requests
+	// without either header. Blocked image requests get HotlinkPlaceholderKey (an object in the
+	// same bucket) if set, everything else 403.
+	HotlinkAllowedDomains    []string
+	HotlinkAllowEmptyReferer bool
+	HotlinkPlaceholderKey    string
+
+	// NotFoundImageKey is an image (in the requested bucket) sent instead of a bare 404 when an
+	// image GET misses, so <img> tags never show as broken. NotFoundImageStatus is 404 (default)
+	// or 200; either way the response carries "X-Placeholder: not-found".
+	NotFoundImageKey    string
+	NotFoundImageStatus int
+
+	// SVGMode is how object routes serve SVGs, which can carry scripts: SVGServeInline (as
+	// stored), SVGServeSandbox, SVGServeText or SVGServePNG (rasterized by SVGRasterizer).
+	SVGMode       string
+	SVGRasterizer SVGRasterizer
+
+	// PublicEndpoint is the MinIO address browsers use (e.g. "s3.kzen.app"), for presigned URLs
+	// when Endpoint is only reachable internally; empty reuses Endpoint/UseSSL. Region avoids a
+	// bucket-location lookup through the public endpoint when presigning.
+	PublicEndpoint string
+	PublicUseSSL   bool
+	Region         string
+
+	// IdempotencyTTL is how long POST/PUT responses are kept for Idempotency-Key replay; 0 disables it.
+	IdempotencyTTL time.Duration
+	// SlowRequestThreshold and LargeObjectThreshold log and count requests that take at least that
+	// long or move a body of at least that many bytes; 0 disables each.
+	SlowRequestThreshold time.Duration
+	LargeObjectThreshold int64
+	// AnalyticsSink receives a record of every request (anonymized IP, user agent, key, bytes,
+	// status) as NDJSON batches: a file path, s3://bucket/prefix/ or an http(s):// collector.
+	// Empty disables the export. Batches go out every AnalyticsFlushInterval (0 = 1m).
+	AnalyticsSink          string
+	AnalyticsFlushInterval time.Duration
+	// AlertWebhookURL (JSON event "alert") and AlertSlackWebhookURL (a Slack incoming webhook)
+	// are told when 5xx responses reach AlertErrorRatePercent of a minute's requests, MinIO has
+	// failed every probe for AlertMinioDownAfter, or one batch delete removes at least
+	// AlertDeleteBatchSize keys; 0 disables each check. An alert repeats at most every
+	// AlertCooldown (0 = 15m).
+	AlertWebhookURL       string
+	AlertSlackWebhookURL  string
+	AlertErrorRatePercent int
+	AlertMinioDownAfter   time.Duration
+	AlertDeleteBatchSize  int
+	AlertCooldown         time.Duration
+	// AliasesKey is the object in Bucket holding the alias table (old key -> new key per bucket)
+	// consulted when an object GET misses; "" disables aliases. AliasMode is AliasRedirect (301
+	// to the new key, default) or AliasServe (the new object under the old URL).
+	AliasesKey string
+	AliasMode  string
+	// ContentHashURLs serves /i/{sha256}.{ext}: copies of objects stored under their content hash
+	// (in ContentHashBucket, "" = Bucket) with an immutable Cache-Control, and /i/resolve, which
+	// translates object keys to those URLs.
+	ContentHashURLs   bool
+	ContentHashBucket string
+	// CDNPurgeProvider (CDNCloudflare or CDNFastly; "" disables purging) is called with the public
+	// URL of every object overwritten or deleted through the proxy, so CDN edges drop the stale
+	// copy. CDNPurgeURLs maps a bucket to its public URL template (see ParseCDNPurgeURLs);
+	// CDNPurgeToken is the Cloudflare API token or Fastly API key, CDNPurgeZone the Cloudflare
+	// zone ID.
+	CDNPurgeProvider string
+	CDNPurgeURLs     map[string]string
+	CDNPurgeZone     string
+	CDNPurgeToken    string
+	// StartupDiagnostics makes Run check, before it listens, which of ListBucket, GetObject,
+	// PutObject and DeleteObject the credentials have on every bucket served, and log the result.
+	StartupDiagnostics bool
+	// ReadCacheBytes (0 = off) caches objects of up to ReadCacheObjectMaxBytes (0 = 1 MB) in
+	// memory for object GETs. A copy is fresh for ReadCacheTTL (0 = 30s); for
+	// ReadCacheStaleWhileRevalidate after that it is still served while being refreshed in the
+	// background, and for ReadCacheStaleIfError after it is served when MinIO fails.
+	ReadCacheBytes                int64
+	ReadCacheObjectMaxBytes       int64
+	ReadCacheTTL                  time.Duration
+	ReadCacheStaleWhileRevalidate time.Duration
+	ReadCacheStaleIfError         time.Duration
+	// ReadRetryAttempts and ReadRetryDelay retry object stats and reads that MinIO answers with
+	// AccessDenied (attempts in total, mean delay between them; 0 = 3 attempts, 50ms).
+	ReadRetryAttempts int
+	ReadRetryDelay    time.Duration
+	// MaxRequestTimeout caps the budget a client may ask for with X-Request-Timeout (0 = 10m).
+	MaxRequestTimeout time.Duration
+	// FetchMaxBytes caps files downloaded by POST /fetch.
+	FetchMaxBytes int64
+	// Mounts are extra routes served from a bucket prefix (see ParseMounts).
+	Mounts []Mount
+	// SeedAssets are default objects uploaded at startup when missing (see ParseSeedAssets).
+	SeedAssets []SeedAsset
+	// QuarantineWebhookURL receives a JSON POST when an upload is quarantined (see Quarantine),
+	// released or purged; "" disables the notifications.
+	QuarantineWebhookURL string
+	// UploadWebhookURL receives a JSON POST ("uploaded") for every upload through an objects mount
+	// and every direct upload reported to POST /uploads/confirm; "" disables the notifications.
+	UploadWebhookURL string
+	// SoftDelete makes object DELETEs move objects to trash/ instead of removing them, and serves
+	// GET /trash and POST /trash/restore to list and restore them.
+	SoftDelete bool
+	// BrowseStatsCacheTTL is how long GET /browse/stats keeps a folder rollup; 0 recomputes every
+	// request.
+	BrowseStatsCacheTTL time.Duration
+	// BackupTarget enables backups of BackupPrefix in BackupBucket ("" = Bucket) as tar.zst
+	// archives written to "s3://bucket/prefix" on the same MinIO or to a local directory, on the
+	// cron BackupSchedule ("" = only through POST /admin/backup). With BackupIncremental, archives
+	// after the first only hold objects whose ETag changed.
+	BackupTarget      string
+	BackupBucket      string
+	BackupPrefix      string
+	BackupSchedule    string
+	BackupIncremental bool
+	// AuditSchedule (cron; "" = only through POST /admin/audit) runs the consistency audit of
+	// AuditPrefix in AuditBucket ("" = Bucket): zero-byte objects are flagged, and
+	// AuditSamplePercent of the objects are read to check their size, SHA-256 and image end marker.
+	// Reports are stored under kzen-audit/. AuditEnabled serves /admin/audit without a schedule.
+	AuditEnabled       bool
+	AuditSchedule      string
+	AuditBucket        string
+	AuditPrefix        string
+	AuditSamplePercent int
+	// Processors maps a mount route, built-in ones included, to the functions run over uploads
+	// through it before they are stored (see AddProcessor). Only settable by embedders.
+	Processors map[string][]ProcessorFunc
+	// DirectoryIndex renders an HTML listing for browser GETs of object prefixes ending in "/".
+	DirectoryIndex bool
+	// ParallelGetThreshold is the object size (bytes) from which GETs fetch ranges from MinIO in
+	// parallel with ParallelGetWorkers workers; 0 disables it.
+	ParallelGetThreshold int64
+	ParallelGetWorkers   int
+	// MaxDownloadBytesPerSec caps each object download; MaxTotalDownloadBytesPerSec caps all
+	// downloads together. 0 means unlimited.
+	MaxDownloadBytesPerSec      int64
+	MaxTotalDownloadBytesPerSec int64
+	// MaxConcurrentUploads bounds simultaneous PutObject calls (0 = unlimited). Up to UploadQueueSize
+	// uploads wait at most UploadQueueTimeout for a slot; the rest get 503 with Retry-After.
+	MaxConcurrentUploads int
+	UploadQueueSize      int
+	UploadQueueTimeout   time.Duration
+	// MultipartMaxMemory is held in memory per multipart form before spilling to temp files
+	// (0 = 50 MB). UploadMaxFileBytes and UploadMaxFiles cap each file and the number of files per
+	// form; 0 means unlimited. Violations get 413.
+	MultipartMaxMemory int64
+	UploadMaxFileBytes int64
+	UploadMaxFiles     int
+	// MultipartTempDir is where multipart parts beyond MultipartMaxMemory are spilled; "" uses the
+	// system temp dir. Stale spill files in it are swept periodically.
+	MultipartTempDir string
+	// UploadKeyTemplate names image uploads sent without a path, e.g.
+	// "{folder}/{userId}/{yyyy}/{mm}/{uuid}{ext}" (see mediahandlers.ParseKeyTemplate); "" keeps
+	// "{userId}_{uuid}{ext}" under the folder.
+	UploadKeyTemplate string
+	// UploadPreserveFilenames keeps a slug of the original filename in generated keys and the raw
+	// name in the Original-Filename object metadata.
+	UploadPreserveFilenames bool
+	// UploadCheckKeyCollisions stats generated upload keys and retries on collision.
+	UploadCheckKeyCollisions bool
+	// UploadPreserveOriginals keeps the untouched bytes of images the upload pipeline re-encoded
+	// under originals/{key}.
+	UploadPreserveOriginals bool
+	// DirectUploadImages runs images confirmed with POST /uploads/confirm through the image pipeline
+	// in the background, like uploads to the image endpoints.
+	DirectUploadImages bool
+	// ImageMaxEdgePx is the longest side of stored raster images; larger uploads are downscaled.
+	ImageMaxEdgePx int
+	// ImageJPEGQuality is the quality of re-encoded JPEGs (1-100).
+	ImageJPEGQuality int
+	// ImageAlphaBackground ("#rrggbb") is composited under transparent images re-encoded as JPEG;
+	// "" stores them as PNG instead.
+	ImageAlphaBackground string
+	// ImageMaxDimensionPx and ImageMaxDecodedBytes reject image uploads (422) whose header
+	// announces a side or a decoded size over the limit, before they are decoded; 0 = no limit.
+	ImageMaxDimensionPx  int
+	ImageMaxDecodedBytes int64
+	// ImageWorkers is how many images are decoded, resized and encoded at once across all
+	// requests; 0 uses GOMAXPROCS, a negative value leaves it unbounded.
+	ImageWorkers int
+	// ImagePipeline, when set, replaces the Image* settings above (see WithImagePipeline); its
+	// Workers default to the ImageWorkers pool. Only settable by embedders.
+	ImagePipeline *kzenimage.Options
 }
 
+const (
+	// multipartTempMaxAge is how old a spilled multipart file must be before the sweeper removes it;
+	// live requests remove their own files when they finish.
+	multipartTempMaxAge   = 2 * time.Hour
+	multipartTempSweepGap = 10 * time.Minute
+)
+
+const (
+	// imageWorkerQueue and imageWorkerWait bound how many images may wait for a free image worker,
+	// and for how long, before uploads get 503.
+	imageWorkerQueue = 1000
+	imageWorkerWait  = 30 * time.Second
+)
+
 const (
 	KZEN_STORAGE = "kzen-storage"
 )
 
+// Run serves the proxy for cfg on its listeners until one of them fails.
 func Run(cfg Config) error {
+	handler, admin, err := buildHandlers(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.StartupDiagnostics {
+		logStartupDiagnostics(cfg)
+	}
+
+	// Sockets passed by systemd (kzen.socket) replace LISTEN_ADDR.
+	lns, err := golib.SystemdListeners()
+	if err != nil {
+		return err
+	}
+	if lns != nil {
+		log.Printf("MinIO proxy serving %d systemd socket(s) (bucket: %s)", len(lns), cfg.Bucket)
+	} else {
+		if lns, err = listenAll(cfg.Listen, cfg.ListenSocketMode); err != nil {
+			return err
+		}
+		log.Printf("MinIO proxy listening on %s (bucket: %s)", cfg.Listen, cfg.Bucket)
+	}
+	errc := make(chan error, 2)
+	if admin != nil {
+		adminLns, err := listenAll(cfg.AdminListen, cfg.ListenSocketMode)
+		if err != nil {
+			return fmt.Errorf("admin listener: %w", err)
+		}
+		log.Printf("admin endpoints (/metrics, /stats, /debug/list) listening on %s", cfg.AdminListen)
+		go func() { errc <- serveAll(&http.Server{Handler: admin}, adminLns) }()
+	}
+	notifySystemd()
+	go func() { errc <- serveAll(&http.Server{Handler: handler}, lns) }()
+	return <-errc
+}
+
+// NewHandler returns the proxy for cfg as a single http.Handler, with the same routes and
+// middleware Run serves, for mounting inside another service's mux (e.g. under
+// http.StripPrefix). cfg.Listen is not used, and the admin endpoints are served by the returned
+// handler behind the admin key, as if cfg.AdminListen were empty.
+func NewHandler(cfg Config) (http.Handler, error) {
+	cfg.AdminListen = ""
+	handler, _, err := buildHandlers(cfg)
+	return handler, err
+}
+
+// NewClient returns the MinIO client for cfg's endpoint and credentials.
+func NewClient(cfg Config) (*minio.Client, error) {
+	cfg, err := withSecrets(cfg)
+	if err != nil {
+		return nil, err
+	}
 	cfg.Endpoint = strings.TrimPrefix(strings.TrimPrefix(cfg.Endpoint, "https://"), "http://")
 	if i := strings.Index(cfg.Endpoint, "/"); i != -1 {
 		cfg.Endpoint = cfg.Endpoint[:i]
 	}
-
 	// Higher connection pool limits avoid intermittent 500s when many images load concurrently.
 	// Default transport only keeps 2 idle conns per host, causing connection churn under load.
 	transport := &http.Transport{
@@ -41,36 +364,550 @@ func Run(cfg Config) error {
 		MaxIdleConnsPerHost: 100,
 		IdleConnTimeout:     90 * time.Second,
 	}
+	creds, err := minioCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
 	client, err := minio.New(cfg.Endpoint, &minio.Options{
-		Creds:     credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Creds:     creds,
 		Secure:    cfg.UseSSL,
-		Transport: transport,
+		Transport: instrumentTransport(transport, metrics),
 	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewMountHandler returns the handler of a single mount, configured from cfg like the mounts Run
+// serves, for embedding one bucket route in another service. It does not include Run's
+// middleware (auth, CORS, logging); mounts without publicRead still require one of cfg's API
+// keys on reads.
+func NewMountHandler(client *minio.Client, m Mount, cfg Config) (http.Handler, error) {
+	if err := m.normalize(); err != nil {
+		return nil, err
+	}
+	if m.Bucket == "" {
+		m.Bucket = cfg.Bucket
+	}
+	opts := proxyOptionsFromConfig(cfg)
+	opts.APIKeys = apiKeysFromConfig(cfg)
+	opts.Processors = cfg.Processors[m.Route]
+	return mountHandler(client, m, opts), nil
+}
+
+// ImageUploadOptions returns the mediahandlers options Run uses for cfg, so the image upload
+// handlers (mediahandlers.UploadImagesToMinioServer and friends) can be mounted on their own.
+func ImageUploadOptions(cfg Config) (mediahandlers.Options, error) {
+	return imageUploadOptions(cfg, proxyOptionsFromConfig(cfg))
+}
+
+func imageUploadOptions(cfg Config, popts proxyOptions) (mediahandlers.Options, error) {
+	keyTemplate, err := mediahandlers.ParseKeyTemplate(cfg.UploadKeyTemplate)
+	if err != nil {
+		return mediahandlers.Options{}, err
+	}
+	if !keyTemplate.IsZero() {
+		log.Printf("generated upload keys use template %s", keyTemplate)
+	}
+	alphaBackground, err := kzenimage.ParseHexColor(cfg.ImageAlphaBackground)
+	if err != nil {
+		return mediahandlers.Options{}, fmt.Errorf("IMAGE_ALPHA_BACKGROUND: %w", err)
+	}
+	imageWorkers := cfg.ImageWorkers
+	if imageWorkers == 0 {
+		imageWorkers = runtime.GOMAXPROCS(0)
+	}
+	if imageWorkers > 0 {
+		log.Printf("image processing limited to %d workers", imageWorkers)
+	}
+	pipeline := kzenimage.Options{
+		MaxEdgePx:       cfg.ImageMaxEdgePx,
+		JPEGQuality:     cfg.ImageJPEGQuality,
+		AlphaBackground: alphaBackground,
+		MaxDimensionPx:  cfg.ImageMaxDimensionPx,
+		MaxDecodedBytes: cfg.ImageMaxDecodedBytes,
+	}
+	if cfg.ImagePipeline != nil {
+		pipeline = *cfg.ImagePipeline
+	}
+	if pipeline.Workers == nil {
+		pipeline.Workers = golib.NewSemaphore(imageWorkers, imageWorkerQueue, imageWorkerWait)
+	}
+	mopts := mediahandlers.Options{
+		UploadSlots:        popts.UploadSlots,
+		RecordBytesIn:      popts.ByteStats.addIn,
+		OnChange:           popts.changed,
+		Multipart:          popts.Multipart,
+		KeyTemplate:        keyTemplate,
+		PreserveFilenames:  cfg.UploadPreserveFilenames,
+		CheckKeyCollisions: cfg.UploadCheckKeyCollisions,
+		PreserveOriginals:  cfg.UploadPreserveOriginals,
+		Pipeline:           pipeline,
+	}
+	if popts.ownsObjects() {
+		mopts.StampOwner = popts.stampOwner
+		mopts.MayModify = popts.mayModify
+	}
+	return mopts, nil
+}
+
+// apiKeysFromConfig returns the key store for cfg, watching APIKeysFile when set; nil when auth
+// is off.
+func apiKeysFromConfig(cfg Config) *apiKeyStore {
+	var fromSecret []APIKey
+	if cfg.secrets != nil {
+		values, _ := cfg.secrets.snapshot()
+		fromSecret, _ = apiKeysFromSecret(values) // validated by the watcher
+	}
+	if cfg.APIKey == "" && len(cfg.APIKeys) == 0 && cfg.APIKeysFile == "" && len(fromSecret) == 0 {
+		return nil
+	}
+	var static []APIKey
+	if cfg.APIKey != "" {
+		static = append(static, APIKey{Name: "default", Key: cfg.APIKey})
+	}
+	keys := newAPIKeyStore(append(append(append([]APIKey(nil), static...), fromSecret...), cfg.APIKeys...))
+	keys.signedOnly = cfg.RequireSignedRequests
+	keys.requireNonce = cfg.RequireSignatureNonce
+	keys.tokenSecret = accessTokenSecret(cfg, "")
+	keys.cookieAuth = len(cfg.CredentialedOrigins) > 0
+	if cfg.secrets != nil {
+		cfg.secrets.notify(func(values map[string]string) {
+			fromSecret, _ := apiKeysFromSecret(values)
+			keys.set(append(append(append([]APIKey(nil), static...), fromSecret...), cfg.APIKeys...))
+		})
+	}
+	if cfg.APIKeysFile != "" {
+		// Keys from the secret stay when the keys file is reloaded.
+		go keys.watchFile(context.Background(), cfg.APIKeysFile, append(append([]APIKey(nil), static...), fromSecret...), 10*time.Second)
+	}
+	return keys
+}
+
+// buildHandlers sets up the proxy for cfg: the public handler and, when cfg.AdminListen is set,
+// the handler of the admin listener (nil otherwise).
+func buildHandlers(cfg Config) (http.Handler, http.Handler, error) {
+	cfg, err := withSecrets(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := NewClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	presigner := client
+	if cfg.PublicEndpoint != "" {
+		creds, err := minioCredentials(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		presigner, err = minio.New(cfg.PublicEndpoint, &minio.Options{
+			Creds:  creds,
+			Secure: cfg.PublicUseSSL,
+			Region: cfg.Region,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("public endpoint: %w", err)
+		}
+	}
+
+	popts := proxyOptionsFromConfig(cfg)
+	popts.APIKeys = apiKeysFromConfig(cfg)
+	popts.Alerts = newAlerter(cfg.AlertWebhookURL, cfg.AlertSlackWebhookURL, alertThresholds{
+		ErrorRatePercent: cfg.AlertErrorRatePercent,
+		MinioDownAfter:   cfg.AlertMinioDownAfter,
+		DeleteBatchSize:  cfg.AlertDeleteBatchSize,
+	}, cfg.AlertCooldown)
+	if popts.Aliases, err = newAliasTable(client, cfg.Bucket, cfg.AliasesKey, cfg.AliasMode); err != nil {
+		return nil, nil, err
+	}
+	if popts.Purge, err = newCDNPurger(cfg.CDNPurgeProvider, cfg.CDNPurgeZone, cfg.CDNPurgeToken, cfg.CDNPurgeURLs); err != nil {
+		return nil, nil, err
+	}
+	if popts.Purge != nil {
+		go popts.Purge.run(context.Background())
+		log.Printf("cdn purge via %s for %d url templates", cfg.CDNPurgeProvider, len(cfg.CDNPurgeURLs))
+	}
+	if popts.Aliases != nil {
+		go popts.Aliases.watch(context.Background())
+		log.Printf("alias table %s/%s (%s)", cfg.Bucket, popts.Aliases.key, cmp.Or(cfg.AliasMode, AliasRedirect))
+	}
+	if popts.Alerts != nil {
+		go popts.Alerts.run(context.Background(), func(ctx context.Context) error {
+			_, err := client.BucketExists(ctx, cfg.Bucket)
+			return err
+		})
+		log.Printf("alerting enabled: %+v (cooldown %s)", popts.Alerts.limits, popts.Alerts.cooldown)
+	}
+	if popts.DirectoryIndex {
+		log.Printf("HTML directory index enabled")
+	}
+	if len(cfg.SeedAssets) > 0 {
+		go runSeedAssets(client, cfg.Bucket, cfg.SeedAssets)
+		log.Printf("seeding %d default asset(s) when missing", len(cfg.SeedAssets))
+	}
+	if c := popts.ReadCache; c != nil {
+		log.Printf("read cache: %d bytes, objects up to %d bytes, ttl %s, stale-while-revalidate %s, stale-if-error %s",
+			c.maxBytes, c.maxObject, c.ttl, c.staleWhileRevalidate, c.staleIfError)
+	}
+	if popts.UploadSlots != nil {
+		log.Printf("upload concurrency limited to %d (queue %d, wait %s)", cfg.MaxConcurrentUploads, cfg.UploadQueueSize, cfg.UploadQueueTimeout)
+	}
+	if popts.Hotlink != nil {
+		log.Printf("hotlink protection enabled for %v (empty referer allowed: %v)", popts.Hotlink.domains, popts.Hotlink.allowEmpty)
+	}
+	if popts.ByteStats != nil {
+		popts.ByteStats.register(metrics)
+		log.Printf("byte accounting per key prefix enabled (depth %d)", cfg.ByteStatsPrefixDepth)
+	}
+	if cfg.MultipartTempDir != "" {
+		if err := golib.UseMultipartTempDir(cfg.MultipartTempDir); err != nil {
+			return nil, nil, err
+		}
+		go sweepMultipartTemp(cfg.MultipartTempDir)
+		log.Printf("multipart uploads spill to %s", cfg.MultipartTempDir)
+	}
+	if popts.Multipart.MaxFileBytes > 0 || popts.Multipart.MaxFiles > 0 {
+		log.Printf("multipart uploads limited to %d files of %d bytes (0 = unlimited)", popts.Multipart.MaxFiles, popts.Multipart.MaxFileBytes)
+	}
+	mopts, err := imageUploadOptions(cfg, popts)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/objects/", objectsHandler(client, cfg.Bucket))
-	mux.HandleFunc("/batch", batchHandler(client, cfg.Bucket))
+	// With AdminListen, debug and monitoring endpoints move to their own mux on the internal
+	// listener and are not routed on the public one at all.
+	admin := mux
+	if cfg.AdminListen != "" {
+		admin = http.NewServeMux()
+		admin.HandleFunc("/health", healthHandler)
+	}
+	mux.HandleFunc("/batch", batchHandler(client, cfg.Bucket, servedMounts(cfg), popts))
+	mux.HandleFunc("/objects-base64", mediahandlers.UploadBase64(client, cfg.Bucket, "", mopts))
+	mux.HandleFunc("/paste", mediahandlers.UploadPaste(client, cfg.Bucket, "", "/objects/", mopts))
+	mux.HandleFunc("/reserve", mediahandlers.ReserveKey(client, cfg.Bucket, "", mopts))
+	mux.HandleFunc("/batch/urls", batchURLsHandler(presigner, cfg.Bucket, "", popts))
+	mux.HandleFunc("/upload-policy", uploadPolicyHandler(client, presigner, cfg.Bucket, "", popts))
+	mux.HandleFunc("/batch/copy", batchCopyHandler(client, cfg.Bucket, popts))
+	mux.HandleFunc("/uploads/", resumableUploadsHandler(client, cfg.Bucket, "/uploads/", "", popts))
+	confirmProcessors := map[string][]ProcessorFunc{}
+	for _, m := range defaultMounts(cfg.Bucket) {
+		confirmProcessors[m.Bucket] = cfg.Processors[m.Route]
+	}
+	var confirmImages *directImages
+	if cfg.DirectUploadImages {
+		confirmImages = newDirectImages(client, mopts.Pipeline, cfg.UploadPreserveOriginals, popts)
+		log.Printf("confirmed direct image uploads go through the image pipeline")
+	}
+	mux.HandleFunc("/uploads/confirm", uploadConfirmHandler(client, cfg.Bucket, servedBuckets(cfg), confirmProcessors, confirmImages, popts))
+	mux.HandleFunc("/compose", composeHandler(client, cfg.Bucket, servedMounts(cfg), popts))
+	mux.HandleFunc("/fetch", fetchHandler(client, cfg.Bucket, "", popts))
+	// An export reads any key or prefix, so it takes a key whatever the mounts allow.
+	mux.HandleFunc("/export", requireAPIKey(popts.APIKeys, exportHandler(client, cfg.Bucket, popts)))
+	mux.HandleFunc("/verify", verifyHandler(client, cfg.Bucket, "", popts))
+	mux.HandleFunc("/render/", hotlinkProtected(client, cfg.Bucket, "/render/", popts, mountGuarded(servedMounts(cfg), cfg.Bucket, "/render/", popts, renderHandler(client, cfg.Bucket, "/render/", popts))))
 	mux.HandleFunc("/health", healthHandler)
 	mux.HandleFunc("/health/", healthHandler)
-	mux.HandleFunc("/debug/list", debugList(client, cfg.Bucket))
+	if cfg.ContentHashURLs {
+		hashes := newContentHashes(client, cmp.Or(cfg.ContentHashBucket, cfg.Bucket))
+		mux.HandleFunc(hashRoute, contentHashHandler(hashes, cfg.Bucket, servedMounts(cfg), popts))
+		log.Printf("content-hash URLs under %s (copies in %s/%s)", hashRoute, hashes.bucket, hashBlobPrefix)
+	}
+	if popts.ReadCache != nil {
+		prefetch := newPrefetcher(client, popts, servedBuckets(cfg))
+		go prefetch.run(context.Background())
+		mux.HandleFunc("/prefetch", prefetchHandler(prefetch, cfg.Bucket))
+	}
+	// Listings expose every key, so they take a key like any write.
+	mux.HandleFunc("/list/stream", requireAPIKey(popts.APIKeys, listStreamHandler(client, cfg.Bucket, servedBuckets(cfg), popts)))
+	mux.HandleFunc("/browse/stats", requireAPIKey(popts.APIKeys, folderStatsHandler(client, cfg.Bucket, servedBuckets(cfg), newFolderStatsCache(cfg.BrowseStatsCacheTTL), popts)))
+	mux.HandleFunc("/feed", requireAPIKey(popts.APIKeys, feedHandler(client, cfg.Bucket, mergeMounts(defaultMounts(cfg.Bucket), cfg.Mounts), popts)))
+	if cfg.SoftDelete {
+		// The trash holds deleted objects, so listing it takes a key like any write.
+		trash := requireAPIKey(popts.APIKeys, trashHandler(client, cfg.Bucket, servedBuckets(cfg), popts))
+		mux.HandleFunc("/trash", trash)
+		mux.HandleFunc("/trash/restore", trash)
+	}
+	if popts.APIKeys != nil {
+		mux.HandleFunc("/auth/token", tokenHandler(popts.APIKeys, cfg.AccessTokenMaxTTL))
+		// Links store into cfg.Bucket, so its objects mount's processors apply.
+		linkOpts := popts
+		linkOpts.Processors = confirmProcessors[cfg.Bucket]
+		uploadLinks := uploadLinksHandler(client, cfg.Bucket, popts.APIKeys, cfg.UploadLinkMaxTTL, linkOpts)
+		mux.HandleFunc("/upload-links", uploadLinks)
+		mux.HandleFunc("/upload-links/", uploadLinks)
+		if popts.APIKeys.cookieAuth {
+			mux.HandleFunc("/auth/cookie", authCookieHandler(popts.APIKeys))
+		}
+	}
+	// Admin endpoints need an admin key on the public listener; the admin listener is internal, so
+	// scrapers and operators don't need an API key there.
+	adminHandle := func(pattern string, h http.HandlerFunc) {
+		if admin == mux {
+			h = requireAdminKey(popts.APIKeys, h)
+		}
+		admin.HandleFunc(pattern, h)
+	}
+	adminHandle("/debug/list", debugList(client, cfg.Bucket))
+	adminHandle(fmt.Sprintf("/%s-debug-list", KZEN_STORAGE), debugList(client, KZEN_STORAGE))
+	adminHandle("/admin/policy", bucketPolicyHandler(client, cfg.Bucket))
+	adminHandle("/admin/policy/anonymous", bucketPolicyHandler(client, cfg.Bucket))
+	adminHandle("/admin/lifecycle", bucketLifecycleHandler(client, cfg.Bucket))
+	adminHandle("/admin/lifecycle/expire", bucketLifecycleHandler(client, cfg.Bucket))
+	adminHandle("/admin/legal-hold", legalHoldHandler(client, cfg.Bucket))
+	quarantine := quarantineHandler(client, cfg.Bucket, popts)
+	adminHandle("/admin/quarantine", quarantine)
+	adminHandle("/admin/quarantine/release", quarantine)
+	if cfg.BackupTarget != "" {
+		backup, err := newBackupJob(client, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		adminHandle("/admin/backup", backupHandler(backup))
+		adminHandle("/admin/backup/restore", restoreHandler(client, backup.store, backup.bucket, popts))
+	}
+	adminHandle("/admin/inventory", inventoryHandler(client, cfg.Bucket))
+	if cfg.AuditEnabled || cfg.AuditSchedule != "" {
+		audit, err := newAuditor(client, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		adminHandle("/admin/audit", auditHandler(audit))
+	}
+	reprocess := reprocessHandler(&reprocessJobs{}, func(bucket string) reprocessBackend {
+		return minioReprocessBackend{client: client, bucket: bucket, opts: popts}
+	}, mopts.Pipeline, cfg.Bucket)
+	adminHandle("/admin/reprocess", reprocess)
+	adminHandle("/admin/reprocess/", reprocess)
+	adminHandle("/admin/selftest", selfTestHandler(client, cfg.Bucket))
+	if popts.Aliases != nil {
+		adminHandle("/admin/aliases", aliasesHandler(popts.Aliases, cfg.Bucket))
+	}
+	if admin == mux {
+		mux.HandleFunc("/metrics", requireAPIKey(popts.APIKeys, metricsHandler(metrics)))
+		mux.HandleFunc("/stats", requireAPIKey(popts.APIKeys, statsHandler(popts.ByteStats)))
+	} else {
+		admin.HandleFunc("/metrics", metricsHandler(metrics))
+		admin.HandleFunc("/stats", statsHandler(popts.ByteStats))
+	}
 	/* kzen */
-	mux.HandleFunc(fmt.Sprintf("/%s-objects/", KZEN_STORAGE), objectsHandlerWithPrefix(client, KZEN_STORAGE, fmt.Sprintf("/%s-objects/", KZEN_STORAGE)))
-	mux.HandleFunc(fmt.Sprintf("/%s-upload-images", KZEN_STORAGE), mediahandlers.UploadImagesToMinioServer(client, KZEN_STORAGE, "/kzen"))
-	mux.HandleFunc(fmt.Sprintf("/%s-upload-images-v2", KZEN_STORAGE), mediahandlers.UploadImagesToMinioServerV2(client, KZEN_STORAGE, "/kzen"))
-	mux.HandleFunc(fmt.Sprintf("/%s-debug-list", KZEN_STORAGE), debugList(client, KZEN_STORAGE))
+	mux.HandleFunc(fmt.Sprintf("/%s-upload-images", KZEN_STORAGE), mediahandlers.UploadImagesToMinioServer(client, KZEN_STORAGE, "/kzen", mopts))
+	mux.HandleFunc(fmt.Sprintf("/%s-upload-images-v2", KZEN_STORAGE), mediahandlers.UploadImagesToMinioServerV2(client, KZEN_STORAGE, "/kzen", mopts))
+	mux.HandleFunc(fmt.Sprintf("/%s-fetch", KZEN_STORAGE), fetchHandler(client, KZEN_STORAGE, "/kzen", popts))
+	mux.HandleFunc(fmt.Sprintf("/%s-objects-base64", KZEN_STORAGE), mediahandlers.UploadBase64(client, KZEN_STORAGE, "", mopts))
+	mux.HandleFunc(fmt.Sprintf("/%s-paste", KZEN_STORAGE), mediahandlers.UploadPaste(client, KZEN_STORAGE, "/kzen", fmt.Sprintf("/%s-objects/", KZEN_STORAGE), mopts))
+	mux.HandleFunc(fmt.Sprintf("/%s-reserve", KZEN_STORAGE), mediahandlers.ReserveKey(client, KZEN_STORAGE, "/kzen", mopts))
+	mux.HandleFunc(fmt.Sprintf("/%s-batch-urls", KZEN_STORAGE), batchURLsHandler(presigner, KZEN_STORAGE, "/kzen", popts))
+	mux.HandleFunc(fmt.Sprintf("/%s-upload-policy", KZEN_STORAGE), uploadPolicyHandler(client, presigner, KZEN_STORAGE, "/kzen", popts))
+	mux.HandleFunc(fmt.Sprintf("/%s-uploads/", KZEN_STORAGE), resumableUploadsHandler(client, KZEN_STORAGE, fmt.Sprintf("/%s-uploads/", KZEN_STORAGE), "/kzen", popts))
+	mux.HandleFunc(fmt.Sprintf("/%s-verify", KZEN_STORAGE), verifyHandler(client, KZEN_STORAGE, "/kzen", popts))
+	kzenRender := fmt.Sprintf("/%s-render/", KZEN_STORAGE)
+	mux.HandleFunc(kzenRender, hotlinkProtected(client, KZEN_STORAGE, kzenRender, popts, mountGuarded(servedMounts(cfg), KZEN_STORAGE, kzenRender, popts, renderHandler(client, KZEN_STORAGE, kzenRender, popts))))
 	mux.HandleFunc("/v1/create-story-folder", createStoryFolderHandler(client, KZEN_STORAGE))
 	mux.HandleFunc("/v1/move-story-messages", movestorymessages.Handler(client, KZEN_STORAGE))
 
-	// CORS must wrap the entire chain so 401 (and all other responses) include CORS headers.
-	handler := Chain(corsMiddleware, logMiddleware)(mux)
-	if cfg.APIKey != "" {
-		handler = Chain(corsMiddleware, apiKeyMiddleware(cfg.APIKey), logMiddleware)(mux)
+	// /objects/ and /kzen-storage-objects/ are registered as mounts so MOUNTS can override them.
+	mounts := mergeMounts(defaultMounts(cfg.Bucket), cfg.Mounts)
+	if !slices.ContainsFunc(mounts, func(m Mount) bool { return m.pattern() == embeddedAssetsRoute }) {
+		mux.HandleFunc(embeddedAssetsRoute, embeddedAssetsHandler)
+	}
+	for _, m := range mounts {
+		if m.Bucket == "" {
+			m.Bucket = cfg.Bucket
+		}
+		mountOpts := popts
+		mountOpts.Processors = cfg.Processors[m.Route]
+		mux.HandleFunc(m.pattern(), mountHandler(client, m, mountOpts))
+		if m.Features != nil {
+			log.Printf("mount %s -> %s/%s (%s) features %+v", m.pattern(), m.Bucket, m.Prefix, m.Type, *m.Features)
+		} else {
+			log.Printf("mount %s -> %s/%s (%s)", m.pattern(), m.Bucket, m.Prefix, m.Type)
+		}
+	}
+
+	// The client IP is resolved first so every later middleware and handler can use clientIP.
+	// CORS must wrap the rest of the chain so 401 (and all other responses) include CORS headers.
+	// Versioning runs before auth so /v2/ paths are rewritten first and 401s get the envelope too
+	// (auth checks signatures and token scopes against the path as sent, see originalURL);
+	// jsonErrorMiddleware sits inside it so the envelope sees errors already turned into JSON.
+	// Panics anywhere below recoveryMiddleware (auth, idempotency, handlers) become a JSON 500.
+	// The request budget is set before auth so every handler's MinIO work runs within it.
+	maxTimeout := cfg.MaxRequestTimeout
+	if maxTimeout <= 0 {
+		maxTimeout = 10 * time.Minute
+	}
+	cors := corsMiddleware
+	if len(cfg.CredentialedOrigins) > 0 {
+		cors = credentialedCORSMiddleware(cfg.CredentialedOrigins)
+	}
+	// Reads on these routes are stored objects, which the envelope leaves alone.
+	objectRoutes := []string{"/render/", fmt.Sprintf("/%s-render/", KZEN_STORAGE), hashRoute}
+	for _, m := range mounts {
+		objectRoutes = append(objectRoutes, m.Route)
+	}
+	for _, t := range cfg.Tenants {
+		for _, m := range t.Mounts {
+			objectRoutes = append(objectRoutes, m.Route)
+		}
+	}
+	middlewares := []func(http.Handler) http.Handler{
+		realIPMiddleware(cfg.TrustedProxies), requestIDMiddleware, cleanupMiddleware, webdavMiddleware(mounts), mountCORSMiddleware(mounts, cors),
+		apiVersionMiddleware(objectRoutes), jsonErrorMiddleware,
+	}
+	if popts.Alerts != nil && popts.Alerts.limits.ErrorRatePercent > 0 {
+		// Outside recoveryMiddleware, so the 500s of panics count too.
+		middlewares = append(middlewares, alertMiddleware(popts.Alerts))
+	}
+	middlewares = append(middlewares, recoveryMiddleware, deadlineMiddleware(maxTimeout))
+	if len(cfg.TrustedProxies) > 0 {
+		log.Printf("trusting X-Forwarded-For from %v", cfg.TrustedProxies)
+	}
+	// Auth, idempotency and logging run per tenant, each with its own key set and replay cache.
+	var analytics *analyticsExporter
+	if cfg.AnalyticsSink != "" {
+		sink, err := newAnalyticsSink(cfg.AnalyticsSink, client)
+		if err != nil {
+			return nil, nil, err
+		}
+		analytics = newAnalyticsExporter(sink, cfg.AnalyticsFlushInterval)
+		go analytics.run(context.Background())
+		log.Printf("analytics export enabled (every %s)", analytics.flush)
+	}
+	perTenant := func(keys *apiKeyStore) []func(http.Handler) http.Handler {
+		var mws []func(http.Handler) http.Handler
+		if keys != nil {
+			mws = append(mws, apiKeyMiddleware(keys))
+		}
+		if cfg.IdempotencyTTL > 0 {
+			mws = append(mws, idempotencyMiddleware(newIdempotencyCache(cfg.IdempotencyTTL)))
+		}
+		if analytics != nil {
+			mws = append(mws, analyticsMiddleware(analytics))
+		}
+		return append(mws, logMiddleware(logThresholds{
+			SlowRequest: cfg.SlowRequestThreshold,
+			LargeObject: cfg.LargeObjectThreshold,
+		}))
+	}
+	if popts.APIKeys != nil {
 		log.Printf("API key auth enabled")
 	}
+	if cfg.IdempotencyTTL > 0 {
+		log.Printf("Idempotency-Key replay enabled (ttl %s)", cfg.IdempotencyTTL)
+	}
+	var handler http.Handler = Chain(perTenant(popts.APIKeys)...)(mux)
+	if len(cfg.Tenants) > 0 {
+		tenants, err := buildTenants(cfg, client, popts, perTenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		middlewares = append(middlewares, tenants.middleware)
+	}
+	handler = Chain(middlewares...)(handler)
+	if admin == mux {
+		return handler, nil, nil
+	}
+	return handler, Chain(requestIDMiddleware, jsonErrorMiddleware, recoveryMiddleware)(admin), nil
+}
+
+// buildTenants sets up the handlers of cfg.Tenants: each serves only its own mounts, with its
+// own API keys and quota.
+func buildTenants(cfg Config, client *minio.Client, popts proxyOptions, perTenant func(*apiKeyStore) []func(http.Handler) http.Handler) (*tenantRouter, error) {
+	tenants := make(map[string]Tenant, len(cfg.Tenants))
+	for id, t := range cfg.Tenants {
+		if err := t.normalize(id); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", id, err)
+		}
+		tenants[id] = t
+	}
+	if err := checkTenantIsolation(tenants, servedMounts(cfg)); err != nil {
+		return nil, err
+	}
+	resolvers := cfg.TenantResolvers
+	if len(resolvers) == 0 {
+		resolvers = []string{TenantByHeader, TenantBySubdomain, TenantByKey}
+	}
+	for _, res := range resolvers {
+		switch res {
+		case TenantByHeader, TenantByKey:
+		case TenantBySubdomain:
+			if cfg.TenantDomain == "" && len(cfg.TenantResolvers) > 0 {
+				return nil, fmt.Errorf("tenant resolver %q needs a tenant domain", res)
+			}
+		default:
+			return nil, fmt.Errorf("unknown tenant resolver %q", res)
+		}
+	}
 
-	log.Printf("MinIO proxy listening on %s (bucket: %s)", cfg.Listen, cfg.Bucket)
-	return http.ListenAndServe(cfg.Listen, handler)
+	router := &tenantRouter{resolvers: resolvers, domain: strings.ToLower(cfg.TenantDomain), tenants: map[string]*tenantState{}}
+	for id, t := range tenants {
+		keys := newAPIKeyStore(t.APIKeys)
+		keys.signedOnly = cfg.RequireSignedRequests
+		keys.requireNonce = cfg.RequireSignatureNonce
+		keys.tokenSecret = accessTokenSecret(cfg, "tenant "+id)
+		keys.cookieAuth = len(cfg.CredentialedOrigins) > 0
+		opts := tenantOptions(popts, keys, t.Quota)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/health", healthHandler)
+		mux.HandleFunc("/health/", healthHandler)
+		mux.HandleFunc("/auth/token", tokenHandler(keys, cfg.AccessTokenMaxTTL))
+		if keys.cookieAuth {
+			mux.HandleFunc("/auth/cookie", authCookieHandler(keys))
+		}
+		for _, m := range tenantMounts(t) {
+			mountOpts := opts
+			mountOpts.Processors = cfg.Processors[m.Route]
+			mux.HandleFunc(m.pattern(), mountHandler(client, m, mountOpts))
+		}
+		usage := &tenantUsage{}
+		mws := perTenant(keys)
+		if t.Quota.MaxObjectBytes > 0 || t.Quota.MaxStorageBytes > 0 {
+			mws = append(mws, quotaMiddleware(t.Quota, usage))
+		}
+		if t.Quota.MaxStorageBytes > 0 {
+			go usage.watch(context.Background(), client, id, t.Bucket, t.Prefix)
+		}
+		router.tenants[id] = &tenantState{keys: keys, handler: Chain(mws...)(mux)}
+		log.Printf("tenant %s -> %s/%s (%d keys)", id, t.Bucket, t.Prefix, len(t.APIKeys))
+	}
+	log.Printf("tenants resolved by %s", strings.Join(resolvers, ", "))
+	return router, nil
+}
+
+// sweepMultipartTemp removes multipart spill files orphaned by crashes, at startup and then
+// every multipartTempSweepGap.
+func sweepMultipartTemp(dir string) {
+	for {
+		if n, err := golib.SweepMultipartTemp(dir, multipartTempMaxAge); err != nil {
+			log.Printf("multipart temp sweep %s: %v", dir, err)
+		} else if n > 0 {
+			log.Printf("multipart temp sweep %s: removed %d stale files", dir, n)
+		}
+		time.Sleep(multipartTempSweepGap)
+	}
+}
+
+// notifySystemd tells systemd (Type=notify) the proxy is ready and, with WatchdogSec=, keeps
+// pinging the watchdog at half its interval. Outside systemd it does nothing.
+func notifySystemd() {
+	if ok, err := golib.SdNotify("READY=1"); err != nil {
+		log.Printf("sd_notify: %v", err)
+		return
+	} else if !ok {
+		return
+	}
+	interval := golib.SdWatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	log.Printf("systemd watchdog every %s", interval)
+	go func() {
+		for range time.Tick(interval / 2) {
+			if _, err := golib.SdNotify("WATCHDOG=1"); err != nil {
+				log.Printf("sd_notify watchdog: %v", err)
+			}
+		}
+	}()
 }
@@ -0,0 +1,187 @@
+package minioserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"kzen-go/kzenimage"
+)
+
+// Server is a proxy built with NewServer. It serves exactly what Run and NewHandler serve for
+// the Config its options produce.
+type Server struct {
+	cfg          Config
+	staticMaxAge int
+}
+
+// Option configures a Server in NewServer. Options apply in order, so later ones win.
+//
+// Options cover the settings most servers need; new Config fields don't get one by default.
+// Everything else is set with WithConfigFunc, or on the Config passed to WithConfig.
+type Option func(*Server) error
+
+// NewServer builds a Server from opts, e.g.
+//
+//	srv, err := minioserver.NewServer(
+//		minioserver.WithMinio("minio:9000", ak, sk, false),
+//		minioserver.WithBucket("kzen-storage"),
+//		minioserver.WithAuth(minioserver.APIKey{Name: "app", Key: key}),
+//		minioserver.WithMount(minioserver.Mount{Route: "/app/", Prefix: "kzen/frontend/", Type: "static"}),
+//	)
+//
+// Settings without an option are set with WithConfigFunc.
+func NewServer(opts ...Option) (*Server, error) {
+	s := &Server{}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	for i := range s.cfg.Mounts {
+		m := &s.cfg.Mounts[i]
+		if m.CacheMaxAge == nil && s.staticMaxAge > 0 {
+			maxAge := s.staticMaxAge
+			m.CacheMaxAge = &maxAge
+		}
+		if err := m.normalize(); err != nil {
+			return nil, fmt.Errorf("mount %s: %w", m.Route, err)
+		}
+	}
+	return s, nil
+}
+
+// Config returns the configuration the options produced.
+func (s *Server) Config() Config {
+	return s.cfg
+}
+
+// Run serves the proxy on its listeners, like Run(s.Config()).
+func (s *Server) Run() error {
+	return Run(s.cfg)
+}
+
+// Handler returns the proxy as an http.Handler, like NewHandler(s.Config()).
+func (s *Server) Handler() (http.Handler, error) {
+	return NewHandler(s.cfg)
+}
+
+// WithConfig starts from cfg, e.g. one read from the environment; pass it first, since it
+// replaces what earlier options set.
+func WithConfig(cfg Config) Option {
+	return func(s *Server) error {
+		s.cfg = cfg
+		return nil
+	}
+}
+
+// WithConfigFunc lets fn change any Config field, for settings without an option of their own, e.g.
+//
+//	minioserver.WithConfigFunc(func(c *minioserver.Config) { c.SoftDelete = true })
+func WithConfigFunc(fn func(*Config)) Option {
+	return func(s *Server) error {
+		fn(&s.cfg)
+		return nil
+	}
+}
+
+// WithMinio sets the MinIO endpoint and static credentials.
+func WithMinio(endpoint, accessKey, secretKey string, useSSL bool) Option {
+	return func(s *Server) error {
+		s.cfg.Endpoint, s.cfg.AccessKey, s.cfg.SecretKey, s.cfg.UseSSL = endpoint, accessKey, secretKey, useSSL
+		return nil
+	}
+}
+
+// WithBucket sets the default bucket.
+func WithBucket(bucket string) Option {
+	return func(s *Server) error {
+		if bucket == "" {
+			return fmt.Errorf("bucket must not be empty")
+		}
+		s.cfg.Bucket = bucket
+		return nil
+	}
+}
+
+// WithListen sets the listen addresses (same syntax as LISTEN_ADDR), used by Server.Run.
+func WithListen(addrs string) Option {
+	return func(s *Server) error {
+		s.cfg.Listen = addrs
+		return nil
+	}
+}
+
+// WithMount adds a mount, or replaces the one with the same route.
+func WithMount(m Mount) Option {
+	return func(s *Server) error {
+		// A nil CacheMaxAge is defaulted in NewServer, once WithStaticMaxAge may have been applied.
+		if err := m.normalize(); err != nil {
+			return fmt.Errorf("mount %s: %w", m.Route, err)
+		}
+		s.cfg.Mounts = mergeMounts(s.cfg.Mounts, []Mount{m})
+		return nil
+	}
+}
+
+// WithAuth turns on API key auth with keys, in addition to keys set before.
+func WithAuth(keys ...APIKey) Option {
+	return func(s *Server) error {
+		for _, k := range keys {
+			if k.Name == "" || k.Key == "" {
+				return fmt.Errorf("api key: name and key are required")
+			}
+		}
+		s.cfg.APIKeys = append(s.cfg.APIKeys, keys...)
+		return nil
+	}
+}
+
+// WithImagePipeline replaces the Image* settings of the upload pipeline with p. When p.Workers
+// is nil the pool sized by ImageWorkers is used.
+func WithImagePipeline(p kzenimage.Options) Option {
+	return func(s *Server) error {
+		s.cfg.ImagePipeline = &p
+		return nil
+	}
+}
+
+// WithProcessor registers fn for uploads through the mount at route (see Config.AddProcessor).
+func WithProcessor(route string, fn ProcessorFunc) Option {
+	return func(s *Server) error {
+		s.cfg.AddProcessor(route, fn)
+		return nil
+	}
+}
+
+// WithCache turns on the in-memory read cache of object GETs: up to maxBytes in total, each copy
+// fresh for ttl (0 = 30s). The other ReadCache* settings keep their defaults.
+func WithCache(maxBytes int64, ttl time.Duration) Option {
+	return func(s *Server) error {
+		if maxBytes <= 0 || ttl < 0 {
+			return fmt.Errorf("read cache: size must be positive and ttl not negative")
+		}
+		s.cfg.ReadCacheBytes, s.cfg.ReadCacheTTL = maxBytes, ttl
+		return nil
+	}
+}
+
+// WithStaticMaxAge sets the browser cache lifetime (Cache-Control max-age) of static mounts added
+// without a cacheMaxAge.
+func WithStaticMaxAge(maxAge time.Duration) Option {
+	return func(s *Server) error {
+		if maxAge < time.Second {
+			return fmt.Errorf("static max age must be at least 1s")
+		}
+		s.staticMaxAge = int(maxAge / time.Second)
+		return nil
+	}
+}
+
+// WithIdempotency keeps POST/PUT responses for ttl to replay them for a repeated Idempotency-Key.
+func WithIdempotency(ttl time.Duration) Option {
+	return func(s *Server) error {
+		s.cfg.IdempotencyTTL = ttl
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kzen-go/kzenimage"
+)
+
+func TestNewServer_Options(t *testing.T) {
+	docsMaxAge, noCache := 60, 0
+	srv, err := NewServer(
+		WithConfig(Config{Bucket: "from-env", IdempotencyTTL: time.Minute}),
+		WithMinio("localhost:9", "ak", "sk", false),
+		WithBucket("kzen-storage"),
+		WithAuth(APIKey{Name: "app", Key: "secret"}),
+		WithMount(Mount{Route: "/app", Type: MountTypeStatic}),
+		WithMount(Mount{Route: "/docs/", Type: MountTypeStatic, CacheMaxAge: &docsMaxAge}),
+		WithMount(Mount{Route: "/live/", Type: MountTypeStatic, CacheMaxAge: &noCache}),
+		WithStaticMaxAge(24*time.Hour),
+		WithCache(64<<20, time.Minute),
+		WithImagePipeline(kzenimage.Options{MaxEdgePx: 1024}),
+		WithConfigFunc(func(c *Config) { c.SoftDelete = true }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := srv.Config()
+	if cfg.Bucket != "kzen-storage" || cfg.Endpoint != "localhost:9" || cfg.IdempotencyTTL != time.Minute {
+		t.Errorf("config = %+v", cfg)
+	}
+	if cfg.ReadCacheBytes != 64<<20 || cfg.ReadCacheTTL != time.Minute || !cfg.SoftDelete {
+		t.Errorf("read cache %d %v, soft delete %v", cfg.ReadCacheBytes, cfg.ReadCacheTTL, cfg.SoftDelete)
+	}
+	if len(cfg.APIKeys) != 1 || cfg.ImagePipeline == nil || cfg.ImagePipeline.MaxEdgePx != 1024 {
+		t.Errorf("keys %v, pipeline %+v", cfg.APIKeys, cfg.ImagePipeline)
+	}
+	if len(cfg.Mounts) != 3 || cfg.Mounts[0].Route != "/app/" || cfg.Mounts[0].cacheMaxAge() != 86400 ||
+		cfg.Mounts[1].cacheMaxAge() != 60 || cfg.Mounts[2].cacheMaxAge() != 0 {
+		t.Errorf("mounts = %+v", cfg.Mounts)
+	}
+
+	h, err := srv.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/objects/a.txt", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE without key = %d, want 401", rec.Code)
+	}
+}
+
+func TestNewServer_InvalidOptions(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"bucket": WithBucket(""),
+		"mount":  WithMount(Mount{Route: "app/"}),
+		"auth":   WithAuth(APIKey{Name: "app"}),
+		"cache":  WithCache(0, time.Minute),
+		"static": WithStaticMaxAge(0),
+		"config": WithConfig(Config{Mounts: []Mount{{Route: "app/"}}}),
+	} {
+		if _, err := NewServer(opt); err == nil {
+			t.Errorf("%s: invalid option accepted", name)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 )
@@ -29,7 +30,7 @@ func (m *mockObjectLister) ListObjects(_ context.Context, _ string, opts minio.L
 func TestDebugList_Default(t *testing.T) {
 	mock := &mockObjectLister{
 		objects: []minio.ObjectInfo{
-			{Key: "file1.txt"},
+			{Key: "file1.txt", Size: 10, LastModified: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
 			{Key: "file2.txt"},
 			{Key: "uploads/doc.pdf"},
 		},
@@ -49,8 +50,8 @@ func TestDebugList_Default(t *testing.T) {
 	}
 
 	var resp struct {
-		Bucket  string   `json:"bucket"`
-		Objects []string `json:"objects"`
+		Bucket  string           `json:"bucket"`
+		Objects []debugListEntry `json:"objects"`
 	}
 	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
 		t.Fatalf("unmarshal response: %v", err)
@@ -58,13 +59,16 @@ func TestDebugList_Default(t *testing.T) {
 	if resp.Bucket != "test-bucket" {
 		t.Errorf("got bucket %q, want test-bucket", resp.Bucket)
 	}
+	if got := resp.Objects[0]; got.Size != 10 || got.LastModified.Year() != 2026 {
+		t.Errorf("objects[0] = %+v, want size and date", got)
+	}
 	wantKeys := []string{"file1.txt", "file2.txt", "uploads/doc.pdf"}
 	if len(resp.Objects) != len(wantKeys) {
 		t.Errorf("got %d objects, want %d: %v", len(resp.Objects), len(wantKeys), resp.Objects)
 	}
 	for i, key := range wantKeys {
-		if i < len(resp.Objects) && resp.Objects[i] != key {
-			t.Errorf("objects[%d] = %q, want %q", i, resp.Objects[i], key)
+		if i < len(resp.Objects) && resp.Objects[i].Key != key {
+			t.Errorf("objects[%d] = %q, want %q", i, resp.Objects[i].Key, key)
 		}
 	}
 }
@@ -89,8 +93,8 @@ func TestDebugList_WithPrefix(t *testing.T) {
 	}
 
 	var resp struct {
-		Bucket  string   `json:"bucket"`
-		Objects []string `json:"objects"`
+		Bucket  string           `json:"bucket"`
+		Objects []debugListEntry `json:"objects"`
 	}
 	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
 		t.Fatalf("unmarshal response: %v", err)
@@ -100,8 +104,8 @@ func TestDebugList_WithPrefix(t *testing.T) {
 		t.Errorf("got %d objects, want %d: %v (prefix filter should exclude other/)", len(resp.Objects), len(wantKeys), resp.Objects)
 	}
 	for i, key := range wantKeys {
-		if i < len(resp.Objects) && resp.Objects[i] != key {
-			t.Errorf("objects[%d] = %q, want %q", i, resp.Objects[i], key)
+		if i < len(resp.Objects) && resp.Objects[i].Key != key {
+			t.Errorf("objects[%d] = %q, want %q", i, resp.Objects[i].Key, key)
 		}
 	}
 }
@@ -119,3 +123,126 @@ func TestDebugList_MethodNotAllowed(t *testing.T) {
 		t.Errorf("got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
 	}
 }
+
+func TestDebugList_Pagination(t *testing.T) {
+	mock := &mockObjectLister{objects: []minio.ObjectInfo{{Key: "a"}, {Key: "b"}, {Key: "c"}}}
+	handler := debugList(mock, "test-bucket")
+
+	type page struct {
+		Objects     []debugListEntry `json:"objects"`
+		IsTruncated bool             `json:"isTruncated"`
+		Next        string           `json:"nextContinuationToken"`
+	}
+	var got []string
+	url := "/debug/list?max-keys=2"
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var p page
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatalf("page %d: %v (%s)", i, err, rec.Body.String())
+		}
+		for _, o := range p.Objects {
+			got = append(got, o.Key)
+		}
+		if !p.IsTruncated {
+			break
+		}
+		url = "/debug/list?max-keys=2&continuation-token=" + p.Next
+	}
+	if len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("keys over pages = %v, want [a b c]", got)
+	}
+}
+
+func TestRequireAdminKey(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	keys := newAPIKeyStore([]APIKey{{Name: "app", Key: "app-key"}, {Name: "ops", Key: "ops-key", Admin: true}})
+	cases := []struct {
+		keys   *apiKeyStore
+		key    string
+		status int
+	}{
+		{nil, "", http.StatusForbidden},
+		{keys, "", http.StatusUnauthorized},
+		{keys, "app-key", http.StatusForbidden},
+		{keys, "ops-key", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/debug/list", nil)
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		rec := httptest.NewRecorder()
+		requireAdminKey(tc.keys, ok)(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("key %q: status %d, want %d", tc.key, rec.Code, tc.status)
+		}
+	}
+}
+
+func TestNewHandler_ServesRoutesWithMiddleware(t *testing.T) {
+	h, err := NewHandler(Config{Endpoint: "http://localhost:9/ignored", Bucket: "bucket", APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get(requestIDHeader) == "" {
+		t.Errorf("GET /health = %d, request id %q", rec.Code, rec.Header().Get(requestIDHeader))
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/objects/a.txt", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE without key = %d, want 401", rec.Code)
+	}
+
+	if _, err := NewHandler(Config{Endpoint: "localhost:9", ImageAlphaBackground: "blue"}); err == nil {
+		t.Error("invalid config accepted")
+	}
+}
+
+func TestNewMountHandler(t *testing.T) {
+	client, err := NewClient(Config{Endpoint: "localhost:9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewMountHandler(client, Mount{Route: "/files", Features: &MountFeatures{PublicRead: true}}, Config{Bucket: "bucket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/files/a.txt", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("PUT on a read-only mount = %d, want 403", rec.Code)
+	}
+	if _, err := NewMountHandler(client, Mount{Route: "files/"}, Config{}); err == nil {
+		t.Error("invalid mount accepted")
+	}
+}
+
+func TestProxyDelete_ReportsExistence(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["a.jpg"] = []byte("x")
+	h := proxyDeleteWithPrefix(client, "files", "/objects/", proxyOptions{})
+	del := func(target string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, target, nil))
+		var body map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	if code, body := del("/objects/a.jpg"); code != http.StatusOK || body["existed"] != true {
+		t.Errorf("existing: %d %v", code, body)
+	}
+	if _, ok := objects["a.jpg"]; ok {
+		t.Error("object not deleted")
+	}
+	if code, body := del("/objects/a.jpg"); code != http.StatusOK || body["existed"] != false || body["ok"] != true {
+		t.Errorf("missing: %d %v", code, body)
+	}
+	if code, _ := del("/objects/a.jpg?mustExist=1"); code != http.StatusNotFound {
+		t.Errorf("missing with mustExist: %d", code)
+	}
+}
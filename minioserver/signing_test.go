@@ -0,0 +1,176 @@
+package minioserver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignedRequest(t *testing.T) {
+	store := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	now := time.Date(2026, 1, 16, 12, 0, 0, 0, time.UTC)
+	body := []byte("hello")
+
+	newReq := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/objects/a%20b.txt?b=2&a=1", bytes.NewReader(body))
+		SignRequest(r, "web", "secret", body, now)
+		return r
+	}
+
+	r := newReq()
+	name, err := store.verifySignedRequest(r, now.Add(time.Minute))
+	if err != nil || name != "web" {
+		t.Fatalf("valid request: %q, %v", name, err)
+	}
+	if got, err := io.ReadAll(r.Body); err != nil || string(got) != "hello" {
+		t.Errorf("body read = %q, %v", got, err)
+	}
+
+	if _, err := store.verifySignedRequest(newReq(), now.Add(10*time.Minute)); !errors.Is(err, errSignatureDate) {
+		t.Errorf("stale request: err = %v, want errSignatureDate", err)
+	}
+
+	r = newReq()
+	r.URL.Path = "/objects/other.txt"
+	r.URL.RawPath = ""
+	if _, err := store.verifySignedRequest(r, now); !errors.Is(err, errSignatureMismatch) {
+		t.Errorf("tampered path: err = %v, want errSignatureMismatch", err)
+	}
+
+	r = newReq()
+	r.Body = io.NopCloser(bytes.NewReader([]byte("HELLO")))
+	if _, err := store.verifySignedRequest(r, now); !errors.Is(err, errBodyHashMismatch) {
+		t.Errorf("tampered body: err = %v, want errBodyHashMismatch", err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/objects/a", nil)
+	SignRequest(r, "web", "wrong", nil, now)
+	if _, err := store.verifySignedRequest(r, now); !errors.Is(err, errSignatureMismatch) {
+		t.Errorf("wrong secret: err = %v, want errSignatureMismatch", err)
+	}
+}
+
+// A JSON decoder stops after the first value, so a body swapped for another JSON value must be
+// caught before the handler decodes it.
+func TestVerifySignedRequest_SwappedJSONBody(t *testing.T) {
+	store := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	now := time.Now()
+	r := httptest.NewRequest(http.MethodPost, "/fetch", strings.NewReader(`{"url":"https://evil.example/x"}`))
+	SignRequest(r, "web", "secret", []byte(`{"url":"https://good.example/x"}`), now)
+	if _, err := store.authenticate(r); !errors.Is(err, errBodyHashMismatch) {
+		t.Fatalf("swapped JSON body: err = %v, want errBodyHashMismatch", err)
+	}
+
+	big := bytes.Repeat([]byte("a"), signedBodyMemory+10)
+	r = httptest.NewRequest(http.MethodPut, "/objects/big", bytes.NewReader(big))
+	SignRequest(r, "web", "secret", big, now)
+	if _, err := store.authenticate(r); err != nil {
+		t.Fatalf("spooled body: %v", err)
+	}
+	if got, err := io.ReadAll(r.Body); err != nil || !bytes.Equal(got, big) {
+		t.Errorf("spooled body read: %d bytes, %v", len(got), err)
+	}
+	r.Body.Close()
+
+	swapped := bytes.Clone(big)
+	swapped[len(swapped)-1] = 'b'
+	r = httptest.NewRequest(http.MethodPut, "/objects/big", bytes.NewReader(swapped))
+	SignRequest(r, "web", "secret", big, now)
+	if _, err := store.authenticate(r); !errors.Is(err, errBodyHashMismatch) {
+		t.Errorf("swapped large body: err = %v, want errBodyHashMismatch", err)
+	}
+}
+
+func TestAPIKeyStore_SignedOnlyRejectsPlainKey(t *testing.T) {
+	store := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	store.signedOnly = true
+
+	r := httptest.NewRequest(http.MethodDelete, "/objects/a", nil)
+	r.Header.Set("X-API-Key", "secret")
+	if _, err := store.authenticate(r); !errors.Is(err, errSignatureRequired) {
+		t.Errorf("plain key: err = %v, want errSignatureRequired", err)
+	}
+
+	r = httptest.NewRequest(http.MethodDelete, "/objects/a", nil)
+	SignRequest(r, "web", "secret", nil, time.Now())
+	if name, err := store.authenticate(r); err != nil || name != "web" {
+		t.Errorf("signed request: %q, %v", name, err)
+	}
+}
+
+func TestVerifySignedRequest_Nonce(t *testing.T) {
+	store := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	store.requireNonce = true
+	now := time.Date(2026, 1, 16, 12, 0, 0, 0, time.UTC)
+
+	r := httptest.NewRequest(http.MethodDelete, "/objects/a", nil)
+	SignRequest(r, "web", "secret", nil, now)
+	replay := r.Clone(r.Context())
+	if _, err := store.verifySignedRequest(r, now); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if _, err := store.verifySignedRequest(replay, now.Add(time.Minute)); !errors.Is(err, errSignatureReplay) {
+		t.Errorf("replayed request: err = %v, want errSignatureReplay", err)
+	}
+
+	r = httptest.NewRequest(http.MethodDelete, "/objects/a", nil)
+	SignRequest(r, "web", "secret", nil, now)
+	r.Header.Set(signatureNonceHeader, "0123456789abcdef0123456789abcdef")
+	if _, err := store.verifySignedRequest(r, now); !errors.Is(err, errSignatureMismatch) {
+		t.Errorf("swapped nonce: err = %v, want errSignatureMismatch", err)
+	}
+
+	// Signed the way clients did before nonces.
+	unsigned := func(method string) *http.Request {
+		r := httptest.NewRequest(method, "/objects/a", nil)
+		date := now.Format(signatureDateFormat)
+		bodyHash := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+		r.Header.Set(signatureDateHeader, date)
+		r.Header.Set(signatureBodyHeader, bodyHash)
+		r.Header.Set("Authorization", signatureAlgorithm+" Credential=web, Signature="+signatureHex("secret", signatureStringToSign(r, date, bodyHash)))
+		return r
+	}
+	if _, err := store.verifySignedRequest(unsigned(http.MethodDelete), now); !errors.Is(err, errSignatureNonce) {
+		t.Errorf("DELETE without nonce: err = %v, want errSignatureNonce", err)
+	}
+	if _, err := store.verifySignedRequest(unsigned(http.MethodGet), now); err != nil {
+		t.Errorf("GET without nonce: %v", err)
+	}
+}
+
+// apiKeyMiddleware and the per-route checks behind it both authenticate; the second must not see
+// the signed request as a replay of the first.
+func TestSignedRequest_NonceThroughAuthLayers(t *testing.T) {
+	store := newAPIKeyStore([]APIKey{{Name: "ops", Key: "secret", Admin: true}})
+	store.requireNonce = true
+	var got string
+	inner := func(w http.ResponseWriter, r *http.Request) {
+		if !hasValidAPIKey(store, r) {
+			t.Error("hasValidAPIKey rejected an authenticated request")
+		}
+		body, _ := io.ReadAll(r.Body)
+		got = apiKeyName(r.Context()) + " " + string(body)
+	}
+	h := apiKeyMiddleware(store)(requireAdminKey(store, requireAPIKey(store, inner)))
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/thing", strings.NewReader("payload"))
+	SignRequest(r, "ops", "secret", []byte("payload"), time.Now())
+	replay := r.Clone(r.Context())
+	replay.Body = io.NopCloser(strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || got != "ops payload" {
+		t.Fatalf("signed request through both layers: %d %s, handler saw %q", rec.Code, rec.Body, got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, replay)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed request: %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package minioserver
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const staticIndexFile = "index.html"
+
+// staticSiteKeys returns the object keys to try, in order, for a request path under a static mount:
+// the file itself (index.html for directories), then the SPA fallback index.html for extension-less
+// paths such as client-side routes (/app/goals/123).
+func staticSiteKeys(m Mount, urlPath string) []string {
+	rel := strings.TrimPrefix(urlPath, m.Route)
+	clean := strings.TrimPrefix(path.Clean("/"+rel), "/")
+	if clean == "" || clean == "." || strings.HasSuffix(rel, "/") {
+		clean = path.Join(clean, staticIndexFile)
+	}
+	keys := []string{m.Prefix + clean}
+	if path.Ext(clean) == "" {
+		keys = append(keys, m.Prefix+staticIndexFile)
+	}
+	return keys
+}
+
+// staticSiteHandler serves a bucket prefix as a static website (e.g. the built kzen frontend).
+// HTML is sent with Cache-Control: no-cache so deploys show up immediately; other assets get
+// max-age=m.cacheMaxAge(). Range and conditional requests are handled by http.ServeContent.
+func staticSiteHandler(client *minio.Client, m Mount) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		var info minio.ObjectInfo
+		var key string
+		var err error
+		for _, key = range staticSiteKeys(m, r.URL.Path) {
+			info, err = client.StatObject(ctx, m.Bucket, key, minio.StatObjectOptions{})
+			if err == nil || !golib.IsNotFound(err) {
+				break
+			}
+		}
+		if err != nil {
+			if golib.IsNotFound(err) {
+				http.NotFound(w, r)
+				return
+			}
+			log.Printf("static stat %q bucket=%q: %v", key, m.Bucket, err)
+			respondStorageError(w, err, "failed to get object info")
+			return
+		}
+
+		obj, err := client.GetObject(ctx, m.Bucket, key, minio.GetObjectOptions{})
+		if err != nil {
+			log.Printf("static get %q bucket=%q: %v", key, m.Bucket, err)
+			respondStorageError(w, err, "failed to get object")
+			return
+		}
+		defer obj.Close()
+
+		contentType := info.ContentType
+		if contentType == "" || contentType == "application/octet-stream" || contentType == "binary/octet-stream" {
+			if byExt := mime.TypeByExtension(path.Ext(key)); byExt != "" {
+				contentType = byExt
+			}
+		}
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		if strings.HasPrefix(contentType, "text/html") {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", m.cacheMaxAge()))
+		}
+		if info.ETag != "" {
+			w.Header().Set("ETag", `"`+info.ETag+`"`)
+		}
+		http.ServeContent(w, r, path.Base(key), info.LastModified, obj)
+	}
+}
@@ -0,0 +1,70 @@
+package minioserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestStaticSiteKeys(t *testing.T) {
+	m := Mount{Route: "/app/", Prefix: "kzen/frontend/", Type: MountTypeStatic}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/app/", []string{"kzen/frontend/index.html"}},
+		{"/app/assets/index-3f2a.js", []string{"kzen/frontend/assets/index-3f2a.js"}},
+		{"/app/goals/123", []string{"kzen/frontend/goals/123", "kzen/frontend/index.html"}},
+		{"/app/docs/", []string{"kzen/frontend/docs/index.html"}},
+		{"/app/../../secret.txt", []string{"kzen/frontend/secret.txt"}},
+	}
+	for _, tt := range tests {
+		if got := staticSiteKeys(m, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("staticSiteKeys(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseMounts(t *testing.T) {
+	mounts, err := ParseMounts(`[{"route":"/app","prefix":"/kzen/frontend","type":"static"}]`)
+	if err != nil {
+		t.Fatalf("ParseMounts: %v", err)
+	}
+	if len(mounts) != 1 {
+		t.Fatalf("got %d mounts, want 1", len(mounts))
+	}
+	m := mounts[0]
+	if m.Route != "/app/" || m.Prefix != "kzen/frontend/" || m.Type != MountTypeStatic || m.cacheMaxAge() != defaultStaticMaxAge {
+		t.Errorf("unexpected normalized mount: %+v", m)
+	}
+
+	if _, err := ParseMounts(`[{"route":"/x/","type":"ftp"}]`); err == nil {
+		t.Error("expected error for unknown mount type")
+	}
+	if _, err := ParseMounts(`[{"route":"/x/","type":"static","cacheMaxAge":-1}]`); err == nil {
+		t.Error("expected error for a negative cacheMaxAge")
+	}
+}
+
+func TestStaticSiteHandler_CacheMaxAge(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["site/app.js"] = []byte("console.log(1)")
+	mounts, err := ParseMounts(`[{"route":"/app/","bucket":"files","prefix":"site/","type":"static"},
+		{"route":"/live/","bucket":"files","prefix":"site/","type":"static","cacheMaxAge":0}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for route, want := range map[string]string{"/app/": "public, max-age=3600", "/live/": "public, max-age=0"} {
+		m := mounts[0]
+		if mounts[1].Route == route {
+			m = mounts[1]
+		}
+		rec := httptest.NewRecorder()
+		staticSiteHandler(client, m).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, route+"app.js", nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != want {
+			t.Errorf("GET %sapp.js: %d, Cache-Control %q, want %q", route, rec.Code, rec.Header().Get("Cache-Control"), want)
+		}
+	}
+}
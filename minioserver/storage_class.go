@@ -0,0 +1,32 @@
+package minioserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// storageClassHeader picks the storage class of a single upload, overriding the mount's.
+const storageClassHeader = "X-Storage-Class"
+
+// storageClassPattern matches STANDARD, REDUCED_REDUNDANCY and custom MinIO tier names.
+var storageClassPattern = regexp.MustCompile(`^[A-Z0-9_-]{1,64}$`)
+
+// normalizeStorageClass upper-cases class and checks it looks like a storage class name.
+func normalizeStorageClass(class string) (string, error) {
+	class = strings.ToUpper(strings.TrimSpace(class))
+	if class != "" && !storageClassPattern.MatchString(class) {
+		return "", fmt.Errorf("invalid storage class %q", class)
+	}
+	return class, nil
+}
+
+// storageClassFor returns the storage class for an upload: the X-Storage-Class header when set,
+// otherwise def. "" leaves the choice to MinIO (STANDARD).
+func storageClassFor(r *http.Request, def string) (string, error) {
+	if h := r.Header.Get(storageClassHeader); h != "" {
+		return normalizeStorageClass(h)
+	}
+	return def, nil
+}
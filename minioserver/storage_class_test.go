@@ -0,0 +1,38 @@
+package minioserver
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStorageClassFor(t *testing.T) {
+	cases := []struct {
+		header, def, want string
+		wantErr           bool
+	}{
+		{"", "", "", false},
+		{"", "REDUCED_REDUNDANCY", "REDUCED_REDUNDANCY", false},
+		{"standard", "REDUCED_REDUNDANCY", "STANDARD", false},
+		{"cold tier", "", "", true},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("PUT", "/objects/a", nil)
+		if tc.header != "" {
+			r.Header.Set(storageClassHeader, tc.header)
+		}
+		got, err := storageClassFor(r, tc.def)
+		if got != tc.want || (err != nil) != tc.wantErr {
+			t.Errorf("header %q def %q = %q, %v; want %q", tc.header, tc.def, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseMounts_StorageClass(t *testing.T) {
+	mounts, err := ParseMounts(`[{"route":"/originals/","storageClass":"reduced_redundancy"}]`)
+	if err != nil || mounts[0].StorageClass != "REDUCED_REDUNDANCY" {
+		t.Fatalf("ParseMounts = %+v, %v", mounts, err)
+	}
+	if _, err := ParseMounts(`[{"route":"/x/","storageClass":"a/b"}]`); err == nil {
+		t.Error("invalid storage class accepted")
+	}
+}
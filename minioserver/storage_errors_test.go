@@ -0,0 +1,49 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestRespondStorageError(t *testing.T) {
+	s3err := func(code string, status int) error {
+		return minio.ErrorResponse{Code: code, Message: code, StatusCode: status}
+	}
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"missing key", s3err("NoSuchKey", 404), http.StatusNotFound, "not_found"},
+		{"missing bucket", s3err("NoSuchBucket", 404), http.StatusNotFound, "not_found"},
+		{"wrapped", fmt.Errorf("stat: %w", s3err("NoSuchKey", 404)), http.StatusNotFound, "not_found"},
+		{"denied", s3err("AccessDenied", 403), http.StatusForbidden, "forbidden"},
+		{"locked", s3err("ObjectLocked", 400), http.StatusConflict, "conflict"},
+		{"slow down", s3err("SlowDown", 503), http.StatusServiceUnavailable, "service_unavailable"},
+		{"unreachable", context.DeadlineExceeded, http.StatusServiceUnavailable, "service_unavailable"},
+		{"other s3", s3err("InternalError", 500), http.StatusInternalServerError, "internal_server_error"},
+		{"other", errors.New("boom"), http.StatusInternalServerError, "internal_server_error"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		respondStorageError(rec, tc.err, "upload failed")
+		var body errorBody
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != tc.status || body.Code != tc.code {
+			t.Errorf("%s: response = %d %q (%v), want %d %s", tc.name, rec.Code, rec.Body.String(), err, tc.status, tc.code)
+		}
+		if tc.status == http.StatusInternalServerError && body.Error != "upload failed" {
+			t.Errorf("%s: message = %q, want the fallback", tc.name, body.Error)
+		}
+		if tc.status == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: no Retry-After on 503", tc.name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package minioserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	metrics.describe("kzen_downloads_total", "counter", "Object bodies streamed, by outcome (complete|client_aborted|backend_error).")
+	metrics.describe("kzen_download_missing_bytes_total", "counter", "Bytes of object bodies not delivered because the download was cut short, by outcome.")
+}
+
+// streamErrorTrailer carries the error message when a chunked response fails mid-stream.
+const streamErrorTrailer = "X-Stream-Error"
+
+// Download outcomes: whether a streamed body reached the client in full, or which side cut it short.
+const (
+	downloadComplete      = "complete"
+	downloadClientAborted = "client_aborted"
+	downloadBackendError  = "backend_error"
+)
+
+// downloadRecord is how the object body of a request was streamed, filled by streamBody for the
+// request log and analytics. Outcome is "" for requests that streamed no object.
+type downloadRecord struct {
+	Outcome string
+	Written int64
+	Size    int64 // -1 when unknown
+	Err     error
+}
+
+type downloadRecordKey struct{}
+
+// withDownloadRecord returns r carrying a downloadRecord for streamBody to fill, reusing one an
+// outer middleware already added.
+func withDownloadRecord(r *http.Request) (*http.Request, *downloadRecord) {
+	if rec, ok := r.Context().Value(downloadRecordKey{}).(*downloadRecord); ok {
+		return r, rec
+	}
+	rec := &downloadRecord{}
+	return r.WithContext(context.WithValue(r.Context(), downloadRecordKey{}, rec)), rec
+}
+
+// writeErrRecorder remembers the first error writing to the client, so a failed copy can be told
+// apart from a failed read from MinIO.
+type writeErrRecorder struct {
+	w   io.Writer
+	err error
+}
+
+func (wr *writeErrRecorder) Write(p []byte) (int, error) {
+	n, err := wr.w.Write(p)
+	if err != nil && wr.err == nil {
+		wr.err = err
+	}
+	return n, err
+}
+
+// downloadOutcome classifies a finished copy: errors writing to the client, or any error once the
+// client has gone (its context canceled), are client aborts; everything else, including a body
+// shorter than the stat said, is the backend's.
+func downloadOutcome(r *http.Request, writeErr, err error) string {
+	switch {
+	case err == nil:
+		return downloadComplete
+	case writeErr != nil, r.Context().Err() == context.Canceled:
+		return downloadClientAborted
+	default:
+		return downloadBackendError
+	}
+}
+
+// acceptsTrailers reports whether the client asked for trailers ("TE: trailers").
+func acceptsTrailers(r *http.Request) bool {
+	for _, v := range r.Header.Values("TE") {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(strings.Split(part, ";")[0]), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamBody writes src to w and returns the bytes copied. The outcome (complete, or cut short
+// by the client or by MinIO) is counted in kzen_downloads_total and left in the request's
+// downloadRecord, if any.
+//
+// When size is known and the client didn't ask for trailers, Content-Length is set so browsers can
+// show progress; a failure mid-copy then leaves the response short, which clients detect as a
+// truncated body. When size is unknown (-1, e.g. transformed output) or the client sent
+// "TE: trailers", the response is chunked and a copy error is reported in the X-Stream-Error trailer
+// instead of buffering the whole body to compute its length.
+func streamBody(w http.ResponseWriter, r *http.Request, src io.Reader, size int64) (int64, error) {
+	useTrailer := size < 0 || acceptsTrailers(r)
+	if useTrailer {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Trailer", streamErrorTrailer)
+	} else {
+		w.Header().Set("Content-Length", fmtSize(size))
+	}
+
+	dst := &writeErrRecorder{w: w}
+	n, err := copyPooled(dst, src)
+	if err == nil && size >= 0 && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+	outcome := downloadOutcome(r, dst.err, err)
+	metrics.add("kzen_downloads_total", 1, "outcome", outcome)
+	if outcome != downloadComplete && size > n {
+		metrics.add("kzen_download_missing_bytes_total", float64(size-n), "outcome", outcome)
+	}
+	if rec, ok := r.Context().Value(downloadRecordKey{}).(*downloadRecord); ok {
+		*rec = downloadRecord{Outcome: outcome, Written: n, Size: size, Err: err}
+	}
+	if err != nil && useTrailer {
+		w.Header().Set(streamErrorTrailer, err.Error())
+	}
+	return n, err
+}
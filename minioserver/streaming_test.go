@@ -0,0 +1,110 @@
+package minioserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type failingReader struct {
+	data string
+	err  error
+	done bool
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.done {
+		return 0, f.err
+	}
+	f.done = true
+	return copy(p, f.data), nil
+}
+
+func TestStreamBody_KnownSizeSetsContentLength(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/objects/a.txt", nil)
+	rec := httptest.NewRecorder()
+
+	n, err := streamBody(rec, req, strings.NewReader("hello"), 5)
+	if err != nil || n != 5 {
+		t.Fatalf("streamBody = %d, %v", n, err)
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "5" {
+		t.Errorf("got Content-Length %q, want 5", cl)
+	}
+	if tr := rec.Header().Get("Trailer"); tr != "" {
+		t.Errorf("unexpected Trailer header %q", tr)
+	}
+}
+
+func TestStreamBody_UnknownSizeReportsErrorInTrailer(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/objects/a.txt", nil)
+	rec := httptest.NewRecorder()
+
+	_, err := streamBody(rec, req, &failingReader{data: "partial", err: errors.New("minio connection reset")}, -1)
+	if err == nil {
+		t.Fatal("expected copy error")
+	}
+	res := rec.Result()
+	io.ReadAll(res.Body)
+	if got := res.Trailer.Get(streamErrorTrailer); got != "minio connection reset" {
+		t.Errorf("got trailer %q, want minio connection reset", got)
+	}
+	if res.Header.Get("Content-Length") != "" {
+		t.Error("chunked response must not set Content-Length")
+	}
+}
+
+func TestStreamBody_TETrailersForcesChunked(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/objects/a.txt", nil)
+	req.Header.Set("TE", "gzip, trailers")
+	rec := httptest.NewRecorder()
+
+	streamBody(rec, req, strings.NewReader("hello"), 5)
+	if rec.Header().Get("Content-Length") != "" {
+		t.Error("TE: trailers request must be chunked")
+	}
+	if tr := rec.Header().Get("Trailer"); tr != streamErrorTrailer {
+		t.Errorf("got Trailer %q, want %s", tr, streamErrorTrailer)
+	}
+}
+
+// brokenConnWriter fails every write after the first, like a client that went away mid-download.
+type brokenConnWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (b *brokenConnWriter) Write(p []byte) (int, error) {
+	b.writes++
+	if b.writes > 1 {
+		return 0, errors.New("write: broken pipe")
+	}
+	return b.ResponseRecorder.Write(p)
+}
+
+func TestStreamBody_RecordsDownloadOutcome(t *testing.T) {
+	stream := func(w http.ResponseWriter, src io.Reader, size int64) downloadRecord {
+		t.Helper()
+		req, rec := withDownloadRecord(httptest.NewRequest(http.MethodGet, "/objects/a.txt", nil))
+		streamBody(w, req, src, size)
+		return *rec
+	}
+
+	if d := stream(httptest.NewRecorder(), strings.NewReader("hello"), 5); d.Outcome != downloadComplete || d.Written != 5 || d.Err != nil {
+		t.Errorf("complete: %+v", d)
+	}
+	if d := stream(httptest.NewRecorder(), &failingReader{data: "par", err: errors.New("connection reset by minio")}, 7); d.Outcome != downloadBackendError || d.Written != 3 || d.Size != 7 {
+		t.Errorf("backend error: %+v", d)
+	}
+	if d := stream(httptest.NewRecorder(), strings.NewReader("hel"), 5); d.Outcome != downloadBackendError || !errors.Is(d.Err, io.ErrUnexpectedEOF) {
+		t.Errorf("short object: %+v", d)
+	}
+	// Two reads, so the second write hits the broken connection.
+	src := io.MultiReader(&failingReader{data: "hel", err: io.EOF}, strings.NewReader("lo"))
+	if d := stream(&brokenConnWriter{ResponseRecorder: httptest.NewRecorder()}, src, 5); d.Outcome != downloadClientAborted || d.Written != 3 {
+		t.Errorf("client abort: %+v", d)
+	}
+}
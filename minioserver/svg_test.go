@@ -0,0 +1,46 @@
+package minioserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSVGPolicy(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`
+	png := func(ctx context.Context, data []byte) ([]byte, error) { return []byte("PNG"), nil }
+	broken := func(ctx context.Context, data []byte) ([]byte, error) { return nil, errors.New("boom") }
+
+	for _, c := range []struct {
+		policy             svgPolicy
+		wantServed         bool
+		wantType, wantCSP  string
+		wantBody, wantETag string
+	}{
+		{svgPolicy{}, false, "image/svg+xml", "", "", `"e1"`},
+		{svgPolicy{mode: SVGServeSandbox}, false, "image/svg+xml", svgCSP, "", `"e1"`},
+		{svgPolicy{mode: SVGServeText}, false, "text/plain; charset=utf-8", "", "", `"e1"`},
+		{svgPolicy{mode: SVGServePNG, rasterizer: png}, true, "image/png", "", "PNG", `"e1-png"`},
+		{svgPolicy{mode: SVGServePNG, rasterizer: broken}, true, "image/svg+xml", svgCSP, svg, `"e1"`},
+		{svgPolicy{mode: SVGServePNG}, false, "image/svg+xml", svgCSP, "", `"e1"`},
+	} {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Type", "image/svg+xml")
+		rec.Header().Set("ETag", `"e1"`)
+		req := httptest.NewRequest(http.MethodGet, "/objects/a.svg", nil)
+		served := c.policy.serve(rec, req, strings.NewReader(svg), int64(len(svg)), "e1")
+		if served != c.wantServed || rec.Header().Get("Content-Type") != c.wantType ||
+			rec.Header().Get("Content-Security-Policy") != c.wantCSP || rec.Body.String() != c.wantBody ||
+			rec.Header().Get("ETag") != c.wantETag {
+			t.Errorf("mode %q: served=%v type=%q csp=%q body=%q etag=%q", c.policy.mode, served,
+				rec.Header().Get("Content-Type"), rec.Header().Get("Content-Security-Policy"), rec.Body.String(), rec.Header().Get("ETag"))
+		}
+	}
+
+	if !isSVG("application/octet-stream", "icons/Logo.SVG") || isSVG("image/png", "a.png") {
+		t.Error("isSVG")
+	}
+}
@@ -0,0 +1,36 @@
+package minioserver
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifySystemd(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", sock)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	notifySystemd()
+
+	buf := make([]byte, 64)
+	for _, want := range []string{"READY=1", "WATCHDOG=1"} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil || string(buf[:n]) != want {
+			t.Fatalf("got %q (%v), want %q", buf[:n], err, want)
+		}
+	}
+}
+
+func TestNotifySystemd_OutsideSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	notifySystemd() // must not block or fail
+}
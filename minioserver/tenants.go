@@ -0,0 +1,333 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Tenant is one isolated deployment served by a shared proxy (see Config.Tenants). Its objects
+// live under Prefix in Bucket, and only its own APIKeys are accepted for it.
+type Tenant struct {
+	Bucket  string   `json:"bucket"` // required, and not one the default routes serve
+	Prefix  string   `json:"prefix"` // key prefix inside Bucket, e.g. "tenants/acme/"
+	APIKeys []APIKey `json:"apiKeys"`
+	// Mounts are the tenant's routes besides /objects/; their bucket defaults to Bucket and
+	// their prefix is relative to Prefix.
+	Mounts []Mount     `json:"mounts,omitempty"`
+	Quota  TenantQuota `json:"quota"`
+}
+
+// TenantQuota limits a tenant's uploads; 0 means unlimited.
+type TenantQuota struct {
+	// MaxObjectBytes is the largest object the tenant may upload.
+	MaxObjectBytes int64 `json:"maxObjectBytes,omitempty"`
+	// MaxStorageBytes caps the bytes stored under the tenant's prefix. Usage is counted by
+	// listing the prefix every tenantUsageRescan and adding uploads in between.
+	MaxStorageBytes int64 `json:"maxStorageBytes,omitempty"`
+}
+
+// Tenant resolvers for Config.TenantResolvers.
+const (
+	TenantByHeader    = "header"    // X-Tenant-ID: <tenant>
+	TenantBySubdomain = "subdomain" // <tenant>.<TenantDomain>
+	TenantByKey       = "key"       // the tenant owning the request's API key
+)
+
+const tenantHeader = "X-Tenant-ID"
+
+// tenantUsageRescan is how often a tenant's stored bytes are recounted for MaxStorageBytes.
+const tenantUsageRescan = 10 * time.Minute
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ParseTenants reads tenants from a JSON object keyed by tenant id, e.g.
+// {"acme":{"prefix":"tenants/acme/","apiKeys":[{"name":"web","key":"..."}],"quota":{"maxStorageBytes":1073741824}}}.
+// A value starting with "@" is read from that file path. Empty input yields no tenants.
+func ParseTenants(raw string) (map[string]Tenant, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	if file, ok := strings.CutPrefix(raw, "@"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read tenants file: %w", err)
+		}
+		raw = string(data)
+	}
+	var tenants map[string]Tenant
+	if err := json.Unmarshal([]byte(raw), &tenants); err != nil {
+		return nil, fmt.Errorf("parse tenants: %w", err)
+	}
+	for id, t := range tenants {
+		if err := t.normalize(id); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", id, err)
+		}
+		tenants[id] = t
+	}
+	return tenants, nil
+}
+
+func (t *Tenant) normalize(id string) error {
+	if !tenantIDPattern.MatchString(id) {
+		return fmt.Errorf("id must be a lowercase DNS label")
+	}
+	t.Prefix = strings.TrimPrefix(strings.TrimSpace(t.Prefix), "/")
+	if t.Prefix != "" && !strings.HasSuffix(t.Prefix, "/") {
+		t.Prefix += "/"
+	}
+	names := make(map[string]bool, len(t.APIKeys))
+	for i, k := range t.APIKeys {
+		if k.Name == "" || k.Key == "" {
+			return fmt.Errorf("api key %d: name and key are required", i)
+		}
+		if names[k.Name] {
+			return fmt.Errorf("api key %d: duplicate name %q", i, k.Name)
+		}
+		names[k.Name] = true
+	}
+	for i := range t.Mounts {
+		if err := t.Mounts[i].normalize(); err != nil {
+			return fmt.Errorf("mount %d: %w", i, err)
+		}
+		// CORS is answered before requests are routed to a tenant.
+		if t.Mounts[i].CORS != nil {
+			return fmt.Errorf("mount %d: cors is not supported on tenant mounts", i)
+		}
+		// So are WebDAV's OPTIONS and Basic auth (webdavMiddleware).
+		if t.Mounts[i].Type == MountTypeWebDAV {
+			return fmt.Errorf("mount %d: webdav is not supported on tenant mounts", i)
+		}
+	}
+	if t.Quota.MaxObjectBytes < 0 || t.Quota.MaxStorageBytes < 0 {
+		return fmt.Errorf("quota must not be negative")
+	}
+	return nil
+}
+
+// tenantMounts returns the routes of tenant t: /objects/ on its prefix plus its own mounts,
+// with buckets defaulted and prefixes made absolute.
+func tenantMounts(t Tenant) []Mount {
+	mounts := mergeMounts([]Mount{{Route: "/objects/", Bucket: t.Bucket, Type: MountTypeObjects}}, t.Mounts)
+	for i := range mounts {
+		if mounts[i].Bucket == "" {
+			mounts[i].Bucket = t.Bucket
+		}
+		if mounts[i].Bucket == t.Bucket {
+			mounts[i].Prefix = t.Prefix + mounts[i].Prefix
+		}
+	}
+	return mounts
+}
+
+// checkTenantIsolation rejects tenants whose storage overlaps: same bucket with one prefix
+// containing the other. A tenant's buckets must also be ones none of defaultMounts serve: the
+// default routes (/objects/, /list/stream, the batch endpoints, ...) reach every key of those
+// buckets, past the tenant's keys and quota.
+func checkTenantIsolation(tenants map[string]Tenant, defaultMounts []Mount) error {
+	ids := make([]string, 0, len(tenants))
+	for id := range tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		t := tenants[id]
+		if t.Bucket == "" {
+			return fmt.Errorf("tenant %q: bucket is required", id)
+		}
+		for _, m := range tenantMounts(t) {
+			for _, d := range defaultMounts {
+				if m.Bucket == d.Bucket {
+					return fmt.Errorf("tenant %q: bucket %s is also served by the default route %s", id, m.Bucket, d.Route)
+				}
+			}
+		}
+	}
+	for i, a := range ids {
+		for _, b := range ids[i+1:] {
+			ta, tb := tenants[a], tenants[b]
+			if ta.Bucket == tb.Bucket && (strings.HasPrefix(ta.Prefix, tb.Prefix) || strings.HasPrefix(tb.Prefix, ta.Prefix)) {
+				return fmt.Errorf("tenants %q and %q share %s/%s", a, b, ta.Bucket, min(ta.Prefix, tb.Prefix))
+			}
+		}
+	}
+	return nil
+}
+
+// tenantRouter sends requests that resolve to a tenant to that tenant's handler and all other
+// requests to the default one.
+type tenantRouter struct {
+	resolvers []string
+	domain    string // for TenantBySubdomain
+	tenants   map[string]*tenantState
+}
+
+// tenantState is the runtime of one tenant.
+type tenantState struct {
+	keys    *apiKeyStore
+	handler http.Handler
+}
+
+// resolve returns the tenant id of r, "" when none of the resolvers applies.
+func (tr *tenantRouter) resolve(r *http.Request) string {
+	for _, res := range tr.resolvers {
+		switch res {
+		case TenantByHeader:
+			if id := strings.TrimSpace(r.Header.Get(tenantHeader)); id != "" {
+				return strings.ToLower(id)
+			}
+		case TenantBySubdomain:
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			// Other subdomains (www, the default deployment's own host) are not tenants.
+			if label, ok := strings.CutSuffix(strings.ToLower(host), "."+tr.domain); ok && tr.domain != "" && tr.tenants[label] != nil {
+				return label
+			}
+		case TenantByKey:
+			if id := tr.keyOwner(r); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// keyOwner returns the tenant holding the request's API key, or the only tenant with a key of
+// the signing key's name.
+func (tr *tenantRouter) keyOwner(r *http.Request) string {
+	if isSignedRequest(r) {
+		name, _, err := parseSignatureAuthorization(r.Header.Get("Authorization"))
+		if err != nil {
+			return ""
+		}
+		owner := ""
+		for id, t := range tr.tenants {
+			if _, err := t.keys.byName(name, time.Now()); !errors.Is(err, errAPIKeyInvalid) {
+				if owner != "" {
+					return "" // ambiguous
+				}
+				owner = id
+			}
+		}
+		return owner
+	}
+	key := requestAPIKey(r)
+	if key == "" {
+		return ""
+	}
+	for id, t := range tr.tenants {
+		if _, err := t.keys.lookup(key, time.Now()); !errors.Is(err, errAPIKeyInvalid) {
+			return id
+		}
+	}
+	return ""
+}
+
+func (tr *tenantRouter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := tr.resolve(r)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t, ok := tr.tenants[id]
+		if !ok {
+			respondErrorCode(w, "unknown tenant", "unknown_tenant", http.StatusNotFound)
+			return
+		}
+		t.handler.ServeHTTP(w, r)
+	})
+}
+
+// tenantUsage is the approximate number of bytes stored under a tenant's prefix.
+type tenantUsage struct {
+	bytes atomic.Int64
+}
+
+// watch recounts the bytes under bucket/prefix now and every tenantUsageRescan.
+func (u *tenantUsage) watch(ctx context.Context, client *minio.Client, id, bucket, prefix string) {
+	for {
+		var total int64
+		var err error
+		for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if obj.Err != nil {
+				err = obj.Err
+				break
+			}
+			total += obj.Size
+		}
+		if err != nil {
+			log.Printf("tenant %s usage: %v", id, err)
+		} else {
+			u.bytes.Store(total)
+			metrics.set("kzen_tenant_storage_bytes", float64(total), "tenant", id)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(tenantUsageRescan):
+		}
+	}
+}
+
+// quotaMiddleware enforces q on uploads: bodies over MaxObjectBytes get 413 and uploads that
+// would take the tenant past MaxStorageBytes get 507. Multipart files are limited by the
+// handlers (see tenantOptions).
+func quotaMiddleware(q TenantQuota, usage *tenantUsage) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost && r.Method != http.MethodPut {
+				next.ServeHTTP(w, r)
+				return
+			}
+			multipart := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/")
+			if q.MaxObjectBytes > 0 && !multipart {
+				if r.ContentLength > q.MaxObjectBytes {
+					respondErrorCode(w, fmt.Sprintf("object larger than the tenant limit of %d bytes", q.MaxObjectBytes), "quota_exceeded", http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, q.MaxObjectBytes)
+			}
+			if q.MaxStorageBytes <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if usage.bytes.Load()+max(r.ContentLength, 0) > q.MaxStorageBytes {
+				respondErrorCode(w, "tenant storage quota exceeded", "quota_exceeded", http.StatusInsufficientStorage)
+				return
+			}
+			body := &countingReadCloser{ReadCloser: r.Body}
+			r.Body = body
+			lw := &logResponseWriter{countingResponseWriter: countingResponseWriter{ResponseWriter: w}}
+			next.ServeHTTP(lw, r)
+			if lw.statusCode()/100 == 2 {
+				usage.bytes.Add(body.n)
+			}
+		})
+	}
+}
+
+// tenantOptions returns base adjusted for tenant t: its key set and its object size limit.
+func tenantOptions(base proxyOptions, keys *apiKeyStore, q TenantQuota) proxyOptions {
+	opts := base
+	opts.APIKeys = keys
+	if q.MaxObjectBytes > 0 && (opts.Multipart.MaxFileBytes <= 0 || q.MaxObjectBytes < opts.Multipart.MaxFileBytes) {
+		opts.Multipart.MaxFileBytes = q.MaxObjectBytes
+	}
+	return opts
+}
@@ -0,0 +1,156 @@
+package minioserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestParseTenants(t *testing.T) {
+	tenants, err := ParseTenants(`{"acme":{"prefix":"/tenants/acme","apiKeys":[{"name":"web","key":"k1"}]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tenants["acme"].Prefix; got != "tenants/acme/" {
+		t.Errorf("prefix = %q, want tenants/acme/", got)
+	}
+	for _, raw := range []string{
+		`{"Acme":{}}`,
+		`{"acme":{"apiKeys":[{"name":"web"}]}}`,
+		`{"acme":{"apiKeys":[{"name":"web","key":"a"},{"name":"web","key":"b"}]}}`,
+		`{"acme":{"quota":{"maxStorageBytes":-1}}}`,
+		`{"acme":{"mounts":[{"route":"app/"}]}}`,
+	} {
+		if _, err := ParseTenants(raw); err == nil {
+			t.Errorf("ParseTenants(%s) accepted", raw)
+		}
+	}
+	defaults := servedMounts(Config{Bucket: "files"})
+	if err := checkTenantIsolation(map[string]Tenant{"a": {Bucket: "b", Prefix: "t/"}, "b": {Bucket: "b", Prefix: "t/b/"}}, defaults); err == nil {
+		t.Error("nested tenant prefixes accepted")
+	}
+	if err := checkTenantIsolation(map[string]Tenant{"a": {Bucket: "b", Prefix: "t/a/"}, "b": {Bucket: "c"}}, defaults); err != nil {
+		t.Error(err)
+	}
+	// /objects/ and /list/stream on the default routes would reach the tenant past its keys and quota.
+	for _, tenant := range []Tenant{
+		{Bucket: "files", Prefix: "tenants/a/"},
+		{Bucket: "b", Mounts: []Mount{{Route: "/site/", Bucket: KZEN_STORAGE, Type: MountTypeStatic}}},
+		{Prefix: "tenants/a/"},
+	} {
+		if err := checkTenantIsolation(map[string]Tenant{"a": tenant}, defaults); err == nil {
+			t.Errorf("tenant %+v overlapping the default routes accepted", tenant)
+		}
+	}
+}
+
+func TestTenantRouter(t *testing.T) {
+	var mu sync.Mutex
+	var puts []string
+	// Bodies of unknown length are sent as multipart uploads; the object is stored on completion.
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound) // the owner check of a new key
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"abc"`)
+		case r.Method == http.MethodPost:
+			mu.Lock()
+			puts = append(puts, r.URL.Path)
+			mu.Unlock()
+			io.WriteString(w, `<CompleteMultipartUploadResult><Bucket>b</Bucket><ETag>"abc"</ETag></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer s3.Close()
+	client, err := minio.New(strings.TrimPrefix(s3.URL, "http://"), &minio.Options{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		Bucket:       "shared",
+		TenantDomain: "files.kzen.app",
+		Tenants: map[string]Tenant{
+			"acme":   {Bucket: "tenants", Prefix: "tenants/acme", APIKeys: []APIKey{{Name: "web", Key: "acme-key"}}, Quota: TenantQuota{MaxObjectBytes: 10}},
+			"globex": {Bucket: "globex", APIKeys: []APIKey{{Name: "web", Key: "globex-key"}}},
+		},
+	}
+	authOnly := func(keys *apiKeyStore) []func(http.Handler) http.Handler {
+		return []func(http.Handler) http.Handler{apiKeyMiddleware(keys)}
+	}
+	router, err := buildTenants(cfg, client, proxyOptions{}, authOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := router.middleware(fallback)
+
+	put := func(target, body string, header ...string) int {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := put("/objects/a.txt", "hi", "X-API-Key", "acme-key"); code != http.StatusCreated {
+		t.Errorf("acme by key: %d", code)
+	}
+	if code := put("http://globex.files.kzen.app/objects/b.txt", "hi", "X-API-Key", "globex-key"); code != http.StatusCreated {
+		t.Errorf("globex by subdomain: %d", code)
+	}
+	if code := put("/objects/c.txt", "hi", "X-Tenant-ID", "acme", "X-API-Key", "globex-key"); code != http.StatusUnauthorized {
+		t.Errorf("acme with globex's key: %d, want 401", code)
+	}
+	if code := put("/objects/c.txt", "hi", "X-Tenant-ID", "initech", "X-API-Key", "acme-key"); code != http.StatusNotFound {
+		t.Errorf("unknown tenant: %d, want 404", code)
+	}
+	if code := put("/objects/c.txt", "more than ten bytes", "X-API-Key", "acme-key"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over maxObjectBytes: %d, want 413", code)
+	}
+	if code := put("http://www.files.kzen.app/objects/c.txt", "hi"); code != http.StatusTeapot {
+		t.Errorf("no tenant: %d, want the default handler", code)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"/tenants/tenants/acme/a.txt", "/globex/b.txt"}
+	if len(puts) != len(want) || puts[0] != want[0] || puts[1] != want[1] {
+		t.Errorf("stored %v, want %v", puts, want)
+	}
+}
+
+func TestQuotaMiddleware_StorageBytes(t *testing.T) {
+	usage := &tenantUsage{}
+	usage.bytes.Store(90)
+	h := quotaMiddleware(TenantQuota{MaxStorageBytes: 100}, usage)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 64)
+		for {
+			if _, err := r.Body.Read(buf); err != nil {
+				break
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/objects/a", strings.NewReader("0123456789")))
+	if rec.Code != http.StatusCreated || usage.bytes.Load() != 100 {
+		t.Fatalf("upload within quota: %d, usage %d", rec.Code, usage.bytes.Load())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/objects/b", strings.NewReader("x")))
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("upload over quota: %d, want 507", rec.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package minioserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// byteRateLimiter is a token bucket refilled at rate bytes/sec, holding at most one second of tokens.
+type byteRateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newByteRateLimiter(bytesPerSec int64) *byteRateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &byteRateLimiter{rate: float64(bytesPerSec), tokens: float64(bytesPerSec), last: time.Now()}
+}
+
+// burst is the largest single reservation; writes are split into pieces no bigger than this.
+func (l *byteRateLimiter) burst() int {
+	return max(1, int(l.rate))
+}
+
+// wait blocks until n bytes (n <= burst) may be sent, or ctx is done.
+func (l *byteRateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledResponseWriter paces Write calls through every non-nil limiter, e.g. one per connection
+// plus one shared by all downloads, so a single large download can't starve the proxy's uplink.
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	limiters []*byteRateLimiter
+	chunk    int
+}
+
+func newThrottledResponseWriter(ctx context.Context, w http.ResponseWriter, limiters ...*byteRateLimiter) http.ResponseWriter {
+	var active []*byteRateLimiter
+	chunk := copyBufSize
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+			chunk = min(chunk, l.burst())
+		}
+	}
+	if len(active) == 0 {
+		return w
+	}
+	return &throttledResponseWriter{ResponseWriter: w, ctx: ctx, limiters: active, chunk: chunk}
+}
+
+func (t *throttledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), t.chunk)
+		for _, l := range t.limiters {
+			if err := l.wait(t.ctx, n); err != nil {
+				return written, err
+			}
+		}
+		m, err := t.ResponseWriter.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,36 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThrottledResponseWriter_PacesWrites(t *testing.T) {
+	rec := httptest.NewRecorder()
+	// 1000 B/s with a full 1000 B bucket: the first 1000 bytes are free, the next 500 wait ~0.5s.
+	w := newThrottledResponseWriter(context.Background(), rec, newByteRateLimiter(1000))
+
+	start := time.Now()
+	n, err := w.Write(bytes.Repeat([]byte("x"), 1500))
+	elapsed := time.Since(start)
+
+	if err != nil || n != 1500 {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if rec.Body.Len() != 1500 {
+		t.Errorf("got %d bytes written, want 1500", rec.Body.Len())
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("write took %v, want about 500ms", elapsed)
+	}
+}
+
+func TestThrottledResponseWriter_NoLimitersPassThrough(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if w := newThrottledResponseWriter(context.Background(), rec, nil, nil); w != rec {
+		t.Error("expected the original writer when no limits are configured")
+	}
+}
@@ -0,0 +1,226 @@
+package minioserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access tokens are short-lived, scoped credentials minted by POST /auth/token for a key, so a
+// browser never holds the key itself. They are stateless: "kzt1." + base64url(claims) + "." +
+// base64url(HMAC-SHA256), checked like a key (X-API-Key or Bearer) but only for their paths and
+// methods, and only while the key that minted them is valid.
+const accessTokenPrefix = "kzt1."
+
+const (
+	accessTokenDefaultTTL = 15 * time.Minute
+	accessTokenMaxTTL     = time.Hour
+)
+
+var (
+	errTokenScope = errors.New("access token not valid for this request")
+	// errTokenExchange rejects minting a token with a token.
+	errTokenExchange = errors.New("access tokens cannot mint tokens")
+)
+
+// accessTokenMethods are granted when a token request names no methods: reads and uploads.
+var accessTokenMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut}
+
+type accessTokenClaims struct {
+	Key     string   `json:"sub"` // name of the minting key
+	Expires int64    `json:"exp"` // unix seconds
+	Paths   []string `json:"paths"`
+	Methods []string `json:"methods"`
+}
+
+func (s *apiKeyStore) issueToken(c accessTokenClaims) string {
+	payload, _ := json.Marshal(c)
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return accessTokenPrefix + body + "." + base64.RawURLEncoding.EncodeToString(s.tokenMAC(body))
+}
+
+func (s *apiKeyStore) tokenMAC(body string) []byte {
+	mac := hmac.New(sha256.New, s.tokenSecret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
+
+// verifyToken returns the name of the key that minted token if the token is intact, unexpired,
+// covers r and the key is still valid.
+func (s *apiKeyStore) verifyToken(r *http.Request, token string, now time.Time) (string, error) {
+	c, err := s.validToken(token, now)
+	if err != nil {
+		return c.Key, err
+	}
+	if !slices.Contains(c.Methods, r.Method) || !tokenPathAllowed(c.Paths, originalURL(r).Path) {
+		return c.Key, errTokenScope
+	}
+	return c.Key, nil
+}
+
+// validToken returns the claims of token if it is intact, unexpired and its key is still valid,
+// whatever it grants.
+func (s *apiKeyStore) validToken(token string, now time.Time) (accessTokenClaims, error) {
+	c, err := s.parseToken(token)
+	if err != nil {
+		return c, err
+	}
+	if now.Unix() >= c.Expires {
+		return c, errAPIKeyExpired
+	}
+	// A rotated-out or expired key takes its tokens with it.
+	if _, err := s.byName(c.Key, now); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// parseToken returns the claims of token if it was signed by s.
+func (s *apiKeyStore) parseToken(token string) (accessTokenClaims, error) {
+	var c accessTokenClaims
+	body, sig, ok := strings.Cut(strings.TrimPrefix(token, accessTokenPrefix), ".")
+	if !ok || len(s.tokenSecret) == 0 {
+		return c, errAPIKeyInvalid
+	}
+	gotMAC, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotMAC, s.tokenMAC(body)) {
+		return c, errAPIKeyInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return c, errAPIKeyInvalid
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, errAPIKeyInvalid
+	}
+	return c, nil
+}
+
+// tokenPathAllowed reports whether p is one of paths or below one of them: a granted
+// "/objects/users/42" covers "/objects/users/42/a.png" but not "/objects/users/420/a.png". A path
+// ending in "/" (or "") covers everything below it. Paths with dot segments are refused rather
+// than cleaned, so they can't climb out of a granted prefix.
+func tokenPathAllowed(paths []string, p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." || seg == "." {
+			return false
+		}
+	}
+	for _, prefix := range paths {
+		if p == prefix || (prefix == "" || strings.HasSuffix(prefix, "/")) && strings.HasPrefix(p, prefix) ||
+			strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isAccessToken(key string) bool {
+	return strings.HasPrefix(key, accessTokenPrefix)
+}
+
+// viaToken reports whether r authenticates with an access token, in a header or the auth cookie.
+func (s *apiKeyStore) viaToken(r *http.Request) bool {
+	return isAccessToken(requestAPIKey(r)) || s.cookieToken(r) != ""
+}
+
+var (
+	randomTokenSecretOnce sync.Once
+	randomTokenSecret     []byte
+)
+
+// accessTokenSecret returns the signing secret of a key set: derived from cfg.AccessTokenSecret
+// and scope (so tokens of one tenant are not valid for another), or from a random per-process
+// secret when none is configured.
+func accessTokenSecret(cfg Config, scope string) []byte {
+	base := []byte(cfg.AccessTokenSecret)
+	if len(base) == 0 {
+		randomTokenSecretOnce.Do(func() {
+			randomTokenSecret = make([]byte, 32)
+			rand.Read(randomTokenSecret)
+			log.Printf("ACCESS_TOKEN_SECRET not set: access tokens are valid only on this instance until it restarts")
+		})
+		base = randomTokenSecret
+	}
+	mac := hmac.New(sha256.New, base)
+	mac.Write([]byte("kzen access token " + scope))
+	return mac.Sum(nil)
+}
+
+type tokenRequest struct {
+	Paths     []string `json:"paths"`
+	Methods   []string `json:"methods"`
+	ExpiresIn int      `json:"expiresIn"` // seconds
+}
+
+// tokenHandler serves POST /auth/token: the caller, authenticated with a key by the API key
+// middleware, gets a token for the given paths and methods that expires after expiresIn
+// seconds (default 15m, at most maxTTL).
+func tokenHandler(keys *apiKeyStore, maxTTL time.Duration) http.HandlerFunc {
+	if maxTTL <= 0 {
+		maxTTL = accessTokenMaxTTL
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if keys.viaToken(r) {
+			respondError(w, errTokenExchange.Error(), http.StatusForbidden)
+			return
+		}
+		name := apiKeyName(r.Context())
+		if name == "" {
+			respondUnauthorized(w)
+			return
+		}
+		var req tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Paths) == 0 {
+			respondError(w, "paths required", http.StatusBadRequest)
+			return
+		}
+		for _, p := range req.Paths {
+			if !strings.HasPrefix(p, "/") || !tokenPathAllowed([]string{"/"}, p) {
+				respondError(w, "paths must be absolute, without dot segments: "+p, http.StatusBadRequest)
+				return
+			}
+		}
+		methods := accessTokenMethods
+		if len(req.Methods) > 0 {
+			methods = make([]string, len(req.Methods))
+			for i, m := range req.Methods {
+				methods[i] = strings.ToUpper(m)
+			}
+		}
+		ttl := accessTokenDefaultTTL
+		if req.ExpiresIn > 0 {
+			ttl = time.Duration(req.ExpiresIn) * time.Second
+		}
+		ttl = min(ttl, maxTTL)
+		expires := time.Now().Add(ttl).Truncate(time.Second)
+		token := keys.issueToken(accessTokenClaims{Key: name, Expires: expires.Unix(), Paths: req.Paths, Methods: methods})
+		metrics.add("kzen_access_tokens_issued_total", 1, "key", name)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{
+			"token":     token,
+			"expiresAt": expires.UTC(),
+			"paths":     req.Paths,
+			"methods":   methods,
+		})
+	}
+}
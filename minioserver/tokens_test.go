@@ -0,0 +1,111 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessTokens(t *testing.T) {
+	keys := newAPIKeyStore([]APIKey{{Name: "backend", Key: "secret", Admin: true}})
+	keys.tokenSecret = accessTokenSecret(Config{AccessTokenSecret: "s"}, "")
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/token", tokenHandler(keys, time.Hour))
+	mux.HandleFunc("/admin/policy", requireAdminKey(keys, ok))
+	mux.Handle("/", ok)
+	h := apiKeyMiddleware(keys)(mux)
+
+	do := func(method, target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/auth/token", "secret", `{"paths":["/objects/users/42/"],"methods":["put"],"expiresIn":99999}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token exchange: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if !strings.HasPrefix(resp.Token, accessTokenPrefix) || time.Until(resp.ExpiresAt) > time.Hour {
+		t.Fatalf("response = %+v, want a token capped at an hour", resp)
+	}
+
+	for _, c := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodPut, "/objects/users/42/a.png", http.StatusOK},
+		{http.MethodPut, "/objects/users/43/a.png", http.StatusUnauthorized},
+		{http.MethodPut, "/objects/users/420/a.png", http.StatusUnauthorized},
+		{http.MethodPut, "/objects/users/42/../43/a.png", http.StatusUnauthorized},
+		{http.MethodDelete, "/objects/users/42/a.png", http.StatusUnauthorized},
+		{http.MethodPost, "/auth/token", http.StatusUnauthorized},
+	} {
+		if rec := do(c.method, c.target, resp.Token, `{"paths":["/"]}`); rec.Code != c.want {
+			t.Errorf("%s %s with token: %d, want %d", c.method, c.target, rec.Code, c.want)
+		}
+	}
+
+	// Even a token for everything minted by an admin key is no admin credential.
+	rec = do(http.MethodPost, "/auth/token", "secret", `{"paths":["/"],"methods":["GET","POST"]}`)
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec := do(http.MethodGet, "/admin/policy", resp.Token, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("admin endpoint with token: %d, want 403", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/auth/token", resp.Token, `{"paths":["/"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("token exchange with token: %d, want 403", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/auth/token", "secret", `{"paths":["objects/"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("relative path: %d, want 400", rec.Code)
+	}
+
+	// Another key set (e.g. another tenant) doesn't accept the token.
+	other := newAPIKeyStore([]APIKey{{Name: "backend", Key: "other"}})
+	other.tokenSecret = accessTokenSecret(Config{AccessTokenSecret: "s"}, "tenant acme")
+	req := httptest.NewRequest(http.MethodPut, "/objects/users/42/a.png", nil)
+	if _, err := other.verifyToken(req, resp.Token, time.Now()); err == nil {
+		t.Error("token accepted by another key set")
+	}
+
+	// Removing the minting key revokes its tokens.
+	keys.set(nil)
+	if rec := do(http.MethodPut, "/objects/users/42/a.png", resp.Token, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token of a removed key: %d, want 401", rec.Code)
+	}
+}
+
+func TestTokenPathAllowed(t *testing.T) {
+	for _, c := range []struct {
+		paths []string
+		p     string
+		want  bool
+	}{
+		{[]string{"/objects/users/42"}, "/objects/users/42", true},
+		{[]string{"/objects/users/42"}, "/objects/users/42/a.png", true},
+		{[]string{"/objects/users/42"}, "/objects/users/420", false},
+		{[]string{"/objects/users/42"}, "/objects/users/420/a.png", false},
+		{[]string{"/objects/users/42/"}, "/objects/users/42/a.png", true},
+		{[]string{"/objects/users/42/"}, "/objects/users/420/a.png", false},
+		{[]string{"/"}, "/objects/a.png", true},
+		{[]string{""}, "boards/7/", true},
+		{[]string{""}, "boards/../secrets/", false},
+		{[]string{"/objects/"}, "/objects/./a.png", false},
+	} {
+		if got := tokenPathAllowed(c.paths, c.p); got != c.want {
+			t.Errorf("tokenPathAllowed(%q, %q) = %t, want %t", c.paths, c.p, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package minioserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// transportStats tracks per-host connection counts for the MinIO client transport. Open conns are
+// counted at dial/close; in-flight requests from RoundTrip until the response body is closed.
+// With HTTP/1.1 every in-flight request holds one conn, so open - inflight approximates the idle pool.
+type transportStats struct {
+	mu       sync.Mutex
+	open     map[string]*atomic.Int64
+	inflight map[string]*atomic.Int64
+}
+
+func newTransportStats() *transportStats {
+	return &transportStats{open: make(map[string]*atomic.Int64), inflight: make(map[string]*atomic.Int64)}
+}
+
+func (s *transportStats) counter(m map[string]*atomic.Int64, host string) *atomic.Int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := m[host]
+	if !ok {
+		c = new(atomic.Int64)
+		m[host] = c
+	}
+	return c
+}
+
+func (s *transportStats) snapshot(m map[string]*atomic.Int64) map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]float64, len(m))
+	for host, c := range m {
+		out[labelString([]string{"host", host})] = float64(c.Load())
+	}
+	return out
+}
+
+func (s *transportStats) idle() map[string]float64 {
+	open := s.snapshot(s.open)
+	inflight := s.snapshot(s.inflight)
+	for l, n := range open {
+		open[l] = max(0, n-inflight[l])
+	}
+	return open
+}
+
+// countedConn decrements the host's open gauge once on Close.
+type countedConn struct {
+	net.Conn
+	open *atomic.Int64
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// instrumentTransport wraps t's dialer to count open conns per host and returns a RoundTripper that
+// records httptrace timings (DNS, connect, TLS handshake, conn reuse) into reg.
+func instrumentTransport(t *http.Transport, reg *metricsRegistry) http.RoundTripper {
+	stats := newTransportStats()
+
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			reg.add("kzen_minio_dial_errors_total", 1, "host", addr)
+			return nil, err
+		}
+		open := stats.counter(stats.open, addr)
+		open.Add(1)
+		return &countedConn{Conn: conn, open: open}, nil
+	}
+
+	reg.describe("kzen_minio_conns_open", "gauge", "Open TCP connections to MinIO per host.")
+	reg.describe("kzen_minio_requests_inflight", "gauge", "MinIO requests whose response body is not yet closed.")
+	reg.describe("kzen_minio_conns_idle", "gauge", "Approximate idle pooled connections per host (open - in-flight).")
+	reg.describe("kzen_minio_max_idle_conns_per_host", "gauge", "Configured Transport.MaxIdleConnsPerHost.")
+	reg.describe("kzen_minio_dial_errors_total", "counter", "Failed dials to MinIO.")
+	reg.describe("kzen_minio_conns_total", "counter", "Connections obtained for MinIO requests, by reused=true|false.")
+	reg.describe("kzen_minio_conn_idle_seconds", "summary", "Time a reused connection sat idle in the pool.")
+	reg.describe("kzen_minio_dns_seconds", "summary", "DNS lookup duration.")
+	reg.describe("kzen_minio_connect_seconds", "summary", "TCP connect duration.")
+	reg.describe("kzen_minio_tls_handshake_seconds", "summary", "TLS handshake duration.")
+	reg.gaugeFunc("kzen_minio_conns_open", func() map[string]float64 { return stats.snapshot(stats.open) })
+	reg.gaugeFunc("kzen_minio_requests_inflight", func() map[string]float64 { return stats.snapshot(stats.inflight) })
+	reg.gaugeFunc("kzen_minio_conns_idle", stats.idle)
+	reg.set("kzen_minio_max_idle_conns_per_host", float64(t.MaxIdleConnsPerHost))
+
+	return &tracingTransport{base: t, stats: stats, reg: reg}
+}
+
+type tracingTransport struct {
+	base  http.RoundTripper
+	stats *transportStats
+	reg   *metricsRegistry
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		if req.URL.Scheme == "https" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace(host)))
+
+	inflight := t.stats.counter(t.stats.inflight, host)
+	inflight.Add(1)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		inflight.Add(-1)
+		return nil, err
+	}
+	resp.Body = &inflightBody{ReadCloser: resp.Body, inflight: inflight}
+	return resp, nil
+}
+
+// clientTrace observes the connection setup of one request to host. A dial may try several
+// addresses at once (Happy Eyeballs), whose ConnectStart/ConnectDone run on their own
+// goroutines, so connect start times are kept per address behind a lock.
+func (t *tracingTransport) clientTrace(host string) *httptrace.ClientTrace {
+	var dnsStart, tlsStart time.Time
+	var mu sync.Mutex
+	connectStart := map[string]time.Time{}
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused := "false"
+			if info.Reused {
+				reused = "true"
+			}
+			t.reg.add("kzen_minio_conns_total", 1, "host", host, "reused", reused)
+			if info.WasIdle {
+				t.reg.observe("kzen_minio_conn_idle_seconds", info.IdleTime.Seconds(), "host", host)
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.reg.observe("kzen_minio_dns_seconds", time.Since(dnsStart).Seconds(), "host", host)
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			connectStart[network+" "+addr] = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			start, ok := connectStart[network+" "+addr]
+			delete(connectStart, network+" "+addr)
+			mu.Unlock()
+			if err == nil && ok {
+				t.reg.observe("kzen_minio_connect_seconds", time.Since(start).Seconds(), "host", host)
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				t.reg.observe("kzen_minio_tls_handshake_seconds", time.Since(tlsStart).Seconds(), "host", host)
+			}
+		},
+	}
+}
+
+// inflightBody releases the in-flight count when the caller closes the response body.
+type inflightBody struct {
+	io.ReadCloser
+	inflight *atomic.Int64
+	once     sync.Once
+}
+
+func (b *inflightBody) Close() error {
+	b.once.Do(func() { b.inflight.Add(-1) })
+	return b.ReadCloser.Close()
+}
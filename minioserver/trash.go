@@ -0,0 +1,273 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+func init() {
+	metrics.describe("kzen_trash_total", "counter", "Objects moved to and restored from the trash, by action (deleted|restored).")
+}
+
+// trashPrefix holds objects deleted with soft delete on (Config.SoftDelete), each under
+// trash/<key>~<deletion time in Unix nanoseconds>, so deleting a key again keeps both copies.
+// Object routes don't serve it; GET /trash lists it and POST /trash/restore moves objects back.
+// Nothing purges it: give the bucket a lifecycle rule expiring trash/ (see /admin/lifecycle).
+const trashPrefix = "trash/"
+
+// User metadata of trashed objects.
+const (
+	trashMetaKey  = "Trash-Key"
+	trashMetaTime = "Trash-Time"
+	trashMetaBy   = "Trash-By"
+)
+
+// isTrashKey reports whether key is inside the trash prefix.
+func isTrashKey(key string) bool {
+	return strings.HasPrefix(key, trashPrefix)
+}
+
+// trashKeyFor returns the key key is trashed under when deleted at t.
+func trashKeyFor(key string, t time.Time) string {
+	return trashPrefix + key + "~" + strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// parseTrashKey returns the original key and deletion time of a trash key.
+func parseTrashKey(trashKey string) (key string, deletedAt time.Time, ok bool) {
+	rest, found := strings.CutPrefix(trashKey, trashPrefix)
+	if !found {
+		return "", time.Time{}, false
+	}
+	i := strings.LastIndex(rest, "~")
+	if i <= 0 {
+		return "", time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(rest[i+1:], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return rest[:i], time.Unix(0, nanos).UTC(), true
+}
+
+// trashObject moves the object described by info (from a stat) to the trash, recording who
+// deleted it, and returns its trash key.
+func trashObject(ctx context.Context, client quarantineClient, bucket string, info minio.ObjectInfo, by string) (string, error) {
+	now := time.Now().UTC()
+	trashKey := trashKeyFor(info.Key, now)
+	meta := map[string]string{}
+	for k, v := range info.UserMetadata {
+		meta[k] = v
+	}
+	if info.ContentType != "" {
+		meta["Content-Type"] = info.ContentType
+	}
+	meta[trashMetaKey] = info.Key
+	meta[trashMetaTime] = now.Format(time.RFC3339Nano)
+	meta[trashMetaBy] = by
+	_, err := client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucket, Object: trashKey, UserMetadata: meta, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: bucket, Object: info.Key})
+	if err != nil {
+		return "", err
+	}
+	if err := client.RemoveObject(ctx, bucket, info.Key, minio.RemoveObjectOptions{}); err != nil {
+		// The copy stays in the trash; restoring it is harmless.
+		return "", err
+	}
+	log.Printf("trash: %s/%s -> %s by %q", bucket, info.Key, trashKey, by)
+	metrics.add("kzen_trash_total", 1, "action", "deleted")
+	return trashKey, nil
+}
+
+// trashedObject is an entry of GET /trash.
+type trashedObject struct {
+	Key          string    `json:"key"` // original key, where restore puts it
+	TrashKey     string    `json:"trashKey"`
+	DeletedAt    time.Time `json:"deletedAt"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// trashListMax bounds GET /trash; narrow it with ?prefix=.
+const trashListMax = 1000
+
+// trashRestoreMaxKeys bounds POST /trash/restore.
+const trashRestoreMaxKeys = 1000
+
+// trashHandler serves the trash of defaultBucket (or the bucket asked for, one of buckets):
+//
+//	GET  /trash?prefix=   list trashed objects whose original key starts with prefix, newest first
+//	POST /trash/restore   move {"keys": [trash keys]} back to their original keys
+//
+// Restore refuses (409) to overwrite an object written since the delete unless "overwrite" is
+// true. opts.changed is told about restored keys.
+func trashHandler(client quarantineClient, defaultBucket string, buckets []string, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		restore := strings.HasSuffix(r.URL.Path, "/restore")
+		switch {
+		case r.Method == http.MethodGet && !restore:
+			listTrash(client, defaultBucket, buckets, w, r)
+		case r.Method == http.MethodPost && restore:
+			restoreTrash(client, defaultBucket, buckets, opts, w, r)
+		default:
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func listTrash(client quarantineClient, defaultBucket string, buckets []string, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	bucket := q.Get("bucket")
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+	if !slices.Contains(buckets, bucket) {
+		respondError(w, "unknown bucket", http.StatusBadRequest)
+		return
+	}
+	prefix := strings.TrimPrefix(q.Get("prefix"), "/")
+
+	ctx, cancel := golib.RequestContext(r, 60*time.Second)
+	defer cancel()
+
+	items := []trashedObject{}
+	truncated := false
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: trashPrefix + prefix, Recursive: true}) {
+		if obj.Err != nil {
+			respondStorageError(w, obj.Err, "failed to list trash")
+			return
+		}
+		key, deletedAt, ok := parseTrashKey(obj.Key)
+		if !ok {
+			continue
+		}
+		if len(items) == trashListMax {
+			truncated = true
+			break
+		}
+		items = append(items, trashedObject{Key: key, TrashKey: obj.Key, DeletedAt: deletedAt, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	slices.SortStableFunc(items, func(a, b trashedObject) int { return b.DeletedAt.Compare(a.DeletedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "prefix": prefix, "objects": items, "truncated": truncated})
+}
+
+func restoreTrash(client quarantineClient, defaultBucket string, buckets []string, opts proxyOptions, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Bucket    string   `json:"bucket"`
+		Keys      []string `json:"keys"`
+		Overwrite bool     `json:"overwrite"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || len(req.Keys) == 0 {
+		respondError(w, `body must be {"keys": ["trash/..."]}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Keys) > trashRestoreMaxKeys {
+		respondError(w, "too many keys", http.StatusBadRequest)
+		return
+	}
+	if req.Bucket == "" {
+		req.Bucket = defaultBucket
+	}
+	if !slices.Contains(buckets, req.Bucket) {
+		respondError(w, "unknown bucket", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := golib.RequestContext(r, 60*time.Second)
+	defer cancel()
+
+	type restoreResult struct {
+		TrashKey string `json:"trashKey"`
+		Key      string `json:"key,omitempty"`
+		OK       bool   `json:"ok"`
+		Err      string `json:"error,omitempty"`
+		Status   int    `json:"status,omitempty"`
+	}
+	by := apiKeyName(r.Context())
+	// One at a time, in request order: two trash keys may restore to the same key.
+	results := make([]restoreResult, 0, len(req.Keys))
+	for _, trashKey := range req.Keys {
+		trashKey = strings.TrimPrefix(trashKey, "/")
+		key, status, err := restoreTrashed(ctx, client, req.Bucket, trashKey, req.Overwrite, opts)
+		if err != nil {
+			results = append(results, restoreResult{TrashKey: trashKey, Key: key, Err: err.Error(), Status: status})
+			continue
+		}
+		opts.changed(req.Bucket, key)
+		log.Printf("trash: restored %s/%s to %s by %q", req.Bucket, trashKey, key, by)
+		metrics.add("kzen_trash_total", 1, "action", "restored")
+		results = append(results, restoreResult{TrashKey: trashKey, Key: key, OK: true})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"bucket": req.Bucket, "restored": results})
+}
+
+// restoreError is a restore failure with the HTTP status reported for it.
+type restoreError string
+
+func (e restoreError) Error() string { return string(e) }
+
+// restoreTrashed copies trashKey back to its original key without the trash metadata and removes
+// it from the trash. It returns the original key, and on failure the status to report. Overwriting
+// an object needs the request's key to own it (see mayModify).
+func restoreTrashed(ctx context.Context, client quarantineClient, bucket, trashKey string, overwrite bool, opts proxyOptions) (string, int, error) {
+	key, _, ok := parseTrashKey(trashKey)
+	if !ok {
+		return "", http.StatusBadRequest, restoreError("not a trash key")
+	}
+	info, err := client.StatObject(ctx, bucket, trashKey, minio.StatObjectOptions{})
+	if err != nil {
+		if golib.IsNotFound(err) {
+			return key, http.StatusNotFound, restoreError("not in trash")
+		}
+		return key, golib.MinioStatus(err), err
+	}
+	if k := info.UserMetadata[trashMetaKey]; k != "" {
+		key = k
+	}
+	existing, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	switch {
+	case err == nil && !overwrite:
+		return key, http.StatusConflict, restoreError("object exists; restore with overwrite")
+	case err == nil:
+		if err := opts.mayModify(ctx, existing); err != nil {
+			return key, http.StatusForbidden, err
+		}
+	case !golib.IsNotFound(err):
+		return key, golib.MinioStatus(err), err
+	}
+
+	meta := map[string]string{}
+	for k, v := range info.UserMetadata {
+		if !strings.HasPrefix(k, "Trash-") {
+			meta[k] = v
+		}
+	}
+	if info.ContentType != "" {
+		meta["Content-Type"] = info.ContentType
+	}
+	_, err = client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucket, Object: key, UserMetadata: meta, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: bucket, Object: trashKey})
+	if err != nil {
+		return key, golib.MinioStatus(err), err
+	}
+	if err := client.RemoveObject(ctx, bucket, trashKey, minio.RemoveObjectOptions{}); err != nil {
+		return key, golib.MinioStatus(err), err
+	}
+	return key, 0, nil
+}
@@ -0,0 +1,102 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestParseTrashKey(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	key, deletedAt, ok := parseTrashKey(trashKeyFor("a/b~c.jpg", at))
+	if !ok || key != "a/b~c.jpg" || !deletedAt.Equal(at) {
+		t.Errorf("parseTrashKey = %q %v %v", key, deletedAt, ok)
+	}
+	for _, bad := range []string{"a.jpg~1", "trash/a.jpg", "trash/~1", "trash/a.jpg~x"} {
+		if _, _, ok := parseTrashKey(bad); ok {
+			t.Errorf("parseTrashKey(%q) ok", bad)
+		}
+	}
+}
+
+func TestProxyDelete_SoftDelete(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["a.jpg"] = []byte("jpeg")
+	h := objectsHandlerWithPrefix(client, "files", "/objects/", proxyOptions{SoftDelete: true})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/objects/a.jpg", nil))
+	var resp struct {
+		Existed  bool   `json:"existed"`
+		TrashKey string `json:"trashKey"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || !resp.Existed || !strings.HasPrefix(resp.TrashKey, "trash/a.jpg~") {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := objects["a.jpg"]; ok || string(objects[resp.TrashKey]) != "jpeg" {
+		t.Errorf("objects = %v", objects)
+	}
+
+	// Trashed objects are not reachable through object routes.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/objects/"+resp.TrashKey, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET trash key: %d", rec.Code)
+	}
+}
+
+func TestTrashHandler(t *testing.T) {
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeQuarantineClient{objects: map[string]minio.ObjectInfo{}}
+	for key, at := range map[string]time.Time{"docs/a.pdf": old, "docs/b.pdf": old.Add(time.Hour), "img/c.jpg": old} {
+		tk := trashKeyFor(key, at)
+		client.objects[tk] = minio.ObjectInfo{Key: tk, UserMetadata: map[string]string{trashMetaKey: key, "Original-Name": key}}
+	}
+	client.objects["docs/b.pdf"] = minio.ObjectInfo{Key: "docs/b.pdf"} // written again since
+	h := trashHandler(client, "files", []string{"files"}, proxyOptions{})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/trash?prefix=docs/", "")
+	var list struct {
+		Objects []trashedObject `json:"objects"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if rec.Code != http.StatusOK || len(list.Objects) != 2 || list.Objects[0].Key != "docs/b.pdf" || list.Objects[1].Key != "docs/a.pdf" {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body.String())
+	}
+
+	a, b := list.Objects[1].TrashKey, list.Objects[0].TrashKey
+	rec = do(http.MethodPost, "/trash/restore", `{"keys": ["`+a+`", "`+b+`", "trash/gone~1"]}`)
+	var restored struct {
+		Restored []struct {
+			Key    string `json:"key"`
+			OK     bool   `json:"ok"`
+			Status int    `json:"status"`
+		} `json:"restored"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &restored)
+	if r := restored.Restored; rec.Code != http.StatusOK || len(r) != 3 ||
+		!r[0].OK || r[1].Status != http.StatusConflict || r[2].Status != http.StatusNotFound {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := client.objects[a]; ok || client.copied.Object != "docs/a.pdf" || client.copied.UserMetadata[trashMetaKey] != "" || client.copied.UserMetadata["Original-Name"] != "docs/a.pdf" {
+		t.Errorf("restore of a: %+v", client.copied)
+	}
+
+	if rec := do(http.MethodPost, "/trash/restore", `{"keys": ["`+b+`"], "overwrite": true}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok":true`) {
+		t.Errorf("overwrite: %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/trash?bucket=other", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("other bucket: %d", rec.Code)
+	}
+}
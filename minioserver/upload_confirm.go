@@ -0,0 +1,201 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// uploadConfirmedMeta marks an object POST /uploads/confirm has processed, so a second confirm
+// doesn't run the processors over their own output.
+const uploadConfirmedMeta = "Upload-Confirmed"
+
+type uploadConfirmRequest struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// ETag, when given, must match the stored object, so a confirm can't pick up another upload.
+	ETag string `json:"etag"`
+}
+
+// uploadEvent is the payload of the "uploaded" webhook event, for proxied and direct uploads alike.
+func uploadEvent(bucket string, info minio.ObjectInfo, contentType, apiKey, via string) map[string]any {
+	return map[string]any{
+		"bucket":      bucket,
+		"key":         info.Key,
+		"size":        info.Size,
+		"etag":        info.ETag,
+		"contentType": contentType,
+		"apiKey":      apiKey,
+		"via":         via,
+	}
+}
+
+// uploadConfirmHandler serves POST /uploads/confirm: a client that uploaded straight to MinIO
+// (a presigned URL or /upload-policy) reports the key, and the object gets what a proxied upload
+// would have: the processors of the bucket's objects mount (processors, keyed by bucket), the
+// quarantine, byte accounting, cache purges and the "uploaded" webhook event. Processed objects
+// are rewritten in place, guarded by their ETag. Images are then queued for images, the image
+// pipeline, unless it is nil.
+func uploadConfirmHandler(client *minio.Client, defaultBucket string, buckets []string, processors map[string][]ProcessorFunc, images *directImages, opts proxyOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req uploadConfirmRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+			respondError(w, `body must be {"key": "..."}`, http.StatusBadRequest)
+			return
+		}
+		if req.Bucket == "" {
+			req.Bucket = defaultBucket
+		}
+		if !slices.Contains(buckets, req.Bucket) {
+			respondError(w, "unknown bucket", http.StatusBadRequest)
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimSpace(req.Key), "/")
+		if key == "" || strings.HasSuffix(key, "/") || hiddenKey(opts, req.Bucket, key) {
+			respondError(w, "invalid key", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 5*time.Minute)
+		defer cancel()
+
+		info, err := client.StatObject(ctx, req.Bucket, key, minio.StatObjectOptions{})
+		if golib.IsNotFound(err) {
+			respondErrorCode(w, "object not found; upload it before confirming", "not_found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			respondStorageError(w, err, "failed to get object info")
+			return
+		}
+		if etag := strings.Trim(req.ETag, `"`); etag != "" && etag != info.ETag {
+			respondErrorCode(w, "object changed since the upload", "etag_mismatch", http.StatusConflict)
+			return
+		}
+		if err := opts.mayModify(ctx, info); err != nil {
+			respondOwnerError(w, err)
+			return
+		}
+		by := apiKeyName(r.Context())
+
+		processed := false
+		confirmed := info.UserMetadata[uploadConfirmedMeta] != ""
+		if procs := processors[req.Bucket]; len(procs) > 0 && !confirmed {
+			next, quarantineKey, err := processConfirmedUpload(ctx, client, req.Bucket, info, procs, opts, by)
+			if quarantineKey != "" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]any{"ok": false, "quarantined": true, "key": key, "quarantineKey": quarantineKey})
+				return
+			}
+			if err != nil {
+				var procErr *processorError
+				if errors.As(err, &procErr) || errors.Is(err, errUploadTooLarge) {
+					respondProcessorError(w, key, err)
+					return
+				}
+				if errors.Is(err, golib.ErrSaturated) {
+					respondUploadBusy(w, opts.UploadSlots, err)
+					return
+				}
+				log.Printf("confirm upload %s/%s: %v", req.Bucket, key, err)
+				respondStorageError(w, err, "failed to process upload")
+				return
+			}
+			info, processed = next, true
+		}
+
+		imageProcessing := ""
+		if !confirmed && images.wants(info) {
+			imageProcessing = "queued"
+			if !images.enqueue(req.Bucket, info) {
+				imageProcessing = "busy"
+			}
+		}
+
+		opts.ByteStats.addIn(req.Bucket, key, info.Size)
+		opts.changed(req.Bucket, key)
+		opts.UploadWebhook.send("uploaded", uploadEvent(req.Bucket, info, info.ContentType, by, "direct"))
+		metrics.add("kzen_uploads_confirmed_total", 1, "bucket", req.Bucket)
+
+		w.Header().Set("Content-Type", "application/json")
+		resp := map[string]any{
+			"ok":          true,
+			"bucket":      req.Bucket,
+			"key":         key,
+			"size":        info.Size,
+			"etag":        info.ETag,
+			"contentType": info.ContentType,
+			"processed":   processed,
+		}
+		if imageProcessing != "" {
+			resp["imageProcessing"] = imageProcessing
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// processConfirmedUpload runs procs over the object info describes and stores the result under
+// the same key, if it is still the object that was read. A quarantined upload is moved to the
+// quarantine and its key returned.
+func processConfirmedUpload(ctx context.Context, client *minio.Client, bucket string, info minio.ObjectInfo, procs []ProcessorFunc, opts proxyOptions, by string) (minio.ObjectInfo, string, error) {
+	obj, err := client.GetObject(ctx, bucket, info.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return info, "", err
+	}
+	defer obj.Close()
+	u := &Upload{Bucket: bucket, Key: info.Key, ContentType: info.ContentType, Metadata: maps.Clone(info.UserMetadata)}
+	if u.Metadata == nil {
+		u.Metadata = map[string]string{}
+	}
+	data, err := runProcessors(ctx, procs, u, obj, opts.Multipart.MaxFileBytes)
+	var q *quarantineError
+	if errors.As(err, &q) {
+		qKey, err := quarantineUpload(ctx, client, u, data, q, opts.QuarantineWebhook, by)
+		if err != nil {
+			return info, "", err
+		}
+		if err := client.RemoveObject(ctx, bucket, info.Key, minio.RemoveObjectOptions{}); err != nil {
+			return info, "", err
+		}
+		opts.changed(bucket, info.Key)
+		return info, qKey, nil
+	}
+	if err != nil {
+		return info, "", err
+	}
+
+	u.Metadata[uploadConfirmedMeta] = time.Now().UTC().Format(time.RFC3339)
+	putOpts := minio.PutObjectOptions{ContentType: u.ContentType, UserMetadata: u.Metadata}
+	putOpts.SetMatchETag(info.ETag)
+	if err := opts.UploadSlots.Acquire(ctx); err != nil {
+		return info, "", err
+	}
+	defer opts.UploadSlots.Release()
+	uploaded, err := client.PutObject(ctx, bucket, info.Key, bytes.NewReader(data), int64(len(data)), putOpts)
+	if err != nil {
+		return info, "", err
+	}
+	info.Size, info.ETag, info.ContentType = uploaded.Size, uploaded.ETag, u.ContentType
+	return info, "", nil
+}
+
+func init() {
+	metrics.describe("kzen_uploads_confirmed_total", "counter", "Direct uploads confirmed with POST /uploads/confirm, by bucket.")
+}
@@ -0,0 +1,55 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestUploadConfirmHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["direct/a.txt"] = []byte("hello")
+	upper := func(_ context.Context, u *Upload, data []byte) ([]byte, error) {
+		u.Metadata["Checked"] = "yes"
+		return bytes.ToUpper(data), nil
+	}
+	h := uploadConfirmHandler(client, "files", []string{"files"}, map[string][]ProcessorFunc{"files": {upper}}, nil, proxyOptions{})
+	confirm := func(body string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/uploads/confirm", strings.NewReader(body)))
+		var resp map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := confirm(`{"key":"direct/a.txt","etag":"\"abc\""}`)
+	if code != http.StatusOK || resp["processed"] != true || string(objects["direct/a.txt"]) != "HELLO" {
+		t.Fatalf("confirm: %d %v, stored %q", code, resp, objects["direct/a.txt"])
+	}
+	info, err := client.StatObject(t.Context(), "files", "direct/a.txt", minio.StatObjectOptions{})
+	if err != nil || info.UserMetadata["Checked"] != "yes" || info.UserMetadata[uploadConfirmedMeta] == "" {
+		t.Errorf("metadata %v, %v", info.UserMetadata, err)
+	}
+	if code, resp := confirm(`{"key":"direct/a.txt"}`); code != http.StatusOK || resp["processed"] != false || string(objects["direct/a.txt"]) != "HELLO" {
+		t.Errorf("second confirm: %d %v", code, resp)
+	}
+
+	if code, _ := confirm(`{"key":"direct/missing.txt"}`); code != http.StatusNotFound {
+		t.Errorf("missing object: %d, want 404", code)
+	}
+	if code, _ := confirm(`{"key":"direct/a.txt","etag":"other"}`); code != http.StatusConflict {
+		t.Errorf("etag mismatch: %d, want 409", code)
+	}
+	if code, _ := confirm(`{"key":"trash/a.txt"}`); code != http.StatusBadRequest {
+		t.Errorf("trash key: %d, want 400", code)
+	}
+	if code, _ := confirm(`{"bucket":"other","key":"direct/a.txt"}`); code != http.StatusBadRequest {
+		t.Errorf("unknown bucket: %d, want 400", code)
+	}
+}
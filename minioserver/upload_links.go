@@ -0,0 +1,331 @@
+package minioserver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+// Upload links let a client without a key store files under one key prefix, e.g. a guest adding a
+// photo to a shared board. POST /upload-links mints one for the caller's key; like access tokens
+// they are stateless, "kzl1." + base64url(claims) + "." + base64url(HMAC-SHA256), and die with
+// the key that minted them.
+//
+// Spent single-use links are kept in the nonce cache, so like signature nonces they are
+// remembered per process: after a restart, or on another replica, a link can be used once more.
+const uploadLinkPrefix = "kzl1."
+
+const (
+	uploadLinkDefaultTTL = 24 * time.Hour
+	// uploadLinkMaxBytes caps (and is the default of) the size a link allows.
+	uploadLinkMaxBytes = 100 << 20
+	// uploadLinkSniffBytes are read to detect the content type of an upload.
+	uploadLinkSniffBytes = 512
+)
+
+// uploadLinkDefaultTypes are the types a link minted without contentTypes accepts: media that
+// browsers never run as a page, so a guest can't plant HTML or scripts under the bucket's origin.
+var uploadLinkDefaultTypes = []string{"image/*", "video/*", "audio/*", "application/pdf"}
+
+var (
+	errUploadLinkUsed = errors.New("upload link already used")
+	errUploadLinkType = errors.New("content type not allowed by this upload link")
+)
+
+// uploadLinkClaims is what an upload link grants.
+type uploadLinkClaims struct {
+	ID           string   `json:"jti"`
+	Key          string   `json:"sub"` // name of the minting key
+	Expires      int64    `json:"exp"` // unix seconds
+	Prefix       string   `json:"prefix"`
+	MaxBytes     int64    `json:"maxBytes"`
+	ContentTypes []string `json:"contentTypes,omitempty"` // "image/*" matches any image type
+	SingleUse    bool     `json:"singleUse,omitempty"`
+}
+
+// allowsType reports whether contentType is one of c.ContentTypes, or of uploadLinkDefaultTypes
+// when the link names none.
+func (c uploadLinkClaims) allowsType(contentType string) bool {
+	types := c.ContentTypes
+	if len(types) == 0 {
+		types = uploadLinkDefaultTypes
+	}
+	for _, t := range types {
+		if t == contentType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *apiKeyStore) issueUploadLink(c uploadLinkClaims) string {
+	payload, _ := json.Marshal(c)
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return uploadLinkPrefix + body + "." + base64.RawURLEncoding.EncodeToString(s.tokenMAC(uploadLinkPrefix+body))
+}
+
+// verifyUploadLink returns the claims of link if it was signed by s, is unexpired and the key
+// that minted it is still valid. The prefix is part of the MAC, so an access token is never
+// mistaken for a link.
+func (s *apiKeyStore) verifyUploadLink(link string, now time.Time) (uploadLinkClaims, error) {
+	var c uploadLinkClaims
+	body, sig, ok := strings.Cut(strings.TrimPrefix(link, uploadLinkPrefix), ".")
+	if !ok || !strings.HasPrefix(link, uploadLinkPrefix) || len(s.tokenSecret) == 0 {
+		return c, errAPIKeyInvalid
+	}
+	gotMAC, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotMAC, s.tokenMAC(uploadLinkPrefix+body)) {
+		return c, errAPIKeyInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || json.Unmarshal(payload, &c) != nil {
+		return c, errAPIKeyInvalid
+	}
+	if now.Unix() >= c.Expires {
+		return c, errAPIKeyExpired
+	}
+	if _, err := s.byName(c.Key, now); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+type uploadLinkRequest struct {
+	Prefix       string   `json:"prefix"`
+	MaxBytes     int64    `json:"maxBytes"`
+	ContentTypes []string `json:"contentTypes"`
+	ExpiresIn    int      `json:"expiresIn"` // seconds
+	SingleUse    bool     `json:"singleUse"`
+}
+
+// uploadLinksHandler serves the upload links of bucket:
+//
+//	POST /upload-links          mint a link for the caller's key (authenticated by apiKeyMiddleware)
+//	PUT|POST /upload-links/{link}  store the request body under the link's prefix, without a key
+//
+// Links expire after expiresIn seconds (default 24h, at most maxTTL). Uploads get a generated key
+// (prefix + uuid + the extension of ?filename=) so a link can never overwrite anything, and their
+// type is sniffed from the bytes rather than taken from the request. They go through
+// opts.Processors, and quarantine, like uploads through the bucket's objects mount.
+func uploadLinksHandler(client *minio.Client, bucket string, keys *apiKeyStore, maxTTL time.Duration, opts proxyOptions) http.HandlerFunc {
+	if maxTTL <= 0 {
+		maxTTL = 7 * 24 * time.Hour
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if link := strings.TrimPrefix(r.URL.Path, "/upload-links/"); link != r.URL.Path && link != "" {
+			uploadViaLink(client, bucket, keys, link, opts, w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if keys.viaToken(r) {
+			respondError(w, "access tokens cannot mint upload links", http.StatusForbidden)
+			return
+		}
+		name := apiKeyName(r.Context())
+		if name == "" {
+			respondUnauthorized(w)
+			return
+		}
+		var req uploadLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		prefix := strings.TrimPrefix(req.Prefix, "/")
+		if prefix == "" || !strings.HasSuffix(prefix, "/") || !tokenPathAllowed([]string{""}, prefix) ||
+			hiddenKey(opts, bucket, prefix) {
+			respondError(w, "prefix must be a folder (ending in /) without dot segments", http.StatusBadRequest)
+			return
+		}
+		if req.MaxBytes < 0 || req.MaxBytes > uploadLinkMaxBytes {
+			respondError(w, fmt.Sprintf("maxBytes must be between 1 and %d", uploadLinkMaxBytes), http.StatusBadRequest)
+			return
+		}
+		if req.MaxBytes == 0 {
+			req.MaxBytes = uploadLinkMaxBytes
+		}
+		for i, t := range req.ContentTypes {
+			mediaType, _, err := mime.ParseMediaType(t)
+			if err != nil || !strings.Contains(mediaType, "/") {
+				respondError(w, "invalid content type: "+t, http.StatusBadRequest)
+				return
+			}
+			req.ContentTypes[i] = mediaType
+		}
+		if len(req.ContentTypes) == 0 {
+			req.ContentTypes = uploadLinkDefaultTypes
+		}
+		ttl := uploadLinkDefaultTTL
+		if req.ExpiresIn > 0 {
+			ttl = time.Duration(req.ExpiresIn) * time.Second
+		}
+		ttl = min(ttl, maxTTL)
+		expires := time.Now().Add(ttl).Truncate(time.Second)
+		c := uploadLinkClaims{
+			ID: uuid.NewString(), Key: name, Expires: expires.Unix(), Prefix: prefix,
+			MaxBytes: req.MaxBytes, ContentTypes: req.ContentTypes, SingleUse: req.SingleUse,
+		}
+		link := keys.issueUploadLink(c)
+		metrics.add("kzen_upload_links_issued_total", 1, "key", name)
+		log.Printf("upload link %s for %s/%s issued by %q (expires %s, single use %t)", c.ID, bucket, prefix, name, expires.UTC().Format(time.RFC3339), c.SingleUse)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":           c.ID,
+			"link":         link,
+			"url":          "/upload-links/" + link,
+			"expiresAt":    expires.UTC(),
+			"prefix":       prefix,
+			"maxBytes":     c.MaxBytes,
+			"contentTypes": c.ContentTypes,
+			"singleUse":    c.SingleUse,
+		})
+	}
+}
+
+// uploadViaLink stores the body of an unauthenticated request under the prefix of link. A
+// single-use link is spent when the upload starts, and given back if it fails.
+func uploadViaLink(client *minio.Client, bucket string, keys *apiKeyStore, link string, opts proxyOptions, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now()
+	c, err := keys.verifyUploadLink(link, now)
+	if err != nil {
+		log.Printf("upload link rejected: %s: %v", clientIP(r), err)
+		respondErrorCode(w, "invalid or expired upload link", "invalid_link", http.StatusUnauthorized)
+		return
+	}
+	if r.ContentLength > c.MaxBytes {
+		respondErrorCode(w, "upload exceeds the link's maxBytes", "too_large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	body := bufio.NewReaderSize(http.MaxBytesReader(w, r.Body, c.MaxBytes), uploadLinkSniffBytes)
+	head, _ := body.Peek(uploadLinkSniffBytes)
+	if len(head) == 0 {
+		respondError(w, "empty body", http.StatusBadRequest)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !c.allowsType(contentType) {
+		respondErrorCode(w, errUploadLinkType.Error()+": "+contentType, "type_not_allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	spent := "upload link " + c.ID
+	if c.SingleUse && !keys.nonces.use(spent, time.Unix(c.Expires, 0), now) {
+		respondErrorCode(w, errUploadLinkUsed.Error(), "link_used", http.StatusGone)
+		return
+	}
+	ok := false
+	defer func() {
+		if c.SingleUse && !ok {
+			keys.nonces.forget(spent)
+		}
+	}()
+
+	ctx, cancel := golib.RequestContext(r, 10*time.Minute)
+	defer cancel()
+	if err := opts.UploadSlots.Acquire(ctx); err != nil {
+		respondUploadBusy(w, opts.UploadSlots, err)
+		return
+	}
+	defer opts.UploadSlots.Release()
+
+	ext := strings.ToLower(path.Ext(path.Base(r.URL.Query().Get("filename"))))
+	if exts, _ := mime.ExtensionsByType(contentType); ext == "" || len(ext) > 10 || (len(exts) > 0 && !slices.Contains(exts, ext)) {
+		ext = ""
+		if len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	objectKey := c.Prefix + uuid.NewString() + ext
+	meta := map[string]string{"Upload-Link": c.ID}
+	if opts.ownsObjects() {
+		meta[ownerMeta] = c.Key
+	}
+	var tooLarge *http.MaxBytesError
+	putOpts := minio.PutObjectOptions{ContentType: contentType, UserMetadata: meta}
+	var stored io.Reader = body
+	size := r.ContentLength
+	if size <= 0 {
+		size = -1
+	}
+	if len(opts.Processors) > 0 {
+		u := &Upload{Bucket: bucket, Key: objectKey, ContentType: contentType, Metadata: meta}
+		data, err := runProcessors(ctx, opts.Processors, u, body, c.MaxBytes)
+		var q *quarantineError
+		if errors.As(err, &q) {
+			qKey, err := quarantineUpload(ctx, client, u, data, q, opts.QuarantineWebhook, c.Key)
+			if err != nil {
+				log.Printf("upload link %s: quarantine %q: %v", c.ID, objectKey, err)
+				respondStorageError(w, err, "upload failed")
+				return
+			}
+			// The link is spent: the file was received, it just isn't served.
+			ok = true
+			log.Printf("upload link %s: %s/%s quarantined (%s) from %s", c.ID, bucket, objectKey, q.reason, clientIP(r))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "quarantined": true, "key": objectKey, "quarantineKey": qKey, "reason": q.reason})
+			return
+		}
+		if errors.As(err, &tooLarge) || errors.Is(err, errUploadTooLarge) {
+			respondErrorCode(w, "upload exceeds the link's maxBytes", "too_large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			respondProcessorError(w, objectKey, err)
+			return
+		}
+		putOpts.ContentType, putOpts.UserMetadata = u.ContentType, u.Metadata
+		stored, size = bytes.NewReader(data), int64(len(data))
+	}
+	info, err := client.PutObject(ctx, bucket, objectKey, stored, size, putOpts)
+	if err != nil {
+		if errors.As(err, &tooLarge) {
+			respondErrorCode(w, "upload exceeds the link's maxBytes", "too_large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		log.Printf("upload link %s: put %q: %v", c.ID, objectKey, err)
+		respondStorageError(w, err, "upload failed")
+		return
+	}
+	ok = true
+	opts.ByteStats.addIn(bucket, objectKey, info.Size)
+	opts.changed(bucket, objectKey)
+	metrics.add("kzen_upload_link_uploads_total", 1, "key", c.Key)
+	log.Printf("upload link %s: %s/%s (%d bytes) from %s", c.ID, bucket, objectKey, info.Size, clientIP(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "key": objectKey, "size": info.Size, "contentType": putOpts.ContentType})
+}
+
+func init() {
+	metrics.describe("kzen_upload_links_issued_total", "counter", "Upload links minted, by key.")
+	metrics.describe("kzen_upload_link_uploads_total", "counter", "Files stored through upload links, by the key that minted the link.")
+}
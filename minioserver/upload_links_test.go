@@ -0,0 +1,124 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadLinks(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	keys := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	keys.tokenSecret = accessTokenSecret(Config{AccessTokenSecret: "s"}, "")
+	h := apiKeyMiddleware(keys)(uploadLinksHandler(client, "files", keys, 0, proxyOptions{APIKeys: keys}))
+
+	mint := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/upload-links", strings.NewReader(body))
+		req.Header.Set("X-API-Key", "secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var resp map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	upload := func(url string, body []byte) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, url, bytes.NewReader(body)))
+		var resp map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+	code, link := mint(`{"prefix":"boards/7/","contentTypes":["image/*"],"maxBytes":100,"singleUse":true}`)
+	if code != http.StatusCreated || !strings.HasPrefix(link["link"].(string), uploadLinkPrefix) {
+		t.Fatalf("mint: %d %v", code, link)
+	}
+	url := link["url"].(string)
+	if code, _ := upload(url, []byte("just some text")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("text through an image link: %d, want 415", code)
+	}
+	if code, _ := upload(url, append(png, make([]byte, 100)...)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over maxBytes: %d, want 413", code)
+	}
+	code, resp := upload(url+"?filename=cat.png", png)
+	if code != http.StatusCreated {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	key := resp["key"].(string)
+	if !strings.HasPrefix(key, "boards/7/") || !strings.HasSuffix(key, ".png") || !bytes.Equal(objects[key], png) {
+		t.Errorf("stored %q", key)
+	}
+	if code, _ := upload(url, png); code != http.StatusGone {
+		t.Errorf("single-use link reused: %d, want 410", code)
+	}
+
+	if code, _ := upload("/upload-links/"+uploadLinkPrefix+"e30.AAAA", png); code != http.StatusUnauthorized {
+		t.Errorf("forged link: %d, want 401", code)
+	}
+	if code, _ := mint(`{"prefix":"boards/../secrets/"}`); code != http.StatusBadRequest {
+		t.Errorf("dot segments: %d, want 400", code)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload-links", strings.NewReader(`{"prefix":"boards/7/"}`)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("mint without a key: %d, want 401", rec.Code)
+	}
+}
+
+func TestUploadLinks_ProcessorsAndDefaultTypes(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	keys := newAPIKeyStore([]APIKey{{Name: "web", Key: "secret"}})
+	keys.tokenSecret = accessTokenSecret(Config{AccessTokenSecret: "s"}, "")
+	procs := []ProcessorFunc{func(ctx context.Context, u *Upload, data []byte) ([]byte, error) {
+		if bytes.Contains(data, []byte("EICAR")) {
+			return nil, Quarantine("EICAR")
+		}
+		u.Metadata["Processed"] = "yes"
+		return append(data, "!"...), nil
+	}}
+	h := apiKeyMiddleware(keys)(uploadLinksHandler(client, "files", keys, 0, proxyOptions{APIKeys: keys, Processors: procs}))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-links", strings.NewReader(`{"prefix":"boards/7/"}`))
+	req.Header.Set("X-API-Key", "secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var link struct {
+		URL          string   `json:"url"`
+		ContentTypes []string `json:"contentTypes"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &link)
+	if rec.Code != http.StatusCreated || len(link.ContentTypes) != len(uploadLinkDefaultTypes) {
+		t.Fatalf("mint without contentTypes: %d %s", rec.Code, rec.Body)
+	}
+	upload := func(body []byte) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, link.URL, bytes.NewReader(body)))
+		var resp map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	if code, _ := upload([]byte("<html><script>alert(1)</script></html>")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("HTML through a link without contentTypes: %d, want 415", code)
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	code, resp := upload(png)
+	if code != http.StatusCreated {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	if key := resp["key"].(string); !bytes.Equal(objects[key], append(png, '!')) {
+		t.Errorf("stored %q without running the processor: %q", key, objects[key])
+	}
+	code, resp = upload(append(png, "EICAR"...))
+	if code != http.StatusAccepted || resp["quarantined"] != true {
+		t.Fatalf("infected upload: %d %v", code, resp)
+	}
+	if key := resp["key"].(string); objects[key] != nil || objects[quarantinePrefix+key] == nil {
+		t.Errorf("infected upload stored at %q instead of quarantine", key)
+	}
+}
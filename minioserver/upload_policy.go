@@ -0,0 +1,162 @@
+package minioserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	uploadPolicyDefaultExpiry = time.Hour
+	// uploadPolicyMaxBytes is the largest object S3 accepts in one POST, and the default limit.
+	uploadPolicyMaxBytes = 5 << 30
+)
+
+type uploadPolicyRequest struct {
+	// Key is the exact key to upload to; otherwise the browser picks one under Prefix.
+	Key    string `json:"key"`
+	Prefix string `json:"prefix"`
+	// ContentType is an exact type, or "image/*" for any type with that prefix.
+	ContentType string `json:"contentType"`
+	MaxBytes    int64  `json:"maxBytes"`
+	// ExpiresIn is the policy lifetime in seconds (default 3600, max 7 days).
+	ExpiresIn int `json:"expiresIn"`
+}
+
+// uploadPolicyHandler serves POST /upload-policy: an S3 POST policy (form URL and fields) that
+// lets a browser upload one object straight to MinIO, so large files never pass through the
+// proxy. The policy pins the key (or a key prefix), the content type and the size range; MinIO
+// enforces them. presigner signs for the endpoint browsers reach, and keys are relative to
+// folderPrefix, as for /batch/urls. With auth on, the policy stamps the caller as the owner, an
+// exact key someone else owns is refused, and a prefix is narrowed to a new random folder under it.
+func uploadPolicyHandler(client, presigner *minio.Client, bucket string, folderPrefix string, opts proxyOptions) http.HandlerFunc {
+	folder := strings.Trim(folderPrefix, "/")
+	withFolder := func(k string) string {
+		if folder == "" {
+			return k
+		}
+		// path.Join would drop the trailing slash of a prefix.
+		return folder + "/" + k
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req uploadPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimSpace(req.Key), "/")
+		prefix := strings.TrimPrefix(strings.TrimSpace(req.Prefix), "/")
+		if (key == "") == (prefix == "") {
+			respondError(w, "exactly one of key and prefix required", http.StatusBadRequest)
+			return
+		}
+		if p := key + prefix; !tokenPathAllowed([]string{""}, p) || hiddenKey(opts, bucket, p) {
+			respondError(w, "invalid key or prefix", http.StatusBadRequest)
+			return
+		}
+		if prefix != "" && (!strings.HasSuffix(prefix, "/") || coversHiddenPrefix(prefix) || coversHiddenPrefix(withFolder(prefix))) {
+			respondError(w, "invalid prefix: it must end in / and not cover trash/, quarantine/ or reports", http.StatusBadRequest)
+			return
+		}
+		if key != "" && path.Clean(key) != key {
+			respondError(w, "invalid key", http.StatusBadRequest)
+			return
+		}
+		if req.MaxBytes < 0 || req.MaxBytes > uploadPolicyMaxBytes {
+			respondError(w, fmt.Sprintf("maxBytes must be between 1 and %d", int64(uploadPolicyMaxBytes)), http.StatusBadRequest)
+			return
+		}
+		if req.MaxBytes == 0 {
+			req.MaxBytes = uploadPolicyMaxBytes
+		}
+		expiry := uploadPolicyDefaultExpiry
+		if req.ExpiresIn > 0 {
+			expiry = min(time.Duration(req.ExpiresIn)*time.Second, batchURLsMaxExpiry)
+		}
+		expires := time.Now().Add(expiry).UTC().Truncate(time.Second)
+
+		ctx, cancel := golib.RequestContext(r, 30*time.Second)
+		defer cancel()
+
+		policy := minio.NewPostPolicy()
+		policy.SetBucket(bucket)
+		policy.SetExpires(expires)
+		policy.SetContentLengthRange(1, req.MaxBytes)
+		policy.SetSuccessStatusAction("201")
+		if key != "" {
+			key = withFolder(key)
+			if err := opts.checkOwner(ctx, client, bucket, key); err != nil {
+				respondOwnerError(w, err)
+				return
+			}
+			policy.SetKey(key)
+		} else {
+			prefix = withFolder(prefix)
+			if opts.ownsObjects() {
+				// A prefix would let the browser overwrite objects other keys own; a fresh folder
+				// under it holds nothing yet.
+				prefix += newNonce() + "/"
+			}
+			policy.SetKeyStartsWith(prefix)
+		}
+		if ct := strings.TrimSpace(req.ContentType); ct != "" {
+			if major, ok := strings.CutSuffix(ct, "/*"); ok && major != "" && !strings.Contains(major, "/") {
+				policy.SetContentTypeStartsWith(major + "/")
+			} else if mediaType, _, err := mime.ParseMediaType(ct); err == nil && strings.Contains(mediaType, "/") {
+				policy.SetContentType(ct)
+			} else {
+				respondError(w, "invalid content type: "+ct, http.StatusBadRequest)
+				return
+			}
+		}
+		if owner := apiKeyName(r.Context()); opts.ownsObjects() && owner != "" {
+			policy.SetUserMetadata(ownerMeta, owner)
+		}
+
+		u, fields, err := presigner.PresignedPostPolicy(ctx, policy)
+		if err != nil {
+			log.Printf("upload policy bucket=%q key=%q prefix=%q: %v", bucket, key, prefix, err)
+			respondStorageError(w, err, "failed to sign upload policy")
+			return
+		}
+
+		resp := map[string]any{
+			"url":       u.String(),
+			"fields":    fields,
+			"expiresAt": expires.Format(time.RFC3339),
+			"maxBytes":  req.MaxBytes,
+		}
+		if key != "" {
+			resp["key"] = key
+		} else {
+			resp["prefix"] = prefix
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// coversHiddenPrefix reports whether keys starting with prefix can land in the trash, quarantine or
+// report folders the object routes hide.
+func coversHiddenPrefix(prefix string) bool {
+	for _, hidden := range []string{trashPrefix, quarantinePrefix, inventoryPrefix, auditReportPrefix} {
+		if strings.HasPrefix(hidden, prefix) || strings.HasPrefix(prefix, hidden) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package minioserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestUploadPolicyHandler(t *testing.T) {
+	presigner, err := minio.New("s3.example.com", &minio.Options{
+		Creds:  credentials.NewStaticV4("ak", "sk", ""),
+		Secure: true,
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := uploadPolicyHandler(presigner, presigner, "kzen-storage", "/kzen", proxyOptions{})
+	post := func(body string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/kzen-storage-upload-policy", strings.NewReader(body)))
+		var resp map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := post(`{"prefix":"users/1/","contentType":"image/*","maxBytes":1048576,"expiresIn":600}`)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, resp)
+	}
+	if resp["url"] != "https://s3.example.com/kzen-storage/" || resp["prefix"] != "kzen/users/1/" {
+		t.Errorf("url %v, prefix %v", resp["url"], resp["prefix"])
+	}
+	fields := resp["fields"].(map[string]any)
+	if fields["key"] != "kzen/users/1/" || fields["x-amz-signature"] == nil {
+		t.Errorf("fields %v", fields)
+	}
+	policy, _ := base64.StdEncoding.DecodeString(fields["policy"].(string))
+	for _, want := range []string{`["starts-with","$key","kzen/users/1/"]`, `["starts-with","$Content-Type","image/"]`, `["content-length-range", 1, 1048576]`} {
+		if !strings.Contains(string(policy), want) {
+			t.Errorf("policy %s lacks %s", policy, want)
+		}
+	}
+
+	if code, resp := post(`{"key":"users/1/a.png","contentType":"image/png"}`); code != http.StatusOK || resp["key"] != "kzen/users/1/a.png" {
+		t.Errorf("exact key: %d %v", code, resp)
+	}
+	for _, body := range []string{`{}`, `{"key":"a","prefix":"b/"}`, `{"prefix":"users/../x/"}`, `{"prefix":"trash/"}`, `{"prefix":"t"}`, `{"prefix":"q"}`, `{"prefix":"users"}`, `{"prefix":"kzen-"}`, `{"prefix":"a/","maxBytes":-1}`, `{"prefix":"a/","contentType":"nope"}`} {
+		if code, _ := post(body); code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", body, code)
+		}
+	}
+
+	// With auth on, a prefix could overwrite objects other keys own: it is narrowed to a new folder.
+	owned := uploadPolicyHandler(presigner, presigner, "files", "", proxyOptions{APIKeys: newAPIKeyStore(nil)})
+	prefixes := map[string]bool{}
+	for range 2 {
+		rec := httptest.NewRecorder()
+		owned(rec, httptest.NewRequest(http.MethodPost, "/upload-policy", strings.NewReader(`{"prefix":"users/1/"}`)))
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		p, _ := resp["prefix"].(string)
+		rest, ok := strings.CutPrefix(p, "users/1/")
+		if rec.Code != http.StatusOK || !ok || len(rest) < 17 || !strings.HasSuffix(rest, "/") {
+			t.Errorf("owned prefix: %d %v", rec.Code, resp)
+		}
+		prefixes[p] = true
+	}
+	if len(prefixes) != 2 {
+		t.Errorf("owned prefixes repeat: %v", prefixes)
+	}
+}
@@ -0,0 +1,177 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"kzen-go/golib"
+)
+
+const (
+	verifyMaxPaths    = 10000
+	verifyMaxListed   = 100000
+	verifyConcurrency = 16
+)
+
+// objectStatLister is the part of *minio.Client that POST /verify uses.
+type objectStatLister interface {
+	objectLister
+	StatObject(ctx context.Context, bucket, object string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+}
+
+// verifyRequest is either a bare JSON array of paths or an object with paths and an optional
+// prefix. With a prefix, objects under it that no path references are reported as orphaned.
+type verifyRequest struct {
+	Paths  []string `json:"paths"`
+	Prefix string   `json:"prefix"`
+}
+
+func (v *verifyRequest) UnmarshalJSON(data []byte) error {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		return json.Unmarshal(data, &v.Paths)
+	}
+	type plain verifyRequest
+	return json.Unmarshal(data, (*plain)(v))
+}
+
+type verifyError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type verifyResult struct {
+	Checked  int           `json:"checked"`
+	Missing  []string      `json:"missing"`
+	Orphaned []string      `json:"orphaned,omitempty"`
+	Errors   []verifyError `json:"errors,omitempty"`
+}
+
+// verifyHandler serves POST /verify: checks that every DB path exists in the bucket and, when a
+// prefix is given, lists it to find objects no path references. Paths are relative to folderPrefix
+// like the upload handlers, and results use the same form so they can be matched to DB rows.
+// The proxy's own keys (see hiddenKey) are reported missing and never orphaned.
+func verifyHandler(client objectStatLister, bucket string, folderPrefix string, opts proxyOptions) http.HandlerFunc {
+	folder := strings.Trim(folderPrefix, "/")
+	toKey := func(p string) string {
+		p = strings.TrimPrefix(strings.TrimSpace(p), "/")
+		if folder == "" {
+			return p
+		}
+		return path.Join(folder, p)
+	}
+	fromKey := func(key string) string {
+		if folder == "" {
+			return key
+		}
+		return strings.TrimPrefix(key, folder+"/")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req verifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "invalid JSON body (expected an array of paths or {\"paths\":[...],\"prefix\":\"...\"})", http.StatusBadRequest)
+			return
+		}
+		if len(req.Paths) > verifyMaxPaths {
+			respondError(w, fmt.Sprintf("at most %d paths per request", verifyMaxPaths), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx, cancel := golib.RequestContext(r, 120*time.Second)
+		defer cancel()
+
+		// With a prefix, one listing answers existence for every path under it; paths elsewhere are
+		// stat'ed individually.
+		listed := map[string]bool{}
+		listPrefix := ""
+		if strings.TrimSpace(req.Prefix) != "" {
+			listPrefix = toKey(req.Prefix)
+			if !strings.HasSuffix(listPrefix, "/") {
+				listPrefix += "/"
+			}
+			for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: listPrefix, Recursive: true}) {
+				if obj.Err != nil {
+					log.Printf("verify list %q: %v", listPrefix, obj.Err)
+					respondError(w, "failed to list prefix", http.StatusBadGateway)
+					return
+				}
+				if hiddenKey(opts, bucket, obj.Key) {
+					continue
+				}
+				if len(listed) >= verifyMaxListed {
+					respondError(w, fmt.Sprintf("prefix has more than %d objects; use a narrower prefix", verifyMaxListed), http.StatusRequestEntityTooLarge)
+					return
+				}
+				listed[obj.Key] = false // set to true once referenced
+			}
+		}
+
+		res := verifyResult{Missing: []string{}}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, verifyConcurrency)
+		seen := make(map[string]bool, len(req.Paths))
+		for _, p := range req.Paths {
+			key := toKey(p)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			res.Checked++
+			if hiddenKey(opts, bucket, key) {
+				res.Missing = append(res.Missing, p)
+				continue
+			}
+			if listPrefix != "" && strings.HasPrefix(key, listPrefix) {
+				if _, ok := listed[key]; ok {
+					listed[key] = true
+				} else {
+					res.Missing = append(res.Missing, p)
+				}
+				continue
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(p, key string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				_, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+				case golib.IsNotFound(err):
+					res.Missing = append(res.Missing, p)
+				default:
+					res.Errors = append(res.Errors, verifyError{Path: p, Error: err.Error()})
+				}
+			}(p, key)
+		}
+		wg.Wait()
+
+		for key, referenced := range listed {
+			if !referenced {
+				res.Orphaned = append(res.Orphaned, fromKey(key))
+			}
+		}
+		sort.Strings(res.Missing)
+		sort.Strings(res.Orphaned)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
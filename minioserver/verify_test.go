@@ -0,0 +1,87 @@
+package minioserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+type mockObjectStatLister struct {
+	mockObjectLister
+}
+
+func (m *mockObjectStatLister) StatObject(_ context.Context, _ string, key string, _ minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	for _, obj := range m.objects {
+		if obj.Key == key {
+			return obj, nil
+		}
+	}
+	return minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey", Message: "The specified key does not exist.", StatusCode: http.StatusNotFound}
+}
+
+func TestVerifyHandler_MissingAndOrphaned(t *testing.T) {
+	client := &mockObjectStatLister{mockObjectLister{objects: []minio.ObjectInfo{
+		{Key: "kzen/users/1/a.jpeg"},
+		{Key: "kzen/users/1/b.jpeg"},
+		{Key: "kzen/users/1/orphan.jpeg"},
+		{Key: "kzen/shared/logo.png"},
+	}}}
+	h := verifyHandler(client, "kzen-storage", "/kzen", proxyOptions{})
+
+	body := `{"paths":["users/1/a.jpeg","/users/1/b.jpeg","users/1/gone.jpeg","shared/logo.png","shared/missing.png"],"prefix":"users/1"}`
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/kzen-storage-verify", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var res verifyResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 5 {
+		t.Errorf("checked = %d, want 5", res.Checked)
+	}
+	if want := []string{"shared/missing.png", "users/1/gone.jpeg"}; !reflect.DeepEqual(res.Missing, want) {
+		t.Errorf("missing = %v, want %v", res.Missing, want)
+	}
+	if want := []string{"users/1/orphan.jpeg"}; !reflect.DeepEqual(res.Orphaned, want) {
+		t.Errorf("orphaned = %v, want %v", res.Orphaned, want)
+	}
+}
+
+func TestVerifyHandler_BareArray(t *testing.T) {
+	client := &mockObjectStatLister{mockObjectLister{objects: []minio.ObjectInfo{{Key: "a.jpg"}}}}
+	rec := httptest.NewRecorder()
+	verifyHandler(client, "b", "", proxyOptions{})(rec, httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(`["a.jpg","b.jpg"]`)))
+	var res verifyResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Checked != 2 || !reflect.DeepEqual(res.Missing, []string{"b.jpg"}) || res.Orphaned != nil {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestVerifyHandler_HiddenKeys(t *testing.T) {
+	client := &mockObjectStatLister{mockObjectLister{objects: []minio.ObjectInfo{
+		{Key: "a.jpg"},
+		{Key: "quarantine/b.jpg"},
+		{Key: "trash/c.jpg"},
+	}}}
+	rec := httptest.NewRecorder()
+	verifyHandler(client, "b", "", proxyOptions{})(rec, httptest.NewRequest(http.MethodPost, "/verify",
+		strings.NewReader(`{"paths":["a.jpg","quarantine/b.jpg"],"prefix":"trash"}`)))
+	var res verifyResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Missing, []string{"quarantine/b.jpg"}) || len(res.Orphaned) != 0 {
+		t.Errorf("missing %v, orphaned %v", res.Missing, res.Orphaned)
+	}
+}
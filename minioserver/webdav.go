@@ -0,0 +1,549 @@
+package minioserver
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/net/webdav"
+
+	"kzen-go/golib"
+)
+
+const (
+	// webdavMaxEntries entries of a folder are listed at most.
+	webdavMaxEntries = 10000
+	// webdavMaxTree objects at most are deleted, moved or copied by one request on a folder.
+	webdavMaxTree = 10000
+	webdavMethods = "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, LOCK, UNLOCK, PROPFIND, PROPPATCH"
+)
+
+var (
+	errWebDAVTooMany = errors.New("webdav: too many objects under the folder")
+	errWebDAVHidden  = fmt.Errorf("webdav: reserved key: %w", fs.ErrPermission)
+)
+
+// davFS is a webdav.FileSystem over the keys under prefix in bucket. Folders are key prefixes:
+// one exists while any key is under it, and MKCOL keeps an empty one with a folder marker (an
+// empty object whose key ends in "/"). The keys the object routes hide are neither listed nor
+// writable.
+type davFS struct {
+	client *minio.Client
+	mount  Mount
+	opts   proxyOptions
+}
+
+func (d *davFS) key(name string) string {
+	return d.mount.Prefix + strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// dirKey is the prefix of the keys in folder key; the mount root is the mount prefix itself.
+func (d *davFS) dirKey(key string) string {
+	if key == d.mount.Prefix {
+		return key
+	}
+	return key + "/"
+}
+
+func (d *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	key := d.key(name)
+	if fi, ok := davStatsFrom(ctx)[key]; ok {
+		return fi, nil
+	}
+	if key == d.mount.Prefix {
+		return &davFileInfo{name: "/", dir: true}, nil
+	}
+	if hiddenKey(d.opts, d.mount.Bucket, key) || hiddenKey(d.opts, d.mount.Bucket, key+"/") {
+		return nil, fs.ErrNotExist
+	}
+	info, err := d.client.StatObject(ctx, d.mount.Bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return newDavFileInfo(info), nil
+	}
+	if !golib.IsNotFound(err) {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for obj := range d.client.ListObjects(ctx, d.mount.Bucket, minio.ListObjectsOptions{Prefix: key + "/", MaxKeys: 1}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		return &davFileInfo{name: path.Base(key), dir: true}, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (d *davFS) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	key := d.key(name)
+	if hiddenKey(d.opts, d.mount.Bucket, key+"/") {
+		return errWebDAVHidden
+	}
+	if _, err := d.Stat(ctx, name); err == nil {
+		return fs.ErrExist
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	_, err := d.client.PutObject(ctx, d.mount.Bucket, key+"/", bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+	return err
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	key := d.key(name)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return d.create(ctx, key)
+	}
+	fi, err := d.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	dfi := fi.(*davFileInfo)
+	if dfi.dir {
+		return &davDir{fs: d, ctx: ctx, dirKey: d.dirKey(key), info: dfi}, nil
+	}
+	obj, err := d.client.GetObject(ctx, d.mount.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &davReader{Object: obj, info: dfi}, nil
+}
+
+// create opens key for writing: the bytes are spooled to a temporary file and uploaded on Close.
+func (d *davFS) create(ctx context.Context, key string) (webdav.File, error) {
+	if key == d.mount.Prefix || hiddenKey(d.opts, d.mount.Bucket, key) {
+		return nil, errWebDAVHidden
+	}
+	if _, err := d.modifiable(ctx, key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "kzen-webdav-*")
+	if err != nil {
+		return nil, err
+	}
+	return &davWriter{fs: d, ctx: ctx, key: key, tmp: tmp}, nil
+}
+
+// modifiable stats key and checks the request's key may overwrite or delete it.
+func (d *davFS) modifiable(ctx context.Context, key string) (minio.ObjectInfo, error) {
+	info, err := d.client.StatObject(ctx, d.mount.Bucket, key, minio.StatObjectOptions{})
+	if golib.IsNotFound(err) {
+		return info, fs.ErrNotExist
+	}
+	if err != nil {
+		return info, err
+	}
+	if err := d.opts.mayModify(ctx, info); err != nil {
+		return info, fmt.Errorf("%w: %w", fs.ErrPermission, err)
+	}
+	return info, nil
+}
+
+// tree returns the keys in folder key, markers included, refusing folders over webdavMaxTree.
+func (d *davFS) tree(ctx context.Context, key string) ([]string, error) {
+	var keys []string
+	for obj := range d.client.ListObjects(ctx, d.mount.Bucket, minio.ListObjectsOptions{Prefix: d.dirKey(key), Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if hiddenKey(d.opts, d.mount.Bucket, obj.Key) {
+			continue
+		}
+		if len(keys) == webdavMaxTree {
+			return nil, errWebDAVTooMany
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+// remove deletes key, through the trash with soft delete on. Folder markers are just removed.
+func (d *davFS) remove(ctx context.Context, key string) error {
+	if strings.HasSuffix(key, "/") {
+		return d.client.RemoveObject(ctx, d.mount.Bucket, key, minio.RemoveObjectOptions{})
+	}
+	info, err := d.modifiable(ctx, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if d.opts.SoftDelete {
+		_, err = trashObject(ctx, d.client, d.mount.Bucket, info, apiKeyName(ctx))
+	} else {
+		err = d.client.RemoveObject(ctx, d.mount.Bucket, key, minio.RemoveObjectOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	d.opts.changed(d.mount.Bucket, key)
+	return nil
+}
+
+func (d *davFS) RemoveAll(ctx context.Context, name string) error {
+	key := d.key(name)
+	if key == d.mount.Prefix {
+		return fmt.Errorf("webdav: the root can't be removed: %w", fs.ErrPermission)
+	}
+	keys, err := d.tree(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, k := range append(keys, key) {
+		if err := d.remove(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename moves an object or every object of a folder with server-side copies.
+func (d *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	from, to := d.key(oldName), d.key(newName)
+	if from == d.mount.Prefix || to == d.mount.Prefix || strings.HasPrefix(to, from+"/") || hiddenKey(d.opts, d.mount.Bucket, from) || hiddenKey(d.opts, d.mount.Bucket, to) || hiddenKey(d.opts, d.mount.Bucket, to+"/") {
+		return errWebDAVHidden
+	}
+	keys, err := d.tree(ctx, from)
+	if err != nil {
+		return err
+	}
+	moves := map[string]string{from: to}
+	for _, k := range keys {
+		moves[k] = to + "/" + strings.TrimPrefix(k, from+"/")
+	}
+	for _, k := range append(keys, from) {
+		// Folder markers have no owner; from itself is no object when it is a folder.
+		if !strings.HasSuffix(k, "/") {
+			if _, err := d.modifiable(ctx, k); errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if _, err := d.client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: d.mount.Bucket, Object: moves[k]},
+			minio.CopySrcOptions{Bucket: d.mount.Bucket, Object: k}); err != nil {
+			return err
+		}
+		if err := d.client.RemoveObject(ctx, d.mount.Bucket, k, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+		d.opts.changed(d.mount.Bucket, k)
+		d.opts.changed(d.mount.Bucket, moves[k])
+	}
+	return nil
+}
+
+// davFileInfo describes an object, or a folder when dir is set.
+type davFileInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	dir         bool
+	etag        string
+	contentType string
+}
+
+func newDavFileInfo(info minio.ObjectInfo) *davFileInfo {
+	return &davFileInfo{
+		name:        path.Base(info.Key),
+		size:        info.Size,
+		modTime:     info.LastModified,
+		etag:        info.ETag,
+		contentType: info.ContentType,
+	}
+}
+
+func (fi *davFileInfo) Name() string       { return fi.name }
+func (fi *davFileInfo) Size() int64        { return fi.size }
+func (fi *davFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *davFileInfo) IsDir() bool        { return fi.dir }
+func (fi *davFileInfo) Sys() any           { return nil }
+
+func (fi *davFileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// ETag and ContentType spare webdav.Handler from opening every listed object.
+func (fi *davFileInfo) ETag(context.Context) (string, error) {
+	if fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + normalizeETag(fi.etag) + `"`, nil
+}
+
+func (fi *davFileInfo) ContentType(context.Context) (string, error) {
+	return cmp.Or(fi.contentType, mime.TypeByExtension(path.Ext(fi.name)), "application/octet-stream"), nil
+}
+
+// davStats holds what the folder listings of a PROPFIND found, keyed by object key, so the
+// handler's Stat of every entry doesn't cost a request to MinIO each.
+type davStats map[string]*davFileInfo
+
+type davStatsKey struct{}
+
+func withDavStats(ctx context.Context) context.Context {
+	return context.WithValue(ctx, davStatsKey{}, davStats{})
+}
+
+func davStatsFrom(ctx context.Context) davStats {
+	s, _ := ctx.Value(davStatsKey{}).(davStats)
+	return s
+}
+
+// davReader is an object opened for reading.
+type davReader struct {
+	*minio.Object
+	info *davFileInfo
+}
+
+func (f *davReader) Stat() (fs.FileInfo, error)         { return f.info, nil }
+func (f *davReader) Readdir(int) ([]fs.FileInfo, error) { return nil, fs.ErrInvalid }
+func (f *davReader) Write([]byte) (int, error)          { return 0, fs.ErrPermission }
+
+// davDir is a folder opened for listing.
+type davDir struct {
+	fs      *davFS
+	ctx     context.Context
+	dirKey  string
+	info    *davFileInfo
+	entries []fs.FileInfo
+	listed  bool
+}
+
+func (f *davDir) Read([]byte) (int, error)       { return 0, fs.ErrInvalid }
+func (f *davDir) Seek(int64, int) (int64, error) { return 0, nil }
+func (f *davDir) Write([]byte) (int, error)      { return 0, fs.ErrInvalid }
+func (f *davDir) Close() error                   { return nil }
+func (f *davDir) Stat() (fs.FileInfo, error)     { return f.info, nil }
+
+func (f *davDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if !f.listed {
+		if err := f.list(); err != nil {
+			return nil, err
+		}
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *davDir) list() error {
+	f.listed = true
+	stats := davStatsFrom(f.ctx)
+	for obj := range f.fs.client.ListObjects(f.ctx, f.fs.mount.Bucket, minio.ListObjectsOptions{Prefix: f.dirKey}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if obj.Key == f.dirKey || hiddenKey(f.fs.opts, f.fs.mount.Bucket, obj.Key) {
+			continue
+		}
+		if len(f.entries) == webdavMaxEntries {
+			log.Printf("webdav %s/%s: listing cut at %d entries", f.fs.mount.Bucket, f.dirKey, webdavMaxEntries)
+			break
+		}
+		fi := newDavFileInfo(obj)
+		key := obj.Key
+		if strings.HasSuffix(obj.Key, "/") {
+			key = strings.TrimSuffix(obj.Key, "/")
+			fi = &davFileInfo{name: path.Base(key), dir: true}
+		}
+		if stats != nil {
+			stats[key] = fi
+		}
+		f.entries = append(f.entries, fi)
+	}
+	return nil
+}
+
+// davWriter is an object being written; the upload happens on Close.
+type davWriter struct {
+	fs   *davFS
+	ctx  context.Context
+	key  string
+	tmp  *os.File
+	size int64
+}
+
+func (f *davWriter) Read([]byte) (int, error)           { return 0, fs.ErrInvalid }
+func (f *davWriter) Seek(int64, int) (int64, error)     { return 0, fs.ErrInvalid }
+func (f *davWriter) Readdir(int) ([]fs.FileInfo, error) { return nil, fs.ErrInvalid }
+
+func (f *davWriter) Stat() (fs.FileInfo, error) {
+	return &davFileInfo{name: path.Base(f.key), size: f.size, modTime: time.Now()}, nil
+}
+
+func (f *davWriter) Write(p []byte) (int, error) {
+	if limit := f.fs.opts.Multipart.MaxFileBytes; limit > 0 && f.size+int64(len(p)) > limit {
+		return 0, errUploadTooLarge
+	}
+	n, err := f.tmp.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close stores the object through the same pipeline as the object routes: the mount's processors
+// run over it, and an upload they quarantine is stored under quarantine/ and fails the PUT.
+func (f *davWriter) Close() error {
+	defer os.Remove(f.tmp.Name())
+	defer f.tmp.Close()
+	if _, err := f.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	d := f.fs
+	if err := d.opts.UploadSlots.Acquire(f.ctx); err != nil {
+		return err
+	}
+	defer d.opts.UploadSlots.Release()
+
+	by := apiKeyName(f.ctx)
+	putOpts := minio.PutObjectOptions{
+		ContentType:  cmp.Or(mime.TypeByExtension(path.Ext(f.key)), "application/octet-stream"),
+		StorageClass: d.mount.StorageClass,
+	}
+	var body io.Reader = f.tmp
+	size := f.size
+	if len(d.opts.Processors) > 0 {
+		u := &Upload{Bucket: d.mount.Bucket, Key: f.key, Filename: path.Base(f.key), ContentType: putOpts.ContentType, Metadata: map[string]string{}}
+		data, err := runProcessors(f.ctx, d.opts.Processors, u, f.tmp, d.opts.Multipart.MaxFileBytes)
+		var q *quarantineError
+		if errors.As(err, &q) {
+			if _, err := quarantineUpload(f.ctx, d.client, u, data, q, d.opts.QuarantineWebhook, by); err != nil {
+				return err
+			}
+			return q
+		}
+		if err != nil {
+			return err
+		}
+		putOpts.ContentType, putOpts.UserMetadata = u.ContentType, u.Metadata
+		body, size = bytes.NewReader(data), int64(len(data))
+	}
+	putOpts.UserMetadata = d.opts.stampOwner(f.ctx, putOpts.UserMetadata)
+	d.mount.Retention.apply(&putOpts, time.Now())
+	uploaded, err := d.client.PutObject(f.ctx, d.mount.Bucket, f.key, body, size, putOpts)
+	if err != nil {
+		return err
+	}
+	d.opts.ByteStats.addIn(d.mount.Bucket, f.key, f.size)
+	d.opts.changed(d.mount.Bucket, f.key)
+	d.opts.UploadWebhook.send("uploaded", uploadEvent(d.mount.Bucket, minio.ObjectInfo{Key: f.key, Size: uploaded.Size, ETag: uploaded.ETag},
+		putOpts.ContentType, by, "webdav"))
+	return nil
+}
+
+// webdavHandler serves a "webdav" mount: the mount's keys as a WebDAV share desktop file managers
+// can mount as a network drive. Folders are prefixes (see davFS). With API keys, every method
+// takes one; file managers send it as the Basic auth password (see webdavMiddleware). The mount's
+// upload and delete features gate the writing methods, and PROPFIND must ask for Depth 0 or 1.
+// Locks are held in memory, per process.
+func webdavHandler(client *minio.Client, m Mount, opts proxyOptions) http.HandlerFunc {
+	dav := &webdav.Handler{
+		Prefix:     strings.TrimSuffix(m.Route, "/"),
+		FileSystem: &davFS{client: client, mount: m, opts: opts},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("webdav %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	f := m.features()
+	return func(w http.ResponseWriter, r *http.Request) {
+		// apiKeyMiddleware checked every method but GET already.
+		if opts.APIKeys != nil && r.Method == http.MethodGet {
+			if _, err := opts.APIKeys.authenticate(r); err != nil {
+				respondUnauthorized(w)
+				return
+			}
+		}
+		switch r.Method {
+		case http.MethodPut, "MKCOL", "COPY", "PROPPATCH", "LOCK", "UNLOCK":
+			if !f.Upload {
+				respondError(w, "uploads are disabled on this route", http.StatusForbidden)
+				return
+			}
+		case http.MethodDelete, "MOVE":
+			if !f.Upload || !f.Delete {
+				respondError(w, "deletes are disabled on this route", http.StatusForbidden)
+				return
+			}
+		case "PROPFIND":
+			// An absent Depth means infinity, which would walk the whole mount (RFC 4918 9.1).
+			if d := r.Header.Get("Depth"); d != "0" && d != "1" {
+				respondErrorCode(w, "PROPFIND needs Depth: 0 or 1", "propfind_finite_depth", http.StatusForbidden)
+				return
+			}
+			r = r.WithContext(withDavStats(r.Context()))
+		case http.MethodGet, http.MethodHead:
+			key := m.Prefix + strings.TrimPrefix(r.URL.Path, m.Route)
+			withByteAccounting(opts.ByteStats, m.Bucket, key, w, r, dav.ServeHTTP)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}
+}
+
+// webdavMiddleware adapts requests for the webdav mounts of mounts to what file managers send,
+// ahead of CORS and auth: OPTIONS without a CORS preflight is answered with the DAV classes
+// (the CORS middleware would answer it without), and the password of Basic auth is taken as the
+// API key. WWW-Authenticate makes clients ask for it.
+func webdavMiddleware(mounts []Mount) func(http.Handler) http.Handler {
+	routes := http.NewServeMux()
+	n := 0
+	for _, m := range mounts {
+		if m.Type == MountTypeWebDAV {
+			routes.Handle(m.pattern(), http.NotFoundHandler())
+			n++
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		if n == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pattern := routes.Handler(r); pattern == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") == "" {
+				w.Header().Set("DAV", "1, 2")
+				w.Header().Set("MS-Author-Via", "DAV")
+				w.Header().Set("Allow", webdavMethods)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="kzen", charset="UTF-8"`)
+			if _, password, ok := r.BasicAuth(); ok {
+				r = r.Clone(r.Context())
+				r.Header.Del("Authorization")
+				r.Header.Set("X-API-Key", password)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
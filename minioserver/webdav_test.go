@@ -0,0 +1,128 @@
+package minioserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestWebDAVHandler(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	objects["share/a.txt"] = []byte("hello")
+	objects["share/docs/b.txt"] = []byte("bee")
+	objects["trash/share/c.txt~1"] = []byte("gone")
+	h := webdavHandler(client, Mount{Route: "/dav/", Bucket: "files", Prefix: "share/", Type: MountTypeWebDAV}, proxyOptions{})
+	do := func(method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	rec := do("PROPFIND", "/dav/", "", map[string]string{"Depth": "1"})
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: %d %s", rec.Code, rec.Body)
+	}
+	for _, want := range []string{"<D:href>/dav/a.txt</D:href>", "<D:href>/dav/docs/</D:href>", "<D:getcontentlength>5</D:getcontentlength>", "<D:collection"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("PROPFIND lacks %s:\n%s", want, rec.Body)
+		}
+	}
+	if rec := do("PROPFIND", "/dav/", "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("PROPFIND without Depth: %d, want 403", rec.Code)
+	}
+
+	if rec := do(http.MethodGet, "/dav/docs/b.txt", "", nil); rec.Code != http.StatusOK || rec.Body.String() != "bee" {
+		t.Errorf("GET: %d %q", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPut, "/dav/docs/new.txt", "new", nil); rec.Code != http.StatusCreated || string(objects["share/docs/new.txt"]) != "new" {
+		t.Errorf("PUT: %d, stored %q", rec.Code, objects["share/docs/new.txt"])
+	}
+	if rec := do("MKCOL", "/dav/empty/", "", nil); rec.Code != http.StatusCreated {
+		t.Errorf("MKCOL: %d", rec.Code)
+	}
+	if _, ok := objects["share/empty/"]; !ok {
+		t.Error("MKCOL left no folder marker")
+	}
+	rec = do("MOVE", "/dav/docs/", "", map[string]string{"Destination": "http://example.com/dav/moved/"})
+	if rec.Code != http.StatusCreated || string(objects["share/moved/b.txt"]) != "bee" || objects["share/docs/b.txt"] != nil {
+		t.Errorf("MOVE: %d, objects %v", rec.Code, objects)
+	}
+	if rec := do(http.MethodDelete, "/dav/moved/", "", nil); rec.Code != http.StatusNoContent || objects["share/moved/new.txt"] != nil {
+		t.Errorf("DELETE: %d, objects %v", rec.Code, objects)
+	}
+	if rec := do(http.MethodGet, "/dav/../trash/share/c.txt~1", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET outside the prefix: %d", rec.Code)
+	}
+
+	readOnly := webdavHandler(client, Mount{Route: "/dav/", Bucket: "files", Prefix: "share/", Type: MountTypeWebDAV, Features: &MountFeatures{}}, proxyOptions{})
+	rec = httptest.NewRecorder()
+	readOnly(rec, httptest.NewRequest(http.MethodPut, "/dav/x.txt", strings.NewReader("x")))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("PUT on a read-only mount: %d", rec.Code)
+	}
+}
+
+// WebDAV uploads go through the mount's processors like uploads on the object routes.
+func TestWebDAVHandler_Processors(t *testing.T) {
+	client, objects := selfTestS3(t, false)
+	flagExe := func(ctx context.Context, u *Upload, data []byte) ([]byte, error) {
+		if path.Ext(u.Key) == ".exe" {
+			return nil, Quarantine("executable")
+		}
+		return data, nil
+	}
+	h := webdavHandler(client, Mount{Route: "/dav/", Bucket: "files", Prefix: "share/", Type: MountTypeWebDAV},
+		proxyOptions{Processors: []ProcessorFunc{flagExe}})
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, "/dav/setup.exe", strings.NewReader("MZ")))
+	if rec.Code < 400 {
+		t.Errorf("PUT of a quarantined file: %d", rec.Code)
+	}
+	if _, ok := objects["share/setup.exe"]; ok || string(objects["quarantine/share/setup.exe"]) != "MZ" {
+		t.Errorf("quarantined PUT: objects %q", objects)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPut, "/dav/notes.txt", strings.NewReader("ok")))
+	if rec.Code != http.StatusCreated || string(objects["share/notes.txt"]) != "ok" {
+		t.Errorf("PUT: %d, objects %q", rec.Code, objects)
+	}
+}
+
+func TestWebDAVMiddleware(t *testing.T) {
+	var got *http.Request
+	h := webdavMiddleware([]Mount{{Route: "/dav/", Type: MountTypeWebDAV}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/dav/", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("DAV") != "1, 2" || got != nil {
+		t.Errorf("OPTIONS: %d %v", rec.Code, rec.Header())
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/dav/a", nil)
+	req.SetBasicAuth("me", "secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got == nil || got.Header.Get("X-API-Key") != "secret" || got.Header.Get("Authorization") != "" || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Basic auth not turned into the API key: %v", got)
+	}
+
+	got = nil
+	preflight := httptest.NewRequest(http.MethodOptions, "/dav/", nil)
+	preflight.Header.Set("Access-Control-Request-Method", "PUT")
+	h.ServeHTTP(httptest.NewRecorder(), preflight)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodOptions, "/objects/a", nil))
+	if got == nil || got.URL.Path != "/objects/a" {
+		t.Error("other requests not passed through")
+	}
+}
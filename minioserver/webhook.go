@@ -0,0 +1,77 @@
+package minioserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// webhook POSTs JSON events to an operator-configured URL. Deliveries run in the background
+// and are not retried; failures are logged and counted. A nil webhook drops events.
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhook(url string) *webhook {
+	if url == "" {
+		return nil
+	}
+	return &webhook{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// send delivers {"event": event, ...payload fields} without blocking the caller.
+func (h *webhook) send(event string, payload map[string]any) {
+	if h == nil {
+		return
+	}
+	body := map[string]any{"event": event, "time": time.Now().UTC()}
+	for k, v := range payload {
+		body[k] = v
+	}
+	h.deliver(event, body)
+}
+
+// deliver posts body as is, for receivers with their own format (e.g. Slack's {"text": ...});
+// event only labels logs and metrics.
+func (h *webhook) deliver(event string, body any) {
+	if h == nil {
+		return
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("webhook %s: %v", event, err)
+		return
+	}
+	go func() {
+		if err := h.post(data); err != nil {
+			log.Printf("webhook %s: %v", event, err)
+			metrics.add("kzen_webhook_failures_total", 1, "event", event)
+		}
+	}()
+}
+
+func (h *webhook) post(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", h.url, resp.Status)
+	}
+	return nil
+}
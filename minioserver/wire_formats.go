@@ -0,0 +1,228 @@
+package minioserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"mime"
+	"sort"
+	"strings"
+)
+
+// wireFormat is a response encoding negotiated from Accept. Handlers always produce JSON; other
+// formats are transcoded from it by apiVersionMiddleware, so they carry exactly the same data.
+type wireFormat int
+
+const (
+	formatJSON wireFormat = iota
+	formatMsgpack
+	formatCBOR
+)
+
+func (f wireFormat) contentType() string {
+	switch f {
+	case formatMsgpack:
+		return "application/msgpack"
+	case formatCBOR:
+		return "application/cbor"
+	default:
+		return "application/json"
+	}
+}
+
+// negotiateFormat picks the first msgpack or CBOR type listed in accept; anything else (including
+// wildcards) means JSON. q-values are not weighed: clients that want a binary format list it.
+func negotiateFormat(accept string) wireFormat {
+	for _, part := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+			return formatMsgpack
+		case "application/cbor":
+			return formatCBOR
+		}
+	}
+	return formatJSON
+}
+
+// transcodeJSON re-encodes a JSON document in format f.
+func transcodeJSON(data []byte, f wireFormat) ([]byte, error) {
+	if f == formatJSON {
+		return data, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if f == formatMsgpack {
+		writeMsgpack(&buf, v)
+	} else {
+		writeCBOR(&buf, v)
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonNumber returns n as an int64 when it is integral and fits, otherwise as a float64.
+func jsonNumber(n json.Number) (int64, float64, bool) {
+	if i, err := n.Int64(); err == nil {
+		return i, 0, true
+	}
+	f, _ := n.Float64()
+	return 0, f, false
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeMsgpack encodes a value decoded from JSON (nil, bool, json.Number, string, []any,
+// map[string]any) in MessagePack using the smallest representation for each value.
+func writeMsgpack(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		i, f, isInt := jsonNumber(v)
+		if !isInt {
+			buf.WriteByte(0xcb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+			return
+		}
+		switch {
+		case i >= 0 && i < 128, i < 0 && i >= -32:
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt8 && i <= math.MaxInt8:
+			buf.WriteByte(0xd0)
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(i))
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(i))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, i)
+		}
+	case string:
+		n := len(v)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(v)
+	case []any:
+		writeMsgpackHeader(buf, len(v), 0x90, 0xdc)
+		for _, e := range v {
+			writeMsgpack(buf, e)
+		}
+	case map[string]any:
+		writeMsgpackHeader(buf, len(v), 0x80, 0xde)
+		for _, k := range sortedKeys(v) {
+			writeMsgpack(buf, k)
+			writeMsgpack(buf, v[k])
+		}
+	}
+}
+
+// writeMsgpackHeader writes an array or map header: fix is the fixarray/fixmap base and ext the
+// 16-bit variant (the 32-bit one follows it).
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix, ext byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(ext)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(ext + 1)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeCBOR encodes a value decoded from JSON in CBOR (RFC 8949) with definite lengths, shortest
+// integer heads and map keys in sorted order.
+func writeCBOR(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case json.Number:
+		i, f, isInt := jsonNumber(v)
+		switch {
+		case !isInt:
+			buf.WriteByte(0xfb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		case i >= 0:
+			writeCBORHead(buf, 0, uint64(i))
+		default:
+			writeCBORHead(buf, 1, uint64(-1-i))
+		}
+	case string:
+		writeCBORHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeCBORHead(buf, 4, uint64(len(v)))
+		for _, e := range v {
+			writeCBOR(buf, e)
+		}
+	case map[string]any:
+		writeCBORHead(buf, 5, uint64(len(v)))
+		for _, k := range sortedKeys(v) {
+			writeCBOR(buf, k)
+			writeCBOR(buf, v[k])
+		}
+	}
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		buf.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(m | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(m | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(m | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(m | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}